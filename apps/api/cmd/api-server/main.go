@@ -1,27 +1,53 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/dendianugerah/velld/internal"
+	"github.com/dendianugerah/velld/internal/audit"
 	"github.com/dendianugerah/velld/internal/auth"
 	"github.com/dendianugerah/velld/internal/backup"
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/connection"
 	"github.com/dendianugerah/velld/internal/database"
+	"github.com/dendianugerah/velld/internal/events"
+	"github.com/dendianugerah/velld/internal/logging"
 	"github.com/dendianugerah/velld/internal/middleware"
 	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/rules"
 	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/dendianugerah/velld/internal/team"
+	"github.com/dendianugerah/velld/internal/telemetry"
+	"github.com/dendianugerah/velld/internal/webhook"
 	"github.com/gorilla/mux"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func main() {
+	logFile, err := logging.Setup()
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	defer logFile.Close()
+
 	secrets := common.GetSecrets()
 
+	shutdownTracing, err := telemetry.InitTracing(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	if telemetry.Enabled() {
+		slog.Info("Exporting traces over OTLP")
+	}
+
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
 		dbPath = filepath.Join("data", "velld.db")
@@ -41,7 +67,7 @@ func main() {
 	connManager := connection.NewConnectionManager()
 
 	authRepo := auth.NewAuthRepository(db)
-	authService := auth.NewAuthService(authRepo, secrets.JWTSecret)
+	authService := auth.NewAuthService(authRepo, secrets.JWTSecret, secrets.AdminUsernameCredential, secrets.IsAllowSignup)
 
 	if !secrets.IsAllowSignup {
 		// create one admin user if isAllowSignup is false
@@ -50,9 +76,9 @@ func main() {
 		}
 		_, err := authService.CreateNewUserByEnvData(secrets.AdminUsernameCredential, secrets.AdminPasswordCredential)
 		if err != nil {
-			log.Println(err)
+			slog.Warn("Failed to create admin user", "error", err)
 		} else {
-			log.Println("Admin user created")
+			slog.Info("Admin user created")
 		}
 	}
 
@@ -62,7 +88,9 @@ func main() {
 	}
 
 	connRepo := connection.NewConnectionRepository(db, cryptoService)
-	connService := connection.NewConnectionService(connRepo, connManager)
+	// Domain events are broadcast to the event streams of their users
+	eventService := events.NewEventService()
+	connService := connection.NewConnectionService(connRepo, connManager, eventService)
 
 	authHandler := auth.NewAuthHandler(authService)
 
@@ -71,39 +99,83 @@ func main() {
 	r := mux.NewRouter()
 	r.Use(middleware.CORS)
 
-	healthHandler := internal.NewHealthHandler(db)
-	r.HandleFunc("/health", healthHandler.CheckHealth).Methods("GET", "OPTIONS")
-
 	// Public routes
 	api := r.PathPrefix("/api").Subrouter()
 	api.HandleFunc("/auth/register", authHandler.Register).Methods("POST", "OPTIONS")
 	api.HandleFunc("/auth/login", authHandler.Login).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/register/invite", authHandler.RegisterWithInvite).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/invites/{token}", authHandler.GetInviteDetails).Methods("GET", "OPTIONS")
+	api.HandleFunc("/auth/refresh", authHandler.Refresh).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/password/forgot", authHandler.ForgotPassword).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/password/reset", authHandler.ResetPassword).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/email/verify", authHandler.VerifyEmail).Methods("POST", "OPTIONS")
+	api.HandleFunc("/auth/email/verify/resend", authHandler.ResendVerification).Methods("POST", "OPTIONS")
 
 	// Protected routes
 	protected := api.PathPrefix("").Subrouter()
 	protected.Use(authMiddleware.RequireAuth)
+	// Requests made while an admin impersonates a user are audited
+	protected.Use(authHandler.AuditImpersonation)
+	// Tokens of deactivated users are refused before they expire
+	protected.Use(authHandler.RejectDeactivated)
+	// Changes and data exports are recorded in the append-only audit log
+	auditHandler := audit.NewAuditHandler(audit.NewAuditService(audit.NewAuditRepository(db)))
+	protected.Use(auditHandler.RecordActions)
 	protected.HandleFunc("/auth/profile", authHandler.GetProfile).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/auth/email", authHandler.UpdateEmail).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/auth/sessions", authHandler.GetSessions).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/auth/sessions", authHandler.RevokeOtherSessions).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/auth/sessions/{id}", authHandler.RevokeSession).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/auth/impersonation/end", authHandler.EndCurrentImpersonation).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/admin/impersonate", authHandler.Impersonate).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/admin/impersonations", authHandler.GetImpersonationSessions).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/admin/impersonations/{id}", authHandler.GetImpersonationSession).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/admin/impersonations/{id}/end", authHandler.EndImpersonation).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/admin/invites", authHandler.GetInvites).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/admin/invites", authHandler.CreateInvite).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/admin/invites/{id}", authHandler.RevokeInvite).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/admin/orphans", authHandler.GetOrphanedConnections).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/admin/users/{username}/deactivate", authHandler.DeactivateUser).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/admin/users/{username}/reactivate", authHandler.ReactivateUser).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/admin/users/{username}/transfer", authHandler.TransferOwnership).Methods("POST", "OPTIONS")
 
 	backupRepo := backup.NewBackupRepository(db)
 	settingsRepo := settings.NewSettingsRepository(db)
 	notificationRepo := notification.NewNotificationRepository(db)
 	settingsService := settings.NewSettingsService(settingsRepo, cryptoService)
+	webhookService := webhook.NewWebhookService(webhook.NewWebhookRepository(db), cryptoService)
+	ruleService := rules.NewRuleService(rules.NewRuleRepository(db), connRepo)
 
 	backupService := backup.NewBackupService(
 		connRepo,
+		connService,
 		"./backups",
 		backupRepo,
 		settingsService,
 		notificationRepo,
+		webhookService,
+		eventService,
+		ruleService,
 		cryptoService,
 	)
 
+	healthHandler := internal.NewHealthHandler(db, backupService)
+	r.HandleFunc("/health", healthHandler.CheckHealth).Methods("GET", "OPTIONS")
+	// Probes for container orchestrators and uptime monitors
+	r.HandleFunc("/healthz", healthHandler.Liveness).Methods("GET", "OPTIONS")
+	r.HandleFunc("/readyz", healthHandler.Readiness).Methods("GET", "OPTIONS")
+
 	// Create connHandler after backupService is available
 	connHandler := connection.NewConnectionHandler(connService, backupService)
 
 	protected.HandleFunc("/connections/test", connHandler.TestConnection).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/connections/import", connHandler.ImportConnections).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/connections/{id}/discover", connHandler.DiscoverDatabases).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/privileges", connHandler.CheckDumpPrivileges).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/credentials/check", connHandler.CheckCredentials).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/connections/{id}/databases", connHandler.UpdateSelectedDatabases).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/tags", connHandler.UpdateTags).Methods("PUT", "OPTIONS")
 	protected.HandleFunc("/connections/{id}/settings", connHandler.UpdateConnectionSettings).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/connections/{id}", connHandler.GetConnection).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/connections/{id}", connHandler.DeleteConnection).Methods("DELETE", "OPTIONS")
@@ -115,28 +187,219 @@ func main() {
 
 	protected.HandleFunc("/backups/stats", backupHandler.GetBackupStats).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/backups/schedule", backupHandler.ScheduleBackup).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/schedule/simulate", backupHandler.SimulateSchedule).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/schedule/preview", backupHandler.PreviewCronSchedule).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups", backupHandler.CreateBackup).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups", backupHandler.ListBackups).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/runs", backupHandler.GetBackupRuns).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/runs/{id}", backupHandler.GetBackupRun).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/estimate", backupHandler.GetBackupSizeEstimate).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/capabilities", backupHandler.GetEngineCapabilities).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/catalog", backupHandler.SearchBackupCatalog).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/transfers", backupHandler.GetActiveTransfers).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/live-logs", backupHandler.GetLiveLogs).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/live-logs/{id}", backupHandler.StreamLiveLog).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/progress", backupHandler.GetProgress).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/progress/stream", backupHandler.StreamProgress).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/logs", backupHandler.GetRunLogs).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/logs/{id}", backupHandler.GetRunLog).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/logs/{id}/follow", backupHandler.FollowRunLog).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/restore-history", backupHandler.GetRestoreRecords).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/restore-history/{id}", backupHandler.GetRestoreRecord).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/restores", backupHandler.GetRestoreJobs).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/restores/{id}", backupHandler.GetRestoreJob).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/restores/{id}/cancel", backupHandler.CancelRestoreJob).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/imports", backupHandler.GetDumpImports).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/imports", backupHandler.CreateDumpImport).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/imports/{id}", backupHandler.GetDumpImport).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/imports/{id}", backupHandler.AppendDumpImport).Methods("PATCH", "OPTIONS")
+	protected.HandleFunc("/backups/imports/{id}", backupHandler.CancelDumpImport).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/backups/imports/{id}/restore", backupHandler.RestoreDumpImport).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/sandboxes", backupHandler.GetRestoreSandboxes).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/sandboxes", backupHandler.CreateRestoreSandbox).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/sandboxes/{id}", backupHandler.GetRestoreSandbox).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/sandboxes/{id}", backupHandler.RemoveRestoreSandbox).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/backups/dedup", backupHandler.GetDedupStats).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/uploads/presign", backupHandler.PresignBackupUpload).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/uploads/complete", backupHandler.CompleteBackupUpload).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/access-log", backupHandler.GetConnectionAccessLog).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/point-in-time", backupHandler.GetPointInTimePlan).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/point-in-time", backupHandler.RestoreToPointInTime).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/maintenance-windows", backupHandler.GetMaintenanceWindows).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/maintenance-windows", backupHandler.CreateMaintenanceWindow).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/maintenance-windows/{id}", backupHandler.UpdateMaintenanceWindow).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/backups/maintenance-windows/{id}", backupHandler.DeleteMaintenanceWindow).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/backups/reconciliation", backupHandler.GetStorageFindings).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/reconciliation", backupHandler.ReconcileStorage).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/reconciliation/{id}/resolve", backupHandler.ResolveStorageFinding).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/incidents", backupHandler.GetIncidents).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/digest/send", backupHandler.SendDigest).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/calendar", backupHandler.GetBackupCalendar).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/backups/{id}", backupHandler.GetBackup).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/backups/{id}/download", backupHandler.DownloadBackup).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/access-log", backupHandler.GetBackupAccessLog).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/manifest", backupHandler.GetBackupManifest).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/download", backupHandler.DownloadBackup).Methods("GET", "HEAD", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/verify-encryption", backupHandler.VerifyBackupEncryption).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/signature", backupHandler.VerifyBackupSignature).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/verify", backupHandler.VerifyBackupIntegrity).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/prepare", backupHandler.PreparePhysicalBackup).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/restore-verification", backupHandler.GetRestoreVerification).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/restore-verification", backupHandler.VerifyBackupByRestore).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/restore-to", backupHandler.RestoreToConnection).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/upload", backupHandler.GetUploadProgress).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/upload/resume", backupHandler.ResumeUpload).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/reproduce", backupHandler.GetBackupReproduction).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/toc", backupHandler.GetBackupTOC).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/backups/restore", backupHandler.RestoreBackup).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups/compare/{sourceId}/{targetId}", backupHandler.CompareBackups).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/backups/{connection_id}/schedule/disable", backupHandler.DisableBackupSchedule).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/schedule/pause", backupHandler.PauseSchedule).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/schedule/resume", backupHandler.ResumeSchedule).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups/{connection_id}/schedule", backupHandler.UpdateBackupSchedule).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/schedule", backupHandler.GetBackupSchedule).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/retention/preview", backupHandler.PreviewRetention).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/capabilities", backupHandler.GetConnectionCapabilities).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/size-history", backupHandler.GetSizeHistory).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/badge-token", backupHandler.GetBadgeToken).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/badge-token", backupHandler.IssueBadgeToken).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/badge-token", backupHandler.RevokeBadgeToken).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/reports/retention", backupHandler.GetRetentionReport).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/reports/sla", backupHandler.GetSLAReport).Methods("GET", "OPTIONS")
+
+	// Freshness checks for Nagios/Zabbix-style monitoring use MONITORING_TOKEN
+	// instead of a user session
+	if secrets.MonitoringToken != "" {
+		monitoring := api.PathPrefix("/monitoring").Subrouter()
+		monitoring.Use(middleware.NewTokenMiddleware(secrets.MonitoringToken).RequireToken)
+		monitoring.HandleFunc("/freshness", backupHandler.GetBackupFreshness).Methods("GET", "OPTIONS")
+	}
+
+	// Status badges take the connection's badge token in the query, so they
+	// can be embedded as images
+	api.HandleFunc("/badges/{connection_id}/status.svg", backupHandler.GetBadgeSVG).Methods("GET", "OPTIONS")
+	api.HandleFunc("/badges/{connection_id}/status.json", backupHandler.GetBadgeJSON).Methods("GET", "OPTIONS")
 
 	settingsHandler := settings.NewSettingsHandler(settingsService)
 
 	protected.HandleFunc("/settings", settingsHandler.GetSettings).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/settings", settingsHandler.UpdateSettings).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/settings/discord/test", settingsHandler.TestDiscordWebhook).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/settings/incidents/test", settingsHandler.TestIncidentIntegration).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/settings/push/test", settingsHandler.TestPushNotification).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/settings/matrix/test", settingsHandler.TestMatrixNotification).Methods("POST", "OPTIONS")
 
 	notificationService := notification.NewNotificationService(notificationRepo)
 	notificationHandler := notification.NewNotificationHandler(notificationService)
 
 	protected.HandleFunc("/notifications", notificationHandler.GetNotifications).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/notifications/mark-read", notificationHandler.MarkAsRead).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/notifications/deliveries", notificationHandler.GetDeliveries).Methods("GET", "OPTIONS")
+
+	webhookHandler := webhook.NewWebhookHandler(webhookService)
+
+	protected.HandleFunc("/webhooks", webhookHandler.GetWebhooks).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/webhooks", webhookHandler.CreateWebhook).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/webhooks/deliveries/{id}/redeliver", webhookHandler.Redeliver).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}", webhookHandler.GetWebhook).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}", webhookHandler.UpdateWebhook).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}", webhookHandler.DeleteWebhook).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}/test", webhookHandler.TestWebhook).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/webhooks/{id}/deliveries", webhookHandler.GetDeliveries).Methods("GET", "OPTIONS")
+
+	teamHandler := team.NewTeamHandler(team.NewTeamService(team.NewTeamRepository(db), connRepo))
 
-	log.Println("Server starting on :8080")
-	if err := http.ListenAndServe(":8080", r); err != nil {
+	protected.HandleFunc("/teams", teamHandler.GetTeams).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/teams", teamHandler.CreateTeam).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/teams/{id}", teamHandler.GetTeam).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/teams/{id}", teamHandler.UpdateTeam).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/teams/{id}", teamHandler.DeleteTeam).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/teams/{id}/members", teamHandler.GetMembers).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/teams/{id}/members", teamHandler.AddMember).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/teams/{id}/members/{user_id}", teamHandler.UpdateMember).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/teams/{id}/members/{user_id}", teamHandler.RemoveMember).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/connections/{id}/team", teamHandler.SetConnectionTeam).Methods("PUT", "OPTIONS")
+
+	eventHandler := events.NewEventHandler(eventService)
+
+	protected.HandleFunc("/events/stream", eventHandler.StreamEvents).Methods("GET", "OPTIONS")
+
+	ruleHandler := rules.NewRuleHandler(ruleService)
+
+	protected.HandleFunc("/notification-rules", ruleHandler.GetRules).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/notification-rules", ruleHandler.CreateRule).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/notification-rules/{id}", ruleHandler.GetRule).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/notification-rules/{id}", ruleHandler.UpdateRule).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/notification-rules/{id}", ruleHandler.DeleteRule).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/notification-rules/{id}/events", ruleHandler.GetRuleEvents).Methods("GET", "OPTIONS")
+
+	// Bulk artifact exports can copy any user's backups, so they are
+	// restricted to the admin
+	exports := protected.PathPrefix("/admin/exports").Subrouter()
+	exports.Use(authHandler.RequireAdmin)
+	exports.HandleFunc("", backupHandler.CreateArtifactExport).Methods("POST", "OPTIONS")
+	exports.HandleFunc("", backupHandler.GetArtifactExports).Methods("GET", "OPTIONS")
+	exports.HandleFunc("/{id}", backupHandler.GetArtifactExport).Methods("GET", "OPTIONS")
+	exports.HandleFunc("/{id}/resume", backupHandler.ResumeArtifactExport).Methods("POST", "OPTIONS")
+	exports.HandleFunc("/{id}/cancel", backupHandler.CancelArtifactExport).Methods("POST", "OPTIONS")
+
+	// The audit log covers every user, so it is restricted to the admin
+	auditLog := protected.PathPrefix("/admin/audit-events").Subrouter()
+	auditLog.Use(authHandler.RequireAdmin)
+	auditLog.HandleFunc("", auditHandler.GetEvents).Methods("GET", "OPTIONS")
+	auditLog.HandleFunc("/export", auditHandler.ExportEvents).Methods("GET", "OPTIONS")
+
+	// Housekeeping cleans up files of every user, so it is restricted to the admin
+	housekeeper := internal.NewHousekeeper()
+	housekeeping := protected.PathPrefix("/admin/housekeeping").Subrouter()
+	housekeeping.Use(authHandler.RequireAdmin)
+	housekeeping.HandleFunc("", housekeeper.HandleGetMetrics).Methods("GET", "OPTIONS")
+	housekeeping.HandleFunc("", housekeeper.HandleRun).Methods("POST", "OPTIONS")
+
+	// Reloading applies server-wide configuration, so it is restricted to the admin
+	reloader := internal.NewReloader(backupService, housekeeper)
+	reload := protected.PathPrefix("/admin/reload").Subrouter()
+	reload.Use(authHandler.RequireAdmin)
+	reload.HandleFunc("", reloader.HandleReload).Methods("POST", "OPTIONS")
+
+	// Reload configuration on SIGHUP without interrupting in-flight backups
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			if _, err := reloader.Reload(); err != nil {
+				slog.Error("Failed to reload configuration", "error", err)
+			}
+		}
+	}()
+
+	// SIGINT and SIGTERM stop the server gracefully, so the deferred cleanup
+	// runs and spans still buffered are exported
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	slog.Info("Server starting", "addr", srv.Addr)
+	select {
+	case err := <-serveErr:
 		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("Server shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shut down server", "error", err)
+	}
+
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
 	}
 }
@@ -0,0 +1,310 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxBodyPeek is the largest request body read for the IDs it names;
+	// larger bodies are passed on unread
+	maxBodyPeek = 1 << 20
+	// maxResponsePeek is the largest response read for the ID of a created
+	// resource
+	maxResponsePeek = 64 << 10
+	// maxUserAgentLength keeps an oversized header out of the log
+	maxUserAgentLength = 512
+)
+
+type AuditHandler struct {
+	service *AuditService
+}
+
+func NewAuditHandler(service *AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// responseRecorder captures the status of a response and, when asked to,
+// the start of its body
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	capture bool
+	body    bytes.Buffer
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.capture && w.body.Len() < maxResponsePeek {
+		w.body.Write(p[:min(len(p), maxResponsePeek-w.body.Len())])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the writer, so streamed
+// responses can still be flushed
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// peekBody decodes a JSON request body and puts it back for the handler.
+// Bodies that are too large or not JSON objects decode to nil.
+func peekBody(r *http.Request) map[string]interface{} {
+	if r.Body == nil {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBodyPeek+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+	if err != nil || len(data) > maxBodyPeek {
+		return nil
+	}
+
+	var body map[string]interface{}
+	if json.Unmarshal(data, &body) != nil {
+		return nil
+	}
+	return body
+}
+
+// bodyValue returns a field of a request body as text
+func bodyValue(body map[string]interface{}, field string) string {
+	switch value := body[field].(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// createdID returns the id of the data of a JSON response
+func createdID(data []byte) string {
+	var created struct {
+		Data struct {
+			ID interface{} `json:"id"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(data, &created) != nil || created.Data.ID == nil {
+		return ""
+	}
+	return fmt.Sprint(created.Data.ID)
+}
+
+// newEvent describes the request's action by the signed-in user
+func newEvent(r *http.Request, userID uuid.UUID, audited auditedRoute, status int) *Event {
+	event := &Event{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Action:       audited.action,
+		ResourceType: audited.resourceType,
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		Status:       status,
+		RemoteAddr:   r.RemoteAddr,
+		CreatedAt:    time.Now(),
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		event.RemoteAddr = host
+	}
+	if userAgent := r.UserAgent(); userAgent != "" {
+		if len(userAgent) > maxUserAgentLength {
+			userAgent = userAgent[:maxUserAgentLength]
+		}
+		event.UserAgent = &userAgent
+	}
+
+	if claims, ok := r.Context().Value("user").(jwt.MapClaims); ok {
+		if username, _ := claims["username"].(string); username != "" {
+			event.Username = &username
+		}
+		if impersonator, _ := claims["impersonator"].(string); impersonator != "" {
+			event.Impersonator = &impersonator
+		}
+	}
+
+	return event
+}
+
+// RecordActions runs after RequireAuth and records the requests of audited
+// routes once they are answered, whatever their outcome. Request bodies
+// are only read for the IDs they name; secrets are never recorded.
+func (h *AuditHandler) RecordActions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		audited, ok := auditedRoutes[r.Method+" "+template]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, err := common.GetUserIDFromContext(r.Context())
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body map[string]interface{}
+		if audited.idField != "" || len(audited.detailFields) > 0 || len(audited.credentialFields) > 0 {
+			body = peekBody(r)
+		}
+
+		recorder := &responseRecorder{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+			capture:        audited.idVar == "" && audited.idField == "",
+		}
+		next.ServeHTTP(recorder, r)
+
+		event := newEvent(r, userID, audited, recorder.status)
+		var resourceID string
+		switch {
+		case audited.idVar != "":
+			resourceID = mux.Vars(r)[audited.idVar]
+		case audited.idField != "":
+			resourceID = bodyValue(body, audited.idField)
+		case recorder.status < http.StatusBadRequest:
+			resourceID = createdID(recorder.body.Bytes())
+		}
+		if resourceID != "" {
+			event.ResourceID = &resourceID
+		}
+
+		var details []string
+		for _, field := range audited.detailFields {
+			if value := bodyValue(body, field); value != "" {
+				details = append(details, field+"="+value)
+			}
+		}
+		if len(details) > 0 {
+			detail := strings.Join(details, ", ")
+			event.Detail = &detail
+		}
+		events := []*Event{event}
+
+		var changed []string
+		for _, field := range audited.credentialFields {
+			if bodyValue(body, field) != "" {
+				changed = append(changed, field)
+			}
+		}
+		if len(changed) > 0 {
+			credentials := newEvent(r, userID, audited, recorder.status)
+			credentials.Action = ActionCredentialsUpdate
+			credentials.ResourceID = event.ResourceID
+			detail := "changed " + strings.Join(changed, ", ")
+			credentials.Detail = &detail
+			events = append(events, credentials)
+		}
+
+		for _, e := range events {
+			if err := h.service.RecordEvent(e); err != nil {
+				slog.Error("Failed to record audit event", "action", e.Action, "path", e.Path, "error", err)
+			}
+		}
+	})
+}
+
+// parseFilter reads the filter of a listing or export from the query
+func parseFilter(r *http.Request) (EventFilter, error) {
+	query := r.URL.Query()
+	filter := EventFilter{
+		UserID:       query.Get("user_id"),
+		Action:       query.Get("action"),
+		ResourceType: query.Get("resource_type"),
+		ResourceID:   query.Get("resource_id"),
+	}
+
+	for name, dest := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 time", name)
+		}
+		*dest = &t
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return filter, fmt.Errorf("to must not be before from")
+	}
+	return filter, nil
+}
+
+func (h *AuditHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page := 1
+	limit := defaultEventListLimit
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, maxEventListLimit)
+		}
+	}
+	filter.Limit = limit
+	filter.Offset = (page - 1) * limit
+
+	events, total, err := h.service.GetEvents(filter)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendPaginatedSuccess(w, "Audit events retrieved successfully", events, page, limit, total)
+}
+
+func (h *AuditHandler) ExportEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("velld-audit-%s.csv", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := h.service.ExportCSV(w, filter); err != nil {
+		// The status is already sent, so the export is cut short
+		slog.Error("Failed to export audit events", "error", err)
+	}
+}
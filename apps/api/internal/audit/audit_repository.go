@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+)
+
+type AuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+const eventColumns = `id, user_id, username, impersonator, action, resource_type, resource_id, detail,
+	method, path, status, remote_addr, user_agent, created_at`
+
+func scanEvent(rows *sql.Rows) (*Event, error) {
+	event := &Event{}
+	var username, impersonator, resourceID, detail, userAgent sql.NullString
+	var createdAtStr string
+	if err := rows.Scan(&event.ID, &event.UserID, &username, &impersonator, &event.Action, &event.ResourceType,
+		&resourceID, &detail, &event.Method, &event.Path, &event.Status, &event.RemoteAddr, &userAgent,
+		&createdAtStr); err != nil {
+		return nil, err
+	}
+	if username.Valid {
+		event.Username = &username.String
+	}
+	if impersonator.Valid {
+		event.Impersonator = &impersonator.String
+	}
+	if resourceID.Valid {
+		event.ResourceID = &resourceID.String
+	}
+	if detail.Valid {
+		event.Detail = &detail.String
+	}
+	if userAgent.Valid {
+		event.UserAgent = &userAgent.String
+	}
+
+	var err error
+	if event.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (r *AuditRepository) CreateEvent(event *Event) error {
+	_, err := r.db.Exec(`
+		INSERT INTO audit_events (`+eventColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`,
+		event.ID, event.UserID, event.Username, event.Impersonator, event.Action, event.ResourceType,
+		event.ResourceID, event.Detail, event.Method, event.Path, event.Status, event.RemoteAddr,
+		event.UserAgent, event.CreatedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+// filterClause builds the WHERE clause of a filter. Times are stored in UTC,
+// so they compare as text.
+func filterClause(filter EventFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID != "" {
+		add("user_id = $%d", filter.UserID)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		add("resource_type = $%d", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		add("resource_id = $%d", filter.ResourceID)
+	}
+	if filter.From != nil {
+		add("created_at >= $%d", filter.From.UTC().Format(time.RFC3339))
+	}
+	if filter.To != nil {
+		add("created_at <= $%d", filter.To.UTC().Format(time.RFC3339))
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// GetEvents returns a page of the events matching the filter, newest first,
+// with the number of matching events
+func (r *AuditRepository) GetEvents(filter EventFilter) ([]*Event, int, error) {
+	where, args := filterClause(filter)
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM audit_events`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM audit_events%s ORDER BY created_at DESC, rowid DESC LIMIT $%d OFFSET $%d`,
+		eventColumns, where, len(args)+1, len(args)+2)
+	rows, err := r.db.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+	}
+	return events, total, rows.Err()
+}
+
+// EachEvent calls fn with every event matching the filter, oldest first,
+// without holding them all in memory
+func (r *AuditRepository) EachEvent(filter EventFilter, fn func(*Event) error) error {
+	where, args := filterClause(filter)
+	rows, err := r.db.Query(`SELECT `+eventColumns+` FROM audit_events`+where+` ORDER BY created_at, rowid`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
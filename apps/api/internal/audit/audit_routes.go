@@ -0,0 +1,98 @@
+package audit
+
+// auditedRoute describes the action a route takes and where its request
+// names the resource acted on
+type auditedRoute struct {
+	action       string
+	resourceType string
+	// idVar is the route variable holding the resource's ID
+	idVar string
+	// idField is the field of the JSON request body holding it. Routes with
+	// neither take it from the id of the response's data, as creates do.
+	idField string
+	// detailFields are fields of the JSON request body recorded as the
+	// event's detail, such as the target of a restore
+	detailFields []string
+	// credentialFields are fields of the JSON request body holding secrets;
+	// setting any of them records a credentials.update event as well
+	credentialFields []string
+}
+
+var connectionCredentialFields = []string{"password", "ssh_password", "ssh_private_key"}
+
+var settingsCredentialFields = []string{
+	"smtp_password", "s3_access_key", "s3_secret_key", "webhook_url", "discord_webhook_url",
+	"pagerduty_routing_key", "opsgenie_api_key", "ntfy_token", "gotify_token", "matrix_access_token",
+	"digest_slack_webhook_url",
+}
+
+// auditedRoutes are the routes recorded in the audit log, by method and
+// path template. Every route that changes state belongs here, as do the
+// reads that copy data out of velld. Checks, previews and tests that change
+// nothing are left out.
+var auditedRoutes = map[string]auditedRoute{
+	"POST /api/connections":                              {action: "connection.create", resourceType: ResourceConnection, credentialFields: connectionCredentialFields},
+	"PUT /api/connections":                               {action: "connection.update", resourceType: ResourceConnection, idField: "id", credentialFields: connectionCredentialFields},
+	"DELETE /api/connections/{id}":                       {action: "connection.delete", resourceType: ResourceConnection, idVar: "id"},
+	"POST /api/connections/import":                       {action: "connection.import", resourceType: ResourceConnection},
+	"PUT /api/connections/{id}/databases":                {action: "connection.update_databases", resourceType: ResourceConnection, idVar: "id"},
+	"PUT /api/connections/{id}/tags":                     {action: "connection.update_tags", resourceType: ResourceConnection, idVar: "id"},
+	"PUT /api/connections/{id}/team":                     {action: "connection.update_team", resourceType: ResourceConnection, idVar: "id", detailFields: []string{"team_id"}},
+	"POST /api/connections/{id}/settings":                {action: "connection.update_settings", resourceType: ResourceConnection, idVar: "id"},
+	"POST /api/backups/schedule":                         {action: "schedule.create", resourceType: ResourceSchedule, idField: "connection_id"},
+	"PUT /api/backups/{connection_id}/schedule":          {action: "schedule.update", resourceType: ResourceSchedule, idVar: "connection_id"},
+	"POST /api/backups/{connection_id}/schedule/disable": {action: "schedule.disable", resourceType: ResourceSchedule, idVar: "connection_id"},
+	"POST /api/backups/{connection_id}/schedule/pause":   {action: "schedule.pause", resourceType: ResourceSchedule, idVar: "connection_id"},
+	"POST /api/backups/{connection_id}/schedule/resume":  {action: "schedule.resume", resourceType: ResourceSchedule, idVar: "connection_id"},
+	"POST /api/backups/{connection_id}/badge-token":      {action: "badge_token.issue", resourceType: ResourceConnection, idVar: "connection_id"},
+	"DELETE /api/backups/{connection_id}/badge-token":    {action: "badge_token.revoke", resourceType: ResourceConnection, idVar: "connection_id"},
+	"POST /api/backups":                                  {action: "backup.create", resourceType: ResourceBackup, detailFields: []string{"connection_id"}},
+	"GET /api/backups/{id}/download":                     {action: "backup.download", resourceType: ResourceBackup, idVar: "id"},
+	"POST /api/backups/{id}/verify":                      {action: "backup.verify", resourceType: ResourceBackup, idVar: "id"},
+	"POST /api/backups/{id}/prepare":                     {action: "backup.prepare", resourceType: ResourceBackup, idVar: "id"},
+	"POST /api/backups/{id}/restore-verification":        {action: "backup.verify_restore", resourceType: ResourceBackup, idVar: "id"},
+	"POST /api/backups/{id}/upload/resume":               {action: "backup.resume_upload", resourceType: ResourceBackup, idVar: "id"},
+	"POST /api/backups/uploads/complete":                 {action: "backup.upload", resourceType: ResourceBackup},
+	"POST /api/backups/restore":                          {action: "restore.start", resourceType: ResourceBackup, idField: "backup_id", detailFields: []string{"connection_id"}},
+	"POST /api/backups/{id}/restore-to":                  {action: "restore.start", resourceType: ResourceBackup, idVar: "id", detailFields: []string{"connection_id", "database_name"}},
+	"POST /api/backups/point-in-time":                    {action: "restore.point_in_time", resourceType: ResourceConnection, idField: "connection_id", detailFields: []string{"target_time", "database"}},
+	"POST /api/backups/restores/{id}/cancel":             {action: "restore.cancel", resourceType: ResourceRestore, idVar: "id"},
+	"POST /api/backups/imports":                          {action: "import.create", resourceType: ResourceImport},
+	"DELETE /api/backups/imports/{id}":                   {action: "import.cancel", resourceType: ResourceImport, idVar: "id"},
+	"POST /api/backups/imports/{id}/restore":             {action: "restore.import", resourceType: ResourceImport, idVar: "id", detailFields: []string{"connection_id"}},
+	"POST /api/backups/sandboxes":                        {action: "sandbox.create", resourceType: ResourceSandbox, detailFields: []string{"backup_id"}},
+	"DELETE /api/backups/sandboxes/{id}":                 {action: "sandbox.delete", resourceType: ResourceSandbox, idVar: "id"},
+	"POST /api/backups/maintenance-windows":              {action: "maintenance_window.create", resourceType: ResourceMaintenanceWindow},
+	"PUT /api/backups/maintenance-windows/{id}":          {action: "maintenance_window.update", resourceType: ResourceMaintenanceWindow, idVar: "id"},
+	"DELETE /api/backups/maintenance-windows/{id}":       {action: "maintenance_window.delete", resourceType: ResourceMaintenanceWindow, idVar: "id"},
+	"POST /api/backups/reconciliation/{id}/resolve":      {action: "storage.resolve_finding", resourceType: ResourceBackup, idVar: "id"},
+	"PUT /api/settings":                                  {action: "settings.update", resourceType: ResourceSettings, credentialFields: settingsCredentialFields},
+	"POST /api/webhooks":                                 {action: "webhook.create", resourceType: ResourceWebhook},
+	"PUT /api/webhooks/{id}":                             {action: "webhook.update", resourceType: ResourceWebhook, idVar: "id"},
+	"DELETE /api/webhooks/{id}":                          {action: "webhook.delete", resourceType: ResourceWebhook, idVar: "id"},
+	"POST /api/notification-rules":                       {action: "notification_rule.create", resourceType: ResourceNotificationRule},
+	"PUT /api/notification-rules/{id}":                   {action: "notification_rule.update", resourceType: ResourceNotificationRule, idVar: "id"},
+	"DELETE /api/notification-rules/{id}":                {action: "notification_rule.delete", resourceType: ResourceNotificationRule, idVar: "id"},
+	"POST /api/teams":                                    {action: "team.create", resourceType: ResourceTeam},
+	"PUT /api/teams/{id}":                                {action: "team.update", resourceType: ResourceTeam, idVar: "id"},
+	"DELETE /api/teams/{id}":                             {action: "team.delete", resourceType: ResourceTeam, idVar: "id"},
+	"POST /api/teams/{id}/members":                       {action: "team.add_member", resourceType: ResourceTeam, idVar: "id", detailFields: []string{"username", "role"}},
+	"PUT /api/teams/{id}/members/{user_id}":              {action: "team.update_member", resourceType: ResourceTeam, idVar: "id", detailFields: []string{"role"}},
+	"DELETE /api/teams/{id}/members/{user_id}":           {action: "team.remove_member", resourceType: ResourceTeam, idVar: "id"},
+	"POST /api/admin/impersonate":                        {action: "impersonation.start", resourceType: ResourceImpersonation, detailFields: []string{"username"}},
+	"POST /api/admin/impersonations/{id}/end":            {action: "impersonation.end", resourceType: ResourceImpersonation, idVar: "id"},
+	"PUT /api/auth/email":                                {action: "user.update_email", resourceType: ResourceUser},
+	"DELETE /api/auth/sessions":                          {action: "session.revoke_others", resourceType: ResourceSession},
+	"DELETE /api/auth/sessions/{id}":                     {action: "session.revoke", resourceType: ResourceSession, idVar: "id"},
+	"POST /api/auth/impersonation/end":                   {action: "impersonation.end", resourceType: ResourceImpersonation},
+	"POST /api/admin/invites":                            {action: "invite.create", resourceType: ResourceInvite, detailFields: []string{"email", "team_id", "role"}},
+	"DELETE /api/admin/invites/{id}":                     {action: "invite.revoke", resourceType: ResourceInvite, idVar: "id"},
+	"POST /api/admin/users/{username}/deactivate":        {action: "user.deactivate", resourceType: ResourceUser, idVar: "username"},
+	"POST /api/admin/users/{username}/reactivate":        {action: "user.reactivate", resourceType: ResourceUser, idVar: "username"},
+	"POST /api/admin/users/{username}/transfer":          {action: "user.transfer_ownership", resourceType: ResourceUser, idVar: "username"},
+	"POST /api/admin/exports":                            {action: "export.create", resourceType: ResourceExport},
+	"POST /api/admin/exports/{id}/resume":                {action: "export.resume", resourceType: ResourceExport, idVar: "id"},
+	"POST /api/admin/exports/{id}/cancel":                {action: "export.cancel", resourceType: ResourceExport, idVar: "id"},
+	"POST /api/admin/housekeeping":                       {action: "system.housekeeping", resourceType: ResourceSystem},
+	"POST /api/admin/reload":                             {action: "system.reload", resourceType: ResourceSystem},
+}
@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEventListLimit = 100
+	maxEventListLimit     = 1000
+)
+
+// csvHeader is the header row of an export
+var csvHeader = []string{
+	"id", "created_at", "user_id", "username", "impersonator", "action", "resource_type", "resource_id",
+	"detail", "method", "path", "status", "remote_addr", "user_agent",
+}
+
+type AuditService struct {
+	repo *AuditRepository
+}
+
+func NewAuditService(repo *AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// RecordEvent appends an event to the audit log
+func (s *AuditService) RecordEvent(event *Event) error {
+	return s.repo.CreateEvent(event)
+}
+
+// GetEvents returns a page of the events matching the filter, newest first
+func (s *AuditService) GetEvents(filter EventFilter) ([]*Event, int, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultEventListLimit
+	}
+	if filter.Limit > maxEventListLimit {
+		filter.Limit = maxEventListLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.repo.GetEvents(filter)
+}
+
+// ExportCSV writes every event matching the filter as CSV, oldest first
+func (s *AuditService) ExportCSV(w io.Writer, filter EventFilter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	err := s.repo.EachEvent(filter, func(event *Event) error {
+		return writer.Write(csvRow(
+			event.ID.String(),
+			event.CreatedAt.UTC().Format(time.RFC3339),
+			event.UserID.String(),
+			stringValue(event.Username),
+			stringValue(event.Impersonator),
+			event.Action,
+			event.ResourceType,
+			stringValue(event.ResourceID),
+			stringValue(event.Detail),
+			event.Method,
+			event.Path,
+			strconv.Itoa(event.Status),
+			event.RemoteAddr,
+			stringValue(event.UserAgent),
+		))
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvRow escapes cells a spreadsheet would evaluate as formulas, since paths,
+// details and user agents come from requests
+func csvRow(cells ...string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Resource types of audit events
+const (
+	ResourceConnection        = "connection"
+	ResourceSchedule          = "schedule"
+	ResourceBackup            = "backup"
+	ResourceRestore           = "restore"
+	ResourceImport            = "import"
+	ResourceSandbox           = "sandbox"
+	ResourceMaintenanceWindow = "maintenance_window"
+	ResourceSettings          = "settings"
+	ResourceWebhook           = "webhook"
+	ResourceNotificationRule  = "notification_rule"
+	ResourceTeam              = "team"
+	ResourceUser              = "user"
+	ResourceSession           = "session"
+	ResourceInvite            = "invite"
+	ResourceImpersonation     = "impersonation"
+	ResourceExport            = "export"
+	ResourceSystem            = "system"
+)
+
+// ActionCredentialsUpdate is recorded next to the action of a request that
+// changed stored credentials, naming the fields that changed
+const ActionCredentialsUpdate = "credentials.update"
+
+// Event is one action taken through the API: who took it, on what, and
+// whether it succeeded. Events are append-only; the database refuses to
+// change or delete them.
+type Event struct {
+	ID       uuid.UUID `json:"id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Username *string   `json:"username,omitempty"`
+	// Impersonator is the admin who acted as the user, if any
+	Impersonator *string `json:"impersonator,omitempty"`
+	Action       string  `json:"action"`
+	ResourceType string  `json:"resource_type"`
+	ResourceID   *string `json:"resource_id,omitempty"`
+	// Detail names what else the action touched, such as the target of a
+	// restore or the credential fields that changed. It never holds
+	// secret values.
+	Detail     *string   `json:"detail,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	RemoteAddr string    `json:"remote_addr"`
+	UserAgent  *string   `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// EventFilter narrows a listing or export of events. Empty fields match
+// every event.
+type EventFilter struct {
+	UserID       string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	From         *time.Time
+	To           *time.Time
+	Limit        int
+	Offset       int
+}
@@ -16,14 +16,14 @@ func NewAuthHandler(authService *AuthService) *AuthHandler {
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
-	var req LoginRequest
+	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.SendError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if err := h.authService.Register(req.Username, req.Password); err != nil {
-		response.SendError(w, http.StatusInternalServerError, err.Error())
+	if err := h.authService.Register(req.Username, req.Password, req.Email); err != nil {
+		sendAccountError(w, err)
 		return
 	}
 
@@ -37,21 +37,25 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.authService.Login(req.Username, req.Password)
+	tokens, err := h.authService.Login(req.Username, req.Password, sessionClientOf(r))
+	if err == ErrEmailNotVerified {
+		response.SendError(w, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
 		response.SendError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	response.SendSuccess(w, "Login successful", LoginResponse{Token: token})
+	response.SendSuccess(w, "Login successful", tokens)
 }
 
 func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
-	username, err := h.authService.GetProfile(r.Context())
+	profile, err := h.authService.GetProfile(r.Context())
 	if err != nil {
 		response.SendError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
-	response.SendSuccess(w, "Profile retrieved successfully", ProfileResponse{Username: username})
+	response.SendSuccess(w, "Profile retrieved successfully", profile)
 }
@@ -3,6 +3,11 @@ package auth
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/google/uuid"
 )
 
 type AuthRepository struct {
@@ -16,19 +21,705 @@ func NewAuthRepository(db *sql.DB) *AuthRepository {
 }
 
 func (r *AuthRepository) CreateUser(data User) error {
-	_, err := r.db.Exec("INSERT INTO users (id, username, password, created_at) VALUES ($1, $2, $3, $4)", data.ID, data.Username, data.Password, data.CreatedAt)
+	_, err := r.db.Exec("INSERT INTO users (id, username, password, created_at, email) VALUES ($1, $2, $3, $4, $5)", data.ID, data.Username, data.Password, data.CreatedAt, data.Email)
 	return err
 }
 
-func (r *AuthRepository) GetUserByUsername(username string) (*User, error) {
+const userColumns = `id, username, password, deactivated_at, email, email_verified_at`
+
+func scanUser(row rowScanner) (*User, error) {
 	var user User
-	err := r.db.QueryRow("SELECT id, username, password FROM users WHERE username = $1", username).
-		Scan(&user.ID, &user.Username, &user.Password)
+	var deactivatedAt, email, emailVerifiedAt sql.NullString
+	if err := row.Scan(&user.ID, &user.Username, &user.Password, &deactivatedAt, &email, &emailVerifiedAt); err != nil {
+		return nil, err
+	}
+	if deactivatedAt.Valid {
+		user.DeactivatedAt = &deactivatedAt.String
+	}
+	if email.Valid {
+		user.Email = &email.String
+	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.String
+	}
+	return &user, nil
+}
+
+// GetUserByUsername looks up a user signing in, without telling whether the
+// user exists
+func (r *AuthRepository) GetUserByUsername(username string) (*User, error) {
+	user, err := scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = $1", username))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errors.New("invalid credentials")
 		}
 		return nil, err
 	}
-	return &user, nil
+	return user, nil
+}
+
+// FindUserByUsername returns sql.ErrNoRows for unknown users
+func (r *AuthRepository) FindUserByUsername(username string) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE username = $1", username))
+}
+
+func (r *AuthRepository) GetUserByID(id string) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1", id))
+}
+
+// FindUserByEmail returns sql.ErrNoRows for unknown addresses. Emails are
+// stored in lower case.
+func (r *AuthRepository) FindUserByEmail(email string) (*User, error) {
+	return scanUser(r.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email = $1", email))
+}
+
+// SetUserEmail changes a user's email, which is unverified until verifiedAt
+// is set
+func (r *AuthRepository) SetUserEmail(id uuid.UUID, email *string, verifiedAt *string) error {
+	_, err := r.db.Exec("UPDATE users SET email = $1, email_verified_at = $2 WHERE id = $3", email, verifiedAt, id)
+	return err
+}
+
+// MarkEmailVerified verifies the user's email if it is still the address
+// the verification was sent to
+func (r *AuthRepository) MarkEmailVerified(id uuid.UUID, email string, at string) error {
+	_, err := r.db.Exec("UPDATE users SET email_verified_at = $1 WHERE id = $2 AND email = $3", at, id, email)
+	return err
+}
+
+func (r *AuthRepository) SetUserPassword(id uuid.UUID, password string) error {
+	_, err := r.db.Exec("UPDATE users SET password = $1 WHERE id = $2", password, id)
+	return err
+}
+
+// SetUserDeactivatedAt deactivates a user, or reactivates them when at is nil
+func (r *AuthRepository) SetUserDeactivatedAt(id uuid.UUID, at *string) error {
+	_, err := r.db.Exec("UPDATE users SET deactivated_at = $1 WHERE id = $2", at, id)
+	return err
+}
+
+func (r *AuthRepository) CreateAuthToken(token *AuthToken) error {
+	_, err := r.db.Exec(`
+		INSERT INTO auth_tokens (id, user_id, kind, token_hash, email, expires_at, used_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULL, $7)`,
+		token.ID, token.UserID, token.Kind, token.TokenHash, token.Email,
+		token.ExpiresAt.UTC().Format(time.RFC3339), token.CreatedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (r *AuthRepository) GetAuthTokenByHash(kind, tokenHash string) (*AuthToken, error) {
+	var (
+		token                string
+		expiresAt, createdAt string
+		usedAt               sql.NullString
+	)
+	authToken := &AuthToken{}
+	err := r.db.QueryRow(`
+		SELECT id, user_id, kind, token_hash, email, expires_at, used_at, created_at
+		FROM auth_tokens WHERE kind = $1 AND token_hash = $2`, kind, tokenHash).
+		Scan(&token, &authToken.UserID, &authToken.Kind, &authToken.TokenHash, &authToken.Email,
+			&expiresAt, &usedAt, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if authToken.ID, err = uuid.Parse(token); err != nil {
+		return nil, fmt.Errorf("error parsing token id: %v", err)
+	}
+	if authToken.ExpiresAt, err = common.ParseTime(expiresAt); err != nil {
+		return nil, fmt.Errorf("error parsing expires_at: %v", err)
+	}
+	if authToken.CreatedAt, err = common.ParseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	if usedAt.Valid {
+		used, err := common.ParseTime(usedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing used_at: %v", err)
+		}
+		authToken.UsedAt = &used
+	}
+
+	return authToken, nil
+}
+
+// UseAuthToken marks a token as used. It reports false when the token was
+// used already, so a token cannot be redeemed twice by concurrent requests.
+func (r *AuthRepository) UseAuthToken(id uuid.UUID, at time.Time) (bool, error) {
+	result, err := r.db.Exec("UPDATE auth_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL",
+		at.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// DeleteAuthTokens removes the unused tokens of a kind a user still holds,
+// so only the newest one works
+func (r *AuthRepository) DeleteAuthTokens(userID uuid.UUID, kind string) error {
+	_, err := r.db.Exec("DELETE FROM auth_tokens WHERE user_id = $1 AND kind = $2 AND used_at IS NULL", userID, kind)
+	return err
+}
+
+// DeleteExpiredAuthTokens removes tokens that expired before the given time
+func (r *AuthRepository) DeleteExpiredAuthTokens(before time.Time) error {
+	_, err := r.db.Exec("DELETE FROM auth_tokens WHERE expires_at < $1", before.UTC().Format(time.RFC3339))
+	return err
+}
+
+const refreshTokenColumns = `id, user_id, family_id, token_hash, user_agent, remote_addr,
+	expires_at, created_at, rotated_at, revoked_at, revoked_reason`
+
+func (r *AuthRepository) CreateRefreshToken(token *RefreshToken) error {
+	_, err := r.db.Exec(`
+		INSERT INTO refresh_tokens (`+refreshTokenColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULL, NULL, NULL)`,
+		token.ID, token.UserID, token.FamilyID, token.TokenHash, token.UserAgent, token.RemoteAddr,
+		token.ExpiresAt.UTC().Format(time.RFC3339), token.CreatedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+func scanRefreshToken(row rowScanner) (*RefreshToken, error) {
+	var (
+		expiresAt, createdAt            string
+		userAgent, remoteAddr           sql.NullString
+		rotatedAt, revokedAt, reasonStr sql.NullString
+	)
+	token := &RefreshToken{}
+	err := row.Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &userAgent, &remoteAddr,
+		&expiresAt, &createdAt, &rotatedAt, &revokedAt, &reasonStr)
+	if err != nil {
+		return nil, err
+	}
+
+	token.UserAgent = userAgent.String
+	token.RemoteAddr = remoteAddr.String
+	if token.ExpiresAt, err = common.ParseTime(expiresAt); err != nil {
+		return nil, fmt.Errorf("error parsing expires_at: %v", err)
+	}
+	if token.CreatedAt, err = common.ParseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	if rotatedAt.Valid {
+		rotated, err := common.ParseTime(rotatedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing rotated_at: %v", err)
+		}
+		token.RotatedAt = &rotated
+	}
+	if revokedAt.Valid {
+		revoked, err := common.ParseTime(revokedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing revoked_at: %v", err)
+		}
+		token.RevokedAt = &revoked
+	}
+	if reasonStr.Valid {
+		token.RevokedReason = &reasonStr.String
+	}
+
+	return token, nil
+}
+
+func (r *AuthRepository) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	return scanRefreshToken(r.db.QueryRow("SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE token_hash = $1", tokenHash))
+}
+
+// RotateRefreshToken marks a token as exchanged. It reports false when the
+// token was rotated or revoked already, so only one refresh can use it.
+func (r *AuthRepository) RotateRefreshToken(id uuid.UUID, at time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE refresh_tokens SET rotated_at = $1
+		WHERE id = $2 AND rotated_at IS NULL AND revoked_at IS NULL`,
+		at.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token of a session
+func (r *AuthRepository) RevokeRefreshTokenFamily(familyID uuid.UUID, reason string, at time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = $1, revoked_reason = $2
+		WHERE family_id = $3 AND revoked_at IS NULL`,
+		at.UTC().Format(time.RFC3339), reason, familyID)
+	return err
+}
+
+// RevokeUserRefreshTokens revokes the sessions of a user, except the one
+// given, which may be uuid.Nil
+func (r *AuthRepository) RevokeUserRefreshTokens(userID uuid.UUID, except uuid.UUID, reason string, at time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE refresh_tokens SET revoked_at = $1, revoked_reason = $2
+		WHERE user_id = $3 AND family_id != $4 AND revoked_at IS NULL`,
+		at.UTC().Format(time.RFC3339), reason, userID, except)
+	return err
+}
+
+// IsRefreshTokenFamilyActive reports whether a session has a token that
+// was not revoked. Sessions whose tokens were removed are not active.
+func (r *AuthRepository) IsRefreshTokenFamilyActive(familyID string) (bool, error) {
+	var active bool
+	err := r.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM refresh_tokens WHERE family_id = $1 AND revoked_at IS NULL)`,
+		familyID).Scan(&active)
+	return active, err
+}
+
+// GetActiveRefreshTokens returns the usable token of each of a user's
+// sessions, newest first
+func (r *AuthRepository) GetActiveRefreshTokens(userID uuid.UUID, now time.Time) ([]*RefreshToken, error) {
+	rows, err := r.db.Query(`
+		SELECT `+refreshTokenColumns+`
+		FROM refresh_tokens
+		WHERE user_id = $1 AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY created_at DESC`,
+		userID, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*RefreshToken{}
+	for rows.Next() {
+		token, err := scanRefreshToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// GetRefreshTokenFamilyStart returns when a session signed in
+func (r *AuthRepository) GetRefreshTokenFamilyStart(familyID uuid.UUID) (time.Time, error) {
+	var createdAt string
+	if err := r.db.QueryRow("SELECT MIN(created_at) FROM refresh_tokens WHERE family_id = $1", familyID).Scan(&createdAt); err != nil {
+		return time.Time{}, err
+	}
+	return common.ParseTime(createdAt)
+}
+
+// DeleteExpiredRefreshTokens removes sessions whose newest token expired
+// before the given time, with all their tokens
+func (r *AuthRepository) DeleteExpiredRefreshTokens(before time.Time) error {
+	_, err := r.db.Exec(`
+		DELETE FROM refresh_tokens WHERE family_id IN (
+			SELECT family_id FROM refresh_tokens
+			GROUP BY family_id
+			HAVING MAX(expires_at) < $1
+		)`, before.UTC().Format(time.RFC3339))
+	return err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+const impersonationSessionColumns = `id, admin_id, admin_username, target_user_id, target_username,
+	reason, started_at, expires_at, ended_at`
+
+func (r *AuthRepository) CreateImpersonationSession(session *ImpersonationSession) error {
+	_, err := r.db.Exec(`
+		INSERT INTO impersonation_sessions (`+impersonationSessionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULL)`,
+		session.ID, session.AdminID, session.AdminUsername, session.TargetUserID, session.TargetUsername,
+		session.Reason, session.StartedAt.Format(time.RFC3339), session.ExpiresAt.Format(time.RFC3339))
+	return err
+}
+
+func scanImpersonationSession(row rowScanner) (*ImpersonationSession, error) {
+	var (
+		startedAt, expiresAt string
+		endedAt              sql.NullString
+	)
+	session := &ImpersonationSession{}
+	err := row.Scan(&session.ID, &session.AdminID, &session.AdminUsername, &session.TargetUserID, &session.TargetUsername,
+		&session.Reason, &startedAt, &expiresAt, &endedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.StartedAt, err = common.ParseTime(startedAt); err != nil {
+		return nil, fmt.Errorf("error parsing started_at: %v", err)
+	}
+	if session.ExpiresAt, err = common.ParseTime(expiresAt); err != nil {
+		return nil, fmt.Errorf("error parsing expires_at: %v", err)
+	}
+	if endedAt.Valid {
+		ended, err := common.ParseTime(endedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ended_at: %v", err)
+		}
+		session.EndedAt = &ended
+	}
+
+	return session, nil
+}
+
+func (r *AuthRepository) GetImpersonationSession(id string) (*ImpersonationSession, error) {
+	row := r.db.QueryRow(`
+		SELECT `+impersonationSessionColumns+`
+		FROM impersonation_sessions WHERE id = $1`, id)
+	return scanImpersonationSession(row)
+}
+
+func (r *AuthRepository) GetImpersonationSessions(limit int) ([]*ImpersonationSession, error) {
+	rows, err := r.db.Query(`
+		SELECT `+impersonationSessionColumns+`
+		FROM impersonation_sessions
+		ORDER BY started_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*ImpersonationSession{}
+	for rows.Next() {
+		session, err := scanImpersonationSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// EndImpersonationSession ends a session that has not ended yet
+func (r *AuthRepository) EndImpersonationSession(id string, endedAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE impersonation_sessions SET ended_at = $1
+		WHERE id = $2 AND ended_at IS NULL`,
+		endedAt.Format(time.RFC3339), id)
+	return err
+}
+
+func (r *AuthRepository) CreateImpersonationEvent(event *ImpersonationEvent) error {
+	_, err := r.db.Exec(`
+		INSERT INTO impersonation_events (id, session_id, method, path, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		event.ID, event.SessionID, event.Method, event.Path, event.Status, event.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *AuthRepository) GetImpersonationEvents(sessionID string) ([]ImpersonationEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT id, session_id, method, path, status, created_at
+		FROM impersonation_events
+		WHERE session_id = $1
+		ORDER BY created_at`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ImpersonationEvent{}
+	for rows.Next() {
+		var (
+			event     ImpersonationEvent
+			createdAt string
+		)
+		if err := rows.Scan(&event.ID, &event.SessionID, &event.Method, &event.Path, &event.Status, &createdAt); err != nil {
+			return nil, err
+		}
+		if event.CreatedAt, err = common.ParseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("error parsing created_at: %v", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// TransferConnections moves connections of one user to another, together
+// with their schedules and backups, which hang off the connection. With no
+// connection IDs, all of the user's connections move. Held connections are
+// marked so they are listed until the admin reassigns them, and remember the
+// owner they were taken from rather than the admin.
+func (r *AuthRepository) TransferConnections(fromID, toID uuid.UUID, connectionIDs []string, held bool) (*OwnershipTransfer, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if len(connectionIDs) == 0 {
+		rows, err := tx.Query("SELECT id FROM connections WHERE user_id = $1 ORDER BY name", fromID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			connectionIDs = append(connectionIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var heldAt *string
+	if held {
+		now := time.Now().Format(time.RFC3339)
+		heldAt = &now
+	}
+
+	transfer := &OwnershipTransfer{ConnectionIDs: []string{}, Held: held}
+	for _, id := range connectionIDs {
+		result, err := tx.Exec(`
+			UPDATE connections SET user_id = $1,
+				previous_user_id = CASE WHEN held_at IS NULL THEN $2 ELSE previous_user_id END,
+				held_at = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $4 AND user_id = $5`,
+			toID, fromID, heldAt, id, fromID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transfer connection %s: %v", id, err)
+		}
+		if affected, err := result.RowsAffected(); err != nil {
+			return nil, err
+		} else if affected == 0 {
+			return nil, fmt.Errorf("connection %s does not belong to the user", id)
+		}
+
+		var enabled int
+		if err := tx.QueryRow(`
+			SELECT COUNT(*) FROM backup_schedules WHERE connection_id = $1 AND enabled = true`,
+			id).Scan(&enabled); err != nil {
+			return nil, err
+		}
+		transfer.EnabledSchedules += enabled
+		transfer.ConnectionIDs = append(transfer.ConnectionIDs, id)
+	}
+
+	return transfer, tx.Commit()
+}
+
+// CountS3Backups counts the backups of the connections that were uploaded to
+// S3, whose objects stay in the storage they were uploaded to
+func (r *AuthRepository) CountS3Backups(connectionIDs []string) (int, error) {
+	total := 0
+	for _, id := range connectionIDs {
+		var count int
+		if err := r.db.QueryRow(`
+			SELECT COUNT(*) FROM backups WHERE connection_id = $1 AND s3_object_key IS NOT NULL`,
+			id).Scan(&count); err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// GetOrphanedConnections lists the connections whose owner is deactivated or
+// no longer exists, and those the admin holds
+func (r *AuthRepository) GetOrphanedConnections() ([]OrphanedConnection, error) {
+	rows, err := r.db.Query(`
+		SELECT c.id, c.name, c.type, c.user_id, u.id, u.username, u.deactivated_at, c.previous_user_id, c.held_at,
+			(SELECT COUNT(*) FROM backup_schedules s WHERE s.connection_id = c.id AND s.enabled = true)
+		FROM connections c
+		LEFT JOIN users u ON u.id = c.user_id
+		WHERE u.id IS NULL OR u.deactivated_at IS NOT NULL OR c.held_at IS NOT NULL
+		ORDER BY c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orphans := []OrphanedConnection{}
+	for rows.Next() {
+		var orphan OrphanedConnection
+		var userID, ownerID, username, deactivatedAt, previousUserID, heldAt sql.NullString
+		if err := rows.Scan(&orphan.ID, &orphan.Name, &orphan.Type, &userID, &ownerID, &username, &deactivatedAt,
+			&previousUserID, &heldAt, &orphan.EnabledSchedules); err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			orphan.UserID = &userID.String
+		}
+		if username.Valid {
+			orphan.Username = &username.String
+		}
+		if previousUserID.Valid {
+			orphan.PreviousUserID = &previousUserID.String
+		}
+		if heldAt.Valid {
+			orphan.HeldAt = &heldAt.String
+		}
+
+		switch {
+		case !ownerID.Valid:
+			orphan.Reason = OrphanOwnerMissing
+		case deactivatedAt.Valid:
+			orphan.Reason = OrphanOwnerDeactivated
+		default:
+			orphan.Reason = OrphanHeld
+		}
+		orphans = append(orphans, orphan)
+	}
+
+	return orphans, rows.Err()
+}
+
+const inviteColumns = `i.id, i.token_hash, i.email, i.team_id, t.name, i.team_role, i.created_by,
+	i.created_at, i.expires_at, i.used_at, i.used_by, u.username, i.revoked_at`
+
+const inviteFrom = `invites i
+	LEFT JOIN teams t ON t.id = i.team_id
+	LEFT JOIN users u ON u.id = i.used_by`
+
+func (r *AuthRepository) CreateInvite(invite *Invite) error {
+	_, err := r.db.Exec(`
+		INSERT INTO invites (id, token_hash, email, team_id, team_role, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		invite.ID, invite.TokenHash, invite.Email, invite.TeamID, invite.TeamRole, invite.CreatedBy,
+		invite.CreatedAt.UTC().Format(time.RFC3339), invite.ExpiresAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+func scanInvite(row rowScanner) (*Invite, error) {
+	var (
+		createdAt, expiresAt string
+		usedAt, revokedAt    sql.NullString
+	)
+	invite := &Invite{}
+	err := row.Scan(&invite.ID, &invite.TokenHash, &invite.Email, &invite.TeamID, &invite.TeamName, &invite.TeamRole,
+		&invite.CreatedBy, &createdAt, &expiresAt, &usedAt, &invite.UsedBy, &invite.UsedByUsername, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if invite.CreatedAt, err = common.ParseTime(createdAt); err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	if invite.ExpiresAt, err = common.ParseTime(expiresAt); err != nil {
+		return nil, fmt.Errorf("error parsing expires_at: %v", err)
+	}
+	if usedAt.Valid {
+		used, err := common.ParseTime(usedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing used_at: %v", err)
+		}
+		invite.UsedAt = &used
+	}
+	if revokedAt.Valid {
+		revoked, err := common.ParseTime(revokedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing revoked_at: %v", err)
+		}
+		invite.RevokedAt = &revoked
+	}
+
+	return invite, nil
+}
+
+func (r *AuthRepository) GetInvite(id string) (*Invite, error) {
+	return scanInvite(r.db.QueryRow("SELECT "+inviteColumns+" FROM "+inviteFrom+" WHERE i.id = $1", id))
+}
+
+func (r *AuthRepository) GetInviteByHash(tokenHash string) (*Invite, error) {
+	return scanInvite(r.db.QueryRow("SELECT "+inviteColumns+" FROM "+inviteFrom+" WHERE i.token_hash = $1", tokenHash))
+}
+
+func (r *AuthRepository) GetInvites(limit int) ([]*Invite, error) {
+	rows, err := r.db.Query(`
+		SELECT `+inviteColumns+`
+		FROM `+inviteFrom+`
+		ORDER BY i.created_at DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []*Invite{}
+	for rows.Next() {
+		invite, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+// RevokeInvite revokes an invite that was neither used nor revoked. It
+// reports false otherwise.
+func (r *AuthRepository) RevokeInvite(id uuid.UUID, at time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE invites SET revoked_at = $1
+		WHERE id = $2 AND used_at IS NULL AND revoked_at IS NULL`,
+		at.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// TeamName returns the name of a team
+func (r *AuthRepository) TeamName(teamID string) (string, error) {
+	var name string
+	err := r.db.QueryRow("SELECT name FROM teams WHERE id = $1", teamID).Scan(&name)
+	return name, err
+}
+
+// RedeemInvite creates the user signing up with an invite, marks the invite
+// as used and adds the user to the invite's team, all or nothing. It
+// returns errInviteTaken when another sign-up used the invite first.
+func (r *AuthRepository) RedeemInvite(invite *Invite, user *User, at time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE invites SET used_at = $1, used_by = $2
+		WHERE id = $3 AND used_at IS NULL AND revoked_at IS NULL`,
+		at.UTC().Format(time.RFC3339), user.ID, invite.ID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return errInviteTaken
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO users (id, username, password, created_at, email, email_verified_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		user.ID, user.Username, user.Password, user.CreatedAt, user.Email, user.EmailVerifiedAt); err != nil {
+		return err
+	}
+
+	if invite.TeamID != nil {
+		// A team deleted since the invite was made is skipped
+		if _, err := tx.Exec(`
+			INSERT INTO team_members (team_id, user_id, role, created_at)
+			SELECT id, $1, $2, $3 FROM teams WHERE id = $4`,
+			user.ID, invite.TeamRole, at.Format(time.RFC3339), *invite.TeamID); err != nil {
+			return fmt.Errorf("failed to join team: %v", err)
+		}
+	}
+
+	return tx.Commit()
 }
@@ -2,7 +2,9 @@ package auth
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"log/slog"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,16 +15,47 @@ import (
 type AuthService struct {
 	repo      *AuthRepository
 	jwtSecret []byte
+	// adminUsername is the user allowed to impersonate others
+	adminUsername string
+	// allowSignup opens registration to everyone; otherwise users sign up
+	// with an invite
+	allowSignup bool
+	// limiter rate limits password resets and email verifications
+	limiter *attemptLimiter
 }
 
-func NewAuthService(repo *AuthRepository, jwtSecret string) *AuthService {
+func NewAuthService(repo *AuthRepository, jwtSecret, adminUsername string, allowSignup bool) *AuthService {
 	return &AuthService{
-		repo:      repo,
-		jwtSecret: []byte(jwtSecret),
+		repo:          repo,
+		jwtSecret:     []byte(jwtSecret),
+		adminUsername: adminUsername,
+		allowSignup:   allowSignup,
+		limiter:       newAttemptLimiter(rateLimitWindow),
 	}
 }
 
-func (s *AuthService) Register(username, password string) error {
+// Register creates a user while registration is open. The email is
+// optional unless REQUIRE_EMAIL_VERIFICATION is set; when given, a
+// verification link is sent to it.
+func (s *AuthService) Register(username, password, email string) error {
+	if !s.allowSignup {
+		return ErrRegistrationClosed
+	}
+
+	var userEmail *string
+	if email != "" {
+		normalized, err := normalizeEmail(email)
+		if err != nil {
+			return err
+		}
+		if err := s.checkEmailAvailable(normalized, nil); err != nil {
+			return err
+		}
+		userEmail = &normalized
+	} else if requireEmailVerification() {
+		return ErrEmailRequired
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -33,43 +66,69 @@ func (s *AuthService) Register(username, password string) error {
 		Username:  username,
 		Password:  string(hashedPassword),
 		CreatedAt: time.Now().Format("2006-01-02 15:04:05"),
+		Email:     userEmail,
+	}
+
+	if err := s.repo.CreateUser(payload); err != nil {
+		return err
 	}
 
-	return s.repo.CreateUser(payload)
+	if userEmail != nil {
+		if _, _, err := systemSMTP(); err != nil {
+			slog.Warn("User registered with an email but no verification was sent", "user_id", payload.ID, "error", err)
+		} else if err := s.sendVerification(&payload, *userEmail); err != nil {
+			slog.Error("Failed to send verification email", "user_id", payload.ID, "error", err)
+		}
+	}
+	return nil
 }
 
-func (s *AuthService) Login(username, password string) (string, error) {
+// Login starts a session and returns a short-lived access token with the
+// session's first refresh token
+func (s *AuthService) Login(username, password string, client sessionClient) (*LoginResponse, error) {
 	user, err := s.repo.GetUserByUsername(username)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return "", err
+		return nil, err
+	}
+	if user.DeactivatedAt != nil {
+		return nil, ErrUserDeactivated
+	}
+	if requireEmailVerification() && user.Email != nil && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	return token.SignedString(s.jwtSecret)
+	return s.issueSessionTokens(user, uuid.Nil, client)
 }
 
-func (s *AuthService) GetProfile(ctx context.Context) (string, error) {
+func (s *AuthService) GetProfile(ctx context.Context) (*ProfileResponse, error) {
 	claims, ok := ctx.Value("user").(jwt.MapClaims)
 
 	if !ok {
-		return "", errors.New("invalid token")
+		return nil, errors.New("invalid token")
 	}
 
 	username, ok := claims["username"].(string)
 	if !ok {
-		return "", errors.New("invalid token claims")
+		return nil, errors.New("invalid token claims")
 	}
 
-	return username, nil
+	_, impersonator := impersonationFromClaims(claims)
+	profile := &ProfileResponse{Username: username, ImpersonatedBy: impersonator}
+
+	userID, _ := claims["user_id"].(string)
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if user != nil {
+		profile.Email = user.Email
+		profile.EmailVerified = user.EmailVerifiedAt != nil
+	}
+	return profile, nil
 }
 
 func (s *AuthService) CreateNewUserByEnvData(username, password string) (bool, error) {
@@ -0,0 +1,307 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/mail"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPasswordResetTTL     = time.Hour
+	defaultEmailVerificationTTL = 48 * time.Hour
+	defaultAppURL               = "http://localhost:3000"
+	minimumPasswordLength       = 8
+)
+
+// Rate limits of the endpoints that send emails or redeem tokens
+const (
+	// emailsPerAddress bounds the emails sent to one address per window
+	emailsPerAddress = 3
+	// attemptsPerClient bounds the requests of one client address per window
+	attemptsPerClient = 10
+	rateLimitWindow   = 15 * time.Minute
+)
+
+var (
+	ErrInvalidEmail      = errors.New("invalid email address")
+	ErrEmailInUse        = errors.New("email is already in use")
+	ErrEmailRequired     = errors.New("an email is required to register")
+	ErrEmailNotVerified  = errors.New("email is not verified")
+	ErrInvalidToken      = errors.New("invalid or expired token")
+	ErrMailNotConfigured = errors.New("email delivery is not configured")
+	ErrTooManyRequests   = errors.New("too many requests, try again later")
+	ErrImpersonating     = errors.New("this cannot be done while impersonating")
+	ErrPasswordTooShort  = fmt.Errorf("password must be at least %d characters", minimumPasswordLength)
+)
+
+// requireEmailVerification reads REQUIRE_EMAIL_VERIFICATION. When set,
+// signing up needs an email and users with an unverified email cannot sign
+// in. Users without an email, such as the admin from the environment, are
+// not affected.
+func requireEmailVerification() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("REQUIRE_EMAIL_VERIFICATION"))) == "true"
+}
+
+// tokenTTL reads a token lifetime from envVar, counted in units
+func tokenTTL(envVar string, unit, defaultTTL time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(envVar))
+	if value == "" {
+		return defaultTTL
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count <= 0 {
+		slog.Warn("Invalid token lifetime, using the default", "env", envVar, "value", value, "default", defaultTTL)
+		return defaultTTL
+	}
+	return time.Duration(count) * unit
+}
+
+// appLink builds a link into the web app at APP_URL carrying the token
+func appLink(path, token string) string {
+	base := strings.TrimRight(strings.TrimSpace(os.Getenv("APP_URL")), "/")
+	if base == "" {
+		base = defaultAppURL
+	}
+	return base + path + "?token=" + url.QueryEscape(token)
+}
+
+// normalizeEmail validates an address and returns it in lower case
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	address, err := netmail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < minimumPasswordLength {
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
+// newToken returns a random token to hand out; only its hash is stored
+func newToken() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueToken creates a token of the kind for the user, replacing any unused
+// one they hold, and returns the token to send. Expired tokens of all users
+// are removed on the way.
+func (s *AuthService) issueToken(user *User, kind, email string, ttl time.Duration) (string, time.Time, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	if err := s.repo.DeleteExpiredAuthTokens(now); err != nil {
+		slog.Warn("Failed to remove expired auth tokens", "error", err)
+	}
+	if err := s.repo.DeleteAuthTokens(user.ID, kind); err != nil {
+		return "", time.Time{}, err
+	}
+
+	authToken := &AuthToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Kind:      kind,
+		TokenHash: hashToken(token),
+		Email:     email,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := s.repo.CreateAuthToken(authToken); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, authToken.ExpiresAt, nil
+}
+
+// redeemToken marks a valid token of the kind as used and returns it.
+// Unknown, used and expired tokens are all ErrInvalidToken.
+func (s *AuthService) redeemToken(kind, token string) (*AuthToken, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+
+	authToken, err := s.repo.GetAuthTokenByHash(kind, hashToken(token))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if authToken.UsedAt != nil || now.After(authToken.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+	used, err := s.repo.UseAuthToken(authToken.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidToken
+	}
+	return authToken, nil
+}
+
+// systemSMTP returns the SMTP server from the SMTP_* environment variables,
+// which delivers the emails of users who are not signed in
+func systemSMTP() (*mail.SMTPConfig, string, error) {
+	host := strings.TrimSpace(os.Getenv("SMTP_HOST"))
+	if host == "" {
+		return nil, "", ErrMailNotConfigured
+	}
+
+	port := 587
+	if value := strings.TrimSpace(os.Getenv("SMTP_PORT")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid SMTP_PORT: %s", value)
+		}
+		port = parsed
+	}
+
+	from := strings.TrimSpace(os.Getenv("SMTP_FROM"))
+	if from == "" {
+		from = strings.TrimSpace(os.Getenv("SMTP_USER"))
+	}
+
+	return &mail.SMTPConfig{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		Security: os.Getenv("SMTP_SECURITY"),
+	}, from, nil
+}
+
+// sendAccountEmail renders an account template and sends it through the
+// system SMTP server
+func sendAccountEmail(template, subject, to string, data interface{}) error {
+	config, from, err := systemSMTP()
+	if err != nil {
+		return err
+	}
+
+	text, html, err := mail.Render(template, data)
+	if err != nil {
+		return err
+	}
+
+	return mail.SendEmail(config, &mail.Message{
+		From:     from,
+		To:       []string{to},
+		Subject:  subject,
+		Body:     text,
+		HTMLBody: html,
+	})
+}
+
+// attemptLimiter counts attempts per key within a sliding window
+type attemptLimiter struct {
+	mu       sync.Mutex
+	window   time.Duration
+	attempts map[string][]time.Time
+}
+
+func newAttemptLimiter(window time.Duration) *attemptLimiter {
+	return &attemptLimiter{window: window, attempts: make(map[string][]time.Time)}
+}
+
+// allow records an attempt for key unless it already made max attempts in
+// the window
+func (l *attemptLimiter) allow(key string, max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+	for k, times := range l.attempts {
+		recent := times[:0]
+		for _, t := range times {
+			if t.After(cutoff) {
+				recent = append(recent, t)
+			}
+		}
+		if len(recent) == 0 {
+			delete(l.attempts, k)
+		} else {
+			l.attempts[k] = recent
+		}
+	}
+
+	if len(l.attempts[key]) >= max {
+		return false
+	}
+	l.attempts[key] = append(l.attempts[key], now)
+	return true
+}
+
+// allowClient rate limits the requests of one client address
+func (s *AuthService) allowClient(clientAddr string) error {
+	if !s.limiter.allow("client:"+clientAddr, attemptsPerClient) {
+		return ErrTooManyRequests
+	}
+	return nil
+}
+
+// allowEmail rate limits the emails sent to one address
+func (s *AuthService) allowEmail(email string) bool {
+	return s.limiter.allow("email:"+email, emailsPerAddress)
+}
+
+// clientAddr is the remote address of a request, without its port
+func clientAddr(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func sendAccountError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrTooManyRequests:
+		w.Header().Set("Retry-After", strconv.Itoa(int(rateLimitWindow.Seconds())))
+		response.SendError(w, http.StatusTooManyRequests, err.Error())
+	case ErrImpersonating, ErrRegistrationClosed:
+		response.SendError(w, http.StatusForbidden, err.Error())
+	case ErrMailNotConfigured:
+		response.SendError(w, http.StatusServiceUnavailable, err.Error())
+	case ErrInvalidEmail, ErrEmailInUse, ErrEmailRequired, ErrInvalidToken, ErrPasswordTooShort,
+		ErrInvalidInvite, ErrInviteEmailMismatch, ErrUsernameTaken, ErrUsernameRequired:
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
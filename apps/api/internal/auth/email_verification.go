@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/mail"
+)
+
+// userFromContext returns the signed-in user. Impersonation tokens are
+// refused, so an admin cannot take over an account through its email or
+// sessions.
+func (s *AuthService) userFromContext(ctx context.Context) (*User, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sessionID, _ := impersonationFromClaims(claims); sessionID != "" {
+		return nil, ErrImpersonating
+	}
+
+	userID, _ := claims["user_id"].(string)
+	return s.repo.GetUserByID(userID)
+}
+
+// checkEmailAvailable refuses an address another user has
+func (s *AuthService) checkEmailAvailable(email string, self *User) error {
+	other, err := s.repo.FindUserByEmail(email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if self != nil && other.ID == self.ID {
+		return nil
+	}
+	return ErrEmailInUse
+}
+
+// sendVerification emails a verification link for the user's email in the
+// background
+func (s *AuthService) sendVerification(user *User, email string) error {
+	token, expiresAt, err := s.issueToken(user, TokenEmailVerification, email, tokenTTL("EMAIL_VERIFICATION_TOKEN_TTL_MINUTES", time.Minute, defaultEmailVerificationTTL))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		err := sendAccountEmail(mail.TemplateEmailVerification, "Verify your email", email, &mail.AccountLinkData{
+			Username:  user.Username,
+			Link:      appLink("/verify-email", token),
+			Token:     token,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			slog.Error("Failed to send verification email", "user_id", user.ID, "error", err)
+		}
+	}()
+	return nil
+}
+
+// VerifyEmail verifies the address a verification token was sent to, as
+// long as the user still has it
+func (s *AuthService) VerifyEmail(token, client string) error {
+	if err := s.allowClient(client); err != nil {
+		return err
+	}
+
+	authToken, err := s.redeemToken(TokenEmailVerification, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByID(authToken.UserID.String())
+	if err == sql.ErrNoRows {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+	if user.Email == nil || *user.Email != authToken.Email {
+		return ErrInvalidToken
+	}
+
+	return s.repo.MarkEmailVerified(user.ID, authToken.Email, time.Now().Format(time.RFC3339))
+}
+
+// ResendVerification sends a new verification link to an unverified
+// address. Like ForgotPassword it does not tell whether the address is used.
+func (s *AuthService) ResendVerification(email, client string) error {
+	if err := s.allowClient(client); err != nil {
+		return err
+	}
+	if _, _, err := systemSMTP(); err != nil {
+		return err
+	}
+
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.FindUserByEmail(email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil || user.DeactivatedAt != nil || !s.allowEmail(email) {
+		return nil
+	}
+
+	return s.sendVerification(user, email)
+}
+
+// UpdateEmail sets the signed-in user's email, or removes it when empty. A
+// new address is unverified until its verification link is followed.
+func (s *AuthService) UpdateEmail(ctx context.Context, email string) (*ProfileResponse, error) {
+	user, err := s.userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if email == "" {
+		if requireEmailVerification() {
+			return nil, ErrEmailRequired
+		}
+		if err := s.repo.SetUserEmail(user.ID, nil, nil); err != nil {
+			return nil, err
+		}
+		if err := s.repo.DeleteAuthTokens(user.ID, TokenEmailVerification); err != nil {
+			return nil, err
+		}
+		return s.GetProfile(ctx)
+	}
+
+	email, err = normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if user.Email != nil && *user.Email == email {
+		return s.GetProfile(ctx)
+	}
+	if err := s.checkEmailAvailable(email, user); err != nil {
+		return nil, err
+	}
+	if !s.allowEmail(email) {
+		return nil, ErrTooManyRequests
+	}
+
+	// Users who must verify their email would be locked out by an address
+	// that cannot be verified
+	_, _, mailErr := systemSMTP()
+	if mailErr != nil && requireEmailVerification() {
+		return nil, mailErr
+	}
+
+	if err := s.repo.SetUserEmail(user.ID, &email, nil); err != nil {
+		return nil, err
+	}
+	if mailErr != nil {
+		slog.Warn("Email changed but no verification was sent", "user_id", user.ID, "error", mailErr)
+	} else if err := s.sendVerification(user, email); err != nil {
+		return nil, err
+	}
+
+	return s.GetProfile(ctx)
+}
+
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.authService.VerifyEmail(req.Token, clientAddr(r)); err != nil {
+		sendAccountError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Email verified successfully", nil)
+}
+
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.authService.ResendVerification(req.Email, clientAddr(r)); err != nil {
+		sendAccountError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "If this email awaits verification, a new link has been sent to it", nil)
+}
+
+func (h *AuthHandler) UpdateEmail(w http.ResponseWriter, r *http.Request) {
+	var req UpdateEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	profile, err := h.authService.UpdateEmail(r.Context(), req.Email)
+	if err != nil {
+		sendAccountError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Email updated successfully", profile)
+}
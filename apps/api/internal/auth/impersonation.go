@@ -0,0 +1,348 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultImpersonationMinutes = 30
+	maxImpersonationMinutes     = 4 * 60
+	impersonationSessionsLimit  = 100
+)
+
+// ErrNotAdmin is returned when someone other than the admin user, or the
+// admin while impersonating, uses an admin endpoint
+var ErrNotAdmin = errors.New("only the admin user can do this")
+
+// Impersonation tokens carry these claims next to the impersonated user's
+const (
+	claimImpersonationID = "impersonation_id"
+	claimImpersonator    = "impersonator"
+	claimImpersonatorID  = "impersonator_id"
+)
+
+func claimsFromContext(ctx context.Context) (jwt.MapClaims, error) {
+	claims, ok := ctx.Value("user").(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// impersonationFromClaims returns the session of an impersonation token, or
+// an empty ID for regular sessions
+func impersonationFromClaims(claims jwt.MapClaims) (sessionID, impersonator string) {
+	sessionID, _ = claims[claimImpersonationID].(string)
+	impersonator, _ = claims[claimImpersonator].(string)
+	return sessionID, impersonator
+}
+
+// requireAdmin returns the admin user behind a regular session. Admins have
+// to sign in as themselves; impersonation tokens are never admin tokens.
+func (s *AuthService) requireAdmin(ctx context.Context) (*User, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sessionID, _ := impersonationFromClaims(claims); sessionID != "" {
+		return nil, ErrNotAdmin
+	}
+
+	username, _ := claims["username"].(string)
+	if s.adminUsername == "" || username != s.adminUsername {
+		return nil, ErrNotAdmin
+	}
+
+	admin, err := s.repo.GetUserByUsername(username)
+	if err != nil {
+		return nil, ErrNotAdmin
+	}
+	return admin, nil
+}
+
+// RequireAdmin refuses requests from anyone but the admin user signed in as
+// themselves
+func (h *AuthHandler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := h.authService.requireAdmin(r.Context()); err != nil {
+			response.SendError(w, http.StatusForbidden, ErrNotAdmin.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Impersonate starts an audited session in which the admin acts as another
+// user, and returns a token for it that expires with the session
+func (s *AuthService) Impersonate(ctx context.Context, req *ImpersonateRequest) (*ImpersonateResponse, error) {
+	admin, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("a reason is required to impersonate a user")
+	}
+
+	minutes := req.DurationMinutes
+	if minutes == 0 {
+		minutes = defaultImpersonationMinutes
+	}
+	if minutes < 0 || minutes > maxImpersonationMinutes {
+		return nil, fmt.Errorf("duration_minutes must be between 1 and %d", maxImpersonationMinutes)
+	}
+
+	target, err := s.repo.GetUserByUsername(strings.TrimSpace(req.Username))
+	if err != nil {
+		if err.Error() == "invalid credentials" {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	if target.ID == admin.ID {
+		return nil, fmt.Errorf("cannot impersonate yourself")
+	}
+
+	now := time.Now()
+	session := &ImpersonationSession{
+		ID:             uuid.New(),
+		AdminID:        admin.ID,
+		AdminUsername:  admin.Username,
+		TargetUserID:   target.ID,
+		TargetUsername: target.Username,
+		Reason:         reason,
+		StartedAt:      now,
+		ExpiresAt:      now.Add(time.Duration(minutes) * time.Minute),
+	}
+	if err := s.repo.CreateImpersonationSession(session); err != nil {
+		return nil, fmt.Errorf("failed to record impersonation session: %v", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":            target.ID,
+		"username":           target.Username,
+		claimImpersonationID: session.ID.String(),
+		claimImpersonator:    admin.Username,
+		claimImpersonatorID:  admin.ID,
+		"exp":                session.ExpiresAt.Unix(),
+	})
+	signed, err := token.SignedString(s.jwtSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Admin started impersonating user",
+		"admin", admin.Username, "user", target.Username, "until", session.ExpiresAt.Format(time.RFC3339), "session_id", session.ID, "reason", reason)
+	return &ImpersonateResponse{Token: signed, Session: session}, nil
+}
+
+// EndImpersonation ends a session before it expires. The impersonation token
+// can end its own session; the admin can end any session.
+func (s *AuthService) EndImpersonation(ctx context.Context, sessionID string) error {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if current, _ := impersonationFromClaims(claims); current != sessionID {
+		if _, err := s.requireAdmin(ctx); err != nil {
+			return err
+		}
+	}
+
+	session, err := s.repo.GetImpersonationSession(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.EndImpersonationSession(session.ID.String(), time.Now()); err != nil {
+		return err
+	}
+
+	slog.Info("Impersonation ended", "user", session.TargetUsername, "admin", session.AdminUsername, "session_id", session.ID)
+	return nil
+}
+
+func (s *AuthService) GetImpersonationSessions(ctx context.Context) ([]*ImpersonationSession, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return s.repo.GetImpersonationSessions(impersonationSessionsLimit)
+}
+
+// GetImpersonationSession returns a session with the requests made in it
+func (s *AuthService) GetImpersonationSession(ctx context.Context, sessionID string) (*ImpersonationSession, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	session, err := s.repo.GetImpersonationSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	session.Events, err = s.repo.GetImpersonationEvents(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// activeImpersonation returns the session of an impersonation token while it
+// has neither expired nor been ended
+func (s *AuthService) activeImpersonation(sessionID string) (*ImpersonationSession, error) {
+	session, err := s.repo.GetImpersonationSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.EndedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, errors.New("impersonation session ended")
+	}
+	return session, nil
+}
+
+func (s *AuthService) recordImpersonationEvent(session *ImpersonationSession, r *http.Request, status int) {
+	event := &ImpersonationEvent{
+		ID:        uuid.New(),
+		SessionID: session.ID,
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+		Status:    status,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.CreateImpersonationEvent(event); err != nil {
+		slog.Warn("Failed to audit impersonated request", "method", event.Method, "path", event.Path, "error", err)
+	}
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the writer, so streamed
+// responses can still be flushed
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AuditImpersonation runs after RequireAuth. It rejects impersonation tokens
+// whose session ended and records every request made with the others.
+func (h *AuthHandler) AuditImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := claimsFromContext(r.Context())
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sessionID, _ := impersonationFromClaims(claims)
+		if sessionID == "" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		session, err := h.authService.activeImpersonation(sessionID)
+		if err != nil {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		h.authService.recordImpersonationEvent(session, r, recorder.status)
+	})
+}
+
+func sendAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case err == ErrNotAdmin:
+		response.SendError(w, http.StatusForbidden, err.Error())
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Not found")
+	default:
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+func (h *AuthHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	var req ImpersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	impersonation, err := h.authService.Impersonate(r.Context(), &req)
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Impersonation started", impersonation)
+}
+
+// EndCurrentImpersonation ends the session of the impersonation token used
+func (h *AuthHandler) EndCurrentImpersonation(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	sessionID, _ := impersonationFromClaims(claims)
+	if sessionID == "" {
+		response.SendError(w, http.StatusBadRequest, "Not impersonating a user")
+		return
+	}
+
+	if err := h.authService.EndImpersonation(r.Context(), sessionID); err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Impersonation ended", nil)
+}
+
+func (h *AuthHandler) EndImpersonation(w http.ResponseWriter, r *http.Request) {
+	if err := h.authService.EndImpersonation(r.Context(), mux.Vars(r)["id"]); err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Impersonation ended", nil)
+}
+
+func (h *AuthHandler) GetImpersonationSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.authService.GetImpersonationSessions(r.Context())
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Impersonation sessions retrieved successfully", sessions)
+}
+
+func (h *AuthHandler) GetImpersonationSession(w http.ResponseWriter, r *http.Request) {
+	session, err := h.authService.GetImpersonationSession(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Impersonation session retrieved successfully", session)
+}
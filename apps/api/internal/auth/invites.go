@@ -0,0 +1,394 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/mail"
+	"github.com/dendianugerah/velld/internal/team"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultInviteHours = 72
+	maxInviteHours     = 720
+	inviteListLimit    = 200
+)
+
+var (
+	ErrRegistrationClosed  = errors.New("registration is closed, ask the admin for an invite")
+	ErrInvalidInvite       = errors.New("invalid or expired invite")
+	ErrInviteEmailMismatch = errors.New("this invite is for a different email")
+	ErrUsernameTaken       = errors.New("username is already taken")
+	ErrUsernameRequired    = errors.New("username is required")
+	// errInviteTaken is returned when another sign-up used the invite first
+	errInviteTaken = errors.New("invite was already used")
+)
+
+// status tells whether the invite can still be used
+func (i *Invite) status(now time.Time) string {
+	switch {
+	case i.UsedAt != nil:
+		return InviteUsed
+	case i.RevokedAt != nil:
+		return InviteRevoked
+	case now.After(i.ExpiresAt):
+		return InviteExpired
+	default:
+		return InvitePending
+	}
+}
+
+// CreateInvite makes a time-limited invite to sign up, optionally joining a
+// team with a preset role. The token is only returned here; when the invite
+// names an email and SMTP is configured, the link is emailed as well.
+func (s *AuthService) CreateInvite(ctx context.Context, req *CreateInviteRequest) (*Invite, error) {
+	admin, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hours := req.ExpiresInHours
+	if hours == 0 {
+		hours = defaultInviteHours
+	}
+	if hours < 0 || hours > maxInviteHours {
+		return nil, fmt.Errorf("expires_in_hours must be between 1 and %d", maxInviteHours)
+	}
+
+	now := time.Now()
+	invite := &Invite{
+		ID:        uuid.New(),
+		CreatedBy: admin.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(hours) * time.Hour),
+	}
+
+	if req.Email != "" {
+		email, err := normalizeEmail(req.Email)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkEmailAvailable(email, nil); err != nil {
+			return nil, err
+		}
+		invite.Email = &email
+	}
+
+	if teamID := strings.TrimSpace(req.TeamID); teamID != "" {
+		if _, err := uuid.Parse(teamID); err != nil {
+			return nil, fmt.Errorf("invalid team_id")
+		}
+		name, err := s.repo.TeamName(teamID)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("team not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		role := req.Role
+		if role == "" {
+			role = team.RoleMember
+		}
+		if role != team.RoleAdmin && role != team.RoleMember {
+			return nil, fmt.Errorf("role must be %s or %s", team.RoleAdmin, team.RoleMember)
+		}
+		invite.TeamID = &teamID
+		invite.TeamName = &name
+		invite.TeamRole = &role
+	} else if req.Role != "" {
+		return nil, fmt.Errorf("a role needs a team_id")
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	invite.TokenHash = hashToken(token)
+	if err := s.repo.CreateInvite(invite); err != nil {
+		return nil, fmt.Errorf("failed to create invite: %v", err)
+	}
+
+	invite.Token = token
+	invite.Link = appLink("/invite", token)
+	invite.Status = InvitePending
+
+	if invite.Email != nil {
+		if _, _, err := systemSMTP(); err == nil {
+			invite.EmailSent = true
+			go s.sendInvite(invite, admin.Username)
+		}
+	}
+
+	slog.Info("Admin created invite", "admin", admin.Username, "invite_id", invite.ID, "expires_at", invite.ExpiresAt.Format(time.RFC3339))
+	return invite, nil
+}
+
+func (s *AuthService) sendInvite(invite *Invite, invitedBy string) {
+	data := &mail.InviteData{
+		InvitedBy: invitedBy,
+		Link:      invite.Link,
+		Token:     invite.Token,
+		ExpiresAt: invite.ExpiresAt,
+	}
+	if invite.TeamName != nil {
+		data.TeamName = *invite.TeamName
+	}
+
+	if err := sendAccountEmail(mail.TemplateInvite, "You are invited to Velld", *invite.Email, data); err != nil {
+		slog.Error("Failed to send invite email", "invite_id", invite.ID, "error", err)
+	}
+}
+
+func (s *AuthService) GetInvites(ctx context.Context) ([]*Invite, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	invites, err := s.repo.GetInvites(inviteListLimit)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, invite := range invites {
+		invite.Status = invite.status(now)
+	}
+	return invites, nil
+}
+
+// RevokeInvite stops an unused invite from being used
+func (s *AuthService) RevokeInvite(ctx context.Context, inviteID string) error {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	invite, err := s.repo.GetInvite(inviteID)
+	if err != nil {
+		return err
+	}
+	revoked, err := s.repo.RevokeInvite(invite.ID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return fmt.Errorf("invite is already %s", invite.status(time.Now()))
+	}
+	return nil
+}
+
+// pendingInvite returns the invite of a token while it can be used
+func (s *AuthService) pendingInvite(token string) (*Invite, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrInvalidInvite
+	}
+
+	invite, err := s.repo.GetInviteByHash(hashToken(token))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidInvite
+	}
+	if err != nil {
+		return nil, err
+	}
+	if invite.status(time.Now()) != InvitePending {
+		return nil, ErrInvalidInvite
+	}
+	return invite, nil
+}
+
+// GetInviteDetails shows the recipient of an invite what they sign up for
+func (s *AuthService) GetInviteDetails(token, client string) (*InviteDetails, error) {
+	if err := s.allowClient(client); err != nil {
+		return nil, err
+	}
+
+	invite, err := s.pendingInvite(token)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &InviteDetails{
+		Email:     invite.Email,
+		TeamName:  invite.TeamName,
+		TeamRole:  invite.TeamRole,
+		ExpiresAt: invite.ExpiresAt,
+	}
+	if admin, err := s.repo.GetUserByID(invite.CreatedBy.String()); err == nil {
+		details.InvitedBy = admin.Username
+	}
+	return details, nil
+}
+
+// RegisterWithInvite signs up with an invite, which works even while
+// registration is closed, and signs the new user in. An email set on the
+// invite is taken as verified. Users who still have to verify their email
+// are not signed in, and get no tokens.
+func (s *AuthService) RegisterWithInvite(req *InviteRegisterRequest, client sessionClient) (*LoginResponse, error) {
+	if err := s.allowClient(client.remoteAddr); err != nil {
+		return nil, err
+	}
+
+	invite, err := s.pendingInvite(req.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	username := strings.TrimSpace(req.Username)
+	if username == "" {
+		return nil, ErrUsernameRequired
+	}
+	if err := validatePassword(req.Password); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.FindUserByUsername(username); err == nil {
+		return nil, ErrUsernameTaken
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &User{
+		ID:        uuid.New(),
+		Username:  username,
+		CreatedAt: now.Format("2006-01-02 15:04:05"),
+	}
+
+	var unverified bool
+	switch {
+	case invite.Email != nil:
+		if req.Email != "" {
+			email, err := normalizeEmail(req.Email)
+			if err != nil {
+				return nil, err
+			}
+			if email != *invite.Email {
+				return nil, ErrInviteEmailMismatch
+			}
+		}
+		if err := s.checkEmailAvailable(*invite.Email, nil); err != nil {
+			return nil, err
+		}
+		verifiedAt := now.Format(time.RFC3339)
+		user.Email = invite.Email
+		user.EmailVerifiedAt = &verifiedAt
+	case req.Email != "":
+		email, err := normalizeEmail(req.Email)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkEmailAvailable(email, nil); err != nil {
+			return nil, err
+		}
+		user.Email = &email
+		unverified = true
+	case requireEmailVerification():
+		return nil, ErrEmailRequired
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = string(hashedPassword)
+
+	if err := s.repo.RedeemInvite(invite, user, now); err != nil {
+		if err == errInviteTaken {
+			return nil, ErrInvalidInvite
+		}
+		return nil, err
+	}
+	slog.Info("User signed up with invite", "user", user.Username, "invite_id", invite.ID)
+
+	if unverified {
+		if _, _, err := systemSMTP(); err != nil {
+			slog.Warn("User registered with an email but no verification was sent", "user_id", user.ID, "error", err)
+		} else if err := s.sendVerification(user, *user.Email); err != nil {
+			slog.Error("Failed to send verification email", "user_id", user.ID, "error", err)
+		}
+		if requireEmailVerification() {
+			return nil, nil
+		}
+	}
+
+	return s.issueSessionTokens(user, uuid.Nil, client)
+}
+
+func (h *AuthHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	var req CreateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	invite, err := h.authService.CreateInvite(r.Context(), &req)
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Invite created successfully", invite)
+}
+
+func (h *AuthHandler) GetInvites(w http.ResponseWriter, r *http.Request) {
+	invites, err := h.authService.GetInvites(r.Context())
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Invites retrieved successfully", invites)
+}
+
+func (h *AuthHandler) RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	if err := h.authService.RevokeInvite(r.Context(), mux.Vars(r)["id"]); err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Invite revoked successfully", nil)
+}
+
+func (h *AuthHandler) GetInviteDetails(w http.ResponseWriter, r *http.Request) {
+	details, err := h.authService.GetInviteDetails(mux.Vars(r)["token"], clientAddr(r))
+	if err == ErrInvalidInvite {
+		response.SendError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		sendAccountError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Invite retrieved successfully", details)
+}
+
+func (h *AuthHandler) RegisterWithInvite(w http.ResponseWriter, r *http.Request) {
+	var req InviteRegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tokens, err := h.authService.RegisterWithInvite(&req, sessionClientOf(r))
+	if err != nil {
+		sendAccountError(w, err)
+		return
+	}
+	if tokens == nil {
+		response.SendSuccess(w, "Registration successful, verify your email to sign in", nil)
+		return
+	}
+
+	response.SendSuccess(w, "Registration successful", tokens)
+}
@@ -1,12 +1,23 @@
 package auth
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type User struct {
 	ID        uuid.UUID `json:"id"`
 	Username  string    `json:"username"`
 	Password  string    `json:"password ,omitempty"`
 	CreatedAt string    `json:"created_at"`
+	// DeactivatedAt is set once the admin deactivated the user, who can no
+	// longer sign in
+	DeactivatedAt *string `json:"deactivated_at,omitempty"`
+	// Email is optional; password resets are sent to it
+	Email *string `json:"email,omitempty"`
+	// EmailVerifiedAt is set once the user followed a link sent to Email
+	EmailVerifiedAt *string `json:"email_verified_at,omitempty"`
 }
 
 type LoginRequest struct {
@@ -14,10 +25,265 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Email is required when REQUIRE_EMAIL_VERIFICATION is set
+	Email string `json:"email,omitempty"`
+}
+
 type LoginResponse struct {
-	Token string `json:"token"`
+	// Token is the short-lived access token
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// RefreshToken gets a new pair of tokens once; it is replaced with
+	// every refresh
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Reasons a session's refresh tokens were revoked
+const (
+	RevokedLogout        = "logout"
+	RevokedByUser        = "revoked"
+	RevokedReuse         = "reuse"
+	RevokedDeactivated   = "deactivated"
+	RevokedPasswordReset = "password_reset"
+)
+
+// RefreshToken is one token of a session. The tokens of a session form a
+// family in which only the newest, unrotated token is usable. Only its hash
+// is stored.
+type RefreshToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	FamilyID   uuid.UUID
+	TokenHash  string
+	UserAgent  string
+	RemoteAddr string
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	// RotatedAt is set once the token was exchanged for a new one
+	RotatedAt     *time.Time
+	RevokedAt     *time.Time
+	RevokedReason *string
+}
+
+// Session is a sign-in that is kept alive by refreshing its tokens
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	// LastUsedAt is when the session last signed in or refreshed
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current is the session of the token making the request
+	Current bool `json:"current"`
 }
 
 type ProfileResponse struct {
+	Username      string  `json:"username"`
+	Email         *string `json:"email,omitempty"`
+	EmailVerified bool    `json:"email_verified"`
+	// ImpersonatedBy is the admin acting as this user, if any
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+}
+
+// Kinds of emailed auth tokens
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+// AuthToken is a single-use token emailed to a user. Only its hash is
+// stored.
+type AuthToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Kind      string
+	TokenHash string
+	// Email is the address the token was sent to
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type UpdateEmailRequest struct {
+	Email string `json:"email"`
+}
+
+// Invite states
+const (
+	InvitePending = "pending"
+	InviteUsed    = "used"
+	InviteExpired = "expired"
+	InviteRevoked = "revoked"
+)
+
+// Invite lets someone sign up while registration is closed, optionally
+// joining a team with a preset role
+type Invite struct {
+	ID        uuid.UUID `json:"id"`
+	TokenHash string    `json:"-"`
+	// Email, when set, is the only address the invite can sign up with
+	Email    *string `json:"email,omitempty"`
+	TeamID   *string `json:"team_id,omitempty"`
+	TeamName *string `json:"team_name,omitempty"`
+	// TeamRole is admin or member in the team
+	TeamRole       *string    `json:"team_role,omitempty"`
+	CreatedBy      uuid.UUID  `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	UsedAt         *time.Time `json:"used_at,omitempty"`
+	UsedBy         *string    `json:"used_by,omitempty"`
+	UsedByUsername *string    `json:"used_by_username,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	Status         string     `json:"status"`
+	// Token and Link are only returned when the invite is created
+	Token string `json:"token,omitempty"`
+	Link  string `json:"link,omitempty"`
+	// EmailSent tells whether the link was emailed to Email
+	EmailSent bool `json:"email_sent,omitempty"`
+}
+
+type CreateInviteRequest struct {
+	Email  string `json:"email,omitempty"`
+	TeamID string `json:"team_id,omitempty"`
+	// Role in the team, defaults to member
+	Role string `json:"role,omitempty"`
+	// ExpiresInHours defaults to 72 and is at most 720
+	ExpiresInHours int `json:"expires_in_hours,omitempty"`
+}
+
+// InviteDetails is what the recipient of an invite sees before signing up
+type InviteDetails struct {
+	Email     *string   `json:"email,omitempty"`
+	TeamName  *string   `json:"team_name,omitempty"`
+	TeamRole  *string   `json:"team_role,omitempty"`
+	InvitedBy string    `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type InviteRegisterRequest struct {
+	Token    string `json:"token"`
 	Username string `json:"username"`
+	Password string `json:"password"`
+	// Email is taken from the invite when it names one
+	Email string `json:"email,omitempty"`
+}
+
+type ImpersonateRequest struct {
+	Username string `json:"username"`
+	// Reason is recorded in the audit trail and required
+	Reason string `json:"reason"`
+	// DurationMinutes bounds the session, defaults to 30 and is at most 240
+	DurationMinutes int `json:"duration_minutes,omitempty"`
+}
+
+type ImpersonateResponse struct {
+	Token   string                `json:"token"`
+	Session *ImpersonationSession `json:"session"`
+}
+
+// ImpersonationSession is one audited session of an admin acting as a user
+type ImpersonationSession struct {
+	ID             uuid.UUID            `json:"id"`
+	AdminID        uuid.UUID            `json:"admin_id"`
+	AdminUsername  string               `json:"admin_username"`
+	TargetUserID   uuid.UUID            `json:"target_user_id"`
+	TargetUsername string               `json:"target_username"`
+	Reason         string               `json:"reason"`
+	StartedAt      time.Time            `json:"started_at"`
+	ExpiresAt      time.Time            `json:"expires_at"`
+	EndedAt        *time.Time           `json:"ended_at,omitempty"`
+	Events         []ImpersonationEvent `json:"events,omitempty"`
+}
+
+// ImpersonationEvent is a request made with an impersonation token
+type ImpersonationEvent struct {
+	ID        uuid.UUID `json:"id"`
+	SessionID uuid.UUID `json:"session_id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TransferOwnershipRequest moves a user's connections, with their schedules
+// and backups, to another user or into the admin's hold
+type TransferOwnershipRequest struct {
+	ToUsername string `json:"to_username,omitempty"`
+	// Hold parks the connections with the admin until they are reassigned
+	Hold bool `json:"hold"`
+	// ConnectionIDs limits the transfer, defaulting to all of the user's
+	// connections
+	ConnectionIDs []string `json:"connection_ids,omitempty"`
+}
+
+type DeactivateUserRequest struct {
+	// Transfer moves the user's connections away as part of deactivating.
+	// Without it they stay with the user and are listed as orphaned.
+	Transfer *TransferOwnershipRequest `json:"transfer,omitempty"`
+}
+
+// OwnershipTransfer is the outcome of moving connections between users
+type OwnershipTransfer struct {
+	FromUsername  string   `json:"from_username"`
+	ToUsername    string   `json:"to_username"`
+	Held          bool     `json:"held"`
+	ConnectionIDs []string `json:"connection_ids"`
+	// EnabledSchedules keep running under the new owner
+	EnabledSchedules int      `json:"enabled_schedules"`
+	Warnings         []string `json:"warnings"`
+}
+
+// DeactivationResult is a deactivated user with the transfer made, if any
+type DeactivationResult struct {
+	Username      string             `json:"username"`
+	DeactivatedAt string             `json:"deactivated_at"`
+	Transfer      *OwnershipTransfer `json:"transfer,omitempty"`
+}
+
+// Reasons a connection is listed as orphaned
+const (
+	OrphanOwnerDeactivated = "owner_deactivated"
+	OrphanOwnerMissing     = "owner_missing"
+	OrphanHeld             = "held"
+)
+
+// OrphanedConnection is a connection whose owner can no longer manage it,
+// or that the admin holds until it is reassigned. Its schedules keep running.
+type OrphanedConnection struct {
+	ID               string  `json:"id"`
+	Name             string  `json:"name"`
+	Type             string  `json:"type"`
+	UserID           *string `json:"user_id,omitempty"`
+	Username         *string `json:"username,omitempty"`
+	Reason           string  `json:"reason"`
+	PreviousUserID   *string `json:"previous_user_id,omitempty"`
+	HeldAt           *string `json:"held_at,omitempty"`
+	EnabledSchedules int     `json:"enabled_schedules"`
 }
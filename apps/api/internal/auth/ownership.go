@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/gorilla/mux"
+)
+
+// ErrUserDeactivated refuses sign-ins and tokens of deactivated users
+var ErrUserDeactivated = errors.New("user is deactivated")
+
+// DeactivateUser stops a user from signing in. Their connections keep
+// backing up on schedule; they are transferred with the request, or listed
+// as orphaned until the admin transfers them.
+func (s *AuthService) DeactivateUser(ctx context.Context, username string, req *DeactivateUserRequest) (*DeactivationResult, error) {
+	admin, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.FindUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == admin.ID {
+		return nil, errors.New("the admin user cannot be deactivated")
+	}
+	if user.DeactivatedAt != nil {
+		return nil, errors.New("user is already deactivated")
+	}
+
+	result := &DeactivationResult{Username: user.Username}
+	if req.Transfer != nil {
+		transfer, err := s.transferOwnership(admin, user, req.Transfer)
+		if err != nil {
+			return nil, err
+		}
+		result.Transfer = transfer
+	}
+
+	result.DeactivatedAt = time.Now().Format(time.RFC3339)
+	if err := s.repo.SetUserDeactivatedAt(user.ID, &result.DeactivatedAt); err != nil {
+		return nil, fmt.Errorf("failed to deactivate user: %v", err)
+	}
+	s.revokeAllSessions(user.ID, RevokedDeactivated)
+
+	return result, nil
+}
+
+// ReactivateUser lets a deactivated user sign in again. Connections that
+// were transferred away stay with their new owner.
+func (s *AuthService) ReactivateUser(ctx context.Context, username string) error {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return err
+	}
+
+	user, err := s.repo.FindUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user.DeactivatedAt == nil {
+		return errors.New("user is not deactivated")
+	}
+
+	return s.repo.SetUserDeactivatedAt(user.ID, nil)
+}
+
+// TransferOwnership moves a user's connections to another user, or into the
+// admin's hold. Held connections are reassigned by transferring them from
+// the admin.
+func (s *AuthService) TransferOwnership(ctx context.Context, username string, req *TransferOwnershipRequest) (*OwnershipTransfer, error) {
+	admin, err := s.requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := s.repo.FindUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.transferOwnership(admin, from, req)
+}
+
+func (s *AuthService) transferOwnership(admin, from *User, req *TransferOwnershipRequest) (*OwnershipTransfer, error) {
+	if req.Hold == (req.ToUsername != "") {
+		return nil, errors.New("either to_username or hold is required")
+	}
+
+	to := admin
+	if !req.Hold {
+		var err error
+		to, err = s.repo.FindUserByUsername(req.ToUsername)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user '%s' does not exist", req.ToUsername)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if to.ID == from.ID {
+			return nil, errors.New("connections cannot be transferred to their owner")
+		}
+		if to.DeactivatedAt != nil {
+			return nil, fmt.Errorf("user '%s' is deactivated", to.Username)
+		}
+	}
+
+	transfer, err := s.repo.TransferConnections(from.ID, to.ID, req.ConnectionIDs, req.Hold)
+	if err != nil {
+		return nil, err
+	}
+	transfer.FromUsername = from.Username
+	transfer.ToUsername = to.Username
+	transfer.Warnings = []string{}
+
+	// Uploads, downloads and pruning use the owner's S3 settings, so objects
+	// uploaded before the transfer are only reachable if both point at the
+	// same bucket
+	s3Backups, err := s.repo.CountS3Backups(transfer.ConnectionIDs)
+	if err != nil {
+		slog.Warn("Failed to count S3 backups of transferred connections", "error", err)
+	} else if s3Backups > 0 {
+		transfer.Warnings = append(transfer.Warnings, fmt.Sprintf(
+			"%d backups were uploaded with the S3 settings of '%s' and are now downloaded and pruned with those of '%s'",
+			s3Backups, from.Username, to.Username))
+	}
+
+	return transfer, nil
+}
+
+// GetOrphanedConnections lists the connections no active user manages
+func (s *AuthService) GetOrphanedConnections(ctx context.Context) ([]OrphanedConnection, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	return s.repo.GetOrphanedConnections()
+}
+
+// RejectDeactivated refuses the tokens of deactivated or deleted users and
+// of revoked sessions, which stay valid until they expire otherwise
+func (h *AuthHandler) RejectDeactivated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := claimsFromContext(r.Context())
+		if err != nil {
+			response.SendError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		userID, _ := claims["user_id"].(string)
+		user, err := h.authService.repo.GetUserByID(userID)
+		if err == sql.ErrNoRows || (err == nil && user.DeactivatedAt != nil) {
+			response.SendError(w, http.StatusUnauthorized, ErrUserDeactivated.Error())
+			return
+		}
+		if err != nil {
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if sessionID := sessionFromClaims(claims); sessionID != "" {
+			active, err := h.authService.repo.IsRefreshTokenFamilyActive(sessionID)
+			if err != nil {
+				response.SendError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if !active {
+				response.SendError(w, http.StatusUnauthorized, ErrSessionRevoked.Error())
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *AuthHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	// The body is optional
+	var req DeactivateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result, err := h.authService.DeactivateUser(r.Context(), mux.Vars(r)["username"], &req)
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "User deactivated", result)
+}
+
+func (h *AuthHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	if err := h.authService.ReactivateUser(r.Context(), mux.Vars(r)["username"]); err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "User reactivated", nil)
+}
+
+func (h *AuthHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	var req TransferOwnershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	transfer, err := h.authService.TransferOwnership(r.Context(), mux.Vars(r)["username"], &req)
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Ownership transferred", transfer)
+}
+
+func (h *AuthHandler) GetOrphanedConnections(w http.ResponseWriter, r *http.Request) {
+	orphans, err := h.authService.GetOrphanedConnections(r.Context())
+	if err != nil {
+		sendAdminError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Orphaned connections retrieved successfully", orphans)
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/mail"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ForgotPassword emails a reset link to the user with the address. It does
+// not tell whether such a user exists: unknown and deactivated users get no
+// email, and the email is sent in the background.
+func (s *AuthService) ForgotPassword(email, client string) error {
+	if err := s.allowClient(client); err != nil {
+		return err
+	}
+	if _, _, err := systemSMTP(); err != nil {
+		return err
+	}
+
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.FindUserByEmail(email)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.DeactivatedAt != nil || !s.allowEmail(email) {
+		return nil
+	}
+
+	token, expiresAt, err := s.issueToken(user, TokenPasswordReset, email, tokenTTL("PASSWORD_RESET_TOKEN_TTL_MINUTES", time.Minute, defaultPasswordResetTTL))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		err := sendAccountEmail(mail.TemplatePasswordReset, "Reset your Velld password", email, &mail.AccountLinkData{
+			Username:  user.Username,
+			Link:      appLink("/reset-password", token),
+			Token:     token,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			slog.Error("Failed to send password reset email", "user_id", user.ID, "error", err)
+		}
+	}()
+	return nil
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword and
+// signs the user out everywhere. The token proves access to the email, so an
+// unverified email is verified.
+func (s *AuthService) ResetPassword(token, password, client string) error {
+	if err := s.allowClient(client); err != nil {
+		return err
+	}
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
+	authToken, err := s.redeemToken(TokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByID(authToken.UserID.String())
+	if err == sql.ErrNoRows {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+	if user.DeactivatedAt != nil {
+		return ErrUserDeactivated
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetUserPassword(user.ID, string(hashedPassword)); err != nil {
+		return err
+	}
+	s.revokeAllSessions(user.ID, RevokedPasswordReset)
+
+	if user.EmailVerifiedAt == nil {
+		if err := s.repo.MarkEmailVerified(user.ID, authToken.Email, time.Now().Format(time.RFC3339)); err != nil {
+			slog.Warn("Failed to verify email after password reset", "user_id", user.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.authService.ForgotPassword(req.Email, clientAddr(r)); err != nil {
+		sendAccountError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "If an account uses this email, a reset link has been sent to it", nil)
+}
+
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.authService.ResetPassword(req.Token, req.Password, clientAddr(r)); err != nil {
+		if err == ErrUserDeactivated {
+			response.SendError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		sendAccountError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Password reset successfully", nil)
+}
@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+	// claimSessionID names the session an access token was issued for
+	claimSessionID = "session_id"
+)
+
+var (
+	ErrRefreshTokenReused = errors.New("refresh token was already used, the session has been revoked")
+	ErrSessionRevoked     = errors.New("session has been revoked")
+)
+
+// sessionClient describes where a sign-in or refresh came from
+type sessionClient struct {
+	userAgent  string
+	remoteAddr string
+}
+
+func sessionClientOf(r *http.Request) sessionClient {
+	return sessionClient{userAgent: r.UserAgent(), remoteAddr: clientAddr(r)}
+}
+
+// accessToken signs a short-lived access token for a session
+func (s *AuthService) accessToken(user *User, sessionID uuid.UUID, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(tokenTTL("ACCESS_TOKEN_TTL_MINUTES", time.Minute, defaultAccessTokenTTL))
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":      user.ID,
+		"username":     user.Username,
+		claimSessionID: sessionID.String(),
+		"exp":          expiresAt.Unix(),
+	})
+
+	signed, err := token.SignedString(s.jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// issueSessionTokens returns an access token and a new refresh token of the
+// session. A new session starts with familyID uuid.Nil.
+func (s *AuthService) issueSessionTokens(user *User, familyID uuid.UUID, client sessionClient) (*LoginResponse, error) {
+	refreshToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if familyID == uuid.Nil {
+		familyID = uuid.New()
+		if err := s.repo.DeleteExpiredRefreshTokens(now); err != nil {
+			slog.Warn("Failed to remove expired refresh tokens", "error", err)
+		}
+	}
+
+	stored := &RefreshToken{
+		ID:         uuid.New(),
+		UserID:     user.ID,
+		FamilyID:   familyID,
+		TokenHash:  hashToken(refreshToken),
+		UserAgent:  client.userAgent,
+		RemoteAddr: client.remoteAddr,
+		ExpiresAt:  now.Add(tokenTTL("REFRESH_TOKEN_TTL_HOURS", time.Hour, defaultRefreshTokenTTL)),
+		CreatedAt:  now,
+	}
+	if err := s.repo.CreateRefreshToken(stored); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %v", err)
+	}
+
+	access, expiresAt, err := s.accessToken(user, familyID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:            access,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: stored.ExpiresAt,
+	}, nil
+}
+
+// Refresh exchanges a refresh token for a new pair of tokens. Each refresh
+// token works once: presenting one that was exchanged already means it was
+// stolen or replayed, so the whole session is revoked.
+func (s *AuthService) Refresh(refreshToken string, client sessionClient) (*LoginResponse, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidToken
+	}
+
+	stored, err := s.repo.GetRefreshTokenByHash(hashToken(refreshToken))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if stored.RevokedAt != nil {
+		return nil, ErrSessionRevoked
+	}
+	if stored.RotatedAt != nil {
+		return nil, s.revokeReusedFamily(stored, client, now)
+	}
+	if now.After(stored.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.repo.GetUserByID(stored.UserID.String())
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == sql.ErrNoRows || user.DeactivatedAt != nil {
+		if err := s.repo.RevokeRefreshTokenFamily(stored.FamilyID, RevokedDeactivated, now); err != nil {
+			slog.Warn("Failed to revoke session of deactivated user", "session_id", stored.FamilyID, "error", err)
+		}
+		return nil, ErrUserDeactivated
+	}
+
+	rotated, err := s.repo.RotateRefreshToken(stored.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// Another refresh exchanged the token first
+		return nil, s.revokeReusedFamily(stored, client, now)
+	}
+
+	return s.issueSessionTokens(user, stored.FamilyID, client)
+}
+
+func (s *AuthService) revokeReusedFamily(stored *RefreshToken, client sessionClient, now time.Time) error {
+	slog.Warn("Refresh token reused, revoking session",
+		"user_id", stored.UserID, "session_id", stored.FamilyID, "remote_addr", client.remoteAddr)
+	if err := s.repo.RevokeRefreshTokenFamily(stored.FamilyID, RevokedReuse, now); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// Logout revokes the session of a refresh token. Unknown tokens are
+// ignored, so signing out twice is not an error.
+func (s *AuthService) Logout(refreshToken string) error {
+	if refreshToken == "" {
+		return nil
+	}
+
+	stored, err := s.repo.GetRefreshTokenByHash(hashToken(refreshToken))
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.repo.RevokeRefreshTokenFamily(stored.FamilyID, RevokedLogout, time.Now())
+}
+
+// sessionFromClaims returns the session of an access token, or an empty ID
+// for tokens without one
+func sessionFromClaims(claims jwt.MapClaims) string {
+	sessionID, _ := claims[claimSessionID].(string)
+	return sessionID
+}
+
+// GetSessions lists the signed-in user's active sessions
+func (s *AuthService) GetSessions(ctx context.Context) ([]*Session, error) {
+	user, err := s.userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current := sessionFromClaims(claims)
+
+	tokens, err := s.repo.GetActiveRefreshTokens(user.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*Session{}
+	for _, token := range tokens {
+		startedAt, err := s.repo.GetRefreshTokenFamilyStart(token.FamilyID)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &Session{
+			ID:         token.FamilyID,
+			UserAgent:  token.UserAgent,
+			RemoteAddr: token.RemoteAddr,
+			CreatedAt:  startedAt,
+			LastUsedAt: token.CreatedAt,
+			ExpiresAt:  token.ExpiresAt,
+			Current:    token.FamilyID.String() == current,
+		})
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs one of the user's sessions out. Its access tokens are
+// refused from the next request on.
+func (s *AuthService) RevokeSession(ctx context.Context, sessionID string) error {
+	user, err := s.userFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	familyID, err := uuid.Parse(sessionID)
+	if err != nil {
+		return sql.ErrNoRows
+	}
+	tokens, err := s.repo.GetActiveRefreshTokens(user.ID, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if token.FamilyID == familyID {
+			return s.repo.RevokeRefreshTokenFamily(familyID, RevokedByUser, time.Now())
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// RevokeOtherSessions signs the user out everywhere but the current
+// session
+func (s *AuthService) RevokeOtherSessions(ctx context.Context) error {
+	user, err := s.userFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	current, err := uuid.Parse(sessionFromClaims(claims))
+	if err != nil {
+		current = uuid.Nil
+	}
+	return s.repo.RevokeUserRefreshTokens(user.ID, current, RevokedByUser, time.Now())
+}
+
+// revokeAllSessions signs a user out everywhere, e.g. once they were
+// deactivated or their password was reset
+func (s *AuthService) revokeAllSessions(userID uuid.UUID, reason string) {
+	if err := s.repo.RevokeUserRefreshTokens(userID, uuid.Nil, reason, time.Now()); err != nil {
+		slog.Error("Failed to revoke sessions", "user_id", userID, "reason", reason, "error", err)
+	}
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tokens, err := h.authService.Refresh(req.RefreshToken, sessionClientOf(r))
+	if err != nil {
+		sendSessionError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Token refreshed successfully", tokens)
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.authService.Logout(req.RefreshToken); err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Logged out successfully", nil)
+}
+
+func (h *AuthHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.authService.GetSessions(r.Context())
+	if err != nil {
+		sendSessionError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Sessions retrieved successfully", sessions)
+}
+
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if err := h.authService.RevokeSession(r.Context(), mux.Vars(r)["id"]); err != nil {
+		sendSessionError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Session revoked successfully", nil)
+}
+
+func (h *AuthHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	if err := h.authService.RevokeOtherSessions(r.Context()); err != nil {
+		sendSessionError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Other sessions revoked successfully", nil)
+}
+
+func sendSessionError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrInvalidToken, ErrRefreshTokenReused, ErrSessionRevoked, ErrUserDeactivated:
+		response.SendError(w, http.StatusUnauthorized, err.Error())
+	case sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Session not found")
+	default:
+		sendAccountError(w, err)
+	}
+}
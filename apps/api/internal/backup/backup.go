@@ -3,15 +3,12 @@ package backup
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
 	"github.com/gorilla/mux"
 )
 
@@ -25,12 +22,36 @@ func NewBackupHandler(bs *BackupService) *BackupHandler {
 	}
 }
 
+// requireConnectionAccess returns the connection if the user owns it or
+// shares it through a team, and otherwise answers the request with notFound
+// and returns nil
+func (h *BackupHandler) requireConnectionAccess(w http.ResponseWriter, r *http.Request, connectionID, notFound string) *connection.StoredConnection {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	conn, err := h.backupService.accessibleConnection(connectionID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, notFound)
+			return nil
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return nil
+	}
+	return conn
+}
+
 func (h *BackupHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
 	var req BackupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if h.requireConnectionAccess(w, r, req.ConnectionID, "Connection not found") == nil {
+		return
+	}
 
 	backup, err := h.backupService.CreateBackup(req.ConnectionID)
 	if err != nil {
@@ -54,6 +75,9 @@ func (h *BackupHandler) GetBackup(w http.ResponseWriter, r *http.Request) {
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if h.requireConnectionAccess(w, r, backup.ConnectionID, "Backup not found") == nil {
+		return
+	}
 
 	response.SendSuccess(w, "Backup retrieved successfully", backup)
 }
@@ -108,27 +132,36 @@ func (h *BackupHandler) ScheduleBackup(w http.ResponseWriter, r *http.Request) {
 		response.SendError(w, http.StatusBadRequest, "connection_id is required")
 		return
 	}
-	if req.CronSchedule == "" {
-		response.SendError(w, http.StatusBadRequest, "cron_schedule is required")
+	if h.requireConnectionAccess(w, r, req.ConnectionID, "Connection not found") == nil {
 		return
 	}
-	if req.RetentionDays <= 0 {
-		response.SendError(w, http.StatusBadRequest, "retention_days must be greater than 0")
+	if req.CronSchedule == "" && req.RunAt == nil {
+		response.SendError(w, http.StatusBadRequest, "cron_schedule or run_at is required")
+		return
+	}
+	if req.RetentionDays < 0 || (req.RetentionDays == 0 && (req.RetentionMaxBytes == nil || *req.RetentionMaxBytes <= 0)) {
+		response.SendError(w, http.StatusBadRequest, "retention_days or retention_max_bytes must be greater than 0")
 		return
 	}
 
-	err := h.backupService.ScheduleBackup(&req)
+	warnings, err := h.backupService.ScheduleBackup(&req)
 	if err != nil {
-		response.SendError(w, http.StatusInternalServerError, err.Error())
+		sendScheduleError(w, err)
 		return
 	}
 
-	response.SendSuccess(w, "Backup scheduled successfully", nil)
+	response.SendSuccess(w, "Backup scheduled successfully", map[string]interface{}{
+		"warnings":  warnings,
+		"next_runs": h.backupService.scheduleNextRuns(req.ConnectionID),
+	})
 }
 
 func (h *BackupHandler) DisableBackupSchedule(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	connectionID := vars["connection_id"]
+	if h.requireConnectionAccess(w, r, connectionID, "No active schedule found") == nil {
+		return
+	}
 
 	err := h.backupService.DisableBackupSchedule(connectionID)
 	if err != nil {
@@ -146,6 +179,9 @@ func (h *BackupHandler) DisableBackupSchedule(w http.ResponseWriter, r *http.Req
 func (h *BackupHandler) UpdateBackupSchedule(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	connectionID := vars["connection_id"]
+	if h.requireConnectionAccess(w, r, connectionID, "No active schedule found") == nil {
+		return
+	}
 
 	var req UpdateScheduleRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -153,12 +189,12 @@ func (h *BackupHandler) UpdateBackupSchedule(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if req.CronSchedule == "" {
-		response.SendError(w, http.StatusBadRequest, "cron_schedule is required")
+	if req.CronSchedule == "" && req.RunAt == nil {
+		response.SendError(w, http.StatusBadRequest, "cron_schedule or run_at is required")
 		return
 	}
-	if req.RetentionDays <= 0 {
-		response.SendError(w, http.StatusBadRequest, "retention_days must be greater than 0")
+	if req.RetentionDays < 0 || (req.RetentionDays == 0 && (req.RetentionMaxBytes == nil || *req.RetentionMaxBytes <= 0)) {
+		response.SendError(w, http.StatusBadRequest, "retention_days or retention_max_bytes must be greater than 0")
 		return
 	}
 
@@ -168,11 +204,13 @@ func (h *BackupHandler) UpdateBackupSchedule(w http.ResponseWriter, r *http.Requ
 			response.SendError(w, http.StatusNotFound, "No active schedule found")
 			return
 		}
-		response.SendError(w, http.StatusInternalServerError, err.Error())
+		sendScheduleError(w, err)
 		return
 	}
 
-	response.SendSuccess(w, "Backup schedule updated successfully", nil)
+	response.SendSuccess(w, "Backup schedule updated successfully", map[string]interface{}{
+		"next_runs": h.backupService.scheduleNextRuns(connectionID),
+	})
 }
 
 func (h *BackupHandler) GetBackupStats(w http.ResponseWriter, r *http.Request) {
@@ -191,82 +229,84 @@ func (h *BackupHandler) GetBackupStats(w http.ResponseWriter, r *http.Request) {
 	response.SendSuccess(w, "Backup statistics retrieved successfully", stats)
 }
 
-func (h *BackupHandler) DownloadBackup(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	backupID := vars["id"]
-
-	userID, err := common.GetUserIDFromContext(r.Context())
-	if err != nil {
+func (h *BackupHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	var req RestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	backup, err := h.backupService.GetBackup(backupID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			response.SendError(w, http.StatusNotFound, "Backup not found")
-			return
-		}
-		response.SendError(w, http.StatusInternalServerError, err.Error())
+	if req.BackupID == "" {
+		response.SendError(w, http.StatusBadRequest, "backup_id is required")
 		return
 	}
 
-	// Ensure backup file is available (local or download from S3)
-	filePath, isTemp, err := h.backupService.ensureBackupFileAvailable(backup, userID)
-	if err != nil {
-		response.SendError(w, http.StatusInternalServerError, err.Error())
+	if req.ConnectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
 		return
 	}
 
-	// Clean up temp file after download if needed
-	if isTemp {
-		defer func() {
-			if err := os.Remove(filePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp file %s: %v\n", filePath, err)
-			}
-		}()
-	}
-
-	file, err := os.Open(filePath)
+	userID, err := common.GetUserIDFromContext(r.Context())
 	if err != nil {
-		response.SendError(w, http.StatusInternalServerError, "Failed to open backup file")
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if h.requireConnectionAccess(w, r, req.ConnectionID, "Connection not found") == nil {
 		return
 	}
-	defer file.Close()
-
-	filename := filepath.Base(backup.Path)
-	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
-	w.Header().Set("Content-Type", "application/octet-stream")
 
-	_, err = io.Copy(w, file)
-	if err != nil {
-		response.SendError(w, http.StatusInternalServerError, "Failed to send file")
+	if req.DryRun {
+		preview, err := h.backupService.PreviewRestore(&req, userID)
+		if err != nil {
+			sendRestoreError(w, err)
+			return
+		}
+		response.SendSuccess(w, "Restore preview generated successfully", preview)
 		return
 	}
-}
 
-func (h *BackupHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
-	var req RestoreRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response.SendError(w, http.StatusBadRequest, err.Error())
+	access := newArtifactAccess(r, req.BackupID, userID, AccessRestore)
+	target := "connection " + req.ConnectionID
+	if req.DatabaseName != "" {
+		target += " database " + req.DatabaseName
+	}
+	access.Detail = &target
+	if !req.Selection.isEmpty() {
+		access.Selection = req.Selection
+	}
+	if err := h.backupService.recordArtifactAccess(access); err != nil {
+		sendAccessError(w, err)
 		return
 	}
 
-	if req.BackupID == "" {
-		response.SendError(w, http.StatusBadRequest, "backup_id is required")
+	result, err := h.backupService.RestoreBackup(&req, access)
+	if err != nil {
+		sendRestoreError(w, err)
 		return
 	}
 
-	if req.ConnectionID == "" {
-		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+	response.SendSuccess(w, "Backup restored successfully", result)
+}
+
+func (h *BackupHandler) VerifyBackupEncryption(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	err := h.backupService.RestoreBackup(req.BackupID, req.ConnectionID)
+	result, err := h.backupService.VerifyBackupEncryption(backupID, userID)
 	if err != nil {
-		response.SendError(w, http.StatusInternalServerError, err.Error())
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	response.SendSuccess(w, "Backup restored successfully", nil)
+	response.SendSuccess(w, "Backup encryption verified", result)
 }
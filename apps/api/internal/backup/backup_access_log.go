@@ -0,0 +1,239 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Ways an artifact's contents leave velld's hands
+const (
+	AccessDownload            = "download"
+	AccessRestore             = "restore"
+	AccessRestoreVerification = "restore_verification"
+	AccessPrepare             = "prepare"
+	AccessExport              = "export"
+)
+
+const (
+	defaultAccessListLimit = 100
+	maxAccessListLimit     = 1000
+	// maxUserAgentLength keeps an oversized header out of the log
+	maxUserAgentLength = 512
+)
+
+// ArtifactAccess is one request for a backup artifact's contents: who made
+// it, when, from where and what for. Artifacts hold full copies of production
+// data, so their reads are audited like reads of the database itself. The
+// access is recorded before the artifact is read, so failed and refused
+// requests are kept as well.
+type ArtifactAccess struct {
+	ID           uuid.UUID `json:"id"`
+	BackupID     string    `json:"backup_id"`
+	ConnectionID string    `json:"connection_id"`
+	Action       string    `json:"action"`
+	// Detail names the target of restores
+	Detail *string `json:"detail,omitempty"`
+	// Selection is the part of the backup a selective restore was limited to
+	Selection *RestoreSelection `json:"selection,omitempty"`
+	UserID    uuid.UUID         `json:"user_id"`
+	Username  *string           `json:"username,omitempty"`
+	// Impersonator is the admin who acted as the user, if any
+	Impersonator *string `json:"impersonator,omitempty"`
+	RemoteAddr   string  `json:"remote_addr"`
+	// ForwardedFor is the X-Forwarded-For header as received, for requests
+	// through a proxy
+	ForwardedFor *string   `json:"forwarded_for,omitempty"`
+	UserAgent    *string   `json:"user_agent,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// newArtifactAccess describes the access of backupID by the request's user
+func newArtifactAccess(r *http.Request, backupID string, userID uuid.UUID, action string) *ArtifactAccess {
+	access := &ArtifactAccess{
+		ID:         uuid.New(),
+		BackupID:   backupID,
+		Action:     action,
+		UserID:     userID,
+		RemoteAddr: r.RemoteAddr,
+		CreatedAt:  time.Now(),
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		access.RemoteAddr = host
+	}
+	if forwarded := strings.TrimSpace(r.Header.Get("X-Forwarded-For")); forwarded != "" {
+		access.ForwardedFor = &forwarded
+	}
+	if userAgent := r.UserAgent(); userAgent != "" {
+		if len(userAgent) > maxUserAgentLength {
+			userAgent = userAgent[:maxUserAgentLength]
+		}
+		access.UserAgent = &userAgent
+	}
+
+	if claims, ok := r.Context().Value("user").(jwt.MapClaims); ok {
+		if username, _ := claims["username"].(string); username != "" {
+			access.Username = &username
+		}
+		if impersonator, _ := claims["impersonator"].(string); impersonator != "" {
+			access.Impersonator = &impersonator
+		}
+	}
+
+	return access
+}
+
+// recordArtifactAccess logs an access before the artifact is read. Callers
+// refuse the access when it cannot be recorded; sql.ErrNoRows means the
+// backup does not exist or the user cannot access its connection.
+func (s *BackupService) recordArtifactAccess(access *ArtifactAccess) error {
+	backup, err := s.backupRepo.GetBackup(access.BackupID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.accessibleConnection(backup.ConnectionID, access.UserID); err != nil {
+		return err
+	}
+	access.ConnectionID = backup.ConnectionID
+
+	if err := s.backupRepo.CreateArtifactAccess(access); err != nil {
+		return fmt.Errorf("failed to record artifact access: %v", err)
+	}
+	return nil
+}
+
+// accessListLimit clamps the limit of an access log request
+func accessListLimit(limit int) int {
+	if limit <= 0 {
+		return defaultAccessListLimit
+	}
+	if limit > maxAccessListLimit {
+		return maxAccessListLimit
+	}
+	return limit
+}
+
+// GetBackupAccessLog returns the accesses of one artifact, newest first
+func (s *BackupService) GetBackupAccessLog(backupID string, userID uuid.UUID, limit int) ([]*ArtifactAccess, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.backupRepo.GetBackupAccesses(backupID, accessListLimit(limit))
+}
+
+// GetConnectionAccessLog returns the accesses of every artifact of a
+// connection, including artifacts deleted since
+func (s *BackupService) GetConnectionAccessLog(connectionID string, userID uuid.UUID, limit int) ([]*ArtifactAccess, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.backupRepo.GetConnectionAccesses(connectionID, accessListLimit(limit))
+}
+
+func parseAccessListLimit(r *http.Request) (int, error) {
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid limit")
+	}
+	return limit, nil
+}
+
+func (h *BackupHandler) GetBackupAccessLog(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit, err := parseAccessListLimit(r)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	accesses, err := h.backupService.GetBackupAccessLog(backupID, userID, limit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup access log retrieved successfully", accesses)
+}
+
+func (h *BackupHandler) GetConnectionAccessLog(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	connectionID := r.URL.Query().Get("connection_id")
+	if connectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+
+	limit, err := parseAccessListLimit(r)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	accesses, err := h.backupService.GetConnectionAccessLog(connectionID, userID, limit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup access log retrieved successfully", accesses)
+}
+
+// sendAccessError answers a request whose access could not be recorded
+func sendAccessError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		response.SendError(w, http.StatusNotFound, "Backup not found")
+		return
+	}
+	response.SendError(w, http.StatusInternalServerError, err.Error())
+}
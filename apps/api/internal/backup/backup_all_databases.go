@@ -0,0 +1,169 @@
+package backup
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// maxDatabaseWorkers caps how many databases of a run are dumped at once
+const maxDatabaseWorkers = 8
+
+// allDatabasesTypes are the database types whose databases can be discovered
+// and dumped one by one. A Redis dump already holds every database.
+var allDatabasesTypes = map[string]bool{
+	"postgresql": true,
+	"mysql":      true,
+	"mariadb":    true,
+	"mongodb":    true,
+}
+
+// validateAllDatabases checks the all databases toggle submitted with a
+// schedule request. The databases are discovered at run time, so it replaces
+// the connection's selected databases and copies of the whole server.
+func (s *BackupService) validateAllDatabases(connectionID string, enabled *bool, physical bool) error {
+	if enabled == nil || !*enabled {
+		return nil
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	if !allDatabasesTypes[conn.Type] {
+		return fmt.Errorf("all databases backups are not supported for %s connections", conn.Type)
+	}
+	if len(conn.SelectedDatabases) > 0 {
+		return fmt.Errorf("all databases backups cannot be combined with selected databases")
+	}
+	if physical {
+		return fmt.Errorf("physical backups already include every database")
+	}
+
+	return nil
+}
+
+func validateDatabaseWorkers(workers *int) error {
+	if workers != nil && (*workers < 0 || *workers > maxDatabaseWorkers) {
+		return fmt.Errorf("database workers must be between 0 and %d", maxDatabaseWorkers)
+	}
+	return nil
+}
+
+func allDatabasesFor(schedule *BackupSchedule) bool {
+	return schedule != nil && schedule.AllDatabases
+}
+
+// databaseWorkersFor returns how many databases of a multi-database run are
+// dumped at once
+func databaseWorkersFor(schedule *BackupSchedule) int {
+	if schedule == nil || schedule.DatabaseWorkers < 1 {
+		return 1
+	}
+	return schedule.DatabaseWorkers
+}
+
+// selectRunDatabases picks the databases a run backs up when its schedule
+// decides them: the schedule's own list, or for all databases schedules
+// every database currently on the server, including ones created since the
+// schedule was saved. They are selected on the run's copy of the connection.
+func (s *BackupService) selectRunDatabases(conn *connection.StoredConnection, schedule *BackupSchedule) error {
+	if schedule != nil && len(schedule.Databases) > 0 {
+		conn.SelectedDatabases = schedule.Databases
+		return nil
+	}
+	if !allDatabasesFor(schedule) {
+		return nil
+	}
+	if s.connService == nil {
+		return fmt.Errorf("databases of connection %s cannot be discovered", conn.Name)
+	}
+
+	databases, err := s.connService.DiscoverDatabases(conn.ID)
+	if err != nil {
+		return fmt.Errorf("failed to discover databases: %v", err)
+	}
+	if len(databases) == 0 {
+		return fmt.Errorf("no databases found on %s:%d", conn.Host, conn.Port)
+	}
+
+	slog.Info("Discovered databases to back up", "databases", len(databases), "connection", conn.Name)
+	conn.SelectedDatabases = databases
+	return nil
+}
+
+// ScheduleDatabases are the databases of a connection a schedule backs up
+type ScheduleDatabases []string
+
+// Value stores the databases as JSON in a nullable text column
+func (d ScheduleDatabases) Value() (driver.Value, error) {
+	if len(d) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (d *ScheduleDatabases) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), d)
+	case []byte:
+		return json.Unmarshal(v, d)
+	default:
+		return fmt.Errorf("cannot scan %T into schedule databases", src)
+	}
+}
+
+// validateScheduleDatabases checks the databases submitted with a schedule
+// request and returns them trimmed and without duplicates. An empty list
+// clears the selection.
+func (s *BackupService) validateScheduleDatabases(connectionID string, databases *ScheduleDatabases, allDatabases, physical bool) (ScheduleDatabases, error) {
+	if databases == nil || len(*databases) == 0 {
+		return nil, nil
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	if !allDatabasesTypes[conn.Type] {
+		return nil, fmt.Errorf("schedule databases are not supported for %s connections", conn.Type)
+	}
+	if len(conn.SelectedDatabases) > 0 {
+		return nil, fmt.Errorf("schedule databases cannot be combined with the connection's selected databases")
+	}
+	if allDatabases {
+		return nil, fmt.Errorf("schedule databases cannot be combined with all_databases")
+	}
+	if physical {
+		return nil, fmt.Errorf("physical backups include every database and cannot be combined with schedule databases")
+	}
+
+	seen := make(map[string]bool)
+	var cleaned ScheduleDatabases
+	for _, dbName := range *databases {
+		dbName = strings.TrimSpace(dbName)
+		if dbName == "" {
+			return nil, fmt.Errorf("schedule databases cannot contain an empty name")
+		}
+		if seen[dbName] {
+			continue
+		}
+		seen[dbName] = true
+		cleaned = append(cleaned, dbName)
+	}
+
+	return cleaned, nil
+}
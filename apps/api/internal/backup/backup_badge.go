@@ -0,0 +1,350 @@
+package backup
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Badge colors, as shields.io names them
+const (
+	badgeColorSuccess = "brightgreen"
+	badgeColorPartial = "yellow"
+	badgeColorStale   = "orange"
+	badgeColorFailed  = "red"
+	badgeColorNone    = "lightgrey"
+)
+
+const badgeLabel = "backup"
+
+// badgeColorHex are the colors the SVG badge is drawn with
+var badgeColorHex = map[string]string{
+	badgeColorSuccess: "#4c1",
+	badgeColorPartial: "#dfb317",
+	badgeColorStale:   "#fe7d37",
+	badgeColorFailed:  "#e05d44",
+	badgeColorNone:    "#9f9f9f",
+}
+
+// BadgeStatus is the last backup status of a connection shown by its badge.
+// The first fields follow the shields.io endpoint schema, so the JSON badge
+// can be drawn by shields.io as well.
+type BadgeStatus struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+	// Status is the status of the last finished run, or "none"
+	Status       string     `json:"status"`
+	LastRunAt    *time.Time `json:"last_run_at"`
+	LastBackupAt *time.Time `json:"last_backup_at"`
+	AgeSeconds   *int64     `json:"age_seconds"`
+	// Stale is set when the last backup breaks the schedule's RPO
+	Stale bool `json:"stale"`
+}
+
+// BadgeToken is a connection's badge token. The token itself is only
+// returned when it is issued; velld keeps its hash.
+type BadgeToken struct {
+	Enabled   bool       `json:"enabled"`
+	Token     string     `json:"token,omitempty"`
+	SVGPath   string     `json:"svg_path,omitempty"`
+	JSONPath  string     `json:"json_path,omitempty"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+func hashBadgeToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// accessibleConnection returns the connection if the user owns it or shares
+// it through a team
+func (s *BackupService) accessibleConnection(connectionID string, userID uuid.UUID) (*connection.StoredConnection, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+	return conn, nil
+}
+
+// IssueBadgeToken issues a new badge token for the connection, which stops
+// the previous one from working
+func (s *BackupService) IssueBadgeToken(connectionID string, userID uuid.UUID) (*BadgeToken, error) {
+	if _, err := s.accessibleConnection(connectionID, userID); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate badge token: %v", err)
+	}
+	token := "vbadge_" + hex.EncodeToString(buf)
+
+	now := time.Now()
+	if err := s.backupRepo.SaveBadgeToken(connectionID, hashBadgeToken(token), now); err != nil {
+		return nil, err
+	}
+
+	query := "?token=" + token
+	return &BadgeToken{
+		Enabled:   true,
+		Token:     token,
+		SVGPath:   "/api/badges/" + connectionID + "/status.svg" + query,
+		JSONPath:  "/api/badges/" + connectionID + "/status.json" + query,
+		CreatedAt: &now,
+	}, nil
+}
+
+// GetBadgeToken tells whether the connection has a badge token
+func (s *BackupService) GetBadgeToken(connectionID string, userID uuid.UUID) (*BadgeToken, error) {
+	if _, err := s.accessibleConnection(connectionID, userID); err != nil {
+		return nil, err
+	}
+
+	_, createdAt, err := s.backupRepo.GetBadgeToken(connectionID)
+	if err == sql.ErrNoRows {
+		return &BadgeToken{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &BadgeToken{Enabled: true, CreatedAt: &createdAt}, nil
+}
+
+// RevokeBadgeToken turns the connection's badge off
+func (s *BackupService) RevokeBadgeToken(connectionID string, userID uuid.UUID) error {
+	if _, err := s.accessibleConnection(connectionID, userID); err != nil {
+		return err
+	}
+	return s.backupRepo.DeleteBadgeToken(connectionID)
+}
+
+// GetBadgeStatus returns the badge of a connection when the token is its
+// badge token. A wrong token reads as a missing connection.
+func (s *BackupService) GetBadgeStatus(connectionID, token string) (*BadgeStatus, error) {
+	tokenHash, _, err := s.backupRepo.GetBadgeToken(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(hashBadgeToken(token)), []byte(tokenHash)) != 1 {
+		return nil, sql.ErrNoRows
+	}
+	if _, err := s.connStorage.GetConnection(connectionID); err != nil {
+		return nil, err
+	}
+
+	badge := &BadgeStatus{SchemaVersion: 1, Label: badgeLabel, Status: "none"}
+	now := time.Now()
+
+	run, err := s.backupRepo.GetLatestFinishedBackupRun(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if run != nil {
+		badge.Status = run.Status
+		badge.LastRunAt = run.CompletedTime
+	}
+
+	backup, err := s.backupRepo.GetLatestCompletedBackup(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if backup != nil {
+		lastBackupAt := backup.CreatedAt
+		if backup.CompletedTime != nil {
+			lastBackupAt = *backup.CompletedTime
+		}
+		age := int64(now.Sub(lastBackupAt).Seconds())
+		badge.LastBackupAt = &lastBackupAt
+		badge.AgeSeconds = &age
+	}
+
+	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if schedule != nil && schedule.Enabled && !schedule.Paused {
+		if rpo := rpoFor(schedule); rpo > 0 {
+			badge.Stale = badge.AgeSeconds == nil || *badge.AgeSeconds > int64(rpo.Seconds())
+		}
+	}
+
+	switch {
+	case run == nil && backup == nil:
+		badge.Message = "no backups"
+		badge.Color = badgeColorNone
+		return badge, nil
+	case badge.Status == RunStatusPartial:
+		badge.Color = badgeColorPartial
+	case runFailed(badge.Status):
+		badge.Color = badgeColorFailed
+	case badge.Stale || badge.Status != RunStatusSuccess:
+		// Missed and cancelled runs made no backup either
+		badge.Color = badgeColorStale
+	default:
+		badge.Color = badgeColorSuccess
+	}
+
+	badge.Message = badge.Status
+	if badge.LastBackupAt != nil {
+		badge.Message += " · " + formatBadgeAge(now.Sub(*badge.LastBackupAt))
+	} else {
+		badge.Message += " · never succeeded"
+	}
+	return badge, nil
+}
+
+// formatBadgeAge returns the age of the last backup the way badges show it
+func formatBadgeAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return "just now"
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+	}
+}
+
+// badgeTextWidth estimates the width of a text in 11px Verdana
+func badgeTextWidth(text string) int {
+	return len([]rune(text))*7 + 10
+}
+
+// renderBadgeSVG draws the badge in the flat style of shields.io
+func renderBadgeSVG(badge *BadgeStatus) []byte {
+	labelWidth := badgeTextWidth(badge.Label)
+	messageWidth := badgeTextWidth(badge.Message)
+	width := labelWidth + messageWidth
+	label := html.EscapeString(badge.Label)
+	message := html.EscapeString(badge.Message)
+
+	return []byte(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">
+<title>%[4]s: %[5]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[7]d" y="15" fill="#010101" fill-opacity=".3">%[4]s</text><text x="%[7]d" y="14">%[4]s</text>
+<text x="%[8]d" y="15" fill="#010101" fill-opacity=".3">%[5]s</text><text x="%[8]d" y="14">%[5]s</text>
+</g>
+</svg>
+`, width, labelWidth, messageWidth, label, message, badgeColorHex[badge.Color], labelWidth/2, labelWidth+messageWidth/2))
+}
+
+func (h *BackupHandler) IssueBadgeToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := h.backupService.IssueBadgeToken(mux.Vars(r)["connection_id"], userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Badge token issued successfully", token)
+}
+
+func (h *BackupHandler) GetBadgeToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token, err := h.backupService.GetBadgeToken(mux.Vars(r)["connection_id"], userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Badge token retrieved successfully", token)
+}
+
+func (h *BackupHandler) RevokeBadgeToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.backupService.RevokeBadgeToken(mux.Vars(r)["connection_id"], userID); err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Badge token revoked successfully", nil)
+}
+
+// badgeStatus answers for the badge routes, which take the badge token in
+// ?token= so the badge can be embedded as an image
+func (h *BackupHandler) badgeStatus(w http.ResponseWriter, r *http.Request) *BadgeStatus {
+	connectionID := mux.Vars(r)["connection_id"]
+	badge, err := h.backupService.GetBadgeStatus(connectionID, r.URL.Query().Get("token"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "badge not found", http.StatusNotFound)
+			return nil
+		}
+		slog.Error("Failed to get badge status", "connection_id", connectionID, "error", err)
+		http.Error(w, "failed to get badge status", http.StatusInternalServerError)
+		return nil
+	}
+
+	// Badges are embedded in pages that cache images, so they are never cached
+	w.Header().Set("Cache-Control", "no-cache, no-store, max-age=0")
+	return badge
+}
+
+func (h *BackupHandler) GetBadgeSVG(w http.ResponseWriter, r *http.Request) {
+	badge := h.badgeStatus(w, r)
+	if badge == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	w.Write(renderBadgeSVG(badge))
+}
+
+func (h *BackupHandler) GetBadgeJSON(w http.ResponseWriter, r *http.Request) {
+	badge := h.badgeStatus(w, r)
+	if badge == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(badge)
+}
@@ -0,0 +1,193 @@
+package backup
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+)
+
+// Calendar run states
+const (
+	CalendarRunScheduled = "scheduled"
+	CalendarRunSkipped   = "skipped"
+	CalendarRunDeferred  = "deferred"
+	CalendarRunPaused    = "paused"
+)
+
+const (
+	defaultCalendarDays = 7
+	// maxCalendarRuns keeps per-minute schedules from producing huge
+	// calendars
+	maxCalendarRuns = 5000
+)
+
+// CalendarRun is a predicted run of a schedule, on the wall clock of the
+// schedule's time zone and in UTC
+type CalendarRun struct {
+	ScheduledRun
+	ConnectionID   string `json:"connection_id"`
+	ConnectionName string `json:"connection_name"`
+	ScheduleID     string `json:"schedule_id"`
+	Status         string `json:"status"`
+	// Reason says why a run is skipped, deferred or paused
+	Reason *string `json:"reason,omitempty"`
+	// DeferredTo is when a deferred run starts, once its maintenance window
+	// ends
+	DeferredTo *time.Time `json:"deferred_to,omitempty"`
+	// Latest is the latest start of the run once jitter is applied
+	Latest *time.Time `json:"latest,omitempty"`
+}
+
+// BackupCalendar lists the predicted runs of a user's schedules in a date
+// range, ordered by time
+type BackupCalendar struct {
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Runs      []*CalendarRun `json:"runs"`
+	Truncated bool           `json:"truncated"`
+}
+
+// GetBackupCalendar predicts the runs of the user's enabled schedules from
+// from until to. Runs in a maintenance window are marked skipped or deferred
+// and the runs of paused schedules are marked paused, so gaps in coverage
+// show up. An empty connectionID covers all connections.
+func (s *BackupService) GetBackupCalendar(userID uuid.UUID, connectionID string, from, to time.Time) (*BackupCalendar, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+	if to.Sub(from) > maxSimulationDays*24*time.Hour {
+		return nil, fmt.Errorf("the calendar covers at most %d days", maxSimulationDays)
+	}
+
+	schedules, err := s.backupRepo.GetAllActiveSchedules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active schedules: %v", err)
+	}
+
+	calendar := &BackupCalendar{From: from, To: to, Runs: []*CalendarRun{}}
+	for _, schedule := range schedules {
+		if connectionID != "" && schedule.ConnectionID != connectionID {
+			continue
+		}
+		conn, err := s.connStorage.GetConnection(schedule.ConnectionID)
+		if err != nil || !s.connStorage.HasAccess(conn, userID) {
+			continue
+		}
+		windows, err := s.backupRepo.GetMaintenanceWindows(userID, conn.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get maintenance windows of connection %s: %v", conn.ID, err)
+		}
+
+		runs, truncated := predictScheduleRuns(schedule, windows, from, to)
+		for _, run := range runs {
+			run.ConnectionName = conn.Name
+		}
+		calendar.Runs = append(calendar.Runs, runs...)
+		calendar.Truncated = calendar.Truncated || truncated
+	}
+
+	sort.SliceStable(calendar.Runs, func(i, j int) bool {
+		return calendar.Runs[i].UTC.Before(calendar.Runs[j].UTC)
+	})
+	if len(calendar.Runs) > maxCalendarRuns {
+		calendar.Runs = calendar.Runs[:maxCalendarRuns]
+		calendar.Truncated = true
+	}
+
+	return calendar, nil
+}
+
+// predictScheduleRuns lists the runs of a schedule from from until to, the
+// way executeCronBackup would treat them
+func predictScheduleRuns(schedule *BackupSchedule, windows []*MaintenanceWindow, from, to time.Time) ([]*CalendarRun, bool) {
+	spec, err := schedule.cronSchedule()
+	if err != nil {
+		return nil, false
+	}
+	loc := scheduleLocation(schedule.CronSchedule, timezoneName(schedule.Timezone))
+	jitter := time.Duration(schedule.JitterSeconds) * time.Second
+
+	var runs []*CalendarRun
+	// deferredUntil is when the pending deferred run starts; runs due before
+	// then are skipped
+	var deferredUntil time.Time
+	// Next is exclusive, so start just before from to include a run at from
+	for next := spec.Next(from.Add(-time.Nanosecond)); !next.IsZero() && next.Before(to); next = spec.Next(next) {
+		if len(runs) == maxCalendarRuns {
+			return runs, true
+		}
+
+		run := &CalendarRun{
+			ScheduledRun: ScheduledRun{Local: next.In(loc), UTC: next.UTC()},
+			ConnectionID: schedule.ConnectionID,
+			ScheduleID:   schedule.ID.String(),
+			Status:       CalendarRunScheduled,
+		}
+		if jitter > 0 {
+			latest := next.Add(jitter)
+			run.Latest = &latest
+		}
+
+		if schedule.Paused {
+			reason := "schedule is paused"
+			if schedule.PauseReason != nil {
+				reason += ": " + *schedule.PauseReason
+			}
+			run.Status = CalendarRunPaused
+			run.Reason = &reason
+		} else if window, until := activeWindow(windows, next); window != nil {
+			reason := window.describe()
+			switch {
+			case window.Action == MaintenanceActionDefer && !next.Before(deferredUntil):
+				deferredUntil = until
+				run.Status = CalendarRunDeferred
+				run.DeferredTo = &until
+			case window.Action == MaintenanceActionDefer:
+				reason += ", a deferred run is already pending"
+				run.Status = CalendarRunSkipped
+			default:
+				run.Status = CalendarRunSkipped
+			}
+			run.Reason = &reason
+		}
+
+		runs = append(runs, run)
+	}
+	return runs, false
+}
+
+func (h *BackupHandler) GetBackupCalendar(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	from := time.Now()
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		if from, err = parseReportDate(fromStr); err != nil {
+			response.SendError(w, http.StatusBadRequest, "invalid from date")
+			return
+		}
+	}
+	to := from.AddDate(0, 0, defaultCalendarDays)
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		if to, err = parseReportDate(toStr); err != nil {
+			response.SendError(w, http.StatusBadRequest, "invalid to date")
+			return
+		}
+	}
+
+	calendar, err := h.backupService.GetBackupCalendar(userID, r.URL.Query().Get("connection_id"), from, to)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup calendar retrieved successfully", calendar)
+}
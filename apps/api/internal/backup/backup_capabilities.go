@@ -0,0 +1,261 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Capabilities reported by the feature matrix
+const (
+	CapabilityIncremental         = "incremental"
+	CapabilityPITR                = "pitr"
+	CapabilityPartialRestore      = "partial_restore"
+	CapabilityParallelDump        = "parallel_dump"
+	CapabilityPhysicalBackup      = "physical_backup"
+	CapabilityStreaming           = "streaming"
+	CapabilitySnapshot            = "snapshot"
+	CapabilityDumpFilters         = "dump_filters"
+	CapabilityMasking             = "masking"
+	CapabilitySampling            = "sampling"
+	CapabilityRestore             = "restore"
+	CapabilityRestoreVerification = "restore_verification"
+	CapabilityCatalog             = "catalog"
+)
+
+// Capability tells whether velld supports a feature, and why not if it does not
+type Capability struct {
+	Name      string `json:"name"`
+	Supported bool   `json:"supported"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// EngineCapabilities is what velld supports for a database type in general
+type EngineCapabilities struct {
+	Engine       string       `json:"engine"`
+	Capabilities []Capability `json:"capabilities"`
+}
+
+// ConnectionCapabilities is what velld supports for one connection, given the
+// tools installed and the connection's databases and schedule
+type ConnectionCapabilities struct {
+	ConnectionID string       `json:"connection_id"`
+	Engine       string       `json:"engine"`
+	Capabilities []Capability `json:"capabilities"`
+}
+
+// engineCapability lists the database types a capability is supported for,
+// and why it is not for the others
+type engineCapability struct {
+	name    string
+	engines map[string]bool
+	reason  string
+}
+
+var engineCapabilities = []engineCapability{
+	{CapabilityIncremental, map[string]bool{"mysql": true}, "only XtraBackup physical backups can be incremental"},
+	{CapabilityPITR, nil, "point-in-time restores go back to the last backup before the target time; replaying to the exact moment needs continuous log archiving, which velld does not do"},
+	{CapabilityPartialRestore, map[string]bool{"postgresql": true}, "only custom-format PostgreSQL backups can be restored selectively"},
+	{CapabilityParallelDump, map[string]bool{"postgresql": true}, "only pg_dump dumps with parallel workers"},
+	{CapabilityPhysicalBackup, map[string]bool{"postgresql": true, "mysql": true}, "physical backups use pg_basebackup or XtraBackup"},
+	{CapabilityStreaming, streamableTypes, "the dump tool cannot write a self-contained dump to stdout"},
+	{CapabilitySnapshot, map[string]bool{"redis": true}, "snapshot backups use Redis BGSAVE"},
+	{CapabilityDumpFilters, map[string]bool{"postgresql": true, "mysql": true, "mariadb": true, "mongodb": true}, "the dump tool cannot select tables"},
+	{CapabilityMasking, maskableTypes, "dumps are not SQL scripts the masking stage can rewrite"},
+	{CapabilitySampling, samplableTypes, "rows are only sampled from SQL databases"},
+	{CapabilityRestore, map[string]bool{"postgresql": true, "mysql": true, "mariadb": true, "mongodb": true}, "velld has no restore tool for this database type"},
+	{CapabilityRestoreVerification, map[string]bool{"postgresql": true, "mysql": true, "mariadb": true, "mongodb": true}, "backups cannot be restored into a scratch database"},
+	{CapabilityCatalog, sqlCatalogTypes, "only SQL dumps are cataloged"},
+}
+
+// GetEngineCapabilities returns the feature matrix of every supported
+// database type
+func (s *BackupService) GetEngineCapabilities() []EngineCapabilities {
+	engines := make([]string, 0, len(requiredTools))
+	for engine := range requiredTools {
+		engines = append(engines, engine)
+	}
+	sort.Strings(engines)
+
+	matrix := make([]EngineCapabilities, 0, len(engines))
+	for _, engine := range engines {
+		matrix = append(matrix, EngineCapabilities{
+			Engine:       engine,
+			Capabilities: capabilitiesOf(engine),
+		})
+	}
+	return matrix
+}
+
+func capabilitiesOf(engine string) []Capability {
+	capabilities := make([]Capability, 0, len(engineCapabilities))
+	for _, c := range engineCapabilities {
+		capability := Capability{Name: c.name, Supported: c.engines[engine]}
+		if !capability.Supported {
+			capability.Reason = c.reason
+		}
+		capabilities = append(capabilities, capability)
+	}
+	return capabilities
+}
+
+// GetConnectionCapabilities narrows the connection's engine capabilities to
+// what works with the installed tools, its selected databases and the options
+// of its schedule, so combinations that would fail at run time are reported
+// up front.
+func (s *BackupService) GetConnectionCapabilities(connectionID string, userID uuid.UUID) (*ConnectionCapabilities, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get backup schedule: %v", err)
+	}
+
+	capabilities := capabilitiesOf(conn.Type)
+	for i := range capabilities {
+		if !capabilities[i].Supported {
+			continue
+		}
+		if reason := s.capabilityUnavailable(capabilities[i].Name, conn, schedule); reason != "" {
+			capabilities[i].Supported = false
+			capabilities[i].Reason = reason
+		}
+	}
+
+	return &ConnectionCapabilities{
+		ConnectionID: conn.ID,
+		Engine:       conn.Type,
+		Capabilities: capabilities,
+	}, nil
+}
+
+// capabilityUnavailable returns why an engine capability does not work for
+// the connection, or an empty string if it does
+func (s *BackupService) capabilityUnavailable(name string, conn *connection.StoredConnection, schedule *BackupSchedule) string {
+	physical := physicalBackupFor(schedule)
+	encrypted := schedule != nil && schedule.GPGPublicKey != nil
+
+	switch name {
+	case CapabilityRestore, CapabilityRestoreVerification, CapabilityPartialRestore:
+		if s.findDatabaseRestorePath(conn.Type) == "" {
+			return fmt.Sprintf("%s is not installed", restoreTools[conn.Type])
+		}
+		if encrypted {
+			return "backups are GPG encrypted and velld cannot decrypt them"
+		}
+		if physical {
+			return "physical backups are restored into a data directory, not a database"
+		}
+		if name == CapabilityPartialRestore && (pgDumpJobs(conn, schedule) > 0 || pgDumpFormatFor(schedule) != pgDumpFormatCustom) {
+			return "the schedule does not produce custom-format backups"
+		}
+		return ""
+	case CapabilityPhysicalBackup, CapabilityIncremental:
+		if common.FindBinaryPath(conn.Type, physicalBackupTools[conn.Type]) == "" {
+			return fmt.Sprintf("%s is not installed", physicalBackupTools[conn.Type])
+		}
+		if len(conn.SelectedDatabases) > 0 {
+			return "physical backups include every database and cannot be combined with selected databases"
+		}
+		if schedule == nil {
+			return ""
+		}
+		switch {
+		case schedule.AllDatabases:
+			return "the schedule backs up all databases one by one"
+		case len(schedule.Databases) > 0:
+			return "the schedule selects databases"
+		case schedule.PgDumpJobs > 0:
+			return "the schedule dumps with pg_dump_jobs"
+		case schedule.DumpFilters != nil:
+			return "the schedule has dump filters"
+		case schedule.Sample != nil:
+			return "the schedule samples rows"
+		case len(schedule.MaskingRules) > 0:
+			return "the schedule has masking rules"
+		}
+		return ""
+	case CapabilityCatalog:
+		if encrypted {
+			return "backups are GPG encrypted and cannot be read to catalog them"
+		}
+		if physical {
+			return "physical backups hold data files, not SQL dumps"
+		}
+		return ""
+	}
+
+	if s.findDatabaseBinaryPath(conn.Type) == "" {
+		return fmt.Sprintf("%s is not installed", requiredTools[conn.Type])
+	}
+	if physical {
+		return "the schedule takes physical backups"
+	}
+
+	switch name {
+	case CapabilitySnapshot:
+		if len(conn.SelectedDatabases) > 0 {
+			return "snapshot backups include every database and cannot be combined with selected databases"
+		}
+	case CapabilityParallelDump:
+		if schedule != nil && (len(schedule.MaskingRules) > 0 || schedule.Sample != nil) {
+			return "masked and sampled dumps are written as plain SQL scripts"
+		}
+	case CapabilityStreaming:
+		if pgDumpJobs(conn, schedule) > 0 {
+			return "parallel directory dumps cannot be streamed"
+		}
+		if sampleOptionsFor(schedule) != nil {
+			return "sampled dumps cannot be streamed"
+		}
+	case CapabilitySampling:
+		if schedule != nil && schedule.PgDumpJobs > 0 {
+			return "sampled dumps cannot be combined with pg_dump_jobs"
+		}
+		if schedule != nil && schedule.DumpFilters != nil {
+			return "sampled dumps cannot be combined with dump filters"
+		}
+	}
+
+	return ""
+}
+
+func (h *BackupHandler) GetEngineCapabilities(w http.ResponseWriter, r *http.Request) {
+	response.SendSuccess(w, "Engine capabilities retrieved successfully", h.backupService.GetEngineCapabilities())
+}
+
+func (h *BackupHandler) GetConnectionCapabilities(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	capabilities, err := h.backupService.GetConnectionCapabilities(connectionID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Connection capabilities retrieved successfully", capabilities)
+}
@@ -0,0 +1,237 @@
+package backup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// createTablePattern matches the CREATE TABLE statements of pg_dump and
+// mysqldump scripts and captures the possibly qualified table name.
+var createTablePattern = regexp.MustCompile(`(?i)^\s*CREATE\s+(?:UNLOGGED\s+|TEMPORARY\s+)?TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?([^\s(]+)`)
+
+// sqlCatalogTypes are the database types whose dumps are SQL scripts
+var sqlCatalogTypes = map[string]bool{
+	"postgresql": true,
+	"mysql":      true,
+	"mariadb":    true,
+}
+
+// catalogBackup records the tables in a local artifact, so backups can be
+// searched by table without downloading them. Streamed, encrypted and
+// non-SQL artifacts cannot be read here and are left out of table searches.
+func (s *BackupService) catalogBackup(backup *Backup, conn *connection.StoredConnection) {
+	if !sqlCatalogTypes[conn.Type] || isGPGEncrypted(backup) {
+		return
+	}
+	if _, err := os.Stat(backup.Path); err != nil {
+		return
+	}
+
+	contentPath, isTemp, err := s.ensureBackupContentAvailable(backup, conn.UserID)
+	if err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to read backup for its catalog", "backup_id", backup.ID, "error", err)
+		return
+	}
+	if isTemp {
+		defer os.Remove(contentPath)
+	}
+
+	var tables []CatalogTable
+	switch {
+	case isCustomDump(contentPath):
+		toc, err := s.listArchive(contentPath)
+		if err != nil {
+			slog.WarnContext(backupContext(backup), "Failed to catalog backup", "backup_id", backup.ID, "error", err)
+			return
+		}
+		for _, entry := range parseTOC(toc) {
+			if entry.Type == "TABLE" {
+				tables = append(tables, CatalogTable{Schema: entry.Schema, Name: entry.Name})
+			}
+		}
+	case strings.HasSuffix(contentPath, ".sql"):
+		tables, err = scanSQLTables(contentPath)
+		if err != nil {
+			slog.WarnContext(backupContext(backup), "Failed to catalog backup", "backup_id", backup.ID, "error", err)
+			return
+		}
+	default:
+		return
+	}
+
+	backup.catalog = tables
+}
+
+// scanSQLTables lists the tables a SQL script creates. Only the start of each
+// line is matched, so long INSERT lines are skipped without being buffered.
+func scanSQLTables(path string) ([]CatalogTable, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	seen := make(map[CatalogTable]bool)
+	var tables []CatalogTable
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	atLineStart := true
+	for {
+		line, err := reader.ReadSlice('\n')
+		if atLineStart {
+			if match := createTablePattern.FindSubmatch(line); match != nil {
+				table := parseTableName(string(match[1]))
+				if !seen[table] {
+					seen[table] = true
+					tables = append(tables, table)
+				}
+			}
+		}
+		atLineStart = err != bufio.ErrBufferFull
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+
+	return tables, nil
+}
+
+// parseTableName splits a qualified name such as public."Invoices" or
+// `shop`.`orders` and removes the identifier quotes
+func parseTableName(name string) CatalogTable {
+	parts := strings.Split(strings.TrimSuffix(name, ";"), ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(part, "\"`[]")
+	}
+
+	if len(parts) == 1 {
+		return CatalogTable{Name: parts[0]}
+	}
+	return CatalogTable{
+		Schema: parts[len(parts)-2],
+		Name:   parts[len(parts)-1],
+	}
+}
+
+// tableNamePattern turns a table search with * wildcards into a LIKE pattern
+func tableNamePattern(table string) string {
+	pattern := strings.ToLower(strings.TrimSpace(table))
+	pattern = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(pattern)
+	return strings.ReplaceAll(pattern, "*", "%")
+}
+
+// parseCatalogDate accepts RFC 3339 timestamps and plain dates. A plain date
+// as the end of a range includes that whole day.
+func parseCatalogDate(value string, endOfRange bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, use YYYY-MM-DD or RFC 3339", value)
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// SearchBackupCatalog finds the user's backups by connection, database, tag,
+// date and the tables they contain, using only the recorded catalog.
+func (s *BackupService) SearchBackupCatalog(opts CatalogSearchOptions) ([]*CatalogSearchResult, int, error) {
+	if opts.Table != "" {
+		opts.Table = tableNamePattern(opts.Table)
+	}
+	opts.Database = strings.ToLower(strings.TrimSpace(opts.Database))
+	opts.Tag = strings.ToLower(strings.TrimSpace(opts.Tag))
+
+	results, total, err := s.backupRepo.SearchBackupCatalog(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if opts.Table != "" {
+		for _, result := range results {
+			tables, err := s.backupRepo.GetCatalogTables(result.BackupID.String(), opts.Table)
+			if err != nil {
+				return nil, 0, err
+			}
+			result.MatchedTables = tables
+		}
+	}
+
+	return results, total, nil
+}
+
+func (h *BackupHandler) SearchBackupCatalog(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+
+	page := 1
+	limit := 10
+	if pageStr := query.Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	from, err := parseCatalogDate(query.Get("from"), false)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to, err := parseCatalogDate(query.Get("to"), true)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts := CatalogSearchOptions{
+		UserID:       userID,
+		ConnectionID: query.Get("connection_id"),
+		Database:     query.Get("database"),
+		Tag:          query.Get("tag"),
+		Table:        query.Get("table"),
+		From:         from,
+		To:           to,
+		Limit:        limit,
+		Offset:       (page - 1) * limit,
+	}
+
+	results, total, err := h.backupService.SearchBackupCatalog(opts)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendPaginatedSuccess(w, "Backup catalog searched successfully", results, page, limit, total)
+}
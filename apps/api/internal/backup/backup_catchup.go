@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCatchUpParallelism   = 2
+	defaultCatchUpSpreadSeconds = 30
+)
+
+// catchUpParallelism reads BACKUP_CATCHUP_PARALLELISM, how many missed
+// schedules are backed up at the same time after startup.
+func catchUpParallelism() int {
+	parallelism := defaultCatchUpParallelism
+	if value := strings.TrimSpace(os.Getenv("BACKUP_CATCHUP_PARALLELISM")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			slog.Warn("Invalid BACKUP_CATCHUP_PARALLELISM, using the default", "value", value, "default", defaultCatchUpParallelism)
+		} else {
+			parallelism = parsed
+		}
+	}
+	return parallelism
+}
+
+// catchUpSpread reads BACKUP_CATCHUP_SPREAD_SECONDS, the pause between
+// starting one missed backup and the next.
+func catchUpSpread() time.Duration {
+	seconds := defaultCatchUpSpreadSeconds
+	if value := strings.TrimSpace(os.Getenv("BACKUP_CATCHUP_SPREAD_SECONDS")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			slog.Warn("Invalid BACKUP_CATCHUP_SPREAD_SECONDS, using the default", "value", value, "default_seconds", defaultCatchUpSpreadSeconds)
+		} else {
+			seconds = parsed
+		}
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// catchUpMissedSchedules runs the schedules missed while the API was down
+// through a queue, longest overdue first, instead of starting all of them at
+// once. A schedule whose regular run comes around while it is still queued is
+// dropped from the queue.
+func (s *BackupService) catchUpMissedSchedules(missed []*BackupSchedule) {
+	if len(missed) == 0 {
+		return
+	}
+
+	sort.Slice(missed, func(i, j int) bool {
+		return missed[i].NextRunTime.Before(*missed[j].NextRunTime)
+	})
+
+	parallelism := catchUpParallelism()
+	spread := catchUpSpread()
+	queuedAt := time.Now()
+	slog.Info("Catching up missed backup schedules", "schedules", len(missed), "parallelism", parallelism, "spread", spread)
+
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, schedule := range missed {
+		if i > 0 && spread > 0 {
+			time.Sleep(spread)
+		}
+		slots <- struct{}{}
+
+		current, err := s.backupRepo.GetBackupSchedule(schedule.ConnectionID)
+		if err != nil || !current.Enabled || current.ID != schedule.ID {
+			<-slots
+			continue
+		}
+		if current.LastBackupTime != nil && current.LastBackupTime.After(queuedAt) {
+			slog.Info("Skipping catch-up of schedule, it has run since startup", "schedule_id", schedule.ID)
+			<-slots
+			continue
+		}
+
+		wg.Add(1)
+		go func(schedule *BackupSchedule) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			s.executeCronBackup(schedule)
+		}(current)
+	}
+
+	wg.Wait()
+	slog.Info("Catch-up of missed backup schedules completed", "schedules", len(missed))
+}
@@ -2,6 +2,7 @@ package backup
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -58,23 +59,33 @@ func (s *BackupService) setupSSHTunnelIfNeeded(conn *connection.StoredConnection
 	return tunnel, "127.0.0.1", tunnel.GetLocalPort(), nil
 }
 
-func (s *BackupService) createPgDumpCmd(conn *connection.StoredConnection, outputPath string) *exec.Cmd {
+func (s *BackupService) createPgDumpCmd(conn *connection.StoredConnection, outputPath, format string) *exec.Cmd {
 	binaryPath := s.findDatabaseBinaryPath("postgresql")
 	if binaryPath == "" {
-		fmt.Printf("ERROR: pg_dump binary not found. Please install PostgreSQL client tools.\n")
+		slog.Error("pg_dump binary not found, install PostgreSQL client tools")
 		return nil
 	}
 
 	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(requiredTools["postgresql"]))
 
 	// Use original host/port (SSH tunnel handled at backup execution level)
-	cmd := exec.Command(binPath,
+	args := []string{
 		"-h", conn.Host,
 		"-p", fmt.Sprintf("%d", conn.Port),
 		"-U", conn.Username,
 		"-d", conn.DatabaseName,
-		"-f", outputPath,
-	)
+	}
+
+	if format == pgDumpFormatCustom {
+		args = append(args, "-Fc")
+	}
+
+	// An empty output path writes the dump to stdout for streaming
+	if outputPath != "" {
+		args = append(args, "-f", outputPath)
+	}
+
+	cmd := exec.Command(binPath, args...)
 
 	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
 	return cmd
@@ -83,7 +94,7 @@ func (s *BackupService) createPgDumpCmd(conn *connection.StoredConnection, outpu
 func (s *BackupService) createMySQLDumpCmd(conn *connection.StoredConnection, outputPath string) *exec.Cmd {
 	binaryPath := s.findDatabaseBinaryPath(conn.Type)
 	if binaryPath == "" {
-		fmt.Printf("ERROR: mysqldump binary not found. Please install MySQL/MariaDB client tools.\n")
+		slog.Error("mysqldump binary not found, install MySQL/MariaDB client tools")
 		return nil
 	}
 
@@ -102,7 +113,10 @@ func (s *BackupService) createMySQLDumpCmd(conn *connection.StoredConnection, ou
 		args = append(args, "--ssl-mode=REQUIRED")
 	}
 
-	args = append(args, conn.DatabaseName, "-r", outputPath)
+	args = append(args, conn.DatabaseName)
+	if outputPath != "" {
+		args = append(args, "-r", outputPath)
+	}
 
 	cmd := exec.Command(binPath, args...)
 	return cmd
@@ -111,7 +125,7 @@ func (s *BackupService) createMySQLDumpCmd(conn *connection.StoredConnection, ou
 func (s *BackupService) createMongoDumpCmd(conn *connection.StoredConnection, outputPath string) *exec.Cmd {
 	binaryPath := s.findDatabaseBinaryPath("mongodb")
 	if binaryPath == "" {
-		fmt.Printf("ERROR: mongodump binary not found. Please install MongoDB Database Tools.\n")
+		slog.Error("mongodump binary not found, install MongoDB Database Tools")
 		return nil
 	}
 
@@ -120,7 +134,7 @@ func (s *BackupService) createMongoDumpCmd(conn *connection.StoredConnection, ou
 		"--host", conn.Host,
 		"--port", fmt.Sprintf("%d", conn.Port),
 		"--db", conn.DatabaseName,
-		"--out", filepath.Dir(outputPath),
+		"--archive=" + outputPath,
 	}
 
 	if conn.Username != "" {
@@ -137,7 +151,7 @@ func (s *BackupService) createMongoDumpCmd(conn *connection.StoredConnection, ou
 func (s *BackupService) createRedisDumpCmd(conn *connection.StoredConnection, outputPath string) *exec.Cmd {
 	binaryPath := s.findDatabaseBinaryPath("redis")
 	if binaryPath == "" {
-		fmt.Printf("ERROR: redis-cli binary not found. Please install Redis tools.\n")
+		slog.Error("redis-cli binary not found, install Redis tools")
 		return nil
 	}
 
@@ -0,0 +1,239 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxCompressionThreads caps the threads a schedule can compress with
+const maxCompressionThreads = 64
+
+// compressionCodec is a supported compression filter. Its arguments are fixed
+// so that schedules can only choose a codec, never the command that is run;
+// a level and a thread count are passed through the codec's own flags.
+type compressionCodec struct {
+	extension  string
+	compress   []string
+	decompress []string
+	// minLevel and maxLevel bound the levels passed as -<level>
+	minLevel int
+	maxLevel int
+	// threadsFlag prefixes a thread count, empty for single-threaded codecs
+	threadsFlag string
+}
+
+// compressionCodecs are the codecs a schedule can compress its dumps with,
+// keyed by the name stored in compression_command
+var compressionCodecs = map[string]compressionCodec{
+	"gzip":  {extension: ".gz", compress: []string{"gzip", "-c"}, decompress: []string{"gzip", "-dc"}, minLevel: 1, maxLevel: 9},
+	"pigz":  {extension: ".gz", compress: []string{"pigz", "-c"}, decompress: []string{"pigz", "-dc"}, minLevel: 1, maxLevel: 9, threadsFlag: "-p"},
+	"xz":    {extension: ".xz", compress: []string{"xz", "-c"}, decompress: []string{"xz", "-dc"}, minLevel: 0, maxLevel: 9, threadsFlag: "-T"},
+	"zstd":  {extension: ".zst", compress: []string{"zstd", "-c", "-q"}, decompress: []string{"zstd", "-dc", "-q"}, minLevel: 1, maxLevel: 19, threadsFlag: "-T"},
+	"bzip2": {extension: ".bz2", compress: []string{"bzip2", "-c"}, decompress: []string{"bzip2", "-dc"}, minLevel: 1, maxLevel: 9},
+}
+
+// compressArgs returns the command compressing with level and threads, where
+// 0 keeps the codec's default
+func (c compressionCodec) compressArgs(level, threads int) []string {
+	args := append([]string{}, c.compress...)
+	if level != 0 {
+		args = append(args, fmt.Sprintf("-%d", level))
+	}
+	if threads != 0 {
+		args = append(args, fmt.Sprintf("%s%d", c.threadsFlag, threads))
+	}
+	return args
+}
+
+// lookupCompressionCodec resolves a codec name. Backups record the command
+// line they were compressed with, so only its binary name is used.
+func lookupCompressionCodec(command string) (compressionCodec, error) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return compressionCodec{}, fmt.Errorf("compression codec is empty")
+	}
+
+	codec, ok := compressionCodecs[fields[0]]
+	if !ok {
+		return compressionCodec{}, fmt.Errorf("unsupported compression codec %q", fields[0])
+	}
+
+	return codec, nil
+}
+
+// validateScheduleCompression validates a codec name submitted with a
+// schedule request. An empty name disables compression.
+func validateScheduleCompression(command *string) (*string, error) {
+	if command == nil {
+		return nil, nil
+	}
+
+	name := strings.TrimSpace(*command)
+	if name == "" {
+		return nil, nil
+	}
+
+	codec, ok := compressionCodecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported compression codec %q, expected one of gzip, pigz, xz, zstd or bzip2", name)
+	}
+
+	if _, err := exec.LookPath(codec.compress[0]); err != nil {
+		return nil, fmt.Errorf("compression codec %q not found in PATH", name)
+	}
+
+	return &name, nil
+}
+
+// validateCompressionOptions checks the level and threads of a schedule
+// against its codec
+func validateCompressionOptions(schedule *BackupSchedule) error {
+	level, threads := schedule.CompressionLevel, schedule.CompressionThreads
+	if schedule.CompressionCommand == nil || *schedule.CompressionCommand == "" {
+		if level != 0 || threads != 0 {
+			return fmt.Errorf("compression level and threads need a compression codec")
+		}
+		return nil
+	}
+
+	name := *schedule.CompressionCommand
+	codec, err := lookupCompressionCodec(name)
+	if err != nil {
+		return err
+	}
+
+	// xz has a level 0, so a level of 0 can't be chosen explicitly for it
+	if level != 0 && (level < codec.minLevel || level > codec.maxLevel) {
+		return fmt.Errorf("compression level for %s must be between %d and %d", name, codec.minLevel, codec.maxLevel)
+	}
+	if threads != 0 {
+		if codec.threadsFlag == "" {
+			return fmt.Errorf("%s compresses with a single thread, use pigz, xz or zstd for threads", name)
+		}
+		if threads < 1 || threads > maxCompressionThreads {
+			return fmt.Errorf("compression threads must be between 1 and %d", maxCompressionThreads)
+		}
+	}
+
+	return nil
+}
+
+// scheduleCompression returns the codec of a schedule and the command that
+// compresses with its level and threads, or false when it compresses nothing
+func scheduleCompression(schedule *BackupSchedule) (compressionCodec, []string, bool, error) {
+	if schedule == nil || schedule.CompressionCommand == nil || *schedule.CompressionCommand == "" {
+		return compressionCodec{}, nil, false, nil
+	}
+
+	codec, err := lookupCompressionCodec(*schedule.CompressionCommand)
+	if err != nil {
+		return compressionCodec{}, nil, false, err
+	}
+
+	return codec, codec.compressArgs(schedule.CompressionLevel, schedule.CompressionThreads), true, nil
+}
+
+// runFilter streams src through the command's stdin and writes its stdout to dst
+func runFilter(args []string, srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	var stderr strings.Builder
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = src
+	cmd.Stdout = dst
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+
+	return dst.Sync()
+}
+
+// compressBackupIfConfigured pipes the dump through the schedule's codec.
+// The uncompressed dump is removed once the compressed copy exists, and the
+// backup records the command that compressed it.
+func (s *BackupService) compressBackupIfConfigured(backup *Backup, schedule *BackupSchedule) error {
+	codec, args, ok, err := scheduleCompression(schedule)
+	if err != nil || !ok {
+		return err
+	}
+
+	compressedPath := backup.Path + codec.extension
+	if err := runFilter(args, backup.Path, compressedPath); err != nil {
+		os.Remove(compressedPath)
+		return fmt.Errorf("failed to compress backup: %v", err)
+	}
+
+	if err := os.Remove(backup.Path); err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to remove uncompressed backup file", "path", backup.Path, "error", err)
+	}
+
+	fileInfo, err := os.Stat(compressedPath)
+	if err != nil {
+		return fmt.Errorf("failed to get compressed backup file info: %v", err)
+	}
+
+	command := strings.Join(args, " ")
+	backup.Path = compressedPath
+	backup.Size = fileInfo.Size()
+	backup.CompressionCommand = &command
+
+	return nil
+}
+
+// ensureBackupContentAvailable returns the path of the uncompressed dump,
+// decompressing it into a new temp file when the backup used a codec.
+func (s *BackupService) ensureBackupContentAvailable(backup *Backup, userID uuid.UUID) (string, bool, error) {
+	filePath, isTemp, err := s.ensureBackupFileAvailable(backup, userID)
+	if err != nil {
+		return "", false, err
+	}
+
+	if backup.CompressionCommand == nil || *backup.CompressionCommand == "" {
+		return filePath, isTemp, nil
+	}
+
+	if isTemp {
+		defer os.Remove(filePath)
+	}
+
+	codec, err := lookupCompressionCodec(*backup.CompressionCommand)
+	if err != nil {
+		return "", false, err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(filePath), codec.extension)
+	tempFile, err := os.CreateTemp("", "velld-decompressed-*-"+name)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	decompressedPath := tempFile.Name()
+	tempFile.Close()
+
+	if err := runFilter(codec.decompress, filePath, decompressedPath); err != nil {
+		os.Remove(decompressedPath)
+		return "", false, fmt.Errorf("failed to decompress backup: %v", err)
+	}
+
+	return decompressedPath, true, nil
+}
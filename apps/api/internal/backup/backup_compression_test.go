@@ -0,0 +1,175 @@
+package backup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupCompressionCodec(t *testing.T) {
+	tests := []struct {
+		name       string
+		command    string
+		extension  string
+		compress   []string
+		decompress []string
+		wantErr    bool
+	}{
+		{name: "gzip", command: "gzip", extension: ".gz", compress: []string{"gzip", "-c"}, decompress: []string{"gzip", "-dc"}},
+		{name: "pigz", command: "pigz", extension: ".gz", compress: []string{"pigz", "-c"}, decompress: []string{"pigz", "-dc"}},
+		{name: "xz", command: "xz", extension: ".xz", compress: []string{"xz", "-c"}, decompress: []string{"xz", "-dc"}},
+		{name: "zstd", command: "zstd", extension: ".zst", compress: []string{"zstd", "-c", "-q"}, decompress: []string{"zstd", "-dc", "-q"}},
+		{name: "bzip2", command: "bzip2", extension: ".bz2", compress: []string{"bzip2", "-c"}, decompress: []string{"bzip2", "-dc"}},
+		{name: "recorded command line", command: "xz -c -9 -T4", extension: ".xz", compress: []string{"xz", "-c"}, decompress: []string{"xz", "-dc"}},
+		{name: "surrounding whitespace", command: "  zstd ", extension: ".zst", compress: []string{"zstd", "-c", "-q"}, decompress: []string{"zstd", "-dc", "-q"}},
+		{name: "empty", command: "", wantErr: true},
+		{name: "blank", command: "   ", wantErr: true},
+		{name: "unsupported codec", command: "lz4", wantErr: true},
+		{name: "arbitrary binary", command: "sh -c id", wantErr: true},
+		{name: "path to codec", command: "/usr/bin/gzip", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := lookupCompressionCodec(tt.command)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("lookupCompressionCodec(%q) returned no error", tt.command)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lookupCompressionCodec(%q) returned error: %v", tt.command, err)
+			}
+			if codec.extension != tt.extension {
+				t.Errorf("extension = %q, want %q", codec.extension, tt.extension)
+			}
+			if !reflect.DeepEqual(codec.compress, tt.compress) {
+				t.Errorf("compress = %v, want %v", codec.compress, tt.compress)
+			}
+			if !reflect.DeepEqual(codec.decompress, tt.decompress) {
+				t.Errorf("decompress = %v, want %v", codec.decompress, tt.decompress)
+			}
+		})
+	}
+}
+
+func TestValidateScheduleCompressionRejectsCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		command *string
+		want    *string
+		wantErr bool
+	}{
+		{name: "nil", command: nil, want: nil},
+		{name: "empty disables", command: strPtr(""), want: nil},
+		{name: "blank disables", command: strPtr("  "), want: nil},
+		{name: "codec with arguments", command: strPtr("xz -9"), wantErr: true},
+		{name: "unsupported codec", command: strPtr("brotli"), wantErr: true},
+		{name: "arbitrary binary", command: strPtr("rm"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateScheduleCompression(tt.command)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("validateScheduleCompression returned no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateScheduleCompression returned error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateScheduleCompression = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		codec   string
+		level   int
+		threads int
+		want    []string
+	}{
+		{name: "defaults", codec: "xz", want: []string{"xz", "-c"}},
+		{name: "level", codec: "gzip", level: 9, want: []string{"gzip", "-c", "-9"}},
+		{name: "pigz threads", codec: "pigz", threads: 8, want: []string{"pigz", "-c", "-p8"}},
+		{name: "xz level and threads", codec: "xz", level: 6, threads: 4, want: []string{"xz", "-c", "-6", "-T4"}},
+		{name: "zstd level and threads", codec: "zstd", level: 19, threads: 2, want: []string{"zstd", "-c", "-q", "-19", "-T2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compressionCodecs[tt.codec].compressArgs(tt.level, tt.threads)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("compressArgs(%d, %d) = %v, want %v", tt.level, tt.threads, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCompressionOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		codec   *string
+		level   int
+		threads int
+		wantErr bool
+	}{
+		{name: "no compression", codec: nil},
+		{name: "codec defaults", codec: strPtr("gzip")},
+		{name: "gzip level", codec: strPtr("gzip"), level: 9},
+		{name: "zstd high level", codec: strPtr("zstd"), level: 19},
+		{name: "pigz threads", codec: strPtr("pigz"), threads: 8},
+		{name: "xz threads", codec: strPtr("xz"), level: 9, threads: 4},
+		{name: "level without codec", codec: nil, level: 6, wantErr: true},
+		{name: "threads without codec", codec: nil, threads: 2, wantErr: true},
+		{name: "level above range", codec: strPtr("gzip"), level: 10, wantErr: true},
+		{name: "negative level", codec: strPtr("zstd"), level: -1, wantErr: true},
+		{name: "threads of single-threaded codec", codec: strPtr("bzip2"), threads: 2, wantErr: true},
+		{name: "negative threads", codec: strPtr("xz"), threads: -1, wantErr: true},
+		{name: "too many threads", codec: strPtr("zstd"), threads: maxCompressionThreads + 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := &BackupSchedule{CompressionCommand: tt.codec, CompressionLevel: tt.level, CompressionThreads: tt.threads}
+			err := validateCompressionOptions(schedule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateCompressionOptions error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlainDumpPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		compression *string
+		want        string
+	}{
+		{name: "uncompressed", path: "/backups/db.sql", want: "/backups/db.sql"},
+		{name: "gzip", path: "/backups/db.sql.gz", compression: strPtr("gzip"), want: "/backups/db.sql"},
+		{name: "zstd encrypted", path: "/backups/db.sql.zst.gpg", compression: strPtr("zstd"), want: "/backups/db.sql"},
+		{name: "bzip2", path: "/backups/db.dump.bz2", compression: strPtr("bzip2"), want: "/backups/db.dump"},
+		{name: "unknown codec keeps extension", path: "/backups/db.sql.lz4", compression: strPtr("lz4"), want: "/backups/db.sql.lz4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup := &Backup{Path: tt.path, CompressionCommand: tt.compression}
+			if got := plainDumpPath(backup); got != tt.want {
+				t.Errorf("plainDumpPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
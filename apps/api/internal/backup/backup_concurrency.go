@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// Concurrency policies decide what a scheduled run does when the previous
+// run of its connection is still going
+const (
+	ConcurrencySkip    = "skip"
+	ConcurrencyQueue   = "queue"
+	ConcurrencyReplace = "replace"
+)
+
+// Backup run states of the concurrency policies
+const (
+	RunStatusMissed    = "missed"
+	RunStatusCancelled = "cancelled"
+)
+
+// errRunReplaced ends a run cancelled by a newer run of its schedule
+var errRunReplaced = errors.New("run was cancelled to make way for a newer run")
+
+// connectionRun is the queued or running backup run of a connection
+type connectionRun struct {
+	run  *BackupRun
+	done chan struct{}
+	// pending is set once a scheduled run waits for this one to finish
+	pending bool
+}
+
+func validateConcurrencyPolicy(policy *string) (string, error) {
+	if policy == nil {
+		return ConcurrencyQueue, nil
+	}
+	value := strings.ToLower(strings.TrimSpace(*policy))
+	switch value {
+	case "":
+		return ConcurrencyQueue, nil
+	case ConcurrencySkip, ConcurrencyQueue, ConcurrencyReplace:
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid concurrency_policy %q, use skip, queue or replace", *policy)
+}
+
+func concurrencyPolicyFor(schedule *BackupSchedule) string {
+	if schedule == nil || schedule.ConcurrencyPolicy == "" {
+		return ConcurrencyQueue
+	}
+	return schedule.ConcurrencyPolicy
+}
+
+// beginConnectionRun registers the run as the current run of its connection
+func (s *BackupService) beginConnectionRun(run *BackupRun) *connectionRun {
+	current := &connectionRun{run: run, done: make(chan struct{})}
+	s.runsMu.Lock()
+	s.connectionRuns[run.ConnectionID] = current
+	s.runsMu.Unlock()
+	return current
+}
+
+// endConnectionRun releases the runs waiting for current to finish
+func (s *BackupService) endConnectionRun(current *connectionRun) {
+	s.runsMu.Lock()
+	if s.connectionRuns[current.run.ConnectionID] == current {
+		delete(s.connectionRuns, current.run.ConnectionID)
+	}
+	s.runsMu.Unlock()
+	close(current.done)
+}
+
+// awaitPreviousRun applies the schedule's concurrency policy when its
+// connection still has a run going, and reports whether the scheduled run
+// should start. Skipped runs are recorded as missed. A queued run waits for
+// the current one, and at most one run queues behind it; replace cancels the
+// current run and waits for it to stop.
+func (s *BackupService) awaitPreviousRun(schedule *BackupSchedule) bool {
+	s.runsMu.Lock()
+	current, running := s.connectionRuns[schedule.ConnectionID]
+	if !running {
+		s.runsMu.Unlock()
+		return true
+	}
+
+	switch concurrencyPolicyFor(schedule) {
+	case ConcurrencySkip:
+		s.runsMu.Unlock()
+		s.recordSkippedRun(schedule, RunStatusMissed, fmt.Sprintf("missed, run %s was still going", current.run.ID))
+		return false
+	case ConcurrencyReplace:
+		s.runsMu.Unlock()
+		slog.Info("Cancelling backup run to replace it with a new run of schedule", "run_id", current.run.ID, "schedule_id", schedule.ID)
+		current.run.processes.cancel()
+	default:
+		if current.pending {
+			s.runsMu.Unlock()
+			s.recordSkippedRun(schedule, RunStatusMissed, fmt.Sprintf("missed, a run is already queued behind run %s", current.run.ID))
+			return false
+		}
+		current.pending = true
+		s.runsMu.Unlock()
+		slog.Info("Queueing backup of schedule behind run", "schedule_id", schedule.ID, "run_id", current.run.ID)
+	}
+
+	<-current.done
+	// The schedule may have been paused while the run waited
+	return !s.schedulePaused(schedule)
+}
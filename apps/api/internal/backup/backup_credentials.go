@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/google/uuid"
+)
+
+// defaultCredentialCheckSchedule probes credentials every six hours
+const defaultCredentialCheckSchedule = "0 0 */6 * * *"
+
+// scheduleCredentialChecks registers the job that probes the stored
+// credentials of scheduled connections. BACKUP_CREDENTIAL_CHECK_SCHEDULE takes
+// a cron expression (with seconds) or "off".
+func (s *BackupService) scheduleCredentialChecks() {
+	if s.credentialEntry != 0 {
+		s.cronManager.Remove(s.credentialEntry)
+		s.credentialEntry = 0
+	}
+
+	if s.connService == nil {
+		return
+	}
+
+	schedule := strings.TrimSpace(os.Getenv("BACKUP_CREDENTIAL_CHECK_SCHEDULE"))
+	if strings.EqualFold(schedule, "off") {
+		return
+	}
+	if schedule == "" {
+		schedule = defaultCredentialCheckSchedule
+	}
+
+	entryID, err := s.cronManager.AddFunc(schedule, s.checkScheduledCredentials)
+	if err != nil {
+		slog.Error("Failed to schedule credential checks", "error", err)
+		return
+	}
+	s.credentialEntry = entryID
+}
+
+// checkScheduledCredentials probes every connection with an active schedule
+// and notifies once when its credentials stop working, so they can be fixed
+// before the next backup fails.
+func (s *BackupService) checkScheduledCredentials() {
+	schedules, err := s.backupRepo.GetAllActiveSchedules()
+	if err != nil {
+		slog.Error("Failed to get schedules for credential checks", "error", err)
+		return
+	}
+
+	checked := make(map[string]bool)
+	invalid := 0
+	for _, schedule := range schedules {
+		if checked[schedule.ConnectionID] {
+			continue
+		}
+		checked[schedule.ConnectionID] = true
+
+		check, err := s.connService.CheckCredentials(schedule.ConnectionID)
+		if err != nil {
+			slog.Warn("Failed to check credentials of connection", "connection_id", schedule.ConnectionID, "error", err)
+			continue
+		}
+		if check.Status != connection.CredentialStatusInvalid {
+			continue
+		}
+
+		invalid++
+		slog.Warn("Stored credentials of connection were rejected", "connection_id", schedule.ConnectionID, "error", check.Error)
+		if check.PreviousStatus == connection.CredentialStatusInvalid {
+			continue
+		}
+
+		conn, err := s.connStorage.GetConnection(schedule.ConnectionID)
+		if err != nil {
+			continue
+		}
+		s.createCredentialNotification(conn, schedule, check)
+	}
+
+	slog.Info("Credential checks completed", "checked", len(checked), "rejected", invalid)
+}
+
+func (s *BackupService) createCredentialNotification(conn *connection.StoredConnection, schedule *BackupSchedule, check *connection.CredentialCheck) {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+	if err != nil || userSettings == nil {
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"connection_id": conn.ID,
+		"database_name": conn.DatabaseName,
+		"database_type": conn.Type,
+		"error":         check.Error,
+		"checked_at":    check.CheckedAt.Format(time.RFC3339),
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}
+
+	nextRun := ""
+	if schedule.NextRunTime != nil {
+		metadata["next_run_time"] = schedule.NextRunTime.Format(time.RFC3339)
+		nextRun = fmt.Sprintf(" before the backup at %s", schedule.NextRunTime.Format("2006-01-02 15:04"))
+	}
+
+	metadataJSON, _ := json.Marshal(metadata)
+	n := &notification.Notification{
+		ID:     uuid.New(),
+		UserID: conn.UserID,
+		Title:  "Connection Credentials Rejected",
+		Message: fmt.Sprintf("The server rejected the stored credentials of '%s'. Update them%s: %s",
+			conn.Name, nextRun, check.Error),
+		Type:      notification.ConnectionCredentialsInvalid,
+		Status:    notification.StatusUnread,
+		Metadata:  metadataJSON,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	s.dispatchWebhooks(n, metadata)
+
+	if s.notifyThroughFallbacks(userSettings, n, metadata) {
+		return
+	}
+
+	if userSettings.NotifyDashboard {
+		if err := s.notificationRepo.CreateNotification(n); err != nil {
+			slog.Error("Failed to create credential notification", "error", err)
+		}
+	}
+
+	if userSettings.NotifyWebhook && userSettings.WebhookURL != nil {
+		go s.sendWebhookNotification(*userSettings.WebhookURL, metadata)
+	}
+
+	s.notifyDiscord(userSettings, conn.ID, n, metadata)
+	s.notifyEmail(userSettings, n, metadata)
+	s.notifyPush(userSettings, n, metadata)
+	s.notifyMatrix(userSettings, n, metadata)
+}
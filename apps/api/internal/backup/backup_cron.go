@@ -0,0 +1,376 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleParser reads the cron expressions of backup schedules: standard
+// five-field expressions (minute hour day month weekday), six fields with
+// leading seconds, and descriptors such as @daily or @every 6h. A
+// CRON_TZ=Europe/Amsterdam prefix runs the schedule in that time zone
+// instead of the server's.
+var scheduleParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+const (
+	defaultCronPreviewRuns = 5
+	maxCronPreviewRuns     = 100
+)
+
+// CronScheduleError rejects a cron expression that cannot be scheduled
+type CronScheduleError struct {
+	Reason string
+}
+
+func (e *CronScheduleError) Error() string {
+	return e.Reason
+}
+
+// hasCronTimezone reports whether an expression names its own time zone
+func hasCronTimezone(expr string) bool {
+	expr = strings.TrimSpace(expr)
+	return strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=")
+}
+
+// validateScheduleTimezone checks the time zone of a schedule. Nil leaves
+// the schedule's zone as it is and an empty name clears it.
+func validateScheduleTimezone(timezone *string, expr string) (*string, error) {
+	if timezone == nil {
+		return nil, nil
+	}
+	name := strings.TrimSpace(*timezone)
+	if name == "" {
+		return &name, nil
+	}
+	if hasCronTimezone(expr) {
+		return nil, &CronScheduleError{Reason: "the cron schedule names its own time zone with CRON_TZ; leave timezone empty or remove the prefix"}
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return nil, &CronScheduleError{Reason: fmt.Sprintf("invalid timezone %q: %v", name, err)}
+	}
+	return &name, nil
+}
+
+// parseCronSchedule validates a cron expression and evaluates it in the
+// given IANA time zone, or the server's when it is empty. Besides syntax
+// errors it rejects expressions that name no existing date, such as
+// February 30th, which would never run.
+func parseCronSchedule(expr, timezone string) (cron.Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, &CronScheduleError{Reason: "cron schedule is required"}
+	}
+
+	fields := strings.Fields(expr)
+	if hasCronTimezone(expr) {
+		fields = fields[1:]
+	}
+	if len(fields) > 0 && !strings.HasPrefix(fields[0], "@") && len(fields) != 5 && len(fields) != 6 {
+		return nil, &CronScheduleError{Reason: fmt.Sprintf("cron schedule must have 5 fields (minute hour day month weekday) or 6 with leading seconds, got %d", len(fields))}
+	}
+
+	spec := expr
+	if timezone != "" && !hasCronTimezone(expr) {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, &CronScheduleError{Reason: fmt.Sprintf("invalid timezone %q: %v", timezone, err)}
+		}
+		spec = "CRON_TZ=" + timezone + " " + expr
+	}
+
+	parsed, err := scheduleParser.Parse(spec)
+	if err != nil {
+		return nil, &CronScheduleError{Reason: fmt.Sprintf("invalid cron schedule: %v", err)}
+	}
+
+	schedule := parsed
+	if spec, ok := parsed.(*cron.SpecSchedule); ok && spec.Hour&starBit == 0 {
+		schedule = &wallClockSchedule{spec: spec}
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, &CronScheduleError{Reason: fmt.Sprintf("cron schedule %q never runs", expr)}
+	}
+	return schedule, nil
+}
+
+// starBit is set in a field of a cron.SpecSchedule that was given as *
+const starBit = 1 << 63
+
+// wallClockSchedule runs a schedule with fixed hours by the wall clock of its
+// time zone across daylight saving changes. A run whose time the clocks skip
+// when they move forward runs when they jump instead of being dropped, and a
+// run whose time repeats when they move back runs only the first time.
+// Schedules that run every hour keep counting real time, so they neither
+// pause nor double up.
+type wallClockSchedule struct {
+	spec *cron.SpecSchedule
+}
+
+func (w *wallClockSchedule) Next(t time.Time) time.Time {
+	loc := w.spec.Location
+	t = t.In(loc)
+	next := w.spec.Next(t)
+
+	// Evaluated at the offset in effect now, the expression finds run times
+	// that the coming change skips
+	_, offset := t.Zone()
+	fixed := *w.spec
+	fixed.Location = time.FixedZone("", offset)
+	if skipped := fixed.Next(t.In(fixed.Location)); !skipped.IsZero() && (next.IsZero() || !skipped.After(next)) && !existsOnWallClock(skipped, loc) {
+		return offsetChangeBetween(t, skipped.In(loc))
+	}
+
+	for !next.IsZero() && repeatsWallClock(next) {
+		next = w.spec.Next(next)
+	}
+	return next
+}
+
+// existsOnWallClock reports whether the wall clock time of t occurs in loc
+func existsOnWallClock(t time.Time, loc *time.Location) bool {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	local := time.Date(year, month, day, hour, min, sec, 0, loc)
+	localHour, localMin, localSec := local.Clock()
+	return local.Day() == day && localHour == hour && localMin == min && localSec == sec
+}
+
+// repeatsWallClock reports whether the wall clock time of t occurred before,
+// an offset change earlier
+func repeatsWallClock(t time.Time) bool {
+	_, offset := t.Zone()
+	_, earlierOffset := t.Add(-12 * time.Hour).Zone()
+	if earlierOffset <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(earlierOffset-offset) * time.Second)
+	return earlier.Format("2006-01-02 15:04:05") == t.Format("2006-01-02 15:04:05")
+}
+
+// offsetChangeBetween finds the instant the UTC offset of from changes,
+// which lies before to
+func offsetChangeBetween(from, to time.Time) time.Time {
+	_, offset := from.Zone()
+	lo, hi := from, to
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2)
+		if _, midOffset := mid.Zone(); midOffset == offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi.Truncate(time.Second)
+}
+
+// storedTimezone is the time zone saved for a schedule, nil for the server's
+func storedTimezone(name string) *string {
+	if name == "" {
+		return nil
+	}
+	return &name
+}
+
+// timezoneName is the name of a saved time zone, empty for the server's
+func timezoneName(timezone *string) string {
+	if timezone == nil {
+		return ""
+	}
+	return *timezone
+}
+
+// cronSchedule returns the schedule's cron expression evaluated in its time
+// zone, or the single run of a one-shot schedule
+func (schedule *BackupSchedule) cronSchedule() (cron.Schedule, error) {
+	return scheduleSpec(schedule.CronSchedule, schedule.RunAt, timezoneName(schedule.Timezone))
+}
+
+// registerSchedule adds the cron job of a schedule
+func (s *BackupService) registerSchedule(schedule *BackupSchedule) (cron.EntryID, error) {
+	spec, err := schedule.cronSchedule()
+	if err != nil {
+		return 0, err
+	}
+	return s.cronManager.Schedule(spec, cron.FuncJob(func() {
+		s.runScheduled(schedule)
+	})), nil
+}
+
+// ScheduledRun is a run time on the wall clock of its schedule's time zone
+// and in UTC
+type ScheduledRun struct {
+	Local time.Time `json:"local"`
+	UTC   time.Time `json:"utc"`
+}
+
+// nextCronRuns lists the next count run times of a schedule after from, in
+// the time zone loc
+func nextCronRuns(spec cron.Schedule, from time.Time, count int, loc *time.Location) []ScheduledRun {
+	runs := []ScheduledRun{}
+	for next := spec.Next(from); !next.IsZero() && len(runs) < count; next = spec.Next(next) {
+		runs = append(runs, ScheduledRun{Local: next.In(loc), UTC: next.UTC()})
+	}
+	return runs
+}
+
+// scheduleLocation is the time zone a schedule's runs are shown in
+func scheduleLocation(expr, timezone string) *time.Location {
+	fields := strings.Fields(expr)
+	if hasCronTimezone(expr) {
+		timezone = fields[0][strings.Index(fields[0], "=")+1:]
+	}
+	if timezone != "" {
+		if loc, err := time.LoadLocation(timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// CronPreviewRequest asks for the next run times of a cron expression
+type CronPreviewRequest struct {
+	CronSchedule string `json:"cron_schedule"`
+	Count        int    `json:"count,omitempty"`
+	// Timezone is the IANA zone the schedule would run in; defaults to the
+	// server's local time zone
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// CronPreview lists the next run times of a cron expression, as the
+// scheduler will run it
+type CronPreview struct {
+	CronSchedule string         `json:"cron_schedule"`
+	Timezone     string         `json:"timezone"`
+	NextRuns     []ScheduledRun `json:"next_runs"`
+}
+
+// PreviewCronSchedule validates a cron expression and returns its next run
+// times, so a schedule can be confirmed before it is saved
+func (s *BackupService) PreviewCronSchedule(req *CronPreviewRequest) (*CronPreview, error) {
+	timezone, err := validateScheduleTimezone(&req.Timezone, req.CronSchedule)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := parseCronSchedule(req.CronSchedule, *timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	count := req.Count
+	if count <= 0 {
+		count = defaultCronPreviewRuns
+	}
+	if count > maxCronPreviewRuns {
+		return nil, &CronScheduleError{Reason: fmt.Sprintf("count must be at most %d", maxCronPreviewRuns)}
+	}
+
+	loc := scheduleLocation(req.CronSchedule, *timezone)
+	return &CronPreview{
+		CronSchedule: strings.TrimSpace(req.CronSchedule),
+		Timezone:     loc.String(),
+		NextRuns:     nextCronRuns(spec, time.Now(), count, loc),
+	}, nil
+}
+
+// ScheduleOverview is a connection's schedule with its coming runs, none
+// while it is paused
+type ScheduleOverview struct {
+	Schedule *BackupSchedule `json:"schedule"`
+	// Timezone is the zone the schedule runs in, the server's when the
+	// schedule names none
+	Timezone string         `json:"timezone"`
+	NextRuns []ScheduledRun `json:"next_runs"`
+}
+
+// scheduleOverview describes a saved schedule with its next runs
+func scheduleOverview(schedule *BackupSchedule) *ScheduleOverview {
+	loc := scheduleLocation(schedule.CronSchedule, timezoneName(schedule.Timezone))
+	overview := &ScheduleOverview{
+		Schedule: schedule,
+		Timezone: loc.String(),
+		NextRuns: []ScheduledRun{},
+	}
+	if schedule.Paused {
+		return overview
+	}
+	if spec, err := schedule.cronSchedule(); err == nil {
+		overview.NextRuns = nextCronRuns(spec, time.Now(), defaultCronPreviewRuns, loc)
+	}
+	return overview
+}
+
+// GetScheduleOverview returns the schedule of one of the user's connections
+// with its next runs
+func (s *BackupService) GetScheduleOverview(connectionID string, userID uuid.UUID) (*ScheduleOverview, error) {
+	schedule, err := s.userSchedule(connectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scheduleOverview(schedule), nil
+}
+
+// scheduleNextRuns returns the next runs of a connection's schedule for the
+// response that saved it
+func (s *BackupService) scheduleNextRuns(connectionID string) []ScheduledRun {
+	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
+	if err != nil {
+		return []ScheduledRun{}
+	}
+	return scheduleOverview(schedule).NextRuns
+}
+
+// sendScheduleError answers a request that failed to save a schedule
+func sendScheduleError(w http.ResponseWriter, err error) {
+	var invalid *CronScheduleError
+	if errors.As(err, &invalid) {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.SendError(w, http.StatusInternalServerError, err.Error())
+}
+
+func (h *BackupHandler) PreviewCronSchedule(w http.ResponseWriter, r *http.Request) {
+	var req CronPreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	preview, err := h.backupService.PreviewCronSchedule(&req)
+	if err != nil {
+		sendScheduleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Cron schedule previewed successfully", preview)
+}
+
+func (h *BackupHandler) GetBackupSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	overview, err := h.backupService.GetScheduleOverview(mux.Vars(r)["connection_id"], userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "No schedule found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule retrieved successfully", overview)
+}
@@ -0,0 +1,341 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+)
+
+// Content-defined chunk boundaries are cut where the rolling gear hash has
+// its low bits clear, so an insert early in a dump only changes the chunks
+// around it instead of shifting every chunk after it.
+const (
+	minChunkSize = 512 * 1024
+	maxChunkSize = 8 * 1024 * 1024
+	// chunkMask gives chunks of about 1 MiB on average
+	chunkMask = 1<<20 - 1
+)
+
+var gearTable = newGearTable()
+
+// newGearTable fills the gear hash table from a fixed splitmix64 sequence.
+// Changing it would change every chunk boundary and defeat deduplication of
+// existing chunks.
+func newGearTable() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x76656c6c64)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}
+
+type chunker struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{
+		r:   bufio.NewReaderSize(r, 256*1024),
+		buf: make([]byte, 0, maxChunkSize),
+	}
+}
+
+// next returns the next chunk, which is only valid until the following call
+func (c *chunker) next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var hash uint64
+	for {
+		b, err := c.r.ReadByte()
+		if err == io.EOF {
+			if len(c.buf) == 0 {
+				return nil, io.EOF
+			}
+			return c.buf, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		c.buf = append(c.buf, b)
+		if len(c.buf) < minChunkSize {
+			continue
+		}
+
+		hash = hash<<1 + gearTable[b]
+		if hash&chunkMask == 0 || len(c.buf) >= maxChunkSize {
+			return c.buf, nil
+		}
+	}
+}
+
+// dedupDir reads BACKUP_DEDUP_DIR, the chunk store shared by all
+// deduplicated schedules. It defaults to .chunks in the backup directory.
+func (s *BackupService) dedupDir() string {
+	if dir := strings.TrimSpace(os.Getenv("BACKUP_DEDUP_DIR")); dir != "" {
+		return dir
+	}
+	return filepath.Join(s.backupDir, ".chunks")
+}
+
+func chunkPath(dir, hash string) string {
+	return filepath.Join(dir, hash[:2], hash)
+}
+
+func dedupFor(schedule *BackupSchedule) bool {
+	return schedule != nil && schedule.Deduplicate
+}
+
+// deduplicateBackupIfConfigured moves a local artifact into the chunk store.
+// Artifacts whose upload can still be resumed keep their file until then.
+func (s *BackupService) deduplicateBackupIfConfigured(backup *Backup, schedule *BackupSchedule) {
+	if !dedupFor(schedule) {
+		return
+	}
+	if _, err := os.Stat(backup.Path); err != nil {
+		return
+	}
+
+	journal, err := s.backupRepo.GetUploadJournal(backup.ID.String())
+	if err != nil && err != sql.ErrNoRows {
+		slog.WarnContext(backupContext(backup), "Failed to get upload journal of backup", "backup_id", backup.ID, "error", err)
+		return
+	}
+	if journal != nil && journal.Status != UploadStatusCompleted {
+		slog.WarnContext(backupContext(backup), "Backup is kept as a file until its upload completes", "backup_id", backup.ID)
+		return
+	}
+
+	if err := s.deduplicateBackup(backup); err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to deduplicate backup, keeping it as a file", "backup_id", backup.ID, "error", err)
+	}
+}
+
+// deduplicateBackup splits the artifact into chunks, stores the ones the
+// store does not have yet, records the chunk list and removes the file
+func (s *BackupService) deduplicateBackup(backup *Backup) error {
+	s.dedupMu.Lock()
+	defer s.dedupMu.Unlock()
+
+	dir := s.dedupDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create chunk store: %v", err)
+	}
+
+	file, err := os.Open(backup.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var chunks []BackupChunk
+	var newChunks int
+	var newSize int64
+	c := newChunker(file)
+	for seq := 0; ; seq++ {
+		data, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read backup: %v", err)
+		}
+
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		path := chunkPath(dir, hash)
+
+		var storedSize int64
+		if info, err := os.Stat(path); err == nil {
+			storedSize = info.Size()
+		} else {
+			storedSize, err = writeChunk(path, data)
+			if err != nil {
+				return fmt.Errorf("failed to store chunk %s: %v", hash, err)
+			}
+			newChunks++
+			newSize += storedSize
+		}
+
+		chunks = append(chunks, BackupChunk{Seq: seq, Hash: hash, Size: int64(len(data)), StoredSize: storedSize})
+	}
+
+	if err := s.backupRepo.SaveBackupChunks(backup.ID.String(), chunks); err != nil {
+		return err
+	}
+
+	file.Close()
+	if err := os.Remove(backup.Path); err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to remove deduplicated backup file", "path", backup.Path, "error", err)
+	}
+
+	slog.InfoContext(backupContext(backup), "Deduplicated backup",
+		"backup_id", backup.ID, "chunks", len(chunks), "new_chunks", newChunks, "stored", formatBytes(newSize))
+	return nil
+}
+
+// writeChunk stores a gzip-compressed chunk under a temporary name first, so
+// a crash never leaves a truncated chunk under its hash
+func writeChunk(path string, data []byte) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+
+	tempPath := path + ".tmp"
+	out, err := os.Create(tempPath)
+	if err != nil {
+		return 0, err
+	}
+
+	gz, err := gzip.NewWriterLevel(out, gzip.BestSpeed)
+	if err == nil {
+		_, err = gz.Write(data)
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return 0, err
+	}
+
+	info, err := os.Stat(tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return 0, err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// reassembleDeduplicatedBackup writes a deduplicated artifact back out of the
+// chunk store into a temp file, checking every chunk against its hash. It
+// returns an empty path for backups that are not deduplicated.
+func (s *BackupService) reassembleDeduplicatedBackup(backup *Backup) (string, error) {
+	chunks, err := s.backupRepo.GetBackupChunks(backup.ID.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to get backup chunks: %v", err)
+	}
+	if len(chunks) == 0 {
+		return "", nil
+	}
+
+	tempDir := filepath.Join(os.TempDir(), "velld-dedup")
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	// The base name keeps the extension, which restores and verification use
+	out, err := os.CreateTemp(tempDir, "*_"+filepath.Base(backup.Path))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	path := out.Name()
+
+	dir := s.dedupDir()
+	for _, chunk := range chunks {
+		if err = readChunk(chunkPath(dir, chunk.Hash), chunk, out); err != nil {
+			break
+		}
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to reassemble backup from chunk store: %v", err)
+	}
+
+	return path, nil
+}
+
+func readChunk(path string, chunk BackupChunk, out io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("chunk %s is missing: %v", chunk.Hash, err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("chunk %s is corrupt: %v", chunk.Hash, err)
+	}
+	defer gz.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, hash), gz)
+	if err != nil {
+		return fmt.Errorf("chunk %s is corrupt: %v", chunk.Hash, err)
+	}
+	if n != chunk.Size || hex.EncodeToString(hash.Sum(nil)) != chunk.Hash {
+		return fmt.Errorf("chunk %s does not match its hash", chunk.Hash)
+	}
+	return nil
+}
+
+// releaseBackupChunks drops a deleted backup's chunk references and removes
+// the chunks no other backup shares
+func (s *BackupService) releaseBackupChunks(backupID string) {
+	s.dedupMu.Lock()
+	defer s.dedupMu.Unlock()
+
+	unreferenced, err := s.backupRepo.ReleaseBackupChunks(backupID)
+	if err != nil {
+		slog.Warn("Failed to release chunks of backup", "backup_id", backupID, "error", err)
+		return
+	}
+
+	dir := s.dedupDir()
+	for _, hash := range unreferenced {
+		if err := os.Remove(chunkPath(dir, hash)); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove chunk", "hash", hash, "error", err)
+		}
+	}
+}
+
+func (s *BackupService) GetDedupStats(userID uuid.UUID) (*DedupStats, error) {
+	return s.backupRepo.GetDedupStats(userID)
+}
+
+func (h *BackupHandler) GetDedupStats(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats, err := h.backupService.GetDedupStats(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Deduplication stats retrieved successfully", stats)
+}
@@ -3,11 +3,11 @@ package backup
 import (
 	"bufio"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
 
-	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/common/response"
 	"github.com/gorilla/mux"
 )
@@ -34,47 +34,78 @@ func (h *BackupHandler) CompareBackups(w http.ResponseWriter, r *http.Request) {
 	sourceID := vars["sourceId"]
 	targetID := vars["targetId"]
 
-	userID, err := common.GetUserIDFromContext(r.Context())
-	if err != nil {
-		response.SendError(w, http.StatusBadRequest, err.Error())
-		return
-	}
-
 	sourceBackup, err := h.backupService.GetBackup(sourceID)
 	if err != nil {
 		response.SendError(w, http.StatusNotFound, "Source backup not found")
 		return
 	}
+	sourceConn := h.requireConnectionAccess(w, r, sourceBackup.ConnectionID, "Source backup not found")
+	if sourceConn == nil {
+		return
+	}
 
 	targetBackup, err := h.backupService.GetBackup(targetID)
 	if err != nil {
 		response.SendError(w, http.StatusNotFound, "Target backup not found")
 		return
 	}
+	targetConn := h.requireConnectionAccess(w, r, targetBackup.ConnectionID, "Target backup not found")
+	if targetConn == nil {
+		return
+	}
+
+	if isGPGEncrypted(sourceBackup) || isGPGEncrypted(targetBackup) {
+		response.SendError(w, http.StatusBadRequest, "Encrypted backups cannot be compared")
+		return
+	}
+
+	if isDirectoryDump(sourceBackup.Path) || isDirectoryDump(targetBackup.Path) {
+		response.SendError(w, http.StatusBadRequest, "Directory-format backups cannot be compared")
+		return
+	}
 
 	// Ensure both backup files are available (local or download from S3)
-	sourceFilePath, sourceIsTemp, err := h.backupService.ensureBackupFileAvailable(sourceBackup, userID)
+	sourceFilePath, sourceIsTemp, err := h.backupService.ensureBackupContentAvailable(sourceBackup, sourceConn.UserID)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to access source backup: %v", err))
 		return
 	}
 
-	targetFilePath, targetIsTemp, err := h.backupService.ensureBackupFileAvailable(targetBackup, userID)
+	targetFilePath, targetIsTemp, err := h.backupService.ensureBackupContentAvailable(targetBackup, targetConn.UserID)
 	if err != nil {
+		if sourceIsTemp {
+			os.Remove(sourceFilePath)
+		}
 		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to access target backup: %v", err))
 		return
 	}
 
+	// Custom-format archives are binary; compare their SQL rendering instead
+	sourceFilePath, sourceIsTemp, err = h.backupService.sqlRenderingOf(sourceFilePath, sourceIsTemp)
+	if err == nil {
+		targetFilePath, targetIsTemp, err = h.backupService.sqlRenderingOf(targetFilePath, targetIsTemp)
+	}
+	if err != nil {
+		if sourceIsTemp {
+			os.Remove(sourceFilePath)
+		}
+		if targetIsTemp {
+			os.Remove(targetFilePath)
+		}
+		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read backup archive: %v", err))
+		return
+	}
+
 	// Clean up temp files after comparison
 	defer func() {
 		if sourceIsTemp {
 			if err := os.Remove(sourceFilePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp source file %s: %v\n", sourceFilePath, err)
+				slog.Warn("Failed to remove temp source file", "path", sourceFilePath, "error", err)
 			}
 		}
 		if targetIsTemp {
 			if err := os.Remove(targetFilePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp target file %s: %v\n", targetFilePath, err)
+				slog.Warn("Failed to remove temp target file", "path", targetFilePath, "error", err)
 			}
 		}
 	}()
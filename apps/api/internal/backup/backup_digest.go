@@ -0,0 +1,295 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/mail"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/google/uuid"
+)
+
+// defaultDigestSchedule sends digests every day at 07:00; weekly digests go
+// out on the user's digest weekday
+const defaultDigestSchedule = "0 0 7 * * *"
+
+// maxDigestErrors caps the distinct errors listed per connection
+const maxDigestErrors = 3
+
+// DigestDelivery tells where a digest was sent
+type DigestDelivery struct {
+	Recipients []string `json:"recipients"`
+	Slack      bool     `json:"slack"`
+}
+
+func (s *BackupService) scheduleDigests() {
+	schedule := strings.TrimSpace(os.Getenv("BACKUP_DIGEST_SCHEDULE"))
+	if strings.EqualFold(schedule, "off") {
+		return
+	}
+	if schedule == "" {
+		schedule = defaultDigestSchedule
+	}
+
+	if _, err := s.cronManager.AddFunc(schedule, s.sendDigests); err != nil {
+		slog.Error("Failed to schedule digest", "error", err)
+	}
+}
+
+// sendDigests sends the digest of every user due for one: daily digests each
+// time, weekly digests on the user's weekday
+func (s *BackupService) sendDigests() {
+	users, err := s.backupRepo.GetConnectionOwners()
+	if err != nil {
+		slog.Error("Failed to get users for digest", "error", err)
+		return
+	}
+
+	today := int(time.Now().Weekday())
+	for _, userID := range users {
+		userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+		if err != nil {
+			slog.Error("Failed to get settings for digest", "user_id", userID, "error", err)
+			continue
+		}
+		switch userSettings.DigestFrequency {
+		case settings.DigestOff:
+			continue
+		case settings.DigestWeekly:
+			if userSettings.DigestWeekday != today {
+				continue
+			}
+		}
+		if _, err := s.SendDigest(userID); err != nil {
+			slog.Error("Failed to send digest", "user_id", userID, "error", err)
+		}
+	}
+}
+
+// digestPeriod is the time a digest covers, up to when it is sent
+func digestPeriod(frequency string) (time.Duration, string) {
+	if frequency == settings.DigestWeekly {
+		return 7 * 24 * time.Hour, "Weekly"
+	}
+	return 24 * time.Hour, "Daily"
+}
+
+// SendDigest sends the digest of the user's period to the digest recipients
+// when email notifications are on, and to the digest Slack webhook when one
+// is set. A user whose digest is off gets the daily one.
+func (s *BackupService) SendDigest(userID uuid.UUID) (*DigestDelivery, error) {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user settings: %v", err)
+	}
+
+	delivery := &DigestDelivery{Recipients: []string{}}
+	var recipients []string
+	if userSettings.NotifyEmail {
+		recipients = userSettings.DigestRecipients()
+	}
+	if len(recipients) == 0 && userSettings.DigestSlackWebhookURL == nil {
+		return delivery, nil
+	}
+
+	period, name := digestPeriod(userSettings.DigestFrequency)
+	to := time.Now()
+	digest, err := s.BuildDigest(userID, to.Add(-period), to)
+	if err != nil {
+		return nil, err
+	}
+	digest.Period = name
+
+	var errs []string
+	if len(recipients) > 0 {
+		subject := fmt.Sprintf("Velld - %s digest", name)
+		switch {
+		case digest.Failed > 0:
+			subject += fmt.Sprintf(": %d failed", digest.Failed)
+		case digest.Partial > 0:
+			subject += fmt.Sprintf(": %d partially failed", digest.Partial)
+		}
+		if err := s.sendEmail(recipients, userSettings, subject, mail.TemplateDigest, digest); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to send email digest: %v", err))
+		} else {
+			delivery.Recipients = recipients
+		}
+	}
+	if userSettings.DigestSlackWebhookURL != nil {
+		if err := notification.SendSlack(*userSettings.DigestSlackWebhookURL, slackDigest(digest)); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to send Slack digest: %v", err))
+		} else {
+			delivery.Slack = true
+		}
+	}
+
+	if len(errs) > 0 {
+		return delivery, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return delivery, nil
+}
+
+// slackDigest formats a digest for Slack: the totals, then a line per
+// connection
+func slackDigest(digest *mail.DigestData) *notification.SlackMessage {
+	const timeFormat = "2006-01-02 15:04 MST"
+	title := fmt.Sprintf("%s digest", digest.Period)
+	totals := fmt.Sprintf("*%d* backup runs: *%d* succeeded, *%d* partially failed, *%d* failed, *%d* skipped\nBacked up: *%s*",
+		digest.Runs, digest.Succeeded, digest.Partial, digest.Failed, digest.Skipped, digest.TotalSize)
+	if digest.ExpiringBackups > 0 {
+		totals += fmt.Sprintf("\nDeleted by retention before the next digest: *%d* backups, %s", digest.ExpiringBackups, digest.ExpiringSize)
+	}
+
+	msg := &notification.SlackMessage{
+		Text: fmt.Sprintf("Velld %s: %d succeeded, %d failed", strings.ToLower(title), digest.Succeeded, digest.Failed+digest.Partial),
+		Blocks: []notification.SlackBlock{
+			notification.SlackHeader(title),
+			notification.SlackContext(fmt.Sprintf("%s to %s", digest.From.Format(timeFormat), digest.To.Format(timeFormat))),
+			notification.SlackSection(totals),
+		},
+	}
+
+	for _, conn := range digest.Connections {
+		lastBackup := "never"
+		if conn.LastBackup != nil {
+			lastBackup = conn.LastBackup.Format(timeFormat)
+		}
+		line := fmt.Sprintf("*%s* (%s, %s)\nRuns: %d, failed: %d, backed up: %s, last backup: %s",
+			notification.EscapeSlack(conn.Name), conn.Type, notification.EscapeSlack(conn.Database),
+			conn.Runs, conn.Failed, conn.Size, lastBackup)
+		if conn.ExpiringBackups > 0 {
+			line += fmt.Sprintf("\nExpiring: %d backups, %s", conn.ExpiringBackups, conn.ExpiringSize)
+		}
+		for _, runErr := range conn.Errors {
+			line += "\n> " + notification.EscapeSlack(runErr)
+		}
+		msg.Blocks = append(msg.Blocks, notification.SlackSection(line))
+	}
+	return msg
+}
+
+// BuildDigest summarizes the backup runs of a user's connections that
+// started in [from, to), and the backups retention deletes in the period
+// after it
+func (s *BackupService) BuildDigest(userID uuid.UUID, from, to time.Time) (*mail.DigestData, error) {
+	conns, err := s.connStorage.ListByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connections: %v", err)
+	}
+	runs, err := s.backupRepo.GetBackupRunsSince(userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup runs: %v", err)
+	}
+
+	next := to.Add(to.Sub(from))
+	digest := &mail.DigestData{From: from, To: to, Runs: len(runs), Connections: []mail.DigestConnection{}}
+	var totalSize, expiringSize int64
+	byConnection := make(map[string]*mail.DigestConnection)
+	for _, conn := range conns {
+		summary := mail.DigestConnection{Name: conn.Name, Type: conn.Type, Size: formatBytes(0), ExpiringSize: formatBytes(0)}
+		if stored, err := s.connStorage.GetConnection(conn.ID); err == nil {
+			summary.Database = stored.DatabaseName
+		}
+		if latest, err := s.backupRepo.GetLatestCompletedBackup(conn.ID); err == nil && latest != nil {
+			summary.LastBackup = latest.CompletedTime
+		}
+
+		var size int64
+		if backups, err := s.backupRepo.GetBackupsByConnectionID(conn.ID); err == nil {
+			for _, backup := range backups {
+				if backup.Status == "completed" && !backup.CreatedAt.Before(from) && backup.CreatedAt.Before(to) {
+					size += backup.Size
+				}
+			}
+		}
+		summary.Size = formatBytes(size)
+		totalSize += size
+
+		// Retention runs with the schedule, so paused schedules delete nothing
+		if schedule, err := s.backupRepo.GetBackupSchedule(conn.ID); err == nil && schedule.Enabled && !schedule.Paused && schedule.RetentionDays > 0 {
+			if expiring, err := s.backupRepo.GetBackupsOlderThan(conn.ID, next.AddDate(0, 0, -schedule.RetentionDays)); err == nil {
+				var size int64
+				for _, backup := range expiring {
+					size += backup.Size
+				}
+				summary.ExpiringBackups = len(expiring)
+				summary.ExpiringSize = formatBytes(size)
+				digest.ExpiringBackups += len(expiring)
+				expiringSize += size
+			}
+		}
+
+		digest.Connections = append(digest.Connections, summary)
+		byConnection[conn.ID] = &digest.Connections[len(digest.Connections)-1]
+	}
+	digest.TotalSize = formatBytes(totalSize)
+	digest.ExpiringSize = formatBytes(expiringSize)
+
+	for _, run := range runs {
+		summary := byConnection[run.ConnectionID]
+		if summary == nil {
+			continue
+		}
+		summary.Runs++
+
+		switch run.Status {
+		case RunStatusSuccess:
+			digest.Succeeded++
+			summary.Succeeded++
+			continue
+		case RunStatusPartial:
+			digest.Partial++
+			summary.Failed++
+		case RunStatusFailed, RunStatusTimedOut, RunStatusInterrupted:
+			digest.Failed++
+			summary.Failed++
+		default:
+			digest.Skipped++
+			continue
+		}
+
+		if run.Error != nil && len(summary.Errors) < maxDigestErrors && !containsString(summary.Errors, *run.Error) {
+			summary.Errors = append(summary.Errors, *run.Error)
+		}
+	}
+
+	return digest, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SendDigest sends the digest right away, to check the email and Slack
+// settings without waiting for the schedule
+func (h *BackupHandler) SendDigest(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	delivery, err := h.backupService.SendDigest(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(delivery.Recipients) == 0 && !delivery.Slack {
+		response.SendError(w, http.StatusBadRequest, "No recipient or Slack webhook receives the digest")
+		return
+	}
+
+	response.SendSuccess(w, "Digest sent successfully", delivery)
+}
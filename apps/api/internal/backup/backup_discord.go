@@ -0,0 +1,195 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/google/uuid"
+)
+
+// validateScheduleDiscordWebhook checks a schedule's Discord webhook; an empty
+// URL removes it
+func validateScheduleDiscordWebhook(webhookURL *string) (*string, error) {
+	if webhookURL == nil {
+		return nil, nil
+	}
+
+	trimmed := strings.TrimSpace(*webhookURL)
+	if trimmed == "" {
+		return nil, nil
+	}
+	if err := notification.ValidateDiscordWebhookURL(trimmed); err != nil {
+		return nil, err
+	}
+	return &trimmed, nil
+}
+
+// scheduleDiscordWebhook returns the Discord webhook of the connection's
+// schedule, if it has one
+func (s *BackupService) scheduleDiscordWebhook(connectionID string) *string {
+	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
+	if err != nil {
+		return nil
+	}
+	return schedule.DiscordWebhookURL
+}
+
+// discordWebhookFor returns where the connection's events are posted: the
+// schedule's webhook, else the one of the settings when Discord notifications
+// are on
+func (s *BackupService) discordWebhookFor(userSettings *settings.UserSettings, connectionID string) *string {
+	if webhookURL := s.scheduleDiscordWebhook(connectionID); webhookURL != nil {
+		return webhookURL
+	}
+	if userSettings.NotifyDiscord {
+		return userSettings.DiscordWebhookURL
+	}
+	return nil
+}
+
+// discordMessage formats a notification with its metadata as a Discord embed
+func discordMessage(n *notification.Notification, metadata map[string]interface{}) *notification.DiscordMessage {
+	var fields []notification.DiscordEmbedField
+	for _, field := range notificationFields {
+		value, ok := metadata[field.key]
+		if !ok || value == nil {
+			continue
+		}
+		text := fmt.Sprint(value)
+		if text == "" {
+			continue
+		}
+		fields = append(fields, notification.DiscordEmbedField{Name: field.label, Value: text, Inline: field.inline})
+	}
+	return notification.NewDiscordMessage(n, fields)
+}
+
+// notifyDiscord posts n to the Discord webhook of the connection, if any,
+// without waiting for Discord
+func (s *BackupService) notifyDiscord(userSettings *settings.UserSettings, connectionID string, n *notification.Notification, metadata map[string]interface{}) {
+	webhookURL := s.discordWebhookFor(userSettings, connectionID)
+	if webhookURL == nil {
+		return
+	}
+
+	message := discordMessage(n, metadata)
+	go func() {
+		if err := notification.SendDiscord(*webhookURL, message); err != nil {
+			slog.Warn("Failed to send notification to Discord", "type", n.Type, "error", err)
+		}
+	}()
+}
+
+// notifySuccessToDiscord posts a successful backup or restore to Discord when
+// the user asked for successes as well. Successes are not kept on the
+// dashboard.
+func (s *BackupService) notifySuccessToDiscord(userID uuid.UUID, connectionID string, n *notification.Notification, metadata map[string]interface{}) {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	if err != nil || userSettings == nil || !userSettings.DiscordNotifySuccess {
+		return
+	}
+	s.notifyDiscord(userSettings, connectionID, n, metadata)
+}
+
+// notifyBackupSucceeded posts a successful scheduled run to Discord and Matrix
+func (s *BackupService) notifyBackupSucceeded(run *BackupRun) {
+	conn, err := s.connStorage.GetConnection(run.ConnectionID)
+	if err != nil {
+		return
+	}
+
+	var size int64
+	for _, backupID := range run.backupIDs() {
+		if backup, err := s.backupRepo.GetBackup(backupID); err == nil {
+			size += backup.Size
+		}
+	}
+
+	metadata := map[string]interface{}{
+		"connection_id":   conn.ID,
+		"connection_name": conn.Name,
+		"database_name":   conn.DatabaseName,
+		"database_type":   conn.Type,
+		"run_id":          run.ID,
+		"size":            formatBytes(size),
+		"jobs":            fmt.Sprintf("%d of %d", run.SucceededJobs, run.TotalJobs),
+	}
+	if run.CompletedTime != nil {
+		metadata["duration"] = run.CompletedTime.Sub(run.StartedTime).Round(time.Second).String()
+	}
+
+	now := time.Now()
+	n := &notification.Notification{
+		ID:        uuid.New(),
+		UserID:    conn.UserID,
+		Title:     "Backup Completed",
+		Message:   fmt.Sprintf("Backup of '%s' completed", conn.Name),
+		Type:      notification.BackupCompleted,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.dispatchWebhooks(n, metadata)
+	s.notifySuccessToDiscord(conn.UserID, conn.ID, n, metadata)
+	s.notifySuccessToMatrix(conn.UserID, n, metadata)
+}
+
+// notifyRestoreFinished posts the outcome of a restore to Discord and Matrix:
+// failed and cancelled restores always, completed ones with successes turned
+// on
+func (s *BackupService) notifyRestoreFinished(record *RestoreRecord) {
+	conn, err := s.connStorage.GetConnection(record.ConnectionID)
+	if err != nil {
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"connection_id":   conn.ID,
+		"connection_name": conn.Name,
+		"database_name":   record.DatabaseName,
+		"database_type":   conn.Type,
+		"backup_id":       record.BackupID,
+	}
+	if record.DurationMs != nil {
+		metadata["duration"] = (time.Duration(*record.DurationMs) * time.Millisecond).Round(time.Second).String()
+	}
+	if record.Error != nil {
+		metadata["error"] = *record.Error
+	}
+
+	now := time.Now()
+	n := &notification.Notification{
+		ID:        uuid.New(),
+		UserID:    conn.UserID,
+		Title:     "Restore Completed",
+		Message:   fmt.Sprintf("Restore into '%s' completed", record.DatabaseName),
+		Type:      notification.RestoreCompleted,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	switch record.Status {
+	case RestoreJobCompleted:
+		s.dispatchWebhooks(n, metadata)
+		s.notifySuccessToDiscord(conn.UserID, conn.ID, n, metadata)
+		s.notifySuccessToMatrix(conn.UserID, n, metadata)
+		return
+	case RestoreJobCancelled:
+		n.Title = "Restore Cancelled"
+		n.Message = fmt.Sprintf("Restore into '%s' was cancelled", record.DatabaseName)
+	default:
+		n.Title = "Restore Failed"
+		n.Message = fmt.Sprintf("Restore into '%s' failed", record.DatabaseName)
+	}
+	n.Type = notification.RestoreFailed
+	s.dispatchWebhooks(n, metadata)
+
+	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+	if err != nil || userSettings == nil {
+		return
+	}
+	s.notifyDiscord(userSettings, conn.ID, n, metadata)
+	s.notifyMatrix(userSettings, n, metadata)
+}
@@ -0,0 +1,241 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// DownloadOptions undo the compression of an artifact while it is sent. The
+// stored artifact is sent unchanged by default. Encrypted artifacts are never
+// decrypted by velld: private keys stay with the client, which decrypts the
+// download locally.
+type DownloadOptions struct {
+	// Decompress pipes artifacts through the decompressor of their codec
+	Decompress bool
+}
+
+// transforms reports whether the options change what is sent
+func (o DownloadOptions) transforms(backup *Backup) bool {
+	return o.Decompress && backup.CompressionCommand != nil && *backup.CompressionCommand != ""
+}
+
+// DownloadRequestError rejects a download that cannot be served as asked
+type DownloadRequestError struct {
+	Reason string
+}
+
+func (e *DownloadRequestError) Error() string {
+	return e.Reason
+}
+
+// backupDownload is an opened artifact ready to be sent
+type backupDownload struct {
+	backup  *Backup
+	content io.ReadSeekCloser
+	modTime time.Time
+	// cleanup removes the temp file of an artifact reassembled for the
+	// download
+	cleanup func()
+}
+
+func (d *backupDownload) Close() error {
+	err := d.content.Close()
+	if d.cleanup != nil {
+		d.cleanup()
+	}
+	return err
+}
+
+// openBackupDownload opens one of the user's artifacts where it is stored.
+// Local and S3 artifacts are read in place, so range requests fetch only
+// the bytes asked for; artifacts stored as split parts or in the chunk store
+// are reassembled into a temp file first.
+func (s *BackupService) openBackupDownload(ctx context.Context, backupID string, userID uuid.UUID) (*backupDownload, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.accessibleConnection(backup.ConnectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	modTime := backup.CreatedAt
+	if backup.CompletedTime != nil {
+		modTime = *backup.CompletedTime
+	}
+
+	if file, err := os.Open(backup.Path); err == nil {
+		return &backupDownload{backup: backup, content: file, modTime: modTime}, nil
+	}
+
+	if backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" && !artifactReplacedBySplit(backup) {
+		storage, err := s.s3StorageForUser(conn.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if storage != nil {
+			object, err := storage.OpenFile(ctx, *backup.S3ObjectKey)
+			if err != nil {
+				return nil, err
+			}
+			return &backupDownload{backup: backup, content: object, modTime: modTime}, nil
+		}
+	}
+
+	filePath, isTemp, err := s.ensureBackupFileAvailable(backup, conn.UserID)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		if isTemp {
+			os.Remove(filePath)
+		}
+		return nil, fmt.Errorf("failed to open backup file: %v", err)
+	}
+
+	download := &backupDownload{backup: backup, content: file, modTime: modTime}
+	if isTemp {
+		download.cleanup = func() {
+			if err := os.Remove(filePath); err != nil {
+				slog.Warn("Failed to remove temp file", "path", filePath, "error", err)
+			}
+		}
+	}
+	return download, nil
+}
+
+// decompressedContent pipes the artifact through the decompressor of its
+// codec. An encrypted artifact was compressed before it was encrypted, so it
+// has to be decrypted by the client first.
+func decompressedContent(ctx context.Context, download *backupDownload) (*exec.Cmd, error) {
+	backup := download.backup
+	if isGPGEncrypted(backup) {
+		return nil, &DownloadRequestError{Reason: "the backup is encrypted after compression; download it as stored, decrypt it locally and decompress it"}
+	}
+
+	codec, err := lookupCompressionCodec(*backup.CompressionCommand)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, codec.decompress[0], codec.decompress[1:]...)
+	cmd.Stdin = download.content
+	return cmd, nil
+}
+
+// downloadFileName is the artifact's name without the extensions of the
+// layers a download removed
+func downloadFileName(backup *Backup, options DownloadOptions) string {
+	name := filepath.Base(backup.Path)
+	if options.Decompress && backup.CompressionCommand != nil {
+		if codec, err := lookupCompressionCodec(*backup.CompressionCommand); err == nil {
+			name = strings.TrimSuffix(name, codec.extension)
+		}
+	}
+	return name
+}
+
+func sendDownloadError(w http.ResponseWriter, err error) {
+	var invalid *DownloadRequestError
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Backup not found")
+	case errors.As(err, &invalid):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// DownloadBackup streams an artifact from where it is stored. The stored
+// artifact supports range requests, so interrupted downloads resume with
+// curl -C -, and its checksum is the ETag. ?decompress=true sends the dump
+// inside instead, as one stream without ranges. Encrypted artifacts are only
+// sent as stored, for the client to decrypt.
+func (h *BackupHandler) DownloadBackup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("decrypt") == "true" {
+		response.SendError(w, http.StatusBadRequest, "velld does not decrypt downloads; download the artifact and decrypt it locally with gpg --decrypt")
+		return
+	}
+	options := DownloadOptions{
+		Decompress: query.Get("decompress") == "true",
+	}
+
+	download, err := h.backupService.openBackupDownload(r.Context(), backupID, userID)
+	if err != nil {
+		sendDownloadError(w, err)
+		return
+	}
+	defer download.Close()
+	backup := download.backup
+
+	// Probing requests send nothing of the artifact and are not logged
+	if r.Method != http.MethodHead {
+		if err := h.backupService.recordArtifactAccess(newArtifactAccess(r, backupID, userID, AccessDownload)); err != nil {
+			sendAccessError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", downloadFileName(backup, options)))
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	if !options.transforms(backup) {
+		h.backupService.setSignatureHeaders(w, backup)
+		if backup.Checksum != nil {
+			w.Header().Set("ETag", `"`+*backup.Checksum+`"`)
+		}
+		http.ServeContent(w, r, "", download.modTime, download.content)
+		return
+	}
+
+	decompress, err := decompressedContent(r.Context(), download)
+	if err != nil {
+		sendDownloadError(w, err)
+		return
+	}
+
+	// The checksum and signature cover the stored artifact, not this body
+	w.Header().Set("Accept-Ranges", "none")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var stderr strings.Builder
+	decompress.Stdout = w
+	decompress.Stderr = &stderr
+	if err := decompress.Run(); err != nil {
+		slog.Warn("Download of backup stopped", "backup_id", backupID, "error", err, "stderr", strings.TrimSpace(stderr.String()))
+		// Aborting drops the connection, so the client sees a truncated
+		// transfer rather than a complete one
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,154 @@
+package backup
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// extraDumpArgs lists the options users may append to each dump tool. The
+// value reports whether the option takes a value, which must then be passed
+// as --option=value. Options that change the connection, the output location
+// or the dump format are deliberately missing.
+var extraDumpArgs = map[string]map[string]bool{
+	"postgresql": {
+		"--no-owner":                false,
+		"--no-privileges":           false,
+		"--no-acl":                  false,
+		"--no-comments":             false,
+		"--no-publications":         false,
+		"--no-subscriptions":        false,
+		"--no-security-labels":      false,
+		"--no-tablespaces":          false,
+		"--no-table-access-method":  false,
+		"--no-toast-compression":    false,
+		"--no-unlogged-table-data":  false,
+		"--no-sync":                 false,
+		"--clean":                   false,
+		"--if-exists":               false,
+		"--create":                  false,
+		"--data-only":               false,
+		"--schema-only":             false,
+		"--inserts":                 false,
+		"--column-inserts":          false,
+		"--on-conflict-do-nothing":  false,
+		"--quote-all-identifiers":   false,
+		"--serializable-deferrable": false,
+		"--load-via-partition-root": false,
+		"--disable-triggers":        false,
+		"--disable-dollar-quoting":  false,
+		"--enable-row-security":     false,
+		"--rows-per-insert":         true,
+		"--lock-wait-timeout":       true,
+		"--encoding":                true,
+		"--exclude-table-data":      true,
+		"--extra-float-digits":      true,
+		"--section":                 true,
+	},
+	"mysql":   mysqlDumpArgs,
+	"mariadb": mysqlDumpArgs,
+	"mongodb": {
+		"--forceTableScan":          false,
+		"--viewsAsCollections":      false,
+		"--readPreference":          true,
+		"--numParallelCollections":  true,
+		"--authenticationDatabase":  true,
+		"--authenticationMechanism": true,
+	},
+}
+
+// mysqlDumpArgs is shared by MySQL and MariaDB, which ship a compatible mysqldump
+var mysqlDumpArgs = map[string]bool{
+	"--single-transaction":    false,
+	"--quick":                 false,
+	"--skip-lock-tables":      false,
+	"--lock-tables":           false,
+	"--routines":              false,
+	"--triggers":              false,
+	"--skip-triggers":         false,
+	"--events":                false,
+	"--no-tablespaces":        false,
+	"--hex-blob":              false,
+	"--add-drop-table":        false,
+	"--skip-add-drop-table":   false,
+	"--add-drop-database":     false,
+	"--skip-add-locks":        false,
+	"--skip-comments":         false,
+	"--extended-insert":       false,
+	"--skip-extended-insert":  false,
+	"--complete-insert":       false,
+	"--insert-ignore":         false,
+	"--replace":               false,
+	"--no-create-info":        false,
+	"--no-create-db":          false,
+	"--no-data":               false,
+	"--compact":               false,
+	"--skip-tz-utc":           false,
+	"--order-by-primary":      false,
+	"--column-statistics":     true,
+	"--set-gtid-purged":       true,
+	"--default-character-set": true,
+	"--max-allowed-packet":    true,
+	"--net-buffer-length":     true,
+}
+
+// validateExtraDumpArgs checks the extra dump arguments submitted with a
+// schedule request against the allowlist of the connection's dump tool. An
+// empty string removes them.
+func (s *BackupService) validateExtraDumpArgs(connectionID string, args *string) (*string, error) {
+	if args == nil {
+		return nil, nil
+	}
+
+	fields := strings.Fields(*args)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	allowed, ok := extraDumpArgs[conn.Type]
+	if !ok {
+		return nil, fmt.Errorf("extra dump arguments are not supported for %s", conn.Type)
+	}
+
+	for _, arg := range fields {
+		name, value, hasValue := strings.Cut(arg, "=")
+		takesValue, ok := allowed[name]
+		if !ok {
+			return nil, fmt.Errorf("dump argument %q is not allowed for %s, allowed arguments: %s",
+				name, conn.Type, strings.Join(allowedDumpArgNames(allowed), ", "))
+		}
+		if takesValue && (!hasValue || value == "") {
+			return nil, fmt.Errorf("dump argument %s requires a value, use %s=<value>", name, name)
+		}
+		if !takesValue && hasValue {
+			return nil, fmt.Errorf("dump argument %s does not take a value", name)
+		}
+	}
+
+	normalized := strings.Join(fields, " ")
+	return &normalized, nil
+}
+
+func allowedDumpArgNames(allowed map[string]bool) []string {
+	names := make([]string, 0, len(allowed))
+	for name := range allowed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyExtraDumpArgs appends the schedule's extra arguments to the dump
+// command. They were validated when the schedule was saved.
+func applyExtraDumpArgs(cmd *exec.Cmd, schedule *BackupSchedule) {
+	if cmd == nil || schedule == nil || schedule.ExtraDumpArgs == nil {
+		return
+	}
+	cmd.Args = append(cmd.Args, strings.Fields(*schedule.ExtraDumpArgs)...)
+}
@@ -0,0 +1,162 @@
+package backup
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// DumpFilters limits a dump to a subset of a database. Tables also match
+// MongoDB collections. Postgres accepts pg_dump patterns such as "public.*";
+// MySQL and MongoDB need exact names.
+type DumpFilters struct {
+	IncludeSchemas []string `json:"include_schemas,omitempty"`
+	ExcludeSchemas []string `json:"exclude_schemas,omitempty"`
+	IncludeTables  []string `json:"include_tables,omitempty"`
+	ExcludeTables  []string `json:"exclude_tables,omitempty"`
+}
+
+func (f *DumpFilters) isEmpty() bool {
+	return len(f.IncludeSchemas) == 0 && len(f.ExcludeSchemas) == 0 &&
+		len(f.IncludeTables) == 0 && len(f.ExcludeTables) == 0
+}
+
+// Value stores the filters as JSON in a nullable text column
+func (f DumpFilters) Value() (driver.Value, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (f *DumpFilters) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	case []byte:
+		return json.Unmarshal(v, f)
+	default:
+		return fmt.Errorf("cannot scan %T into dump filters", src)
+	}
+}
+
+// validateDumpFilters checks the filters submitted with a schedule request
+// against the connection type. Empty filters clear them.
+func (s *BackupService) validateDumpFilters(connectionID string, filters *DumpFilters) (*DumpFilters, error) {
+	if filters == nil {
+		return nil, nil
+	}
+
+	normalized := &DumpFilters{
+		IncludeSchemas: normalizeFilterNames(filters.IncludeSchemas),
+		ExcludeSchemas: normalizeFilterNames(filters.ExcludeSchemas),
+		IncludeTables:  normalizeFilterNames(filters.IncludeTables),
+		ExcludeTables:  normalizeFilterNames(filters.ExcludeTables),
+	}
+	if normalized.isEmpty() {
+		return nil, nil
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	switch conn.Type {
+	case "postgresql":
+		return normalized, nil
+	case "mysql", "mariadb", "mongodb":
+	default:
+		return nil, fmt.Errorf("dump filters are not supported for %s", conn.Type)
+	}
+
+	if len(normalized.IncludeSchemas) > 0 || len(normalized.ExcludeSchemas) > 0 {
+		return nil, fmt.Errorf("schema filters are only supported for postgresql connections")
+	}
+
+	for _, name := range append(normalized.IncludeTables, normalized.ExcludeTables...) {
+		if strings.ContainsAny(name, "*?%") {
+			return nil, fmt.Errorf("table patterns are not supported for %s, use exact names: %s", conn.Type, name)
+		}
+	}
+
+	if conn.Type == "mongodb" {
+		if len(normalized.IncludeTables) > 1 {
+			return nil, fmt.Errorf("mongodump can only include a single collection")
+		}
+		if len(normalized.IncludeTables) > 0 && len(normalized.ExcludeTables) > 0 {
+			return nil, fmt.Errorf("mongodump cannot include and exclude collections at the same time")
+		}
+	}
+
+	return normalized, nil
+}
+
+func normalizeFilterNames(names []string) []string {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+	return normalized
+}
+
+func dumpFiltersFor(schedule *BackupSchedule) *DumpFilters {
+	if schedule == nil {
+		return nil
+	}
+	return schedule.DumpFilters
+}
+
+// applyDumpFilters appends the dump tool arguments for the filters. The
+// arguments are options or trailing table names, so they can follow the
+// arguments the dump command was built with.
+func applyDumpFilters(cmd *exec.Cmd, conn *connection.StoredConnection, filters *DumpFilters) {
+	if cmd == nil || filters == nil {
+		return
+	}
+
+	var args []string
+	switch conn.Type {
+	case "postgresql":
+		for _, schema := range filters.IncludeSchemas {
+			args = append(args, "-n", schema)
+		}
+		for _, schema := range filters.ExcludeSchemas {
+			args = append(args, "-N", schema)
+		}
+		for _, table := range filters.IncludeTables {
+			args = append(args, "-t", table)
+		}
+		for _, table := range filters.ExcludeTables {
+			args = append(args, "-T", table)
+		}
+	case "mysql", "mariadb":
+		for _, table := range filters.ExcludeTables {
+			args = append(args, fmt.Sprintf("--ignore-table=%s.%s", conn.DatabaseName, table))
+		}
+		// Table names after the database name restrict the dump to them
+		args = append(args, filters.IncludeTables...)
+	case "mongodb":
+		for _, collection := range filters.IncludeTables {
+			args = append(args, "--collection", collection)
+		}
+		for _, collection := range filters.ExcludeTables {
+			args = append(args, "--excludeCollection", collection)
+		}
+	}
+
+	cmd.Args = append(cmd.Args, args...)
+}
@@ -0,0 +1,79 @@
+package backup
+
+import (
+	"log/slog"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/events"
+)
+
+// publishEvent broadcasts an event about a connection to the event streams
+// of its owner and of the members of its team
+func (s *BackupService) publishEvent(conn *connection.StoredConnection, eventType events.Type, data map[string]interface{}) {
+	if s.eventService == nil {
+		return
+	}
+	for _, userID := range s.connStorage.UsersWithAccess(conn) {
+		s.eventService.Publish(userID, eventType, data)
+	}
+}
+
+// publishConnectionEvent broadcasts an event about a connection, naming
+// the connection in its data
+func (s *BackupService) publishConnectionEvent(connectionID string, eventType events.Type, data map[string]interface{}) {
+	if s.eventService == nil {
+		return
+	}
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		slog.Warn("Failed to get connection for event", "event", eventType, "connection_id", connectionID, "error", err)
+		return
+	}
+	data["connection_id"] = conn.ID
+	data["connection_name"] = conn.Name
+	s.publishEvent(conn, eventType, data)
+}
+
+func (s *BackupService) publishRunStarted(run *BackupRun) {
+	s.publishConnectionEvent(run.ConnectionID, events.TypeBackupStarted, map[string]interface{}{
+		"run_id":      run.ID,
+		"schedule_id": run.ScheduleID,
+		"trigger":     run.Trigger,
+		"started_at":  run.StartedTime,
+	})
+}
+
+func (s *BackupService) publishRunFinished(run *BackupRun) {
+	s.publishConnectionEvent(run.ConnectionID, events.TypeBackupFinished, map[string]interface{}{
+		"run_id":         run.ID,
+		"schedule_id":    run.ScheduleID,
+		"trigger":        run.Trigger,
+		"status":         run.Status,
+		"total_jobs":     run.TotalJobs,
+		"succeeded_jobs": run.SucceededJobs,
+		"failed_jobs":    run.FailedJobs,
+		"error":          run.Error,
+		"started_at":     run.StartedTime,
+		"completed_at":   run.CompletedTime,
+	})
+}
+
+// publishRestoreEvent broadcasts the start or end of a restore into conn
+func (s *BackupService) publishRestoreEvent(eventType events.Type, conn *connection.StoredConnection, job RestoreJob) {
+	data := map[string]interface{}{
+		"restore_id":      job.ID,
+		"backup_id":       job.BackupID,
+		"connection_id":   conn.ID,
+		"connection_name": conn.Name,
+		"database_name":   job.Database,
+		"started_at":      job.StartedAt,
+	}
+	if eventType == events.TypeRestoreFinished {
+		data["status"] = job.Status
+		data["finished_at"] = job.FinishedAt
+		if job.Error != "" {
+			data["error"] = job.Error
+		}
+	}
+	s.publishEvent(conn, eventType, data)
+}
@@ -0,0 +1,816 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Artifact export states
+const (
+	ExportStatusPending     = "pending"
+	ExportStatusRunning     = "running"
+	ExportStatusInterrupted = "interrupted"
+	ExportStatusCompleted   = "completed"
+	ExportStatusFailed      = "failed"
+	ExportStatusCancelled   = "cancelled"
+)
+
+// States of the artifacts in an export
+const (
+	ExportItemPending  = "pending"
+	ExportItemExported = "exported"
+	ExportItemFailed   = "failed"
+)
+
+// Kinds of export destination
+const (
+	ExportDestinationDirectory = "directory"
+	ExportDestinationS3        = "s3"
+)
+
+const (
+	// exportManifestName lists the exported artifacts with their metadata
+	exportManifestName = "export-manifest.json"
+	// exportChecksumsName lists the artifacts in sha256sum format, so the
+	// recipient can check them with `sha256sum -c`
+	exportChecksumsName = "SHA256SUMS"
+	// exportFolderPrefix names the folder an export writes to at its
+	// destination, followed by the export ID
+	exportFolderPrefix = "velld-export-"
+)
+
+// ExportDestination is where an export writes the artifacts: a directory on
+// the velld server, such as a mounted volume, or an S3 bucket other than the
+// owner's own
+type ExportDestination struct {
+	Type string               `json:"type"`
+	Path string               `json:"path,omitempty"`
+	S3   *ExportS3Destination `json:"s3,omitempty"`
+}
+
+type ExportS3Destination struct {
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket"`
+	AccessKey string `json:"access_key"`
+	// SecretKey is stored encrypted and never returned
+	SecretKey  string `json:"secret_key,omitempty"`
+	UseSSL     bool   `json:"use_ssl"`
+	PathPrefix string `json:"path_prefix,omitempty"`
+}
+
+// Value stores the destination as JSON in a text column
+func (d ExportDestination) Value() (driver.Value, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (d *ExportDestination) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), d)
+	case []byte:
+		return json.Unmarshal(v, d)
+	default:
+		return fmt.Errorf("cannot scan %T into export destination", src)
+	}
+}
+
+// describe names the destination for the access log, without credentials
+func (d *ExportDestination) describe() string {
+	if d.Type == ExportDestinationS3 && d.S3 != nil {
+		return fmt.Sprintf("s3://%s/%s", d.S3.Bucket, strings.Trim(d.S3.PathPrefix, "/"))
+	}
+	return d.Path
+}
+
+// ExportFilter narrows the artifacts of a connection an export covers. An
+// empty filter exports every completed backup.
+type ExportFilter struct {
+	From         *time.Time `json:"from,omitempty"`
+	To           *time.Time `json:"to,omitempty"`
+	DatabaseName string     `json:"database_name,omitempty"`
+	BackupIDs    []string   `json:"backup_ids,omitempty"`
+}
+
+// Value stores the filter as JSON in a nullable text column
+func (f ExportFilter) Value() (driver.Value, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (f *ExportFilter) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	case []byte:
+		return json.Unmarshal(v, f)
+	default:
+		return fmt.Errorf("cannot scan %T into export filter", src)
+	}
+}
+
+func (f *ExportFilter) matches(backup *Backup) bool {
+	if f == nil {
+		return true
+	}
+	if f.From != nil && backup.StartedTime.Before(*f.From) {
+		return false
+	}
+	if f.To != nil && backup.StartedTime.After(*f.To) {
+		return false
+	}
+	if f.DatabaseName != "" && (backup.DatabaseName == nil || *backup.DatabaseName != f.DatabaseName) {
+		return false
+	}
+	if len(f.BackupIDs) > 0 {
+		for _, id := range f.BackupIDs {
+			if id == backup.ID.String() {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+type ArtifactExportRequest struct {
+	ConnectionID string            `json:"connection_id"`
+	Destination  ExportDestination `json:"destination"`
+	Filter       *ExportFilter     `json:"filter,omitempty"`
+	// BandwidthLimitKBps caps the export on top of
+	// BACKUP_BANDWIDTH_LIMIT_KBPS. 0 is unlimited.
+	BandwidthLimitKBps int `json:"bandwidth_limit_kbps"`
+}
+
+// ArtifactExport copies the artifacts of a connection to an external
+// destination in one job, for offboarding a project or handing data over.
+// Every artifact is hashed as it is copied and checked against its recorded
+// checksum. Exported artifacts are skipped when an interrupted or failed
+// export is resumed.
+type ArtifactExport struct {
+	ID                 string            `json:"id"`
+	ConnectionID       string            `json:"connection_id"`
+	Destination        ExportDestination `json:"destination"`
+	Filter             *ExportFilter     `json:"filter,omitempty"`
+	BandwidthLimitKBps int               `json:"bandwidth_limit_kbps"`
+	Status             string            `json:"status"`
+	Error              *string           `json:"error,omitempty"`
+	Attempts           int               `json:"attempts"`
+	CreatedBy          uuid.UUID         `json:"created_by"`
+	CreatedAt          time.Time         `json:"created_at"`
+	UpdatedAt          time.Time         `json:"updated_at"`
+	CompletedAt        *time.Time        `json:"completed_at,omitempty"`
+	// Progress over the items, filled in when the export is read
+	TotalItems               int                   `json:"total_items"`
+	ExportedItems            int                   `json:"exported_items"`
+	FailedItems              int                   `json:"failed_items"`
+	TotalBytes               int64                 `json:"total_bytes"`
+	ExportedBytes            int64                 `json:"exported_bytes"`
+	ThroughputBytesPerSecond float64               `json:"throughput_bytes_per_second"`
+	Items                    []*ArtifactExportItem `json:"items,omitempty"`
+}
+
+// ArtifactExportItem is one artifact of an export
+type ArtifactExportItem struct {
+	BackupID string `json:"backup_id"`
+	FileName string `json:"file_name"`
+	Status   string `json:"status"`
+	Size     int64  `json:"size"`
+	// Checksum is the SHA-256 of the artifact as it was copied
+	Checksum   *string    `json:"checksum,omitempty"`
+	Location   *string    `json:"location,omitempty"`
+	Error      *string    `json:"error,omitempty"`
+	ExportedAt *time.Time `json:"exported_at,omitempty"`
+}
+
+// ExportRequestError rejects an export that cannot be started
+type ExportRequestError struct {
+	Reason string
+}
+
+func (e *ExportRequestError) Error() string {
+	return e.Reason
+}
+
+// exportWriter writes the files of an export to its destination and returns
+// where each one ended up
+type exportWriter interface {
+	write(name string, r io.Reader, size int64) (string, error)
+}
+
+// directoryExportWriter writes through a partial file, so a resumed export
+// never mistakes a cut-off copy for a finished one
+type directoryExportWriter struct {
+	dir string
+}
+
+func (w *directoryExportWriter) write(name string, r io.Reader, size int64) (string, error) {
+	target := filepath.Join(w.dir, name)
+	partial := target + ".partial"
+
+	file, err := os.Create(partial)
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", partial, err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(partial)
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+
+	if err := os.Rename(partial, target); err != nil {
+		return "", fmt.Errorf("failed to move %s into place: %v", target, err)
+	}
+	return target, nil
+}
+
+type s3ExportWriter struct {
+	storage   *S3Storage
+	subfolder string
+}
+
+func (w *s3ExportWriter) write(name string, r io.Reader, size int64) (string, error) {
+	return w.storage.UploadReaderWithPath(context.Background(), r, size, name, w.subfolder)
+}
+
+// openExportDestination checks the destination of an export and returns a
+// writer for it. The S3 secret key is given in plain text.
+func openExportDestination(exportID string, destination *ExportDestination) (exportWriter, error) {
+	folder := exportFolderPrefix + exportID
+
+	switch destination.Type {
+	case ExportDestinationDirectory:
+		if !filepath.IsAbs(destination.Path) {
+			return nil, &ExportRequestError{Reason: "the destination path must be an absolute directory on the server"}
+		}
+		dir := filepath.Join(destination.Path, folder)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, &ExportRequestError{Reason: fmt.Sprintf("cannot create destination directory: %v", err)}
+		}
+		return &directoryExportWriter{dir: dir}, nil
+	case ExportDestinationS3:
+		s3 := destination.S3
+		if s3 == nil || s3.Endpoint == "" || s3.Bucket == "" || s3.AccessKey == "" || s3.SecretKey == "" {
+			return nil, &ExportRequestError{Reason: "S3 destinations need an endpoint, bucket, access key and secret key"}
+		}
+		region := s3.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		storage, err := NewS3Storage(S3Config{
+			Endpoint:   s3.Endpoint,
+			Region:     region,
+			Bucket:     s3.Bucket,
+			AccessKey:  s3.AccessKey,
+			SecretKey:  s3.SecretKey,
+			UseSSL:     s3.UseSSL,
+			PathPrefix: s3.PathPrefix,
+		})
+		if err != nil {
+			return nil, &ExportRequestError{Reason: fmt.Sprintf("invalid S3 destination: %v", err)}
+		}
+		if err := storage.TestConnection(context.Background()); err != nil {
+			return nil, &ExportRequestError{Reason: fmt.Sprintf("cannot reach S3 destination: %v", err)}
+		}
+		return &s3ExportWriter{storage: storage, subfolder: folder}, nil
+	default:
+		return nil, &ExportRequestError{Reason: "destination type must be 'directory' or 's3'"}
+	}
+}
+
+// CreateArtifactExport saves an export of the connection's completed backups
+// that match the filter. It is started with startArtifactExport once the
+// accesses are recorded.
+func (s *BackupService) CreateArtifactExport(req *ArtifactExportRequest, adminID uuid.UUID) (*ArtifactExport, error) {
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateBandwidthLimit(&req.BandwidthLimitKBps); err != nil {
+		return nil, &ExportRequestError{Reason: err.Error()}
+	}
+
+	export := &ArtifactExport{
+		ID:                 uuid.New().String(),
+		ConnectionID:       conn.ID,
+		Destination:        req.Destination,
+		Filter:             req.Filter,
+		BandwidthLimitKBps: req.BandwidthLimitKBps,
+		Status:             ExportStatusPending,
+		CreatedBy:          adminID,
+		CreatedAt:          time.Now(),
+		UpdatedAt:          time.Now(),
+	}
+
+	if _, err := openExportDestination(export.ID, &export.Destination); err != nil {
+		return nil, err
+	}
+	if s3 := export.Destination.S3; s3 != nil {
+		encrypted, err := s.cryptoService.Encrypt(s3.SecretKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt S3 secret key: %v", err)
+		}
+		stored := *s3
+		stored.SecretKey = encrypted
+		export.Destination.S3 = &stored
+	}
+
+	backups, err := s.backupRepo.GetBackupsByConnectionID(conn.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backups: %v", err)
+	}
+	// Oldest first, so a cut-off export holds a contiguous history
+	for i := len(backups) - 1; i >= 0; i-- {
+		backup := backups[i]
+		if backup.Status != "completed" || !req.Filter.matches(backup) {
+			continue
+		}
+		export.Items = append(export.Items, &ArtifactExportItem{
+			BackupID: backup.ID.String(),
+			FileName: filepath.Base(backup.Path),
+			Status:   ExportItemPending,
+			Size:     backup.Size,
+		})
+	}
+	if len(export.Items) == 0 {
+		return nil, &ExportRequestError{Reason: "no completed backups match the filter"}
+	}
+
+	if err := s.backupRepo.CreateArtifactExport(export); err != nil {
+		return nil, fmt.Errorf("failed to save export: %v", err)
+	}
+
+	return s.presentArtifactExport(export), nil
+}
+
+// startArtifactExport runs an export in the background
+func (s *BackupService) startArtifactExport(id string) {
+	go func() {
+		if err := s.runArtifactExport(id); err != nil {
+			slog.Error("Failed to export artifacts", "export_id", id, "error", err)
+		}
+	}()
+}
+
+// runArtifactExport copies the artifacts of an export that are not exported
+// yet, then writes the export's manifest and checksums
+func (s *BackupService) runArtifactExport(id string) error {
+	cancelled := &atomic.Bool{}
+	if _, running := s.exportJobs.LoadOrStore(id, cancelled); running {
+		return fmt.Errorf("export is already running")
+	}
+	defer s.exportJobs.Delete(id)
+
+	export, err := s.backupRepo.GetArtifactExport(id)
+	if err != nil {
+		return err
+	}
+	if export.Status == ExportStatusCompleted || export.Status == ExportStatusCancelled {
+		return fmt.Errorf("export is %s", export.Status)
+	}
+
+	fail := func(cause error) error {
+		message := cause.Error()
+		export.Status = ExportStatusInterrupted
+		export.Error = &message
+		if err := s.backupRepo.UpdateArtifactExport(export); err != nil {
+			slog.Warn("Failed to update export", "export_id", id, "error", err)
+		}
+		return cause
+	}
+
+	conn, err := s.connStorage.GetConnection(export.ConnectionID)
+	if err != nil {
+		return fail(fmt.Errorf("failed to get connection: %v", err))
+	}
+
+	destination := export.Destination
+	if s3 := destination.S3; s3 != nil {
+		secretKey, err := s.cryptoService.Decrypt(s3.SecretKey)
+		if err != nil {
+			return fail(fmt.Errorf("failed to decrypt S3 secret key: %v", err))
+		}
+		plain := *s3
+		plain.SecretKey = secretKey
+		destination.S3 = &plain
+	}
+	writer, err := openExportDestination(export.ID, &destination)
+	if err != nil {
+		return fail(err)
+	}
+
+	export.Status = ExportStatusRunning
+	export.Attempts++
+	export.Error = nil
+	if err := s.backupRepo.UpdateArtifactExport(export); err != nil {
+		return fmt.Errorf("failed to update export: %v", err)
+	}
+
+	t := s.registerTransfer(exportTransferKey(id), "", conn.ID, TransferKindExport, export.BandwidthLimitKBps)
+	defer s.endTransfer(t)
+
+	for _, item := range export.Items {
+		if item.Status == ExportItemExported {
+			continue
+		}
+		if cancelled.Load() {
+			export.Status = ExportStatusCancelled
+			return s.backupRepo.UpdateArtifactExport(export)
+		}
+
+		s.exportArtifact(conn, item, writer, t)
+		if err := s.backupRepo.UpdateArtifactExportItem(id, item); err != nil {
+			return fail(fmt.Errorf("failed to save export progress: %v", err))
+		}
+	}
+
+	if err := s.writeExportManifest(export, conn, writer); err != nil {
+		return fail(err)
+	}
+
+	failed := 0
+	for _, item := range export.Items {
+		if item.Status == ExportItemFailed {
+			failed++
+		}
+	}
+	now := time.Now()
+	export.CompletedAt = &now
+	export.Status = ExportStatusCompleted
+	if failed > 0 {
+		message := fmt.Sprintf("%d of %d artifacts failed to export and are retried when the export is resumed", failed, len(export.Items))
+		export.Status = ExportStatusFailed
+		export.Error = &message
+	}
+	if err := s.backupRepo.UpdateArtifactExport(export); err != nil {
+		return fmt.Errorf("failed to update export: %v", err)
+	}
+
+	slog.Info("Export of connection finished", "export_id", id, "connection_id", conn.ID, "status", export.Status)
+	return nil
+}
+
+// exportArtifact copies one artifact within the export's bandwidth limits,
+// hashing it on the way. The outcome is recorded on the item.
+func (s *BackupService) exportArtifact(conn *connection.StoredConnection, item *ArtifactExportItem, writer exportWriter, t *transfer) {
+	item.Error = nil
+	fail := func(cause error) {
+		message := cause.Error()
+		item.Status = ExportItemFailed
+		item.Error = &message
+	}
+
+	backup, err := s.backupRepo.GetBackup(item.BackupID)
+	if err == sql.ErrNoRows {
+		fail(fmt.Errorf("backup was deleted"))
+		return
+	}
+	if err != nil {
+		fail(fmt.Errorf("failed to get backup: %v", err))
+		return
+	}
+
+	path, isTemp, err := s.ensureBackupFileAvailable(backup, conn.UserID)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if isTemp {
+		defer os.Remove(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		fail(fmt.Errorf("failed to open artifact: %v", err))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		fail(fmt.Errorf("failed to stat artifact: %v", err))
+		return
+	}
+
+	t.setBackup(item.BackupID)
+	hash := sha256.New()
+	location, err := writer.write(item.FileName, t.reader(io.TeeReader(file, hash)), info.Size())
+	if err != nil {
+		fail(fmt.Errorf("failed to write artifact: %v", err))
+		return
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if backup.Checksum != nil && *backup.Checksum != checksum {
+		fail(fmt.Errorf("checksum mismatch: the artifact hashes to %s but %s was recorded", checksum, *backup.Checksum))
+		return
+	}
+
+	now := time.Now()
+	item.Status = ExportItemExported
+	item.Size = info.Size()
+	item.Checksum = &checksum
+	item.Location = &location
+	item.ExportedAt = &now
+}
+
+// exportManifestArtifact describes an exported artifact in the manifest
+type exportManifestArtifact struct {
+	BackupID     string          `json:"backup_id"`
+	FileName     string          `json:"file_name"`
+	DatabaseName *string         `json:"database_name,omitempty"`
+	StartedTime  time.Time       `json:"started_time"`
+	Size         int64           `json:"size"`
+	SHA256       string          `json:"sha256"`
+	Manifest     *BackupManifest `json:"manifest,omitempty"`
+}
+
+// writeExportManifest writes the export's manifest and the sha256sum list of
+// the artifacts exported so far next to them
+func (s *BackupService) writeExportManifest(export *ArtifactExport, conn *connection.StoredConnection, writer exportWriter) error {
+	manifest := struct {
+		ExportID       string                   `json:"export_id"`
+		ConnectionID   string                   `json:"connection_id"`
+		ConnectionName string                   `json:"connection_name"`
+		DatabaseType   string                   `json:"database_type"`
+		ExportedAt     time.Time                `json:"exported_at"`
+		Artifacts      []exportManifestArtifact `json:"artifacts"`
+	}{
+		ExportID:       export.ID,
+		ConnectionID:   conn.ID,
+		ConnectionName: conn.Name,
+		DatabaseType:   conn.Type,
+		ExportedAt:     time.Now(),
+		Artifacts:      []exportManifestArtifact{},
+	}
+
+	var checksums strings.Builder
+	for _, item := range export.Items {
+		if item.Status != ExportItemExported || item.Checksum == nil {
+			continue
+		}
+		artifact := exportManifestArtifact{
+			BackupID: item.BackupID,
+			FileName: item.FileName,
+			Size:     item.Size,
+			SHA256:   *item.Checksum,
+		}
+		if backup, err := s.backupRepo.GetBackup(item.BackupID); err == nil {
+			artifact.DatabaseName = backup.DatabaseName
+			artifact.StartedTime = backup.StartedTime
+			artifact.Manifest = backup.Manifest
+		}
+		manifest.Artifacts = append(manifest.Artifacts, artifact)
+		checksums.WriteString(checksumLine(*item.Checksum, item.FileName))
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode export manifest: %v", err)
+	}
+	if _, err := writer.write(exportManifestName, strings.NewReader(string(data)), int64(len(data))); err != nil {
+		return fmt.Errorf("failed to write export manifest: %v", err)
+	}
+	if _, err := writer.write(exportChecksumsName, strings.NewReader(checksums.String()), int64(checksums.Len())); err != nil {
+		return fmt.Errorf("failed to write export checksums: %v", err)
+	}
+	return nil
+}
+
+func exportTransferKey(exportID string) string {
+	return "export:" + exportID
+}
+
+// presentArtifactExport fills in the progress of an export and hides the
+// destination's secret key
+func (s *BackupService) presentArtifactExport(export *ArtifactExport) *ArtifactExport {
+	if s3 := export.Destination.S3; s3 != nil {
+		hidden := *s3
+		hidden.SecretKey = ""
+		export.Destination.S3 = &hidden
+	}
+
+	export.TotalItems = len(export.Items)
+	export.ExportedItems, export.FailedItems = 0, 0
+	export.TotalBytes, export.ExportedBytes = 0, 0
+	for _, item := range export.Items {
+		export.TotalBytes += item.Size
+		switch item.Status {
+		case ExportItemExported:
+			export.ExportedItems++
+			export.ExportedBytes += item.Size
+		case ExportItemFailed:
+			export.FailedItems++
+		}
+	}
+	export.ThroughputBytesPerSecond = s.transferThroughput(exportTransferKey(export.ID))
+	return export
+}
+
+func (s *BackupService) GetArtifactExport(id string) (*ArtifactExport, error) {
+	export, err := s.backupRepo.GetArtifactExport(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.presentArtifactExport(export), nil
+}
+
+// GetArtifactExports lists the exports with their progress, leaving out the
+// items
+func (s *BackupService) GetArtifactExports() ([]*ArtifactExport, error) {
+	listed, err := s.backupRepo.GetArtifactExports()
+	if err != nil {
+		return nil, err
+	}
+
+	exports := make([]*ArtifactExport, 0, len(listed))
+	for _, e := range listed {
+		export, err := s.backupRepo.GetArtifactExport(e.ID)
+		if err != nil {
+			return nil, err
+		}
+		s.presentArtifactExport(export)
+		export.Items = nil
+		exports = append(exports, export)
+	}
+	return exports, nil
+}
+
+// ResumeArtifactExport restarts an interrupted or failed export. Artifacts
+// already exported are skipped.
+func (s *BackupService) ResumeArtifactExport(id string) (*ArtifactExport, error) {
+	export, err := s.backupRepo.GetArtifactExport(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, running := s.exportJobs.Load(id); running {
+		return nil, &ExportRequestError{Reason: "export is already running"}
+	}
+	if export.Status != ExportStatusInterrupted && export.Status != ExportStatusFailed {
+		return nil, &ExportRequestError{Reason: fmt.Sprintf("a %s export cannot be resumed", export.Status)}
+	}
+
+	s.startArtifactExport(id)
+	return s.presentArtifactExport(export), nil
+}
+
+// CancelArtifactExport stops an export after the artifact being copied. A
+// cancelled export cannot be resumed.
+func (s *BackupService) CancelArtifactExport(id string) error {
+	export, err := s.backupRepo.GetArtifactExport(id)
+	if err != nil {
+		return err
+	}
+
+	if job, running := s.exportJobs.Load(id); running {
+		job.(*atomic.Bool).Store(true)
+		return nil
+	}
+	if export.Status == ExportStatusCompleted || export.Status == ExportStatusCancelled {
+		return &ExportRequestError{Reason: fmt.Sprintf("a %s export cannot be cancelled", export.Status)}
+	}
+
+	export.Status = ExportStatusCancelled
+	return s.backupRepo.UpdateArtifactExport(export)
+}
+
+// resumeArtifactExports picks up the exports a restart cut off
+func (s *BackupService) resumeArtifactExports() {
+	exports, err := s.backupRepo.GetArtifactExports(ExportStatusPending, ExportStatusRunning)
+	if err != nil {
+		slog.Error("Failed to get unfinished exports", "error", err)
+		return
+	}
+
+	for _, export := range exports {
+		slog.Info("Resuming export of connection", "export_id", export.ID, "connection_id", export.ConnectionID)
+		if err := s.runArtifactExport(export.ID); err != nil {
+			slog.Warn("Failed to resume export", "export_id", export.ID, "error", err)
+		}
+	}
+}
+
+func sendExportError(w http.ResponseWriter, err error) {
+	var invalid *ExportRequestError
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Export or connection not found")
+	case errors.As(err, &invalid):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// CreateArtifactExport records an access for every artifact of the export
+// before it starts copying them
+func (h *BackupHandler) CreateArtifactExport(w http.ResponseWriter, r *http.Request) {
+	var req ArtifactExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.ConnectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	export, err := h.backupService.CreateArtifactExport(&req, userID)
+	if err != nil {
+		sendExportError(w, err)
+		return
+	}
+
+	detail := fmt.Sprintf("export %s to %s", export.ID, export.Destination.describe())
+	for _, item := range export.Items {
+		access := newArtifactAccess(r, item.BackupID, userID, AccessExport)
+		access.Detail = &detail
+		if err := h.backupService.recordArtifactAccess(access); err != nil {
+			h.backupService.CancelArtifactExport(export.ID)
+			sendAccessError(w, err)
+			return
+		}
+	}
+
+	h.backupService.startArtifactExport(export.ID)
+	response.SendSuccess(w, "Export started", export)
+}
+
+func (h *BackupHandler) GetArtifactExports(w http.ResponseWriter, r *http.Request) {
+	exports, err := h.backupService.GetArtifactExports()
+	if err != nil {
+		sendExportError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Exports retrieved successfully", exports)
+}
+
+func (h *BackupHandler) GetArtifactExport(w http.ResponseWriter, r *http.Request) {
+	export, err := h.backupService.GetArtifactExport(mux.Vars(r)["id"])
+	if err != nil {
+		sendExportError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Export retrieved successfully", export)
+}
+
+func (h *BackupHandler) ResumeArtifactExport(w http.ResponseWriter, r *http.Request) {
+	export, err := h.backupService.ResumeArtifactExport(mux.Vars(r)["id"])
+	if err != nil {
+		sendExportError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Export resumed", export)
+}
+
+func (h *BackupHandler) CancelArtifactExport(w http.ResponseWriter, r *http.Request) {
+	if err := h.backupService.CancelArtifactExport(mux.Vars(r)["id"]); err != nil {
+		sendExportError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Export cancelled", nil)
+}
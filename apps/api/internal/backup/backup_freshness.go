@@ -0,0 +1,142 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Freshness check states
+const (
+	FreshnessStatusOK       = "ok"
+	FreshnessStatusViolated = "violated"
+)
+
+func validateRPO(minutes *int) error {
+	if minutes != nil && *minutes < 0 {
+		return fmt.Errorf("rpo cannot be negative")
+	}
+	return nil
+}
+
+// defaultRPO reads BACKUP_RPO_MINUTES, the recovery point objective of
+// schedules that do not set their own. Unset means no objective.
+func defaultRPO() time.Duration {
+	value := strings.TrimSpace(os.Getenv("BACKUP_RPO_MINUTES"))
+	if value == "" {
+		return 0
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		slog.Warn("Invalid BACKUP_RPO_MINUTES, freshness is not checked against a default", "value", value)
+		return 0
+	}
+	return time.Duration(parsed) * time.Minute
+}
+
+func rpoFor(schedule *BackupSchedule) time.Duration {
+	if schedule.RPOMinutes > 0 {
+		return time.Duration(schedule.RPOMinutes) * time.Minute
+	}
+	return defaultRPO()
+}
+
+// GetBackupFreshness reports, for every connection with an enabled schedule,
+// how old its newest successful backup is and whether that breaks its RPO.
+// A connection with an RPO and no successful backup is a violation, unless its
+// schedule is paused. An empty connectionID checks all connections.
+func (s *BackupService) GetBackupFreshness(connectionID string) (*BackupFreshness, error) {
+	schedules, err := s.backupRepo.GetAllActiveSchedules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active schedules: %v", err)
+	}
+
+	now := time.Now()
+	freshness := &BackupFreshness{
+		Status:      FreshnessStatusOK,
+		CheckedAt:   now,
+		Connections: []*ConnectionFreshness{},
+	}
+
+	seen := make(map[string]bool)
+	for _, schedule := range schedules {
+		if seen[schedule.ConnectionID] || (connectionID != "" && schedule.ConnectionID != connectionID) {
+			continue
+		}
+		seen[schedule.ConnectionID] = true
+
+		conn, err := s.connStorage.GetConnection(schedule.ConnectionID)
+		if err != nil {
+			slog.Warn("Failed to get connection for freshness check", "connection_id", schedule.ConnectionID, "error", err)
+			continue
+		}
+
+		entry := &ConnectionFreshness{
+			ConnectionID: conn.ID,
+			Name:         conn.Name,
+			Type:         conn.Type,
+		}
+
+		backup, err := s.backupRepo.GetLatestCompletedBackup(conn.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to get latest backup of connection %s: %v", conn.ID, err)
+		}
+		if backup != nil {
+			lastBackupAt := backup.CreatedAt
+			if backup.CompletedTime != nil {
+				lastBackupAt = *backup.CompletedTime
+			}
+			age := int64(now.Sub(lastBackupAt).Seconds())
+			entry.LastBackupAt = &lastBackupAt
+			entry.AgeSeconds = &age
+		}
+
+		if rpo := rpoFor(schedule); rpo > 0 {
+			rpoSeconds := int64(rpo.Seconds())
+			entry.RPOSeconds = &rpoSeconds
+			entry.Violated = !schedule.Paused && (entry.AgeSeconds == nil || *entry.AgeSeconds > rpoSeconds)
+		}
+		entry.Paused = schedule.Paused
+
+		if entry.Violated {
+			freshness.Violations++
+			freshness.Status = FreshnessStatusViolated
+		}
+		freshness.Connections = append(freshness.Connections, entry)
+	}
+
+	if connectionID != "" && len(freshness.Connections) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return freshness, nil
+}
+
+// GetBackupFreshness answers with 503 when any connection breaks its RPO, so
+// HTTP checks can alert on the status code alone. ?connection_id= checks a
+// single connection.
+func (h *BackupHandler) GetBackupFreshness(w http.ResponseWriter, r *http.Request) {
+	freshness, err := h.backupService.GetBackupFreshness(r.URL.Query().Get("connection_id"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "connection has no enabled schedule", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if freshness.Status == FreshnessStatusViolated {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(freshness)
+}
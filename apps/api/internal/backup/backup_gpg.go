@@ -0,0 +1,260 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/google/uuid"
+)
+
+// parseGPGPublicKey parses an ASCII-armored public key and makes sure it can be
+// used to encrypt backups. Keys that contain private material are rejected so
+// velld never ends up holding anything that could decrypt an artifact.
+func parseGPGPublicKey(armoredKey string) (openpgp.EntityList, error) {
+	block, err := armor.Decode(strings.NewReader(armoredKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GPG public key: %v", err)
+	}
+
+	if block.Type != openpgp.PublicKeyType {
+		return nil, fmt.Errorf("invalid GPG public key: expected %q block, got %q", openpgp.PublicKeyType, block.Type)
+	}
+
+	entities, err := openpgp.ReadKeyRing(block.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GPG public key: %v", err)
+	}
+
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("invalid GPG public key: no keys found")
+	}
+
+	for _, entity := range entities {
+		if entity.PrivateKey != nil {
+			return nil, fmt.Errorf("GPG key contains private key material, upload the public key only")
+		}
+		for _, subkey := range entity.Subkeys {
+			if subkey.PrivateKey != nil {
+				return nil, fmt.Errorf("GPG key contains private key material, upload the public key only")
+			}
+		}
+	}
+
+	// Make sure at least one usable encryption key is present
+	w, err := openpgp.Encrypt(io.Discard, entities, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("GPG key cannot be used for encryption: %v", err)
+	}
+	w.Close()
+
+	return entities, nil
+}
+
+// gpgKeyFingerprint returns the hex fingerprint of the primary key
+func gpgKeyFingerprint(entities openpgp.EntityList) string {
+	return strings.ToUpper(fmt.Sprintf("%x", entities[0].PrimaryKey.Fingerprint))
+}
+
+// encryptBackupIfConfigured encrypts the backup artifact for the schedule's GPG
+// public key. The plaintext dump is removed once the encrypted copy is written,
+// and also when encryption fails, so a failed run never leaves it on disk.
+func (s *BackupService) encryptBackupIfConfigured(backup *Backup, schedule *BackupSchedule) error {
+	if schedule == nil || schedule.GPGPublicKey == nil || *schedule.GPGPublicKey == "" {
+		return nil
+	}
+
+	entities, err := parseGPGPublicKey(*schedule.GPGPublicKey)
+	if err != nil {
+		s.removePlaintextBackup(backup)
+		return err
+	}
+
+	encryptedPath := backup.Path + ".gpg"
+	if err := encryptFileForRecipients(backup.Path, encryptedPath, entities); err != nil {
+		os.Remove(encryptedPath)
+		s.removePlaintextBackup(backup)
+		return fmt.Errorf("failed to encrypt backup: %v", err)
+	}
+
+	if err := os.Remove(backup.Path); err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to remove unencrypted backup file", "path", backup.Path, "error", err)
+	}
+
+	fileInfo, err := os.Stat(encryptedPath)
+	if err != nil {
+		return fmt.Errorf("failed to get encrypted backup file info: %v", err)
+	}
+
+	fingerprint := gpgKeyFingerprint(entities)
+	backup.Path = encryptedPath
+	backup.Size = fileInfo.Size()
+	backup.EncryptionKeyFingerprint = &fingerprint
+
+	return nil
+}
+
+// removePlaintextBackup deletes the unencrypted artifact of a backup whose
+// encryption failed
+func (s *BackupService) removePlaintextBackup(backup *Backup) {
+	if err := os.Remove(backup.Path); err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to remove unencrypted backup file", "path", backup.Path, "error", err)
+	}
+}
+
+func encryptFileForRecipients(srcPath, dstPath string, entities openpgp.EntityList) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	hints := &openpgp.FileHints{IsBinary: true}
+	config := &packet.Config{DefaultCompressionAlgo: packet.CompressionZLIB}
+
+	plaintext, err := openpgp.Encrypt(dst, entities, nil, hints, config)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(plaintext, src); err != nil {
+		plaintext.Close()
+		return err
+	}
+
+	if err := plaintext.Close(); err != nil {
+		return err
+	}
+
+	return dst.Sync()
+}
+
+// verifyGPGRecipients checks that an encrypted artifact is addressed to the
+// given key without decrypting it, by reading the session key packets.
+func verifyGPGRecipients(path string, entities openpgp.EntityList) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	keyIDs := make(map[uint64]bool)
+	for _, entity := range entities {
+		keyIDs[entity.PrimaryKey.KeyId] = true
+		for _, subkey := range entity.Subkeys {
+			keyIDs[subkey.PublicKey.KeyId] = true
+		}
+	}
+
+	packets := packet.NewReader(file)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read encrypted backup: %v", err)
+		}
+
+		switch pk := p.(type) {
+		case *packet.EncryptedKey:
+			if keyIDs[pk.KeyId] {
+				return nil
+			}
+		case *packet.SymmetricallyEncrypted:
+			// Session key packets always precede the encrypted data
+			return fmt.Errorf("backup is not encrypted for the configured GPG key")
+		}
+	}
+
+	return fmt.Errorf("backup is not encrypted for the configured GPG key")
+}
+
+// isGPGEncrypted reports whether the artifact looks like an OpenPGP message
+func isGPGEncrypted(backup *Backup) bool {
+	return backup.EncryptionKeyFingerprint != nil && *backup.EncryptionKeyFingerprint != ""
+}
+
+// validateScheduleGPGKey validates a key submitted with a schedule request.
+// An empty key clears the schedule's encryption setting.
+func validateScheduleGPGKey(key *string) (*string, error) {
+	if key == nil {
+		return nil, nil
+	}
+
+	trimmed := strings.TrimSpace(*key)
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	if _, err := parseGPGPublicKey(trimmed); err != nil {
+		return nil, err
+	}
+
+	return &trimmed, nil
+}
+
+// VerifyBackupEncryption checks that an encrypted backup is addressed to the
+// key currently configured on its connection's schedule. velld holds only the
+// public key, so this inspects the message headers and never decrypts.
+func (s *BackupService) VerifyBackupEncryption(backupID string, userID uuid.UUID) (*EncryptionVerification, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.accessibleConnection(backup.ConnectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isGPGEncrypted(backup) {
+		return nil, fmt.Errorf("backup is not encrypted")
+	}
+
+	result := &EncryptionVerification{
+		BackupID:       backup.ID.String(),
+		KeyFingerprint: *backup.EncryptionKeyFingerprint,
+	}
+
+	schedule, err := s.backupRepo.GetBackupSchedule(backup.ConnectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get backup schedule: %v", err)
+	}
+	if schedule == nil || schedule.GPGPublicKey == nil {
+		return nil, fmt.Errorf("no GPG public key configured for this connection")
+	}
+
+	entities, err := parseGPGPublicKey(*schedule.GPGPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	result.ConfiguredFingerprint = gpgKeyFingerprint(entities)
+
+	filePath, isTemp, err := s.ensureBackupFileAvailable(backup, conn.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if isTemp {
+		defer os.Remove(filePath)
+	}
+
+	if err := verifyGPGRecipients(filePath, entities); err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	result.Verified = true
+	return result, nil
+}
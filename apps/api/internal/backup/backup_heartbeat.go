@@ -0,0 +1,148 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Heartbeat pings sent for a scheduled run
+const (
+	HeartbeatStart   = "start"
+	HeartbeatSuccess = "success"
+	HeartbeatFailure = "failure"
+)
+
+// heartbeatTimeout bounds a ping, so a hung monitor doesn't hold up a run
+const heartbeatTimeout = 10 * time.Second
+
+// heartbeatMessageLimit caps the error sent with a failure ping
+const heartbeatMessageLimit = 1000
+
+// validateHeartbeatURL checks a schedule's heartbeat check URL; an empty URL
+// removes it
+func validateHeartbeatURL(checkURL *string) (*string, error) {
+	if checkURL == nil {
+		return nil, nil
+	}
+
+	trimmed := strings.TrimSpace(*checkURL)
+	if trimmed == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(trimmed)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("heartbeat_url must be an http or https URL")
+	}
+	return &trimmed, nil
+}
+
+// isCronitor tells whether a check URL is a Cronitor telemetry URL. Every
+// other URL is pinged the way Healthchecks.io expects.
+func isCronitor(parsed *url.URL) bool {
+	host := strings.ToLower(parsed.Hostname())
+	return host == "cronitor.link" || strings.HasSuffix(host, ".cronitor.link") ||
+		host == "cronitor.io" || strings.HasSuffix(host, ".cronitor.io")
+}
+
+// heartbeatRequest builds the ping of an event. Healthchecks.io takes the
+// event as a /start or /fail suffix and correlates pings by rid; Cronitor
+// takes it as the state parameter. The error of a failure is sent as the
+// body or message, which both show with the ping.
+func heartbeatRequest(checkURL, event, runID, message string) (*http.Request, error) {
+	parsed, err := url.Parse(checkURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(message) > heartbeatMessageLimit {
+		message = message[:heartbeatMessageLimit]
+	}
+
+	query := parsed.Query()
+	if isCronitor(parsed) {
+		state := map[string]string{
+			HeartbeatStart:   "run",
+			HeartbeatSuccess: "complete",
+			HeartbeatFailure: "fail",
+		}[event]
+		query.Set("state", state)
+		query.Set("series", runID)
+		if message != "" {
+			query.Set("message", message)
+		}
+		parsed.RawQuery = query.Encode()
+		return http.NewRequest(http.MethodGet, parsed.String(), nil)
+	}
+
+	path := strings.TrimSuffix(parsed.Path, "/")
+	switch event {
+	case HeartbeatStart:
+		path += "/start"
+	case HeartbeatFailure:
+		path += "/fail"
+	}
+	parsed.Path = path
+	query.Set("rid", runID)
+	parsed.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, parsed.String(), strings.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	return req, nil
+}
+
+// sendHeartbeat pings a schedule's check URL. Failed pings are only logged;
+// the monitor alerting on missed pings is what they are for.
+func sendHeartbeat(checkURL, event, runID, message string) {
+	req, err := heartbeatRequest(checkURL, event, runID, message)
+	if err != nil {
+		slog.Warn("Invalid heartbeat URL", "run_id", runID, "error", err)
+		return
+	}
+
+	client := &http.Client{Timeout: heartbeatTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Warn("Failed to send heartbeat", "event", event, "run_id", runID, "error", err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		slog.Warn("Heartbeat monitor rejected ping", "status", resp.Status, "event", event, "run_id", runID)
+	}
+}
+
+// pingRunStarted pings the heartbeat of the run's schedule when it starts
+func pingRunStarted(run *BackupRun, schedule *BackupSchedule) {
+	if schedule == nil || schedule.HeartbeatURL == nil {
+		return
+	}
+	go sendHeartbeat(*schedule.HeartbeatURL, HeartbeatStart, run.ID.String(), "")
+}
+
+// pingRunFinished pings the heartbeat of the run's schedule with the run's
+// outcome. Cancelled runs send nothing; the run replacing them pings.
+func pingRunFinished(run *BackupRun, schedule *BackupSchedule) {
+	if schedule == nil || schedule.HeartbeatURL == nil {
+		return
+	}
+
+	switch {
+	case run.Status == RunStatusSuccess:
+		go sendHeartbeat(*schedule.HeartbeatURL, HeartbeatSuccess, run.ID.String(), "")
+	case runFailed(run.Status):
+		message := run.Status
+		if run.Error != nil {
+			message = *run.Error
+		}
+		go sendHeartbeat(*schedule.HeartbeatURL, HeartbeatFailure, run.ID.String(), message)
+	}
+}
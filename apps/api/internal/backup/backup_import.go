@@ -0,0 +1,783 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Dump import states
+const (
+	ImportUploading = "uploading"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+	ImportCancelled = "cancelled"
+	ImportExpired   = "expired"
+)
+
+const (
+	// importOffsetHeader carries the byte offset an upload chunk starts at,
+	// and the offset reached in responses
+	importOffsetHeader = "Upload-Offset"
+	// staleImportAge is how long an upload may sit idle before it is removed
+	staleImportAge = 24 * time.Hour
+	// importReapSchedule looks for stale uploads every hour
+	importReapSchedule = "0 30 * * * *"
+	// importSniffSize is how much of a dump its format is detected from
+	importSniffSize = 4096
+)
+
+// mongoArchiveMagic starts every mongodump --archive file
+var mongoArchiveMagic = []byte{0x6d, 0xe2, 0x99, 0x81}
+
+// DumpImport is a dump file made outside velld, uploaded so it can be
+// restored like a backup. Once the whole file arrived it is registered as a
+// backup of the connection.
+type DumpImport struct {
+	ID           string    `json:"id"`
+	UserID       uuid.UUID `json:"user_id"`
+	ConnectionID string    `json:"connection_id"`
+	FileName     string    `json:"file_name"`
+	Size         int64     `json:"size"`
+	Received     int64     `json:"received"`
+	Checksum     *string   `json:"checksum,omitempty"`
+	// DatabaseName is the database the dump was taken from, if known
+	DatabaseName *string `json:"database_name,omitempty"`
+	Status       string  `json:"status"`
+	// Format is the detected kind of dump, such as pg_custom or mysql_sql
+	Format    *string   `json:"format,omitempty"`
+	BackupID  *string   `json:"backup_id,omitempty"`
+	Error     *string   `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CreateImportRequest starts a resumable upload of a dump of Size bytes.
+// Checksum is an optional hex SHA-256 the file is checked against.
+type CreateImportRequest struct {
+	ConnectionID string  `json:"connection_id"`
+	FileName     string  `json:"file_name"`
+	Size         int64   `json:"size"`
+	Checksum     *string `json:"checksum,omitempty"`
+	DatabaseName *string `json:"database_name,omitempty"`
+}
+
+// ImportRequestError rejects an upload or a file that cannot be imported
+type ImportRequestError struct {
+	Reason string
+}
+
+func (e *ImportRequestError) Error() string {
+	return e.Reason
+}
+
+// ImportOffsetError rejects a chunk that does not start where the upload
+// stands; clients resume from Offset
+type ImportOffsetError struct {
+	Offset int64
+}
+
+func (e *ImportOffsetError) Error() string {
+	return fmt.Sprintf("upload is at offset %d", e.Offset)
+}
+
+// dumpFormat is a kind of dump file velld can restore
+type dumpFormat struct {
+	name string
+	// dbType is the engine the dump restores into, empty for SQL scripts
+	// that name none
+	dbType string
+	// extension is what the restore pipeline recognizes the format by
+	extension string
+	// compression is the command gzip-wrapped scripts are decompressed with
+	compression string
+}
+
+// importDir holds the uploads that are still arriving
+func (s *BackupService) importDir() string {
+	return filepath.Join(s.backupDir, ".imports")
+}
+
+func (s *BackupService) importPath(id string) string {
+	return filepath.Join(s.importDir(), id+".part")
+}
+
+// CreateDumpImport starts a resumable upload into the connection's backups
+func (s *BackupService) CreateDumpImport(req *CreateImportRequest, userID uuid.UUID) (*DumpImport, error) {
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+	if conn.Type == "redis" {
+		return nil, &ImportRequestError{Reason: "redis dumps cannot be restored by velld"}
+	}
+
+	fileName := strings.TrimSpace(req.FileName)
+	if fileName == "" || strings.ContainsAny(fileName, `/\`) || strings.HasPrefix(fileName, ".") {
+		return nil, &ImportRequestError{Reason: "file_name must be a plain file name"}
+	}
+	if req.Size <= 0 {
+		return nil, &ImportRequestError{Reason: "size must be the file's size in bytes"}
+	}
+	if req.Checksum != nil {
+		checksum := strings.ToLower(strings.TrimSpace(*req.Checksum))
+		if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != 32 {
+			return nil, &ImportRequestError{Reason: "checksum must be a hex SHA-256"}
+		}
+		req.Checksum = &checksum
+	}
+	if req.DatabaseName != nil && *req.DatabaseName == "" {
+		req.DatabaseName = nil
+	}
+
+	if err := os.MkdirAll(s.importDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create import directory: %v", err)
+	}
+
+	now := time.Now()
+	imp := &DumpImport{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		ConnectionID: conn.ID,
+		FileName:     fileName,
+		Size:         req.Size,
+		Checksum:     req.Checksum,
+		DatabaseName: req.DatabaseName,
+		Status:       ImportUploading,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	file, err := os.Create(s.importPath(imp.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload file: %v", err)
+	}
+	file.Close()
+
+	if err := s.backupRepo.CreateDumpImport(imp); err != nil {
+		os.Remove(s.importPath(imp.ID))
+		return nil, fmt.Errorf("failed to save import: %v", err)
+	}
+	return imp, nil
+}
+
+// userDumpImport returns one of the user's imports
+func (s *BackupService) userDumpImport(id string, userID uuid.UUID) (*DumpImport, error) {
+	imp, err := s.backupRepo.GetDumpImport(id)
+	if err != nil {
+		return nil, err
+	}
+	if imp.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return imp, nil
+}
+
+// importLock serializes the chunks of one upload
+func (s *BackupService) importLock(id string) *sync.Mutex {
+	lock, _ := s.importLocks.LoadOrStore(id, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// AppendDumpImport writes a chunk of an upload starting at offset, which
+// has to be where the upload stands. The upload is completed once all of
+// its bytes arrived.
+func (s *BackupService) AppendDumpImport(id string, userID uuid.UUID, offset int64, chunk io.Reader) (*DumpImport, error) {
+	lock := s.importLock(id)
+	if !lock.TryLock() {
+		return nil, &ImportRequestError{Reason: "another chunk of this upload is being written"}
+	}
+	defer lock.Unlock()
+
+	imp, err := s.userDumpImport(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if imp.Status != ImportUploading {
+		return nil, &ImportRequestError{Reason: fmt.Sprintf("upload is %s", imp.Status)}
+	}
+	if offset != imp.Received {
+		return nil, &ImportOffsetError{Offset: imp.Received}
+	}
+
+	file, err := os.OpenFile(s.importPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload file: %v", err)
+	}
+	// A chunk cut off by a dropped connection leaves bytes past the last
+	// recorded offset, which the next chunk overwrites
+	if err := file.Truncate(imp.Received); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open upload file: %v", err)
+	}
+	if _, err := file.Seek(imp.Received, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open upload file: %v", err)
+	}
+
+	// One byte past the remaining size detects an oversized upload
+	remaining := imp.Size - imp.Received
+	written, copyErr := io.Copy(file, io.LimitReader(chunk, remaining+1))
+	if closeErr := file.Close(); copyErr == nil {
+		copyErr = closeErr
+	}
+	if written > remaining {
+		return nil, &ImportRequestError{Reason: fmt.Sprintf("upload is larger than its declared size of %d bytes", imp.Size)}
+	}
+
+	// Whatever arrived before an interrupted chunk failed is kept
+	imp.Received += written
+	if err := s.backupRepo.UpdateDumpImport(imp); err != nil {
+		return nil, fmt.Errorf("failed to save import: %v", err)
+	}
+	if copyErr != nil {
+		return imp, fmt.Errorf("upload interrupted at offset %d: %v", imp.Received, copyErr)
+	}
+
+	if imp.Received == imp.Size {
+		s.completeDumpImport(imp)
+	}
+	return imp, nil
+}
+
+// completeDumpImport checks a fully uploaded dump and registers it as a
+// backup of its connection. A dump that cannot be restored fails the import
+// and is removed.
+func (s *BackupService) completeDumpImport(imp *DumpImport) {
+	backup, err := s.registerDumpImport(imp)
+	if err != nil {
+		os.Remove(s.importPath(imp.ID))
+		message := err.Error()
+		imp.Status = ImportFailed
+		imp.Error = &message
+	} else {
+		backupID := backup.ID.String()
+		imp.Status = ImportCompleted
+		imp.BackupID = &backupID
+		slog.Info("Imported dump as backup", "file", imp.FileName, "backup_id", backupID)
+	}
+
+	if err := s.backupRepo.UpdateDumpImport(imp); err != nil {
+		slog.Warn("Failed to save import", "import_id", imp.ID, "error", err)
+	}
+}
+
+func (s *BackupService) registerDumpImport(imp *DumpImport) (*Backup, error) {
+	conn, err := s.connStorage.GetConnection(imp.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	partPath := s.importPath(imp.ID)
+	checksum, err := computeFileChecksum(partPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum upload: %v", err)
+	}
+	if imp.Checksum != nil && !strings.EqualFold(checksum, *imp.Checksum) {
+		return nil, fmt.Errorf("upload does not match its checksum")
+	}
+
+	format, err := detectDumpFormat(partPath)
+	if err != nil {
+		return nil, err
+	}
+	if format.dbType != "" && engineFamily(format.dbType) != engineFamily(conn.Type) {
+		return nil, fmt.Errorf("the file is a %s dump and cannot be restored into a %s connection", format.dbType, conn.Type)
+	}
+	if format.dbType == "" && conn.Type == "mongodb" {
+		return nil, fmt.Errorf("MongoDB dumps are imported as mongodump --archive files")
+	}
+	imp.Format = &format.name
+
+	connectionFolder := filepath.Join(s.backupDir, common.SanitizeConnectionName(conn.Name))
+	if err := os.MkdirAll(connectionFolder, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create connection backup folder: %v", err)
+	}
+
+	// The restore pipeline tells formats apart by their extension
+	base, _, _ := strings.Cut(imp.FileName, ".")
+	timestamp := imp.CreatedAt.Format("20060102_150405")
+	backupPath := filepath.Join(connectionFolder, fmt.Sprintf("import_%s_%s%s", common.SanitizeConnectionName(base), timestamp, format.extension))
+	if err := os.Rename(partPath, backupPath); err != nil {
+		return nil, fmt.Errorf("failed to move upload: %v", err)
+	}
+
+	now := time.Now()
+	backup := &Backup{
+		ID:            uuid.New(),
+		ConnectionID:  conn.ID,
+		DatabaseName:  imp.DatabaseName,
+		Status:        "completed",
+		Path:          backupPath,
+		Size:          imp.Size,
+		Checksum:      &checksum,
+		StartedTime:   imp.CreatedAt,
+		CompletedTime: &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if format.compression != "" {
+		backup.CompressionCommand = &format.compression
+	}
+
+	if err := s.backupRepo.CreateBackup(backup); err != nil {
+		os.Remove(backupPath)
+		return nil, fmt.Errorf("failed to save backup: %v", err)
+	}
+	return backup, nil
+}
+
+// detectDumpFormat reads the start of a dump to tell which tool wrote it.
+// Gzip-wrapped files are looked into.
+func detectDumpFormat(path string) (*dumpFormat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	head := make([]byte, importSniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read upload: %v", err)
+	}
+	head = head[:n]
+
+	gzipped := bytes.HasPrefix(head, []byte{0x1f, 0x8b})
+	if gzipped {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("the file is not valid gzip: %v", err)
+		}
+		defer gz.Close()
+		head = make([]byte, importSniffSize)
+		n, err = io.ReadFull(gz, head)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("the file is not valid gzip: %v", err)
+		}
+		head = head[:n]
+	}
+
+	format := sniffDumpFormat(head)
+	if format == nil {
+		return nil, &ImportRequestError{Reason: "the file is not a dump velld can restore: upload a pg_dump plain or custom format file, a mysqldump script or a mongodump --archive file"}
+	}
+
+	if gzipped {
+		// mongorestore reads gzipped archives itself; other dumps are
+		// decompressed before they are restored
+		if format.name != "mongo_archive" {
+			format.compression = "gzip"
+		}
+		format.extension += mongoGzipExtension
+		format.name += "_gzip"
+	}
+	return format, nil
+}
+
+// sniffDumpFormat recognizes the start of an uncompressed dump
+func sniffDumpFormat(head []byte) *dumpFormat {
+	switch {
+	case bytes.HasPrefix(head, []byte("PGDMP")):
+		return &dumpFormat{name: "pg_custom", dbType: "postgresql", extension: customDumpExtension}
+	case bytes.HasPrefix(head, mongoArchiveMagic):
+		return &dumpFormat{name: "mongo_archive", dbType: "mongodb", extension: mongoArchiveExtension}
+	case len(head) > 262 && string(head[257:262]) == "ustar":
+		// Directory dumps are packed differently by every tool
+		return nil
+	}
+
+	// A partial rune at the end of the sample is not a sign of binary data
+	text := head
+	for len(text) > 0 && !utf8.Valid(text) && len(head)-len(text) < utf8.UTFMax {
+		text = text[:len(text)-1]
+	}
+	if !utf8.Valid(text) || bytes.IndexByte(text, 0) >= 0 {
+		return nil
+	}
+
+	sample := string(text)
+	switch {
+	case strings.Contains(sample, "PostgreSQL database dump"):
+		return &dumpFormat{name: "pg_sql", dbType: "postgresql", extension: ".sql"}
+	case strings.Contains(sample, "MySQL dump"), strings.Contains(sample, "MariaDB dump"):
+		return &dumpFormat{name: "mysql_sql", dbType: "mysql", extension: ".sql"}
+	}
+
+	// Other SQL scripts are restored as they are
+	scanner := bufio.NewScanner(strings.NewReader(sample))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "--") || strings.HasPrefix(line, "/*") {
+			continue
+		}
+		upper := strings.ToUpper(line)
+		for _, keyword := range []string{"CREATE ", "INSERT ", "SET ", "DROP ", "BEGIN", "START ", "USE ", "ALTER ", "COPY ", "SELECT "} {
+			if strings.HasPrefix(upper, keyword) {
+				return &dumpFormat{name: "sql", extension: ".sql"}
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+// GetDumpImports lists the user's imports, newest first
+func (s *BackupService) GetDumpImports(userID uuid.UUID) ([]*DumpImport, error) {
+	return s.backupRepo.GetDumpImports(&userID)
+}
+
+// GetDumpImport returns one of the user's imports
+func (s *BackupService) GetDumpImport(id string, userID uuid.UUID) (*DumpImport, error) {
+	return s.userDumpImport(id, userID)
+}
+
+// CancelDumpImport stops an upload and removes what arrived of it
+func (s *BackupService) CancelDumpImport(id string, userID uuid.UUID) error {
+	lock := s.importLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	imp, err := s.userDumpImport(id, userID)
+	if err != nil {
+		return err
+	}
+	if imp.Status != ImportUploading {
+		return &ImportRequestError{Reason: fmt.Sprintf("upload is %s", imp.Status)}
+	}
+
+	os.Remove(s.importPath(id))
+	imp.Status = ImportCancelled
+	return s.backupRepo.UpdateDumpImport(imp)
+}
+
+// importedBackup returns the backup an import was registered as
+func (s *BackupService) importedBackup(id string, userID uuid.UUID) (string, error) {
+	imp, err := s.userDumpImport(id, userID)
+	if err != nil {
+		return "", err
+	}
+	if imp.Status != ImportCompleted || imp.BackupID == nil {
+		return "", &ImportRequestError{Reason: fmt.Sprintf("upload is %s", imp.Status)}
+	}
+	return *imp.BackupID, nil
+}
+
+// scheduleImportCleanup removes uploads left idle every hour
+func (s *BackupService) scheduleImportCleanup() {
+	if _, err := s.cronManager.AddFunc(importReapSchedule, s.removeStaleImports); err != nil {
+		slog.Error("Failed to schedule dump import cleanup", "error", err)
+	}
+}
+
+// removeStaleImports expires the uploads that received nothing for a day
+func (s *BackupService) removeStaleImports() {
+	imports, err := s.backupRepo.GetDumpImports(nil, ImportUploading)
+	if err != nil {
+		slog.Error("Failed to get dump imports", "error", err)
+		return
+	}
+
+	for _, imp := range imports {
+		if time.Since(imp.UpdatedAt) < staleImportAge {
+			continue
+		}
+		lock := s.importLock(imp.ID)
+		if !lock.TryLock() {
+			continue
+		}
+		os.Remove(s.importPath(imp.ID))
+		imp.Status = ImportExpired
+		if err := s.backupRepo.UpdateDumpImport(imp); err != nil {
+			slog.Warn("Failed to save import", "import_id", imp.ID, "error", err)
+		}
+		lock.Unlock()
+		s.importLocks.Delete(imp.ID)
+		slog.Info("Removed stale dump upload", "import_id", imp.ID)
+	}
+}
+
+func sendImportError(w http.ResponseWriter, err error) {
+	var invalid *ImportRequestError
+	var offset *ImportOffsetError
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Import or connection not found")
+	case errors.As(err, &offset):
+		w.Header().Set(importOffsetHeader, strconv.FormatInt(offset.Offset, 10))
+		response.SendError(w, http.StatusConflict, err.Error())
+	case errors.As(err, &invalid):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// CreateDumpImport starts a resumable upload from a JSON body, or imports a
+// whole file sent as multipart/form-data with connection_id, optional
+// database_name and checksum fields, and the file in the file field
+func (h *BackupHandler) CreateDumpImport(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		h.importMultipartDump(w, r, userID)
+		return
+	}
+
+	var req CreateImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.ConnectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+
+	imp, err := h.backupService.CreateDumpImport(&req, userID)
+	if err != nil {
+		sendImportError(w, err)
+		return
+	}
+
+	w.Header().Set(importOffsetHeader, "0")
+	response.SendSuccess(w, "Upload started", imp)
+}
+
+// importMultipartDump streams the file part of a multipart request into a
+// new import. The form fields have to come before the file.
+func (h *BackupHandler) importMultipartDump(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req CreateImportRequest
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			response.SendError(w, http.StatusBadRequest, "file is required")
+			return
+		}
+		if err != nil {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(io.LimitReader(part, 4096))
+			if err != nil {
+				response.SendError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			field := strings.TrimSpace(string(value))
+			switch part.FormName() {
+			case "connection_id":
+				req.ConnectionID = field
+			case "database_name":
+				req.DatabaseName = &field
+			case "checksum":
+				req.Checksum = &field
+			case "size":
+				if req.Size, err = strconv.ParseInt(field, 10, 64); err != nil {
+					response.SendError(w, http.StatusBadRequest, "size must be a number of bytes")
+					return
+				}
+			}
+			continue
+		}
+
+		if req.ConnectionID == "" {
+			response.SendError(w, http.StatusBadRequest, "connection_id is required before the file")
+			return
+		}
+		req.FileName = filepath.Base(part.FileName())
+		// Without a size field the request length bounds the file
+		if req.Size <= 0 {
+			req.Size = r.ContentLength
+		}
+
+		imp, err := h.importStreamedDump(&req, userID, part)
+		if err != nil {
+			sendImportError(w, err)
+			return
+		}
+		response.SendSuccess(w, "Dump imported", imp)
+		return
+	}
+}
+
+// importStreamedDump imports a file whose exact size may be unknown, such as
+// a multipart file part bounded only by the request length. The upload is
+// staged first and its size fixed to what arrived.
+func (h *BackupHandler) importStreamedDump(req *CreateImportRequest, userID uuid.UUID, content io.Reader) (*DumpImport, error) {
+	if req.Size <= 0 {
+		return nil, &ImportRequestError{Reason: "size is required when the request length is unknown"}
+	}
+
+	s := h.backupService
+	imp, err := s.CreateDumpImport(req, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	id := imp.ID
+	imp, err = s.AppendDumpImport(id, userID, 0, content)
+	if err != nil {
+		s.CancelDumpImport(id, userID)
+		return nil, err
+	}
+	if imp.Status == ImportUploading {
+		// The declared size was an upper bound; the file is what arrived
+		imp.Size = imp.Received
+		s.completeDumpImport(imp)
+	}
+	if imp.Status == ImportFailed && imp.Error != nil {
+		return imp, &ImportRequestError{Reason: *imp.Error}
+	}
+	return imp, nil
+}
+
+// AppendDumpImport writes a chunk of an upload. The chunk's start goes in the
+// Upload-Offset header; a mismatch answers 409 with the offset to resume at.
+func (h *BackupHandler) AppendDumpImport(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get(importOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		response.SendError(w, http.StatusBadRequest, importOffsetHeader+" header is required")
+		return
+	}
+
+	imp, err := h.backupService.AppendDumpImport(mux.Vars(r)["id"], userID, offset, r.Body)
+	if err != nil {
+		sendImportError(w, err)
+		return
+	}
+
+	w.Header().Set(importOffsetHeader, strconv.FormatInt(imp.Received, 10))
+	if imp.Status == ImportFailed && imp.Error != nil {
+		response.SendError(w, http.StatusBadRequest, *imp.Error)
+		return
+	}
+	response.SendSuccess(w, "Upload chunk received", imp)
+}
+
+func (h *BackupHandler) GetDumpImports(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	imports, err := h.backupService.GetDumpImports(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Dump imports retrieved successfully", imports)
+}
+
+func (h *BackupHandler) GetDumpImport(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	imp, err := h.backupService.GetDumpImport(mux.Vars(r)["id"], userID)
+	if err != nil {
+		sendImportError(w, err)
+		return
+	}
+
+	w.Header().Set(importOffsetHeader, strconv.FormatInt(imp.Received, 10))
+	response.SendSuccess(w, "Dump import retrieved successfully", imp)
+}
+
+func (h *BackupHandler) CancelDumpImport(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.backupService.CancelDumpImport(mux.Vars(r)["id"], userID); err != nil {
+		sendImportError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Upload cancelled", nil)
+}
+
+// RestoreDumpImport restores an imported dump into one of the user's
+// connections, taking the options of a restore to another connection. The
+// import's own connection is the default target.
+func (h *BackupHandler) RestoreDumpImport(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req RestoreToConnectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	backupID, err := h.backupService.importedBackup(id, userID)
+	if err != nil {
+		sendImportError(w, err)
+		return
+	}
+	if req.ConnectionID == "" {
+		imp, err := h.backupService.GetDumpImport(id, userID)
+		if err != nil {
+			sendImportError(w, err)
+			return
+		}
+		req.ConnectionID = imp.ConnectionID
+	}
+
+	h.restoreToConnection(w, r, backupID, userID, &req)
+}
@@ -0,0 +1,181 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSniffDumpFormat(t *testing.T) {
+	tarHeader := make([]byte, 512)
+	copy(tarHeader[257:], "ustar")
+
+	// A UTF-8 rune cut off at the end of the sample
+	cutRune := append([]byte("-- PostgreSQL database dump\n-- café"), "é"[0])
+
+	tests := []struct {
+		name string
+		head []byte
+		want *dumpFormat
+	}{
+		{
+			name: "pg_dump custom format",
+			head: []byte("PGDMP\x01\x0e\x00"),
+			want: &dumpFormat{name: "pg_custom", dbType: "postgresql", extension: customDumpExtension},
+		},
+		{
+			name: "mongodump archive",
+			head: append(append([]byte{}, mongoArchiveMagic...), 0x00, 0x01),
+			want: &dumpFormat{name: "mongo_archive", dbType: "mongodb", extension: mongoArchiveExtension},
+		},
+		{
+			name: "pg_dump plain script",
+			head: []byte("--\n-- PostgreSQL database dump\n--\n\nSET statement_timeout = 0;\n"),
+			want: &dumpFormat{name: "pg_sql", dbType: "postgresql", extension: ".sql"},
+		},
+		{
+			name: "mysqldump script",
+			head: []byte("-- MySQL dump 10.13  Distrib 8.0.36, for Linux (x86_64)\n"),
+			want: &dumpFormat{name: "mysql_sql", dbType: "mysql", extension: ".sql"},
+		},
+		{
+			name: "mariadb-dump script",
+			head: []byte("/*M!999999\\- enable the sandbox mode */\n-- MariaDB dump 10.19\n"),
+			want: &dumpFormat{name: "mysql_sql", dbType: "mysql", extension: ".sql"},
+		},
+		{
+			name: "generic SQL script",
+			head: []byte("-- exported by hand\n\n/* schema */\nCREATE TABLE users (id int);\n"),
+			want: &dumpFormat{name: "sql", extension: ".sql"},
+		},
+		{
+			name: "lowercase SQL keyword",
+			head: []byte("insert into users values (1);\n"),
+			want: &dumpFormat{name: "sql", extension: ".sql"},
+		},
+		{
+			name: "partial rune at the end of the sample",
+			head: cutRune,
+			want: &dumpFormat{name: "pg_sql", dbType: "postgresql", extension: ".sql"},
+		},
+		{name: "tar archive", head: tarHeader, want: nil},
+		{name: "binary data", head: []byte{0x00, 0x01, 0x02, 0xff, 0xfe}, want: nil},
+		{name: "text with a NUL byte", head: []byte("CREATE TABLE t (id int);\x00"), want: nil},
+		{name: "plain text", head: []byte("hello world\nCREATE TABLE t (id int);\n"), want: nil},
+		{name: "only comments", head: []byte("-- nothing here\n\n"), want: nil},
+		{name: "empty", head: []byte{}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sniffDumpFormat(tt.head)
+			if !equalDumpFormat(got, tt.want) {
+				t.Errorf("sniffDumpFormat = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffDumpFormatSampleSize(t *testing.T) {
+	// Leading comments longer than the sample leave no statement to go by
+	head := []byte(strings.Repeat("-- comment\n", importSniffSize/11+1))
+	if got := sniffDumpFormat(head[:importSniffSize]); got != nil {
+		t.Errorf("sniffDumpFormat = %+v, want nil", got)
+	}
+}
+
+func TestDetectDumpFormat(t *testing.T) {
+	pgScript := []byte("--\n-- PostgreSQL database dump\n--\nSET statement_timeout = 0;\n")
+	mongoArchive := append(append([]byte{}, mongoArchiveMagic...), bytes.Repeat([]byte{0x01}, 32)...)
+
+	tests := []struct {
+		name      string
+		content   []byte
+		want      *dumpFormat
+		wantErr   bool
+		wantUsage bool
+	}{
+		{
+			name:    "plain script",
+			content: pgScript,
+			want:    &dumpFormat{name: "pg_sql", dbType: "postgresql", extension: ".sql"},
+		},
+		{
+			name:    "gzipped script is decompressed before restoring",
+			content: gzipBytes(t, pgScript),
+			want:    &dumpFormat{name: "pg_sql_gzip", dbType: "postgresql", extension: ".sql" + mongoGzipExtension, compression: "gzip"},
+		},
+		{
+			name:    "gzipped mongodump archive is read by mongorestore",
+			content: gzipBytes(t, mongoArchive),
+			want:    &dumpFormat{name: "mongo_archive_gzip", dbType: "mongodb", extension: mongoArchiveExtension + mongoGzipExtension},
+		},
+		{
+			name:    "custom format",
+			content: []byte("PGDMP\x01\x0e\x00"),
+			want:    &dumpFormat{name: "pg_custom", dbType: "postgresql", extension: customDumpExtension},
+		},
+		{
+			name:    "truncated gzip",
+			content: []byte{0x1f, 0x8b, 0x08},
+			wantErr: true,
+		},
+		{
+			name:      "unrecognized file",
+			content:   []byte("hello world\n"),
+			wantErr:   true,
+			wantUsage: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "upload.part")
+			if err := os.WriteFile(path, tt.content, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := detectDumpFormat(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("detectDumpFormat returned %+v, want an error", got)
+				}
+				var requestErr *ImportRequestError
+				if tt.wantUsage != errors.As(err, &requestErr) {
+					t.Errorf("detectDumpFormat error = %v, ImportRequestError wanted: %v", err, tt.wantUsage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("detectDumpFormat returned error: %v", err)
+			}
+			if !equalDumpFormat(got, tt.want) {
+				t.Errorf("detectDumpFormat = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func equalDumpFormat(got, want *dumpFormat) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	return *got == *want
+}
+
+func gzipBytes(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
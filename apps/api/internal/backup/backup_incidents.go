@@ -0,0 +1,304 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/google/uuid"
+)
+
+// Kinds of incidents raised with PagerDuty and Opsgenie. A connection has at
+// most one open incident of each kind.
+const (
+	IncidentBackupFailed = "backup_failed"
+	IncidentRPOViolated  = "rpo_violated"
+)
+
+// defaultStalenessSchedule checks backups against their RPO every 10 minutes
+const defaultStalenessSchedule = "0 */10 * * * *"
+
+// Incident is an alert raised with the incident integrations of the user.
+// It is resolved when the next backup of the connection succeeds, or for an
+// RPO violation when the connection is fresh again.
+type Incident struct {
+	ID           uuid.UUID  `json:"id"`
+	UserID       uuid.UUID  `json:"-"`
+	ConnectionID string     `json:"connection_id"`
+	Kind         string     `json:"kind"`
+	DedupKey     string     `json:"dedup_key"`
+	Summary      string     `json:"summary"`
+	TriggeredAt  time.Time  `json:"triggered_at"`
+	ResolvedAt   *time.Time `json:"resolved_at"`
+}
+
+// incidentNotifications are the notifications that raise an incident, with
+// its kind and severity
+var incidentNotifications = map[notification.NotificationType]struct {
+	kind     string
+	severity string
+}{
+	notification.BackupFailed:  {IncidentBackupFailed, notification.SeverityError},
+	notification.BackupPartial: {IncidentBackupFailed, notification.SeverityWarning},
+}
+
+// incidentDedupKey is stable per connection and kind, so repeated failures
+// update one incident instead of paging again
+func incidentDedupKey(connectionID, kind string) string {
+	return "velld-" + kind + "-" + connectionID
+}
+
+// incidentKeys are the decrypted keys of a user's incident integrations
+type incidentKeys struct {
+	pagerDuty      string
+	opsgenie       string
+	opsgenieRegion string
+}
+
+// incidentKeysFor returns the keys of the user's integrations, or nil without
+// any. Incidents are raised only through enabled integrations, but resolved
+// through every configured one, so turning an integration off doesn't leave
+// its incidents open.
+func (s *BackupService) incidentKeysFor(userSettings *settings.UserSettings, enabledOnly bool) *incidentKeys {
+	keys := &incidentKeys{}
+	if userSettings.PagerDutyRoutingKey != nil && (userSettings.NotifyPagerDuty || !enabledOnly) {
+		key, err := s.cryptoService.Decrypt(*userSettings.PagerDutyRoutingKey)
+		if err != nil {
+			slog.Warn("Failed to decrypt PagerDuty routing key", "error", err)
+		} else {
+			keys.pagerDuty = key
+		}
+	}
+	if userSettings.OpsgenieAPIKey != nil && (userSettings.NotifyOpsgenie || !enabledOnly) {
+		key, err := s.cryptoService.Decrypt(*userSettings.OpsgenieAPIKey)
+		if err != nil {
+			slog.Warn("Failed to decrypt Opsgenie API key", "error", err)
+		} else {
+			keys.opsgenie = key
+		}
+		if userSettings.OpsgenieRegion != nil {
+			keys.opsgenieRegion = *userSettings.OpsgenieRegion
+		}
+	}
+	if keys.pagerDuty == "" && keys.opsgenie == "" {
+		return nil
+	}
+	return keys
+}
+
+func (k *incidentKeys) trigger(incident *notification.Incident) {
+	if k.pagerDuty != "" {
+		if err := notification.TriggerPagerDuty(k.pagerDuty, incident); err != nil {
+			slog.Warn("Failed to trigger PagerDuty incident", "dedup_key", incident.DedupKey, "error", err)
+		}
+	}
+	if k.opsgenie != "" {
+		if err := notification.TriggerOpsgenie(k.opsgenie, k.opsgenieRegion, incident); err != nil {
+			slog.Warn("Failed to create Opsgenie alert", "dedup_key", incident.DedupKey, "error", err)
+		}
+	}
+}
+
+func (k *incidentKeys) resolve(dedupKey string) {
+	if k.pagerDuty != "" {
+		if err := notification.ResolvePagerDuty(k.pagerDuty, dedupKey); err != nil {
+			slog.Warn("Failed to resolve PagerDuty incident", "dedup_key", dedupKey, "error", err)
+		}
+	}
+	if k.opsgenie != "" {
+		if err := notification.ResolveOpsgenie(k.opsgenie, k.opsgenieRegion, dedupKey); err != nil {
+			slog.Warn("Failed to close Opsgenie alert", "dedup_key", dedupKey, "error", err)
+		}
+	}
+}
+
+// raiseIncident opens an incident of kind for the connection, unless one is
+// open already. An open incident is triggered again only with retrigger set,
+// which adds the new event to it.
+func (s *BackupService) raiseIncident(userSettings *settings.UserSettings, conn *connection.StoredConnection,
+	kind, severity, summary string, details map[string]interface{}, retrigger bool) {
+	keys := s.incidentKeysFor(userSettings, true)
+	if keys == nil {
+		return
+	}
+
+	s.incidentMu.Lock()
+	open, err := s.backupRepo.GetOpenIncidents(conn.ID)
+	if err != nil {
+		s.incidentMu.Unlock()
+		slog.Warn("Failed to get open incidents of connection", "connection_id", conn.ID, "error", err)
+		return
+	}
+	var existing *Incident
+	for _, incident := range open {
+		if incident.Kind == kind {
+			existing = incident
+		}
+	}
+	if existing == nil {
+		existing = &Incident{
+			ID:           uuid.New(),
+			UserID:       conn.UserID,
+			ConnectionID: conn.ID,
+			Kind:         kind,
+			DedupKey:     incidentDedupKey(conn.ID, kind),
+			Summary:      summary,
+			TriggeredAt:  time.Now(),
+		}
+		if err := s.backupRepo.CreateIncident(existing); err != nil {
+			slog.Warn("Failed to record incident of connection", "connection_id", conn.ID, "error", err)
+		}
+	} else if !retrigger {
+		s.incidentMu.Unlock()
+		return
+	}
+	s.incidentMu.Unlock()
+
+	go keys.trigger(&notification.Incident{
+		DedupKey:  existing.DedupKey,
+		Summary:   summary,
+		Severity:  severity,
+		Component: conn.Name,
+		Group:     conn.Type,
+		Class:     kind,
+		Details:   details,
+	})
+}
+
+// raiseNotificationIncident raises the incident of a failure notification.
+// Like webhooks, incidents don't depend on fallback chains.
+func (s *BackupService) raiseNotificationIncident(userSettings *settings.UserSettings, connectionID string, n *notification.Notification, metadata map[string]interface{}) {
+	mapping, ok := incidentNotifications[n.Type]
+	if !ok {
+		return
+	}
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return
+	}
+	s.raiseIncident(userSettings, conn, mapping.kind, mapping.severity, n.Message, metadata, true)
+}
+
+// resolveIncidents resolves the open incidents of a connection; with kinds,
+// only incidents of those kinds
+func (s *BackupService) resolveIncidents(connectionID string, kinds ...string) {
+	s.incidentMu.Lock()
+	defer s.incidentMu.Unlock()
+
+	open, err := s.backupRepo.GetOpenIncidents(connectionID)
+	if err != nil {
+		slog.Warn("Failed to get open incidents of connection", "connection_id", connectionID, "error", err)
+		return
+	}
+	if len(open) == 0 {
+		return
+	}
+
+	var keys *incidentKeys
+	if conn, err := s.connStorage.GetConnection(connectionID); err == nil {
+		if userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID); err == nil {
+			keys = s.incidentKeysFor(userSettings, false)
+		}
+	}
+
+	now := time.Now()
+	for _, incident := range open {
+		if len(kinds) > 0 && !containsString(kinds, incident.Kind) {
+			continue
+		}
+		incident.ResolvedAt = &now
+		if err := s.backupRepo.ResolveIncident(incident); err != nil {
+			slog.Warn("Failed to resolve incident", "incident_id", incident.ID, "error", err)
+			continue
+		}
+		if keys != nil {
+			go keys.resolve(incident.DedupKey)
+		}
+	}
+}
+
+func (s *BackupService) scheduleStalenessAlerts() {
+	schedule := strings.TrimSpace(os.Getenv("BACKUP_STALENESS_SCHEDULE"))
+	if strings.EqualFold(schedule, "off") {
+		return
+	}
+	if schedule == "" {
+		schedule = defaultStalenessSchedule
+	}
+
+	if _, err := s.cronManager.AddFunc(schedule, s.checkStaleness); err != nil {
+		slog.Error("Failed to schedule staleness alerts", "error", err)
+	}
+}
+
+// checkStaleness raises an incident for every connection whose newest
+// successful backup is older than its RPO, and resolves the ones of
+// connections that are fresh again or paused
+func (s *BackupService) checkStaleness() {
+	freshness, err := s.GetBackupFreshness("")
+	if err != nil {
+		slog.Error("Failed to check backup staleness", "error", err)
+		return
+	}
+
+	for _, entry := range freshness.Connections {
+		if !entry.Violated {
+			s.resolveIncidents(entry.ConnectionID, IncidentRPOViolated)
+			continue
+		}
+
+		conn, err := s.connStorage.GetConnection(entry.ConnectionID)
+		if err != nil {
+			continue
+		}
+		userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+		if err != nil || userSettings == nil {
+			continue
+		}
+
+		rpo := time.Duration(*entry.RPOSeconds) * time.Second
+		details := map[string]interface{}{
+			"connection_id":   conn.ID,
+			"connection_name": conn.Name,
+			"database_name":   conn.DatabaseName,
+			"database_type":   conn.Type,
+			"rpo":             rpo.String(),
+		}
+		summary := fmt.Sprintf("No successful backup of '%s' in its RPO of %s", conn.Name, rpo)
+		if entry.LastBackupAt != nil {
+			details["last_backup_at"] = entry.LastBackupAt.Format(time.RFC3339)
+			details["age"] = (time.Duration(*entry.AgeSeconds) * time.Second).String()
+		} else {
+			summary = fmt.Sprintf("'%s' has no successful backup and an RPO of %s", conn.Name, rpo)
+		}
+		s.raiseIncident(userSettings, conn, IncidentRPOViolated, notification.SeverityCritical, summary, details, false)
+	}
+}
+
+func (s *BackupService) GetIncidents(userID uuid.UUID, includeResolved bool) ([]*Incident, error) {
+	return s.backupRepo.GetIncidents(userID, includeResolved)
+}
+
+func (h *BackupHandler) GetIncidents(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	incidents, err := h.backupService.GetIncidents(userID, r.URL.Query().Get("include_resolved") == "true")
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Incidents retrieved successfully", incidents)
+}
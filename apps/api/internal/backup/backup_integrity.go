@@ -0,0 +1,297 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Integrity verification states recorded on a backup
+const (
+	VerificationStatusVerified    = "verified"
+	VerificationStatusCorrupt     = "corrupt"
+	VerificationStatusUnavailable = "unavailable"
+)
+
+// defaultIntegritySchedule re-hashes stored artifacts every day at 03:00
+const defaultIntegritySchedule = "0 0 3 * * *"
+
+// manifestSuffix is appended to the artifact path for its checksum manifest
+const manifestSuffix = ".sha256"
+
+func computeFileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// recordBackupChecksum hashes the final artifact and writes a manifest next to
+// it in sha256sum format, so it can also be checked with `sha256sum -c`.
+func (s *BackupService) recordBackupChecksum(backup *Backup) error {
+	checksum, err := computeFileChecksum(backup.Path)
+	if err != nil {
+		return fmt.Errorf("failed to compute backup checksum: %v", err)
+	}
+	backup.Checksum = &checksum
+	s.signBackupChecksum(backup)
+
+	manifest := checksumLine(checksum, backup.Path)
+	if err := os.WriteFile(backup.Path+manifestSuffix, []byte(manifest), 0644); err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to write checksum manifest", "path", backup.Path, "error", err)
+	}
+
+	return nil
+}
+
+// appendToManifest adds sha256sum lines for files derived from an artifact
+// to its manifest
+func appendToManifest(backupPath, lines string) error {
+	file, err := os.OpenFile(backupPath+manifestSuffix, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(lines); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// removeChecksumManifest deletes the manifest written next to a local artifact
+func removeChecksumManifest(backupPath string) {
+	manifestPath := backupPath + manifestSuffix
+	if _, err := os.Stat(manifestPath); err != nil {
+		return
+	}
+	if err := os.Remove(manifestPath); err != nil {
+		slog.Warn("Failed to delete checksum manifest", "path", manifestPath, "error", err)
+	}
+}
+
+// VerifyBackupIntegrity re-hashes a stored backup artifact (downloading it from
+// S3 if needed) and records whether it still matches the recorded checksum.
+func (s *BackupService) VerifyBackupIntegrity(backupID string, userID uuid.UUID) (*IntegrityVerification, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.verifyBackup(backup, conn.UserID)
+}
+
+func (s *BackupService) verifyBackup(backup *Backup, userID uuid.UUID) (*IntegrityVerification, error) {
+	if backup.Checksum == nil || *backup.Checksum == "" {
+		return nil, fmt.Errorf("backup has no recorded checksum")
+	}
+
+	result := &IntegrityVerification{
+		BackupID:         backup.ID.String(),
+		ExpectedChecksum: *backup.Checksum,
+		VerifiedAt:       time.Now(),
+	}
+
+	filePath, isTemp, err := s.ensureBackupFileAvailable(backup, userID)
+	if err != nil {
+		result.Status = VerificationStatusUnavailable
+		result.Error = err.Error()
+	} else {
+		if isTemp {
+			defer os.Remove(filePath)
+		}
+
+		actual, err := computeFileChecksum(filePath)
+		if err != nil {
+			result.Status = VerificationStatusUnavailable
+			result.Error = err.Error()
+		} else {
+			result.ActualChecksum = actual
+			if strings.EqualFold(actual, *backup.Checksum) {
+				result.Status = VerificationStatusVerified
+			} else {
+				result.Status = VerificationStatusCorrupt
+				result.Error = "checksum mismatch, backup artifact has been modified or damaged"
+			}
+		}
+	}
+
+	if err := s.backupRepo.UpdateBackupVerification(result.BackupID, result.Status, result.VerifiedAt); err != nil {
+		return nil, fmt.Errorf("failed to record verification result: %v", err)
+	}
+
+	wasCorrupt := backup.VerificationStatus != nil && *backup.VerificationStatus == VerificationStatusCorrupt
+	if result.Status == VerificationStatusCorrupt && !wasCorrupt {
+		s.createCorruptionNotification(backup, userID, result)
+	}
+
+	return result, nil
+}
+
+// verifyAllBackups is the background job that re-hashes every stored artifact
+// to detect bit rot or tampering.
+func (s *BackupService) verifyAllBackups() {
+	backups, err := s.backupRepo.GetBackupsWithChecksum()
+	if err != nil {
+		slog.Error("Failed to get backups for integrity verification", "error", err)
+		return
+	}
+
+	owners := make(map[string]uuid.UUID)
+	var verified, corrupt, unavailable int
+
+	for _, backup := range backups {
+		userID, ok := owners[backup.ConnectionID]
+		if !ok {
+			conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+			if err != nil {
+				slog.Warn("Failed to get connection for integrity verification", "connection_id", backup.ConnectionID, "error", err)
+				continue
+			}
+			userID = conn.UserID
+			owners[backup.ConnectionID] = userID
+		}
+
+		result, err := s.verifyBackup(backup, userID)
+		if err != nil {
+			slog.Warn("Failed to verify backup", "backup_id", backup.ID, "error", err)
+			continue
+		}
+
+		switch result.Status {
+		case VerificationStatusVerified:
+			verified++
+		case VerificationStatusCorrupt:
+			corrupt++
+			slog.Warn("Backup failed integrity verification", "backup_id", backup.ID, "error", result.Error)
+		default:
+			unavailable++
+		}
+	}
+
+	slog.Info("Integrity verification completed",
+		"verified", verified, "corrupt", corrupt, "unavailable", unavailable)
+}
+
+// scheduleIntegrityVerification registers the background verification job.
+// BACKUP_VERIFY_SCHEDULE takes a cron expression (with seconds) or "off".
+func (s *BackupService) scheduleIntegrityVerification() {
+	if s.integrityEntry != 0 {
+		s.cronManager.Remove(s.integrityEntry)
+		s.integrityEntry = 0
+	}
+
+	schedule := strings.TrimSpace(os.Getenv("BACKUP_VERIFY_SCHEDULE"))
+	if strings.EqualFold(schedule, "off") {
+		return
+	}
+	if schedule == "" {
+		schedule = defaultIntegritySchedule
+	}
+
+	entryID, err := s.cronManager.AddFunc(schedule, s.verifyAllBackups)
+	if err != nil {
+		slog.Error("Failed to schedule integrity verification", "error", err)
+		return
+	}
+	s.integrityEntry = entryID
+}
+
+func (s *BackupService) createCorruptionNotification(backup *Backup, userID uuid.UUID, result *IntegrityVerification) {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	if err != nil || userSettings == nil {
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"backup_id":         result.BackupID,
+		"connection_id":     backup.ConnectionID,
+		"expected_checksum": result.ExpectedChecksum,
+		"actual_checksum":   result.ActualChecksum,
+		"timestamp":         result.VerifiedAt.Format(time.RFC3339),
+	}
+	metadataJSON, _ := json.Marshal(metadata)
+
+	n := &notification.Notification{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Title:     "Backup Integrity Check Failed",
+		Message:   fmt.Sprintf("Backup '%s' no longer matches its recorded checksum", filepath.Base(backup.Path)),
+		Type:      notification.BackupCorrupt,
+		Status:    notification.StatusUnread,
+		Metadata:  metadataJSON,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	s.dispatchWebhooks(n, metadata)
+
+	if s.notifyThroughFallbacks(userSettings, n, metadata) {
+		return
+	}
+
+	s.notifyDiscord(userSettings, backup.ConnectionID, n, metadata)
+	s.notifyEmail(userSettings, n, metadata)
+	s.notifyPush(userSettings, n, metadata)
+	s.notifyMatrix(userSettings, n, metadata)
+	if !userSettings.NotifyDashboard {
+		return
+	}
+
+	if err := s.notificationRepo.CreateNotification(n); err != nil {
+		slog.Error("Failed to create dashboard notification", "error", err)
+	}
+}
+
+func (h *BackupHandler) VerifyBackupIntegrity(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.backupService.VerifyBackupIntegrity(backupID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup integrity verification completed", result)
+}
@@ -0,0 +1,34 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+func validateJitter(seconds *int) error {
+	if seconds != nil && (*seconds < 0 || *seconds > maxJitterSeconds) {
+		return fmt.Errorf("jitter_seconds must be between 0 and %d", maxJitterSeconds)
+	}
+	return nil
+}
+
+// startJitter picks how long a scheduled run waits before it starts, so the
+// backups of a fleet scheduled for the same minute are spread over the
+// schedule's jitter instead of hitting shared storage at once
+func startJitter(schedule *BackupSchedule) time.Duration {
+	if schedule.JitterSeconds <= 0 {
+		return 0
+	}
+	return rand.N(time.Duration(schedule.JitterSeconds) * time.Second)
+}
+
+// runScheduled starts a cron run of the schedule after its jitter
+func (s *BackupService) runScheduled(schedule *BackupSchedule) {
+	if delay := startJitter(schedule); delay > 0 {
+		slog.Info("Delaying backup of schedule by jitter", "schedule_id", schedule.ID, "delay", delay.Round(time.Second))
+		time.Sleep(delay)
+	}
+	s.executeCronBackup(schedule)
+}
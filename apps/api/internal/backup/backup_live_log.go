@@ -0,0 +1,358 @@
+package backup
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Kinds of process output that can be tailed
+const (
+	LiveLogBackup  = "backup"
+	LiveLogRestore = "restore"
+)
+
+const (
+	// liveLogBacklogLines are replayed to a client that starts tailing late
+	liveLogBacklogLines = 500
+	// liveLogRetention keeps a finished log around, so a client that
+	// connects just after the end still sees how the process ended
+	liveLogRetention = time.Minute
+	// liveLogHeartbeat keeps idle streams open through proxies while a dump
+	// is silent
+	liveLogHeartbeat = 15 * time.Second
+	// liveLogSubscriberBuffer is how far a client may fall behind before it
+	// misses lines
+	liveLogSubscriberBuffer = 256
+	maxLiveLogLineLength    = 4096
+)
+
+// LiveLog describes the output of a running backup or restore. Backup logs
+// share the ID of their run.
+type LiveLog struct {
+	ID           string     `json:"id"`
+	Kind         string     `json:"kind"`
+	ConnectionID string     `json:"connection_id"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+// liveLog collects the stdout and stderr lines of a run's processes as they
+// are written and passes them on to the clients tailing it
+type liveLog struct {
+	info LiveLog
+
+	mu          sync.Mutex
+	lines       []string
+	partial     []byte
+	subscribers map[chan string]bool
+	finished    bool
+	// spool keeps every line for the run log persisted when the log ends
+	spool *runLogSpool
+}
+
+// beginLiveLog registers the output of a run for tailing. It must be ended
+// with endLiveLog.
+func (s *BackupService) beginLiveLog(id, kind, connectionID string) *liveLog {
+	l := &liveLog{
+		info: LiveLog{
+			ID:           id,
+			Kind:         kind,
+			ConnectionID: connectionID,
+			StartedAt:    time.Now(),
+		},
+		subscribers: make(map[chan string]bool),
+		spool:       s.openRunLogSpool(id),
+	}
+	s.liveLogs.Store(id, l)
+	return l
+}
+
+// endLiveLog persists the log, ends the streams of its clients and forgets
+// the log after liveLogRetention
+func (s *BackupService) endLiveLog(l *liveLog) {
+	l.flush()
+	s.persistRunLog(l)
+	l.finish()
+	time.AfterFunc(liveLogRetention, func() {
+		s.liveLogs.Delete(l.info.ID)
+	})
+}
+
+// Write splits p into lines. Lines cut across writes are joined, and
+// carriage returns of progress output end a line as well.
+func (l *liveLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data := append(l.partial, p...)
+	for {
+		end := bytes.IndexAny(data, "\r\n")
+		if end < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(data[:end])); line != "" {
+			l.publish(line)
+		}
+		data = data[end+1:]
+	}
+	if len(data) > maxLiveLogLineLength {
+		l.publish(string(data))
+		data = nil
+	}
+	l.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// publish keeps the line in the backlog and sends it to the clients. A
+// client whose buffer is full misses the line rather than stall the dump.
+func (l *liveLog) publish(line string) {
+	if len(line) > maxLiveLogLineLength {
+		line = line[:maxLiveLogLineLength]
+	}
+
+	l.spool.append(line)
+	l.lines = append(l.lines, line)
+	if len(l.lines) > liveLogBacklogLines {
+		l.lines = l.lines[len(l.lines)-liveLogBacklogLines:]
+	}
+
+	for ch := range l.subscribers {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// flush publishes the last line when the output didn't end with a newline
+func (l *liveLog) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if line := strings.TrimSpace(string(l.partial)); line != "" {
+		l.publish(line)
+	}
+	l.partial = nil
+}
+
+func (l *liveLog) finish() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.info.FinishedAt = &now
+	l.finished = true
+	for ch := range l.subscribers {
+		close(ch)
+	}
+	l.subscribers = make(map[chan string]bool)
+}
+
+// subscribe returns the backlog and a channel with the lines that follow,
+// which is closed when the log finishes
+func (l *liveLog) subscribe() ([]string, chan string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	backlog := append([]string(nil), l.lines...)
+	ch := make(chan string, liveLogSubscriberBuffer)
+	if l.finished {
+		close(ch)
+	} else {
+		l.subscribers[ch] = true
+	}
+	return backlog, ch
+}
+
+func (l *liveLog) unsubscribe(ch chan string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.subscribers, ch)
+}
+
+func (l *liveLog) describe() LiveLog {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.info
+}
+
+// backlog returns the last lines of the log
+func (l *liveLog) backlog() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+// logOutput returns w, also writing to the run's live log and restore
+// progress when it has them
+func (t *processTracker) logOutput(w io.Writer) io.Writer {
+	if t == nil {
+		return w
+	}
+	writers := []io.Writer{w}
+	if t.log != nil {
+		writers = append(writers, t.log)
+	}
+	if t.progress != nil {
+		writers = append(writers, t.progress)
+	}
+	if len(writers) == 1 {
+		return w
+	}
+	return io.MultiWriter(writers...)
+}
+
+// userLiveLog returns a live log of one of the user's connections
+func (s *BackupService) userLiveLog(id string, userID uuid.UUID) (*liveLog, error) {
+	value, ok := s.liveLogs.Load(id)
+	if !ok {
+		return nil, nil
+	}
+	l := value.(*liveLog)
+
+	conn, err := s.connStorage.GetConnection(l.info.ConnectionID)
+	if err == sql.ErrNoRows {
+		// Restores into sandboxes run against no saved connection
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// GetLiveLogs lists the running and just finished backups and restores of
+// the user's connections whose output can be tailed
+func (s *BackupService) GetLiveLogs(userID uuid.UUID) ([]LiveLog, error) {
+	owned := make(map[string]bool)
+	logs := []LiveLog{}
+
+	var lookupErr error
+	s.liveLogs.Range(func(_, value interface{}) bool {
+		info := value.(*liveLog).describe()
+
+		isOwner, checked := owned[info.ConnectionID]
+		if !checked {
+			conn, err := s.connStorage.GetConnection(info.ConnectionID)
+			if err == sql.ErrNoRows {
+				owned[info.ConnectionID] = false
+				return true
+			}
+			if err != nil {
+				lookupErr = fmt.Errorf("failed to get connection: %v", err)
+				return false
+			}
+			isOwner = s.connStorage.HasAccess(conn, userID)
+			owned[info.ConnectionID] = isOwner
+		}
+
+		if isOwner {
+			logs = append(logs, info)
+		}
+		return true
+	})
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].StartedAt.Before(logs[j].StartedAt)
+	})
+
+	return logs, nil
+}
+
+func (h *BackupHandler) GetLiveLogs(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logs, err := h.backupService.GetLiveLogs(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Live logs retrieved successfully", logs)
+}
+
+// StreamLiveLog tails the output of a running backup or restore as
+// server-sent events: the backlog first, then each line as it is written,
+// and an "end" event once the process finished.
+func (h *BackupHandler) StreamLiveLog(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	logID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	l, err := h.backupService.userLiveLog(logID, userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if l == nil {
+		response.SendError(w, http.StatusNotFound, "No running backup or restore with this ID")
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	backlog, lines := l.subscribe()
+	defer l.unsubscribe(lines)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, line := range backlog {
+		fmt.Fprintf(w, "data: %s\n\n", line)
+	}
+	if err := controller.Flush(); err != nil {
+		slog.Warn("Failed to stream live log", "log_id", logID, "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(liveLogHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case line, open := <-lines:
+			if !open {
+				fmt.Fprintf(w, "event: end\ndata: %s\n\n", l.info.Kind)
+				controller.Flush()
+				return
+			}
+			fmt.Fprintf(w, "data: %s\n\n", line)
+			controller.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			controller.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
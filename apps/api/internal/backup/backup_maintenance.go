@@ -0,0 +1,383 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// What happens to a scheduled run that falls in a maintenance window
+const (
+	MaintenanceActionSkip  = "skip"
+	MaintenanceActionDefer = "defer"
+)
+
+// RunStatusBlackedOut marks scheduled runs skipped by a maintenance window
+const RunStatusBlackedOut = "blacked_out"
+
+// MaintenanceWindow is a recurring time range, such as Sundays 02:00-06:00
+// while a database is being maintained, in which scheduled backups are
+// skipped or deferred until the window ends. Manual backups are not affected.
+type MaintenanceWindow struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	// ConnectionID limits the window to one connection; nil applies it to
+	// all of the user's connections
+	ConnectionID *string `json:"connection_id"`
+	Name         string  `json:"name"`
+	Start        string  `json:"start"`
+	End          string  `json:"end"`
+	// Days limits the window to weekdays such as "sun"; empty means every day
+	Days []string `json:"days,omitempty"`
+	// Timezone is the IANA zone the window is in; unset uses the server's
+	// local time zone
+	Timezone  *string   `json:"timezone,omitempty"`
+	Action    string    `json:"action"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MaintenanceWindowRequest creates or replaces a maintenance window
+type MaintenanceWindowRequest struct {
+	ConnectionID *string  `json:"connection_id,omitempty"`
+	Name         string   `json:"name"`
+	Start        string   `json:"start"`
+	End          string   `json:"end"`
+	Days         []string `json:"days,omitempty"`
+	Timezone     string   `json:"timezone,omitempty"`
+	// Action is skip, the default, or defer
+	Action  string `json:"action,omitempty"`
+	Enabled *bool  `json:"enabled,omitempty"`
+}
+
+// MaintenanceWindowError rejects an invalid maintenance window
+type MaintenanceWindowError struct {
+	Reason string
+}
+
+func (e *MaintenanceWindowError) Error() string {
+	return e.Reason
+}
+
+// blackout parses the window's time range
+func (w *MaintenanceWindow) blackout() (blackout, error) {
+	parsed, err := parseBlackoutWindows([]BlackoutWindow{{Start: w.Start, End: w.End, Days: w.Days}})
+	if err != nil {
+		return blackout{}, err
+	}
+	return parsed[0], nil
+}
+
+func (w *MaintenanceWindow) location() (*time.Location, error) {
+	if w.Timezone == nil {
+		return time.Local, nil
+	}
+	return time.LoadLocation(*w.Timezone)
+}
+
+// describe names the window in the reason of the runs it skips or defers
+func (w *MaintenanceWindow) describe() string {
+	return fmt.Sprintf("maintenance window %q (%s-%s)", w.Name, w.Start, w.End)
+}
+
+// applyMaintenanceWindow validates a request and copies it onto the window
+func (s *BackupService) applyMaintenanceWindow(window *MaintenanceWindow, req *MaintenanceWindowRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return &MaintenanceWindowError{Reason: "name is required"}
+	}
+
+	var connectionID *string
+	if req.ConnectionID != nil && *req.ConnectionID != "" {
+		conn, err := s.connStorage.GetConnection(*req.ConnectionID)
+		if err == sql.ErrNoRows || (err == nil && !s.connStorage.HasAccess(conn, window.UserID)) {
+			return &MaintenanceWindowError{Reason: fmt.Sprintf("connection %s not found", *req.ConnectionID)}
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get connection: %v", err)
+		}
+		connectionID = &conn.ID
+	}
+
+	action := req.Action
+	if action == "" {
+		action = MaintenanceActionSkip
+	}
+	if action != MaintenanceActionSkip && action != MaintenanceActionDefer {
+		return &MaintenanceWindowError{Reason: fmt.Sprintf("invalid action %q, use %s or %s", req.Action, MaintenanceActionSkip, MaintenanceActionDefer)}
+	}
+
+	var timezone *string
+	if zone := strings.TrimSpace(req.Timezone); zone != "" {
+		if _, err := time.LoadLocation(zone); err != nil {
+			return &MaintenanceWindowError{Reason: fmt.Sprintf("invalid timezone %q: %v", zone, err)}
+		}
+		timezone = &zone
+	}
+
+	candidate := MaintenanceWindow{Start: strings.TrimSpace(req.Start), End: strings.TrimSpace(req.End), Days: req.Days}
+	if _, err := candidate.blackout(); err != nil {
+		return &MaintenanceWindowError{Reason: err.Error()}
+	}
+
+	window.ConnectionID = connectionID
+	window.Name = name
+	window.Start = candidate.Start
+	window.End = candidate.End
+	window.Days = req.Days
+	window.Timezone = timezone
+	window.Action = action
+	window.Enabled = req.Enabled == nil || *req.Enabled
+	window.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *BackupService) CreateMaintenanceWindow(userID uuid.UUID, req *MaintenanceWindowRequest) (*MaintenanceWindow, error) {
+	window := &MaintenanceWindow{
+		ID:        uuid.New(),
+		UserID:    userID,
+		CreatedAt: time.Now(),
+	}
+	if err := s.applyMaintenanceWindow(window, req); err != nil {
+		return nil, err
+	}
+	if err := s.backupRepo.CreateMaintenanceWindow(window); err != nil {
+		return nil, fmt.Errorf("failed to save maintenance window: %v", err)
+	}
+	return window, nil
+}
+
+// userMaintenanceWindow returns one of the user's maintenance windows
+func (s *BackupService) userMaintenanceWindow(id string, userID uuid.UUID) (*MaintenanceWindow, error) {
+	window, err := s.backupRepo.GetMaintenanceWindow(id)
+	if err != nil {
+		return nil, err
+	}
+	if window.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return window, nil
+}
+
+func (s *BackupService) UpdateMaintenanceWindow(id string, userID uuid.UUID, req *MaintenanceWindowRequest) (*MaintenanceWindow, error) {
+	window, err := s.userMaintenanceWindow(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyMaintenanceWindow(window, req); err != nil {
+		return nil, err
+	}
+	if err := s.backupRepo.UpdateMaintenanceWindow(window); err != nil {
+		return nil, fmt.Errorf("failed to update maintenance window: %v", err)
+	}
+	return window, nil
+}
+
+func (s *BackupService) DeleteMaintenanceWindow(id string, userID uuid.UUID) error {
+	if _, err := s.userMaintenanceWindow(id, userID); err != nil {
+		return err
+	}
+	return s.backupRepo.DeleteMaintenanceWindow(id)
+}
+
+// GetMaintenanceWindows lists the user's maintenance windows, or only the
+// ones that apply to a connection when one is given
+func (s *BackupService) GetMaintenanceWindows(userID uuid.UUID, connectionID string) ([]*MaintenanceWindow, error) {
+	return s.backupRepo.GetMaintenanceWindows(userID, connectionID)
+}
+
+// activeMaintenanceWindow returns the enabled window the connection is in at
+// t, and when it ends
+func (s *BackupService) activeMaintenanceWindow(conn *connection.StoredConnection, t time.Time) (*MaintenanceWindow, time.Time) {
+	windows, err := s.backupRepo.GetMaintenanceWindows(conn.UserID, conn.ID)
+	if err != nil {
+		slog.Warn("Failed to get maintenance windows for connection", "connection_id", conn.ID, "error", err)
+		return nil, time.Time{}
+	}
+	return activeWindow(windows, t)
+}
+
+// activeWindow returns the enabled window of windows that t falls in, and
+// when it ends. Skipping wins over deferring when windows overlap, and a
+// deferred run waits for the last overlapping window to end.
+func activeWindow(windows []*MaintenanceWindow, t time.Time) (*MaintenanceWindow, time.Time) {
+	var active *MaintenanceWindow
+	var until time.Time
+	for _, window := range windows {
+		if !window.Enabled {
+			continue
+		}
+		b, err := window.blackout()
+		if err != nil {
+			continue
+		}
+		loc, err := window.location()
+		if err != nil {
+			continue
+		}
+		local := t.In(loc)
+		if !b.contains(local) {
+			continue
+		}
+
+		end := b.until(local)
+		if active == nil || (window.Action == MaintenanceActionSkip && active.Action == MaintenanceActionDefer) ||
+			(window.Action == active.Action && end.After(until)) {
+			active, until = window, end
+		}
+	}
+	return active, until
+}
+
+// blackedOut skips or defers a scheduled run that falls in a maintenance
+// window. A skipped run is recorded as blacked out; a deferred run is
+// started when the window ends, and runs due while it is pending are
+// skipped.
+func (s *BackupService) blackedOut(schedule *BackupSchedule) bool {
+	conn, err := s.connStorage.GetConnection(schedule.ConnectionID)
+	if err != nil {
+		slog.Warn("Failed to check maintenance windows for connection", "connection_id", schedule.ConnectionID, "error", err)
+		return false
+	}
+
+	window, until := s.activeMaintenanceWindow(conn, time.Now())
+	if window == nil {
+		return false
+	}
+
+	reason := window.describe()
+	if window.Action == MaintenanceActionDefer {
+		if _, pending := s.deferredRuns.LoadOrStore(schedule.ID.String(), until); !pending {
+			s.deferScheduledRun(schedule, until, reason)
+			return true
+		}
+		reason += ", a deferred run is already pending"
+	}
+
+	s.recordSkippedRun(schedule, RunStatusBlackedOut, "skipped by "+reason)
+	return true
+}
+
+// deferScheduledRun runs the schedule once a maintenance window ends. The
+// deferred time is saved as the next run, so a restart in the meantime
+// catches it up.
+func (s *BackupService) deferScheduledRun(schedule *BackupSchedule, until time.Time, reason string) {
+	slog.Info("Deferring backup of schedule", "schedule_id", schedule.ID, "until", until.Format(time.RFC3339), "reason", reason)
+
+	schedule.NextRunTime = &until
+	schedule.UpdatedAt = time.Now()
+	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
+		slog.Error("Failed to update backup schedule", "schedule_id", schedule.ID, "error", err)
+	}
+
+	time.AfterFunc(time.Until(until), func() {
+		s.deferredRuns.Delete(schedule.ID.String())
+
+		current, err := s.backupRepo.GetBackupSchedule(schedule.ConnectionID)
+		if err != nil || !current.Enabled || current.ID != schedule.ID {
+			return
+		}
+		s.executeCronBackup(current)
+	})
+}
+
+// sendMaintenanceWindowError answers a request that failed to save a
+// maintenance window
+func sendMaintenanceWindowError(w http.ResponseWriter, err error) {
+	var invalid *MaintenanceWindowError
+	switch {
+	case errors.As(err, &invalid):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Maintenance window not found")
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *BackupHandler) GetMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	windows, err := h.backupService.GetMaintenanceWindows(userID, r.URL.Query().Get("connection_id"))
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Maintenance windows retrieved successfully", windows)
+}
+
+func (h *BackupHandler) CreateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req MaintenanceWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	window, err := h.backupService.CreateMaintenanceWindow(userID, &req)
+	if err != nil {
+		sendMaintenanceWindowError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Maintenance window created successfully", window)
+}
+
+func (h *BackupHandler) UpdateMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req MaintenanceWindowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	window, err := h.backupService.UpdateMaintenanceWindow(mux.Vars(r)["id"], userID, &req)
+	if err != nil {
+		sendMaintenanceWindowError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Maintenance window updated successfully", window)
+}
+
+func (h *BackupHandler) DeleteMaintenanceWindow(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.backupService.DeleteMaintenanceWindow(mux.Vars(r)["id"], userID); err != nil {
+		sendMaintenanceWindowError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Maintenance window deleted successfully", nil)
+}
@@ -0,0 +1,351 @@
+package backup
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// manifestFileSuffix is appended to the artifact path for its manifest
+const manifestFileSuffix = ".manifest.json"
+
+// postProcessorManifest marks the manifest among a backup's side files, so it
+// is uploaded and deleted with the artifact
+const postProcessorManifest = "manifest"
+
+// BackupManifest describes where an artifact came from: the server and tool
+// versions, the options it was dumped with and the shape of the schema. It is
+// saved with the backup and written next to local artifacts, so restores can
+// warn about version mismatches.
+type BackupManifest struct {
+	BackupID        uuid.UUID `json:"backup_id"`
+	ConnectionID    string    `json:"connection_id"`
+	DatabaseType    string    `json:"database_type"`
+	ServerVersion   string    `json:"server_version,omitempty"`
+	DumpTool        string    `json:"dump_tool,omitempty"`
+	DumpToolVersion string    `json:"dump_tool_version,omitempty"`
+	Databases       []string  `json:"databases"`
+	TableCount      int       `json:"table_count"`
+	// SchemaFingerprint is a SHA-256 over the tables and their columns
+	SchemaFingerprint string          `json:"schema_fingerprint,omitempty"`
+	Options           ManifestOptions `json:"options"`
+	DurationSeconds   float64         `json:"duration_seconds"`
+	Size              int64           `json:"size"`
+	Checksum          *string         `json:"checksum,omitempty"`
+	CreatedAt         time.Time       `json:"created_at"`
+}
+
+// ManifestOptions are the options an artifact was produced with
+type ManifestOptions struct {
+	DumpArgs                 []string       `json:"dump_args,omitempty"`
+	ExtraDumpArgs            string         `json:"extra_dump_args,omitempty"`
+	Streamed                 bool           `json:"streamed"`
+	PgDumpJobs               int            `json:"pg_dump_jobs,omitempty"`
+	CompressionCommand       *string        `json:"compression_command,omitempty"`
+	EncryptionKeyFingerprint *string        `json:"encryption_key_fingerprint,omitempty"`
+	DumpFilters              *DumpFilters   `json:"dump_filters,omitempty"`
+	Sample                   *SampleOptions `json:"sample,omitempty"`
+}
+
+// Value stores the manifest as JSON in a nullable text column
+func (m BackupManifest) Value() (driver.Value, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (m *BackupManifest) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	case []byte:
+		return json.Unmarshal(v, m)
+	default:
+		return fmt.Errorf("cannot scan %T into backup manifest", src)
+	}
+}
+
+// describeRunSchemas takes the server version and schema of each database
+// the run dumps. It runs before the dump, while the connection still points
+// at the server rather than an SSH tunnel. Failures only leave the manifests
+// without a schema.
+func (s *BackupService) describeRunSchemas(conn *connection.StoredConnection, run *BackupRun) {
+	if s.connService == nil {
+		return
+	}
+
+	databases := conn.SelectedDatabases
+	if len(databases) == 0 {
+		databases = []string{conn.DatabaseName}
+	}
+
+	run.schemas = make(map[string]*connection.SchemaDescription, len(databases))
+	for _, dbName := range databases {
+		tempConn := *conn
+		tempConn.DatabaseName = dbName
+		description, err := s.connService.DescribeSchema(&tempConn)
+		if err != nil {
+			slog.WarnContext(run.processes.jobContext(), "Failed to describe schema of database for the backup manifest", "database", dbName, "error", err)
+			continue
+		}
+		run.schemas[dbName] = description
+	}
+}
+
+// schema returns the schema of a database taken before the dump, if any
+func (run *BackupRun) schema(dbName string) *connection.SchemaDescription {
+	return run.schemas[dbName]
+}
+
+// buildBackupManifest fills in the backup's manifest once the artifact is
+// final, and writes it next to a local artifact
+func (s *BackupService) buildBackupManifest(backup *Backup, conn *connection.StoredConnection, run *BackupRun) {
+	manifest := &BackupManifest{
+		BackupID:     backup.ID,
+		ConnectionID: backup.ConnectionID,
+		DatabaseType: conn.Type,
+		Databases:    []string{},
+		TableCount:   len(backup.catalog),
+		Size:         backup.Size,
+		Checksum:     backup.Checksum,
+		Options: ManifestOptions{
+			CompressionCommand:       backup.CompressionCommand,
+			EncryptionKeyFingerprint: backup.EncryptionKeyFingerprint,
+			DumpFilters:              backup.DumpFilters,
+		},
+		CreatedAt: time.Now(),
+	}
+
+	if backup.DatabaseName != nil {
+		manifest.Databases = append(manifest.Databases, *backup.DatabaseName)
+		if schema := run.schema(*backup.DatabaseName); schema != nil {
+			manifest.ServerVersion = schema.ServerVersion
+			manifest.SchemaFingerprint = schema.Fingerprint
+			if schema.Tables > 0 {
+				manifest.TableCount = schema.Tables
+			}
+		}
+	}
+
+	if env := backup.RunEnvironment; env != nil {
+		manifest.DumpTool = env.DumpTool
+		manifest.DumpToolVersion = env.DumpToolVersion
+		manifest.Options.DumpArgs = env.DumpArgs
+		manifest.Options.ExtraDumpArgs = env.ExtraDumpArgs
+		manifest.Options.Streamed = env.Streamed
+		manifest.Options.PgDumpJobs = env.PgDumpJobs
+		manifest.Options.Sample = env.Sample
+	}
+
+	if backup.CompletedTime != nil {
+		manifest.DurationSeconds = backup.CompletedTime.Sub(backup.StartedTime).Seconds()
+	}
+
+	backup.Manifest = manifest
+
+	// Streamed artifacts have no local copy to put the manifest next to
+	if manifest.Options.Streamed {
+		return
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		slog.WarnContext(run.processes.jobContext(), "Failed to encode manifest", "path", backup.Path, "error", err)
+		return
+	}
+	manifestPath := backup.Path + manifestFileSuffix
+	if err := os.WriteFile(manifestPath, data, 0644); err != nil {
+		slog.WarnContext(run.processes.jobContext(), "Failed to write manifest", "path", backup.Path, "error", err)
+		return
+	}
+	backup.PostProcessedFiles = append(backup.PostProcessedFiles, PostProcessedFile{
+		Processor: postProcessorManifest,
+		Path:      manifestPath,
+		Size:      int64(len(data)),
+	})
+}
+
+var versionNumberPattern = regexp.MustCompile(`(\d+)(?:\.(\d+))?`)
+
+// parseVersion returns the major and minor number of the first version in a
+// version string such as "PostgreSQL 16.2" or "8.0.36-0ubuntu0.22.04.1"
+func parseVersion(version string) (major, minor int, ok bool) {
+	match := versionNumberPattern.FindStringSubmatch(version)
+	if match == nil {
+		return 0, 0, false
+	}
+	major, _ = strconv.Atoi(match[1])
+	if match[2] != "" {
+		minor, _ = strconv.Atoi(match[2])
+	}
+	return major, minor, true
+}
+
+// compareVersions compares the release series of two versions: the major
+// version for PostgreSQL, major and minor for the others. ok is false when
+// either cannot be parsed.
+func compareVersions(dbType, a, b string) (cmp int, ok bool) {
+	aMajor, aMinor, aOK := parseVersion(a)
+	bMajor, bMinor, bOK := parseVersion(b)
+	if !aOK || !bOK {
+		return 0, false
+	}
+	if aMajor != bMajor {
+		if aMajor < bMajor {
+			return -1, true
+		}
+		return 1, true
+	}
+	if dbType == "postgresql" || aMinor == bMinor {
+		return 0, true
+	}
+	if aMinor < bMinor {
+		return -1, true
+	}
+	return 1, true
+}
+
+// manifestWarnings lists the version mismatches between a backup and the
+// server it would be restored to. target may be nil when the server could not
+// be described; the local restore tool is still checked.
+func manifestWarnings(manifest *BackupManifest, dbType string, target *connection.SchemaDescription) []string {
+	var warnings []string
+	if manifest == nil {
+		return warnings
+	}
+
+	if dbType != manifest.DatabaseType {
+		warnings = append(warnings, fmt.Sprintf("backup was taken from %s but the target is %s", manifest.DatabaseType, dbType))
+		return warnings
+	}
+
+	if target != nil && manifest.ServerVersion != "" && target.ServerVersion != "" {
+		if cmp, ok := compareVersions(dbType, target.ServerVersion, manifest.ServerVersion); ok && cmp != 0 {
+			relation := "newer"
+			if cmp < 0 {
+				relation = "older"
+			}
+			warnings = append(warnings, fmt.Sprintf("target server version %s is %s than the source server version %s",
+				target.ServerVersion, relation, manifest.ServerVersion))
+		}
+	}
+
+	if manifest.DumpToolVersion != "" {
+		if tool, exists := restoreTools[dbType]; exists {
+			if binaryPath := common.FindBinaryPath(dbType, tool); binaryPath != "" {
+				restoreVersion := dumpToolVersion(filepath.Join(binaryPath, common.GetPlatformExecutableName(tool)))
+				if cmp, ok := compareVersions(dbType, restoreVersion, manifest.DumpToolVersion); ok && cmp < 0 {
+					warnings = append(warnings, fmt.Sprintf("restore tool %s is older than the dump tool %s",
+						restoreVersion, manifest.DumpToolVersion))
+				}
+			}
+		}
+	}
+
+	return warnings
+}
+
+// restoreWarnings compares a backup's manifest with the target connection.
+// It describes the target, so it runs before an SSH tunnel rewrites the
+// connection.
+func (s *BackupService) restoreWarnings(backup *Backup, conn *connection.StoredConnection) []string {
+	if backup.Manifest == nil {
+		return nil
+	}
+
+	var target *connection.SchemaDescription
+	if s.connService != nil {
+		description, err := s.connService.DescribeSchema(conn)
+		if err != nil {
+			slog.Warn("Failed to read version of restore target", "connection_id", conn.ID, "error", err)
+		} else {
+			target = description
+		}
+	}
+
+	return manifestWarnings(backup.Manifest, conn.Type, target)
+}
+
+// ManifestReport is a backup's manifest with the mismatches against a
+// prospective restore target
+type ManifestReport struct {
+	Manifest *BackupManifest `json:"manifest"`
+	Warnings []string        `json:"warnings"`
+}
+
+// GetBackupManifest returns a backup's manifest. With a target connection,
+// the report warns about version mismatches a restore into it would face.
+func (s *BackupService) GetBackupManifest(backupID, targetConnectionID string, userID uuid.UUID) (*ManifestReport, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	// Backups taken before manifests were written have none
+	report := &ManifestReport{Manifest: backup.Manifest, Warnings: []string{}}
+	if backup.Manifest == nil || targetConnectionID == "" {
+		return report, nil
+	}
+
+	target, err := s.connStorage.GetConnection(targetConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(target, userID) {
+		return nil, sql.ErrNoRows
+	}
+	if warnings := s.restoreWarnings(backup, target); warnings != nil {
+		report.Warnings = warnings
+	}
+
+	return report, nil
+}
+
+func (h *BackupHandler) GetBackupManifest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.backupService.GetBackupManifest(backupID, r.URL.Query().Get("connection_id"), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup or connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup manifest retrieved successfully", report)
+}
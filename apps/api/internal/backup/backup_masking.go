@@ -0,0 +1,830 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+)
+
+// Masking fakers
+const (
+	MaskingFakerEmail     = "email"
+	MaskingFakerName      = "name"
+	MaskingFakerFirstName = "first_name"
+	MaskingFakerLastName  = "last_name"
+	MaskingFakerPhone     = "phone"
+	MaskingFakerToken     = "token"
+	MaskingFakerUUID      = "uuid"
+)
+
+var maskingFakers = map[string]bool{
+	MaskingFakerEmail:     true,
+	MaskingFakerName:      true,
+	MaskingFakerFirstName: true,
+	MaskingFakerLastName:  true,
+	MaskingFakerPhone:     true,
+	MaskingFakerToken:     true,
+	MaskingFakerUUID:      true,
+}
+
+// maskableTypes lists the database types whose dumps are SQL scripts the
+// masking stage can rewrite
+var maskableTypes = map[string]bool{
+	"postgresql": true,
+	"mysql":      true,
+	"mariadb":    true,
+}
+
+// MaskingRule rewrites a column in the rows of a dump, so the backup can be
+// restored into staging environments without production data
+type MaskingRule struct {
+	// Table is a table name, optionally schema-qualified; empty matches the
+	// column in every table
+	Table  string `json:"table,omitempty"`
+	Column string `json:"column"`
+	// Pattern is a regular expression whose matches are replaced by
+	// Replacement, which may refer to groups as $1
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	// Faker replaces the whole value with generated data: email, name,
+	// first_name, last_name, phone, token or uuid
+	Faker string `json:"faker,omitempty"`
+}
+
+// MaskingRules apply in the configured order
+type MaskingRules []MaskingRule
+
+// Value stores the rules as JSON in a nullable text column
+func (m MaskingRules) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (m *MaskingRules) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	case []byte:
+		return json.Unmarshal(v, m)
+	default:
+		return fmt.Errorf("cannot scan %T into masking rules", src)
+	}
+}
+
+// validateMaskingRules checks the rules submitted with a schedule request. An
+// empty list clears them.
+func (s *BackupService) validateMaskingRules(connectionID string, rules *MaskingRules, pgDumpJobs int) (MaskingRules, error) {
+	if rules == nil || len(*rules) == 0 {
+		return nil, nil
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !maskableTypes[conn.Type] {
+		return nil, fmt.Errorf("masking is not supported for %s", conn.Type)
+	}
+	if conn.Type == "postgresql" && pgDumpJobs > 0 {
+		return nil, fmt.Errorf("masking needs plain SQL dumps and cannot be combined with pg_dump_jobs")
+	}
+
+	var validated MaskingRules
+	for _, rule := range *rules {
+		rule.Table = strings.TrimSpace(rule.Table)
+		rule.Column = strings.TrimSpace(rule.Column)
+		rule.Faker = strings.ToLower(strings.TrimSpace(rule.Faker))
+		if _, err := compileMaskingRule(rule); err != nil {
+			return nil, err
+		}
+		validated = append(validated, rule)
+	}
+
+	return validated, nil
+}
+
+type compiledMaskingRule struct {
+	MaskingRule
+	pattern *regexp.Regexp
+}
+
+func compileMaskingRule(rule MaskingRule) (*compiledMaskingRule, error) {
+	if rule.Column == "" {
+		return nil, fmt.Errorf("masking rules need a column")
+	}
+	if (rule.Pattern == "") == (rule.Faker == "") {
+		return nil, fmt.Errorf("masking rule for column %s needs either a pattern or a faker", rule.Column)
+	}
+
+	compiled := &compiledMaskingRule{MaskingRule: rule}
+	if rule.Pattern != "" {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid masking pattern for column %s: %v", rule.Column, err)
+		}
+		compiled.pattern = pattern
+	} else if !maskingFakers[rule.Faker] {
+		return nil, fmt.Errorf("unknown masking faker: %s", rule.Faker)
+	}
+	return compiled, nil
+}
+
+// pgDumpFormatFor keeps masked Postgres dumps as plain SQL scripts, which the
+// masking stage rewrites as they are written, and sampled ones, which are
+// assembled from parts
+func pgDumpFormatFor(schedule *BackupSchedule) string {
+	if schedule != nil && (len(schedule.MaskingRules) > 0 || schedule.Sample != nil) {
+		return pgDumpFormatPlain
+	}
+	return pgDumpFormat()
+}
+
+// dumpMasker holds the compiled rules of a schedule for one dump. Fakers are
+// seeded with a per-dump salt, so a value is masked the same way throughout
+// the dump, keeping joins intact, but cannot be linked back to the original.
+type dumpMasker struct {
+	rules []*compiledMaskingRule
+	// mysql dumps escape string literals with backslashes
+	mysql bool
+	salt  []byte
+}
+
+// newDumpMasker returns the masker for a dump of the connection, or nil when
+// the schedule has no masking rules. Dumps that cannot be masked fail instead
+// of being stored unmasked.
+func newDumpMasker(conn *connection.StoredConnection, schedule *BackupSchedule) (*dumpMasker, error) {
+	if schedule == nil || len(schedule.MaskingRules) == 0 {
+		return nil, nil
+	}
+	if !maskableTypes[conn.Type] {
+		return nil, fmt.Errorf("masking is not supported for %s", conn.Type)
+	}
+	if pgDumpJobs(conn, schedule) > 0 {
+		return nil, fmt.Errorf("masking cannot be combined with parallel dumps")
+	}
+
+	masker := &dumpMasker{mysql: conn.Type != "postgresql", salt: make([]byte, 16)}
+	if _, err := rand.Read(masker.salt); err != nil {
+		return nil, err
+	}
+	for _, rule := range schedule.MaskingRules {
+		compiled, err := compileMaskingRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		masker.rules = append(masker.rules, compiled)
+	}
+	return masker, nil
+}
+
+// unquoteIdentifier strips the quotes of each part of a possibly qualified
+// identifier such as public."Users" or `users`
+func unquoteIdentifier(name string) string {
+	parts := strings.Split(strings.TrimSpace(name), ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(part, "\"`")
+	}
+	return strings.Join(parts, ".")
+}
+
+func (m *dumpMasker) matchesTable(rule *compiledMaskingRule, table string) bool {
+	if rule.Table == "" {
+		return true
+	}
+	want := strings.ToLower(unquoteIdentifier(rule.Table))
+	table = strings.ToLower(table)
+	if want == table {
+		return true
+	}
+	// Unqualified rules match the table in any schema
+	return !strings.Contains(want, ".") && strings.HasSuffix(table, "."+want)
+}
+
+// columnRules returns the rules of each column of a table, or nil when no
+// column of the table is masked
+func (m *dumpMasker) columnRules(table string, columns []string) [][]*compiledMaskingRule {
+	var result [][]*compiledMaskingRule
+	for i, column := range columns {
+		for _, rule := range m.rules {
+			if !strings.EqualFold(rule.Column, column) || !m.matchesTable(rule, table) {
+				continue
+			}
+			if result == nil {
+				result = make([][]*compiledMaskingRule, len(columns))
+			}
+			result[i] = append(result[i], rule)
+		}
+	}
+	return result
+}
+
+// mask applies rules to a value in order
+func (m *dumpMasker) mask(rules []*compiledMaskingRule, value string) string {
+	for _, rule := range rules {
+		if rule.pattern != nil {
+			value = rule.pattern.ReplaceAllString(value, rule.Replacement)
+		} else if value != "" {
+			value = m.fake(rule.Faker, value)
+		}
+	}
+	return value
+}
+
+var (
+	fakeFirstNames = []string{"Alex", "Sam", "Jordan", "Taylor", "Morgan", "Casey", "Riley", "Jamie",
+		"Avery", "Quinn", "Robin", "Drew", "Charlie", "Skyler", "Rowan", "Emerson"}
+	fakeLastNames = []string{"Smith", "Johnson", "Brown", "Garcia", "Miller", "Davis", "Martinez", "Lopez",
+		"Wilson", "Anderson", "Thomas", "Moore", "Jackson", "Martin", "Lee", "Clark"}
+)
+
+// fake returns generated data of a kind, derived from the value and the
+// dump's salt
+func (m *dumpMasker) fake(kind, value string) string {
+	sum := sha256.Sum256(append(append([]byte{}, m.salt...), value...))
+	first := fakeFirstNames[int(sum[0])%len(fakeFirstNames)]
+	last := fakeLastNames[int(sum[1])%len(fakeLastNames)]
+
+	switch kind {
+	case MaskingFakerEmail:
+		// The hash suffix keeps unique columns unique
+		return fmt.Sprintf("%s.%s.%s@example.com", strings.ToLower(first), strings.ToLower(last), hex.EncodeToString(sum[2:7]))
+	case MaskingFakerName:
+		return first + " " + last
+	case MaskingFakerFirstName:
+		return first
+	case MaskingFakerLastName:
+		return last
+	case MaskingFakerPhone:
+		return fmt.Sprintf("+1-555-%03d-%04d", (int(sum[2])<<8|int(sum[3]))%1000, (int(sum[4])<<8|int(sum[5]))%10000)
+	case MaskingFakerToken:
+		// Tokens keep their length, so column limits still hold
+		token := hex.EncodeToString(sum[:])
+		for len(token) < len(value) {
+			next := sha256.Sum256([]byte(token))
+			token += hex.EncodeToString(next[:])
+		}
+		return token[:len(value)]
+	case MaskingFakerUUID:
+		return uuid.NewSHA1(uuid.Nil, sum[:]).String()
+	}
+	return value
+}
+
+// maskingWriter rewrites the rows of a SQL dump as it is written: the lines of
+// COPY blocks, and the values of INSERT statements, whose columns come from
+// the statement or the table's CREATE TABLE. After an error it keeps
+// accepting and discarding input, so the dump tool is not blocked writing,
+// and Close reports the error.
+type maskingWriter struct {
+	masker  *dumpMasker
+	out     *bufio.Writer
+	pending []byte
+	err     error
+	masked  int64
+
+	// tables are the column names of the tables created so far
+	tables      map[string][]string
+	createTable string
+	createCols  []string
+
+	inCopy    bool
+	copyRules [][]*compiledMaskingRule
+
+	// statement collects an INSERT whose string literals span lines
+	statement []byte
+}
+
+func (m *dumpMasker) writer(out io.Writer) *maskingWriter {
+	return &maskingWriter{
+		masker: m,
+		out:    bufio.NewWriterSize(out, 64*1024),
+		tables: make(map[string][]string),
+	}
+}
+
+func (w *maskingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return len(p), nil
+	}
+
+	w.pending = append(w.pending, p...)
+	for w.err == nil {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.err = w.processLine(w.pending[:i])
+		w.pending = w.pending[i+1:]
+	}
+	if len(w.pending) == 0 {
+		w.pending = nil
+	}
+	return len(p), nil
+}
+
+// Close processes an unterminated last line and flushes the output
+func (w *maskingWriter) Close() error {
+	if w.err == nil && len(w.pending) > 0 {
+		w.err = w.processLine(w.pending)
+		w.pending = nil
+	}
+	if w.err == nil && w.statement != nil {
+		w.err = fmt.Errorf("dump ends inside an INSERT statement")
+	}
+	if w.err == nil {
+		w.err = w.out.Flush()
+	}
+	return w.err
+}
+
+func (w *maskingWriter) writeLine(line []byte) error {
+	if _, err := w.out.Write(line); err != nil {
+		return err
+	}
+	return w.out.WriteByte('\n')
+}
+
+func (w *maskingWriter) processLine(line []byte) error {
+	if w.inCopy {
+		if string(line) == `\.` {
+			w.inCopy = false
+			w.copyRules = nil
+			return w.writeLine(line)
+		}
+		if w.copyRules == nil {
+			return w.writeLine(line)
+		}
+		masked, err := w.maskCopyRow(string(line))
+		if err != nil {
+			return err
+		}
+		return w.writeLine([]byte(masked))
+	}
+
+	if w.statement != nil {
+		w.statement = append(append(w.statement, '\n'), line...)
+		return w.processStatement()
+	}
+
+	text := string(line)
+	if w.createTable != "" {
+		w.collectCreateColumn(text)
+		return w.writeLine(line)
+	}
+
+	switch {
+	case strings.HasPrefix(text, "INSERT INTO "):
+		w.statement = append([]byte{}, line...)
+		return w.processStatement()
+	case strings.HasPrefix(text, "COPY ") && strings.HasSuffix(text, " FROM stdin;"):
+		table, columns, err := parseCopyHeader(text)
+		if err != nil {
+			return err
+		}
+		w.inCopy = true
+		w.copyRules = w.masker.columnRules(table, columns)
+	case strings.HasPrefix(text, "CREATE TABLE ") && strings.HasSuffix(text, "("):
+		name := strings.TrimSuffix(strings.TrimPrefix(text, "CREATE TABLE "), "(")
+		name = strings.TrimPrefix(strings.TrimSpace(name), "IF NOT EXISTS ")
+		w.createTable = unquoteIdentifier(name)
+		w.createCols = nil
+	}
+	return w.writeLine(line)
+}
+
+// createTableKeywords start the lines of a CREATE TABLE that are not columns
+var createTableKeywords = map[string]bool{
+	"CONSTRAINT": true, "PRIMARY": true, "KEY": true, "UNIQUE": true, "INDEX": true,
+	"FOREIGN": true, "CHECK": true, "FULLTEXT": true, "SPATIAL": true, "EXCLUDE": true, "LIKE": true,
+}
+
+func (w *maskingWriter) collectCreateColumn(line string) {
+	trimmed := strings.TrimSpace(line)
+	if strings.HasPrefix(trimmed, ")") {
+		w.tables[strings.ToLower(w.createTable)] = w.createCols
+		w.createTable = ""
+		return
+	}
+	if trimmed == "" {
+		return
+	}
+
+	var name string
+	if quote := trimmed[0]; quote == '"' || quote == '`' {
+		end := strings.IndexByte(trimmed[1:], quote)
+		if end < 0 {
+			return
+		}
+		name = trimmed[1 : end+1]
+	} else {
+		name = strings.Fields(trimmed)[0]
+		if createTableKeywords[strings.ToUpper(name)] {
+			return
+		}
+	}
+	w.createCols = append(w.createCols, name)
+}
+
+// parseCopyHeader reads the table and columns of a line such as
+// COPY public.users (id, email) FROM stdin;
+func parseCopyHeader(line string) (string, []string, error) {
+	header := strings.TrimSuffix(strings.TrimPrefix(line, "COPY "), " FROM stdin;")
+	open := strings.Index(header, " (")
+	if open < 0 || !strings.HasSuffix(header, ")") {
+		return "", nil, fmt.Errorf("unexpected COPY statement: %s", line)
+	}
+
+	var columns []string
+	for _, column := range strings.Split(header[open+2:len(header)-1], ",") {
+		columns = append(columns, unquoteIdentifier(column))
+	}
+	return unquoteIdentifier(header[:open]), columns, nil
+}
+
+func (w *maskingWriter) maskCopyRow(row string) (string, error) {
+	fields := strings.Split(row, "\t")
+	if len(fields) != len(w.copyRules) {
+		return "", fmt.Errorf("COPY row has %d fields, expected %d", len(fields), len(w.copyRules))
+	}
+	for i, rules := range w.copyRules {
+		if rules == nil || fields[i] == `\N` {
+			continue
+		}
+		fields[i] = encodeCopyField(w.masker.mask(rules, decodeCopyField(fields[i])))
+		w.masked++
+	}
+	return strings.Join(fields, "\t"), nil
+}
+
+var copyEscapes = map[byte]byte{'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v'}
+
+// decodeCopyField undoes the backslash escapes of COPY's text format
+func decodeCopyField(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' || i+1 == len(field) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		next := field[i]
+		switch {
+		case copyEscapes[next] != 0:
+			b.WriteByte(copyEscapes[next])
+		case next >= '0' && next <= '7':
+			value, n := 0, 0
+			for ; n < 3 && i+n < len(field) && field[i+n] >= '0' && field[i+n] <= '7'; n++ {
+				value = value*8 + int(field[i+n]-'0')
+			}
+			b.WriteByte(byte(value))
+			i += n - 1
+		case next == 'x' && i+1 < len(field) && isHexDigit(field[i+1]):
+			n := 1
+			if i+2 < len(field) && isHexDigit(field[i+2]) {
+				n = 2
+			}
+			decoded, _ := hex.DecodeString(strings.Repeat("0", 2-n) + field[i+1:i+1+n])
+			b.Write(decoded)
+			i += n
+		default:
+			b.WriteByte(next)
+		}
+	}
+	return b.String()
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+var copyFieldEncoder = strings.NewReplacer(`\`, `\\`, "\b", `\b`, "\f", `\f`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "\v", `\v`)
+
+func encodeCopyField(value string) string {
+	return copyFieldEncoder.Replace(value)
+}
+
+// statementComplete reports whether a statement ends with a semicolon outside
+// of quotes. MySQL escapes quotes in literals with backslashes.
+func statementComplete(statement []byte, backslashEscapes bool) bool {
+	var quote byte
+	for i := 0; i < len(statement); i++ {
+		c := statement[i]
+		switch {
+		case quote == 0 && (c == '\'' || c == '"' || c == '`'):
+			quote = c
+		case quote != 0 && c == '\\' && backslashEscapes && quote == '\'':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		}
+	}
+	return quote == 0 && bytes.HasSuffix(bytes.TrimRight(statement, " \t\r"), []byte(";"))
+}
+
+// processStatement rewrites the collected INSERT once it is complete
+func (w *maskingWriter) processStatement() error {
+	if !statementComplete(w.statement, w.masker.mysql) {
+		return nil
+	}
+
+	statement := string(w.statement)
+	w.statement = nil
+	masked, err := w.maskInsert(statement)
+	if err != nil {
+		return err
+	}
+	return w.writeLine([]byte(masked))
+}
+
+// maskInsert rewrites the masked columns of an INSERT statement and returns
+// other statements unchanged
+func (w *maskingWriter) maskInsert(statement string) (string, error) {
+	p := &sqlScanner{s: statement, i: len("INSERT INTO "), backslashEscapes: w.masker.mysql}
+	table := unquoteIdentifier(p.identifier())
+
+	var columns []string
+	p.skipSpace()
+	if p.peek() == '(' {
+		p.i++
+		for {
+			p.skipSpace()
+			columns = append(columns, unquoteIdentifier(p.identifier()))
+			p.skipSpace()
+			if p.peek() == ')' {
+				p.i++
+				break
+			}
+			if p.peek() != ',' {
+				return "", fmt.Errorf("unexpected column list in INSERT into %s", table)
+			}
+			p.i++
+		}
+	} else {
+		columns = w.tables[strings.ToLower(table)]
+	}
+
+	p.skipSpace()
+	if !strings.HasPrefix(strings.ToUpper(statement[p.i:]), "VALUES") {
+		return "", fmt.Errorf("unexpected INSERT into %s", table)
+	}
+	p.i += len("VALUES")
+
+	rules := w.masker.columnRules(table, columns)
+	if rules == nil {
+		for _, rule := range w.masker.rules {
+			if columns == nil && w.masker.matchesTable(rule, table) {
+				return "", fmt.Errorf("columns of table %s are unknown, cannot mask %s", table, rule.Column)
+			}
+		}
+		return statement, nil
+	}
+
+	var out strings.Builder
+	out.WriteString(statement[:p.i])
+	for {
+		out.WriteString(p.space())
+		if p.peek() != '(' {
+			return "", fmt.Errorf("unexpected values in INSERT into %s", table)
+		}
+		p.i++
+		out.WriteByte('(')
+
+		for column := 0; ; column++ {
+			out.WriteString(p.space())
+			value, quoted, err := p.value()
+			if err != nil {
+				return "", fmt.Errorf("INSERT into %s: %v", table, err)
+			}
+			if column >= len(rules) {
+				return "", fmt.Errorf("INSERT into %s has more values than columns", table)
+			}
+			if rules[column] == nil || (!quoted && strings.EqualFold(value, "NULL")) {
+				out.WriteString(p.s[p.start:p.i])
+			} else {
+				out.WriteString(w.quoteLiteral(w.masker.mask(rules[column], value)))
+				w.masked++
+			}
+
+			out.WriteString(p.space())
+			switch p.peek() {
+			case ',':
+				p.i++
+				out.WriteByte(',')
+				continue
+			case ')':
+				p.i++
+				out.WriteByte(')')
+			default:
+				return "", fmt.Errorf("unexpected values in INSERT into %s", table)
+			}
+			break
+		}
+
+		out.WriteString(p.space())
+		if p.peek() == ',' {
+			p.i++
+			out.WriteByte(',')
+			continue
+		}
+		out.WriteString(p.s[p.i:])
+		return out.String(), nil
+	}
+}
+
+var mysqlLiteralEncoder = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\x00", `\0`, "\x1a", `\Z`)
+
+func (w *maskingWriter) quoteLiteral(value string) string {
+	if w.masker.mysql {
+		return "'" + mysqlLiteralEncoder.Replace(value) + "'"
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// sqlScanner reads the parts of an INSERT statement
+type sqlScanner struct {
+	s                string
+	i                int
+	start            int
+	backslashEscapes bool
+}
+
+func (p *sqlScanner) peek() byte {
+	if p.i < len(p.s) {
+		return p.s[p.i]
+	}
+	return 0
+}
+
+func (p *sqlScanner) skipSpace() {
+	p.space()
+}
+
+// space consumes whitespace and returns it
+func (p *sqlScanner) space() string {
+	start := p.i
+	for p.i < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.i]) >= 0 {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// identifier reads a possibly quoted and qualified identifier
+func (p *sqlScanner) identifier() string {
+	start := p.i
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		if c == '"' || c == '`' {
+			end := strings.IndexByte(p.s[p.i+1:], c)
+			if end < 0 {
+				p.i = len(p.s)
+				break
+			}
+			p.i += end + 2
+			continue
+		}
+		if c == ' ' || c == '(' || c == ',' || c == ')' || c == '\n' || c == '\t' {
+			break
+		}
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// value reads a value of a row. String literals are returned decoded; other
+// values such as numbers and NULL are returned as written.
+func (p *sqlScanner) value() (string, bool, error) {
+	p.start = p.i
+	if p.peek() == '\'' {
+		var b strings.Builder
+		for p.i++; p.i < len(p.s); p.i++ {
+			c := p.s[p.i]
+			switch {
+			case c == '\\' && p.backslashEscapes && p.i+1 < len(p.s):
+				p.i++
+				b.WriteByte(unescapeMySQL(p.s[p.i]))
+			case c == '\'' && p.i+1 < len(p.s) && p.s[p.i+1] == '\'':
+				p.i++
+				b.WriteByte('\'')
+			case c == '\'':
+				p.i++
+				return b.String(), true, nil
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", false, fmt.Errorf("unterminated string literal")
+	}
+
+	depth := 0
+	var quote byte
+	for ; p.i < len(p.s); p.i++ {
+		c := p.s[p.i]
+		switch {
+		case quote != 0:
+			if c == '\\' && p.backslashEscapes {
+				p.i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case (c == ',' || c == ')') && depth == 0:
+			return strings.TrimSpace(p.s[p.start:p.i]), false, nil
+		}
+	}
+	return "", false, fmt.Errorf("unterminated row")
+}
+
+func unescapeMySQL(c byte) byte {
+	switch c {
+	case '0':
+		return 0
+	case 'b':
+		return '\b'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'Z':
+		return 0x1a
+	}
+	return c
+}
+
+// maskDumpFile rewrites a dump written to disk through the masking stage. If
+// masking fails the dump is removed, so no unmasked copy is left behind. ctx
+// carries the job ID of the run into its log lines.
+func maskDumpFile(ctx context.Context, path string, masker *dumpMasker) error {
+	if err := maskDumpFileInPlace(ctx, path, masker); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to mask dump: %v", err)
+	}
+	return nil
+}
+
+func maskDumpFileInPlace(ctx context.Context, path string, masker *dumpMasker) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	tempPath := path + ".masking"
+	dst, err := os.Create(tempPath)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	defer os.Remove(tempPath)
+
+	w := masker.writer(dst)
+	_, err = io.Copy(w, src)
+	src.Close()
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Masked values in dump", "masked", w.masked, "path", path)
+	return nil
+}
@@ -0,0 +1,319 @@
+package backup
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func newTestMasker(t *testing.T, mysql bool, rules ...MaskingRule) *dumpMasker {
+	t.Helper()
+	masker := &dumpMasker{mysql: mysql, salt: []byte("0123456789abcdef")}
+	for _, rule := range rules {
+		compiled, err := compileMaskingRule(rule)
+		if err != nil {
+			t.Fatalf("compileMaskingRule(%+v) returned error: %v", rule, err)
+		}
+		masker.rules = append(masker.rules, compiled)
+	}
+	return masker
+}
+
+func TestCompileMaskingRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    MaskingRule
+		wantErr bool
+	}{
+		{name: "pattern", rule: MaskingRule{Column: "email", Pattern: `^[^@]+`, Replacement: "user"}},
+		{name: "faker", rule: MaskingRule{Table: "users", Column: "name", Faker: MaskingFakerName}},
+		{name: "missing column", rule: MaskingRule{Faker: MaskingFakerEmail}, wantErr: true},
+		{name: "neither pattern nor faker", rule: MaskingRule{Column: "email"}, wantErr: true},
+		{name: "both pattern and faker", rule: MaskingRule{Column: "email", Pattern: "x", Faker: MaskingFakerEmail}, wantErr: true},
+		{name: "invalid pattern", rule: MaskingRule{Column: "email", Pattern: "("}, wantErr: true},
+		{name: "unknown faker", rule: MaskingRule{Column: "email", Faker: "address"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileMaskingRule(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compileMaskingRule(%+v) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaskingRuleMatchesTable(t *testing.T) {
+	tests := []struct {
+		name      string
+		ruleTable string
+		table     string
+		want      bool
+	}{
+		{name: "any table", ruleTable: "", table: "public.users", want: true},
+		{name: "same name", ruleTable: "users", table: "users", want: true},
+		{name: "unqualified matches any schema", ruleTable: "users", table: "public.users", want: true},
+		{name: "case insensitive", ruleTable: "Users", table: "public.users", want: true},
+		{name: "quoted rule table", ruleTable: `public."users"`, table: "public.users", want: true},
+		{name: "qualified rule needs the same schema", ruleTable: "audit.users", table: "public.users", want: false},
+		{name: "suffix is not a match", ruleTable: "users", table: "public.app_users", want: false},
+		{name: "other table", ruleTable: "users", table: "orders", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			masker := newTestMasker(t, false, MaskingRule{Table: tt.ruleTable, Column: "email", Faker: MaskingFakerEmail})
+			if got := masker.matchesTable(masker.rules[0], tt.table); got != tt.want {
+				t.Errorf("matchesTable(%q, %q) = %v, want %v", tt.ruleTable, tt.table, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDumpMaskerMask(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []MaskingRule
+		value string
+		check func(t *testing.T, masked string)
+	}{
+		{
+			name:  "pattern with group",
+			rules: []MaskingRule{{Column: "email", Pattern: `^[^@]+@(.+)$`, Replacement: "masked@$1"}},
+			value: "alice@example.org",
+			check: expectMasked("masked@example.org"),
+		},
+		{
+			name: "rules apply in order",
+			rules: []MaskingRule{
+				{Column: "phone", Pattern: `\d`, Replacement: "9"},
+				{Column: "phone", Pattern: `^9{3}`, Replacement: "000"},
+			},
+			value: "555-1234",
+			check: expectMasked("000-9999"),
+		},
+		{
+			name:  "empty value is not faked",
+			rules: []MaskingRule{{Column: "name", Faker: MaskingFakerName}},
+			value: "",
+			check: expectMasked(""),
+		},
+		{
+			name:  "email faker",
+			rules: []MaskingRule{{Column: "email", Faker: MaskingFakerEmail}},
+			value: "alice@example.org",
+			check: expectPattern(`^[a-z]+\.[a-z]+\.[0-9a-f]{10}@example\.com$`),
+		},
+		{
+			name:  "name faker",
+			rules: []MaskingRule{{Column: "name", Faker: MaskingFakerName}},
+			value: "Alice Liddell",
+			check: expectPattern(`^[A-Z][a-z]+ [A-Z][a-z]+$`),
+		},
+		{
+			name:  "phone faker",
+			rules: []MaskingRule{{Column: "phone", Faker: MaskingFakerPhone}},
+			value: "+44 20 7946 0000",
+			check: expectPattern(`^\+1-555-\d{3}-\d{4}$`),
+		},
+		{
+			name:  "token faker keeps the length",
+			rules: []MaskingRule{{Column: "api_key", Faker: MaskingFakerToken}},
+			value: strings.Repeat("k", 100),
+			check: expectPattern(`^[0-9a-f]{100}$`),
+		},
+		{
+			name:  "uuid faker",
+			rules: []MaskingRule{{Column: "external_id", Faker: MaskingFakerUUID}},
+			value: "8d2f6a1e-0000-4000-8000-000000000000",
+			check: expectPattern(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			masker := newTestMasker(t, false, tt.rules...)
+			masked := masker.mask(masker.rules, tt.value)
+			tt.check(t, masked)
+			if again := masker.mask(masker.rules, tt.value); again != masked {
+				t.Errorf("masking is not deterministic within a dump: %q then %q", masked, again)
+			}
+		})
+	}
+}
+
+func expectMasked(want string) func(t *testing.T, masked string) {
+	return func(t *testing.T, masked string) {
+		t.Helper()
+		if masked != want {
+			t.Errorf("masked = %q, want %q", masked, want)
+		}
+	}
+}
+
+func expectPattern(pattern string) func(t *testing.T, masked string) {
+	re := regexp.MustCompile(pattern)
+	return func(t *testing.T, masked string) {
+		t.Helper()
+		if !re.MatchString(masked) {
+			t.Errorf("masked = %q, want a match of %s", masked, pattern)
+		}
+	}
+}
+
+func TestMaskingWriter(t *testing.T) {
+	redact := MaskingRule{Table: "users", Column: "email", Pattern: `.+`, Replacement: "redacted"}
+
+	tests := []struct {
+		name    string
+		mysql   bool
+		rules   []MaskingRule
+		dump    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "postgres COPY block",
+			rules: []MaskingRule{redact},
+			dump:  "COPY public.users (id, email) FROM stdin;\n1\talice@example.org\n2\t\\N\n\\.\n",
+			want:  "COPY public.users (id, email) FROM stdin;\n1\tredacted\n2\t\\N\n\\.\n",
+		},
+		{
+			name:  "COPY of another table is unchanged",
+			rules: []MaskingRule{redact},
+			dump:  "COPY public.orders (id, email) FROM stdin;\n1\talice@example.org\n\\.\n",
+			want:  "COPY public.orders (id, email) FROM stdin;\n1\talice@example.org\n\\.\n",
+		},
+		{
+			name:    "COPY row with missing fields",
+			rules:   []MaskingRule{redact},
+			dump:    "COPY public.users (id, email) FROM stdin;\n1\n\\.\n",
+			wantErr: true,
+		},
+		{
+			name:  "postgres INSERT with column list",
+			rules: []MaskingRule{redact},
+			dump:  "INSERT INTO public.users (id, email) VALUES (1, 'alice@example.org'), (2, NULL);\n",
+			want:  "INSERT INTO public.users (id, email) VALUES (1, 'redacted'), (2, NULL);\n",
+		},
+		{
+			name:  "postgres INSERT quotes the masked value",
+			rules: []MaskingRule{{Table: "users", Column: "email", Pattern: `.+`, Replacement: "o'hara"}},
+			dump:  "INSERT INTO users (id, email) VALUES (1, 'alice@example.org');\n",
+			want:  "INSERT INTO users (id, email) VALUES (1, 'o''hara');\n",
+		},
+		{
+			name:  "mysql INSERT uses the columns of CREATE TABLE",
+			mysql: true,
+			rules: []MaskingRule{redact},
+			dump: "CREATE TABLE `users` (\n  `id` int NOT NULL,\n  `email` varchar(255),\n  PRIMARY KEY (`id`)\n);\n" +
+				"INSERT INTO `users` VALUES (1,'alice@example.org'),(2,'bob@example.org');\n",
+			want: "CREATE TABLE `users` (\n  `id` int NOT NULL,\n  `email` varchar(255),\n  PRIMARY KEY (`id`)\n);\n" +
+				"INSERT INTO `users` VALUES (1,'redacted'),(2,'redacted');\n",
+		},
+		{
+			name:  "mysql INSERT spanning lines",
+			mysql: true,
+			rules: []MaskingRule{{Table: "users", Column: "bio", Pattern: `(?s).+`, Replacement: "x"}},
+			dump:  "INSERT INTO `users` (`id`, `bio`) VALUES (1,'line one\nline two; it\\'s');\n",
+			want:  "INSERT INTO `users` (`id`, `bio`) VALUES (1,'x');\n",
+		},
+		{
+			name:    "INSERT into a table with unknown columns",
+			mysql:   true,
+			rules:   []MaskingRule{redact},
+			dump:    "INSERT INTO `users` VALUES (1,'alice@example.org');\n",
+			wantErr: true,
+		},
+		{
+			name:    "dump ends inside an INSERT",
+			rules:   []MaskingRule{redact},
+			dump:    "INSERT INTO users (id, email) VALUES (1, 'alice",
+			wantErr: true,
+		},
+		{
+			name:  "other statements are unchanged",
+			rules: []MaskingRule{redact},
+			dump:  "SET statement_timeout = 0;\nCREATE INDEX users_email ON public.users (email);\n",
+			want:  "SET statement_timeout = 0;\nCREATE INDEX users_email ON public.users (email);\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			masker := newTestMasker(t, tt.mysql, tt.rules...)
+			var out bytes.Buffer
+			w := masker.writer(&out)
+			if _, err := w.Write([]byte(tt.dump)); err != nil {
+				t.Fatalf("Write returned error: %v", err)
+			}
+			err := w.Close()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Close returned no error, output %q", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Close returned error: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("masked dump =\n%q\nwant\n%q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyFieldEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   string
+		decoded string
+	}{
+		{name: "plain", field: "alice", decoded: "alice"},
+		{name: "tab and newline", field: `a\tb\nc`, decoded: "a\tb\nc"},
+		{name: "backslash", field: `C:\\temp`, decoded: `C:\temp`},
+		{name: "octal", field: `\101\102`, decoded: "AB"},
+		{name: "hex", field: `\x41\x4`, decoded: "A\x04"},
+		{name: "unknown escape", field: `\q`, decoded: "q"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded := decodeCopyField(tt.field)
+			if decoded != tt.decoded {
+				t.Errorf("decodeCopyField(%q) = %q, want %q", tt.field, decoded, tt.decoded)
+			}
+			if again := decodeCopyField(encodeCopyField(decoded)); again != decoded {
+				t.Errorf("encodeCopyField does not round-trip %q: got %q", decoded, again)
+			}
+		})
+	}
+}
+
+func TestStatementComplete(t *testing.T) {
+	tests := []struct {
+		name             string
+		statement        string
+		backslashEscapes bool
+		want             bool
+	}{
+		{name: "complete", statement: "INSERT INTO t VALUES (1);", want: true},
+		{name: "trailing space", statement: "INSERT INTO t VALUES (1);  ", want: true},
+		{name: "no semicolon", statement: "INSERT INTO t VALUES (1)", want: false},
+		{name: "semicolon inside literal", statement: "INSERT INTO t VALUES ('a;", want: false},
+		{name: "doubled quote", statement: "INSERT INTO t VALUES ('it''s');", want: true},
+		{name: "mysql escaped quote", statement: `INSERT INTO t VALUES ('it\'s;`, backslashEscapes: true, want: false},
+		{name: "mysql escaped quote closed", statement: `INSERT INTO t VALUES ('it\'s');`, backslashEscapes: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statementComplete([]byte(tt.statement), tt.backslashEscapes); got != tt.want {
+				t.Errorf("statementComplete(%q) = %v, want %v", tt.statement, got, tt.want)
+			}
+		})
+	}
+}
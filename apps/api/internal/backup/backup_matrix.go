@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/google/uuid"
+)
+
+// matrixMessage formats a notification with its metadata for a Matrix room
+func matrixMessage(n *notification.Notification, metadata map[string]interface{}) *notification.MatrixMessage {
+	var fields []notification.MatrixField
+	for _, field := range notificationFields {
+		value, ok := metadata[field.key]
+		if !ok || value == nil {
+			continue
+		}
+		text := fmt.Sprint(value)
+		if text == "" {
+			continue
+		}
+		fields = append(fields, notification.MatrixField{Label: field.label, Value: text})
+	}
+	return notification.NewMatrixMessage(n, fields)
+}
+
+// sendMatrix posts msg with the Matrix account of the settings; a non-empty
+// room ID overrides the configured room
+func (s *BackupService) sendMatrix(userSettings *settings.UserSettings, roomID string, msg *notification.MatrixMessage) error {
+	if roomID == "" && userSettings.MatrixRoomID != nil {
+		roomID = *userSettings.MatrixRoomID
+	}
+	if userSettings.MatrixHomeserverURL == nil || userSettings.MatrixAccessToken == nil || roomID == "" {
+		return fmt.Errorf("no Matrix homeserver URL, access token or room ID configured")
+	}
+	token, err := s.cryptoService.Decrypt(*userSettings.MatrixAccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt Matrix access token: %v", err)
+	}
+	return notification.SendMatrix(*userSettings.MatrixHomeserverURL, token, roomID, msg)
+}
+
+// notifyMatrix posts n to the Matrix room of the settings, when Matrix
+// notifications are on, without waiting for the homeserver
+func (s *BackupService) notifyMatrix(userSettings *settings.UserSettings, n *notification.Notification, metadata map[string]interface{}) {
+	if !userSettings.NotifyMatrix {
+		return
+	}
+
+	msg := matrixMessage(n, metadata)
+	go func() {
+		if err := s.sendMatrix(userSettings, "", msg); err != nil {
+			slog.Warn("Failed to send notification to Matrix", "type", n.Type, "error", err)
+		}
+	}()
+}
+
+// notifySuccessToMatrix posts a successful backup or restore to Matrix when
+// the user asked for successes as well
+func (s *BackupService) notifySuccessToMatrix(userID uuid.UUID, n *notification.Notification, metadata map[string]interface{}) {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	if err != nil || userSettings == nil || !userSettings.MatrixNotifySuccess {
+		return
+	}
+	s.notifyMatrix(userSettings, n, metadata)
+}
@@ -0,0 +1,138 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// connectionRunMetrics is the outcome of the latest backup runs of a connection
+type connectionRunMetrics struct {
+	ConnectionID   string
+	ConnectionName string
+	DatabaseType   string
+	LastRun        time.Time
+	LastSuccess    *time.Time
+	Success        bool
+	Duration       time.Duration
+	Size           int64
+	Successes      int
+	Failures       int
+}
+
+// recordRunMetrics updates the in-memory run metrics and, when
+// METRICS_TEXTFILE_PATH is set, rewrites the node_exporter textfile so hosts
+// without scraping still pick up backup health.
+func (s *BackupService) recordRunMetrics(connectionID string, startTime time.Time, backup *Backup, runErr error) {
+	s.metricsMu.Lock()
+	defer s.metricsMu.Unlock()
+
+	m, ok := s.runMetrics[connectionID]
+	if !ok {
+		m = &connectionRunMetrics{ConnectionID: connectionID}
+		s.runMetrics[connectionID] = m
+	}
+
+	if conn, err := s.connStorage.GetConnection(connectionID); err == nil {
+		m.ConnectionName = conn.Name
+		m.DatabaseType = conn.Type
+	}
+
+	now := time.Now()
+	m.LastRun = now
+	m.Duration = now.Sub(startTime)
+	m.Success = runErr == nil
+	if runErr == nil {
+		m.Successes++
+		m.LastSuccess = &now
+		if backup != nil {
+			m.Size = backup.Size
+		}
+	} else {
+		m.Failures++
+	}
+
+	path := strings.TrimSpace(os.Getenv("METRICS_TEXTFILE_PATH"))
+	if path == "" {
+		return
+	}
+
+	if err := writeMetricsTextfile(path, s.runMetrics); err != nil {
+		slog.Warn("Failed to write metrics textfile", "path", path, "error", err)
+	}
+}
+
+// writeMetricsTextfile writes the metrics in the Prometheus text format. The
+// file is replaced atomically so the collector never reads a partial file.
+func writeMetricsTextfile(path string, metrics map[string]*connectionRunMetrics) error {
+	connections := make([]*connectionRunMetrics, 0, len(metrics))
+	for _, m := range metrics {
+		connections = append(connections, m)
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].ConnectionID < connections[j].ConnectionID
+	})
+
+	var b strings.Builder
+	writeGauge := func(name, help string, value func(m *connectionRunMetrics) (float64, bool)) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, m := range connections {
+			if v, ok := value(m); ok {
+				fmt.Fprintf(&b, "%s{%s} %g\n", name, metricLabels(m), v)
+			}
+		}
+	}
+
+	writeGauge("velld_backup_last_run_timestamp_seconds", "Unix time of the last backup run.",
+		func(m *connectionRunMetrics) (float64, bool) { return float64(m.LastRun.Unix()), true })
+	writeGauge("velld_backup_last_run_success", "Whether the last backup run succeeded (1) or failed (0).",
+		func(m *connectionRunMetrics) (float64, bool) {
+			if m.Success {
+				return 1, true
+			}
+			return 0, true
+		})
+	writeGauge("velld_backup_last_success_timestamp_seconds", "Unix time of the last successful backup.",
+		func(m *connectionRunMetrics) (float64, bool) {
+			if m.LastSuccess == nil {
+				return 0, false
+			}
+			return float64(m.LastSuccess.Unix()), true
+		})
+	writeGauge("velld_backup_last_duration_seconds", "Duration of the last backup run.",
+		func(m *connectionRunMetrics) (float64, bool) { return m.Duration.Seconds(), true })
+	writeGauge("velld_backup_last_size_bytes", "Size of the last successful backup artifact.",
+		func(m *connectionRunMetrics) (float64, bool) { return float64(m.Size), m.LastSuccess != nil })
+
+	fmt.Fprintf(&b, "# HELP velld_backup_runs_total Backup runs since velld started.\n# TYPE velld_backup_runs_total counter\n")
+	for _, m := range connections {
+		labels := metricLabels(m)
+		fmt.Fprintf(&b, "velld_backup_runs_total{%s,result=\"success\"} %d\n", labels, m.Successes)
+		fmt.Fprintf(&b, "velld_backup_runs_total{%s,result=\"failure\"} %d\n", labels, m.Failures)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+func metricLabels(m *connectionRunMetrics) string {
+	return fmt.Sprintf(`connection_id="%s",connection_name="%s",database_type="%s"`,
+		escapeLabelValue(m.ConnectionID), escapeLabelValue(m.ConnectionName), escapeLabelValue(m.DatabaseType))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
@@ -0,0 +1,170 @@
+package backup
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// MongoDB dump archives are named after the options they were taken with, so
+// restores know whether to decompress and replay the oplog.
+const (
+	mongoArchiveExtension = ".archive"
+	mongoOplogExtension   = ".oplog"
+	mongoGzipExtension    = ".gz"
+)
+
+// MongoDumpOptions are per-schedule mongodump toggles. Oplog captures writes
+// made during the dump so the archive is a consistent snapshot; it needs a
+// replica set and dumps the whole deployment. ReadFromSecondary offloads the
+// dump from the primary.
+type MongoDumpOptions struct {
+	Oplog             bool `json:"oplog"`
+	Gzip              bool `json:"gzip"`
+	ReadFromSecondary bool `json:"read_from_secondary"`
+}
+
+func (o *MongoDumpOptions) isEmpty() bool {
+	return !o.Oplog && !o.Gzip && !o.ReadFromSecondary
+}
+
+// Value stores the options as JSON in a nullable text column
+func (o MongoDumpOptions) Value() (driver.Value, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (o *MongoDumpOptions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	case []byte:
+		return json.Unmarshal(v, o)
+	default:
+		return fmt.Errorf("cannot scan %T into mongo dump options", src)
+	}
+}
+
+// validateMongoDumpOptions checks the options submitted with a schedule
+// request. filters are the dump filters the schedule will have, since
+// mongodump cannot select collections of an oplog dump. All toggles off
+// clears the options.
+func (s *BackupService) validateMongoDumpOptions(connectionID string, options *MongoDumpOptions, filters *DumpFilters) (*MongoDumpOptions, error) {
+	if options == nil || options.isEmpty() {
+		return nil, nil
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	if conn.Type != "mongodb" {
+		return nil, fmt.Errorf("mongodump options are only supported for mongodb connections")
+	}
+
+	if options.Oplog {
+		if len(conn.SelectedDatabases) > 0 {
+			return nil, fmt.Errorf("oplog dumps include every database and cannot be combined with selected databases")
+		}
+		if filters != nil && !filters.isEmpty() {
+			return nil, fmt.Errorf("oplog dumps include every collection and cannot be combined with dump filters")
+		}
+	}
+
+	return &MongoDumpOptions{
+		Oplog:             options.Oplog,
+		Gzip:              options.Gzip,
+		ReadFromSecondary: options.ReadFromSecondary,
+	}, nil
+}
+
+func mongoDumpOptionsFor(schedule *BackupSchedule) *MongoDumpOptions {
+	if schedule == nil {
+		return nil
+	}
+	return schedule.MongoDumpOptions
+}
+
+// mongoDumpExtension names the archive after the options it is dumped with
+func mongoDumpExtension(schedule *BackupSchedule) string {
+	options := mongoDumpOptionsFor(schedule)
+	if options == nil {
+		return mongoArchiveExtension
+	}
+
+	extension := mongoArchiveExtension
+	if options.Oplog {
+		extension = mongoOplogExtension + extension
+	}
+	if options.Gzip {
+		extension += mongoGzipExtension
+	}
+	return extension
+}
+
+// applyMongoDumpOptions adds the schedule's toggles to a mongodump command.
+// An oplog dump covers the whole deployment, so the --db selection is dropped.
+func applyMongoDumpOptions(cmd *exec.Cmd, options *MongoDumpOptions) {
+	if cmd == nil || options == nil {
+		return
+	}
+
+	if options.Oplog {
+		args := cmd.Args[:1]
+		for i := 1; i < len(cmd.Args); i++ {
+			if cmd.Args[i] == "--db" {
+				i++
+				continue
+			}
+			args = append(args, cmd.Args[i])
+		}
+		cmd.Args = append(args, "--oplog")
+	}
+	if options.Gzip {
+		cmd.Args = append(cmd.Args, "--gzip")
+	}
+	if options.ReadFromSecondary {
+		cmd.Args = append(cmd.Args, "--readPreference=secondary")
+	}
+}
+
+func isMongoArchive(path string) bool {
+	path = strings.TrimSuffix(path, mongoGzipExtension)
+	return strings.HasSuffix(path, mongoArchiveExtension)
+}
+
+// isMongoOplogArchive reports an archive of the whole deployment with the
+// oplog captured during the dump
+func isMongoOplogArchive(path string) bool {
+	return strings.HasSuffix(strings.TrimSuffix(path, mongoGzipExtension), mongoOplogExtension+mongoArchiveExtension)
+}
+
+// mongoArchiveRestoreArgs are the mongorestore arguments for an archive.
+// Single database archives are renamed into the target database; oplog
+// archives hold the whole deployment and are replayed as they are.
+func mongoArchiveRestoreArgs(archivePath, targetDB string) []string {
+	return append([]string{"--archive=" + archivePath}, mongoArchiveOptions(archivePath, targetDB)...)
+}
+
+// mongoArchiveOptions are the mongorestore arguments for an archive other
+// than where it is read from
+func mongoArchiveOptions(archivePath, targetDB string) []string {
+	var args []string
+	if strings.HasSuffix(archivePath, mongoGzipExtension) {
+		args = append(args, "--gzip")
+	}
+
+	if isMongoOplogArchive(archivePath) {
+		return append(args, "--oplogReplay")
+	}
+
+	return append(args, "--nsFrom=$db$.$coll$", fmt.Sprintf("--nsTo=%s.$coll$", targetDB))
+}
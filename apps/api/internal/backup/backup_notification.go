@@ -4,8 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/dendianugerah/velld/internal/mail"
@@ -18,28 +19,28 @@ func (s *BackupService) createFailureNotification(connID string, backupErr error
 
 	conn, err := s.connStorage.GetConnection(connID)
 	if err != nil {
-		log.Printf("Failed to get connection details: %v", err)
+		slog.Error("Failed to get connection details", "connection_id", connID, "error", err)
 		return fmt.Errorf("failed to get connection details: %v", err)
 	}
 
 	if conn == nil {
-		log.Printf("Connection not found: %s", connID)
+		slog.Error("Connection not found", "connection_id", connID)
 		return fmt.Errorf("connection not found: %s", connID)
 	}
 
 	if conn.UserID == uuid.Nil {
-		log.Printf("Invalid user ID for connection: %s", connID)
+		slog.Error("Invalid user ID for connection", "connection_id", connID)
 		return fmt.Errorf("invalid user ID for connection: %s", connID)
 	}
 
 	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
 	if err != nil {
-		log.Printf("Failed to get user settings: %v", err)
+		slog.Error("Failed to get user settings", "user_id", conn.UserID, "error", err)
 		return fmt.Errorf("failed to get user settings: %v", err)
 	}
 
 	if userSettings == nil {
-		log.Printf("No settings found for user: %s", conn.UserID)
+		slog.Error("No settings found for user", "user_id", conn.UserID)
 		return fmt.Errorf("no settings found for user: %s", conn.UserID)
 	}
 
@@ -53,22 +54,29 @@ func (s *BackupService) createFailureNotification(connID string, backupErr error
 
 	metadataJSON, _ := json.Marshal(metadata)
 
+	n := &notification.Notification{
+		ID:        uuid.New(),
+		UserID:    conn.UserID,
+		Title:     "Backup Failed",
+		Message:   fmt.Sprintf("Backup failed for database '%s': %v", conn.DatabaseName, backupErr),
+		Type:      notification.BackupFailed,
+		Status:    notification.StatusUnread,
+		Metadata:  metadataJSON,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	s.dispatchWebhooks(n, metadata)
+	s.raiseNotificationIncident(userSettings, connID, n, metadata)
+
+	if s.notifyThroughFallbacks(userSettings, n, metadata) {
+		return nil
+	}
+
 	// Create dashboard notification if enabled
 	if userSettings.NotifyDashboard {
-		notification := &notification.Notification{
-			ID:        uuid.New(),
-			UserID:    conn.UserID,
-			Title:     "Backup Failed",
-			Message:   fmt.Sprintf("Backup failed for database '%s': %v", conn.DatabaseName, backupErr),
-			Type:      notification.BackupFailed,
-			Status:    notification.StatusUnread,
-			Metadata:  metadataJSON,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-
-		if err := s.notificationRepo.CreateNotification(notification); err != nil {
-			fmt.Printf("Error creating dashboard notification: %v\n", err)
+		if err := s.notificationRepo.CreateNotification(n); err != nil {
+			slog.Error("Failed to create dashboard notification", "error", err)
 		}
 	}
 
@@ -77,32 +85,85 @@ func (s *BackupService) createFailureNotification(connID string, backupErr error
 		go s.sendWebhookNotification(*userSettings.WebhookURL, metadata)
 	}
 
-	// Send email notification if enabled
-	if userSettings.NotifyEmail && userSettings.Email != nil {
-		log.Printf("Attempting to send email notification to: %s", *userSettings.Email)
-		// Use separate goroutine for email to prevent blocking
-		go func(emailAddr string, userSettings *settings.UserSettings, meta map[string]interface{}) {
-			if err := s.sendEmailNotification(emailAddr, userSettings, meta); err != nil {
-				log.Printf("Failed to send email notification: %v", err)
-			}
-		}(*userSettings.Email, userSettings, metadata)
-	} else {
-		log.Printf("Email notification skipped - enabled: %v, email configured: %v",
-			userSettings.NotifyEmail, userSettings.Email != nil)
-	}
+	s.notifyDiscord(userSettings, connID, n, metadata)
+	s.notifyEmail(userSettings, n, metadata)
+	s.notifyPush(userSettings, n, metadata)
+	s.notifyMatrix(userSettings, n, metadata)
 
 	return nil
 }
 
+// notificationFields are the metadata listed with a notification in emails
+// and Discord embeds, in order. The notification message already says what
+// happened; fields add the details at a glance.
+var notificationFields = []struct {
+	key    string
+	label  string
+	inline bool
+}{
+	{"connection_name", "Connection", true},
+	{"database_name", "Database", true},
+	{"database_type", "Type", true},
+	{"size", "Size", true},
+	{"average_size", "Average Size", true},
+	{"deviation", "Deviation", true},
+	{"failed_runs", "Failed Runs", true},
+	{"duration", "Duration", true},
+	{"jobs", "Jobs", true},
+	{"scheduled_time", "Scheduled", true},
+	{"next_run_time", "Next Run", true},
+	{"last_backup_at", "Last Backup", true},
+	{"backup_id", "Backup", false},
+	{"error", "Error", false},
+}
+
+// alertData fills the alert email of a notification
+func alertData(n *notification.Notification, metadata map[string]interface{}) *mail.AlertData {
+	data := &mail.AlertData{Title: n.Title, Message: n.Message, Time: n.CreatedAt}
+	for _, field := range notificationFields {
+		value, ok := metadata[field.key]
+		if !ok || value == nil {
+			continue
+		}
+		if text := fmt.Sprint(value); text != "" {
+			data.Details = append(data.Details, mail.Detail{Label: field.label, Value: text})
+		}
+	}
+	return data
+}
+
+// notifyEmail emails n to the alert recipients of the settings when email
+// notifications are on, without waiting for the SMTP server
+func (s *BackupService) notifyEmail(userSettings *settings.UserSettings, n *notification.Notification, metadata map[string]interface{}) {
+	if !userSettings.NotifyEmail {
+		return
+	}
+	recipients := userSettings.AlertRecipients()
+	if len(recipients) == 0 {
+		slog.Info("Email notification skipped, no alert recipients configured")
+		return
+	}
+
+	slog.Info("Sending email notification", "recipients", strings.Join(recipients, ", "))
+	// Use separate goroutine for email to prevent blocking
+	go func() {
+		if err := s.sendEmail(recipients, userSettings, "Velld - "+n.Title, mail.TemplateAlert, alertData(n, metadata)); err != nil {
+			slog.Error("Failed to send email notification", "error", err)
+		}
+	}()
+}
+
 func (s *BackupService) sendWebhookNotification(webhookURL string, data map[string]interface{}) {
 	body, _ := json.Marshal(data)
 	_, err := http.Post(webhookURL, "application/json", bytes.NewBuffer(body))
 	if err != nil {
-		fmt.Printf("Error sending webhook notification: %v\n", err)
+		slog.Error("Failed to send webhook notification", "error", err)
 	}
 }
 
-func (s *BackupService) sendEmailNotification(email string, userSettings *settings.UserSettings, data map[string]interface{}) error {
+// sendEmail renders a template and sends it through the SMTP server of the
+// settings
+func (s *BackupService) sendEmail(to []string, userSettings *settings.UserSettings, subject, template string, data interface{}) error {
 	if userSettings == nil {
 		return fmt.Errorf("settings cannot be nil")
 	}
@@ -131,16 +192,26 @@ func (s *BackupService) sendEmailNotification(email string, userSettings *settin
 		Username: *userSettings.SMTPUsername,
 		Password: password,
 	}
+	if userSettings.SMTPSecurity != nil {
+		smtpConfig.Security = *userSettings.SMTPSecurity
+	}
+
+	text, html, err := mail.Render(template, data)
+	if err != nil {
+		return err
+	}
 
 	msg := &mail.Message{
-		From:    *userSettings.SMTPUsername,
-		To:      email,
-		Subject: "Velld - Backup Failed",
-		Body:    fmt.Sprintf("Backup failed for database '%s'. Error: %v", data["database_name"], data["error"]),
+		From:     *userSettings.SMTPUsername,
+		To:       to,
+		Subject:  subject,
+		Body:     text,
+		HTMLBody: html,
 	}
 
 	if err := mail.SendEmail(smtpConfig, msg); err != nil {
-		fmt.Printf("Error sending email notification: %v\n", err)
+		slog.Error("Failed to send email notification", "error", err)
+		return err
 	}
 
 	return nil
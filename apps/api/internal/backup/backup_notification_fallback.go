@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/mail"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/google/uuid"
+)
+
+// fallbackWebhookTimeout bounds a webhook delivery of a fallback chain, so a
+// hung endpoint moves on to the next channel
+const fallbackWebhookTimeout = 30 * time.Second
+
+// notifyThroughFallbacks delivers n through the user's fallback chain for
+// its type: each channel is tried in order until one delivers, and every
+// attempt is recorded. It returns false when no chain is defined, leaving the
+// notification to the enabled channels.
+func (s *BackupService) notifyThroughFallbacks(userSettings *settings.UserSettings, n *notification.Notification, metadata map[string]interface{}) bool {
+	chain := userSettings.NotificationFallbacks[string(n.Type)]
+	if len(chain) == 0 {
+		return false
+	}
+
+	go s.runFallbackChain(userSettings, chain, n, metadata)
+	return true
+}
+
+func (s *BackupService) runFallbackChain(userSettings *settings.UserSettings, chain []settings.FallbackChannel, n *notification.Notification, metadata map[string]interface{}) {
+	chainID := uuid.New()
+	for i, channel := range chain {
+		target, deliveryErr := s.deliverThroughChannel(userSettings, channel, n, metadata)
+
+		delivery := &notification.Delivery{
+			ID:               uuid.New(),
+			UserID:           n.UserID,
+			NotificationType: n.Type,
+			ChainID:          chainID,
+			Position:         i + 1,
+			Channel:          channel.Type,
+			Target:           target,
+			Status:           notification.DeliveryDelivered,
+			CreatedAt:        time.Now(),
+		}
+		if deliveryErr != nil {
+			message := deliveryErr.Error()
+			delivery.Status = notification.DeliveryFailed
+			delivery.Error = &message
+		}
+		if err := s.notificationRepo.CreateDelivery(delivery); err != nil {
+			slog.Warn("Failed to record notification delivery", "error", err)
+		}
+
+		if deliveryErr == nil {
+			return
+		}
+		slog.Warn("Failed to deliver notification", "type", n.Type, "channel", channel.Type, "error", deliveryErr)
+	}
+
+	slog.Warn("Every channel of the fallback chain failed", "type", n.Type, "user_id", n.UserID)
+}
+
+// deliverThroughChannel delivers n through one channel and returns the
+// target it was sent to
+func (s *BackupService) deliverThroughChannel(userSettings *settings.UserSettings, channel settings.FallbackChannel, n *notification.Notification, metadata map[string]interface{}) (*string, error) {
+	switch channel.Type {
+	case settings.ChannelDashboard:
+		return nil, s.notificationRepo.CreateNotification(n)
+	case settings.ChannelEmail:
+		recipients := userSettings.AlertRecipients()
+		if channel.Target != nil {
+			recipients = []string{*channel.Target}
+		}
+		if len(recipients) == 0 {
+			return nil, fmt.Errorf("no email address configured")
+		}
+		target := strings.Join(recipients, ", ")
+		return &target, s.sendEmail(recipients, userSettings, "Velld - "+n.Title, mail.TemplateAlert, alertData(n, metadata))
+	case settings.ChannelWebhook:
+		target := channel.Target
+		if target == nil {
+			target = userSettings.WebhookURL
+		}
+		if target == nil {
+			return nil, fmt.Errorf("no webhook URL configured")
+		}
+		return target, postFallbackWebhook(*target, n, metadata)
+	case settings.ChannelDiscord:
+		target := channel.Target
+		if connectionID, ok := metadata["connection_id"].(string); ok && target == nil {
+			target = s.scheduleDiscordWebhook(connectionID)
+		}
+		if target == nil {
+			target = userSettings.DiscordWebhookURL
+		}
+		if target == nil {
+			return nil, fmt.Errorf("no Discord webhook URL configured")
+		}
+		return target, notification.SendDiscord(*target, discordMessage(n, metadata))
+	case settings.ChannelNtfy:
+		target := userSettings.NtfyTopic
+		if channel.Target != nil {
+			target = channel.Target
+		}
+		if target == nil {
+			return nil, fmt.Errorf("no ntfy topic configured")
+		}
+		return target, s.sendNtfy(userSettings, *target, pushMessage(n, metadata))
+	case settings.ChannelGotify:
+		return userSettings.GotifyServerURL, s.sendGotify(userSettings, pushMessage(n, metadata))
+	case settings.ChannelMatrix:
+		target := userSettings.MatrixRoomID
+		if channel.Target != nil {
+			target = channel.Target
+		}
+		if target == nil {
+			return nil, fmt.Errorf("no Matrix room ID configured")
+		}
+		return target, s.sendMatrix(userSettings, *target, matrixMessage(n, metadata))
+	default:
+		return nil, fmt.Errorf("unknown channel type %q", channel.Type)
+	}
+}
+
+// postFallbackWebhook posts the notification's metadata with its type and a
+// text field, which chat webhooks such as Slack's display. Only a 2xx
+// response counts as delivered.
+func postFallbackWebhook(url string, n *notification.Notification, metadata map[string]interface{}) error {
+	payload := make(map[string]interface{}, len(metadata)+2)
+	for key, value := range metadata {
+		payload[key] = value
+	}
+	payload["event"] = n.Type
+	payload["text"] = fmt.Sprintf("%s: %s", n.Title, n.Message)
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: fallbackWebhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package backup
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// onceSchedule is the cron schedule of a one-shot backup. It has no runs
+// after its time, which the cron manager treats as never running again.
+type onceSchedule struct {
+	at time.Time
+}
+
+func (o onceSchedule) Next(t time.Time) time.Time {
+	if t.Before(o.at) {
+		return o.at
+	}
+	return time.Time{}
+}
+
+// scheduleSpec returns the one-shot schedule of runAt when it is set and the
+// cron expression's otherwise
+func scheduleSpec(expr string, runAt *time.Time, timezone string) (cron.Schedule, error) {
+	if runAt != nil {
+		return onceSchedule{at: *runAt}, nil
+	}
+	return parseCronSchedule(expr, timezone)
+}
+
+// validateRunAt checks the time of a one-shot schedule, which replaces the
+// cron expression
+func validateRunAt(runAt *time.Time, expr string) error {
+	if runAt == nil {
+		return nil
+	}
+	if strings.TrimSpace(expr) != "" {
+		return &CronScheduleError{Reason: "use either cron_schedule or run_at, not both"}
+	}
+	if !runAt.After(time.Now()) {
+		return &CronScheduleError{Reason: "run_at must be in the future"}
+	}
+	return nil
+}
+
+// finishOneShot disables a one-shot schedule once its run is over, whether
+// the backup ran or was skipped
+func (s *BackupService) finishOneShot(schedule *BackupSchedule) {
+	slog.Info("One-shot backup schedule is done, disabling it", "schedule_id", schedule.ID)
+
+	s.removeCronEntry(schedule.ID.String())
+	schedule.Enabled = false
+	schedule.NextRunTime = nil
+}
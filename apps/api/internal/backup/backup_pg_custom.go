@@ -0,0 +1,376 @@
+package backup
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Postgres dump formats selected with PG_DUMP_FORMAT
+const (
+	pgDumpFormatCustom = "custom"
+	pgDumpFormatPlain  = "plain"
+)
+
+// customDumpExtension marks a pg_dump custom-format (-Fc) archive
+const customDumpExtension = ".dump"
+
+// pgDumpFormat reads PG_DUMP_FORMAT. Custom-format archives are the default,
+// since pg_restore can restore them selectively; "plain" keeps SQL scripts.
+func pgDumpFormat() string {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("PG_DUMP_FORMAT")))
+	switch value {
+	case "", pgDumpFormatCustom:
+		return pgDumpFormatCustom
+	case pgDumpFormatPlain:
+		return pgDumpFormatPlain
+	default:
+		slog.Warn("Invalid PG_DUMP_FORMAT, using the default", "value", value, "default", pgDumpFormatCustom)
+		return pgDumpFormatCustom
+	}
+}
+
+func isCustomDump(path string) bool {
+	return strings.HasSuffix(path, customDumpExtension)
+}
+
+// TOCEntry is a line of a custom-format archive's table of contents
+type TOCEntry struct {
+	ID     int    `json:"id"`
+	Type   string `json:"type"`
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	Owner  string `json:"owner"`
+	Line   string `json:"line"`
+}
+
+// tocEntryTypes are the multi-word object types pg_restore -l prints. Longer
+// types come first so "MATERIALIZED VIEW DATA" wins over "MATERIALIZED VIEW".
+var tocEntryTypes = []string{
+	"PUBLICATION TABLES IN SCHEMA",
+	"MATERIALIZED VIEW DATA",
+	"TEXT SEARCH CONFIGURATION",
+	"TEXT SEARCH DICTIONARY",
+	"TEXT SEARCH TEMPLATE",
+	"TEXT SEARCH PARSER",
+	"FOREIGN DATA WRAPPER",
+	"PROCEDURAL LANGUAGE",
+	"DATABASE PROPERTIES",
+	"SEQUENCE OWNED BY",
+	"MATERIALIZED VIEW",
+	"PUBLICATION TABLE",
+	"CHECK CONSTRAINT",
+	"OPERATOR FAMILY",
+	"OPERATOR CLASS",
+	"FK CONSTRAINT",
+	"EVENT TRIGGER",
+	"FOREIGN TABLE",
+	"ACCESS METHOD",
+	"SEQUENCE SET",
+	"USER MAPPING",
+	"INDEX ATTACH",
+	"TABLE ATTACH",
+	"ROW SECURITY",
+	"LARGE OBJECT",
+	"DEFAULT ACL",
+	"SHELL TYPE",
+	"TABLE DATA",
+}
+
+// parseTOC parses pg_restore -l output. Lines look like
+// "215; 1259 16386 TABLE public users postgres".
+func parseTOC(output string) []TOCEntry {
+	var entries []TOCEntry
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		idStr, rest, ok := strings.Cut(line, ";")
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSpace(idStr))
+		if err != nil {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) < 3 {
+			continue
+		}
+		// Skip the catalog and object OIDs
+		fields = fields[2:]
+
+		entry := TOCEntry{ID: id, Line: line}
+		description := strings.Join(fields, " ")
+		for _, entryType := range tocEntryTypes {
+			if strings.HasPrefix(description, entryType+" ") {
+				entry.Type = entryType
+				fields = strings.Fields(strings.TrimPrefix(description, entryType))
+				break
+			}
+		}
+		if entry.Type == "" {
+			entry.Type = fields[0]
+			fields = fields[1:]
+		}
+
+		if len(fields) >= 3 {
+			entry.Schema = fields[0]
+			entry.Name = strings.Join(fields[1:len(fields)-1], " ")
+			entry.Owner = fields[len(fields)-1]
+		} else if len(fields) > 0 {
+			entry.Name = strings.Join(fields, " ")
+		}
+		if entry.Schema == "-" {
+			entry.Schema = ""
+		}
+
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (s *BackupService) findPgRestoreBinary() (string, error) {
+	binaryPath := common.FindBinaryPath("postgresql", "pg_restore")
+	if binaryPath == "" {
+		return "", fmt.Errorf("restore tool not found for postgresql. Please ensure pg_restore is installed")
+	}
+	return filepath.Join(binaryPath, common.GetPlatformExecutableName("pg_restore")), nil
+}
+
+// listArchive returns the table of contents of a custom-format archive
+func (s *BackupService) listArchive(archivePath string) (string, error) {
+	binPath, err := s.findPgRestoreBinary()
+	if err != nil {
+		return "", err
+	}
+
+	output, err := exec.Command(binPath, "-l", archivePath).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to read archive table of contents: %s", strings.TrimSpace(string(output)))
+	}
+	return string(output), nil
+}
+
+// writeUseList writes the TOC lines of the selected entries to a list file
+// for pg_restore --use-list.
+func (s *BackupService) writeUseList(archivePath string, entryIDs []int) (string, error) {
+	toc, err := s.listArchive(archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	selected := make(map[int]bool)
+	for _, id := range entryIDs {
+		selected[id] = true
+	}
+
+	var list strings.Builder
+	found := 0
+	for _, entry := range parseTOC(toc) {
+		if selected[entry.ID] {
+			list.WriteString(entry.Line)
+			list.WriteString("\n")
+			found++
+		}
+	}
+	if found != len(selected) {
+		return "", fmt.Errorf("%d of the selected TOC entries do not exist in the archive", len(selected)-found)
+	}
+
+	listFile, err := os.CreateTemp("", "velld-restore-list-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create restore list: %v", err)
+	}
+	defer listFile.Close()
+
+	if _, err := listFile.WriteString(list.String()); err != nil {
+		os.Remove(listFile.Name())
+		return "", fmt.Errorf("failed to write restore list: %v", err)
+	}
+	return listFile.Name(), nil
+}
+
+// restoreCustomDump restores a custom-format archive with pg_restore, limited
+// to the selection when one is given. Portable restores skip the grants.
+func (s *BackupService) restoreCustomDump(conn *connection.StoredConnection, archivePath string, selection *RestoreSelection, portable bool, processes *processTracker) error {
+	binPath, err := s.findPgRestoreBinary()
+	if err != nil {
+		return err
+	}
+
+	args := []string{
+		"-h", conn.Host,
+		"-p", fmt.Sprintf("%d", conn.Port),
+		"-U", conn.Username,
+		"-d", conn.DatabaseName,
+		"--no-owner",
+	}
+	if portable {
+		args = append(args, "--no-privileges")
+	}
+
+	selectionArgs, listPath, err := s.pgRestoreSelectionArgs(archivePath, selection)
+	if err != nil {
+		return err
+	}
+	if listPath != "" {
+		defer os.Remove(listPath)
+	}
+	args = append(args, selectionArgs...)
+	args = append(args, s.pgRestoreProgressArgs(archivePath, selection, processes)...)
+
+	args = append(args, archivePath)
+
+	cmd := exec.Command(binPath, args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
+
+	output, err := processes.combinedOutput(cmd)
+	return s.validatePostgreSQLRestore(output, err)
+}
+
+// convertCustomDumpToSQL renders a custom-format archive as a SQL script in a
+// temp file, for features that work on plain text such as backup comparison.
+func (s *BackupService) convertCustomDumpToSQL(archivePath string) (string, error) {
+	tempDir := filepath.Join(os.TempDir(), "velld-decompressed")
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	sqlPath := filepath.Join(tempDir, strings.TrimSuffix(filepath.Base(archivePath), customDumpExtension)+"-"+uuid.New().String()+".sql")
+	if err := s.writeCustomDumpSQL(archivePath, sqlPath); err != nil {
+		os.Remove(sqlPath)
+		return "", err
+	}
+	return sqlPath, nil
+}
+
+// writeCustomDumpSQL renders a custom-format archive as a SQL script at sqlPath
+func (s *BackupService) writeCustomDumpSQL(archivePath, sqlPath string) error {
+	binPath, err := s.findPgRestoreBinary()
+	if err != nil {
+		return err
+	}
+
+	output, err := exec.Command(binPath, "-f", sqlPath, archivePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to convert archive to SQL: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// GetBackupTOC lists the table of contents of a custom or directory-format
+// PostgreSQL backup, or the collections of a MongoDB archive, so a restore
+// can be limited to some of its entries.
+func (s *BackupService) GetBackupTOC(backupID string, userID uuid.UUID) ([]TOCEntry, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	if isGPGEncrypted(backup) {
+		return nil, fmt.Errorf("backup is encrypted and its table of contents cannot be read")
+	}
+
+	filePath, isTemp, err := s.ensureBackupContentAvailable(backup, conn.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if isTemp {
+		defer os.Remove(filePath)
+	}
+
+	if conn.Type == "mongodb" && isMongoArchive(filePath) {
+		return s.listMongoArchive(filePath)
+	}
+
+	archivePath := filePath
+	switch {
+	case isCustomDump(filePath):
+	case isDirectoryDump(filePath):
+		dumpDir, err := unpackDirectoryDump(filePath)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dumpDir)
+		archivePath = dumpDir
+	default:
+		return nil, fmt.Errorf("only custom and directory-format PostgreSQL backups and MongoDB archives have a table of contents")
+	}
+
+	toc, err := s.listArchive(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := parseTOC(toc)
+	if entries == nil {
+		entries = []TOCEntry{}
+	}
+	return entries, nil
+}
+
+func (h *BackupHandler) GetBackupTOC(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := h.backupService.GetBackupTOC(backupID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup table of contents retrieved successfully", entries)
+}
+
+// sqlRenderingOf returns a SQL script for the dump at path, converting
+// custom-format archives. The original temp file is removed once converted.
+func (s *BackupService) sqlRenderingOf(path string, isTemp bool) (string, bool, error) {
+	if !isCustomDump(path) {
+		return path, isTemp, nil
+	}
+
+	sqlPath, err := s.convertCustomDumpToSQL(path)
+	if isTemp {
+		os.Remove(path)
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return sqlPath, true, nil
+}
@@ -0,0 +1,292 @@
+package backup
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// maxPgDumpJobs caps the number of parallel pg_dump/pg_restore workers
+const maxPgDumpJobs = 32
+
+// directoryDumpExtension marks a pg_dump directory-format dump packed into a
+// tar archive. pg_dump already compresses every table file, so the archive is
+// not compressed again unless the schedule has a compression command.
+const directoryDumpExtension = ".dir.tar"
+
+// validatePgDumpJobs checks the parallel worker count submitted with a
+// schedule request. Zero keeps plain SQL dumps.
+func (s *BackupService) validatePgDumpJobs(connectionID string, jobs *int) error {
+	if jobs == nil || *jobs == 0 {
+		return nil
+	}
+
+	if *jobs < 0 || *jobs > maxPgDumpJobs {
+		return fmt.Errorf("pg_dump jobs must be between 0 and %d", maxPgDumpJobs)
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	if conn.Type != "postgresql" {
+		return fmt.Errorf("parallel dumps are only supported for postgresql connections")
+	}
+
+	return nil
+}
+
+func pgDumpJobs(conn *connection.StoredConnection, schedule *BackupSchedule) int {
+	if conn.Type != "postgresql" || schedule == nil {
+		return 0
+	}
+	return schedule.PgDumpJobs
+}
+
+// dumpFileExtension returns the extension of the dump artifact for a connection
+func dumpFileExtension(conn *connection.StoredConnection, schedule *BackupSchedule) string {
+	if physicalBackupFor(schedule) {
+		if conn.Type == "mysql" {
+			return xtraBackupExtension
+		}
+		return physicalBackupExtension
+	}
+	if pgDumpJobs(conn, schedule) > 0 {
+		return directoryDumpExtension
+	}
+	if conn.Type == "postgresql" && pgDumpFormatFor(schedule) == pgDumpFormatCustom {
+		return customDumpExtension
+	}
+	if conn.Type == "mongodb" {
+		return mongoDumpExtension(schedule)
+	}
+	return ".sql"
+}
+
+func isDirectoryDump(path string) bool {
+	return strings.HasSuffix(path, directoryDumpExtension)
+}
+
+// createPgDumpCmdForSchedule dumps in directory format with parallel workers
+// when the schedule asks for it, and as a plain SQL script otherwise.
+func (s *BackupService) createPgDumpCmdForSchedule(conn *connection.StoredConnection, backupPath string, schedule *BackupSchedule) *exec.Cmd {
+	jobs := pgDumpJobs(conn, schedule)
+	if jobs == 0 {
+		return s.createPgDumpCmd(conn, backupPath, pgDumpFormatFor(schedule))
+	}
+
+	binaryPath := s.findDatabaseBinaryPath("postgresql")
+	if binaryPath == "" {
+		slog.Error("pg_dump binary not found, install PostgreSQL client tools")
+		return nil
+	}
+
+	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(requiredTools["postgresql"]))
+
+	cmd := exec.Command(binPath,
+		"-h", conn.Host,
+		"-p", fmt.Sprintf("%d", conn.Port),
+		"-U", conn.Username,
+		"-d", conn.DatabaseName,
+		"-Fd",
+		"-j", fmt.Sprintf("%d", jobs),
+		"-f", strings.TrimSuffix(backupPath, ".tar"),
+	)
+
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
+	return cmd
+}
+
+// packDirectoryDump archives the directory written by a parallel pg_dump or a
+// physical backup into the backup artifact and removes the directory.
+func packDirectoryDump(backupPath string) error {
+	if !isDirectoryDump(backupPath) && !isPhysicalBackup(backupPath) {
+		return nil
+	}
+
+	dumpDir := strings.TrimSuffix(backupPath, ".tar")
+	defer os.RemoveAll(dumpDir)
+
+	file, err := os.Create(backupPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tw := tar.NewWriter(file)
+	err = filepath.Walk(dumpDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dumpDir, path)
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		os.Remove(backupPath)
+		return fmt.Errorf("failed to pack directory dump: %v", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		os.Remove(backupPath)
+		return fmt.Errorf("failed to pack directory dump: %v", err)
+	}
+
+	return file.Sync()
+}
+
+// unpackDirectoryDump extracts a packed directory dump into a new temp
+// directory. The caller removes the directory when done.
+func unpackDirectoryDump(archivePath string) (string, error) {
+	tempDir := filepath.Join(os.TempDir(), "velld-restore")
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	dumpDir, err := os.MkdirTemp(tempDir, "dump-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	if err := extractDirectoryDump(archivePath, dumpDir); err != nil {
+		os.RemoveAll(dumpDir)
+		return "", err
+	}
+	return dumpDir, nil
+}
+
+// extractDirectoryDump extracts the files of a packed directory dump into
+// dumpDir
+func extractDirectoryDump(archivePath, dumpDir string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read directory dump: %v", err)
+		}
+
+		target := filepath.Join(dumpDir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(target, dumpDir+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in directory dump: %s", header.Name)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		dst, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, tr)
+		dst.Close()
+		if err != nil {
+			return fmt.Errorf("failed to extract directory dump: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// restoreDirectoryDump restores a packed directory-format dump with parallel
+// pg_restore workers, limited to the selection when one is given. Portable
+// restores skip the grants.
+func (s *BackupService) restoreDirectoryDump(conn *connection.StoredConnection, archivePath string, selection *RestoreSelection, portable bool, processes *processTracker) error {
+	binPath, err := s.findPgRestoreBinary()
+	if err != nil {
+		return err
+	}
+
+	dumpDir, err := unpackDirectoryDump(archivePath)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dumpDir)
+
+	jobs := runtime.NumCPU()
+	if jobs > maxPgDumpJobs {
+		jobs = maxPgDumpJobs
+	}
+
+	args := []string{
+		"-h", conn.Host,
+		"-p", fmt.Sprintf("%d", conn.Port),
+		"-U", conn.Username,
+		"-d", conn.DatabaseName,
+		"-j", fmt.Sprintf("%d", jobs),
+		"--no-owner",
+	}
+	if portable {
+		args = append(args, "--no-privileges")
+	}
+
+	selectionArgs, listPath, err := s.pgRestoreSelectionArgs(dumpDir, selection)
+	if err != nil {
+		return err
+	}
+	if listPath != "" {
+		defer os.Remove(listPath)
+	}
+	args = append(args, selectionArgs...)
+	args = append(args, s.pgRestoreProgressArgs(dumpDir, selection, processes)...)
+
+	cmd := exec.Command(binPath, append(args, dumpDir)...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
+
+	output, err := processes.combinedOutput(cmd)
+	if err != nil {
+		outputStr := withoutProgressLines(string(output))
+		if outputStr == "" {
+			outputStr = err.Error()
+		}
+		return fmt.Errorf("restore failed for database '%s': %s", conn.DatabaseName, outputStr)
+	}
+
+	return nil
+}
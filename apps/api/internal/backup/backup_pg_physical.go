@@ -0,0 +1,149 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// physicalBackupExtension marks a pg_basebackup of a whole cluster: the
+// gzipped tar files of the data directory, its tablespaces and the WAL needed
+// to make it consistent, packed into one tar archive.
+const physicalBackupExtension = ".base.tar"
+
+// minBaseBackupRateKBps is the lowest --max-rate pg_basebackup accepts
+const minBaseBackupRateKBps = 32
+
+// physicalBackupTools are the tools taking physical backups of each database
+// type that supports them
+var physicalBackupTools = map[string]string{
+	"postgresql": "pg_basebackup",
+	"mysql":      "xtrabackup",
+}
+
+// validatePhysicalBackup checks the physical backup toggle against the rest
+// of the schedule. A physical backup copies every database of the server
+// byte for byte, so it cannot be combined with anything that selects or
+// rewrites what is dumped.
+func (s *BackupService) validatePhysicalBackup(connectionID string, enabled *bool, pgDumpJobs int, filters *DumpFilters, sample *SampleOptions, rules MaskingRules) error {
+	if enabled == nil || !*enabled {
+		return nil
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	if _, ok := physicalBackupTools[conn.Type]; !ok {
+		return fmt.Errorf("physical backups are only supported for postgresql and mysql connections")
+	}
+	if len(conn.SelectedDatabases) > 0 {
+		return fmt.Errorf("physical backups include every database and cannot be combined with selected databases")
+	}
+	if pgDumpJobs > 0 {
+		return fmt.Errorf("physical backups do not use pg_dump and cannot be combined with pg_dump_jobs")
+	}
+	if filters != nil {
+		return fmt.Errorf("physical backups include every table and cannot be combined with dump filters")
+	}
+	if sample != nil {
+		return fmt.Errorf("physical backups include every row and cannot be combined with a sample")
+	}
+	if len(rules) > 0 {
+		return fmt.Errorf("physical backups copy data files as they are and cannot be combined with masking rules")
+	}
+
+	return nil
+}
+
+func physicalBackupFor(schedule *BackupSchedule) bool {
+	return schedule != nil && schedule.PhysicalBackup
+}
+
+func isPhysicalBackup(path string) bool {
+	return strings.HasSuffix(path, physicalBackupExtension) || isXtraBackup(path)
+}
+
+// createPhysicalBackup copies the whole server into the backup's path. The
+// files are written to a directory next to it, which packDirectoryDump
+// archives.
+func (s *BackupService) createPhysicalBackup(conn *connection.StoredConnection, tunnel *connection.SSHTunnel, backup *Backup, schedule *BackupSchedule, processes *processTracker) (*RunEnvironment, error) {
+	switch conn.Type {
+	case "postgresql":
+		return s.createPgBaseBackup(conn, backup.Path, schedule, processes)
+	case "mysql":
+		return s.createXtraBackup(conn, tunnel, backup, schedule, processes)
+	default:
+		return nil, fmt.Errorf("physical backups are not supported for %s", conn.Type)
+	}
+}
+
+func (s *BackupService) createPgBaseBackup(conn *connection.StoredConnection, backupPath string, schedule *BackupSchedule, processes *processTracker) (*RunEnvironment, error) {
+	cmd := s.createPgBaseBackupCmd(conn, strings.TrimSuffix(backupPath, ".tar"), schedule)
+	if cmd == nil {
+		return nil, fmt.Errorf("backup tool not found for %s. Please ensure pg_basebackup is installed and available in PATH", conn.Type)
+	}
+	environment := captureRunEnvironment(cmd, schedule, false)
+
+	output, err := processes.combinedOutput(cmd)
+	if err != nil {
+		removePartialDump(strings.TrimSuffix(backupPath, ".tar"))
+		if processes.timedOut() {
+			return nil, fmt.Errorf("physical backup of %s cluster on %s:%d timed out", conn.Type, conn.Host, conn.Port)
+		}
+		errorMsg := string(output)
+		if errorMsg == "" {
+			errorMsg = err.Error()
+		}
+		return nil, fmt.Errorf("physical backup failed for %s cluster on %s:%d - %s",
+			conn.Type, conn.Host, conn.Port, errorMsg)
+	}
+
+	return environment, nil
+}
+
+// createPgBaseBackupCmd runs pg_basebackup in tar format with gzip, streaming
+// the WAL written during the copy so the backup is consistent on its own. The
+// connection's user needs the REPLICATION attribute and a replication entry
+// in pg_hba.conf.
+func (s *BackupService) createPgBaseBackupCmd(conn *connection.StoredConnection, outputDir string, schedule *BackupSchedule) *exec.Cmd {
+	// pg_basebackup can come from a different package than pg_dump
+	binaryPath := common.FindBinaryPath("postgresql", "pg_basebackup")
+	if binaryPath == "" {
+		slog.Error("pg_basebackup binary not found, install PostgreSQL client tools")
+		return nil
+	}
+
+	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName("pg_basebackup"))
+	args := []string{
+		"-h", conn.Host,
+		"-p", fmt.Sprintf("%d", conn.Port),
+		"-U", conn.Username,
+		"-D", outputDir,
+		"-F", "t",
+		"-z",
+		"-X", "stream",
+		"--checkpoint=fast",
+		"--label=velld_" + time.Now().Format("20060102_150405"),
+	}
+
+	// pg_basebackup throttles itself, the dump is not streamed through velld
+	if limit := bandwidthLimitFor(schedule); limit > 0 {
+		if limit < minBaseBackupRateKBps {
+			limit = minBaseBackupRateKBps
+		}
+		args = append(args, fmt.Sprintf("--max-rate=%dk", limit))
+	}
+
+	cmd := exec.Command(binPath, args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
+	return cmd
+}
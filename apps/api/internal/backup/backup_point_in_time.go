@@ -0,0 +1,288 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+)
+
+// PointInTimeRestoreRequest restores a connection's database to how it was
+// at TargetTime, from the last backup taken before it
+type PointInTimeRestoreRequest struct {
+	ConnectionID string    `json:"connection_id"`
+	TargetTime   time.Time `json:"target_time"`
+	// Database picks the database of a connection that backs up several,
+	// defaulting to the connection's database
+	Database string `json:"database,omitempty"`
+	// TargetConnectionID restores into another connection of the same
+	// engine family, defaulting to the source connection
+	TargetConnectionID string `json:"target_connection_id,omitempty"`
+	CreateDatabase     bool   `json:"create_database"`
+	// KeepOwnership is only read for restores into another connection;
+	// restores into the source keep the owners
+	KeepOwnership bool   `json:"keep_ownership"`
+	OnConflict    string `json:"on_conflict,omitempty"`
+}
+
+// PointInTimePlan is the backup chain a point-in-time restore goes back to.
+// velld archives no WAL or binlog, so the restore recovers the moment the
+// backup was consistent, and the gap up to the target time is lost.
+type PointInTimePlan struct {
+	TargetTime time.Time `json:"target_time"`
+	BackupID   string    `json:"backup_id"`
+	// Chain is the full backup followed by the incrementals applied to it
+	Chain    []string `json:"chain"`
+	Database *string  `json:"database,omitempty"`
+	Physical bool     `json:"physical"`
+	// RecoveredTo is the moment the restored data is consistent as of
+	RecoveredTo time.Time `json:"recovered_to"`
+	GapSeconds  float64   `json:"gap_seconds"`
+	Steps       []string  `json:"steps"`
+	// preparable is set for XtraBackup chains, which velld prepares
+	preparable bool
+}
+
+// PointInTimeRestoreResult is the outcome of a point-in-time restore. Logical
+// backups are restored; physical MySQL chains are prepared for copy-back.
+type PointInTimeRestoreResult struct {
+	Plan     *PointInTimePlan `json:"plan"`
+	Restore  *RestoreResult   `json:"restore,omitempty"`
+	Prepared *PreparedBackup  `json:"prepared,omitempty"`
+}
+
+// consistentAt returns the moment a backup's data is consistent as of.
+// Dumps see a snapshot taken when they start; physical backups are made
+// consistent with the log written until they complete.
+func consistentAt(backup *Backup) time.Time {
+	if isPhysicalBackup(plainDumpPath(backup)) && backup.CompletedTime != nil {
+		return *backup.CompletedTime
+	}
+	return backup.StartedTime
+}
+
+// PlanPointInTimeRestore selects the newest completed backup of the database
+// that was consistent at or before targetTime, with the incrementals it
+// builds on
+func (s *BackupService) PlanPointInTimeRestore(connectionID, database string, targetTime time.Time, userID uuid.UUID) (*PointInTimePlan, error) {
+	if targetTime.IsZero() {
+		return nil, &RestoreTargetError{Reason: "target_time is required"}
+	}
+	if targetTime.After(time.Now()) {
+		return nil, &RestoreTargetError{Reason: "target_time is in the future"}
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+	if database == "" {
+		database = conn.DatabaseName
+	}
+
+	backups, err := s.backupRepo.GetBackupsByConnectionID(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backups: %v", err)
+	}
+
+	var chosen *Backup
+	for _, backup := range backups {
+		if backup.Status != "completed" || backup.CompletedTime == nil {
+			continue
+		}
+		physical := isPhysicalBackup(plainDumpPath(backup))
+		if !physical && (backup.DatabaseName == nil || *backup.DatabaseName != database) {
+			continue
+		}
+		at := consistentAt(backup)
+		if at.After(targetTime) {
+			continue
+		}
+		if chosen == nil || at.After(consistentAt(chosen)) {
+			chosen = backup
+		}
+	}
+	if chosen == nil {
+		return nil, &RestoreTargetError{Reason: fmt.Sprintf("no completed backup of '%s' was taken before %s", database, targetTime.Format(time.RFC3339))}
+	}
+
+	chain, err := s.backupChain(chosen)
+	if err != nil {
+		return nil, err
+	}
+	chainIDs := make([]string, len(chain))
+	for i, b := range chain {
+		chainIDs[i] = b.ID.String()
+	}
+
+	recoveredTo := consistentAt(chosen)
+	plan := &PointInTimePlan{
+		TargetTime:  targetTime,
+		BackupID:    chosen.ID.String(),
+		Chain:       chainIDs,
+		Database:    chosen.DatabaseName,
+		Physical:    isPhysicalBackup(plainDumpPath(chosen)),
+		RecoveredTo: recoveredTo,
+		GapSeconds:  targetTime.Sub(recoveredTo).Seconds(),
+	}
+
+	switch {
+	case !plan.Physical:
+		plan.Steps = []string{fmt.Sprintf("Restore backup %s", chosen.ID)}
+	case isXtraBackup(plainDumpPath(chosen)):
+		plan.preparable = true
+		plan.Steps = []string{fmt.Sprintf("Prepare the chain of %d backups ending with %s for xtrabackup --copy-back", len(chain), chosen.ID)}
+	default:
+		plan.Steps = restoreSteps(chosen, conn)
+	}
+	if plan.GapSeconds > 0 {
+		plan.Steps = append(plan.Steps, fmt.Sprintf("Changes made between %s and %s are not recovered, since no WAL or binlog is archived",
+			recoveredTo.Format(time.RFC3339), targetTime.Format(time.RFC3339)))
+	}
+
+	return plan, nil
+}
+
+// RestoreToPointInTime carries out a plan: logical backups are restored into
+// the target connection, physical MySQL chains are prepared for copy-back
+func (s *BackupService) RestoreToPointInTime(plan *PointInTimePlan, req *PointInTimeRestoreRequest, userID uuid.UUID, access *ArtifactAccess) (*PointInTimeRestoreResult, error) {
+	result := &PointInTimeRestoreResult{Plan: plan}
+
+	if plan.Physical {
+		if !plan.preparable {
+			return nil, &RestoreTargetError{Reason: "physical PostgreSQL backups replace a whole server's data directory and are restored by hand. See the plan's steps"}
+		}
+		if req.TargetConnectionID != "" && req.TargetConnectionID != req.ConnectionID {
+			return nil, &RestoreTargetError{Reason: "physical backups are copied back onto a stopped server and cannot be restored into another connection"}
+		}
+		prepared, err := s.PreparePhysicalBackup(plan.BackupID, userID)
+		if err != nil {
+			return nil, err
+		}
+		result.Prepared = prepared
+		return result, nil
+	}
+
+	targetID := req.TargetConnectionID
+	if targetID == "" {
+		targetID = req.ConnectionID
+	}
+	restore := &RestoreToConnectionRequest{
+		ConnectionID:   targetID,
+		CreateDatabase: req.CreateDatabase,
+		KeepOwnership:  req.KeepOwnership || targetID == req.ConnectionID,
+		OnConflict:     req.OnConflict,
+	}
+	if targetID == req.ConnectionID && plan.Database != nil {
+		restore.DatabaseName = *plan.Database
+	}
+
+	restoreResult, err := s.restoreToTarget(plan.BackupID, userID, restore, restoreOrigin{trigger: RestoreTriggerPointInTime, access: access})
+	if err != nil {
+		return nil, err
+	}
+	result.Restore = restoreResult
+	return result, nil
+}
+
+// sendPointInTimeError maps the errors of planning and carrying out a
+// point-in-time restore to a response
+func sendPointInTimeError(w http.ResponseWriter, err error) {
+	var conflict *RestoreConflictError
+	var invalidTarget *RestoreTargetError
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Connection not found")
+	case errors.As(err, &conflict), errors.Is(err, ErrRestoreCancelled):
+		response.SendError(w, http.StatusConflict, err.Error())
+	case errors.As(err, &invalidTarget):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *BackupHandler) GetPointInTimePlan(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	connectionID := r.URL.Query().Get("connection_id")
+	if connectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+
+	targetTime, err := time.Parse(time.RFC3339, r.URL.Query().Get("target_time"))
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, "target_time must be an RFC 3339 timestamp")
+		return
+	}
+
+	plan, err := h.backupService.PlanPointInTimeRestore(connectionID, r.URL.Query().Get("database"), targetTime, userID)
+	if err != nil {
+		sendPointInTimeError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Point-in-time restore plan retrieved successfully", plan)
+}
+
+func (h *BackupHandler) RestoreToPointInTime(w http.ResponseWriter, r *http.Request) {
+	var req PointInTimeRestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.ConnectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plan, err := h.backupService.PlanPointInTimeRestore(req.ConnectionID, req.Database, req.TargetTime, userID)
+	if err != nil {
+		sendPointInTimeError(w, err)
+		return
+	}
+
+	action := AccessRestore
+	if plan.Physical {
+		action = AccessPrepare
+	}
+	access := newArtifactAccess(r, plan.BackupID, userID, action)
+	detail := fmt.Sprintf("point in time %s", req.TargetTime.Format(time.RFC3339))
+	if req.TargetConnectionID != "" {
+		detail += " into connection " + req.TargetConnectionID
+	}
+	access.Detail = &detail
+	if err := h.backupService.recordArtifactAccess(access); err != nil {
+		sendAccessError(w, err)
+		return
+	}
+
+	result, err := h.backupService.RestoreToPointInTime(plan, &req, userID, access)
+	if err != nil {
+		sendPointInTimeError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Backup restored to point in time successfully", result)
+}
@@ -0,0 +1,411 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// Post-processor types
+const (
+	PostProcessorSplit    = "split"
+	PostProcessorPar2     = "par2"
+	PostProcessorPlainSQL = "plain_sql"
+)
+
+const (
+	defaultSplitPartSizeMB       = 1024
+	defaultPar2RedundancyPercent = 10
+)
+
+// PostProcessor runs on a finished artifact before it is uploaded and writes
+// extra files next to it. The artifact itself is left unchanged.
+type PostProcessor struct {
+	Type string `json:"type"`
+	// PartSizeMB is the part size of split. PartSizeGB sets it in gigabytes
+	// and is stored as megabytes.
+	PartSizeMB int `json:"part_size_mb,omitempty"`
+	PartSizeGB int `json:"part_size_gb,omitempty"`
+	// ReplaceArtifact has split keep and upload only the parts, for backends
+	// and filesystems that cannot hold the whole artifact
+	ReplaceArtifact bool `json:"replace_artifact,omitempty"`
+	// RedundancyPercent is the share of recoverable damage for par2
+	RedundancyPercent int `json:"redundancy_percent,omitempty"`
+}
+
+// PostProcessors run in the configured order
+type PostProcessors []PostProcessor
+
+// Value stores the processors as JSON in a nullable text column
+func (p PostProcessors) Value() (driver.Value, error) {
+	if len(p) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (p *PostProcessors) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	case []byte:
+		return json.Unmarshal(v, p)
+	default:
+		return fmt.Errorf("cannot scan %T into post-processors", src)
+	}
+}
+
+// PostProcessedFile is a file a post-processor wrote next to an artifact
+type PostProcessedFile struct {
+	Processor string  `json:"processor"`
+	Path      string  `json:"path"`
+	ObjectKey *string `json:"object_key,omitempty"`
+	Size      int64   `json:"size"`
+	// Number is the position of a split part, starting at 1
+	Number int `json:"number,omitempty"`
+	// Checksum is the SHA-256 of a split part
+	Checksum *string `json:"checksum,omitempty"`
+}
+
+type PostProcessedFiles []PostProcessedFile
+
+// Value stores the files as JSON in a nullable text column
+func (f PostProcessedFiles) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (f *PostProcessedFiles) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	case []byte:
+		return json.Unmarshal(v, f)
+	default:
+		return fmt.Errorf("cannot scan %T into post-processed files", src)
+	}
+}
+
+// artifactProcessor writes its output files for a local artifact and returns
+// them. Processor and Size are filled in by the caller.
+type artifactProcessor func(s *BackupService, backup *Backup, conn *connection.StoredConnection, config PostProcessor) ([]PostProcessedFile, error)
+
+// filesAt returns the processed files at paths
+func filesAt(paths []string) []PostProcessedFile {
+	files := make([]PostProcessedFile, len(paths))
+	for i, path := range paths {
+		files[i] = PostProcessedFile{Path: path}
+	}
+	return files
+}
+
+// artifactProcessors are the available post-processors by type
+var artifactProcessors = map[string]artifactProcessor{
+	PostProcessorSplit:    splitArtifact,
+	PostProcessorPar2:     par2Artifact,
+	PostProcessorPlainSQL: plainSQLCopy,
+}
+
+// validatePostProcessors checks the processors submitted with a schedule
+// request and fills in defaults. An empty list clears them.
+func (s *BackupService) validatePostProcessors(connectionID string, processors *PostProcessors) (PostProcessors, error) {
+	if processors == nil || len(*processors) == 0 {
+		return nil, nil
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	var validated PostProcessors
+	for _, processor := range *processors {
+		processor.Type = strings.ToLower(strings.TrimSpace(processor.Type))
+		if _, ok := artifactProcessors[processor.Type]; !ok {
+			return nil, fmt.Errorf("unknown post-processor: %s", processor.Type)
+		}
+		if seen[processor.Type] {
+			return nil, fmt.Errorf("post-processor %s is configured more than once", processor.Type)
+		}
+		seen[processor.Type] = true
+
+		switch processor.Type {
+		case PostProcessorSplit:
+			if processor.PartSizeGB != 0 {
+				if processor.PartSizeMB != 0 {
+					return nil, fmt.Errorf("set either part_size_mb or part_size_gb for split")
+				}
+				if processor.PartSizeGB < 1 {
+					return nil, fmt.Errorf("split part size must be at least 1 GB")
+				}
+				processor.PartSizeMB = processor.PartSizeGB * 1024
+				processor.PartSizeGB = 0
+			}
+			if processor.PartSizeMB == 0 {
+				processor.PartSizeMB = defaultSplitPartSizeMB
+			}
+			if processor.PartSizeMB < 1 {
+				return nil, fmt.Errorf("split part size must be at least 1 MB")
+			}
+			processor.RedundancyPercent = 0
+		case PostProcessorPar2:
+			if _, err := exec.LookPath("par2"); err != nil {
+				return nil, fmt.Errorf("par2 not found in PATH")
+			}
+			if processor.RedundancyPercent == 0 {
+				processor.RedundancyPercent = defaultPar2RedundancyPercent
+			}
+			if processor.RedundancyPercent < 1 || processor.RedundancyPercent > 100 {
+				return nil, fmt.Errorf("par2 redundancy must be between 1 and 100 percent")
+			}
+			processor.PartSizeMB = 0
+			processor.ReplaceArtifact = false
+		case PostProcessorPlainSQL:
+			if conn.Type != "postgresql" {
+				return nil, fmt.Errorf("plain SQL copies are only supported for postgresql connections")
+			}
+			processor.PartSizeMB = 0
+			processor.RedundancyPercent = 0
+			processor.ReplaceArtifact = false
+		}
+
+		validated = append(validated, processor)
+	}
+
+	return validated, nil
+}
+
+// postProcessBackupIfConfigured runs the schedule's post-processors on a local
+// artifact. A failing processor is reported but does not fail the backup,
+// since the artifact itself is complete.
+func (s *BackupService) postProcessBackupIfConfigured(backup *Backup, conn *connection.StoredConnection, schedule *BackupSchedule) {
+	if schedule == nil || len(schedule.PostProcessors) == 0 {
+		return
+	}
+
+	for _, config := range schedule.PostProcessors {
+		process, ok := artifactProcessors[config.Type]
+		if !ok {
+			slog.WarnContext(backupContext(backup), "Skipping unknown post-processor", "post_processor", config.Type, "backup_id", backup.ID)
+			continue
+		}
+
+		files, err := process(s, backup, conn, config)
+		if err != nil {
+			slog.WarnContext(backupContext(backup), "Post-processor failed", "post_processor", config.Type, "backup_id", backup.ID, "error", err)
+			continue
+		}
+
+		for _, file := range files {
+			fileInfo, err := os.Stat(file.Path)
+			if err != nil {
+				slog.WarnContext(backupContext(backup), "Failed to get file info", "path", file.Path, "error", err)
+				continue
+			}
+			file.Processor = config.Type
+			file.Size = fileInfo.Size()
+			backup.PostProcessedFiles = append(backup.PostProcessedFiles, file)
+		}
+	}
+}
+
+// splitArtifact copies the artifact into numbered parts of a fixed size, for
+// storage with object or media size limits. Concatenating the parts in order
+// restores the artifact. The parts are recorded with their number and
+// checksum, which are also added to the artifact's manifest as its part index.
+func splitArtifact(s *BackupService, backup *Backup, conn *connection.StoredConnection, config PostProcessor) ([]PostProcessedFile, error) {
+	src, err := os.Open(backup.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	partSize := int64(config.PartSizeMB) * 1024 * 1024
+	var parts []PostProcessedFile
+	var index strings.Builder
+	for number := 1; ; number++ {
+		partPath := fmt.Sprintf("%s.part%03d", backup.Path, number)
+		written, checksum, err := writePart(src, partPath, partSize)
+		if err != nil {
+			removeFiles(append(partPaths(parts), partPath))
+			return nil, fmt.Errorf("failed to write part %d: %v", number, err)
+		}
+		if written == 0 {
+			os.Remove(partPath)
+			break
+		}
+		parts = append(parts, PostProcessedFile{Path: partPath, Number: number, Checksum: &checksum})
+		fmt.Fprintf(&index, "%s  %s\n", checksum, filepath.Base(partPath))
+		if written < partSize {
+			break
+		}
+	}
+
+	if err := appendToManifest(backup.Path, index.String()); err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to add part index to checksum manifest", "path", backup.Path, "error", err)
+	}
+
+	return parts, nil
+}
+
+func partPaths(parts []PostProcessedFile) []string {
+	paths := make([]string, len(parts))
+	for i, part := range parts {
+		paths[i] = part.Path
+	}
+	return paths
+}
+
+// writePart copies the next part and returns its size and checksum
+func writePart(src io.Reader, partPath string, size int64) (int64, string, error) {
+	part, err := os.Create(partPath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer part.Close()
+
+	hash := sha256.New()
+	written, err := io.CopyN(io.MultiWriter(part, hash), src, size)
+	if err != nil && err != io.EOF {
+		return written, "", err
+	}
+	return written, hex.EncodeToString(hash.Sum(nil)), part.Sync()
+}
+
+// par2Artifact writes PAR2 recovery files that can repair a damaged artifact
+func par2Artifact(s *BackupService, backup *Backup, conn *connection.StoredConnection, config PostProcessor) ([]PostProcessedFile, error) {
+	binPath, err := exec.LookPath("par2")
+	if err != nil {
+		return nil, fmt.Errorf("par2 not found in PATH")
+	}
+
+	indexPath := backup.Path + ".par2"
+	cmd := exec.Command(binPath, "create", "-q",
+		fmt.Sprintf("-r%d", config.RedundancyPercent), indexPath, backup.Path)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// par2 writes the index file and volume files such as "<name>.vol00+10.par2"
+	entries, err := os.ReadDir(filepath.Dir(backup.Path))
+	if err != nil {
+		return nil, err
+	}
+	volumePrefix := filepath.Base(backup.Path) + ".vol"
+	var volumes []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, volumePrefix) && strings.HasSuffix(name, ".par2") {
+			volumes = append(volumes, filepath.Join(filepath.Dir(backup.Path), name))
+		}
+	}
+	sort.Strings(volumes)
+
+	return filesAt(append([]string{indexPath}, volumes...)), nil
+}
+
+// plainSQLCopy renders a custom-format archive as a SQL script next to it, so
+// the backup can also be read or restored without pg_restore.
+func plainSQLCopy(s *BackupService, backup *Backup, conn *connection.StoredConnection, config PostProcessor) ([]PostProcessedFile, error) {
+	if backup.EncryptionKeyFingerprint != nil {
+		return nil, fmt.Errorf("the artifact is encrypted")
+	}
+
+	contentPath, isTemp, err := s.ensureBackupContentAvailable(backup, conn.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if isTemp {
+		defer os.Remove(contentPath)
+	}
+
+	if !isCustomDump(contentPath) {
+		return nil, fmt.Errorf("the artifact is not a custom-format archive")
+	}
+
+	sqlPath := backup.Path + ".sql"
+	if err := s.writeCustomDumpSQL(contentPath, sqlPath); err != nil {
+		os.Remove(sqlPath)
+		return nil, err
+	}
+
+	return filesAt([]string{sqlPath}), nil
+}
+
+// uploadPostProcessedFiles uploads the post-processed files next to the
+// artifact. Failed uploads only leave the files local.
+func uploadPostProcessedFiles(s3Storage *S3Storage, transfer *transfer, backup *Backup, subfolder string) {
+	ctx := context.Background()
+	for i := range backup.PostProcessedFiles {
+		file := &backup.PostProcessedFiles[i]
+		objectKey, err := uploadFile(ctx, s3Storage, transfer, file.Path, subfolder)
+		if err != nil {
+			slog.WarnContext(backupContext(backup), "Failed to upload post-processed file to S3", "path", file.Path, "error", err)
+			continue
+		}
+		file.ObjectKey = &objectKey
+	}
+}
+
+// removePostProcessedFiles deletes the local post-processed files of a backup
+func removePostProcessedFiles(backup *Backup) {
+	var paths []string
+	for _, file := range backup.PostProcessedFiles {
+		paths = append(paths, file.Path)
+	}
+	removeFiles(paths)
+}
+
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			slog.Warn("Failed to delete file", "path", path, "error", err)
+		}
+	}
+}
+
+// deletePostProcessedFiles removes the post-processed files of a backup past
+// retention, including their S3 copies when the connection cleans up S3.
+func (s *BackupService) deletePostProcessedFiles(ctx context.Context, backup *Backup, s3Storage *S3Storage, cleanupS3 bool) {
+	if s3Storage != nil && cleanupS3 {
+		for _, file := range backup.PostProcessedFiles {
+			if file.ObjectKey == nil {
+				continue
+			}
+			if err := s3Storage.DeleteFile(ctx, *file.ObjectKey); err != nil {
+				slog.Warn("Failed to delete S3 object of backup", "object_key", *file.ObjectKey, "backup_id", backup.ID, "error", err)
+			}
+		}
+	}
+	removePostProcessedFiles(backup)
+}
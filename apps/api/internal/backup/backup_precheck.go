@@ -0,0 +1,247 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPrecheckMinutes   = 15
+	defaultPrecheckMinFreeMB = 512
+	precheckDialTimeout      = 10 * time.Second
+	// precheckSchedule looks for upcoming runs once a minute
+	precheckSchedule = "0 * * * * *"
+)
+
+// precheckLeadTime reads BACKUP_PRECHECK_MINUTES, how long before a scheduled
+// run its pre-check happens. Zero or "off" disables pre-checks.
+func precheckLeadTime() time.Duration {
+	value := strings.TrimSpace(os.Getenv("BACKUP_PRECHECK_MINUTES"))
+	if strings.EqualFold(value, "off") {
+		return 0
+	}
+
+	minutes := defaultPrecheckMinutes
+	if value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			slog.Warn("Invalid BACKUP_PRECHECK_MINUTES, using the default", "value", value, "default_minutes", defaultPrecheckMinutes)
+		} else {
+			minutes = parsed
+		}
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// precheckMinFree reads BACKUP_PRECHECK_MIN_FREE_MB, the free space the backup
+// directory needs regardless of previous backup sizes.
+func precheckMinFree() uint64 {
+	sizeMB := defaultPrecheckMinFreeMB
+	if value := strings.TrimSpace(os.Getenv("BACKUP_PRECHECK_MIN_FREE_MB")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			slog.Warn("Invalid BACKUP_PRECHECK_MIN_FREE_MB, using the default", "value", value, "default_mb", defaultPrecheckMinFreeMB)
+		} else {
+			sizeMB = parsed
+		}
+	}
+	return uint64(sizeMB) * 1024 * 1024
+}
+
+// schedulePrechecks registers the job that pre-checks upcoming scheduled runs
+func (s *BackupService) schedulePrechecks() {
+	if s.precheckEntry != 0 {
+		s.cronManager.Remove(s.precheckEntry)
+		s.precheckEntry = 0
+	}
+
+	if precheckLeadTime() == 0 {
+		return
+	}
+
+	entryID, err := s.cronManager.AddFunc(precheckSchedule, s.runDuePrechecks)
+	if err != nil {
+		slog.Error("Failed to schedule backup pre-checks", "error", err)
+		return
+	}
+	s.precheckEntry = entryID
+}
+
+// runDuePrechecks pre-checks every active schedule whose next run falls within
+// the lead time. Each run is pre-checked once.
+func (s *BackupService) runDuePrechecks() {
+	lead := precheckLeadTime()
+	if lead == 0 {
+		return
+	}
+
+	schedules, err := s.backupRepo.GetAllActiveSchedules()
+	if err != nil {
+		slog.Error("Failed to get schedules for pre-checks", "error", err)
+		return
+	}
+
+	now := time.Now()
+
+	s.precheckMu.Lock()
+	defer s.precheckMu.Unlock()
+
+	for _, schedule := range schedules {
+		if schedule.Paused {
+			continue
+		}
+		spec, err := schedule.cronSchedule()
+		if err != nil {
+			continue
+		}
+
+		runAt := spec.Next(now)
+		if runAt.IsZero() || runAt.Sub(now) > lead {
+			continue
+		}
+
+		scheduleID := schedule.ID.String()
+		if checked, ok := s.prechecked[scheduleID]; ok && checked.Equal(runAt) {
+			continue
+		}
+		s.prechecked[scheduleID] = runAt
+
+		go func(schedule *BackupSchedule, runAt time.Time) {
+			problems, conn := s.precheckSchedule(schedule)
+			if len(problems) == 0 {
+				return
+			}
+
+			slog.Warn("Pre-check for backup of connection failed",
+				"connection_id", schedule.ConnectionID, "run_at", runAt.Format(time.RFC3339), "problems", strings.Join(problems, "; "))
+			if conn != nil {
+				s.createPrecheckNotification(conn, runAt, problems)
+			}
+		}(schedule, runAt)
+	}
+}
+
+// precheckSchedule runs lightweight checks for an upcoming backup: the dump
+// tool exists, the server (or SSH jump host) accepts connections and the
+// backup directory has room for another artifact.
+func (s *BackupService) precheckSchedule(schedule *BackupSchedule) ([]string, *connection.StoredConnection) {
+	conn, err := s.connStorage.GetConnection(schedule.ConnectionID)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to get connection: %v", err)}, nil
+	}
+
+	var problems []string
+
+	if s.findDatabaseBinaryPath(conn.Type) == "" {
+		problems = append(problems, fmt.Sprintf("%s not found in PATH", requiredTools[conn.Type]))
+	}
+
+	host, port := conn.Host, conn.Port
+	if conn.SSHEnabled {
+		host, port = conn.SSHHost, conn.SSHPort
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	dialConn, err := net.DialTimeout("tcp", address, precheckDialTimeout)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("cannot reach %s: %v", address, err))
+	} else {
+		dialConn.Close()
+	}
+
+	if s.streamingStorageFor(conn, schedule) == nil {
+		if problem := s.precheckDiskSpace(conn.ID); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	return problems, conn
+}
+
+// precheckDiskSpace expects room for twice the latest artifact, since
+// compression and encryption briefly keep two copies on disk.
+func (s *BackupService) precheckDiskSpace(connectionID string) string {
+	free, err := freeDiskSpace(s.backupDir)
+	if err != nil {
+		slog.Warn("Failed to check free space", "path", s.backupDir, "error", err)
+		return ""
+	}
+
+	required := precheckMinFree()
+	if backups, err := s.backupRepo.GetBackupsByConnectionID(connectionID); err == nil {
+		for _, backup := range backups {
+			if backup.Status == "completed" {
+				if size := uint64(backup.Size) * 2; size > required {
+					required = size
+				}
+				break
+			}
+		}
+	}
+
+	if free < required {
+		return fmt.Sprintf("backup directory has %d MB free, at least %d MB needed",
+			free/1024/1024, required/1024/1024)
+	}
+	return ""
+}
+
+func (s *BackupService) createPrecheckNotification(conn *connection.StoredConnection, runAt time.Time, problems []string) {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+	if err != nil || userSettings == nil {
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"connection_id":  conn.ID,
+		"database_name":  conn.DatabaseName,
+		"database_type":  conn.Type,
+		"scheduled_time": runAt.Format(time.RFC3339),
+		"problems":       problems,
+		"timestamp":      time.Now().Format(time.RFC3339),
+	}
+
+	metadataJSON, _ := json.Marshal(metadata)
+	n := &notification.Notification{
+		ID:     uuid.New(),
+		UserID: conn.UserID,
+		Title:  "Upcoming Backup May Fail",
+		Message: fmt.Sprintf("Pre-check for the backup of '%s' at %s failed: %s",
+			conn.Name, runAt.Format("15:04"), strings.Join(problems, "; ")),
+		Type:      notification.BackupPrecheckFailed,
+		Status:    notification.StatusUnread,
+		Metadata:  metadataJSON,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	s.dispatchWebhooks(n, metadata)
+
+	if s.notifyThroughFallbacks(userSettings, n, metadata) {
+		return
+	}
+
+	if userSettings.NotifyDashboard {
+		if err := s.notificationRepo.CreateNotification(n); err != nil {
+			slog.Error("Failed to create pre-check notification", "error", err)
+		}
+	}
+
+	if userSettings.NotifyWebhook && userSettings.WebhookURL != nil {
+		go s.sendWebhookNotification(*userSettings.WebhookURL, metadata)
+	}
+
+	s.notifyDiscord(userSettings, conn.ID, n, metadata)
+	s.notifyEmail(userSettings, n, metadata)
+	s.notifyPush(userSettings, n, metadata)
+	s.notifyMatrix(userSettings, n, metadata)
+}
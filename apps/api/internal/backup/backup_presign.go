@@ -0,0 +1,203 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPresignExpiryMinutes = 60
+	// S3 rejects pre-signed URLs valid for more than seven days
+	maxPresignExpiryMinutes = 7 * 24 * 60
+)
+
+// presignExpiry reads BACKUP_PRESIGN_EXPIRY_MINUTES, how long a pre-signed
+// upload URL stays valid.
+func presignExpiry() time.Duration {
+	minutes := defaultPresignExpiryMinutes
+	if value := strings.TrimSpace(os.Getenv("BACKUP_PRESIGN_EXPIRY_MINUTES")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxPresignExpiryMinutes {
+			slog.Warn("Invalid BACKUP_PRESIGN_EXPIRY_MINUTES, using the default", "value", value, "default_minutes", defaultPresignExpiryMinutes)
+		} else {
+			minutes = parsed
+		}
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// externalUploadTarget returns the user's connection and the S3 storage of
+// its owner for an artifact uploaded from outside the API server
+func (s *BackupService) externalUploadTarget(connectionID string, userID uuid.UUID) (*connection.StoredConnection, *S3Storage, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, nil, sql.ErrNoRows
+	}
+
+	storage, err := s.s3StorageForUser(conn.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if storage == nil {
+		return nil, nil, fmt.Errorf("direct uploads need S3 storage to be enabled")
+	}
+	return conn, storage, nil
+}
+
+// PresignBackupUpload issues a pre-signed PUT URL in the connection's folder,
+// so an uploader running next to the database sends the artifact straight to
+// S3 instead of through the API server.
+func (s *BackupService) PresignBackupUpload(req *PresignUploadRequest, userID uuid.UUID) (*PresignedUpload, error) {
+	fileName := strings.TrimSpace(req.FileName)
+	if fileName == "" || strings.ContainsAny(fileName, `/\`) || strings.HasPrefix(fileName, ".") {
+		return nil, fmt.Errorf("file_name must be a plain file name")
+	}
+
+	conn, storage, err := s.externalUploadTarget(req.ConnectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := presignExpiry()
+	objectKey := storage.getObjectKeyWithPath(fileName, common.SanitizeConnectionName(conn.Name))
+	presigned, err := storage.PresignUpload(context.Background(), objectKey, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PresignedUpload{
+		ObjectKey: objectKey,
+		URL:       presigned.String(),
+		Method:    http.MethodPut,
+		ExpiresAt: time.Now().Add(expiry),
+	}, nil
+}
+
+// CompleteBackupUpload records an artifact uploaded with a pre-signed URL as
+// a completed backup. The object has to be in the connection's folder and is
+// only accepted once S3 reports it.
+func (s *BackupService) CompleteBackupUpload(req *CompleteUploadRequest, userID uuid.UUID) (*Backup, error) {
+	conn, storage, err := s.externalUploadTarget(req.ConnectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	subfolder := common.SanitizeConnectionName(conn.Name)
+	fileName := filepath.Base(req.ObjectKey)
+	if req.ObjectKey == "" || storage.getObjectKeyWithPath(fileName, subfolder) != req.ObjectKey {
+		return nil, fmt.Errorf("object_key is not an upload of this connection")
+	}
+
+	if req.Checksum != nil {
+		checksum := strings.ToLower(strings.TrimSpace(*req.Checksum))
+		if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != 32 {
+			return nil, fmt.Errorf("checksum must be a hex SHA-256")
+		}
+		req.Checksum = &checksum
+	}
+
+	size, err := storage.GetFileSize(context.Background(), req.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("uploaded object not found: %v", err)
+	}
+
+	databaseName := conn.DatabaseName
+	if req.DatabaseName != nil && *req.DatabaseName != "" {
+		databaseName = *req.DatabaseName
+	}
+
+	objectKey := req.ObjectKey
+	now := time.Now()
+	// There is no local copy; the artifact is fetched from S3 when needed
+	backup := &Backup{
+		ID:            uuid.New(),
+		ConnectionID:  conn.ID,
+		DatabaseName:  &databaseName,
+		Status:        "completed",
+		Path:          filepath.Join(s.backupDir, subfolder, fileName),
+		S3ObjectKey:   &objectKey,
+		Size:          size,
+		Checksum:      req.Checksum,
+		StartedTime:   now,
+		CompletedTime: &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if err := s.backupRepo.CreateBackup(backup); err != nil {
+		return nil, fmt.Errorf("failed to save backup: %v", err)
+	}
+
+	slog.Info("Registered directly uploaded backup", "backup_id", backup.ID, "object_key", objectKey)
+	return backup, nil
+}
+
+func (h *BackupHandler) PresignBackupUpload(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req PresignUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	upload, err := h.backupService.PresignBackupUpload(&req, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Upload URL created successfully", upload)
+}
+
+func (h *BackupHandler) CompleteBackupUpload(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req CompleteUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	backup, err := h.backupService.CompleteBackupUpload(&req, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Uploaded backup registered successfully", backup)
+}
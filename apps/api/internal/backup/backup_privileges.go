@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// privilegeCheckTTL is how long a privilege check is reused under the warn
+// policy, so backups do not open an extra connection to inspect grants
+// every time
+const privilegeCheckTTL = time.Hour
+
+type cachedPrivilegeCheck struct {
+	check     *connection.PrivilegeCheck
+	checkedAt time.Time
+}
+
+// dumpPrivileges returns the privilege check of a connection. The warn policy
+// only reports, so it reuses a recent check; the strict policy refuses
+// backups and always checks the grants as they are now.
+func (s *BackupService) dumpPrivileges(connectionID, policy string) (*connection.PrivilegeCheck, error) {
+	if policy == connection.PrivilegePolicyWarn {
+		if cached, ok := s.privilegeChecks.Load(connectionID); ok {
+			if entry := cached.(*cachedPrivilegeCheck); time.Since(entry.checkedAt) < privilegeCheckTTL {
+				return entry.check, nil
+			}
+		}
+	}
+
+	check, err := s.connService.CheckDumpPrivileges(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	s.privilegeChecks.Store(connectionID, &cachedPrivilegeCheck{check: check, checkedAt: time.Now()})
+	return check, nil
+}
+
+// preflightDumpPrivileges checks the connection's user against the configured
+// privilege policy. It returns the warnings to surface to the user, or an error
+// when the strict policy forbids backing up with this account.
+func (s *BackupService) preflightDumpPrivileges(connectionID string) ([]string, error) {
+	policy := connection.GetPrivilegePolicy()
+	if policy == connection.PrivilegePolicyOff || s.connService == nil {
+		return nil, nil
+	}
+
+	check, err := s.dumpPrivileges(connectionID, policy)
+	if err != nil {
+		// Connectivity problems are reported by the dump itself
+		slog.Warn("Privilege pre-flight check failed for connection", "connection_id", connectionID, "error", err)
+		return nil, nil
+	}
+
+	if check.Compliant {
+		return nil, nil
+	}
+
+	warnings := append([]string{}, check.Warnings...)
+	if len(check.Missing) > 0 {
+		warnings = append(warnings, fmt.Sprintf("user '%s' is missing privileges required to dump: %s",
+			check.User, strings.Join(check.Missing, ", ")))
+	}
+	if len(check.Excessive) > 0 {
+		warnings = append(warnings, fmt.Sprintf("user '%s' has more privileges than required to dump: %s",
+			check.User, strings.Join(check.Excessive, ", ")))
+	}
+
+	if policy == connection.PrivilegePolicyStrict && (check.IsSuperuser || len(check.Excessive) > 0) {
+		return warnings, fmt.Errorf("backup refused by privilege policy: %s", strings.Join(warnings, "; "))
+	}
+
+	for _, warning := range warnings {
+		slog.Warn("Connection lacks a dump privilege", "connection_id", connectionID, "warning", warning)
+	}
+
+	return warnings, nil
+}
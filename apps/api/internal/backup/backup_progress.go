@@ -0,0 +1,431 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+)
+
+// Phases of a run or restore besides its stages, which are named after
+// their spans: dump, stream, compress, encrypt, checksum, post_process and
+// upload for backups, fetch, prepare and restore for restores
+const (
+	ProgressPhaseQueued   = "queued"
+	ProgressPhaseStarting = "starting"
+	ProgressPhaseRestore  = "restore"
+	ProgressPhaseFinished = "finished"
+)
+
+const (
+	// progressStreamInterval is how often progress streams send what changed
+	progressStreamInterval = time.Second
+	// progressRetention keeps a finished run or restore listed, so a client
+	// that connects late sees how it ended
+	progressRetention = time.Minute
+)
+
+// OperationProgress is the progress of a running backup run or restore. It
+// shares the ID of the run or restore. Bytes, totals and throughput are
+// those of the current phase; the total of a dump is estimated from the
+// database size.
+type OperationProgress struct {
+	ID                       string  `json:"id"`
+	Kind                     string  `json:"kind"`
+	ConnectionID             string  `json:"connection_id"`
+	Phase                    string  `json:"phase"`
+	Database                 string  `json:"database,omitempty"`
+	BytesProcessed           int64   `json:"bytes_processed"`
+	TotalBytes               int64   `json:"total_bytes,omitempty"`
+	TotalEstimated           bool    `json:"total_estimated,omitempty"`
+	ThroughputBytesPerSecond float64 `json:"throughput_bytes_per_second"`
+	ETASeconds               *int64  `json:"eta_seconds,omitempty"`
+	// Progress is the percentage of the current phase done, missing when
+	// its total is unknown
+	Progress       *float64   `json:"progress,omitempty"`
+	StartedAt      time.Time  `json:"started_at"`
+	PhaseStartedAt time.Time  `json:"phase_started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+	// Status is how the run or restore ended
+	Status string `json:"status,omitempty"`
+	// Version grows with every change, so clients can skip repeated events
+	Version int64 `json:"version"`
+}
+
+// progressMeter follows a run or restore through its phases. The pipeline
+// reports phases and bytes to it; clients read snapshots of it.
+type progressMeter struct {
+	mu   sync.Mutex
+	info OperationProgress
+	// watched is a dump being written, whose size is the bytes processed
+	watched     string
+	windowStart time.Time
+	windowBytes int64
+	rate        float64
+	// restore reports the bytes a restore tool read
+	restore *restoreJob
+}
+
+// beginProgress starts following a run or restore. It must be ended with
+// endProgress.
+func (s *BackupService) beginProgress(id, kind, connectionID string) *progressMeter {
+	now := time.Now()
+	m := &progressMeter{
+		info: OperationProgress{
+			ID:             id,
+			Kind:           kind,
+			ConnectionID:   connectionID,
+			Phase:          ProgressPhaseQueued,
+			StartedAt:      now,
+			PhaseStartedAt: now,
+			Version:        1,
+		},
+		windowStart: now,
+	}
+	s.progressMeters.Store(id, m)
+	return m
+}
+
+// endProgress records how the run or restore ended and forgets it after
+// progressRetention
+func (s *BackupService) endProgress(m *progressMeter, status string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	now := time.Now()
+	m.enterPhase(ProgressPhaseFinished, now)
+	m.info.FinishedAt = &now
+	m.info.Status = status
+	m.restore = nil
+	m.mu.Unlock()
+
+	time.AfterFunc(progressRetention, func() {
+		s.progressMeters.Delete(m.info.ID)
+	})
+}
+
+// progressMeterFor returns the meter of the run that makes the backup
+func (s *BackupService) progressMeterFor(backup *Backup) *progressMeter {
+	if backup.RunID == nil {
+		return nil
+	}
+	value, ok := s.progressMeters.Load(*backup.RunID)
+	if !ok {
+		return nil
+	}
+	return value.(*progressMeter)
+}
+
+// enterPhase starts a phase, whose bytes are counted from zero. The lock is
+// held.
+func (m *progressMeter) enterPhase(phase string, now time.Time) {
+	m.info.Phase = phase
+	m.info.PhaseStartedAt = now
+	m.info.BytesProcessed = 0
+	m.info.TotalBytes = 0
+	m.info.TotalEstimated = false
+	m.info.Version++
+	m.watched = ""
+	m.windowStart = now
+	m.windowBytes = 0
+	m.rate = 0
+}
+
+// setPhase reports that the run or restore moved on to a phase, for the
+// database when it is given
+func (m *progressMeter) setPhase(phase, database string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enterPhase(phase, time.Now())
+	if database != "" {
+		m.info.Database = database
+	}
+}
+
+// setTotal reports how many bytes the current phase processes
+func (m *progressMeter) setTotal(total int64, estimated bool) {
+	if m == nil || total <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.info.TotalBytes = total
+	m.info.TotalEstimated = estimated
+	m.info.Version++
+}
+
+// add reports n more bytes processed by the current phase
+func (m *progressMeter) add(n int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.info.BytesProcessed += int64(n)
+	m.info.Version++
+}
+
+// watch measures the current phase by the size of the dump at path, a file
+// or a directory dump
+func (m *progressMeter) watch(path string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.watched = path
+}
+
+// trackRestore measures the restore phase by the bytes the tool reads
+func (m *progressMeter) trackRestore(job *restoreJob) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.restore = job
+}
+
+// dumpSize returns the size of a dump being written
+func dumpSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if !info.IsDir() {
+		return info.Size()
+	}
+	var size int64
+	filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// snapshot samples the meter: the size of a watched dump, the bytes of a
+// restore, the throughput over the last window and the ETA from it
+func (m *progressMeter) snapshot() OperationProgress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.watched != "" {
+		if size := dumpSize(m.watched); size != m.info.BytesProcessed {
+			m.info.BytesProcessed = size
+			m.info.Version++
+		}
+	}
+	if m.restore != nil {
+		job := m.restore.describe()
+		if job.BytesRestored != m.info.BytesProcessed || job.TotalBytes != m.info.TotalBytes {
+			m.info.BytesProcessed = job.BytesRestored
+			m.info.TotalBytes = job.TotalBytes
+			m.info.Version++
+		}
+	}
+
+	now := time.Now()
+	if elapsed := now.Sub(m.windowStart); elapsed >= throughputWindow {
+		m.rate = float64(m.info.BytesProcessed-m.windowBytes) / elapsed.Seconds()
+		if m.rate < 0 {
+			m.rate = 0
+		}
+		m.windowStart = now
+		m.windowBytes = m.info.BytesProcessed
+	}
+
+	info := m.info
+	if info.FinishedAt != nil {
+		return info
+	}
+	info.ThroughputBytesPerSecond = m.rate
+	if info.TotalBytes > 0 {
+		progress := float64(info.BytesProcessed) / float64(info.TotalBytes) * 100
+		// Estimates can fall short, and tools have work left after the
+		// last byte
+		if progress > 99 {
+			progress = 99
+		}
+		info.Progress = &progress
+		if remaining := info.TotalBytes - info.BytesProcessed; remaining > 0 && m.rate > 0 {
+			eta := int64(float64(remaining) / m.rate)
+			info.ETASeconds = &eta
+		}
+	}
+	return info
+}
+
+// userProgress lists the runs and restores of the user's connections,
+// running or recently finished. Ownership is cached in owned across calls.
+func (s *BackupService) userProgress(userID uuid.UUID, owned map[string]bool) ([]OperationProgress, error) {
+	operations := []OperationProgress{}
+
+	var lookupErr error
+	s.progressMeters.Range(func(_, value interface{}) bool {
+		progress := value.(*progressMeter).snapshot()
+
+		isOwner, checked := owned[progress.ConnectionID]
+		if !checked {
+			conn, err := s.connStorage.GetConnection(progress.ConnectionID)
+			if err != nil {
+				lookupErr = fmt.Errorf("failed to get connection: %v", err)
+				return false
+			}
+			isOwner = s.connStorage.HasAccess(conn, userID)
+			owned[progress.ConnectionID] = isOwner
+		}
+
+		if isOwner {
+			operations = append(operations, progress)
+		}
+		return true
+	})
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].StartedAt.Before(operations[j].StartedAt)
+	})
+	return operations, nil
+}
+
+// GetProgress lists the progress of the runs and restores of the user's
+// connections
+func (s *BackupService) GetProgress(userID uuid.UUID) ([]OperationProgress, error) {
+	return s.userProgress(userID, make(map[string]bool))
+}
+
+func (h *BackupHandler) GetProgress(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	operations, err := h.backupService.GetProgress(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Progress retrieved successfully", operations)
+}
+
+// StreamProgress pushes the progress of the user's runs and restores as
+// server-sent events: a "progress" event whenever one changed, at most every
+// second, and an "end" event once one finished. ?id= follows a single run or
+// restore and ?connection_id= those of one connection.
+func (h *BackupHandler) StreamProgress(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query := r.URL.Query()
+	id := query.Get("id")
+	connectionID := query.Get("connection_id")
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	owned := make(map[string]bool)
+	sent := make(map[string]int64)
+	ended := make(map[string]bool)
+	lastWrite := time.Now()
+
+	ticker := time.NewTicker(progressStreamInterval)
+	defer ticker.Stop()
+
+	for {
+		operations, err := h.backupService.userProgress(userID, owned)
+		if err != nil {
+			slog.Warn("Failed to stream progress", "error", err)
+			return
+		}
+
+		wrote := false
+		for _, progress := range operations {
+			if (id != "" && progress.ID != id) || (connectionID != "" && progress.ConnectionID != connectionID) {
+				continue
+			}
+			if ended[progress.ID] || sent[progress.ID] == progress.Version {
+				continue
+			}
+			data, err := json.Marshal(progress)
+			if err != nil {
+				continue
+			}
+
+			event := "progress"
+			if progress.FinishedAt != nil {
+				event = "end"
+				ended[progress.ID] = true
+			}
+			fmt.Fprintf(w, "event: %s\nid: %s\ndata: %s\n\n", event, progress.ID, data)
+			sent[progress.ID] = progress.Version
+			wrote = true
+		}
+
+		if !wrote && time.Since(lastWrite) >= liveLogHeartbeat {
+			fmt.Fprint(w, ": keep-alive\n\n")
+			wrote = true
+		}
+		if wrote {
+			if err := controller.Flush(); err != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+
+		// A stream following one run or restore ends with it
+		if id != "" && ended[id] {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// stagePhase names the phase of a stage span, "backup.dump" being "dump"
+func stagePhase(stage string) string {
+	if i := strings.IndexByte(stage, '.'); i >= 0 {
+		return stage[i+1:]
+	}
+	return stage
+}
+
+// estimateDumpTotal reports the size of the database as the estimated total
+// of its dump
+func (run *BackupRun) estimateDumpTotal(dbName string) {
+	if size := run.databaseSize(dbName); size != nil {
+		run.processes.meter.setTotal(*size, true)
+	}
+}
@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/settings"
+)
+
+// pushMessage formats a notification with its metadata for ntfy and Gotify,
+// one "Label: value" line per field
+func pushMessage(n *notification.Notification, metadata map[string]interface{}) *notification.PushMessage {
+	var details []string
+	for _, field := range notificationFields {
+		value, ok := metadata[field.key]
+		if !ok || value == nil {
+			continue
+		}
+		text := fmt.Sprint(value)
+		if text == "" {
+			continue
+		}
+		details = append(details, field.label+": "+text)
+	}
+	return notification.NewPushMessage(n, details)
+}
+
+// sendNtfy publishes msg to the ntfy server of the settings; a non-empty
+// topic overrides the configured one
+func (s *BackupService) sendNtfy(userSettings *settings.UserSettings, topic string, msg *notification.PushMessage) error {
+	if topic == "" && userSettings.NtfyTopic != nil {
+		topic = *userSettings.NtfyTopic
+	}
+	if topic == "" {
+		return fmt.Errorf("no ntfy topic configured")
+	}
+
+	token := ""
+	if userSettings.NtfyToken != nil {
+		decrypted, err := s.cryptoService.Decrypt(*userSettings.NtfyToken)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt ntfy token: %v", err)
+		}
+		token = decrypted
+	}
+	serverURL := ""
+	if userSettings.NtfyServerURL != nil {
+		serverURL = *userSettings.NtfyServerURL
+	}
+	return notification.SendNtfy(serverURL, topic, token, msg)
+}
+
+// sendGotify posts msg to the Gotify server of the settings
+func (s *BackupService) sendGotify(userSettings *settings.UserSettings, msg *notification.PushMessage) error {
+	if userSettings.GotifyServerURL == nil || userSettings.GotifyToken == nil {
+		return fmt.Errorf("no Gotify server URL or application token configured")
+	}
+	token, err := s.cryptoService.Decrypt(*userSettings.GotifyToken)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt Gotify token: %v", err)
+	}
+	return notification.SendGotify(*userSettings.GotifyServerURL, token, msg)
+}
+
+// notifyPush sends n to the enabled push services without waiting for them
+func (s *BackupService) notifyPush(userSettings *settings.UserSettings, n *notification.Notification, metadata map[string]interface{}) {
+	if !userSettings.NotifyNtfy && !userSettings.NotifyGotify {
+		return
+	}
+
+	msg := pushMessage(n, metadata)
+	go func() {
+		if userSettings.NotifyNtfy {
+			if err := s.sendNtfy(userSettings, "", msg); err != nil {
+				slog.Warn("Failed to send notification to ntfy", "type", n.Type, "error", err)
+			}
+		}
+		if userSettings.NotifyGotify {
+			if err := s.sendGotify(userSettings, msg); err != nil {
+				slog.Warn("Failed to send notification to Gotify", "type", n.Type, "error", err)
+			}
+		}
+	}()
+}
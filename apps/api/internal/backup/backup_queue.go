@@ -0,0 +1,161 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Backup job priorities, configured per schedule
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+var priorityRanks = map[string]int{
+	PriorityHigh:   0,
+	PriorityNormal: 1,
+	PriorityLow:    2,
+}
+
+const defaultBackupWorkers = 4
+
+// backupWorkers reads BACKUP_WORKERS, how many backup runs execute at the
+// same time. Runs beyond that wait in the job queue; 0 runs every job
+// immediately.
+func backupWorkers() int {
+	workers := defaultBackupWorkers
+	if value := strings.TrimSpace(os.Getenv("BACKUP_WORKERS")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			slog.Warn("Invalid BACKUP_WORKERS, using the default", "value", value, "default", defaultBackupWorkers)
+		} else {
+			workers = parsed
+		}
+	}
+	return workers
+}
+
+// validatePriority normalizes the priority submitted with a schedule
+func validatePriority(priority *string) (string, error) {
+	if priority == nil {
+		return PriorityNormal, nil
+	}
+	value := strings.ToLower(strings.TrimSpace(*priority))
+	if value == "" {
+		return PriorityNormal, nil
+	}
+	if _, ok := priorityRanks[value]; !ok {
+		return "", fmt.Errorf("invalid priority %q, use high, normal or low", *priority)
+	}
+	return value, nil
+}
+
+func priorityFor(schedule *BackupSchedule) string {
+	if schedule == nil {
+		// Manual runs have someone waiting on them
+		return PriorityHigh
+	}
+	if _, ok := priorityRanks[schedule.Priority]; !ok {
+		return PriorityNormal
+	}
+	return schedule.Priority
+}
+
+type queuedJob struct {
+	runID string
+	rank  int
+	seq   uint64
+	ready chan struct{}
+}
+
+// jobQueue hands out worker slots to backup runs by priority, first come
+// first served within a priority
+type jobQueue struct {
+	mu      sync.Mutex
+	running int
+	seq     uint64
+	waiting []*queuedJob
+}
+
+// acquire blocks until the run may start. It reports whether the run had to
+// wait for a slot.
+func (q *jobQueue) acquire(runID, priority string) bool {
+	q.mu.Lock()
+	workers := backupWorkers()
+	if len(q.waiting) == 0 && (workers == 0 || q.running < workers) {
+		q.running++
+		q.mu.Unlock()
+		return false
+	}
+
+	q.seq++
+	job := &queuedJob{
+		runID: runID,
+		rank:  priorityRanks[priority],
+		seq:   q.seq,
+		ready: make(chan struct{}),
+	}
+	q.waiting = append(q.waiting, job)
+	sort.SliceStable(q.waiting, func(i, j int) bool {
+		if q.waiting[i].rank != q.waiting[j].rank {
+			return q.waiting[i].rank < q.waiting[j].rank
+		}
+		return q.waiting[i].seq < q.waiting[j].seq
+	})
+	q.mu.Unlock()
+
+	<-job.ready
+	return true
+}
+
+// release frees the slot of a finished run and starts the next waiting runs
+func (q *jobQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.running--
+	q.dispatch()
+}
+
+// dispatch starts waiting runs while there are free slots. Workers are read
+// on every call, so raising BACKUP_WORKERS drains the queue on the next
+// release.
+func (q *jobQueue) dispatch() {
+	workers := backupWorkers()
+	for len(q.waiting) > 0 && (workers == 0 || q.running < workers) {
+		job := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		q.running++
+		close(job.ready)
+	}
+}
+
+// position returns the 1-based place of a waiting run, or 0 when the run is
+// not waiting
+func (q *jobQueue) position(runID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, job := range q.waiting {
+		if job.runID == runID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// setQueuePosition fills in the queue position of a queued run
+func (s *BackupService) setQueuePosition(run *BackupRun) {
+	if run.Status != RunStatusQueued {
+		return
+	}
+	if position := s.jobQueue.position(run.ID.String()); position > 0 {
+		run.QueuePosition = &position
+	}
+}
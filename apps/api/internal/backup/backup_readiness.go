@@ -0,0 +1,165 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/robfig/cron/v3"
+)
+
+// schedulerHeartbeatInterval is how often the scheduler proves it still
+// runs its jobs
+const schedulerHeartbeatInterval = 15 * time.Second
+
+// storageCheckTimeout bounds the reachability check of one bucket
+const storageCheckTimeout = 5 * time.Second
+
+// StorageStatus is the outcome of checking the backup directory and every
+// S3 bucket backups are uploaded to
+type StorageStatus struct {
+	LocalWritable bool `json:"local_writable"`
+	Buckets       int  `json:"buckets"`
+	Unreachable   int  `json:"unreachable"`
+	// Problems describe what failed. Errors of buckets are logged rather
+	// than returned, as they name the bucket and its endpoint.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// NotificationStatus is the outcome of checking the notification channels
+// the owners of connections turned on
+type NotificationStatus struct {
+	Channels int `json:"channels"`
+	// Problems name the channels turned on without the settings they need,
+	// with how many users they affect
+	Problems []string `json:"problems,omitempty"`
+}
+
+// scheduleHeartbeat has the scheduler beat on its own, so a scheduler that
+// stopped running jobs shows in the health checks
+func (s *BackupService) scheduleHeartbeat() {
+	s.schedulerBeat.Store(time.Now().UnixNano())
+	s.cronManager.Schedule(cron.Every(schedulerHeartbeatInterval), cron.FuncJob(func() {
+		s.schedulerBeat.Store(time.Now().UnixNano())
+	}))
+}
+
+// SchedulerHeartbeat returns when the scheduler last ran its heartbeat job
+func (s *BackupService) SchedulerHeartbeat() time.Time {
+	return time.Unix(0, s.schedulerBeat.Load())
+}
+
+// SchedulerStale tells whether the scheduler missed its last heartbeats
+func (s *BackupService) SchedulerStale() bool {
+	return time.Since(s.SchedulerHeartbeat()) > 3*schedulerHeartbeatInterval
+}
+
+// CheckStorage checks that the backup directory takes writes and that the
+// S3 bucket of every owner of connections is reachable
+func (s *BackupService) CheckStorage(ctx context.Context) (*StorageStatus, error) {
+	status := &StorageStatus{}
+
+	probe, err := os.CreateTemp(s.backupDir, ".velld-readyz-*")
+	if err != nil {
+		status.Problems = append(status.Problems, fmt.Sprintf("backup directory is not writable: %v", err))
+	} else {
+		probe.Close()
+		os.Remove(probe.Name())
+		status.LocalWritable = true
+	}
+
+	users, err := s.backupRepo.GetConnectionOwners()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owners of connections: %v", err)
+	}
+	for _, userID := range users {
+		storage, err := s.s3StorageForUser(userID)
+		if err != nil {
+			status.Buckets++
+			status.Unreachable++
+			status.Problems = append(status.Problems, err.Error())
+			continue
+		}
+		if storage == nil {
+			continue
+		}
+
+		status.Buckets++
+		checkCtx, cancel := context.WithTimeout(ctx, storageCheckTimeout)
+		err = storage.TestConnection(checkCtx)
+		cancel()
+		if err != nil {
+			slog.Warn("S3 bucket is unreachable", "user_id", userID, "error", err)
+			status.Unreachable++
+			status.Problems = append(status.Problems, "S3 bucket is unreachable")
+		}
+	}
+	return status, nil
+}
+
+// notificationProblems lists the channels a user turned on without the
+// settings they need to deliver
+func notificationProblems(userSettings *settings.UserSettings) (enabled int, problems []string) {
+	set := func(value *string) bool {
+		return value != nil && strings.TrimSpace(*value) != ""
+	}
+	check := func(on bool, channel string, configured bool) {
+		if !on {
+			return
+		}
+		enabled++
+		if !configured {
+			problems = append(problems, channel)
+		}
+	}
+
+	check(userSettings.NotifyEmail, "email",
+		set(userSettings.SMTPHost) && userSettings.SMTPPort != nil && set(userSettings.SMTPUsername) &&
+			set(userSettings.SMTPPassword) && len(userSettings.AlertRecipients()) > 0)
+	check(userSettings.NotifyWebhook, "webhook", set(userSettings.WebhookURL))
+	check(userSettings.NotifyDiscord, "discord", set(userSettings.DiscordWebhookURL))
+	check(userSettings.NotifyPagerDuty, "pagerduty", set(userSettings.PagerDutyRoutingKey))
+	check(userSettings.NotifyOpsgenie, "opsgenie", set(userSettings.OpsgenieAPIKey))
+	check(userSettings.NotifyNtfy, "ntfy", set(userSettings.NtfyTopic))
+	check(userSettings.NotifyGotify, "gotify", set(userSettings.GotifyServerURL) && set(userSettings.GotifyToken))
+	check(userSettings.NotifyMatrix, "matrix",
+		set(userSettings.MatrixHomeserverURL) && set(userSettings.MatrixAccessToken) && set(userSettings.MatrixRoomID))
+	return enabled, problems
+}
+
+// CheckNotifications checks that the notification channels turned on by the
+// owners of connections have the settings they need
+func (s *BackupService) CheckNotifications() (*NotificationStatus, error) {
+	users, err := s.backupRepo.GetConnectionOwners()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owners of connections: %v", err)
+	}
+
+	status := &NotificationStatus{}
+	incomplete := make(map[string]int)
+	var order []string
+	for _, userID := range users {
+		userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user settings: %v", err)
+		}
+		enabled, problems := notificationProblems(userSettings)
+		status.Channels += enabled
+		for _, channel := range problems {
+			if incomplete[channel] == 0 {
+				order = append(order, channel)
+			}
+			incomplete[channel]++
+		}
+	}
+
+	for _, channel := range order {
+		status.Problems = append(status.Problems,
+			fmt.Sprintf("%s is turned on without its settings for %d user(s)", channel, incomplete[channel]))
+	}
+	return status, nil
+}
@@ -0,0 +1,551 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Storage finding kinds
+const (
+	// FindingOrphanFile is a stored file no backup record points to
+	FindingOrphanFile = "orphan_file"
+	// FindingGhostRecord is a completed backup whose artifact is stored
+	// nowhere
+	FindingGhostRecord = "ghost_record"
+)
+
+// Storage backends a finding is in
+const (
+	StorageBackendLocal = "local"
+	StorageBackendS3    = "s3"
+)
+
+// Actions resolving a finding
+const (
+	// FindingActionDelete deletes an orphan file
+	FindingActionDelete = "delete"
+	// FindingActionAdopt registers an orphan file as a backup of the
+	// connection whose folder it is in
+	FindingActionAdopt = "adopt"
+	// FindingActionRemoveRecord deletes a ghost record
+	FindingActionRemoveRecord = "remove_record"
+	// FindingActionDismiss leaves the finding as it is; its location is not
+	// flagged again
+	FindingActionDismiss = "dismiss"
+)
+
+// defaultReconcileSchedule compares storage with the backup records every
+// day at 04:30
+const defaultReconcileSchedule = "0 30 4 * * *"
+
+// orphanGracePeriod leaves younger files alone, as they may belong to a
+// backup that is still being written or uploaded
+const orphanGracePeriod = time.Hour
+
+// StorageFinding is a mismatch between the backup records and what is
+// actually stored
+type StorageFinding struct {
+	ID           uuid.UUID `json:"id"`
+	UserID       uuid.UUID `json:"-"`
+	ConnectionID *string   `json:"connection_id"`
+	Kind         string    `json:"kind"`
+	Backend      string    `json:"backend"`
+	// Location is the file path or S3 object key
+	Location string  `json:"location"`
+	BackupID *string `json:"backup_id"`
+	Size     int64   `json:"size"`
+	// ModifiedAt is when an orphan file was last written, or when a ghost
+	// record's backup was created
+	ModifiedAt *time.Time `json:"modified_at"`
+	DetectedAt time.Time  `json:"detected_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	Resolution *string    `json:"resolution"`
+}
+
+// ResolveFindingRequest picks the action that resolves a finding
+type ResolveFindingRequest struct {
+	Action string `json:"action"`
+}
+
+// StorageFindingError is an action that cannot resolve a finding
+type StorageFindingError struct {
+	Reason string
+}
+
+func (e *StorageFindingError) Error() string {
+	return e.Reason
+}
+
+func (s *BackupService) scheduleStorageReconciliation() {
+	schedule := strings.TrimSpace(os.Getenv("BACKUP_RECONCILE_SCHEDULE"))
+	if strings.EqualFold(schedule, "off") {
+		return
+	}
+	if schedule == "" {
+		schedule = defaultReconcileSchedule
+	}
+
+	if _, err := s.cronManager.AddFunc(schedule, s.reconcileAllStorage); err != nil {
+		slog.Error("Failed to schedule storage reconciliation", "error", err)
+	}
+}
+
+// reconcileAllStorage reconciles the storage of every user with connections
+func (s *BackupService) reconcileAllStorage() {
+	users, err := s.backupRepo.GetConnectionOwners()
+	if err != nil {
+		slog.Error("Failed to get users for storage reconciliation", "error", err)
+		return
+	}
+
+	for _, userID := range users {
+		findings, err := s.ReconcileStorage(userID)
+		if err != nil {
+			slog.Error("Failed to reconcile storage of user", "user_id", userID, "error", err)
+			continue
+		}
+		if len(findings) > 0 {
+			slog.Info("Storage reconciliation found mismatches", "user_id", userID, "mismatches", len(findings))
+		}
+	}
+}
+
+// storedLocations are the artifact paths and object keys backup records
+// point to
+type storedLocations struct {
+	paths map[string]bool
+	keys  map[string]bool
+}
+
+func (s *BackupService) storedLocations() (*storedLocations, error) {
+	artifacts, err := s.backupRepo.GetStoredArtifacts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup artifacts: %v", err)
+	}
+
+	known := &storedLocations{paths: make(map[string]bool), keys: make(map[string]bool)}
+	for _, backup := range artifacts {
+		known.paths[filepath.Clean(backup.Path)] = true
+		if backup.S3ObjectKey != nil {
+			known.keys[*backup.S3ObjectKey] = true
+		}
+		for _, file := range backup.PostProcessedFiles {
+			known.paths[filepath.Clean(file.Path)] = true
+			if file.ObjectKey != nil {
+				known.keys[*file.ObjectKey] = true
+			}
+		}
+	}
+	return known, nil
+}
+
+// referenced reports whether a backup record points to the finding's file
+func (known *storedLocations) referenced(f *StorageFinding) bool {
+	if f.Backend == StorageBackendS3 {
+		return known.keys[f.Location]
+	}
+	return known.paths[filepath.Clean(f.Location)] ||
+		(strings.HasSuffix(f.Location, manifestSuffix) && known.paths[strings.TrimSuffix(f.Location, manifestSuffix)])
+}
+
+// ReconcileStorage compares the user's backup records with the files in the
+// backup folders of their connections and in their S3 bucket. Files no
+// record points to are flagged as orphans and completed backups stored
+// nowhere as ghost records. The findings replace the user's open ones.
+func (s *BackupService) ReconcileStorage(userID uuid.UUID) ([]*StorageFinding, error) {
+	// Connections shared with the user are stored in their owner's folders
+	// and bucket, so they are reconciled for their owner
+	conns, err := s.connStorage.ListOwnedByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connections: %v", err)
+	}
+	known, err := s.storedLocations()
+	if err != nil {
+		return nil, err
+	}
+
+	// Dismissed locations are not flagged again
+	previous, err := s.backupRepo.GetStorageFindings(userID, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage findings: %v", err)
+	}
+	dismissed := make(map[string]bool)
+	for _, f := range previous {
+		if f.Resolution != nil && *f.Resolution == FindingActionDismiss {
+			dismissed[f.Backend+":"+f.Location] = true
+		}
+	}
+
+	now := time.Now()
+	findings := []*StorageFinding{}
+	add := func(f *StorageFinding) {
+		if dismissed[f.Backend+":"+f.Location] {
+			return
+		}
+		f.ID = uuid.New()
+		f.UserID = userID
+		f.DetectedAt = now
+		findings = append(findings, f)
+	}
+
+	// Backups are stored in a folder per connection name, locally and in S3
+	folders := make(map[string]string)
+	for _, conn := range conns {
+		folder := common.SanitizeConnectionName(conn.Name)
+		if _, taken := folders[folder]; !taken {
+			folders[folder] = conn.ID
+		}
+	}
+
+	for folder, connectionID := range folders {
+		connectionID := connectionID
+		err := filepath.WalkDir(filepath.Join(s.backupDir, folder), func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			f := &StorageFinding{ConnectionID: &connectionID, Kind: FindingOrphanFile, Backend: StorageBackendLocal, Location: p}
+			if known.referenced(f) {
+				// Parallel dumps are directories of files
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil || now.Sub(info.ModTime()) < orphanGracePeriod {
+				return nil
+			}
+			modifiedAt := info.ModTime()
+			f.Size = info.Size()
+			f.ModifiedAt = &modifiedAt
+			add(f)
+			return nil
+		})
+		if err != nil {
+			slog.Warn("Failed to scan backup folder", "path", folder, "error", err)
+		}
+	}
+
+	// stored is nil when the bucket could not be listed, so S3 copies are
+	// not known to be missing
+	var stored map[string]bool
+	storage, err := s.s3StorageForUser(userID)
+	if err != nil {
+		slog.Warn("Failed to open S3 storage of user for reconciliation", "user_id", userID, "error", err)
+	} else if storage != nil {
+		objects, err := storage.ListObjects(context.Background())
+		if err != nil {
+			slog.Warn("Failed to list S3 objects of user", "user_id", userID, "error", err)
+		} else {
+			stored = make(map[string]bool)
+			for _, object := range objects {
+				stored[object.Key] = true
+				f := &StorageFinding{Kind: FindingOrphanFile, Backend: StorageBackendS3, Location: object.Key, Size: object.Size}
+				if known.referenced(f) || now.Sub(object.LastModified) < orphanGracePeriod {
+					continue
+				}
+				if connectionID, ok := folders[path.Base(path.Dir(object.Key))]; ok {
+					f.ConnectionID = &connectionID
+				}
+				modifiedAt := object.LastModified
+				f.ModifiedAt = &modifiedAt
+				add(f)
+			}
+		}
+	}
+
+	for _, conn := range conns {
+		backups, err := s.backupRepo.GetBackupsByConnectionID(conn.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get backups of connection %s: %v", conn.ID, err)
+		}
+		for _, backup := range backups {
+			if backup.Status != "completed" {
+				continue
+			}
+			if _, err := os.Stat(backup.Path); err == nil {
+				continue
+			}
+			if backup.S3ObjectKey != nil && (stored == nil || stored[*backup.S3ObjectKey]) {
+				continue
+			}
+			// Deduplicated artifacts live in the chunk store
+			if chunks, err := s.backupRepo.GetBackupChunks(backup.ID.String()); err != nil || len(chunks) > 0 {
+				continue
+			}
+
+			backupID := backup.ID.String()
+			createdAt := backup.CreatedAt
+			f := &StorageFinding{
+				ConnectionID: &backup.ConnectionID,
+				Kind:         FindingGhostRecord,
+				Backend:      StorageBackendLocal,
+				Location:     backup.Path,
+				BackupID:     &backupID,
+				Size:         backup.Size,
+				ModifiedAt:   &createdAt,
+			}
+			if backup.S3ObjectKey != nil {
+				f.Backend = StorageBackendS3
+				f.Location = *backup.S3ObjectKey
+			}
+			add(f)
+		}
+	}
+
+	if err := s.backupRepo.ReplaceStorageFindings(userID, findings); err != nil {
+		return nil, fmt.Errorf("failed to save storage findings: %v", err)
+	}
+	return findings, nil
+}
+
+// GetStorageFindings lists the user's open findings, or all of them
+func (s *BackupService) GetStorageFindings(userID uuid.UUID, includeResolved bool) ([]*StorageFinding, error) {
+	return s.backupRepo.GetStorageFindings(userID, includeResolved)
+}
+
+// ResolveStorageFinding applies an action to one of the user's open findings
+func (s *BackupService) ResolveStorageFinding(id string, userID uuid.UUID, req *ResolveFindingRequest) (*StorageFinding, error) {
+	f, err := s.backupRepo.GetStorageFinding(id)
+	if err != nil {
+		return nil, err
+	}
+	if f.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	if f.ResolvedAt != nil {
+		return nil, &StorageFindingError{Reason: "the finding is already resolved"}
+	}
+
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	switch {
+	case action == FindingActionDismiss:
+	case f.Kind == FindingOrphanFile && action == FindingActionDelete:
+		err = s.deleteOrphanFile(f, userID)
+	case f.Kind == FindingOrphanFile && action == FindingActionAdopt:
+		err = s.adoptOrphanFile(f)
+	case f.Kind == FindingGhostRecord && action == FindingActionRemoveRecord:
+		err = s.removeGhostRecord(f)
+	default:
+		return nil, &StorageFindingError{Reason: fmt.Sprintf("action %q does not apply to %s findings", req.Action, f.Kind)}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	f.ResolvedAt = &now
+	f.Resolution = &action
+	if err := s.backupRepo.ResolveStorageFinding(f); err != nil {
+		return nil, fmt.Errorf("failed to save storage finding: %v", err)
+	}
+	return f, nil
+}
+
+// unreferencedOrphan checks that no backup record points to an orphan file
+// since it was found
+func (s *BackupService) unreferencedOrphan(f *StorageFinding) error {
+	known, err := s.storedLocations()
+	if err != nil {
+		return err
+	}
+	if known.referenced(f) {
+		return &StorageFindingError{Reason: "a backup record points to the file now; reconcile again"}
+	}
+	return nil
+}
+
+func (s *BackupService) deleteOrphanFile(f *StorageFinding, userID uuid.UUID) error {
+	if err := s.unreferencedOrphan(f); err != nil {
+		return err
+	}
+
+	if f.Backend == StorageBackendS3 {
+		storage, err := s.s3StorageForUser(userID)
+		if err != nil {
+			return err
+		}
+		if storage == nil {
+			return &StorageFindingError{Reason: "S3 storage is not enabled"}
+		}
+		if err := storage.DeleteFile(context.Background(), f.Location); err != nil {
+			return err
+		}
+		slog.Info("Deleted orphan S3 object", "object_key", f.Location)
+		return nil
+	}
+
+	// Only files in the backup directory are deleted
+	rel, err := filepath.Rel(s.backupDir, f.Location)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return &StorageFindingError{Reason: "the file is outside the backup directory"}
+	}
+	if err := os.Remove(f.Location); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete orphan file: %v", err)
+	}
+	slog.Info("Deleted orphan file", "path", f.Location)
+	return nil
+}
+
+// adoptOrphanFile registers an orphan file as a completed backup of its
+// connection, so it is listed, restorable and subject to retention
+func (s *BackupService) adoptOrphanFile(f *StorageFinding) error {
+	if f.ConnectionID == nil {
+		return &StorageFindingError{Reason: "the file is not in a connection's folder, so it cannot be adopted"}
+	}
+	if strings.HasSuffix(f.Location, manifestSuffix) {
+		return &StorageFindingError{Reason: "checksum manifests cannot be adopted"}
+	}
+	if err := s.unreferencedOrphan(f); err != nil {
+		return err
+	}
+	conn, err := s.connStorage.GetConnection(*f.ConnectionID)
+	if err != nil {
+		return err
+	}
+
+	createdAt := time.Now()
+	if f.ModifiedAt != nil {
+		createdAt = *f.ModifiedAt
+	}
+	databaseName := conn.DatabaseName
+	backup := &Backup{
+		ID:            uuid.New(),
+		ConnectionID:  conn.ID,
+		DatabaseName:  &databaseName,
+		Status:        "completed",
+		Path:          f.Location,
+		Size:          f.Size,
+		StartedTime:   createdAt,
+		CompletedTime: &createdAt,
+		CreatedAt:     createdAt,
+		UpdatedAt:     time.Now(),
+	}
+	if f.Backend == StorageBackendS3 {
+		// There is no local copy; the artifact is fetched from S3 when needed
+		key := f.Location
+		backup.S3ObjectKey = &key
+		backup.Path = filepath.Join(s.backupDir, path.Base(path.Dir(key)), path.Base(key))
+	} else if err := s.recordBackupChecksum(backup); err != nil {
+		slog.Warn("Failed to checksum adopted backup", "path", f.Location, "error", err)
+	}
+
+	if err := s.backupRepo.CreateBackup(backup); err != nil {
+		return fmt.Errorf("failed to save backup: %v", err)
+	}
+	backupID := backup.ID.String()
+	f.BackupID = &backupID
+	slog.Info("Adopted orphan file as backup", "path", f.Location, "backup_id", backup.ID)
+	return nil
+}
+
+func (s *BackupService) removeGhostRecord(f *StorageFinding) error {
+	backup, err := s.backupRepo.GetBackup(*f.BackupID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(backup.Path); err == nil {
+		return &StorageFindingError{Reason: "the backup's file exists again; reconcile again"}
+	}
+
+	if err := s.backupRepo.DeleteBackup(backup.ID.String()); err != nil {
+		return fmt.Errorf("failed to delete backup record: %v", err)
+	}
+	if err := s.backupRepo.RecordBackupDeletion(backup, DeletionReasonMissingArtifact); err != nil {
+		slog.Warn("Failed to record deletion of backup", "backup_id", backup.ID, "error", err)
+	}
+	slog.Info("Removed ghost record of backup", "backup_id", backup.ID)
+	return nil
+}
+
+func sendStorageFindingError(w http.ResponseWriter, err error) {
+	var invalid *StorageFindingError
+	switch {
+	case errors.As(err, &invalid):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Storage finding not found")
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *BackupHandler) GetStorageFindings(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	findings, err := h.backupService.GetStorageFindings(userID, r.URL.Query().Get("include_resolved") == "true")
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Storage findings retrieved successfully", findings)
+}
+
+func (h *BackupHandler) ReconcileStorage(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	findings, err := h.backupService.ReconcileStorage(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Storage reconciled successfully", findings)
+}
+
+func (h *BackupHandler) ResolveStorageFinding(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req ResolveFindingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	finding, err := h.backupService.ResolveStorageFinding(mux.Vars(r)["id"], userID, &req)
+	if err != nil {
+		sendStorageFindingError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Storage finding resolved successfully", finding)
+}
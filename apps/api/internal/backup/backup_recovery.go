@@ -0,0 +1,213 @@
+package backup
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/google/uuid"
+)
+
+// RunStatusInterrupted marks runs a crash or restart left queued or running,
+// as distinct from runs that failed on their own
+const RunStatusInterrupted = "interrupted"
+
+// rerunInterruptedEnabled reads BACKUP_RERUN_INTERRUPTED. Runs interrupted
+// before their dump completed are run again unless it is "off".
+func rerunInterruptedEnabled() bool {
+	return !strings.EqualFold(strings.TrimSpace(os.Getenv("BACKUP_RERUN_INTERRUPTED")), "off")
+}
+
+// rerunInterruptedFor reports whether an interrupted run of the schedule runs
+// again, which the schedule can decide over BACKUP_RERUN_INTERRUPTED
+func rerunInterruptedFor(schedule *BackupSchedule) bool {
+	if schedule != nil && schedule.RerunInterrupted != nil {
+		return *schedule.RerunInterrupted
+	}
+	return rerunInterruptedEnabled()
+}
+
+// recoverInterruptedRuns closes the runs a crash or restart left queued or
+// running as interrupted, and removes the partial artifacts and temp files
+// they left behind. Pending uploads of runs that saved backups are resumed
+// from the upload journal. Runs that saved nothing are returned so they can
+// run again.
+func (s *BackupService) recoverInterruptedRuns() []*BackupRun {
+	runs, err := s.backupRepo.GetUnfinishedBackupRuns()
+	if err != nil {
+		slog.Warn("Failed to get interrupted backup runs", "error", err)
+		return nil
+	}
+
+	var rerun []*BackupRun
+	var earliestStart time.Time
+	for _, run := range runs {
+		if earliestStart.IsZero() || run.StartedTime.Before(earliestStart) {
+			earliestStart = run.StartedTime
+		}
+		s.removeInterruptedArtifacts(run)
+
+		backups, err := s.backupRepo.GetBackupsByRunID(run.ID.String())
+		if err != nil {
+			slog.Warn("Failed to get backups of interrupted run", "run_id", run.ID, "error", err)
+			continue
+		}
+
+		var message string
+		if len(backups) > 0 {
+			for _, backup := range backups {
+				run.recordJob(RunJobDump, filepath.Base(backup.Path), backup, nil)
+				if run.ScheduleID != nil {
+					if err := s.backupRepo.UpdateBackupStatusAndSchedule(backup.ID.String(), "completed", *run.ScheduleID); err != nil {
+						slog.Error("Failed to update backup status and schedule", "backup_id", backup.ID, "error", err)
+					}
+				}
+			}
+			message = "interrupted by restart, pending uploads resume from their journal"
+		} else {
+			message = "interrupted by restart before the dump completed"
+			rerun = append(rerun, run)
+		}
+		run.Status = RunStatusInterrupted
+
+		now := time.Now()
+		run.TotalJobs = len(run.Jobs)
+		run.SucceededJobs = len(run.Jobs)
+		run.FailedJobs = 0
+		run.Error = &message
+		run.CompletedTime = &now
+
+		if err := s.backupRepo.FinishBackupRun(run); err != nil {
+			slog.Warn("Failed to record outcome of backup run", "run_id", run.ID, "error", err)
+			continue
+		}
+		slog.Info("Closed backup run interrupted by restart", "run_id", run.ID)
+	}
+
+	if !earliestStart.IsZero() {
+		removeInterruptedTempFiles(earliestStart)
+	}
+
+	return rerun
+}
+
+// removeInterruptedArtifacts deletes what an interrupted run wrote to its
+// connection's backup folder without saving it as a backup: partial dumps,
+// unpacked directories and side files of the dump that was cut off. Files
+// of saved backups are kept.
+func (s *BackupService) removeInterruptedArtifacts(run *BackupRun) {
+	conn, err := s.connStorage.GetConnection(run.ConnectionID)
+	if err != nil {
+		slog.Warn("Failed to get connection of interrupted run", "run_id", run.ID, "error", err)
+		return
+	}
+
+	backups, err := s.backupRepo.GetBackupsByConnectionID(run.ConnectionID)
+	if err != nil {
+		slog.Warn("Failed to get backups of connection", "connection_id", run.ConnectionID, "error", err)
+		return
+	}
+	saved := make(map[string]bool)
+	for _, backup := range backups {
+		saved[backup.Path] = true
+		saved[backup.Path+manifestSuffix] = true
+		saved[backup.Path+manifestFileSuffix] = true
+		for _, file := range backup.PostProcessedFiles {
+			saved[file.Path] = true
+		}
+	}
+
+	connectionFolder := filepath.Join(s.backupDir, common.SanitizeConnectionName(conn.Name))
+	entries, err := os.ReadDir(connectionFolder)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		path := filepath.Join(connectionFolder, entry.Name())
+		info, err := entry.Info()
+		if err != nil || saved[path] || info.ModTime().Before(run.StartedTime) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			slog.Warn("Failed to remove partial artifact", "path", path, "error", err)
+			continue
+		}
+		slog.Info("Removed partial artifact of interrupted run", "path", path, "run_id", run.ID)
+	}
+}
+
+// removeInterruptedTempFiles deletes the files velld's temp directories got
+// since the interrupted runs started. Nothing runs yet at startup, so they
+// were left by the process that went down.
+func removeInterruptedTempFiles(since time.Time) {
+	dirs, err := filepath.Glob(filepath.Join(os.TempDir(), "velld-*"))
+	if err != nil {
+		return
+	}
+	for _, dir := range dirs {
+		paths := []string{dir}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			paths = paths[:0]
+			for _, entry := range entries {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Before(since) {
+				continue
+			}
+			if err := os.RemoveAll(path); err != nil {
+				slog.Warn("Failed to remove temp file", "path", path, "error", err)
+			}
+		}
+	}
+}
+
+// rerunInterruptedRuns starts the manual runs again and adds scheduled runs
+// to the missed schedules, so they go through the catch-up queue. Schedules
+// decide whether their runs run again; manual runs follow
+// BACKUP_RERUN_INTERRUPTED.
+func (s *BackupService) rerunInterruptedRuns(runs []*BackupRun, missed []*BackupSchedule) []*BackupSchedule {
+	queued := make(map[uuid.UUID]bool)
+	for _, schedule := range missed {
+		queued[schedule.ID] = true
+	}
+
+	for _, run := range runs {
+		if run.ScheduleID == nil {
+			if !rerunInterruptedEnabled() {
+				continue
+			}
+			slog.Info("Re-running interrupted manual backup run", "run_id", run.ID)
+			go func(connectionID string) {
+				if _, _, err := s.runBackup(context.Background(), connectionID, nil); err != nil {
+					slog.Error("Failed to re-run interrupted backup of connection", "connection_id", connectionID, "error", err)
+				}
+			}(run.ConnectionID)
+			continue
+		}
+
+		schedule, err := s.backupRepo.GetBackupSchedule(run.ConnectionID)
+		if err != nil || !schedule.Enabled || schedule.ID.String() != *run.ScheduleID || queued[schedule.ID] || !rerunInterruptedFor(schedule) {
+			continue
+		}
+
+		// The catch-up queue orders by the run that was missed
+		startedTime := run.StartedTime
+		schedule.NextRunTime = &startedTime
+		missed = append(missed, schedule)
+		queued[schedule.ID] = true
+	}
+
+	return missed
+}
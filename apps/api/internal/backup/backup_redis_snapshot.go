@@ -0,0 +1,260 @@
+package backup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+const (
+	defaultRedisBGSaveTimeoutMinutes = 30
+	redisBGSavePollInterval          = time.Second
+)
+
+// redisBGSaveTimeout reads REDIS_BGSAVE_TIMEOUT_MINUTES, how long a snapshot
+// backup waits for BGSAVE to finish.
+func redisBGSaveTimeout() time.Duration {
+	minutes := defaultRedisBGSaveTimeoutMinutes
+	if value := strings.TrimSpace(os.Getenv("REDIS_BGSAVE_TIMEOUT_MINUTES")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			slog.Warn("Invalid REDIS_BGSAVE_TIMEOUT_MINUTES, using the default", "value", value, "default_minutes", defaultRedisBGSaveTimeoutMinutes)
+		} else {
+			minutes = parsed
+		}
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// validateRedisSnapshot checks the snapshot toggle submitted with a schedule
+// request. A snapshot holds every Redis database, so it cannot be combined
+// with selected databases.
+func (s *BackupService) validateRedisSnapshot(connectionID string, enabled *bool) error {
+	if enabled == nil || !*enabled {
+		return nil
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	if conn.Type != "redis" {
+		return fmt.Errorf("snapshot backups are only supported for redis connections")
+	}
+	if len(conn.SelectedDatabases) > 0 {
+		return fmt.Errorf("snapshot backups include every database and cannot be combined with selected databases")
+	}
+
+	return nil
+}
+
+func redisSnapshotFor(schedule *BackupSchedule) bool {
+	return schedule != nil && schedule.RedisSnapshot
+}
+
+// createRedisSnapshot triggers BGSAVE, waits for rdb_last_save_time to
+// advance and retrieves the new RDB file: over SSH when the connection uses a
+// tunnel, from the local filesystem when the file is reachable, and through
+// redis-cli --rdb otherwise. On Windows the local file can be read from a
+// Volume Shadow Copy.
+func (s *BackupService) createRedisSnapshot(conn *connection.StoredConnection, tunnel *connection.SSHTunnel, outputPath string, schedule *BackupSchedule) (*RunEnvironment, error) {
+	binaryPath := s.findDatabaseBinaryPath("redis")
+	if binaryPath == "" {
+		return nil, fmt.Errorf("backup tool not found for redis. Please ensure %s is installed and available in PATH", requiredTools["redis"])
+	}
+	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(requiredTools["redis"]))
+
+	persistence, err := redisPersistenceInfo(binPath, conn)
+	if err != nil {
+		return nil, err
+	}
+	lastSave := persistence["rdb_last_save_time"]
+
+	output, err := redisCommand(binPath, conn, "BGSAVE")
+	if err != nil && !strings.Contains(output, "already in progress") {
+		return nil, fmt.Errorf("BGSAVE failed: %v", err)
+	}
+
+	if err := waitForRedisSave(binPath, conn, lastSave); err != nil {
+		return nil, err
+	}
+
+	rdbPath, err := redisRDBPath(binPath, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	method, err := fetchRedisRDB(binPath, conn, tunnel, rdbPath, outputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	environment := captureRunEnvironment(nil, schedule, false)
+	environment.DumpTool = requiredTools["redis"]
+	environment.DumpToolPath = binPath
+	environment.DumpToolVersion = dumpToolVersion(binPath)
+	environment.DumpArgs = []string{"BGSAVE", "fetch=" + method, rdbPath}
+	return environment, nil
+}
+
+// redisCommand runs a single command with redis-cli and returns its output
+func redisCommand(binPath string, conn *connection.StoredConnection, args ...string) (string, error) {
+	cliArgs := []string{
+		"-h", conn.Host,
+		"-p", fmt.Sprintf("%d", conn.Port),
+	}
+	if conn.Password != "" {
+		cliArgs = append(cliArgs, "-a", conn.Password, "--no-auth-warning")
+	}
+	cliArgs = append(cliArgs, args...)
+
+	output, err := exec.Command(binPath, cliArgs...).CombinedOutput()
+	result := strings.TrimSpace(string(output))
+	if err == nil && strings.HasPrefix(result, "ERR") {
+		err = fmt.Errorf("%s", result)
+	} else if err != nil && result != "" {
+		err = fmt.Errorf("%v: %s", err, result)
+	}
+	return result, err
+}
+
+// redisPersistenceInfo parses the "key:value" lines of INFO persistence
+func redisPersistenceInfo(binPath string, conn *connection.StoredConnection) (map[string]string, error) {
+	output, err := redisCommand(binPath, conn, "INFO", "persistence")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read persistence info: %v", err)
+	}
+
+	info := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if ok {
+			info[key] = value
+		}
+	}
+
+	if _, ok := info["rdb_last_save_time"]; !ok {
+		return nil, fmt.Errorf("persistence info has no rdb_last_save_time")
+	}
+	return info, nil
+}
+
+// waitForRedisSave polls until a background save newer than lastSave has
+// finished successfully.
+func waitForRedisSave(binPath string, conn *connection.StoredConnection, lastSave string) error {
+	deadline := time.Now().Add(redisBGSaveTimeout())
+	for time.Now().Before(deadline) {
+		time.Sleep(redisBGSavePollInterval)
+
+		info, err := redisPersistenceInfo(binPath, conn)
+		if err != nil {
+			return err
+		}
+		if info["rdb_bgsave_in_progress"] == "1" || info["rdb_last_save_time"] == lastSave {
+			continue
+		}
+		if status := info["rdb_last_bgsave_status"]; status != "" && status != "ok" {
+			return fmt.Errorf("BGSAVE finished with status %s", status)
+		}
+		return nil
+	}
+	return fmt.Errorf("BGSAVE did not finish within %s", redisBGSaveTimeout())
+}
+
+// redisRDBPath asks the server where it writes its RDB file
+func redisRDBPath(binPath string, conn *connection.StoredConnection) (string, error) {
+	dir, err := redisConfigValue(binPath, conn, "dir")
+	if err != nil {
+		return "", err
+	}
+	dbFilename, err := redisConfigValue(binPath, conn, "dbfilename")
+	if err != nil {
+		return "", err
+	}
+	// The path is on the Redis host, which is not necessarily a Windows host
+	return strings.TrimSuffix(dir, "/") + "/" + dbFilename, nil
+}
+
+func redisConfigValue(binPath string, conn *connection.StoredConnection, key string) (string, error) {
+	output, err := redisCommand(binPath, conn, "CONFIG", "GET", key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from the server config: %v", key, err)
+	}
+
+	// redis-cli prints the key and its value on separate lines
+	lines := strings.Split(output, "\n")
+	if len(lines) < 2 || strings.TrimSpace(lines[1]) == "" {
+		return "", fmt.Errorf("server config has no %s", key)
+	}
+	return strings.TrimSpace(lines[1]), nil
+}
+
+// fetchRedisRDB copies the RDB file to outputPath and returns how it did so
+func fetchRedisRDB(binPath string, conn *connection.StoredConnection, tunnel *connection.SSHTunnel, rdbPath, outputPath string) (string, error) {
+	if tunnel != nil {
+		if err := fetchRedisRDBOverSSH(tunnel, rdbPath, outputPath); err != nil {
+			return "", fmt.Errorf("failed to fetch %s over SSH: %v", rdbPath, err)
+		}
+		return "ssh", nil
+	}
+
+	if _, err := os.Stat(rdbPath); err == nil {
+		method, err := copyLocalFile(rdbPath, outputPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to copy %s: %v", rdbPath, err)
+		}
+		return method, nil
+	}
+
+	if _, err := redisCommand(binPath, conn, "--rdb", outputPath); err != nil {
+		return "", fmt.Errorf("failed to fetch RDB with --rdb: %v", err)
+	}
+	return "rdb", nil
+}
+
+func fetchRedisRDBOverSSH(tunnel *connection.SSHTunnel, rdbPath, outputPath string) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	quoted := "'" + strings.ReplaceAll(rdbPath, "'", `'\''`) + "'"
+	if err := tunnel.RunCommand("cat -- "+quoted, file); err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+	return file.Sync()
+}
+
+func copyFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(dstPath)
+		return err
+	}
+	return dst.Sync()
+}
@@ -2,11 +2,14 @@ package backup
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
 	"github.com/google/uuid"
 )
 
@@ -33,15 +36,31 @@ func (r *BackupRepository) CreateBackupSchedule(schedule *BackupSchedule) error
 		lastBackupStr = &str
 	}
 
+	var pausedAtStr *string
+	if schedule.PausedAt != nil {
+		str := schedule.PausedAt.Format(time.RFC3339)
+		pausedAtStr = &str
+	}
+
+	var runAtStr *string
+	if schedule.RunAt != nil {
+		str := schedule.RunAt.Format(time.RFC3339)
+		runAtStr = &str
+	}
+
 	now := time.Now().Format(time.RFC3339)
 	_, err := r.db.Exec(`
 		INSERT INTO backup_schedules (
 			id, connection_id, enabled, cron_schedule, retention_days,
-			next_run_time, last_backup_time, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			next_run_time, last_backup_time, gpg_public_key, verify_connection_id,
+			compression_command, stream_to_storage, pg_dump_jobs, dump_filters, extra_dump_args,
+			mongo_dump_options, post_processors, redis_snapshot, bandwidth_limit_kbps, deduplicate, priority, timeout_minutes, rpo_minutes, masking_rules, sample_options, physical_backup, incremental_backups, all_databases, database_workers, databases, rerun_interrupted, timezone, jitter_seconds, paused, paused_at, pause_reason, concurrency_policy, run_at, retention_max_bytes, discord_webhook_url, heartbeat_url, size_anomaly_percent, verification_objective_minutes, compression_level, compression_threads, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44, $45, $46)`,
 		schedule.ID, schedule.ConnectionID, schedule.Enabled,
 		schedule.CronSchedule, schedule.RetentionDays,
-		nextRunStr, lastBackupStr, now, now)
+		nextRunStr, lastBackupStr, schedule.GPGPublicKey, schedule.VerifyConnectionID,
+		schedule.CompressionCommand, schedule.StreamToStorage, schedule.PgDumpJobs, schedule.DumpFilters, schedule.ExtraDumpArgs,
+		schedule.MongoDumpOptions, schedule.PostProcessors, schedule.RedisSnapshot, schedule.BandwidthLimitKBps, schedule.Deduplicate, schedule.Priority, schedule.TimeoutMinutes, schedule.RPOMinutes, schedule.MaskingRules, schedule.Sample, schedule.PhysicalBackup, schedule.IncrementalBackups, schedule.AllDatabases, schedule.DatabaseWorkers, schedule.Databases, schedule.RerunInterrupted, schedule.Timezone, schedule.JitterSeconds, schedule.Paused, pausedAtStr, schedule.PauseReason, schedule.ConcurrencyPolicy, runAtStr, schedule.RetentionMaxBytes, schedule.DiscordWebhookURL, schedule.HeartbeatURL, schedule.SizeAnomalyPercent, schedule.VerificationObjectiveMinutes, schedule.CompressionLevel, schedule.CompressionThreads, now, now)
 	return err
 }
 
@@ -58,6 +77,18 @@ func (r *BackupRepository) UpdateBackupSchedule(schedule *BackupSchedule) error
 		lastBackupStr = &str
 	}
 
+	var pausedAtStr *string
+	if schedule.PausedAt != nil {
+		str := schedule.PausedAt.Format(time.RFC3339)
+		pausedAtStr = &str
+	}
+
+	var runAtStr *string
+	if schedule.RunAt != nil {
+		str := schedule.RunAt.Format(time.RFC3339)
+		runAtStr = &str
+	}
+
 	query := `
 		UPDATE backup_schedules 
 		SET enabled = $1, 
@@ -65,8 +96,45 @@ func (r *BackupRepository) UpdateBackupSchedule(schedule *BackupSchedule) error
 		    retention_days = $3, 
 		    next_run_time = $4,
 		    last_backup_time = $5,
-		    updated_at = $6
-		WHERE id = $7
+		    gpg_public_key = $6,
+		    verify_connection_id = $7,
+		    compression_command = $8,
+		    stream_to_storage = $9,
+		    pg_dump_jobs = $10,
+		    dump_filters = $11,
+		    extra_dump_args = $12,
+		    mongo_dump_options = $13,
+		    post_processors = $14,
+		    redis_snapshot = $15,
+		    bandwidth_limit_kbps = $16,
+		    deduplicate = $17,
+		    priority = $18,
+		    timeout_minutes = $19,
+		    rpo_minutes = $20,
+		    masking_rules = $21,
+		    sample_options = $22,
+		    physical_backup = $23,
+		    incremental_backups = $24,
+		    all_databases = $25,
+		    database_workers = $26,
+		    databases = $27,
+		    rerun_interrupted = $28,
+		    timezone = $29,
+		    jitter_seconds = $30,
+		    paused = $31,
+		    paused_at = $32,
+		    pause_reason = $33,
+		    concurrency_policy = $34,
+		    run_at = $35,
+		    retention_max_bytes = $36,
+		    discord_webhook_url = $37,
+		    heartbeat_url = $38,
+		    size_anomaly_percent = $39,
+		    verification_objective_minutes = $40,
+		    compression_level = $41,
+		    compression_threads = $42,
+		    updated_at = $43
+		WHERE id = $44
 	`
 
 	_, err := r.db.Exec(query,
@@ -75,6 +143,43 @@ func (r *BackupRepository) UpdateBackupSchedule(schedule *BackupSchedule) error
 		schedule.RetentionDays,
 		nextRunStr,
 		lastBackupStr,
+		schedule.GPGPublicKey,
+		schedule.VerifyConnectionID,
+		schedule.CompressionCommand,
+		schedule.StreamToStorage,
+		schedule.PgDumpJobs,
+		schedule.DumpFilters,
+		schedule.ExtraDumpArgs,
+		schedule.MongoDumpOptions,
+		schedule.PostProcessors,
+		schedule.RedisSnapshot,
+		schedule.BandwidthLimitKBps,
+		schedule.Deduplicate,
+		schedule.Priority,
+		schedule.TimeoutMinutes,
+		schedule.RPOMinutes,
+		schedule.MaskingRules,
+		schedule.Sample,
+		schedule.PhysicalBackup,
+		schedule.IncrementalBackups,
+		schedule.AllDatabases,
+		schedule.DatabaseWorkers,
+		schedule.Databases,
+		schedule.RerunInterrupted,
+		schedule.Timezone,
+		schedule.JitterSeconds,
+		schedule.Paused,
+		pausedAtStr,
+		schedule.PauseReason,
+		schedule.ConcurrencyPolicy,
+		runAtStr,
+		schedule.RetentionMaxBytes,
+		schedule.DiscordWebhookURL,
+		schedule.HeartbeatURL,
+		schedule.SizeAnomalyPercent,
+		schedule.VerificationObjectiveMinutes,
+		schedule.CompressionLevel,
+		schedule.CompressionThreads,
 		time.Now(),
 		schedule.ID)
 	if err != nil {
@@ -85,23 +190,72 @@ func (r *BackupRepository) UpdateBackupSchedule(schedule *BackupSchedule) error
 }
 
 func (r *BackupRepository) GetBackupSchedule(connectionID string) (*BackupSchedule, error) {
+	row := r.db.QueryRow(`
+		SELECT `+backupScheduleColumns+`
+		FROM backup_schedules 
+		WHERE connection_id = $1
+		ORDER BY created_at DESC LIMIT 1`,
+		connectionID)
+	return scanBackupSchedule(row)
+}
+
+func (r *BackupRepository) GetAllActiveSchedules() ([]*BackupSchedule, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + backupScheduleColumns + `
+		FROM backup_schedules 
+		WHERE enabled = true
+		ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*BackupSchedule
+	for rows.Next() {
+		schedule, err := scanBackupSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+const backupScheduleColumns = `id, connection_id, enabled, cron_schedule, retention_days,
+		       next_run_time, last_backup_time, gpg_public_key, verify_connection_id,
+		       compression_command, stream_to_storage, pg_dump_jobs, dump_filters, extra_dump_args,
+		       mongo_dump_options, post_processors, redis_snapshot, bandwidth_limit_kbps, deduplicate, priority, timeout_minutes, rpo_minutes, masking_rules, sample_options, physical_backup, incremental_backups, all_databases, database_workers, databases, rerun_interrupted, timezone, jitter_seconds, paused, paused_at, pause_reason, concurrency_policy, run_at, retention_max_bytes, discord_webhook_url, heartbeat_url, size_anomaly_percent, verification_objective_minutes, compression_level, compression_threads, created_at, updated_at`
+
+func scanBackupSchedule(row rowScanner) (*BackupSchedule, error) {
 	var (
 		nextRunStr    sql.NullString
 		lastBackupStr sql.NullString
+		gpgPublicKey  sql.NullString
+		verifyConnID  sql.NullString
+		compression   sql.NullString
+		extraDumpArgs sql.NullString
+		timezone      sql.NullString
+		pausedAtStr   sql.NullString
+		pauseReason   sql.NullString
+		runAtStr      sql.NullString
+		discordURL    sql.NullString
+		heartbeatURL  sql.NullString
 		createdAtStr  string
 		updatedAtStr  string
 	)
 	schedule := &BackupSchedule{}
-	err := r.db.QueryRow(`
-		SELECT id, connection_id, enabled, cron_schedule, retention_days,
-		       next_run_time, last_backup_time, created_at, updated_at 
-		FROM backup_schedules 
-		WHERE connection_id = $1
-		ORDER BY created_at DESC LIMIT 1`,
-		connectionID).Scan(
+	err := row.Scan(
 		&schedule.ID, &schedule.ConnectionID, &schedule.Enabled,
 		&schedule.CronSchedule, &schedule.RetentionDays,
-		&nextRunStr, &lastBackupStr, &createdAtStr, &updatedAtStr)
+		&nextRunStr, &lastBackupStr, &gpgPublicKey, &verifyConnID,
+		&compression, &schedule.StreamToStorage, &schedule.PgDumpJobs, &schedule.DumpFilters, &extraDumpArgs,
+		&schedule.MongoDumpOptions, &schedule.PostProcessors, &schedule.RedisSnapshot,
+		&schedule.BandwidthLimitKBps, &schedule.Deduplicate, &schedule.Priority, &schedule.TimeoutMinutes, &schedule.RPOMinutes, &schedule.MaskingRules, &schedule.Sample, &schedule.PhysicalBackup, &schedule.IncrementalBackups, &schedule.AllDatabases, &schedule.DatabaseWorkers, &schedule.Databases, &schedule.RerunInterrupted, &timezone, &schedule.JitterSeconds, &schedule.Paused, &pausedAtStr, &pauseReason, &schedule.ConcurrencyPolicy, &runAtStr, &schedule.RetentionMaxBytes, &discordURL, &heartbeatURL, &schedule.SizeAnomalyPercent, &schedule.VerificationObjectiveMinutes, &schedule.CompressionLevel, &schedule.CompressionThreads, &createdAtStr, &updatedAtStr)
 	if err != nil {
 		return nil, err
 	}
@@ -124,101 +278,107 @@ func (r *BackupRepository) GetBackupSchedule(connectionID string) (*BackupSchedu
 		schedule.LastBackupTime = &lastBackup
 	}
 
-	// Parse created_at and updated_at
-	createdAt, err := common.ParseTime(createdAtStr)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	if gpgPublicKey.Valid && gpgPublicKey.String != "" {
+		schedule.GPGPublicKey = &gpgPublicKey.String
 	}
-	schedule.CreatedAt = createdAt
 
-	updatedAt, err := common.ParseTime(updatedAtStr)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	if verifyConnID.Valid && verifyConnID.String != "" {
+		schedule.VerifyConnectionID = &verifyConnID.String
 	}
-	schedule.UpdatedAt = updatedAt
 
-	return schedule, nil
-}
+	if compression.Valid && compression.String != "" {
+		schedule.CompressionCommand = &compression.String
+	}
 
-func (r *BackupRepository) GetAllActiveSchedules() ([]*BackupSchedule, error) {
-	rows, err := r.db.Query(`
-		SELECT id, connection_id, enabled, cron_schedule, retention_days,
-		       next_run_time, last_backup_time, created_at, updated_at 
-		FROM backup_schedules 
-		WHERE enabled = true
-		ORDER BY created_at DESC`)
-	if err != nil {
-		return nil, err
+	if extraDumpArgs.Valid && extraDumpArgs.String != "" {
+		schedule.ExtraDumpArgs = &extraDumpArgs.String
 	}
-	defer rows.Close()
 
-	var schedules []*BackupSchedule
-	for rows.Next() {
-		var (
-			nextRunStr    sql.NullString
-			lastBackupStr sql.NullString
-			createdAtStr  string
-			updatedAtStr  string
-		)
-		schedule := &BackupSchedule{}
-		err := rows.Scan(
-			&schedule.ID, &schedule.ConnectionID, &schedule.Enabled,
-			&schedule.CronSchedule, &schedule.RetentionDays,
-			&nextRunStr, &lastBackupStr, &createdAtStr, &updatedAtStr)
-		if err != nil {
-			return nil, err
-		}
+	if timezone.Valid && timezone.String != "" {
+		schedule.Timezone = &timezone.String
+	}
 
-		// Parse next_run_time if not null
-		if nextRunStr.Valid {
-			nextRun, err := common.ParseTime(nextRunStr.String)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing next_run_time: %v", err)
-			}
-			schedule.NextRunTime = &nextRun
+	if pausedAtStr.Valid {
+		pausedAt, err := common.ParseTime(pausedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing paused_at: %v", err)
 		}
+		schedule.PausedAt = &pausedAt
+	}
 
-		// Parse last_backup_time if not null
-		if lastBackupStr.Valid {
-			lastBackup, err := common.ParseTime(lastBackupStr.String)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing last_backup_time: %v", err)
-			}
-			schedule.LastBackupTime = &lastBackup
-		}
+	if pauseReason.Valid && pauseReason.String != "" {
+		schedule.PauseReason = &pauseReason.String
+	}
 
-		// Parse created_at and updated_at
-		createdAt, err := common.ParseTime(createdAtStr)
+	if runAtStr.Valid {
+		runAt, err := common.ParseTime(runAtStr.String)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing created_at: %v", err)
+			return nil, fmt.Errorf("error parsing run_at: %v", err)
 		}
-		schedule.CreatedAt = createdAt
+		schedule.RunAt = &runAt
+	}
 
-		updatedAt, err := common.ParseTime(updatedAtStr)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing updated_at: %v", err)
-		}
-		schedule.UpdatedAt = updatedAt
+	if discordURL.Valid && discordURL.String != "" {
+		schedule.DiscordWebhookURL = &discordURL.String
+	}
 
-		schedules = append(schedules, schedule)
+	if heartbeatURL.Valid && heartbeatURL.String != "" {
+		schedule.HeartbeatURL = &heartbeatURL.String
 	}
+	schedule.State = schedule.state()
 
-	return schedules, rows.Err()
+	// Parse created_at and updated_at
+	createdAt, err := common.ParseTime(createdAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	schedule.CreatedAt = createdAt
+
+	updatedAt, err := common.ParseTime(updatedAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+	schedule.UpdatedAt = updatedAt
+
+	return schedule, nil
 }
 
 // Backup Methods
 
+// CreateBackup saves a backup together with its table catalog
 func (r *BackupRepository) CreateBackup(backup *Backup) error {
-	_, err := r.db.Exec(`
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
 		INSERT INTO backups (
-			id, connection_id, schedule_id, status, path, s3_object_key, size,
-			started_time, completed_time, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
-		backup.ID, backup.ConnectionID, backup.ScheduleID,
-		backup.Status, backup.Path, backup.S3ObjectKey, backup.Size,
-		backup.StartedTime, backup.CompletedTime,
+			id, connection_id, database_name, database_size, schedule_id, run_id, status, path, s3_object_key, size, compression_command,
+			encryption_key_fingerprint, checksum, checksum_signature, signing_key_fingerprint, dump_filters, run_environment, post_processed_files,
+			incremental_base_id, checkpoint_lsn, manifest, started_time, completed_time, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25)`,
+		backup.ID, backup.ConnectionID, backup.DatabaseName, backup.DatabaseSize, backup.ScheduleID, backup.RunID,
+		backup.Status, backup.Path, backup.S3ObjectKey, backup.Size, backup.CompressionCommand,
+		backup.EncryptionKeyFingerprint, backup.Checksum, backup.ChecksumSignature, backup.SigningKeyFingerprint, backup.DumpFilters, backup.RunEnvironment, backup.PostProcessedFiles,
+		backup.IncrementalBaseID, backup.CheckpointLSN, backup.Manifest, backup.StartedTime, backup.CompletedTime,
 		backup.CreatedAt, backup.UpdatedAt)
-	return err
+	if err != nil {
+		return err
+	}
+
+	for _, table := range backup.catalog {
+		_, err := tx.Exec(`
+			INSERT INTO backup_catalog_entries (backup_id, schema_name, table_name)
+			VALUES ($1, $2, $3)`,
+			backup.ID, table.Schema, table.Name)
+		if err != nil {
+			return fmt.Errorf("failed to save catalog entry: %v", err)
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (r *BackupRepository) UpdateBackupStatus(id string, status string) error {
@@ -227,13 +387,25 @@ func (r *BackupRepository) UpdateBackupStatus(id string, status string) error {
 	return err
 }
 
+// GetBackupsOlderThan returns the completed backups created before cutoffTime.
+// Backups that newer incremental backups still build on are left out, so
+// retention never breaks an incremental chain.
 func (r *BackupRepository) GetBackupsOlderThan(connectionID string, cutoffTime time.Time) ([]*Backup, error) {
 	rows, err := r.db.Query(`
-		SELECT id, path, s3_object_key, created_at 
+		WITH RECURSIVE chain_bases(id) AS (
+			SELECT incremental_base_id FROM backups
+			WHERE connection_id = $1 AND created_at >= $2 AND incremental_base_id IS NOT NULL
+			UNION
+			SELECT b.incremental_base_id FROM backups b
+			INNER JOIN chain_bases c ON b.id = c.id
+			WHERE b.incremental_base_id IS NOT NULL
+		)
+		SELECT id, connection_id, path, s3_object_key, size, post_processed_files, created_at 
 		FROM backups 
 		WHERE connection_id = $1 
 		AND created_at < $2 
-		AND status = 'completed'`,
+		AND status = 'completed'
+		AND id NOT IN (SELECT id FROM chain_bases)`,
 		connectionID, cutoffTime)
 	if err != nil {
 		return nil, err
@@ -244,7 +416,43 @@ func (r *BackupRepository) GetBackupsOlderThan(connectionID string, cutoffTime t
 	for rows.Next() {
 		backup := &Backup{}
 		var createdAtStr string
-		err := rows.Scan(&backup.ID, &backup.Path, &backup.S3ObjectKey, &createdAtStr)
+		err := rows.Scan(&backup.ID, &backup.ConnectionID, &backup.Path, &backup.S3ObjectKey, &backup.Size,
+			&backup.PostProcessedFiles, &createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+		createdAt, err := common.ParseTime(createdAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing created_at: %v", err)
+		}
+		backup.CreatedAt = createdAt
+		backups = append(backups, backup)
+	}
+	return backups, rows.Err()
+}
+
+// GetCompletedBackupsNewestFirst returns the completed backups of a
+// connection, newest first, with what the storage quota needs to pick the
+// ones to delete
+func (r *BackupRepository) GetCompletedBackupsNewestFirst(connectionID string) ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT id, connection_id, path, s3_object_key, size, post_processed_files, incremental_base_id, created_at
+		FROM backups
+		WHERE connection_id = $1
+		AND status = 'completed'
+		ORDER BY created_at DESC`,
+		connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var backups []*Backup
+	for rows.Next() {
+		backup := &Backup{}
+		var createdAtStr string
+		err := rows.Scan(&backup.ID, &backup.ConnectionID, &backup.Path, &backup.S3ObjectKey, &backup.Size,
+			&backup.PostProcessedFiles, &backup.IncrementalBaseID, &createdAtStr)
 		if err != nil {
 			return nil, err
 		}
@@ -259,30 +467,54 @@ func (r *BackupRepository) GetBackupsOlderThan(connectionID string, cutoffTime t
 }
 
 func (r *BackupRepository) DeleteBackup(id string) error {
+	if _, err := r.db.Exec("DELETE FROM backup_catalog_entries WHERE backup_id = $1", id); err != nil {
+		return err
+	}
 	_, err := r.db.Exec("DELETE FROM backups WHERE id = $1", id)
 	return err
 }
 
 func (r *BackupRepository) GetBackup(id string) (*Backup, error) {
+	row := r.db.QueryRow(`
+		SELECT `+backupColumns+`
+		FROM backups WHERE id = $1`, id)
+	return scanBackup(row)
+}
+
+const backupColumns = `id, connection_id, database_name, database_size, schedule_id, run_id, status, path, s3_object_key, size, compression_command,
+		       encryption_key_fingerprint, checksum, checksum_signature, signing_key_fingerprint, verification_status, verified_at,
+		       restore_verification_status, dump_filters, run_environment, post_processed_files,
+		       incremental_base_id, checkpoint_lsn, manifest, started_time, completed_time, created_at, updated_at,
+		       suspect, suspect_reason`
+
+func scanBackup(row rowScanner) (*Backup, error) {
 	var (
+		verifiedAtStr    sql.NullString
 		startedTimeStr   string
 		completedTimeStr sql.NullString
 		createdAtStr     string
 		updatedAtStr     string
 	)
 	backup := &Backup{}
-	err := r.db.QueryRow(`
-		SELECT id, connection_id, schedule_id, status, path, s3_object_key, size,
-			   started_time, completed_time, created_at, updated_at 
-		FROM backups WHERE id = $1`, id).
-		Scan(&backup.ID, &backup.ConnectionID, &backup.ScheduleID,
-			&backup.Status, &backup.Path, &backup.S3ObjectKey, &backup.Size,
-			&startedTimeStr, &completedTimeStr,
-			&createdAtStr, &updatedAtStr)
+	err := row.Scan(&backup.ID, &backup.ConnectionID, &backup.DatabaseName, &backup.DatabaseSize, &backup.ScheduleID, &backup.RunID,
+		&backup.Status, &backup.Path, &backup.S3ObjectKey, &backup.Size, &backup.CompressionCommand,
+		&backup.EncryptionKeyFingerprint, &backup.Checksum, &backup.ChecksumSignature, &backup.SigningKeyFingerprint, &backup.VerificationStatus,
+		&verifiedAtStr, &backup.RestoreVerificationStatus, &backup.DumpFilters, &backup.RunEnvironment, &backup.PostProcessedFiles,
+		&backup.IncrementalBaseID, &backup.CheckpointLSN, &backup.Manifest, &startedTimeStr, &completedTimeStr, &createdAtStr, &updatedAtStr,
+		&backup.Suspect, &backup.SuspectReason)
 	if err != nil {
 		return nil, err
 	}
 
+	// Parse verified_at if not null
+	if verifiedAtStr.Valid {
+		verifiedAt, err := common.ParseTime(verifiedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing verified_at: %v", err)
+		}
+		backup.VerifiedAt = &verifiedAt
+	}
+
 	// Parse started_time
 	startedTime, err := common.ParseTime(startedTimeStr)
 	if err != nil {
@@ -316,7 +548,7 @@ func (r *BackupRepository) GetBackup(id string) (*Backup, error) {
 }
 
 func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) ([]*BackupList, int, error) {
-	whereClause := "WHERE c.user_id = $1"
+	whereClause := "WHERE c.id IN (" + connection.AccessibleConnections + ")"
 	args := []interface{}{opts.UserID}
 	argCount := 2
 
@@ -340,8 +572,9 @@ func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) (
 	query := fmt.Sprintf(`
 		SELECT 
 			b.id, b.connection_id, c.type, b.schedule_id, b.status, b.path, b.s3_object_key, b.size,
-			b.started_time, b.completed_time, b.created_at, b.updated_at,
-			c.database_name
+			b.compression_command, b.encryption_key_fingerprint, b.checksum, b.verification_status, b.verified_at,
+			b.restore_verification_status, b.dump_filters, b.suspect, b.suspect_reason, b.started_time, b.completed_time,
+			b.created_at, b.updated_at, COALESCE(b.database_name, c.database_name)
 		FROM backups b
 		INNER JOIN connections c ON b.connection_id = c.id
 		%s
@@ -368,6 +601,8 @@ func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) (
 		err := rows.Scan(
 			&backup.ID, &backup.ConnectionID, &backup.DatabaseType,
 			&backup.ScheduleID, &backup.Status, &backup.Path, &backup.S3ObjectKey, &backup.Size,
+			&backup.CompressionCommand, &backup.EncryptionKeyFingerprint, &backup.Checksum, &backup.VerificationStatus,
+			&backup.VerifiedAt, &backup.RestoreVerificationStatus, &backup.DumpFilters, &backup.Suspect, &backup.SuspectReason,
 			&startedTimeStr, &completedTimeStr,
 			&createdAtStr, &updatedAtStr,
 			&backup.DatabaseName,
@@ -412,7 +647,7 @@ func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error
 				COALESCE(SUM(b.size), 0) as total_size
 		FROM backups b
 		INNER JOIN connections c ON b.connection_id = c.id
-		WHERE c.user_id = $1
+		WHERE c.id IN (`+connection.AccessibleConnections+`)
 	`, userID).Scan(&stats.TotalBackups, &stats.FailedBackups, &stats.TotalSize)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -436,7 +671,7 @@ func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error
 			b.completed_time
 		FROM backups b
 		INNER JOIN connections c ON b.connection_id = c.id
-		WHERE c.user_id = $1 
+		WHERE c.id IN (`+connection.AccessibleConnections+`)
 		AND b.status = 'completed'
 		AND b.completed_time IS NOT NULL
 	`, userID)
@@ -475,8 +710,7 @@ func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error
 
 func (r *BackupRepository) GetBackupsByConnectionID(connectionID string) ([]*Backup, error) {
 	rows, err := r.db.Query(`
-		SELECT id, connection_id, schedule_id, status, path, s3_object_key, size,
-		       started_time, completed_time, created_at, updated_at
+		SELECT `+backupColumns+`
 		FROM backups
 		WHERE connection_id = $1
 		ORDER BY created_at DESC`,
@@ -488,54 +722,2103 @@ func (r *BackupRepository) GetBackupsByConnectionID(connectionID string) ([]*Bac
 
 	var backups []*Backup
 	for rows.Next() {
-		backup := &Backup{}
-		var startedTimeStr, createdAtStr, updatedAtStr string
-		var completedTimeStr sql.NullString
-
-		err := rows.Scan(
-			&backup.ID, &backup.ConnectionID, &backup.ScheduleID, &backup.Status,
-			&backup.Path, &backup.S3ObjectKey, &backup.Size,
-			&startedTimeStr, &completedTimeStr, &createdAtStr, &updatedAtStr,
-		)
+		backup, err := scanBackup(rows)
 		if err != nil {
 			return nil, err
 		}
+		backups = append(backups, backup)
+	}
 
-		backup.StartedTime, err = common.ParseTime(startedTimeStr)
-		if err != nil {
+	return backups, rows.Err()
+}
+
+// GetLatestCompletedBackup returns the newest completed backup of a connection
+func (r *BackupRepository) GetLatestCompletedBackup(connectionID string) (*Backup, error) {
+	row := r.db.QueryRow(`
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE connection_id = $1 AND status = 'completed'
+		ORDER BY created_at DESC LIMIT 1`,
+		connectionID)
+	return scanBackup(row)
+}
+
+// GetLatestCheckpointedBackup returns the newest completed backup of a
+// connection that recorded a checkpoint LSN, which incremental physical
+// backups continue from
+func (r *BackupRepository) GetLatestCheckpointedBackup(connectionID string) (*Backup, error) {
+	row := r.db.QueryRow(`
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE connection_id = $1 AND status = 'completed' AND checkpoint_lsn IS NOT NULL
+		ORDER BY created_at DESC LIMIT 1`,
+		connectionID)
+	return scanBackup(row)
+}
+
+// GetArtifactSizeRatios returns the artifact to database size ratios of the
+// latest completed backups of a connection that recorded their database size
+func (r *BackupRepository) GetArtifactSizeRatios(connectionID string, limit int) ([]float64, error) {
+	rows, err := r.db.Query(`
+		SELECT CAST(size AS REAL) / database_size
+		FROM backups
+		WHERE connection_id = $1
+		AND status = 'completed'
+		AND size > 0
+		AND database_size > 0
+		ORDER BY created_at DESC
+		LIMIT $2`,
+		connectionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ratios []float64
+	for rows.Next() {
+		var ratio float64
+		if err := rows.Scan(&ratio); err != nil {
 			return nil, err
 		}
+		ratios = append(ratios, ratio)
+	}
+	return ratios, rows.Err()
+}
 
-		if completedTimeStr.Valid {
-			completedTime, err := common.ParseTime(completedTimeStr.String)
-			if err != nil {
-				return nil, err
-			}
-			backup.CompletedTime = &completedTime
-		}
+// GetAverageBackupSize returns the average size of the completed backups of
+// a connection's database created in [from, to), with how many there are
+func (r *BackupRepository) GetAverageBackupSize(connectionID string, databaseName *string, from, to time.Time) (float64, int, error) {
+	var average sql.NullFloat64
+	var count int
+	err := r.db.QueryRow(`
+		SELECT AVG(size), COUNT(*)
+		FROM backups
+		WHERE connection_id = $1
+		AND database_name IS $2
+		AND status = 'completed'
+		AND size > 0
+		AND created_at >= $3 AND created_at < $4`,
+		connectionID, databaseName, from, to).Scan(&average, &count)
+	if err != nil {
+		return 0, 0, err
+	}
+	return average.Float64, count, nil
+}
+
+func (r *BackupRepository) UpdateBackupS3ObjectKey(backupID string, s3ObjectKey string) error {
+	_, err := r.db.Exec(`
+		UPDATE backups 
+		SET s3_object_key = $1, updated_at = datetime('now') 
+		WHERE id = $2`,
+		s3ObjectKey, backupID)
+	return err
+}
+
+// RecordBackupDeletion keeps evidence of a removed backup artifact
+func (r *BackupRepository) RecordBackupDeletion(backup *Backup, reason string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO backup_deletions (
+			id, backup_id, connection_id, path, s3_object_key, size,
+			reason, backup_created_at, deleted_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		uuid.New(), backup.ID, backup.ConnectionID, backup.Path, backup.S3ObjectKey, backup.Size,
+		reason, backup.CreatedAt.Format(time.RFC3339), time.Now().Format(time.RFC3339))
+	return err
+}
+
+func (r *BackupRepository) GetBackupDeletions(connectionID string, from, to time.Time) ([]*BackupDeletion, error) {
+	rows, err := r.db.Query(`
+		SELECT backup_id, path, s3_object_key, COALESCE(size, 0), reason,
+		       COALESCE(backup_created_at, ''), deleted_at
+		FROM backup_deletions
+		WHERE connection_id = $1
+		AND deleted_at >= $2 AND deleted_at <= $3
+		ORDER BY deleted_at DESC`,
+		connectionID, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		backup.CreatedAt, err = common.ParseTime(createdAtStr)
+	deletions := []*BackupDeletion{}
+	for rows.Next() {
+		deletion := &BackupDeletion{}
+		var path sql.NullString
+		err := rows.Scan(&deletion.BackupID, &path, &deletion.S3ObjectKey, &deletion.Size,
+			&deletion.Reason, &deletion.BackupCreatedAt, &deletion.DeletedAt)
 		if err != nil {
 			return nil, err
 		}
+		deletion.Path = path.String
+		deletions = append(deletions, deletion)
+	}
+
+	return deletions, rows.Err()
+}
+
+func (r *BackupRepository) UpdateBackupVerification(id string, status string, verifiedAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE backups 
+		SET verification_status = $1, verified_at = $2, updated_at = $3 
+		WHERE id = $4`,
+		status, verifiedAt.Format(time.RFC3339), time.Now().Format(time.RFC3339), id)
+	return err
+}
 
-		backup.UpdatedAt, err = common.ParseTime(updatedAtStr)
+// GetBackupsWithChecksum returns completed backups that have a recorded checksum
+func (r *BackupRepository) GetBackupsWithChecksum() ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + backupColumns + `
+		FROM backups
+		WHERE status = 'completed' AND checksum IS NOT NULL
+		ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var backups []*Backup
+	for rows.Next() {
+		backup, err := scanBackup(rows)
 		if err != nil {
 			return nil, err
 		}
-
 		backups = append(backups, backup)
 	}
 
 	return backups, rows.Err()
 }
 
-
-func (r *BackupRepository) UpdateBackupS3ObjectKey(backupID string, s3ObjectKey string) error {
+func (r *BackupRepository) UpdateRestoreVerificationStatus(backupID string, status string) error {
 	_, err := r.db.Exec(`
 		UPDATE backups 
-		SET s3_object_key = $1, updated_at = datetime('now') 
-		WHERE id = $2`,
-		s3ObjectKey, backupID)
+		SET restore_verification_status = $1, updated_at = $2 
+		WHERE id = $3`,
+		status, time.Now().Format(time.RFC3339), backupID)
 	return err
 }
+
+type restoreVerificationDetails struct {
+	Tables   []RestoreTableCheck `json:"tables"`
+	Warnings []string            `json:"warnings"`
+}
+
+func (r *BackupRepository) CreateRestoreVerification(v *RestoreVerification) error {
+	details, err := json.Marshal(restoreVerificationDetails{Tables: v.Tables, Warnings: v.Warnings})
+	if err != nil {
+		return err
+	}
+
+	var completedAtStr *string
+	if v.CompletedAt != nil {
+		str := v.CompletedAt.Format(time.RFC3339)
+		completedAtStr = &str
+	}
+
+	_, err = r.db.Exec(`
+		INSERT INTO backup_restore_verifications (
+			id, backup_id, scratch_connection_id, status, details, error, started_at, completed_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		v.ID, v.BackupID, v.ScratchConnectionID, v.Status, string(details), v.Error,
+		v.StartedAt.Format(time.RFC3339), completedAtStr)
+	return err
+}
+
+func (r *BackupRepository) GetLatestRestoreVerification(backupID string) (*RestoreVerification, error) {
+	var (
+		detailsStr     sql.NullString
+		errorStr       sql.NullString
+		startedAtStr   string
+		completedAtStr sql.NullString
+	)
+	v := &RestoreVerification{}
+	err := r.db.QueryRow(`
+		SELECT id, backup_id, scratch_connection_id, status, details, error, started_at, completed_at
+		FROM backup_restore_verifications
+		WHERE backup_id = $1
+		ORDER BY started_at DESC LIMIT 1`, backupID).
+		Scan(&v.ID, &v.BackupID, &v.ScratchConnectionID, &v.Status,
+			&detailsStr, &errorStr, &startedAtStr, &completedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var details restoreVerificationDetails
+	if detailsStr.Valid && detailsStr.String != "" {
+		if err := json.Unmarshal([]byte(detailsStr.String), &details); err != nil {
+			return nil, fmt.Errorf("error parsing verification details: %v", err)
+		}
+	}
+	v.Tables = details.Tables
+	v.Warnings = details.Warnings
+	v.Error = errorStr.String
+
+	v.StartedAt, err = common.ParseTime(startedAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing started_at: %v", err)
+	}
+
+	if completedAtStr.Valid {
+		completedAt, err := common.ParseTime(completedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing completed_at: %v", err)
+		}
+		v.CompletedAt = &completedAt
+	}
+
+	return v, nil
+}
+
+// SaveUploadJournal creates or updates the resume journal of a chunked upload
+func (r *BackupRepository) SaveUploadJournal(j *UploadJournal) error {
+	parts, err := json.Marshal(j.Parts)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	_, err = r.db.Exec(`
+		INSERT INTO backup_uploads (
+			backup_id, object_key, upload_id, part_size, total_size, parts,
+			status, attempts, error, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT(backup_id) DO UPDATE SET
+			object_key = excluded.object_key,
+			upload_id = excluded.upload_id,
+			part_size = excluded.part_size,
+			total_size = excluded.total_size,
+			parts = excluded.parts,
+			status = excluded.status,
+			attempts = excluded.attempts,
+			error = excluded.error,
+			updated_at = excluded.updated_at`,
+		j.BackupID, j.ObjectKey, j.UploadID, j.PartSize, j.TotalSize, string(parts),
+		j.Status, j.Attempts, j.Error, now, now)
+	return err
+}
+
+const uploadJournalColumns = `backup_id, object_key, upload_id, part_size, total_size, parts,
+		       status, attempts, error, created_at, updated_at`
+
+func scanUploadJournal(row rowScanner) (*UploadJournal, error) {
+	var (
+		partsStr     string
+		errorStr     sql.NullString
+		createdAtStr string
+		updatedAtStr string
+	)
+	j := &UploadJournal{}
+	err := row.Scan(&j.BackupID, &j.ObjectKey, &j.UploadID, &j.PartSize, &j.TotalSize, &partsStr,
+		&j.Status, &j.Attempts, &errorStr, &createdAtStr, &updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(partsStr), &j.Parts); err != nil {
+		return nil, fmt.Errorf("error parsing upload parts: %v", err)
+	}
+	j.Error = errorStr.String
+
+	j.CreatedAt, err = common.ParseTime(createdAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	j.UpdatedAt, err = common.ParseTime(updatedAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+
+	return j, nil
+}
+
+func (r *BackupRepository) GetUploadJournal(backupID string) (*UploadJournal, error) {
+	row := r.db.QueryRow(`
+		SELECT `+uploadJournalColumns+`
+		FROM backup_uploads WHERE backup_id = $1`, backupID)
+	return scanUploadJournal(row)
+}
+
+// GetPendingUploadJournals returns uploads that were interrupted, including
+// those left "uploading" by a process that exited mid-upload.
+func (r *BackupRepository) GetPendingUploadJournals() ([]*UploadJournal, error) {
+	rows, err := r.db.Query(`
+		SELECT ` + uploadJournalColumns + `
+		FROM backup_uploads
+		WHERE status IN ('uploading', 'interrupted')
+		ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var journals []*UploadJournal
+	for rows.Next() {
+		j, err := scanUploadJournal(rows)
+		if err != nil {
+			return nil, err
+		}
+		journals = append(journals, j)
+	}
+
+	return journals, rows.Err()
+}
+
+func (r *BackupRepository) DeleteUploadJournal(backupID string) error {
+	_, err := r.db.Exec("DELETE FROM backup_uploads WHERE backup_id = $1", backupID)
+	return err
+}
+
+func (r *BackupRepository) CreateBackupRun(run *BackupRun) error {
+	_, err := r.db.Exec(`
+		INSERT INTO backup_runs (
+			id, connection_id, schedule_id, trigger, status, priority, started_time
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		run.ID, run.ConnectionID, run.ScheduleID, run.Trigger, run.Status, run.Priority,
+		run.StartedTime.Format(time.RFC3339))
+	return err
+}
+
+// StartBackupRun marks a queued run as running from its start time
+func (r *BackupRepository) StartBackupRun(run *BackupRun) error {
+	_, err := r.db.Exec(`
+		UPDATE backup_runs SET status = $1, started_time = $2 WHERE id = $3`,
+		run.Status, run.StartedTime.Format(time.RFC3339), run.ID)
+	return err
+}
+
+// FinishBackupRun stores the aggregated outcome of a run and its child jobs
+func (r *BackupRepository) FinishBackupRun(run *BackupRun) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var completedTimeStr *string
+	if run.CompletedTime != nil {
+		str := run.CompletedTime.Format(time.RFC3339)
+		completedTimeStr = &str
+	}
+
+	_, err = tx.Exec(`
+		UPDATE backup_runs
+		SET status = $1, total_jobs = $2, succeeded_jobs = $3, failed_jobs = $4,
+		    error = $5, completed_time = $6
+		WHERE id = $7`,
+		run.Status, run.TotalJobs, run.SucceededJobs, run.FailedJobs,
+		run.Error, completedTimeStr, run.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range run.Jobs {
+		_, err := tx.Exec(`
+			INSERT INTO backup_run_jobs (
+				id, run_id, kind, target, backup_id, status, error, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			job.ID, job.RunID, job.Kind, job.Target, job.BackupID, job.Status, job.Error,
+			job.CreatedAt.Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+const backupRunColumns = `id, connection_id, schedule_id, trigger, status, priority, total_jobs, succeeded_jobs,
+		       failed_jobs, error, started_time, completed_time`
+
+func scanBackupRun(row rowScanner) (*BackupRun, error) {
+	var (
+		startedTimeStr   string
+		completedTimeStr sql.NullString
+	)
+	run := &BackupRun{}
+	err := row.Scan(&run.ID, &run.ConnectionID, &run.ScheduleID, &run.Trigger, &run.Status, &run.Priority,
+		&run.TotalJobs, &run.SucceededJobs, &run.FailedJobs, &run.Error,
+		&startedTimeStr, &completedTimeStr)
+	if err != nil {
+		return nil, err
+	}
+
+	run.StartedTime, err = common.ParseTime(startedTimeStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing started_time: %v", err)
+	}
+
+	if completedTimeStr.Valid {
+		completedTime, err := common.ParseTime(completedTimeStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing completed_time: %v", err)
+		}
+		run.CompletedTime = &completedTime
+	}
+
+	return run, nil
+}
+
+func (r *BackupRepository) GetBackupRun(id string) (*BackupRun, error) {
+	row := r.db.QueryRow(`
+		SELECT `+backupRunColumns+`
+		FROM backup_runs WHERE id = $1`, id)
+	return scanBackupRun(row)
+}
+
+func (r *BackupRepository) GetBackupRunsByConnectionID(connectionID string, limit int) ([]*BackupRun, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupRunColumns+`
+		FROM backup_runs
+		WHERE connection_id = $1
+		ORDER BY started_time DESC
+		LIMIT $2`,
+		connectionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*BackupRun{}
+	for rows.Next() {
+		run, err := scanBackupRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// GetBackupRunsSince returns the finished runs of a user's connections that
+// started in [from, to), oldest first
+func (r *BackupRepository) GetBackupRunsSince(userID uuid.UUID, from, to time.Time) ([]*BackupRun, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupRunColumns+`
+		FROM backup_runs
+		WHERE connection_id IN (`+connection.AccessibleConnections+`)
+		AND started_time >= $2 AND started_time < $3
+		AND status NOT IN ($4, $5)
+		ORDER BY started_time`,
+		userID, from.Format(time.RFC3339), to.Format(time.RFC3339), RunStatusQueued, RunStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*BackupRun{}
+	for rows.Next() {
+		run, err := scanBackupRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// GetUnfinishedBackupRuns returns the runs that are still queued or running
+func (r *BackupRepository) GetUnfinishedBackupRuns() ([]*BackupRun, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupRunColumns+`
+		FROM backup_runs
+		WHERE status IN ($1, $2)
+		ORDER BY started_time`,
+		RunStatusQueued, RunStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*BackupRun{}
+	for rows.Next() {
+		run, err := scanBackupRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// GetBackupsByRunID returns the backups a run saved
+func (r *BackupRepository) GetBackupsByRunID(runID string) ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE run_id = $1
+		ORDER BY created_at`,
+		runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var backups []*Backup
+	for rows.Next() {
+		backup, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+
+	return backups, rows.Err()
+}
+
+func (r *BackupRepository) GetBackupRunJobs(runID string) ([]*BackupRunJob, error) {
+	rows, err := r.db.Query(`
+		SELECT id, run_id, kind, target, backup_id, status, error, created_at
+		FROM backup_run_jobs
+		WHERE run_id = $1
+		ORDER BY created_at, rowid`,
+		runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*BackupRunJob{}
+	for rows.Next() {
+		job := &BackupRunJob{}
+		var createdAtStr string
+		err := rows.Scan(&job.ID, &job.RunID, &job.Kind, &job.Target, &job.BackupID,
+			&job.Status, &job.Error, &createdAtStr)
+		if err != nil {
+			return nil, err
+		}
+		job.CreatedAt, err = common.ParseTime(createdAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing created_at: %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// SearchBackupCatalog lists the user's backups matching the search options.
+// Database, Tag and Table are expected in lower case, Table as a LIKE pattern.
+func (r *BackupRepository) SearchBackupCatalog(opts CatalogSearchOptions) ([]*CatalogSearchResult, int, error) {
+	whereClause := "WHERE c.id IN (" + connection.AccessibleConnections + ")"
+	args := []interface{}{opts.UserID}
+	argCount := 2
+
+	if opts.ConnectionID != "" {
+		whereClause += fmt.Sprintf(" AND b.connection_id = $%d", argCount)
+		args = append(args, opts.ConnectionID)
+		argCount++
+	}
+	if opts.Database != "" {
+		whereClause += fmt.Sprintf(" AND LOWER(COALESCE(b.database_name, c.database_name)) = $%d", argCount)
+		args = append(args, opts.Database)
+		argCount++
+	}
+	if opts.Tag != "" {
+		// Tags are stored lower case and comma separated
+		whereClause += fmt.Sprintf(" AND (',' || COALESCE(c.tags, '') || ',') LIKE $%d", argCount)
+		args = append(args, "%,"+opts.Tag+",%")
+		argCount++
+	}
+	if opts.From != nil {
+		whereClause += fmt.Sprintf(" AND b.created_at >= $%d", argCount)
+		args = append(args, *opts.From)
+		argCount++
+	}
+	if opts.To != nil {
+		whereClause += fmt.Sprintf(" AND b.created_at < $%d", argCount)
+		args = append(args, *opts.To)
+		argCount++
+	}
+	if opts.Table != "" {
+		whereClause += fmt.Sprintf(` AND EXISTS (
+			SELECT 1 FROM backup_catalog_entries e
+			WHERE e.backup_id = b.id
+			AND (LOWER(e.table_name) LIKE $%d ESCAPE '\' OR LOWER(e.schema_name || '.' || e.table_name) LIKE $%d ESCAPE '\'))`,
+			argCount, argCount)
+		args = append(args, opts.Table)
+		argCount++
+	}
+
+	countQuery := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM backups b
+		INNER JOIN connections c ON b.connection_id = c.id
+		%s`, whereClause)
+
+	var total int
+	if err := r.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT b.id, b.connection_id, c.name, c.type, COALESCE(b.database_name, c.database_name),
+		       b.status, b.path, b.s3_object_key, b.size, b.created_at
+		FROM backups b
+		INNER JOIN connections c ON b.connection_id = c.id
+		%s
+		ORDER BY b.created_at DESC
+		LIMIT $%d OFFSET $%d`, whereClause, argCount, argCount+1)
+
+	args = append(args, opts.Limit, opts.Offset)
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := make([]*CatalogSearchResult, 0)
+	for rows.Next() {
+		result := &CatalogSearchResult{}
+		err := rows.Scan(&result.BackupID, &result.ConnectionID, &result.ConnectionName, &result.DatabaseType,
+			&result.DatabaseName, &result.Status, &result.Path, &result.S3ObjectKey, &result.Size, &result.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		results = append(results, result)
+	}
+
+	return results, total, rows.Err()
+}
+
+// GetCatalogTables returns the catalog tables of a backup that match a LIKE
+// pattern in lower case
+func (r *BackupRepository) GetCatalogTables(backupID string, pattern string) ([]CatalogTable, error) {
+	rows, err := r.db.Query(`
+		SELECT schema_name, table_name
+		FROM backup_catalog_entries
+		WHERE backup_id = $1
+		AND (LOWER(table_name) LIKE $2 ESCAPE '\' OR LOWER(schema_name || '.' || table_name) LIKE $2 ESCAPE '\')
+		ORDER BY schema_name, table_name`,
+		backupID, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []CatalogTable
+	for rows.Next() {
+		var table CatalogTable
+		if err := rows.Scan(&table.Schema, &table.Name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// SaveBackupChunks records the chunk list of a deduplicated backup and counts
+// a reference to every chunk
+func (r *BackupRepository) SaveBackupChunks(backupID string, chunks []BackupChunk) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format(time.RFC3339)
+	for _, chunk := range chunks {
+		_, err := tx.Exec(`
+			INSERT INTO dedup_chunks (hash, size, stored_size, ref_count, created_at)
+			VALUES ($1, $2, $3, 1, $4)
+			ON CONFLICT(hash) DO UPDATE SET ref_count = ref_count + 1`,
+			chunk.Hash, chunk.Size, chunk.StoredSize, now)
+		if err != nil {
+			return fmt.Errorf("failed to save chunk: %v", err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO backup_chunks (backup_id, seq, chunk_hash)
+			VALUES ($1, $2, $3)`,
+			backupID, chunk.Seq, chunk.Hash)
+		if err != nil {
+			return fmt.Errorf("failed to save chunk reference: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetBackupChunks returns the chunks of a deduplicated backup in order, or
+// none when the backup is stored as a whole file
+func (r *BackupRepository) GetBackupChunks(backupID string) ([]BackupChunk, error) {
+	rows, err := r.db.Query(`
+		SELECT bc.seq, bc.chunk_hash, dc.size, dc.stored_size
+		FROM backup_chunks bc
+		INNER JOIN dedup_chunks dc ON dc.hash = bc.chunk_hash
+		WHERE bc.backup_id = $1
+		ORDER BY bc.seq`,
+		backupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []BackupChunk
+	for rows.Next() {
+		var chunk BackupChunk
+		if err := rows.Scan(&chunk.Seq, &chunk.Hash, &chunk.Size, &chunk.StoredSize); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks, rows.Err()
+}
+
+// ReleaseBackupChunks drops the chunk references of a backup and returns the
+// chunks no backup references anymore, whose files can be removed
+func (r *BackupRepository) ReleaseBackupChunks(backupID string) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE dedup_chunks
+		SET ref_count = ref_count - (
+			SELECT COUNT(*) FROM backup_chunks bc
+			WHERE bc.backup_id = $1 AND bc.chunk_hash = dedup_chunks.hash
+		)
+		WHERE hash IN (SELECT chunk_hash FROM backup_chunks WHERE backup_id = $1)`,
+		backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM backup_chunks WHERE backup_id = $1", backupID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query("SELECT hash FROM dedup_chunks WHERE ref_count <= 0")
+	if err != nil {
+		return nil, err
+	}
+	var unreferenced []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		unreferenced = append(unreferenced, hash)
+	}
+	rows.Close()
+
+	if _, err := tx.Exec("DELETE FROM dedup_chunks WHERE ref_count <= 0"); err != nil {
+		return nil, err
+	}
+
+	return unreferenced, tx.Commit()
+}
+
+// GetDedupStats sums the deduplicated backups of a user and the distinct
+// chunks they reference
+func (r *BackupRepository) GetDedupStats(userID uuid.UUID) (*DedupStats, error) {
+	stats := &DedupStats{}
+
+	err := r.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(b.size), 0)
+		FROM backups b
+		INNER JOIN connections c ON b.connection_id = c.id
+		WHERE c.id IN (`+connection.AccessibleConnections+`)
+		AND EXISTS (SELECT 1 FROM backup_chunks bc WHERE bc.backup_id = b.id)`,
+		userID).Scan(&stats.Backups, &stats.LogicalSize)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(dc.stored_size), 0)
+		FROM dedup_chunks dc
+		WHERE dc.hash IN (
+			SELECT bc.chunk_hash
+			FROM backup_chunks bc
+			INNER JOIN backups b ON bc.backup_id = b.id
+			INNER JOIN connections c ON b.connection_id = c.id
+			WHERE c.id IN (`+connection.AccessibleConnections+`)
+		)`,
+		userID).Scan(&stats.Chunks, &stats.StoredSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if stats.StoredSize > 0 {
+		stats.Ratio = float64(stats.LogicalSize) / float64(stats.StoredSize)
+	}
+	return stats, nil
+}
+
+func (r *BackupRepository) CreateArtifactAccess(a *ArtifactAccess) error {
+	_, err := r.db.Exec(`
+		INSERT INTO backup_access_log (
+			id, backup_id, connection_id, action, detail, selection, user_id, username,
+			impersonator, remote_addr, forwarded_for, user_agent, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		a.ID, a.BackupID, a.ConnectionID, a.Action, a.Detail, a.Selection, a.UserID, a.Username,
+		a.Impersonator, a.RemoteAddr, a.ForwardedFor, a.UserAgent, a.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+const artifactAccessColumns = `
+	id, backup_id, connection_id, action, detail, selection, user_id, username,
+	impersonator, remote_addr, forwarded_for, user_agent, created_at`
+
+func (r *BackupRepository) GetBackupAccesses(backupID string, limit int) ([]*ArtifactAccess, error) {
+	rows, err := r.db.Query(`SELECT `+artifactAccessColumns+`
+		FROM backup_access_log
+		WHERE backup_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, backupID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanArtifactAccesses(rows)
+}
+
+func (r *BackupRepository) GetConnectionAccesses(connectionID string, limit int) ([]*ArtifactAccess, error) {
+	rows, err := r.db.Query(`SELECT `+artifactAccessColumns+`
+		FROM backup_access_log
+		WHERE connection_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, connectionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanArtifactAccesses(rows)
+}
+
+func scanArtifactAccesses(rows *sql.Rows) ([]*ArtifactAccess, error) {
+	defer rows.Close()
+
+	accesses := []*ArtifactAccess{}
+	for rows.Next() {
+		a := &ArtifactAccess{}
+		var createdAt string
+		err := rows.Scan(&a.ID, &a.BackupID, &a.ConnectionID, &a.Action, &a.Detail, &a.Selection, &a.UserID, &a.Username,
+			&a.Impersonator, &a.RemoteAddr, &a.ForwardedFor, &a.UserAgent, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		if a.CreatedAt, err = common.ParseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("error parsing created_at: %v", err)
+		}
+		accesses = append(accesses, a)
+	}
+	return accesses, rows.Err()
+}
+
+// Artifact export methods
+
+// CreateArtifactExport saves an export with the artifacts it covers
+func (r *BackupRepository) CreateArtifactExport(e *ArtifactExport) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO artifact_exports (
+			id, connection_id, destination, filter, bandwidth_limit_kbps, status,
+			error, attempts, created_by, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, NULL, 0, $7, $8, $9)`,
+		e.ID, e.ConnectionID, e.Destination, e.Filter, e.BandwidthLimitKBps, e.Status,
+		e.CreatedBy, e.CreatedAt.Format(time.RFC3339), e.UpdatedAt.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	for _, item := range e.Items {
+		_, err := tx.Exec(`
+			INSERT INTO artifact_export_items (export_id, backup_id, file_name, status, size)
+			VALUES ($1, $2, $3, $4, $5)`,
+			e.ID, item.BackupID, item.FileName, item.Status, item.Size)
+		if err != nil {
+			return fmt.Errorf("failed to save export item: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UpdateArtifactExport saves the state of an export
+func (r *BackupRepository) UpdateArtifactExport(e *ArtifactExport) error {
+	var completedAt *string
+	if e.CompletedAt != nil {
+		formatted := e.CompletedAt.Format(time.RFC3339)
+		completedAt = &formatted
+	}
+	_, err := r.db.Exec(`
+		UPDATE artifact_exports
+		SET status = $1, error = $2, attempts = $3, updated_at = $4, completed_at = $5
+		WHERE id = $6`,
+		e.Status, e.Error, e.Attempts, time.Now().Format(time.RFC3339), completedAt, e.ID)
+	return err
+}
+
+// UpdateArtifactExportItem saves the outcome of exporting one artifact
+func (r *BackupRepository) UpdateArtifactExportItem(exportID string, item *ArtifactExportItem) error {
+	var exportedAt *string
+	if item.ExportedAt != nil {
+		formatted := item.ExportedAt.Format(time.RFC3339)
+		exportedAt = &formatted
+	}
+	_, err := r.db.Exec(`
+		UPDATE artifact_export_items
+		SET status = $1, size = $2, checksum = $3, location = $4, error = $5, exported_at = $6
+		WHERE export_id = $7 AND backup_id = $8`,
+		item.Status, item.Size, item.Checksum, item.Location, item.Error, exportedAt, exportID, item.BackupID)
+	return err
+}
+
+const artifactExportColumns = `id, connection_id, destination, filter, bandwidth_limit_kbps, status,
+	error, attempts, created_by, created_at, updated_at, completed_at`
+
+func scanArtifactExport(row rowScanner) (*ArtifactExport, error) {
+	var (
+		errorStr     sql.NullString
+		createdAtStr string
+		updatedAtStr string
+		completedAt  sql.NullString
+	)
+	e := &ArtifactExport{}
+	err := row.Scan(&e.ID, &e.ConnectionID, &e.Destination, &e.Filter, &e.BandwidthLimitKBps, &e.Status,
+		&errorStr, &e.Attempts, &e.CreatedBy, &createdAtStr, &updatedAtStr, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	if errorStr.Valid {
+		e.Error = &errorStr.String
+	}
+
+	if e.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	if e.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+	if completedAt.Valid {
+		t, err := common.ParseTime(completedAt.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing completed_at: %v", err)
+		}
+		e.CompletedAt = &t
+	}
+
+	return e, nil
+}
+
+// GetArtifactExport returns an export with its items
+func (r *BackupRepository) GetArtifactExport(id string) (*ArtifactExport, error) {
+	e, err := scanArtifactExport(r.db.QueryRow(`
+		SELECT `+artifactExportColumns+`
+		FROM artifact_exports WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT backup_id, file_name, status, size, checksum, location, error, exported_at
+		FROM artifact_export_items
+		WHERE export_id = $1
+		ORDER BY rowid`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	e.Items = []*ArtifactExportItem{}
+	for rows.Next() {
+		item := &ArtifactExportItem{}
+		var exportedAt sql.NullString
+		if err := rows.Scan(&item.BackupID, &item.FileName, &item.Status, &item.Size, &item.Checksum,
+			&item.Location, &item.Error, &exportedAt); err != nil {
+			return nil, err
+		}
+		if exportedAt.Valid {
+			t, err := common.ParseTime(exportedAt.String)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing exported_at: %v", err)
+			}
+			item.ExportedAt = &t
+		}
+		e.Items = append(e.Items, item)
+	}
+
+	return e, rows.Err()
+}
+
+// GetArtifactExports lists exports, newest first, without their items. An
+// empty status lists all of them.
+func (r *BackupRepository) GetArtifactExports(statuses ...string) ([]*ArtifactExport, error) {
+	query := `SELECT ` + artifactExportColumns + ` FROM artifact_exports`
+	var args []interface{}
+	if len(statuses) > 0 {
+		placeholders := make([]string, len(statuses))
+		for i, status := range statuses {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+			args = append(args, status)
+		}
+		query += ` WHERE status IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []*ArtifactExport{}
+	for rows.Next() {
+		e, err := scanArtifactExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, e)
+	}
+
+	return exports, rows.Err()
+}
+
+// Restore sandbox methods
+
+// CreateRestoreSandbox saves a new sandbox with its encrypted password
+func (r *BackupRepository) CreateRestoreSandbox(s *RestoreSandbox, encryptedPassword string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO restore_sandboxes (
+			id, user_id, backup_id, connection_id, database_type, image, status,
+			username, password, database_name, expires_at, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		s.ID, s.UserID, s.BackupID, s.ConnectionID, s.DatabaseType, s.Image, s.Status,
+		s.Username, encryptedPassword, s.DatabaseName, s.ExpiresAt.Format(time.RFC3339),
+		s.CreatedAt.Format(time.RFC3339), s.UpdatedAt.Format(time.RFC3339))
+	return err
+}
+
+// UpdateRestoreSandbox saves the state and container of a sandbox. Its
+// password is written only when the sandbox is created.
+func (r *BackupRepository) UpdateRestoreSandbox(s *RestoreSandbox) error {
+	s.UpdatedAt = time.Now()
+	_, err := r.db.Exec(`
+		UPDATE restore_sandboxes
+		SET container_id = $1, status = $2, host = $3, port = $4, error = $5, updated_at = $6
+		WHERE id = $7`,
+		s.ContainerID, s.Status, s.Host, s.Port, s.Error, s.UpdatedAt.Format(time.RFC3339), s.ID)
+	return err
+}
+
+const restoreSandboxColumns = `id, user_id, backup_id, connection_id, database_type, image, container_id,
+	status, host, port, username, password, database_name, error, expires_at, created_at, updated_at`
+
+func scanRestoreSandbox(row rowScanner) (*RestoreSandbox, error) {
+	var (
+		containerID  sql.NullString
+		host         sql.NullString
+		port         sql.NullInt64
+		username     sql.NullString
+		password     sql.NullString
+		errorStr     sql.NullString
+		expiresAtStr string
+		createdAtStr string
+		updatedAtStr string
+	)
+	s := &RestoreSandbox{}
+	err := row.Scan(&s.ID, &s.UserID, &s.BackupID, &s.ConnectionID, &s.DatabaseType, &s.Image, &containerID,
+		&s.Status, &host, &port, &username, &password, &s.DatabaseName, &errorStr,
+		&expiresAtStr, &createdAtStr, &updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+	if containerID.Valid {
+		s.ContainerID = &containerID.String
+	}
+	if errorStr.Valid {
+		s.Error = &errorStr.String
+	}
+	s.Host = host.String
+	s.Port = int(port.Int64)
+	s.Username = username.String
+	s.Password = password.String
+
+	if s.ExpiresAt, err = common.ParseTime(expiresAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing expires_at: %v", err)
+	}
+	if s.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	if s.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+
+	return s, nil
+}
+
+// GetRestoreSandbox returns a sandbox with its encrypted password
+func (r *BackupRepository) GetRestoreSandbox(id string) (*RestoreSandbox, error) {
+	return scanRestoreSandbox(r.db.QueryRow(`
+		SELECT `+restoreSandboxColumns+`
+		FROM restore_sandboxes WHERE id = $1`, id))
+}
+
+// GetRestoreSandboxes lists sandboxes, newest first, of one user or of all
+// users when userID is nil. An empty status lists all of them.
+func (r *BackupRepository) GetRestoreSandboxes(userID *uuid.UUID, statuses ...string) ([]*RestoreSandbox, error) {
+	query := `SELECT ` + restoreSandboxColumns + ` FROM restore_sandboxes`
+	var conditions []string
+	var args []interface{}
+	if userID != nil {
+		args = append(args, *userID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if len(statuses) > 0 {
+		placeholders := make([]string, len(statuses))
+		for i, status := range statuses {
+			args = append(args, status)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conditions = append(conditions, `status IN (`+strings.Join(placeholders, ", ")+`)`)
+	}
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sandboxes := []*RestoreSandbox{}
+	for rows.Next() {
+		s, err := scanRestoreSandbox(rows)
+		if err != nil {
+			return nil, err
+		}
+		sandboxes = append(sandboxes, s)
+	}
+
+	return sandboxes, rows.Err()
+}
+
+// CountActiveRestoreSandboxes counts the user's sandboxes that still have a
+// container
+func (r *BackupRepository) CountActiveRestoreSandboxes(userID uuid.UUID) (int, error) {
+	var count int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM restore_sandboxes
+		WHERE user_id = $1 AND status IN ($2, $3, $4)`,
+		userID, SandboxStarting, SandboxRestoring, SandboxReady).Scan(&count)
+	return count, err
+}
+
+// Dump import methods
+
+// CreateDumpImport saves a new upload
+func (r *BackupRepository) CreateDumpImport(imp *DumpImport) error {
+	_, err := r.db.Exec(`
+		INSERT INTO dump_imports (
+			id, user_id, connection_id, file_name, size, received, checksum,
+			database_name, status, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		imp.ID, imp.UserID, imp.ConnectionID, imp.FileName, imp.Size, imp.Received, imp.Checksum,
+		imp.DatabaseName, imp.Status, imp.CreatedAt.Format(time.RFC3339), imp.UpdatedAt.Format(time.RFC3339))
+	return err
+}
+
+// UpdateDumpImport saves the progress and outcome of an upload
+func (r *BackupRepository) UpdateDumpImport(imp *DumpImport) error {
+	imp.UpdatedAt = time.Now()
+	_, err := r.db.Exec(`
+		UPDATE dump_imports
+		SET size = $1, received = $2, status = $3, format = $4, backup_id = $5, error = $6, updated_at = $7
+		WHERE id = $8`,
+		imp.Size, imp.Received, imp.Status, imp.Format, imp.BackupID, imp.Error,
+		imp.UpdatedAt.Format(time.RFC3339), imp.ID)
+	return err
+}
+
+const dumpImportColumns = `id, user_id, connection_id, file_name, size, received, checksum,
+	database_name, status, format, backup_id, error, created_at, updated_at`
+
+func scanDumpImport(row rowScanner) (*DumpImport, error) {
+	var (
+		checksum     sql.NullString
+		databaseName sql.NullString
+		format       sql.NullString
+		backupID     sql.NullString
+		errorStr     sql.NullString
+		createdAtStr string
+		updatedAtStr string
+	)
+	imp := &DumpImport{}
+	err := row.Scan(&imp.ID, &imp.UserID, &imp.ConnectionID, &imp.FileName, &imp.Size, &imp.Received, &checksum,
+		&databaseName, &imp.Status, &format, &backupID, &errorStr, &createdAtStr, &updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+	if checksum.Valid {
+		imp.Checksum = &checksum.String
+	}
+	if databaseName.Valid {
+		imp.DatabaseName = &databaseName.String
+	}
+	if format.Valid {
+		imp.Format = &format.String
+	}
+	if backupID.Valid {
+		imp.BackupID = &backupID.String
+	}
+	if errorStr.Valid {
+		imp.Error = &errorStr.String
+	}
+
+	if imp.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	if imp.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+
+	return imp, nil
+}
+
+// GetDumpImport returns an upload
+func (r *BackupRepository) GetDumpImport(id string) (*DumpImport, error) {
+	return scanDumpImport(r.db.QueryRow(`
+		SELECT `+dumpImportColumns+`
+		FROM dump_imports WHERE id = $1`, id))
+}
+
+// GetDumpImports lists uploads, newest first, of one user or of all users
+// when userID is nil. An empty status lists all of them.
+func (r *BackupRepository) GetDumpImports(userID *uuid.UUID, statuses ...string) ([]*DumpImport, error) {
+	query := `SELECT ` + dumpImportColumns + ` FROM dump_imports`
+	var conditions []string
+	var args []interface{}
+	if userID != nil {
+		args = append(args, *userID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if len(statuses) > 0 {
+		placeholders := make([]string, len(statuses))
+		for i, status := range statuses {
+			args = append(args, status)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		conditions = append(conditions, `status IN (`+strings.Join(placeholders, ", ")+`)`)
+	}
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	imports := []*DumpImport{}
+	for rows.Next() {
+		imp, err := scanDumpImport(rows)
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, imp)
+	}
+
+	return imports, rows.Err()
+}
+
+// Restore history methods
+
+// CreateRestoreRecord saves a restore as it starts
+func (r *BackupRepository) CreateRestoreRecord(rec *RestoreRecord) error {
+	_, err := r.db.Exec(`
+		INSERT INTO restores (
+			id, user_id, username, impersonator, backup_id, source_connection_id,
+			connection_id, database_name, trigger, options, status, started_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		rec.ID, rec.UserID, rec.Username, rec.Impersonator, rec.BackupID, rec.SourceConnectionID,
+		rec.ConnectionID, rec.DatabaseName, rec.Trigger, rec.Options, rec.Status,
+		rec.StartedAt.Format(time.RFC3339))
+	return err
+}
+
+// FinishRestoreRecord saves the outcome and log of a restore
+func (r *BackupRepository) FinishRestoreRecord(rec *RestoreRecord) error {
+	var finishedAt *string
+	if rec.FinishedAt != nil {
+		formatted := rec.FinishedAt.Format(time.RFC3339)
+		finishedAt = &formatted
+	}
+	_, err := r.db.Exec(`
+		UPDATE restores
+		SET status = $1, error = $2, cleanup = $3, preserved_database = $4, created_database = $5,
+			log = $6, finished_at = $7, duration_ms = $8
+		WHERE id = $9`,
+		rec.Status, rec.Error, rec.Cleanup, rec.PreservedDatabase, rec.CreatedDatabase,
+		rec.Log, finishedAt, rec.DurationMs, rec.ID)
+	return err
+}
+
+// InterruptRunningRestores closes the restores still recorded as running and
+// returns how many there were
+func (r *BackupRepository) InterruptRunningRestores(message string) (int64, error) {
+	result, err := r.db.Exec(`
+		UPDATE restores SET status = $1, error = $2
+		WHERE status = $3`,
+		RestoreInterrupted, message, RestoreJobRunning)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const restoreRecordColumns = `id, user_id, username, impersonator, backup_id, source_connection_id,
+	connection_id, database_name, trigger, options, status, error, cleanup, preserved_database,
+	created_database, started_at, finished_at, duration_ms`
+
+// scanRestoreRecord reads a record, and its log when withLog is set and the
+// row selects it last
+func scanRestoreRecord(row rowScanner, withLog bool) (*RestoreRecord, error) {
+	var (
+		username          sql.NullString
+		impersonator      sql.NullString
+		errorStr          sql.NullString
+		cleanup           sql.NullString
+		preservedDatabase sql.NullString
+		startedAtStr      string
+		finishedAtStr     sql.NullString
+		durationMs        sql.NullInt64
+		log               sql.NullString
+	)
+	rec := &RestoreRecord{}
+	dest := []interface{}{&rec.ID, &rec.UserID, &username, &impersonator, &rec.BackupID, &rec.SourceConnectionID,
+		&rec.ConnectionID, &rec.DatabaseName, &rec.Trigger, &rec.Options, &rec.Status, &errorStr, &cleanup, &preservedDatabase,
+		&rec.CreatedDatabase, &startedAtStr, &finishedAtStr, &durationMs}
+	if withLog {
+		dest = append(dest, &log)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if username.Valid {
+		rec.Username = &username.String
+	}
+	if impersonator.Valid {
+		rec.Impersonator = &impersonator.String
+	}
+	if errorStr.Valid {
+		rec.Error = &errorStr.String
+	}
+	if cleanup.Valid {
+		rec.Cleanup = &cleanup.String
+	}
+	if preservedDatabase.Valid {
+		rec.PreservedDatabase = &preservedDatabase.String
+	}
+	if durationMs.Valid {
+		rec.DurationMs = &durationMs.Int64
+	}
+	if log.Valid {
+		rec.Log = &log.String
+	}
+
+	var err error
+	if rec.StartedAt, err = common.ParseTime(startedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing started_at: %v", err)
+	}
+	if finishedAtStr.Valid {
+		finishedAt, err := common.ParseTime(finishedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing finished_at: %v", err)
+		}
+		rec.FinishedAt = &finishedAt
+	}
+
+	return rec, nil
+}
+
+// GetRestoreRecord returns a restore with its log
+func (r *BackupRepository) GetRestoreRecord(id string) (*RestoreRecord, error) {
+	return scanRestoreRecord(r.db.QueryRow(`
+		SELECT `+restoreRecordColumns+`, log
+		FROM restores WHERE id = $1`, id), true)
+}
+
+// GetRestoreRecords lists a user's restores, newest first, without their logs
+func (r *BackupRepository) GetRestoreRecords(filter RestoreRecordFilter) ([]*RestoreRecord, error) {
+	args := []interface{}{filter.UserID}
+	conditions := []string{"user_id = $1"}
+	if filter.BackupID != "" {
+		args = append(args, filter.BackupID)
+		conditions = append(conditions, fmt.Sprintf("backup_id = $%d", len(args)))
+	}
+	if filter.ConnectionID != "" {
+		args = append(args, filter.ConnectionID)
+		conditions = append(conditions, fmt.Sprintf("connection_id = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(`SELECT `+restoreRecordColumns+`
+		FROM restores
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY started_at DESC
+		LIMIT `+fmt.Sprintf("$%d", len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*RestoreRecord{}
+	for rows.Next() {
+		rec, err := scanRestoreRecord(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+
+	return records, rows.Err()
+}
+
+// Maintenance window methods
+
+func (r *BackupRepository) CreateMaintenanceWindow(w *MaintenanceWindow) error {
+	_, err := r.db.Exec(`
+		INSERT INTO maintenance_windows (
+			id, user_id, connection_id, name, start_time, end_time, days, timezone,
+			action, enabled, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		w.ID, w.UserID, w.ConnectionID, w.Name, w.Start, w.End, joinWindowDays(w.Days), w.Timezone,
+		w.Action, w.Enabled, w.CreatedAt.Format(time.RFC3339), w.UpdatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *BackupRepository) UpdateMaintenanceWindow(w *MaintenanceWindow) error {
+	_, err := r.db.Exec(`
+		UPDATE maintenance_windows
+		SET connection_id = $1, name = $2, start_time = $3, end_time = $4, days = $5, timezone = $6,
+			action = $7, enabled = $8, updated_at = $9
+		WHERE id = $10`,
+		w.ConnectionID, w.Name, w.Start, w.End, joinWindowDays(w.Days), w.Timezone,
+		w.Action, w.Enabled, w.UpdatedAt.Format(time.RFC3339), w.ID)
+	return err
+}
+
+func (r *BackupRepository) DeleteMaintenanceWindow(id string) error {
+	_, err := r.db.Exec("DELETE FROM maintenance_windows WHERE id = $1", id)
+	return err
+}
+
+// joinWindowDays stores the weekdays of a window as a comma separated list
+func joinWindowDays(days []string) *string {
+	if len(days) == 0 {
+		return nil
+	}
+	joined := strings.Join(days, ",")
+	return &joined
+}
+
+const maintenanceWindowColumns = `id, user_id, connection_id, name, start_time, end_time, days, timezone,
+	action, enabled, created_at, updated_at`
+
+func scanMaintenanceWindow(row rowScanner) (*MaintenanceWindow, error) {
+	var (
+		connectionID sql.NullString
+		days         sql.NullString
+		timezone     sql.NullString
+		createdAtStr string
+		updatedAtStr string
+	)
+	w := &MaintenanceWindow{}
+	err := row.Scan(&w.ID, &w.UserID, &connectionID, &w.Name, &w.Start, &w.End, &days, &timezone,
+		&w.Action, &w.Enabled, &createdAtStr, &updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+	if connectionID.Valid {
+		w.ConnectionID = &connectionID.String
+	}
+	if days.Valid && days.String != "" {
+		w.Days = strings.Split(days.String, ",")
+	}
+	if timezone.Valid {
+		w.Timezone = &timezone.String
+	}
+
+	if w.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	if w.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+
+	return w, nil
+}
+
+func (r *BackupRepository) GetMaintenanceWindow(id string) (*MaintenanceWindow, error) {
+	return scanMaintenanceWindow(r.db.QueryRow(`
+		SELECT `+maintenanceWindowColumns+`
+		FROM maintenance_windows WHERE id = $1`, id))
+}
+
+// GetMaintenanceWindows lists a user's maintenance windows. Given a
+// connection, only the windows of that connection and the ones for all
+// connections are listed.
+func (r *BackupRepository) GetMaintenanceWindows(userID uuid.UUID, connectionID string) ([]*MaintenanceWindow, error) {
+	args := []interface{}{userID}
+	query := `SELECT ` + maintenanceWindowColumns + `
+		FROM maintenance_windows
+		WHERE user_id = $1`
+	if connectionID != "" {
+		args = append(args, connectionID)
+		query += ` AND (connection_id IS NULL OR connection_id = $2)`
+	}
+
+	rows, err := r.db.Query(query+` ORDER BY created_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []*MaintenanceWindow{}
+	for rows.Next() {
+		w, err := scanMaintenanceWindow(rows)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+
+	return windows, rows.Err()
+}
+
+// GetStoredArtifacts returns the artifact locations of every backup, for
+// storage reconciliation
+func (r *BackupRepository) GetStoredArtifacts() ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT id, connection_id, status, path, s3_object_key, post_processed_files
+		FROM backups`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var backups []*Backup
+	for rows.Next() {
+		backup := &Backup{}
+		if err := rows.Scan(&backup.ID, &backup.ConnectionID, &backup.Status, &backup.Path, &backup.S3ObjectKey,
+			&backup.PostProcessedFiles); err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+	return backups, rows.Err()
+}
+
+// GetConnectionOwners returns the users that have connections
+func (r *BackupRepository) GetConnectionOwners() ([]uuid.UUID, error) {
+	rows, err := r.db.Query(`SELECT DISTINCT user_id FROM connections`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []uuid.UUID
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		users = append(users, userID)
+	}
+	return users, rows.Err()
+}
+
+// ReplaceStorageFindings swaps the user's open findings for the ones of a
+// new reconciliation. Resolved findings are kept.
+func (r *BackupRepository) ReplaceStorageFindings(userID uuid.UUID, findings []*StorageFinding) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM storage_findings WHERE user_id = $1 AND resolved_at IS NULL", userID); err != nil {
+		return err
+	}
+
+	for _, f := range findings {
+		var modifiedAtStr *string
+		if f.ModifiedAt != nil {
+			str := f.ModifiedAt.Format(time.RFC3339)
+			modifiedAtStr = &str
+		}
+		_, err := tx.Exec(`
+			INSERT INTO storage_findings (
+				id, user_id, connection_id, kind, backend, location, backup_id, size, modified_at, detected_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			f.ID, f.UserID, f.ConnectionID, f.Kind, f.Backend, f.Location, f.BackupID, f.Size,
+			modifiedAtStr, f.DetectedAt.Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *BackupRepository) ResolveStorageFinding(f *StorageFinding) error {
+	var resolvedAtStr *string
+	if f.ResolvedAt != nil {
+		str := f.ResolvedAt.Format(time.RFC3339)
+		resolvedAtStr = &str
+	}
+	_, err := r.db.Exec(`
+		UPDATE storage_findings SET resolved_at = $1, resolution = $2 WHERE id = $3`,
+		resolvedAtStr, f.Resolution, f.ID)
+	return err
+}
+
+const storageFindingColumns = `id, user_id, connection_id, kind, backend, location, backup_id, size,
+	modified_at, detected_at, resolved_at, resolution`
+
+func scanStorageFinding(row rowScanner) (*StorageFinding, error) {
+	var (
+		connectionID  sql.NullString
+		backupID      sql.NullString
+		modifiedAtStr sql.NullString
+		detectedAtStr string
+		resolvedAtStr sql.NullString
+		resolution    sql.NullString
+	)
+	f := &StorageFinding{}
+	err := row.Scan(&f.ID, &f.UserID, &connectionID, &f.Kind, &f.Backend, &f.Location, &backupID, &f.Size,
+		&modifiedAtStr, &detectedAtStr, &resolvedAtStr, &resolution)
+	if err != nil {
+		return nil, err
+	}
+	if connectionID.Valid {
+		f.ConnectionID = &connectionID.String
+	}
+	if backupID.Valid {
+		f.BackupID = &backupID.String
+	}
+	if resolution.Valid {
+		f.Resolution = &resolution.String
+	}
+
+	if modifiedAtStr.Valid {
+		modifiedAt, err := common.ParseTime(modifiedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing modified_at: %v", err)
+		}
+		f.ModifiedAt = &modifiedAt
+	}
+	if f.DetectedAt, err = common.ParseTime(detectedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing detected_at: %v", err)
+	}
+	if resolvedAtStr.Valid {
+		resolvedAt, err := common.ParseTime(resolvedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing resolved_at: %v", err)
+		}
+		f.ResolvedAt = &resolvedAt
+	}
+
+	return f, nil
+}
+
+func (r *BackupRepository) GetStorageFinding(id string) (*StorageFinding, error) {
+	return scanStorageFinding(r.db.QueryRow(`
+		SELECT `+storageFindingColumns+`
+		FROM storage_findings WHERE id = $1`, id))
+}
+
+// GetStorageFindings lists the user's findings, newest first. Only open
+// findings are listed unless includeResolved is set.
+func (r *BackupRepository) GetStorageFindings(userID uuid.UUID, includeResolved bool) ([]*StorageFinding, error) {
+	query := `SELECT ` + storageFindingColumns + `
+		FROM storage_findings
+		WHERE user_id = $1`
+	if !includeResolved {
+		query += ` AND resolved_at IS NULL`
+	}
+
+	rows, err := r.db.Query(query+` ORDER BY detected_at DESC, location`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	findings := []*StorageFinding{}
+	for rows.Next() {
+		f, err := scanStorageFinding(rows)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+
+	return findings, rows.Err()
+}
+
+func (r *BackupRepository) CreateIncident(incident *Incident) error {
+	_, err := r.db.Exec(`
+		INSERT INTO incidents (id, user_id, connection_id, kind, dedup_key, summary, triggered_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		incident.ID, incident.UserID, incident.ConnectionID, incident.Kind, incident.DedupKey,
+		incident.Summary, incident.TriggeredAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *BackupRepository) ResolveIncident(incident *Incident) error {
+	var resolvedAtStr *string
+	if incident.ResolvedAt != nil {
+		str := incident.ResolvedAt.Format(time.RFC3339)
+		resolvedAtStr = &str
+	}
+	_, err := r.db.Exec("UPDATE incidents SET resolved_at = $1 WHERE id = $2", resolvedAtStr, incident.ID)
+	return err
+}
+
+const incidentColumns = `id, user_id, connection_id, kind, dedup_key, summary, triggered_at, resolved_at`
+
+func scanIncident(row rowScanner) (*Incident, error) {
+	var triggeredAtStr string
+	var resolvedAtStr sql.NullString
+	incident := &Incident{}
+	err := row.Scan(&incident.ID, &incident.UserID, &incident.ConnectionID, &incident.Kind, &incident.DedupKey,
+		&incident.Summary, &triggeredAtStr, &resolvedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if incident.TriggeredAt, err = common.ParseTime(triggeredAtStr); err != nil {
+		return nil, err
+	}
+	if resolvedAtStr.Valid {
+		resolvedAt, err := common.ParseTime(resolvedAtStr.String)
+		if err != nil {
+			return nil, err
+		}
+		incident.ResolvedAt = &resolvedAt
+	}
+	return incident, nil
+}
+
+// GetOpenIncidents returns the unresolved incidents of a connection
+func (r *BackupRepository) GetOpenIncidents(connectionID string) ([]*Incident, error) {
+	rows, err := r.db.Query(`
+		SELECT `+incidentColumns+`
+		FROM incidents
+		WHERE connection_id = $1 AND resolved_at IS NULL
+		ORDER BY triggered_at`, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []*Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, rows.Err()
+}
+
+// GetIncidents lists the user's incidents, newest first. Only open incidents
+// are listed unless includeResolved is set.
+func (r *BackupRepository) GetIncidents(userID uuid.UUID, includeResolved bool) ([]*Incident, error) {
+	query := `SELECT ` + incidentColumns + `
+		FROM incidents
+		WHERE user_id = $1`
+	if !includeResolved {
+		query += ` AND resolved_at IS NULL`
+	}
+
+	rows, err := r.db.Query(query+` ORDER BY triggered_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []*Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, incident)
+	}
+	return incidents, rows.Err()
+}
+
+// SaveBadgeToken sets the hash of a connection's badge token, replacing the
+// previous token
+func (r *BackupRepository) SaveBadgeToken(connectionID, tokenHash string, createdAt time.Time) error {
+	_, err := r.db.Exec(`
+		INSERT INTO badge_tokens (connection_id, token_hash, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (connection_id) DO UPDATE SET token_hash = excluded.token_hash, created_at = excluded.created_at`,
+		connectionID, tokenHash, createdAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+// GetBadgeToken returns the hash of a connection's badge token and when it
+// was issued
+func (r *BackupRepository) GetBadgeToken(connectionID string) (string, time.Time, error) {
+	var tokenHash, createdAtStr string
+	err := r.db.QueryRow(`SELECT token_hash, created_at FROM badge_tokens WHERE connection_id = $1`, connectionID).
+		Scan(&tokenHash, &createdAtStr)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	createdAt, err := common.ParseTime(createdAtStr)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenHash, createdAt, nil
+}
+
+func (r *BackupRepository) DeleteBadgeToken(connectionID string) error {
+	_, err := r.db.Exec(`DELETE FROM badge_tokens WHERE connection_id = $1`, connectionID)
+	return err
+}
+
+// GetLatestFinishedBackupRun returns the newest finished run of a connection
+func (r *BackupRepository) GetLatestFinishedBackupRun(connectionID string) (*BackupRun, error) {
+	row := r.db.QueryRow(`
+		SELECT `+backupRunColumns+`
+		FROM backup_runs
+		WHERE connection_id = $1 AND completed_time IS NOT NULL
+		ORDER BY started_time DESC LIMIT 1`,
+		connectionID)
+	return scanBackupRun(row)
+}
+
+// MarkBackupSuspect records why a backup's size makes it suspect
+func (r *BackupRepository) MarkBackupSuspect(backupID, reason string) error {
+	_, err := r.db.Exec(`
+		UPDATE backups
+		SET suspect = 1, suspect_reason = $1, updated_at = $2
+		WHERE id = $3`,
+		reason, time.Now().Format(time.RFC3339), backupID)
+	return err
+}
+
+// GetRecentBackupSizes returns the sizes of the latest completed backups of
+// a connection's database created before the given time, newest first.
+// Suspect backups are left out, so one broken dump doesn't skew the average.
+func (r *BackupRepository) GetRecentBackupSizes(connectionID string, databaseName *string, before time.Time, limit int) ([]int64, error) {
+	rows, err := r.db.Query(`
+		SELECT size
+		FROM backups
+		WHERE connection_id = $1
+		AND database_name IS $2
+		AND status = 'completed'
+		AND suspect = 0
+		AND size > 0
+		AND created_at < $3
+		ORDER BY created_at DESC
+		LIMIT $4`,
+		connectionID, databaseName, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sizes := []int64{}
+	for rows.Next() {
+		var size int64
+		if err := rows.Scan(&size); err != nil {
+			return nil, err
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, rows.Err()
+}
+
+// GetSizeHistory returns the latest completed backups of a connection,
+// newest first
+func (r *BackupRepository) GetSizeHistory(connectionID string, limit int) ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE connection_id = $1 AND status = 'completed'
+		ORDER BY created_at DESC
+		LIMIT $2`,
+		connectionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	backups := []*Backup{}
+	for rows.Next() {
+		backup, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+	return backups, rows.Err()
+}
+
+const runLogColumns = `id, kind, connection_id, lines, size, compressed_size, truncated, started_at, finished_at`
+
+func scanRunLog(row rowScanner) (*RunLog, error) {
+	var startedAtStr, finishedAtStr string
+	runLog := &RunLog{}
+	err := row.Scan(&runLog.ID, &runLog.Kind, &runLog.ConnectionID, &runLog.Lines, &runLog.Size,
+		&runLog.CompressedSize, &runLog.Truncated, &startedAtStr, &finishedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if runLog.StartedAt, err = common.ParseTime(startedAtStr); err != nil {
+		return nil, fmt.Errorf("error parsing started_at: %v", err)
+	}
+	finishedAt, err := common.ParseTime(finishedAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing finished_at: %v", err)
+	}
+	runLog.FinishedAt = &finishedAt
+	return runLog, nil
+}
+
+func (r *BackupRepository) CreateRunLog(runLog *RunLog) error {
+	_, err := r.db.Exec(`
+		INSERT INTO run_logs (`+runLogColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		runLog.ID, runLog.Kind, runLog.ConnectionID, runLog.Lines, runLog.Size, runLog.CompressedSize,
+		runLog.Truncated, runLog.StartedAt.UTC().Format(time.RFC3339), runLog.FinishedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (r *BackupRepository) GetRunLog(id string) (*RunLog, error) {
+	return scanRunLog(r.db.QueryRow(`SELECT `+runLogColumns+` FROM run_logs WHERE id = $1`, id))
+}
+
+// GetRunLogs returns a page of the run logs of the user's connections,
+// newest first, with the number of matching logs. Empty filters match all.
+func (r *BackupRepository) GetRunLogs(userID uuid.UUID, connectionID, kind string, limit, offset int) ([]*RunLog, int, error) {
+	where := `WHERE connection_id IN (` + connection.AccessibleConnections + `)
+		AND ($2 = '' OR connection_id = $2)
+		AND ($3 = '' OR kind = $3)`
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM run_logs `+where, userID, connectionID, kind).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+runLogColumns+`
+		FROM run_logs `+where+`
+		ORDER BY started_at DESC
+		LIMIT $4 OFFSET $5`,
+		userID, connectionID, kind, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	runLogs := []*RunLog{}
+	for rows.Next() {
+		runLog, err := scanRunLog(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		runLogs = append(runLogs, runLog)
+	}
+	return runLogs, total, rows.Err()
+}
+
+// DeleteRunLogsBefore removes the run logs finished before cutoff and
+// returns their IDs
+func (r *BackupRepository) DeleteRunLogsBefore(cutoff time.Time) ([]string, error) {
+	rows, err := r.db.Query(`DELETE FROM run_logs WHERE finished_at < $1 RETURNING id`, cutoff.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetSuccessfulRunTimes returns when the runs of a connection that made
+// backups completed, oldest first
+func (r *BackupRepository) GetSuccessfulRunTimes(connectionID string) ([]time.Time, error) {
+	rows, err := r.db.Query(`
+		SELECT completed_time FROM backup_runs
+		WHERE connection_id = $1 AND status IN ($2, $3) AND completed_time IS NOT NULL`,
+		connectionID, RunStatusSuccess, RunStatusPartial)
+	if err != nil {
+		return nil, err
+	}
+	return scanSortedTimes(rows)
+}
+
+// GetPassedVerificationTimes returns when the restore verifications of a
+// connection's backups passed, oldest first. Verifications of backups removed
+// since count as well.
+func (r *BackupRepository) GetPassedVerificationTimes(connectionID string) ([]time.Time, error) {
+	rows, err := r.db.Query(`
+		SELECT completed_at FROM backup_restore_verifications
+		WHERE status = $1 AND completed_at IS NOT NULL
+		AND backup_id IN (
+			SELECT id FROM backups WHERE connection_id = $2
+			UNION SELECT backup_id FROM backup_deletions WHERE connection_id = $2
+		)`,
+		RestoreVerificationPassed, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	return scanSortedTimes(rows)
+}
+
+// scanSortedTimes reads a column of timestamps. They are sorted after
+// parsing, as their offsets may differ.
+func scanSortedTimes(rows *sql.Rows) ([]time.Time, error) {
+	defer rows.Close()
+
+	times := []time.Time{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		t, err := common.ParseTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing time: %v", err)
+		}
+		times = append(times, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times, nil
+}
@@ -1,7 +1,10 @@
 package backup
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -9,11 +12,39 @@ import (
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/events"
+	"github.com/dendianugerah/velld/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type RestoreRequest struct {
 	BackupID     string `json:"backup_id"`
 	ConnectionID string `json:"connection_id"`
+	// Selection limits the restore to some tables of a PostgreSQL archive or
+	// collections of a MongoDB archive
+	Selection *RestoreSelection `json:"selection,omitempty"`
+	// OnConflict decides what happens to a target database that is not
+	// empty: abort (default), overwrite, or rename to keep it
+	OnConflict string `json:"on_conflict,omitempty"`
+	// DatabaseName restores the backup under another name on the
+	// connection's server, such as app_prod as app_prod_2024_01_01. The
+	// database is created if the server lacks it.
+	DatabaseName string `json:"database_name,omitempty"`
+	// DryRun previews the restore without changing the target
+	DryRun bool `json:"dry_run"`
+}
+
+type RestoreResult struct {
+	// PreservedDatabase holds the previous contents of a renamed target
+	PreservedDatabase string `json:"preserved_database,omitempty"`
+	// CreatedDatabase is set when the target database was created for the
+	// restore
+	CreatedDatabase bool `json:"created_database,omitempty"`
+	// Warnings are the version mismatches between the backup's manifest and
+	// the target
+	Warnings []string `json:"warnings,omitempty"`
+	// JobID is the restore job that tracked the restore's progress
+	JobID string `json:"job_id,omitempty"`
 }
 
 var restoreTools = map[string]string{
@@ -23,40 +54,213 @@ var restoreTools = map[string]string{
 	"mongodb":    "mongorestore",
 }
 
-// RestoreBackup restores a backup to a target database connection
-func (s *BackupService) RestoreBackup(backupID string, connectionID string) error {
-	backup, err := s.backupRepo.GetBackup(backupID)
+// restoreOptions adjust how a backup is restored into its target
+type restoreOptions struct {
+	// selection restores only part of a PostgreSQL or MongoDB archive
+	selection *RestoreSelection
+	// onConflict decides what happens to a target that is not empty
+	onConflict string
+	// createDatabase creates the target database if the server lacks it
+	createDatabase bool
+	// portable leaves out the owners, privileges and definers of the source
+	// server, whose roles and users the target may not have
+	portable bool
+	// origin is who started the restore and how, for its record
+	origin restoreOrigin
+}
+
+// RestoreBackup restores a backup to a target database connection. A
+// selection restores only part of a PostgreSQL or MongoDB archive. Targets
+// that are not empty are only restored over as onConflict allows.
+func (s *BackupService) RestoreBackup(req *RestoreRequest, access *ArtifactAccess) (*RestoreResult, error) {
+	backup, err := s.backupRepo.GetBackup(req.BackupID)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get backup: %v", err)
+		return nil, fmt.Errorf("failed to get backup: %v", err)
+	}
+	if _, err := s.accessibleConnection(backup.ConnectionID, access.UserID); err != nil {
+		return nil, err
 	}
 
-	conn, err := s.connStorage.GetConnection(connectionID)
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get connection: %v", err)
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, access.UserID) {
+		return nil, sql.ErrNoRows
+	}
+
+	if err := renameRestoreTarget(conn, req.DatabaseName); err != nil {
+		return nil, err
 	}
 
-	// Ensure backup file is available (local or download from S3)
-	filePath, isTemp, err := s.ensureBackupFileAvailable(backup, conn.UserID)
+	return s.restoreInto(backup, conn, restoreOptions{
+		selection:      req.Selection,
+		onConflict:     req.OnConflict,
+		createDatabase: req.DatabaseName != "",
+		origin:         restoreOrigin{trigger: RestoreTriggerRequest, access: access},
+	})
+}
+
+// restoreInto restores a backup into the database of conn. Its progress is
+// tracked as a restore job, which can be cancelled while it runs, and the
+// attempt is kept in the restore history.
+func (s *BackupService) restoreInto(backup *Backup, conn *connection.StoredConnection, options restoreOptions) (*RestoreResult, error) {
+	record := s.beginRestoreRecord(backup, conn, options)
+	result, job, err := s.trackRestore(record.ID.String(), backup, conn, options)
+	s.finishRestoreRecord(record, job, result, err)
+	return result, err
+}
+
+// trackRestore runs a restore for restoreInto as a job with the ID of its
+// record. No job is returned for a restore rejected before it started.
+func (s *BackupService) trackRestore(id string, backup *Backup, conn *connection.StoredConnection, options restoreOptions) (*RestoreResult, *restoreJob, error) {
+	mode, err := validateRestoreConflict(options.onConflict)
 	if err != nil {
+		return nil, nil, err
+	}
+
+	if isGPGEncrypted(backup) {
+		return nil, nil, fmt.Errorf("backup is encrypted for GPG key %s and cannot be restored by velld. Decrypt it with the private key and restore it manually", *backup.EncryptionKeyFingerprint)
+	}
+
+	if isPhysicalBackup(plainDumpPath(backup)) {
+		return nil, nil, fmt.Errorf("physical backups replace a whole server's data directory and cannot be restored into a database. See the backup's restore steps")
+	}
+
+	// The restore tool's output can be tailed while it runs
+	processes := newProcessTracker()
+	processes.log = s.beginLiveLog(id, LiveLogRestore, conn.ID)
+	defer s.endLiveLog(processes.log)
+	ctx, span := telemetry.StartSpan(context.Background(), "restore.run", append(databaseAttributes(conn, conn.DatabaseName),
+		attribute.String("velld.restore.id", id),
+		attribute.String("velld.backup.id", backup.ID.String()))...)
+	processes.ctx = ctx
+	processes.meter = s.beginProgress(id, LiveLogRestore, conn.ID)
+	processes.meter.setPhase(ProgressPhaseStarting, "")
+	job := s.beginRestoreJob(backup, conn, processes)
+	s.publishRestoreEvent(events.TypeRestoreStarted, conn, job.describe())
+
+	// Cleanup after a cancel connects on its own, so it needs the target
+	// before an SSH tunnel rewrites it
+	target := *conn
+	result, err := s.runRestore(backup, conn, mode, options, job)
+	err = s.endRestoreJob(job, target, err)
+	s.endProgress(processes.meter, job.describe().Status)
+	s.publishRestoreEvent(events.TypeRestoreFinished, &target, job.describe())
+	telemetry.EndSpan(span, err)
+	if result != nil {
+		result.JobID = job.info.ID
+	}
+	return result, job, err
+}
+
+// runRestore carries out a restore for restoreInto
+func (s *BackupService) runRestore(backup *Backup, conn *connection.StoredConnection, mode string, options restoreOptions, job *restoreJob) (*RestoreResult, error) {
+	selection := options.selection
+	processes := job.processes
+
+	// The artifact is stored with the backup's own connection, which need
+	// not be the target or belong to the same user
+	source, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection of backup: %v", err)
+	}
+
+	// Ensure backup file is available (local or download from S3, decompressed)
+	var filePath string
+	var isTemp bool
+	err = processes.traceStage("restore.fetch", func() error {
+		var err error
+		filePath, isTemp, err = s.ensureBackupContentAvailable(backup, source.UserID)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Clean up temp file after restore if needed
 	if isTemp {
 		defer func() {
 			if err := os.Remove(filePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp file %s: %v\n", filePath, err)
+				slog.WarnContext(processes.jobContext(), "Failed to remove temp file", "path", filePath, "error", err)
 			}
 		}()
 	}
 
 	if err := s.verifyRestoreTools(conn.Type); err != nil {
+		return nil, err
+	}
+
+	if err := validateRestoreSelection(selection, conn.Type, filePath); err != nil {
+		return nil, err
+	}
+
+	// MongoDB oplog archives replay the whole deployment under its own names
+	if isMongoOplogArchive(filePath) && backup.DatabaseName != nil && *backup.DatabaseName != conn.DatabaseName {
+		return nil, &RestoreTargetError{Reason: "oplog archives cover the whole deployment and cannot be restored under another database name"}
+	}
+
+	// A restore cancelled while its backup was fetched stops before it
+	// changes the target
+	if job.cancelled.Load() {
+		return nil, errRunCancelled
+	}
+	job.markTouched()
+
+	// Created and checked before the tunnel is set up, since the connection
+	// manager opens its own
+	var created bool
+	if options.createDatabase && s.connService != nil {
+		if created, err = s.connService.EnsureDatabase(conn); err != nil {
+			return nil, fmt.Errorf("failed to create target database '%s': %v", conn.DatabaseName, err)
+		}
+		if created {
+			slog.InfoContext(processes.jobContext(), "Created database for restore", "database", conn.DatabaseName, "connection_id", conn.ID)
+		}
+	}
+
+	var preserved string
+	err = processes.traceStage("restore.prepare", func() error {
+		var err error
+		preserved, err = s.prepareRestoreTarget(conn, mode)
 		return err
+	}, attribute.String("velld.restore.conflict", mode))
+	if err != nil {
+		return nil, err
+	}
+	result := &RestoreResult{PreservedDatabase: preserved, CreatedDatabase: created}
+
+	result.Warnings = s.restoreWarnings(backup, conn)
+	for _, warning := range result.Warnings {
+		slog.WarnContext(processes.jobContext(), "Restoring backup with a warning", "backup_id", backup.ID, "warning", warning)
+		fmt.Fprintf(processes.log, "Warning: %s\n", warning)
+	}
+
+	var filters []dumpFilter
+	if options.portable {
+		filters = append(filters, portableDumpFilter(conn.Type, filePath))
+	}
+	if restoresUnderNewName(backup, conn) {
+		filters = append(filters, renameDumpFilter(conn.Type, filePath, conn.DatabaseName))
+	}
+	rewrittenPath, err := rewriteDumpCopy(filePath, filters...)
+	if err != nil {
+		return result, err
+	}
+	if rewrittenPath != "" {
+		defer os.Remove(rewrittenPath)
+		filePath = rewrittenPath
 	}
 
 	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(conn)
 	if err != nil {
-		return fmt.Errorf("failed to setup SSH tunnel: %v", err)
+		return result, fmt.Errorf("failed to setup SSH tunnel: %v", err)
 	}
 	if tunnel != nil {
 		defer tunnel.Stop()
@@ -64,24 +268,46 @@ func (s *BackupService) RestoreBackup(backupID string, connectionID string) erro
 		conn.Port = effectivePort
 	}
 
+	processes.meter.setPhase(ProgressPhaseRestore, "")
+	processes.meter.trackRestore(job)
+
 	var cmd *exec.Cmd
 	switch conn.Type {
 	case "postgresql":
+		if isDirectoryDump(filePath) {
+			return result, s.restoreDirectoryDump(conn, filePath, selection, options.portable, processes)
+		}
+		if isCustomDump(filePath) {
+			return result, s.restoreCustomDump(conn, filePath, selection, options.portable, processes)
+		}
 		cmd = s.createPsqlRestoreCmd(conn, filePath)
+		job.setTransactional()
 	case "mysql", "mariadb":
 		cmd = s.createMySQLRestoreCmd(conn, filePath)
 	case "mongodb":
 		cmd = s.createMongoRestoreCmd(conn, filePath)
+		if !selection.isEmpty() {
+			if backup.DatabaseName == nil {
+				return result, fmt.Errorf("backup does not record the database its collections belong to")
+			}
+			applyMongoRestoreSelection(cmd, *backup.DatabaseName, selection)
+		}
 	default:
-		return fmt.Errorf("unsupported database type for restore: %s", conn.Type)
+		return result, fmt.Errorf("unsupported database type for restore: %s", conn.Type)
 	}
 
 	if cmd == nil {
-		return fmt.Errorf("restore tool not found for %s. Please ensure %s is installed", conn.Type, restoreTools[conn.Type])
+		return result, fmt.Errorf("restore tool not found for %s. Please ensure %s is installed", conn.Type, restoreTools[conn.Type])
+	}
+
+	// Tools that read the dump from stdin report progress by the bytes read
+	if input, ok := cmd.Stdin.(*os.File); ok {
+		defer input.Close()
+		cmd.Stdin = job.trackInput(input)
 	}
 
-	output, err := cmd.CombinedOutput()
-	return s.validateRestoreOutput(conn.Type, conn.DatabaseName, output, err)
+	output, err := processes.combinedOutput(cmd)
+	return result, s.validateRestoreOutput(conn.Type, conn.DatabaseName, output, err)
 }
 
 func (s *BackupService) validateRestoreOutput(dbType, dbName string, output []byte, cmdErr error) error {
@@ -181,23 +407,32 @@ func (s *BackupService) findDatabaseRestorePath(dbType string) string {
 func (s *BackupService) createPsqlRestoreCmd(conn *connection.StoredConnection, backupPath string) *exec.Cmd {
 	binaryPath := s.findDatabaseRestorePath("postgresql")
 	if binaryPath == "" {
-		fmt.Printf("ERROR: psql binary not found. Please install PostgreSQL client tools.\n")
+		slog.Error("psql binary not found, install PostgreSQL client tools")
 		return nil
 	}
 
 	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(restoreTools["postgresql"]))
 
 	// Use -v ON_ERROR_STOP=1 to exit immediately on first error
-	// This ensures errors are properly caught
+	// This ensures errors are properly caught. The script runs in a single
+	// transaction, so a failed or cancelled restore leaves nothing behind.
 	cmd := exec.Command(binPath,
 		"-h", conn.Host,
 		"-p", fmt.Sprintf("%d", conn.Port),
 		"-U", conn.Username,
 		"-d", conn.DatabaseName,
-		"-f", backupPath,
+		"--single-transaction",
 		"-v", "ON_ERROR_STOP=1", // Exit on first error
 	)
 
+	// The script is read from stdin, so the bytes read show the progress
+	file, err := os.Open(backupPath)
+	if err != nil {
+		slog.Error("Failed to open backup file", "path", backupPath, "error", err)
+		return nil
+	}
+
+	cmd.Stdin = file
 	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
 	return cmd
 }
@@ -205,7 +440,7 @@ func (s *BackupService) createPsqlRestoreCmd(conn *connection.StoredConnection,
 func (s *BackupService) createMySQLRestoreCmd(conn *connection.StoredConnection, backupPath string) *exec.Cmd {
 	binaryPath := s.findDatabaseRestorePath(conn.Type)
 	if binaryPath == "" {
-		fmt.Printf("ERROR: mysql binary not found. Please install MySQL/MariaDB client tools.\n")
+		slog.Error("mysql binary not found, install MySQL/MariaDB client tools")
 		return nil
 	}
 
@@ -230,7 +465,7 @@ func (s *BackupService) createMySQLRestoreCmd(conn *connection.StoredConnection,
 
 	file, err := os.Open(backupPath)
 	if err != nil {
-		fmt.Printf("ERROR: failed to open backup file: %v\n", err)
+		slog.Error("Failed to open backup file", "path", backupPath, "error", err)
 		return nil
 	}
 
@@ -241,19 +476,31 @@ func (s *BackupService) createMySQLRestoreCmd(conn *connection.StoredConnection,
 func (s *BackupService) createMongoRestoreCmd(conn *connection.StoredConnection, backupPath string) *exec.Cmd {
 	binaryPath := s.findDatabaseRestorePath("mongodb")
 	if binaryPath == "" {
-		fmt.Printf("ERROR: mongorestore binary not found. Please install MongoDB Database Tools.\n")
+		slog.Error("mongorestore binary not found, install MongoDB Database Tools")
 		return nil
 	}
 
 	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(restoreTools["mongodb"]))
 
-	backupDir := filepath.Dir(backupPath)
-
 	args := []string{
 		"--host", conn.Host,
 		"--port", fmt.Sprintf("%d", conn.Port),
-		"--db", conn.DatabaseName,
-		backupDir,
+	}
+
+	var input *os.File
+	if isMongoArchive(backupPath) {
+		// The archive is read from stdin, so the bytes read show the progress
+		file, err := os.Open(backupPath)
+		if err != nil {
+			slog.Error("Failed to open backup file", "path", backupPath, "error", err)
+			return nil
+		}
+		input = file
+		args = append(args, "--archive")
+		args = append(args, mongoArchiveOptions(backupPath, conn.DatabaseName)...)
+	} else {
+		// Older backups were dumped as a directory next to the artifact path
+		args = append(args, "--db", conn.DatabaseName, filepath.Dir(backupPath))
 	}
 
 	if conn.Username != "" {
@@ -264,5 +511,9 @@ func (s *BackupService) createMongoRestoreCmd(conn *connection.StoredConnection,
 		args = append(args, "--password", conn.Password)
 	}
 
-	return exec.Command(binPath, args...)
+	cmd := exec.Command(binPath, args...)
+	if input != nil {
+		cmd.Stdin = input
+	}
+	return cmd
 }
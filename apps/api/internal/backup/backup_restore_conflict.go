@@ -0,0 +1,88 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// Restore conflict modes, for targets that already hold data
+const (
+	RestoreConflictAbort     = "abort"
+	RestoreConflictOverwrite = "overwrite"
+	RestoreConflictRename    = "rename"
+)
+
+// maxDatabaseNameLength fits Postgres' 63 byte limit, which is below MySQL's
+const maxDatabaseNameLength = 63
+
+// RestoreConflictError is returned when a restore targets a database that is
+// not empty and the request does not say what to do with its contents
+type RestoreConflictError struct {
+	Database string
+	Objects  int
+}
+
+func (e *RestoreConflictError) Error() string {
+	return fmt.Sprintf("target database '%s' is not empty (%d objects). Set on_conflict to %q to replace it, or to %q to keep it as %s_pre_restore_<timestamp>",
+		e.Database, e.Objects, RestoreConflictOverwrite, RestoreConflictRename, e.Database)
+}
+
+func validateRestoreConflict(mode string) (string, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	switch mode {
+	case "":
+		return RestoreConflictAbort, nil
+	case RestoreConflictAbort, RestoreConflictOverwrite, RestoreConflictRename:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid on_conflict %q, use %s, %s or %s", mode, RestoreConflictAbort, RestoreConflictOverwrite, RestoreConflictRename)
+	}
+}
+
+// preRestoreName names the database that keeps a target's previous contents
+func preRestoreName(database string, now time.Time) string {
+	suffix := "_pre_restore_" + now.Format("20060102150405")
+	if len(database)+len(suffix) > maxDatabaseNameLength {
+		database = database[:maxDatabaseNameLength-len(suffix)]
+	}
+	return database + suffix
+}
+
+// prepareRestoreTarget refuses to restore over a database that holds data
+// unless the conflict mode replaces it. For renames it returns the name the
+// previous contents are kept under.
+func (s *BackupService) prepareRestoreTarget(conn *connection.StoredConnection, mode string) (string, error) {
+	if s.connService == nil {
+		return "", nil
+	}
+
+	objects, err := s.connService.CountDatabaseObjects(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to check restore target: %v", err)
+	}
+	if objects == 0 {
+		return "", nil
+	}
+
+	switch mode {
+	case RestoreConflictOverwrite:
+		if err := s.connService.ReplaceDatabase(conn, ""); err != nil {
+			return "", fmt.Errorf("failed to clear target database '%s': %v", conn.DatabaseName, err)
+		}
+		slog.Info("Dropped objects of database before restoring over it", "objects", objects, "database", conn.DatabaseName)
+		return "", nil
+	case RestoreConflictRename:
+		keepAs := preRestoreName(conn.DatabaseName, time.Now())
+		if err := s.connService.ReplaceDatabase(conn, keepAs); err != nil {
+			return "", fmt.Errorf("failed to rename target database '%s': %v", conn.DatabaseName, err)
+		}
+		slog.Info("Kept previous contents of database before restoring", "database", conn.DatabaseName, "kept_as", keepAs)
+		return keepAs, nil
+	default:
+		return "", &RestoreConflictError{Database: conn.DatabaseName, Objects: objects}
+	}
+}
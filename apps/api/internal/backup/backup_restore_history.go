@@ -0,0 +1,276 @@
+package backup
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Ways a restore is started
+const (
+	RestoreTriggerRequest     = "request"
+	RestoreTriggerPointInTime = "point_in_time"
+	RestoreTriggerSandbox     = "sandbox"
+)
+
+// RestoreInterrupted marks restores a crash or restart left running
+const RestoreInterrupted = "interrupted"
+
+const (
+	defaultRestoreListLimit = 50
+	maxRestoreListLimit     = 500
+)
+
+// RestoreRecordOptions are the options a restore ran with
+type RestoreRecordOptions struct {
+	Selection      *RestoreSelection `json:"selection,omitempty"`
+	OnConflict     string            `json:"on_conflict,omitempty"`
+	CreateDatabase bool              `json:"create_database"`
+	// Portable restores left out the owners, privileges and definers of
+	// the source
+	Portable bool `json:"portable"`
+}
+
+// Value stores the options as JSON in a nullable text column
+func (o RestoreRecordOptions) Value() (driver.Value, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (o *RestoreRecordOptions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	case []byte:
+		return json.Unmarshal(v, o)
+	default:
+		return fmt.Errorf("cannot scan %T into restore options", src)
+	}
+}
+
+// RestoreRecord is the history of one restore attempt: who started it, which
+// backup went into which database, how and with what outcome. Records are
+// kept apart from the backup history and outlive the restore job, whose ID
+// they share. Rejected restores are recorded as failed.
+type RestoreRecord struct {
+	ID       uuid.UUID `json:"id"`
+	UserID   uuid.UUID `json:"user_id"`
+	Username *string   `json:"username,omitempty"`
+	// Impersonator is the admin who acted as the user, if any
+	Impersonator       *string              `json:"impersonator,omitempty"`
+	BackupID           string               `json:"backup_id"`
+	SourceConnectionID string               `json:"source_connection_id"`
+	ConnectionID       string               `json:"connection_id"`
+	DatabaseName       string               `json:"database_name"`
+	Trigger            string               `json:"trigger"`
+	Options            RestoreRecordOptions `json:"options"`
+	Status             string               `json:"status"`
+	Error              *string              `json:"error,omitempty"`
+	// Cleanup says what was done with the data a cancelled restore left
+	Cleanup           *string    `json:"cleanup,omitempty"`
+	PreservedDatabase *string    `json:"preserved_database,omitempty"`
+	CreatedDatabase   bool       `json:"created_database"`
+	StartedAt         time.Time  `json:"started_at"`
+	FinishedAt        *time.Time `json:"finished_at,omitempty"`
+	DurationMs        *int64     `json:"duration_ms,omitempty"`
+	// Log holds the last lines of the restore tool's output. It is only
+	// returned with a single record.
+	Log *string `json:"log,omitempty"`
+}
+
+// RestoreRecordFilter narrows a listing of a user's restores
+type RestoreRecordFilter struct {
+	UserID       uuid.UUID
+	BackupID     string
+	ConnectionID string
+	Status       string
+	Limit        int
+}
+
+// restoreOrigin names who started a restore and how, for its record
+type restoreOrigin struct {
+	trigger string
+	// access is the recorded request for the artifact, if the restore was
+	// asked for over the API
+	access *ArtifactAccess
+}
+
+// beginRestoreRecord records a restore as running before anything is checked,
+// so that rejected attempts are kept as well
+func (s *BackupService) beginRestoreRecord(backup *Backup, conn *connection.StoredConnection, options restoreOptions) *RestoreRecord {
+	record := &RestoreRecord{
+		ID:                 uuid.New(),
+		UserID:             conn.UserID,
+		BackupID:           backup.ID.String(),
+		SourceConnectionID: backup.ConnectionID,
+		ConnectionID:       conn.ID,
+		DatabaseName:       conn.DatabaseName,
+		Trigger:            options.origin.trigger,
+		Options: RestoreRecordOptions{
+			OnConflict:     options.onConflict,
+			CreateDatabase: options.createDatabase,
+			Portable:       options.portable,
+		},
+		Status:    RestoreJobRunning,
+		StartedAt: time.Now(),
+	}
+	if record.Trigger == "" {
+		record.Trigger = RestoreTriggerRequest
+	}
+	if !options.selection.isEmpty() {
+		record.Options.Selection = options.selection
+	}
+	if access := options.origin.access; access != nil {
+		record.UserID = access.UserID
+		record.Username = access.Username
+		record.Impersonator = access.Impersonator
+	}
+
+	if err := s.backupRepo.CreateRestoreRecord(record); err != nil {
+		slog.Warn("Failed to record restore of backup", "backup_id", record.BackupID, "error", err)
+	}
+	return record
+}
+
+// finishRestoreRecord records how a restore ended, with the output its job
+// collected. A nil job means the restore was rejected before it started.
+func (s *BackupService) finishRestoreRecord(record *RestoreRecord, job *restoreJob, result *RestoreResult, restoreErr error) {
+	now := time.Now()
+	duration := now.Sub(record.StartedAt).Milliseconds()
+	record.FinishedAt = &now
+	record.DurationMs = &duration
+
+	record.Status = RestoreJobCompleted
+	if restoreErr != nil {
+		record.Status = RestoreJobFailed
+		message := restoreErr.Error()
+		record.Error = &message
+	}
+	if job != nil {
+		info := job.describe()
+		record.Status = info.Status
+		if info.Cleanup != "" {
+			record.Cleanup = &info.Cleanup
+		}
+		if lines := job.processes.log.backlog(); len(lines) > 0 {
+			log := strings.Join(lines, "\n")
+			record.Log = &log
+		}
+	}
+	if result != nil {
+		if result.PreservedDatabase != "" {
+			record.PreservedDatabase = &result.PreservedDatabase
+		}
+		record.CreatedDatabase = result.CreatedDatabase
+	}
+
+	if err := s.backupRepo.FinishRestoreRecord(record); err != nil {
+		slog.Warn("Failed to record outcome of restore", "restore_id", record.ID, "error", err)
+	}
+
+	s.notifyRestoreFinished(record)
+}
+
+// recoverInterruptedRestores closes the records of restores a crash or
+// restart left running. It runs before any restore can start.
+func (s *BackupService) recoverInterruptedRestores() {
+	count, err := s.backupRepo.InterruptRunningRestores("interrupted by a restart")
+	if err != nil {
+		slog.Warn("Failed to close interrupted restores", "error", err)
+		return
+	}
+	if count > 0 {
+		slog.Info("Marked restores interrupted by the restart", "restores", count)
+	}
+}
+
+// GetRestoreRecords lists the user's restores, newest first, without their
+// logs
+func (s *BackupService) GetRestoreRecords(filter RestoreRecordFilter) ([]*RestoreRecord, error) {
+	switch {
+	case filter.Limit <= 0:
+		filter.Limit = defaultRestoreListLimit
+	case filter.Limit > maxRestoreListLimit:
+		filter.Limit = maxRestoreListLimit
+	}
+	return s.backupRepo.GetRestoreRecords(filter)
+}
+
+// GetRestoreRecord returns one of the user's restores with its log
+func (s *BackupService) GetRestoreRecord(id string, userID uuid.UUID) (*RestoreRecord, error) {
+	record, err := s.backupRepo.GetRestoreRecord(id)
+	if err != nil {
+		return nil, err
+	}
+	if record.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return record, nil
+}
+
+func (h *BackupHandler) GetRestoreRecords(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	filter := RestoreRecordFilter{
+		UserID:       userID,
+		BackupID:     query.Get("backup_id"),
+		ConnectionID: query.Get("connection_id"),
+		Status:       query.Get("status"),
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if filter.Limit, err = strconv.Atoi(limitStr); err != nil || filter.Limit < 0 {
+			response.SendError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	records, err := h.backupService.GetRestoreRecords(filter)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Restore history retrieved successfully", records)
+}
+
+func (h *BackupHandler) GetRestoreRecord(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	record, err := h.backupService.GetRestoreRecord(mux.Vars(r)["id"], userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Restore not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Restore retrieved successfully", record)
+}
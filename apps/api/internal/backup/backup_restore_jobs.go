@@ -0,0 +1,406 @@
+package backup
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Restore job states
+const (
+	RestoreJobRunning   = "running"
+	RestoreJobCompleted = "completed"
+	RestoreJobFailed    = "failed"
+	RestoreJobCancelled = "cancelled"
+)
+
+// restoreJobRetention keeps a finished restore listed, so a client polling
+// its progress sees how it ended
+const restoreJobRetention = 15 * time.Minute
+
+// errRunCancelled stops the commands of a run its user cancelled
+var errRunCancelled = errors.New("run was cancelled")
+
+// ErrRestoreCancelled is returned by a restore that was cancelled while it
+// ran
+var ErrRestoreCancelled = errors.New("restore was cancelled")
+
+// pgRestoreProgressLine matches the lines pg_restore --verbose prints for
+// each table of contents entry it restores
+var pgRestoreProgressLine = regexp.MustCompile(`^pg_restore: (creating |processing data for table |executing )`)
+
+// mongoRestoreProgressLine matches the line mongorestore prints once a
+// collection is restored
+var mongoRestoreProgressLine = regexp.MustCompile(`finished restoring \S+ \(`)
+
+// RestoreJob is the progress of a running or recently finished restore. It
+// shares the ID of the restore's live log and of its record in the restore
+// history. Plain SQL dumps and MongoDB archives report the bytes read,
+// pg_restore archives the table of contents entries restored.
+type RestoreJob struct {
+	ID              string     `json:"id"`
+	BackupID        string     `json:"backup_id"`
+	ConnectionID    string     `json:"connection_id"`
+	Database        string     `json:"database"`
+	Status          string     `json:"status"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	BytesRestored   int64      `json:"bytes_restored"`
+	TotalBytes      int64      `json:"total_bytes,omitempty"`
+	ObjectsRestored int64      `json:"objects_restored"`
+	TotalObjects    int64      `json:"total_objects,omitempty"`
+	// Progress is the percentage done, missing when the total is unknown
+	Progress *float64 `json:"progress,omitempty"`
+	// Transactional restores run in a single transaction, which the server
+	// rolls back when they are cancelled or fail
+	Transactional bool `json:"transactional"`
+	// Cleanup says what was done with the data a cancelled restore left
+	Cleanup string `json:"cleanup,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// restoreJob tracks a restore's progress and lets it be cancelled. It is
+// written to with the output of the restore tool to count the objects it
+// restores.
+type restoreJob struct {
+	mu        sync.Mutex
+	info      RestoreJob
+	userID    uuid.UUID
+	processes *processTracker
+	// touched is set once the target was changed, so a cancelled restore
+	// knows whether there is anything to clean up
+	touched   bool
+	cancelled atomic.Bool
+	bytes     atomic.Int64
+	objects   atomic.Int64
+	partial   []byte
+}
+
+// beginRestoreJob registers the progress of a restore under the ID of its
+// live log. It must be ended with endRestoreJob.
+func (s *BackupService) beginRestoreJob(backup *Backup, conn *connection.StoredConnection, processes *processTracker) *restoreJob {
+	job := &restoreJob{
+		info: RestoreJob{
+			ID:           processes.log.info.ID,
+			BackupID:     backup.ID.String(),
+			ConnectionID: conn.ID,
+			Database:     conn.DatabaseName,
+			Status:       RestoreJobRunning,
+			StartedAt:    time.Now(),
+		},
+		userID:    conn.UserID,
+		processes: processes,
+	}
+	processes.progress = job
+	s.restoreJobs.Store(job.info.ID, job)
+	return job
+}
+
+// endRestoreJob records how a restore ended. A cancelled restore that was
+// not transactional is cleaned up by emptying the target, which holds
+// nothing but the partial restore since conflicts are resolved before it
+// starts.
+func (s *BackupService) endRestoreJob(job *restoreJob, target connection.StoredConnection, err error) error {
+	job.mu.Lock()
+	now := time.Now()
+	job.info.FinishedAt = &now
+	// A killed psql reports no error, so the kill itself marks the cancel
+	cancelled := job.cancelled.Load() && (err != nil || job.processes.timedOut())
+	transactional := job.info.Transactional
+	touched := job.touched
+	job.mu.Unlock()
+
+	status := RestoreJobCompleted
+	var cleanup string
+	switch {
+	case cancelled:
+		status = RestoreJobCancelled
+		switch {
+		case !touched:
+			cleanup = "the target was not changed"
+		case transactional:
+			cleanup = "the restore's transaction was rolled back"
+		case s.connService == nil:
+			cleanup = "the partially restored data was left in place"
+		default:
+			if clearErr := s.connService.ReplaceDatabase(&target, ""); clearErr != nil {
+				slog.WarnContext(job.processes.jobContext(), "Failed to clear database after cancelled restore", "database", target.DatabaseName, "error", clearErr)
+				cleanup = fmt.Sprintf("clearing the partially restored data failed: %v", clearErr)
+			} else {
+				cleanup = fmt.Sprintf("the partially restored data was dropped from database '%s'", target.DatabaseName)
+			}
+		}
+		err = fmt.Errorf("%w: %s", ErrRestoreCancelled, cleanup)
+	case err != nil:
+		status = RestoreJobFailed
+	}
+
+	job.mu.Lock()
+	job.info.Status = status
+	job.info.Cleanup = cleanup
+	if err != nil {
+		job.info.Error = err.Error()
+	}
+	job.mu.Unlock()
+
+	time.AfterFunc(restoreJobRetention, func() {
+		s.restoreJobs.Delete(job.info.ID)
+	})
+	return err
+}
+
+// markTouched records that the restore is about to change the target
+func (job *restoreJob) markTouched() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.touched = true
+}
+
+func (job *restoreJob) setTransactional() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.info.Transactional = true
+}
+
+func (job *restoreJob) setTotalObjects(total int64) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.info.TotalObjects = total
+}
+
+// trackInput counts the bytes a restore tool reads from its input file
+func (job *restoreJob) trackInput(file *os.File) io.Reader {
+	if info, err := file.Stat(); err == nil {
+		job.mu.Lock()
+		job.info.TotalBytes = info.Size()
+		job.mu.Unlock()
+	}
+	return &countingReader{r: file, n: &job.bytes}
+}
+
+// Write counts the progress lines in the restore tool's output
+func (job *restoreJob) Write(p []byte) (int, error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	data := append(job.partial, p...)
+	for {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			break
+		}
+		line := data[:end]
+		if pgRestoreProgressLine.Match(line) || mongoRestoreProgressLine.Match(line) {
+			job.objects.Add(1)
+		}
+		data = data[end+1:]
+	}
+	if len(data) > maxLiveLogLineLength {
+		data = nil
+	}
+	job.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+func (job *restoreJob) describe() RestoreJob {
+	job.mu.Lock()
+	info := job.info
+	job.mu.Unlock()
+
+	info.BytesRestored = job.bytes.Load()
+	info.ObjectsRestored = job.objects.Load()
+	if info.TotalObjects > 0 && info.ObjectsRestored > info.TotalObjects {
+		info.ObjectsRestored = info.TotalObjects
+	}
+
+	var progress float64
+	switch {
+	case info.Status == RestoreJobCompleted:
+		progress = 100
+	case info.TotalBytes > 0:
+		progress = float64(info.BytesRestored) / float64(info.TotalBytes) * 100
+	case info.TotalObjects > 0:
+		progress = float64(info.ObjectsRestored) / float64(info.TotalObjects) * 100
+	default:
+		return info
+	}
+	// The tool still has work to do after reading the last byte
+	if info.Status == RestoreJobRunning && progress > 99 {
+		progress = 99
+	}
+	info.Progress = &progress
+	return info
+}
+
+// cancel kills the restore's tools. Restores that are still preparing stop
+// before they change the target.
+func (job *restoreJob) cancel() {
+	job.cancelled.Store(true)
+	job.processes.cancel()
+}
+
+// pgRestoreProgressArgs makes pg_restore print each entry it restores when
+// the restore is tracked, and counts the entries of the archive's table of
+// contents it will restore. Selections by schema or table leave the total
+// unknown.
+func (s *BackupService) pgRestoreProgressArgs(archivePath string, selection *RestoreSelection, processes *processTracker) []string {
+	if processes == nil || processes.progress == nil {
+		return nil
+	}
+
+	switch {
+	case selection.isEmpty():
+		toc, err := s.listArchive(archivePath)
+		if err != nil {
+			slog.WarnContext(processes.jobContext(), "Failed to count archive entries for restore progress", "error", err)
+			break
+		}
+		processes.progress.setTotalObjects(int64(len(parseTOC(toc))))
+	case len(selection.Schemas) == 0 && len(selection.Tables) == 0:
+		processes.progress.setTotalObjects(int64(len(selection.TOCEntries)))
+	}
+	return []string{"--verbose"}
+}
+
+// withoutProgressLines drops the lines pg_restore --verbose prints for each
+// entry from its output, leaving the errors
+func withoutProgressLines(output string) string {
+	var kept []string
+	for _, line := range strings.Split(output, "\n") {
+		if !pgRestoreProgressLine.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// userRestoreJob returns a restore job of the user, or nil
+func (s *BackupService) userRestoreJob(id string, userID uuid.UUID) *restoreJob {
+	value, ok := s.restoreJobs.Load(id)
+	if !ok {
+		return nil
+	}
+	job := value.(*restoreJob)
+	if job.userID != userID {
+		return nil
+	}
+	return job
+}
+
+// GetRestoreJobs lists the user's running and recently finished restores,
+// oldest first
+func (s *BackupService) GetRestoreJobs(userID uuid.UUID) []RestoreJob {
+	jobs := []RestoreJob{}
+	s.restoreJobs.Range(func(_, value interface{}) bool {
+		job := value.(*restoreJob)
+		if job.userID == userID {
+			jobs = append(jobs, job.describe())
+		}
+		return true
+	})
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.Before(jobs[j].StartedAt)
+	})
+	return jobs
+}
+
+// GetRestoreJob returns the progress of one of the user's restores
+func (s *BackupService) GetRestoreJob(id string, userID uuid.UUID) (*RestoreJob, error) {
+	job := s.userRestoreJob(id, userID)
+	if job == nil {
+		return nil, sql.ErrNoRows
+	}
+	info := job.describe()
+	return &info, nil
+}
+
+// CancelRestoreJob stops one of the user's running restores
+func (s *BackupService) CancelRestoreJob(id string, userID uuid.UUID) error {
+	job := s.userRestoreJob(id, userID)
+	if job == nil {
+		return sql.ErrNoRows
+	}
+	if status := job.describe().Status; status != RestoreJobRunning {
+		return &RestoreTargetError{Reason: fmt.Sprintf("a %s restore cannot be cancelled", status)}
+	}
+	job.cancel()
+	return nil
+}
+
+func (h *BackupHandler) GetRestoreJobs(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Restore jobs retrieved successfully", h.backupService.GetRestoreJobs(userID))
+}
+
+func (h *BackupHandler) GetRestoreJob(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := h.backupService.GetRestoreJob(mux.Vars(r)["id"], userID)
+	if err != nil {
+		response.SendError(w, http.StatusNotFound, "Restore job not found")
+		return
+	}
+
+	response.SendSuccess(w, "Restore job retrieved successfully", job)
+}
+
+func (h *BackupHandler) CancelRestoreJob(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.backupService.CancelRestoreJob(mux.Vars(r)["id"], userID); err != nil {
+		var invalid *RestoreTargetError
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Restore job not found")
+		case errors.As(err, &invalid):
+			response.SendError(w, http.StatusConflict, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Restore cancelled", nil)
+}
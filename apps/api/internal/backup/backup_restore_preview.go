@@ -0,0 +1,393 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+)
+
+// RestorePreview is what a restore would do to its target, worked out
+// without changing the target. Restorable is false when the restore would
+// be refused or fail, with the reasons in Conflicts.
+type RestorePreview struct {
+	BackupID     string `json:"backup_id"`
+	ConnectionID string `json:"connection_id"`
+	Database     string `json:"database"`
+	OnConflict   string `json:"on_conflict"`
+	// DatabaseExists is false when the target server lacks the database;
+	// CreatesDatabase is set when the restore would create it
+	DatabaseExists  bool `json:"database_exists"`
+	CreatesDatabase bool `json:"creates_database"`
+	// Tables are the tables (or collections) the backup would create. Row
+	// counts are approximate and missing where the dump cannot be counted.
+	Tables []*RestorePreviewTable `json:"tables"`
+	// ExistingObjects are the tables, views, sequences or collections the
+	// target holds now. Overwrite drops them; rename moves them to
+	// PreservedDatabase, named after the time of the preview.
+	ExistingObjects   []string `json:"existing_objects"`
+	Dropped           []string `json:"dropped"`
+	PreservedDatabase string   `json:"preserved_database,omitempty"`
+	// SourceServerVersion is the version the backup was taken from, which
+	// the target should match
+	SourceServerVersion string   `json:"source_server_version,omitempty"`
+	TargetServerVersion string   `json:"target_server_version,omitempty"`
+	Warnings            []string `json:"warnings"`
+	Conflicts           []string `json:"conflicts"`
+	Restorable          bool     `json:"restorable"`
+}
+
+// RestorePreviewTable is a table or collection in a backup
+type RestorePreviewTable struct {
+	Schema     string `json:"schema,omitempty"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	ApproxRows *int64 `json:"approx_rows,omitempty"`
+	// Exists is set when the target already has an object of that name
+	Exists bool `json:"exists"`
+}
+
+var (
+	// copyStatementPattern matches the COPY statements that start the data
+	// of a table in a pg_dump script
+	copyStatementPattern = regexp.MustCompile(`^COPY\s+([^\s(]+)`)
+	// insertStatementPattern matches the INSERT statements of mysqldump and
+	// of pg_dump --inserts
+	insertStatementPattern = regexp.MustCompile(`(?i)^INSERT\s+(?:IGNORE\s+)?INTO\s+([^\s(]+)`)
+	// extendedInsertSeparator separates the rows of an extended INSERT
+	extendedInsertSeparator = []byte("),(")
+)
+
+// PreviewRestore works out what restoring a backup into a connection would
+// do, with the options RestoreBackup takes
+func (s *BackupService) PreviewRestore(req *RestoreRequest, userID uuid.UUID) (*RestorePreview, error) {
+	backup, err := s.backupRepo.GetBackup(req.BackupID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.accessibleConnection(backup.ConnectionID, userID); err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	if err := renameRestoreTarget(conn, req.DatabaseName); err != nil {
+		return nil, err
+	}
+
+	return s.previewRestoreInto(backup, conn, restoreOptions{
+		selection:      req.Selection,
+		onConflict:     req.OnConflict,
+		createDatabase: req.DatabaseName != "",
+	})
+}
+
+// PreviewRestoreToConnection works out what restoring a backup into another
+// of the user's connections would do
+func (s *BackupService) PreviewRestoreToConnection(backupID string, userID uuid.UUID, req *RestoreToConnectionRequest) (*RestorePreview, error) {
+	backup, target, err := s.resolveRestoreTarget(backupID, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.previewRestoreInto(backup, target, restoreOptions{
+		selection:      req.Selection,
+		onConflict:     req.OnConflict,
+		createDatabase: req.CreateDatabase,
+		portable:       !req.KeepOwnership,
+	})
+}
+
+// previewRestoreInto runs the checks of restoreInto and reads the backup and
+// the target, but changes neither
+func (s *BackupService) previewRestoreInto(backup *Backup, conn *connection.StoredConnection, options restoreOptions) (*RestorePreview, error) {
+	mode, err := validateRestoreConflict(options.onConflict)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &RestorePreview{
+		BackupID:        backup.ID.String(),
+		ConnectionID:    conn.ID,
+		Database:        conn.DatabaseName,
+		OnConflict:      mode,
+		Tables:          []*RestorePreviewTable{},
+		ExistingObjects: []string{},
+		Dropped:         []string{},
+		Warnings:        []string{},
+		Conflicts:       []string{},
+	}
+	if backup.Manifest != nil {
+		preview.SourceServerVersion = backup.Manifest.ServerVersion
+	}
+
+	if isGPGEncrypted(backup) {
+		preview.Conflicts = append(preview.Conflicts, fmt.Sprintf("backup is encrypted for GPG key %s and cannot be restored by velld", *backup.EncryptionKeyFingerprint))
+		return preview, nil
+	}
+	if isPhysicalBackup(plainDumpPath(backup)) {
+		preview.Conflicts = append(preview.Conflicts, "physical backups replace a whole server's data directory and cannot be restored into a database")
+		return preview, nil
+	}
+	if err := s.verifyRestoreTools(conn.Type); err != nil {
+		return nil, err
+	}
+
+	if s.connService != nil {
+		state, err := s.connService.InspectRestoreTarget(conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check restore target: %v", err)
+		}
+		s.previewTarget(preview, backup, conn, state, options.createDatabase)
+	}
+
+	source, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection of backup: %v", err)
+	}
+
+	filePath, isTemp, err := s.ensureBackupContentAvailable(backup, source.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if isTemp {
+		defer os.Remove(filePath)
+	}
+
+	if err := validateRestoreSelection(options.selection, conn.Type, filePath); err != nil {
+		preview.Conflicts = append(preview.Conflicts, err.Error())
+	} else {
+		tables, err := s.previewBackupTables(backup, conn.Type, filePath, options.selection)
+		if err != nil {
+			preview.Warnings = append(preview.Warnings, fmt.Sprintf("could not read the tables of the backup: %v", err))
+		}
+		preview.Tables = tables
+	}
+
+	existing := make(map[string]bool, len(preview.ExistingObjects))
+	for _, name := range preview.ExistingObjects {
+		existing[name] = true
+	}
+	for _, table := range preview.Tables {
+		table.Exists = existing[targetObjectName(conn.Type, table)]
+	}
+
+	preview.Restorable = len(preview.Conflicts) == 0
+	return preview, nil
+}
+
+// previewTarget fills in what the restore would do to the target's
+// database and its current contents
+func (s *BackupService) previewTarget(preview *RestorePreview, backup *Backup, conn *connection.StoredConnection, state *connection.RestoreTargetState, createDatabase bool) {
+	preview.DatabaseExists = state.Exists
+	preview.TargetServerVersion = state.ServerVersion
+	preview.ExistingObjects = state.Objects
+
+	if warnings := manifestWarnings(backup.Manifest, conn.Type, &connection.SchemaDescription{ServerVersion: state.ServerVersion}); len(warnings) > 0 {
+		preview.Warnings = append(preview.Warnings, warnings...)
+	}
+
+	// MongoDB creates databases on first write
+	if !state.Exists && conn.Type != "mongodb" {
+		if createDatabase {
+			preview.CreatesDatabase = true
+		} else {
+			preview.Conflicts = append(preview.Conflicts, fmt.Sprintf("target database '%s' does not exist. Set create_database to create it", conn.DatabaseName))
+		}
+	}
+
+	if len(state.Objects) == 0 {
+		return
+	}
+	switch preview.OnConflict {
+	case RestoreConflictOverwrite:
+		preview.Dropped = state.Objects
+	case RestoreConflictRename:
+		preview.PreservedDatabase = preRestoreName(conn.DatabaseName, time.Now())
+	default:
+		conflict := &RestoreConflictError{Database: conn.DatabaseName, Objects: len(state.Objects)}
+		preview.Conflicts = append(preview.Conflicts, conflict.Error())
+	}
+}
+
+// previewBackupTables lists the tables of a backup with approximate row
+// counts. Archives are rendered as SQL by pg_restore, so the selection
+// applies as it would to the restore; MongoDB archives list their
+// collections without counts.
+func (s *BackupService) previewBackupTables(backup *Backup, dbType, filePath string, selection *RestoreSelection) ([]*RestorePreviewTable, error) {
+	tables := []*RestorePreviewTable{}
+
+	switch {
+	case dbType == "mongodb":
+		if !isMongoArchive(filePath) {
+			return tables, nil
+		}
+		entries, err := s.listMongoArchive(filePath)
+		if err != nil {
+			return tables, err
+		}
+		selected := make(map[string]bool)
+		if !selection.isEmpty() {
+			for _, collection := range selection.Collections {
+				selected[collection] = true
+			}
+		}
+		for _, entry := range entries {
+			if backup.DatabaseName != nil && entry.Schema != *backup.DatabaseName {
+				continue
+			}
+			if len(selected) > 0 && !selected[entry.Name] {
+				continue
+			}
+			tables = append(tables, &RestorePreviewTable{Name: entry.Name, Type: "COLLECTION"})
+		}
+		return tables, nil
+	case isDirectoryDump(filePath):
+		dumpDir, err := unpackDirectoryDump(filePath)
+		if err != nil {
+			return tables, err
+		}
+		defer os.RemoveAll(dumpDir)
+		return s.previewArchiveTables(dumpDir, selection)
+	case isCustomDump(filePath):
+		return s.previewArchiveTables(filePath, selection)
+	default:
+		file, err := os.Open(filePath)
+		if err != nil {
+			return tables, fmt.Errorf("failed to open backup file: %v", err)
+		}
+		defer file.Close()
+		return scanDumpTables(file)
+	}
+}
+
+// previewArchiveTables streams the SQL pg_restore renders from a custom or
+// directory-format archive through scanDumpTables
+func (s *BackupService) previewArchiveTables(archivePath string, selection *RestoreSelection) ([]*RestorePreviewTable, error) {
+	binPath, err := s.findPgRestoreBinary()
+	if err != nil {
+		return []*RestorePreviewTable{}, err
+	}
+
+	selectionArgs, listPath, err := s.pgRestoreSelectionArgs(archivePath, selection)
+	if err != nil {
+		return []*RestorePreviewTable{}, err
+	}
+	if listPath != "" {
+		defer os.Remove(listPath)
+	}
+
+	args := append([]string{"-f", "-"}, selectionArgs...)
+	cmd := exec.Command(binPath, append(args, archivePath)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return []*RestorePreviewTable{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return []*RestorePreviewTable{}, fmt.Errorf("failed to start pg_restore: %v", err)
+	}
+
+	tables, scanErr := scanDumpTables(stdout)
+	if scanErr != nil {
+		// Drain the rest so pg_restore does not block on a full pipe
+		io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return tables, fmt.Errorf("failed to render archive: %s", strings.TrimSpace(stderr.String()))
+	}
+	return tables, scanErr
+}
+
+// scanDumpTables lists the tables a SQL dump creates or fills, counting the
+// rows of COPY blocks and INSERT statements. Rows of an extended INSERT are
+// counted by their separators, so values containing "),(" inflate the count.
+func scanDumpTables(r io.Reader) ([]*RestorePreviewTable, error) {
+	tables := []*RestorePreviewTable{}
+	byName := make(map[CatalogTable]*RestorePreviewTable)
+	tableNamed := func(name string) *RestorePreviewTable {
+		key := parseTableName(name)
+		table, ok := byName[key]
+		if !ok {
+			table = &RestorePreviewTable{Schema: key.Schema, Name: key.Name, Type: "TABLE"}
+			byName[key] = table
+			tables = append(tables, table)
+		}
+		return table
+	}
+	addRows := func(table *RestorePreviewTable, rows int64) {
+		if table.ApproxRows == nil {
+			table.ApproxRows = new(int64)
+		}
+		*table.ApproxRows += rows
+	}
+
+	reader := bufio.NewReaderSize(r, 64*1024)
+	atLineStart := true
+	var copying, inserting *RestorePreviewTable
+	for {
+		line, err := reader.ReadSlice('\n')
+		switch {
+		case !atLineStart:
+			if inserting != nil {
+				addRows(inserting, int64(bytes.Count(line, extendedInsertSeparator)))
+			}
+		case copying != nil:
+			if bytes.Equal(bytes.TrimRight(line, "\r\n"), []byte(`\.`)) {
+				copying = nil
+			} else if len(line) > 0 {
+				addRows(copying, 1)
+			}
+		default:
+			inserting = nil
+			if match := createTablePattern.FindSubmatch(line); match != nil {
+				tableNamed(string(match[1]))
+			} else if match := copyStatementPattern.FindSubmatch(line); match != nil {
+				copying = tableNamed(string(match[1]))
+				addRows(copying, 0)
+			} else if match := insertStatementPattern.FindSubmatch(line); match != nil {
+				inserting = tableNamed(string(match[1]))
+				addRows(inserting, 1+int64(bytes.Count(line, extendedInsertSeparator)))
+			}
+		}
+		atLineStart = err != bufio.ErrBufferFull
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return tables, err
+		}
+	}
+
+	return tables, nil
+}
+
+// targetObjectName names a backup's table the way InspectRestoreTarget names
+// the target's objects
+func targetObjectName(dbType string, table *RestorePreviewTable) string {
+	if dbType != "postgresql" {
+		return table.Name
+	}
+	schema := table.Schema
+	if schema == "" {
+		schema = "public"
+	}
+	return schema + "." + table.Name
+}
@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// pgDatabaseIdent matches a PostgreSQL database name, quoted or not
+const pgDatabaseIdent = `(?:"(?:[^"]|"")*"|[^\s;]+)`
+
+var (
+	// pgDatabaseStatement matches the statements of a plain PostgreSQL dump
+	// taken with --create that name the dumped database, such as its search
+	// path setting
+	pgDatabaseStatement = regexp.MustCompile(`^(ALTER DATABASE |COMMENT ON DATABASE |SECURITY LABEL (?:FOR \S+ )?ON DATABASE )` + pgDatabaseIdent)
+	// mysqlAlterDatabase matches the ALTER DATABASE statements mysqldump
+	// writes around routines to switch the database's character set
+	mysqlAlterDatabase = regexp.MustCompile("ALTER DATABASE `(?:[^`]|``)*`")
+)
+
+// renameDumpFilter points the database statements of a plain SQL dump at
+// targetDB, for restoring a backup under another name. The dump's CREATE
+// DATABASE statements are dropped, since the restore creates the target
+// itself, and so are the switches to the dumped database: \connect lines of
+// PostgreSQL dumps and USE statements of MySQL dumps, which would otherwise
+// restore into the source database. Archives restored by pg_restore, which
+// skips database entries, and mongorestore, which maps namespaces with
+// --nsTo, get no filter.
+func renameDumpFilter(dbType, dumpPath, targetDB string) dumpFilter {
+	switch dbType {
+	case "postgresql":
+		if isCustomDump(dumpPath) || isDirectoryDump(dumpPath) {
+			return nil
+		}
+		quoted := `"` + strings.ReplaceAll(targetDB, `"`, `""`) + `"`
+		inCopy := false
+		return func(line string) (string, bool) {
+			if inCopy {
+				inCopy = line != `\.`
+				return line, true
+			}
+			switch {
+			case strings.HasPrefix(line, "COPY ") && strings.HasSuffix(line, "FROM stdin;"):
+				inCopy = true
+			case strings.HasPrefix(line, `\connect `):
+				return "", true
+			case strings.HasPrefix(line, "CREATE DATABASE "):
+				return "", false
+			case pgDatabaseStatement.MatchString(line):
+				return pgDatabaseStatement.ReplaceAllString(line, "${1}"+strings.ReplaceAll(quoted, "$", "$$")), true
+			}
+			return line, true
+		}
+	case "mysql", "mariadb":
+		quoted := "`" + strings.ReplaceAll(targetDB, "`", "``") + "`"
+		return func(line string) (string, bool) {
+			switch {
+			case strings.HasPrefix(line, "CREATE DATABASE "):
+				return "", false
+			case strings.HasPrefix(line, "USE "):
+				return "USE " + quoted + ";", true
+			}
+			return mysqlAlterDatabase.ReplaceAllLiteralString(line, "ALTER DATABASE "+quoted), true
+		}
+	default:
+		return nil
+	}
+}
+
+// renameRestoreTarget points a restore at another database of the target
+// connection's server. An empty name keeps the connection's database.
+func renameRestoreTarget(conn *connection.StoredConnection, name string) error {
+	if name == "" {
+		return nil
+	}
+	if msg := connection.ValidateDatabaseName(conn.Type, name); msg != "" {
+		return &RestoreTargetError{Reason: fmt.Sprintf("database name %s", msg)}
+	}
+	conn.DatabaseName = name
+	return nil
+}
+
+// restoresUnderNewName reports whether a backup is restored into a database
+// other than the one it was taken from. Backups that do not record their
+// database are treated as renamed, which leaves only the target to restore
+// into.
+func restoresUnderNewName(backup *Backup, conn *connection.StoredConnection) bool {
+	return backup.DatabaseName == nil || *backup.DatabaseName != conn.DatabaseName
+}
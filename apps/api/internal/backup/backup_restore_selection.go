@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+)
+
+// RestoreSelection restores part of a backup. Schemas, Tables and TOCEntries
+// select from custom and directory-format PostgreSQL archives; TOCEntries
+// are entry IDs from the archive's table of contents and map to --use-list.
+// Collections select from MongoDB archives and map to --nsInclude.
+type RestoreSelection struct {
+	Schemas     []string `json:"schemas,omitempty"`
+	Tables      []string `json:"tables,omitempty"`
+	TOCEntries  []int    `json:"toc_entries,omitempty"`
+	Collections []string `json:"collections,omitempty"`
+}
+
+func (r *RestoreSelection) isEmpty() bool {
+	return r == nil || (len(r.Schemas) == 0 && len(r.Tables) == 0 && len(r.TOCEntries) == 0 && len(r.Collections) == 0)
+}
+
+// Value stores the selection of a restore as JSON in a nullable text column
+func (r RestoreSelection) Value() (driver.Value, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (r *RestoreSelection) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	case []byte:
+		return json.Unmarshal(v, r)
+	default:
+		return fmt.Errorf("cannot scan %T into restore selection", src)
+	}
+}
+
+// validateRestoreSelection checks that the backup at filePath can be
+// restored selectively with the given selection
+func validateRestoreSelection(selection *RestoreSelection, dbType, filePath string) error {
+	if selection.isEmpty() {
+		return nil
+	}
+
+	switch dbType {
+	case "postgresql":
+		if !isCustomDump(filePath) && !isDirectoryDump(filePath) {
+			return fmt.Errorf("selective restore of PostgreSQL requires a custom or directory-format backup")
+		}
+		if len(selection.Collections) > 0 {
+			return fmt.Errorf("collections can only be selected from MongoDB backups")
+		}
+	case "mongodb":
+		if !isMongoArchive(filePath) || isMongoOplogArchive(filePath) {
+			return fmt.Errorf("selective restore of MongoDB requires an archive taken without the oplog")
+		}
+		if len(selection.Schemas) > 0 || len(selection.Tables) > 0 || len(selection.TOCEntries) > 0 {
+			return fmt.Errorf("only collections can be selected from MongoDB backups")
+		}
+	default:
+		return fmt.Errorf("selective restore is not supported for %s backups", dbType)
+	}
+	return nil
+}
+
+// pgRestoreSelectionArgs returns the pg_restore arguments that limit a
+// restore to the selection, and the list file written for TOC entries,
+// which the caller removes
+func (s *BackupService) pgRestoreSelectionArgs(archivePath string, selection *RestoreSelection) ([]string, string, error) {
+	if selection.isEmpty() {
+		return nil, "", nil
+	}
+
+	var args []string
+	for _, schema := range selection.Schemas {
+		args = append(args, "-n", schema)
+	}
+	for _, table := range selection.Tables {
+		args = append(args, "-t", table)
+	}
+
+	if len(selection.TOCEntries) == 0 {
+		return args, "", nil
+	}
+	listPath, err := s.writeUseList(archivePath, selection.TOCEntries)
+	if err != nil {
+		return nil, "", err
+	}
+	return append(args, "-L", listPath), listPath, nil
+}
+
+// applyMongoRestoreSelection limits a mongorestore command to the selected
+// collections. The archive names them after the source database, before
+// they are renamed into the target.
+func applyMongoRestoreSelection(cmd *exec.Cmd, sourceDB string, selection *RestoreSelection) {
+	if cmd == nil || selection.isEmpty() {
+		return
+	}
+
+	for _, collection := range selection.Collections {
+		cmd.Args = append(cmd.Args, fmt.Sprintf("--nsInclude=%s.%s", sourceDB, collection))
+	}
+}
+
+// mongoArchiveNamespace matches the collections mongorestore --dryRun reports
+// finding in an archive
+var mongoArchiveNamespace = regexp.MustCompile(`(?:found collection|reading metadata for) ([^\s]+\.[^\s]+)`)
+
+// listMongoArchive returns the collections of a MongoDB archive as TOC
+// entries, with the database as schema
+func (s *BackupService) listMongoArchive(archivePath string) ([]TOCEntry, error) {
+	binaryPath := s.findDatabaseRestorePath("mongodb")
+	if binaryPath == "" {
+		return nil, fmt.Errorf("restore tool not found for mongodb. Please ensure mongorestore is installed")
+	}
+
+	args := []string{"--archive=" + archivePath, "--dryRun", "--verbose"}
+	if strings.HasSuffix(archivePath, mongoGzipExtension) {
+		args = append(args, "--gzip")
+	}
+
+	output, err := exec.Command(filepath.Join(binaryPath, common.GetPlatformExecutableName(restoreTools["mongodb"])), args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive collections: %s", strings.TrimSpace(string(output)))
+	}
+
+	entries := []TOCEntry{}
+	seen := make(map[string]bool)
+	for _, match := range mongoArchiveNamespace.FindAllStringSubmatch(string(output), -1) {
+		namespace := match[1]
+		if seen[namespace] {
+			continue
+		}
+		seen[namespace] = true
+
+		database, collection, _ := strings.Cut(namespace, ".")
+		entries = append(entries, TOCEntry{
+			ID:     len(entries) + 1,
+			Type:   "COLLECTION",
+			Schema: database,
+			Name:   collection,
+		})
+	}
+	return entries, nil
+}
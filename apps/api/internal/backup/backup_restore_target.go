@@ -0,0 +1,321 @@
+package backup
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// RestoreToConnectionRequest restores a backup into any connection of the
+// same engine family as its source, such as a production backup into staging
+type RestoreToConnectionRequest struct {
+	ConnectionID string `json:"connection_id"`
+	// DatabaseName overrides the target connection's database, defaulting to
+	// the backed up database when the connection names none
+	DatabaseName string `json:"database_name,omitempty"`
+	// CreateDatabase creates the target database if the server lacks it
+	CreateDatabase bool `json:"create_database"`
+	// KeepOwnership restores the owners, grants and definers of the source.
+	// They are left out by default, since the target's roles and users
+	// usually differ.
+	KeepOwnership bool              `json:"keep_ownership"`
+	OnConflict    string            `json:"on_conflict,omitempty"`
+	Selection     *RestoreSelection `json:"selection,omitempty"`
+	// DryRun previews the restore without changing the target
+	DryRun bool `json:"dry_run"`
+}
+
+// engineFamily groups the database types whose dumps restore into each other
+func engineFamily(dbType string) string {
+	if dbType == "mariadb" {
+		return "mysql"
+	}
+	return dbType
+}
+
+// RestoreToConnection restores a backup into another of the user's
+// connections
+func (s *BackupService) RestoreToConnection(backupID string, userID uuid.UUID, req *RestoreToConnectionRequest, access *ArtifactAccess) (*RestoreResult, error) {
+	return s.restoreToTarget(backupID, userID, req, restoreOrigin{trigger: RestoreTriggerRequest, access: access})
+}
+
+// restoreToTarget restores a backup into the connection a request names
+func (s *BackupService) restoreToTarget(backupID string, userID uuid.UUID, req *RestoreToConnectionRequest, origin restoreOrigin) (*RestoreResult, error) {
+	backup, target, err := s.resolveRestoreTarget(backupID, userID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.restoreInto(backup, target, restoreOptions{
+		selection:      req.Selection,
+		onConflict:     req.OnConflict,
+		createDatabase: req.CreateDatabase,
+		portable:       !req.KeepOwnership,
+		origin:         origin,
+	})
+}
+
+// resolveRestoreTarget loads a backup and the connection a request restores
+// it into, with the database it would be restored to
+func (s *BackupService) resolveRestoreTarget(backupID string, userID uuid.UUID, req *RestoreToConnectionRequest) (*Backup, *connection.StoredConnection, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	source, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(source, userID) {
+		return nil, nil, sql.ErrNoRows
+	}
+
+	target, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !s.connStorage.HasAccess(target, userID) {
+		return nil, nil, sql.ErrNoRows
+	}
+
+	if engineFamily(source.Type) != engineFamily(target.Type) {
+		return nil, nil, &RestoreTargetError{Reason: fmt.Sprintf("a %s backup cannot be restored into a %s connection", source.Type, target.Type)}
+	}
+	if target.Type == "redis" {
+		return nil, nil, &RestoreTargetError{Reason: "redis backups cannot be restored by velld"}
+	}
+
+	if err := renameRestoreTarget(target, req.DatabaseName); err != nil {
+		return nil, nil, err
+	}
+	if target.DatabaseName == "" && backup.DatabaseName != nil {
+		target.DatabaseName = *backup.DatabaseName
+	}
+	if target.DatabaseName == "" {
+		return nil, nil, &RestoreTargetError{Reason: "no target database given"}
+	}
+
+	return backup, target, nil
+}
+
+// RestoreTargetError rejects a target connection a backup cannot be restored
+// into
+type RestoreTargetError struct {
+	Reason string
+}
+
+func (e *RestoreTargetError) Error() string {
+	return e.Reason
+}
+
+var (
+	// pgOwnershipStatement matches the statements of a plain PostgreSQL dump
+	// that need the source's roles
+	pgOwnershipStatement = regexp.MustCompile(`^(ALTER .* OWNER TO |GRANT |REVOKE |SET SESSION AUTHORIZATION |ALTER DEFAULT PRIVILEGES )`)
+	// mysqlPrivilegedStatement matches the statements of a MySQL dump that
+	// need privileges a restoring user seldom has
+	mysqlPrivilegedStatement = regexp.MustCompile(`^SET @@(GLOBAL\.GTID_PURGED|SESSION\.SQL_LOG_BIN)`)
+	// mysqlDefiner matches the definer of views, triggers and routines
+	mysqlDefiner = regexp.MustCompile("DEFINER=`(?:[^`]|``)*`@`(?:[^`]|``)*`\\s*")
+)
+
+// dumpFilter rewrites a line of a plain SQL dump. Returning false drops the
+// statement the line starts.
+type dumpFilter func(line string) (string, bool)
+
+// portableDumpFilter leaves out the owners, grants and definers of the source
+// server. Archives restored by pg_restore or mongorestore get no filter.
+func portableDumpFilter(dbType, dumpPath string) dumpFilter {
+	switch dbType {
+	case "postgresql":
+		if isCustomDump(dumpPath) || isDirectoryDump(dumpPath) {
+			return nil
+		}
+		// Rows of COPY blocks are data and pass unchanged
+		inCopy := false
+		return func(line string) (string, bool) {
+			if inCopy {
+				inCopy = line != `\.`
+				return line, true
+			}
+			if strings.HasPrefix(line, "COPY ") && strings.HasSuffix(line, "FROM stdin;") {
+				inCopy = true
+				return line, true
+			}
+			return line, !pgOwnershipStatement.MatchString(line)
+		}
+	case "mysql", "mariadb":
+		return func(line string) (string, bool) {
+			if mysqlPrivilegedStatement.MatchString(line) {
+				return "", false
+			}
+			return mysqlDefiner.ReplaceAllString(line, ""), true
+		}
+	default:
+		return nil
+	}
+}
+
+// rewriteDumpCopy writes a copy of a plain SQL dump passed through the
+// filters, and returns its path. Without filters no copy is written.
+func rewriteDumpCopy(dumpPath string, filters ...dumpFilter) (string, error) {
+	var active []dumpFilter
+	for _, filter := range filters {
+		if filter != nil {
+			active = append(active, filter)
+		}
+	}
+	if len(active) == 0 {
+		return "", nil
+	}
+
+	in, err := os.Open(dumpPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup file: %v", err)
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp("", "velld-restore-*.sql")
+	if err != nil {
+		return "", fmt.Errorf("failed to create rewritten dump: %v", err)
+	}
+	defer out.Close()
+
+	chained := func(line string) (string, bool) {
+		for _, filter := range active {
+			var keep bool
+			if line, keep = filter(line); !keep {
+				return "", false
+			}
+		}
+		return line, true
+	}
+	if err := filterDumpStatements(in, out, chained); err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("failed to write rewritten dump: %v", err)
+	}
+	return out.Name(), nil
+}
+
+// filterDumpStatements copies a dump line by line. A statement the filter
+// drops is skipped up to the line that ends it.
+func filterDumpStatements(r io.Reader, w io.Writer, filter dumpFilter) error {
+	reader := bufio.NewReader(r)
+	writer := bufio.NewWriter(w)
+	skipping := false
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			content := strings.TrimRight(line, "\r\n")
+			if skipping {
+				skipping = !strings.HasSuffix(content, ";")
+			} else if filtered, keep := filter(content); !keep {
+				skipping = !strings.HasSuffix(content, ";")
+			} else {
+				if _, werr := writer.WriteString(filtered + line[len(content):]); werr != nil {
+					return werr
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+func (h *BackupHandler) RestoreToConnection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	var req RestoreToConnectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.ConnectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.restoreToConnection(w, r, backupID, userID, &req)
+}
+
+// restoreToConnection previews or runs a restore into another connection,
+// recording the access to the artifact
+func (h *BackupHandler) restoreToConnection(w http.ResponseWriter, r *http.Request, backupID string, userID uuid.UUID, req *RestoreToConnectionRequest) {
+	if req.DryRun {
+		preview, err := h.backupService.PreviewRestoreToConnection(backupID, userID, req)
+		if err != nil {
+			sendRestoreError(w, err)
+			return
+		}
+		response.SendSuccess(w, "Restore preview generated successfully", preview)
+		return
+	}
+
+	access := newArtifactAccess(r, backupID, userID, AccessRestore)
+	detail := "connection " + req.ConnectionID
+	if req.DatabaseName != "" {
+		detail += " database " + req.DatabaseName
+	}
+	access.Detail = &detail
+	if !req.Selection.isEmpty() {
+		access.Selection = req.Selection
+	}
+	if err := h.backupService.recordArtifactAccess(access); err != nil {
+		sendAccessError(w, err)
+		return
+	}
+
+	result, err := h.backupService.RestoreToConnection(backupID, userID, req, access)
+	if err != nil {
+		sendRestoreError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Backup restored successfully", result)
+}
+
+// sendRestoreError maps the errors of restoring a backup, or previewing the
+// restore, to a response
+func sendRestoreError(w http.ResponseWriter, err error) {
+	var conflict *RestoreConflictError
+	var invalidTarget *RestoreTargetError
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Backup or connection not found")
+	case errors.As(err, &conflict), errors.Is(err, ErrRestoreCancelled):
+		response.SendError(w, http.StatusConflict, err.Error())
+	case errors.As(err, &invalidTarget):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
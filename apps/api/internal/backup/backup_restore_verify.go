@@ -0,0 +1,396 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Restore verification states recorded on a backup
+const (
+	RestoreVerificationRunning = "running"
+	RestoreVerificationPassed  = "passed"
+	RestoreVerificationFailed  = "failed"
+	RestoreVerificationSkipped = "skipped"
+)
+
+// validateVerifyConnection checks the scratch connection submitted with a
+// schedule request. An empty ID disables verify-by-restore.
+func (s *BackupService) validateVerifyConnection(sourceID string, verifyID *string) (*string, error) {
+	if verifyID == nil {
+		return nil, nil
+	}
+
+	trimmed := strings.TrimSpace(*verifyID)
+	if trimmed == "" {
+		return nil, nil
+	}
+
+	if trimmed == sourceID {
+		return nil, fmt.Errorf("verification connection must be different from the backed up connection")
+	}
+
+	source, err := s.connStorage.GetConnection(sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	scratch, err := s.connStorage.GetConnection(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("verification connection not found")
+	}
+
+	if scratch.UserID != source.UserID {
+		return nil, fmt.Errorf("verification connection not found")
+	}
+
+	if scratch.Type != source.Type {
+		return nil, fmt.Errorf("verification connection must be a %s connection", source.Type)
+	}
+
+	if _, ok := restoreTools[scratch.Type]; !ok {
+		return nil, fmt.Errorf("restore verification is not supported for %s", scratch.Type)
+	}
+
+	return &trimmed, nil
+}
+
+// verifyBackupByRestoreIfConfigured runs verify-by-restore in the background
+// when the connection's schedule has a scratch connection configured.
+func (s *BackupService) verifyBackupByRestoreIfConfigured(backup *Backup, schedule *BackupSchedule) {
+	if schedule == nil || schedule.VerifyConnectionID == nil {
+		return
+	}
+
+	if err := s.backupRepo.UpdateRestoreVerificationStatus(backup.ID.String(), RestoreVerificationRunning); err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to update restore verification status", "backup_id", backup.ID, "error", err)
+	}
+
+	go func() {
+		if _, err := s.verifyBackupByRestore(backup, *schedule.VerifyConnectionID); err != nil {
+			slog.WarnContext(backupContext(backup), "Restore verification could not run", "backup_id", backup.ID, "error", err)
+		}
+	}()
+}
+
+// verifyBackupByRestore restores the backup into a disposable database on the
+// scratch connection's server, compares table row counts with the source
+// database and drops the scratch database again.
+func (s *BackupService) verifyBackupByRestore(backup *Backup, scratchConnectionID string) (*RestoreVerification, error) {
+	result := &RestoreVerification{
+		ID:                  uuid.New(),
+		BackupID:            backup.ID.String(),
+		ScratchConnectionID: scratchConnectionID,
+		Tables:              []RestoreTableCheck{},
+		Warnings:            []string{},
+		StartedAt:           time.Now(),
+	}
+
+	err := s.runRestoreVerification(backup, scratchConnectionID, result)
+	switch {
+	case result.Status != "":
+		// Status already decided, e.g. skipped
+	case err != nil:
+		result.Status = RestoreVerificationFailed
+		result.Error = err.Error()
+	default:
+		result.Status = RestoreVerificationPassed
+	}
+
+	now := time.Now()
+	result.CompletedAt = &now
+
+	if err := s.backupRepo.CreateRestoreVerification(result); err != nil {
+		return nil, fmt.Errorf("failed to record restore verification: %v", err)
+	}
+	if err := s.backupRepo.UpdateRestoreVerificationStatus(result.BackupID, result.Status); err != nil {
+		return nil, fmt.Errorf("failed to update restore verification status: %v", err)
+	}
+
+	if result.Status == RestoreVerificationFailed {
+		verifyErr := fmt.Errorf("restore verification failed: %s", result.Error)
+		if notifyErr := s.createFailureNotification(backup.ConnectionID, verifyErr); notifyErr != nil {
+			slog.ErrorContext(backupContext(backup), "Failed to create failure notification", "error", notifyErr)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *BackupService) runRestoreVerification(backup *Backup, scratchConnectionID string, result *RestoreVerification) error {
+	if isGPGEncrypted(backup) {
+		result.Status = RestoreVerificationSkipped
+		result.Error = "backup is GPG encrypted and cannot be restored by velld"
+		return nil
+	}
+	if isPhysicalBackup(plainDumpPath(backup)) {
+		result.Status = RestoreVerificationSkipped
+		result.Error = "physical backups are restored into a data directory, not a database"
+		return nil
+	}
+
+	source, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	scratch, err := s.connStorage.GetConnection(scratchConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get verification connection: %v", err)
+	}
+
+	if scratch.Type != source.Type {
+		return fmt.Errorf("verification connection type %s does not match %s", scratch.Type, source.Type)
+	}
+
+	filePath, isTemp, err := s.ensureBackupContentAvailable(backup, source.UserID)
+	if err != nil {
+		return err
+	}
+	if isTemp {
+		defer os.Remove(filePath)
+	}
+
+	scratchDB := "velld_verify_" + strings.ReplaceAll(backup.ID.String(), "-", "")[:12]
+	if err := s.connService.CreateScratchDatabase(scratch, scratchDB); err != nil {
+		return fmt.Errorf("failed to create scratch database: %v", err)
+	}
+	defer func() {
+		if err := s.connService.DropScratchDatabase(scratch, scratchDB); err != nil {
+			slog.WarnContext(backupContext(backup), "Failed to drop scratch database", "database", scratchDB, "error", err)
+		}
+	}()
+
+	target := *scratch
+	target.DatabaseName = scratchDB
+
+	// A dump that switches to the database it was taken from would
+	// otherwise be restored over the source
+	renamedPath, err := rewriteDumpCopy(filePath, renameDumpFilter(target.Type, filePath, scratchDB))
+	if err != nil {
+		return err
+	}
+	if renamedPath != "" {
+		defer os.Remove(renamedPath)
+		filePath = renamedPath
+	}
+
+	if err := s.restoreIntoConnection(&target, filePath); err != nil {
+		return err
+	}
+
+	restored, err := s.connService.InspectDatabase(&target)
+	if err != nil {
+		return fmt.Errorf("failed to inspect restored database: %v", err)
+	}
+
+	// The source is inspected now rather than at dump time, so differing row
+	// counts are reported as warnings only.
+	sourceRows := make(map[string]int64)
+	sourceDB := *source
+	sourceDB.DatabaseName = databaseNameFromBackup(backup, source)
+	if inspection, err := s.connService.InspectDatabase(&sourceDB); err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("could not inspect source database: %v", err))
+	} else {
+		for _, table := range inspection.Tables {
+			sourceRows[table.Name] = table.Rows
+		}
+	}
+
+	restoredTables := make(map[string]bool)
+	for _, table := range restored.Tables {
+		restoredTables[table.Name] = true
+		check := RestoreTableCheck{Name: table.Name, RestoredRows: table.Rows}
+		if rows, ok := sourceRows[table.Name]; ok {
+			check.SourceRows = &rows
+			if rows != table.Rows {
+				result.Warnings = append(result.Warnings,
+					fmt.Sprintf("%s has %d rows in the source and %d after restore", table.Name, rows, table.Rows))
+			}
+		}
+		result.Tables = append(result.Tables, check)
+	}
+
+	var missing []string
+	for name := range sourceRows {
+		if !restoredTables[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%d table(s) missing after restore: %s", len(missing), strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// restoreIntoConnection restores a backup file into the connection's database
+func (s *BackupService) restoreIntoConnection(conn *connection.StoredConnection, filePath string) error {
+	if err := s.verifyRestoreTools(conn.Type); err != nil {
+		return err
+	}
+
+	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(conn)
+	if err != nil {
+		return fmt.Errorf("failed to setup SSH tunnel: %v", err)
+	}
+	if tunnel != nil {
+		defer tunnel.Stop()
+		tunneled := *conn
+		tunneled.Host = effectiveHost
+		tunneled.Port = effectivePort
+		conn = &tunneled
+	}
+
+	var cmd *exec.Cmd
+	switch conn.Type {
+	case "postgresql":
+		if isDirectoryDump(filePath) {
+			return s.restoreDirectoryDump(conn, filePath, nil, false, nil)
+		}
+		if isCustomDump(filePath) {
+			return s.restoreCustomDump(conn, filePath, nil, false, nil)
+		}
+		cmd = s.createPsqlRestoreCmd(conn, filePath)
+	case "mysql", "mariadb":
+		cmd = s.createMySQLRestoreCmd(conn, filePath)
+	case "mongodb":
+		cmd = s.createMongoRestoreCmd(conn, filePath)
+	default:
+		return fmt.Errorf("unsupported database type for restore: %s", conn.Type)
+	}
+
+	if cmd == nil {
+		return fmt.Errorf("restore tool not found for %s. Please ensure %s is installed", conn.Type, restoreTools[conn.Type])
+	}
+	if input, ok := cmd.Stdin.(*os.File); ok {
+		defer input.Close()
+	}
+
+	output, err := cmd.CombinedOutput()
+	return s.validateRestoreOutput(conn.Type, conn.DatabaseName, output, err)
+}
+
+// databaseNameFromBackup resolves which database a backup was taken from.
+// Multi-database backups are named "<database>_<timestamp>.sql", and backups
+// of databases selected by their schedule record the database name.
+func databaseNameFromBackup(backup *Backup, conn *connection.StoredConnection) string {
+	if backup.DatabaseName != nil && *backup.DatabaseName != "" {
+		return *backup.DatabaseName
+	}
+	for _, dbName := range conn.SelectedDatabases {
+		if strings.HasPrefix(filepath.Base(backup.Path), dbName+"_") {
+			return dbName
+		}
+	}
+	return conn.DatabaseName
+}
+
+// VerifyBackupByRestore runs verify-by-restore on demand using the scratch
+// connection configured on the backup's schedule.
+func (s *BackupService) VerifyBackupByRestore(backupID string, userID uuid.UUID) (*RestoreVerification, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	schedule, err := s.backupRepo.GetBackupSchedule(backup.ConnectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get backup schedule: %v", err)
+	}
+	if schedule == nil || schedule.VerifyConnectionID == nil {
+		return nil, fmt.Errorf("no verification connection configured for this connection")
+	}
+
+	return s.verifyBackupByRestore(backup, *schedule.VerifyConnectionID)
+}
+
+func (s *BackupService) GetRestoreVerification(backupID string, userID uuid.UUID) (*RestoreVerification, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.backupRepo.GetLatestRestoreVerification(backupID)
+}
+
+func (h *BackupHandler) VerifyBackupByRestore(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.backupService.recordArtifactAccess(newArtifactAccess(r, backupID, userID, AccessRestoreVerification)); err != nil {
+		sendAccessError(w, err)
+		return
+	}
+
+	result, err := h.backupService.VerifyBackupByRestore(backupID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Restore verification completed", result)
+}
+
+func (h *BackupHandler) GetRestoreVerification(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.backupService.GetRestoreVerification(backupID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Restore verification not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Restore verification retrieved successfully", result)
+}
@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// RetentionPreviewRequest is a retention policy to try out. Unset fields use
+// the connection's schedule.
+type RetentionPreviewRequest struct {
+	RetentionDays     *int   `json:"retention_days,omitempty"`
+	RetentionMaxBytes *int64 `json:"retention_max_bytes,omitempty"`
+}
+
+// RetentionPreviewBackup is a backup the policy would delete
+type RetentionPreviewBackup struct {
+	ID          uuid.UUID `json:"id"`
+	Path        string    `json:"path"`
+	S3ObjectKey *string   `json:"s3_object_key"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Reason is retention for backups past retention_days and storage_quota
+	// for backups beyond retention_max_bytes
+	Reason string `json:"reason"`
+}
+
+// RetentionPreview lists what a retention policy would delete on the next
+// scheduled run, without deleting anything
+type RetentionPreview struct {
+	ConnectionID      string                    `json:"connection_id"`
+	RetentionDays     int                       `json:"retention_days"`
+	RetentionMaxBytes int64                     `json:"retention_max_bytes"`
+	Deleted           []*RetentionPreviewBackup `json:"deleted"`
+	ReclaimedBytes    int64                     `json:"reclaimed_bytes"`
+	KeptBackups       int                       `json:"kept_backups"`
+	KeptBytes         int64                     `json:"kept_bytes"`
+}
+
+// PreviewRetention applies a retention policy to one of the user's
+// connections the way a scheduled run would, age first and then the storage
+// quota, and reports the backups it would delete
+func (s *BackupService) PreviewRetention(connectionID string, userID uuid.UUID, req *RetentionPreviewRequest) (*RetentionPreview, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	if err := validateStorageQuota(req.RetentionMaxBytes); err != nil {
+		return nil, err
+	}
+	if req.RetentionDays != nil && *req.RetentionDays < 0 {
+		return nil, fmt.Errorf("retention_days cannot be negative")
+	}
+
+	preview := &RetentionPreview{ConnectionID: connectionID, Deleted: []*RetentionPreviewBackup{}}
+	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get backup schedule: %v", err)
+	}
+	if schedule != nil {
+		preview.RetentionDays = schedule.RetentionDays
+		preview.RetentionMaxBytes = schedule.RetentionMaxBytes
+	}
+	if req.RetentionDays != nil {
+		preview.RetentionDays = *req.RetentionDays
+	}
+	if req.RetentionMaxBytes != nil {
+		preview.RetentionMaxBytes = *req.RetentionMaxBytes
+	}
+
+	backups, err := s.backupRepo.GetCompletedBackupsNewestFirst(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backups: %v", err)
+	}
+
+	deleted := make(map[uuid.UUID]bool)
+	remove := func(backup *Backup, reason string) {
+		deleted[backup.ID] = true
+		preview.ReclaimedBytes += backup.Size
+		preview.Deleted = append(preview.Deleted, &RetentionPreviewBackup{
+			ID:          backup.ID,
+			Path:        backup.Path,
+			S3ObjectKey: backup.S3ObjectKey,
+			Size:        backup.Size,
+			CreatedAt:   backup.CreatedAt,
+			Reason:      reason,
+		})
+	}
+
+	if preview.RetentionDays > 0 {
+		expired, err := s.backupRepo.GetBackupsOlderThan(connectionID, time.Now().AddDate(0, 0, -preview.RetentionDays))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get expired backups: %v", err)
+		}
+		for _, backup := range expired {
+			remove(backup, DeletionReasonRetention)
+		}
+	}
+
+	var remaining []*Backup
+	for _, backup := range backups {
+		if !deleted[backup.ID] {
+			remaining = append(remaining, backup)
+		}
+	}
+	if preview.RetentionMaxBytes > 0 {
+		for _, backup := range backupsOverQuota(remaining, preview.RetentionMaxBytes) {
+			remove(backup, DeletionReasonStorageQuota)
+		}
+	}
+
+	for _, backup := range remaining {
+		if !deleted[backup.ID] {
+			preview.KeptBackups++
+			preview.KeptBytes += backup.Size
+		}
+	}
+	return preview, nil
+}
+
+func (h *BackupHandler) PreviewRetention(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The body is optional; without one the schedule's policy is previewed
+	var req RetentionPreviewRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	preview, err := h.backupService.PreviewRetention(mux.Vars(r)["connection_id"], userID, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Retention preview generated successfully", preview)
+}
@@ -0,0 +1,262 @@
+package backup
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+)
+
+const (
+	DeletionReasonRetention       = "retention"
+	DeletionReasonStorageQuota    = "storage_quota"
+	DeletionReasonMissingArtifact = "missing_artifact"
+)
+
+// dataClassTagPrefix marks connection tags that describe the kind of data
+// stored, e.g. "class:pii" or "class:phi"
+const dataClassTagPrefix = "class:"
+
+// ComplianceFramework describes the retention expectations of a regulatory
+// framework. Connections opt in by carrying the framework key as a tag.
+type ComplianceFramework struct {
+	Key              string `json:"key"`
+	Name             string `json:"name"`
+	Description      string `json:"description"`
+	MinRetentionDays int    `json:"min_retention_days,omitempty"`
+	MaxRetentionDays int    `json:"max_retention_days,omitempty"`
+}
+
+var complianceFrameworks = map[string]ComplianceFramework{
+	"gdpr": {
+		Key:         "gdpr",
+		Name:        "GDPR",
+		Description: "Storage limitation: personal data must not be kept longer than necessary, so a retention policy is required",
+	},
+	"hipaa": {
+		Key:              "hipaa",
+		Name:             "HIPAA",
+		Description:      "Records must be retained for at least six years",
+		MinRetentionDays: 6 * 365,
+	},
+	"sox": {
+		Key:              "sox",
+		Name:             "SOX",
+		Description:      "Financial records must be retained for at least seven years",
+		MinRetentionDays: 7 * 365,
+	},
+	"pci-dss": {
+		Key:              "pci-dss",
+		Name:             "PCI DSS",
+		Description:      "Audit data must be retained for at least one year",
+		MinRetentionDays: 365,
+	},
+}
+
+type BackupDeletion struct {
+	BackupID        string  `json:"backup_id"`
+	Path            string  `json:"path"`
+	S3ObjectKey     *string `json:"s3_object_key"`
+	Size            int64   `json:"size"`
+	Reason          string  `json:"reason"`
+	BackupCreatedAt string  `json:"backup_created_at"`
+	DeletedAt       string  `json:"deleted_at"`
+}
+
+type ConnectionRetentionReport struct {
+	ConnectionID    string            `json:"connection_id"`
+	Name            string            `json:"name"`
+	Type            string            `json:"type"`
+	Tags            []string          `json:"tags"`
+	DataClasses     []string          `json:"data_classes"`
+	Frameworks      []string          `json:"frameworks"`
+	RetentionDays   *int              `json:"retention_days"`
+	RetainedBackups int               `json:"retained_backups"`
+	RetainedSize    int64             `json:"retained_size"`
+	OldestBackup    *time.Time        `json:"oldest_backup"`
+	NewestBackup    *time.Time        `json:"newest_backup"`
+	Deletions       []*BackupDeletion `json:"deletions"`
+	Violations      []string          `json:"violations"`
+	Compliant       bool              `json:"compliant"`
+}
+
+type RetentionReport struct {
+	GeneratedAt time.Time                    `json:"generated_at"`
+	From        time.Time                    `json:"from"`
+	To          time.Time                    `json:"to"`
+	Framework   *ComplianceFramework         `json:"framework,omitempty"`
+	Compliant   bool                         `json:"compliant"`
+	Connections []*ConnectionRetentionReport `json:"connections"`
+}
+
+// GetRetentionReport builds a retention compliance report for the user's
+// connections, optionally limited to connections tagged with a framework.
+func (s *BackupService) GetRetentionReport(userID uuid.UUID, frameworkKey string, from, to time.Time) (*RetentionReport, error) {
+	report := &RetentionReport{
+		GeneratedAt: time.Now(),
+		From:        from,
+		To:          to,
+		Compliant:   true,
+		Connections: []*ConnectionRetentionReport{},
+	}
+
+	if frameworkKey != "" {
+		framework, ok := complianceFrameworks[strings.ToLower(frameworkKey)]
+		if !ok {
+			return nil, fmt.Errorf("unknown compliance framework: %s", frameworkKey)
+		}
+		report.Framework = &framework
+	}
+
+	connections, err := s.connStorage.ListByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connections: %v", err)
+	}
+
+	for _, conn := range connections {
+		if report.Framework != nil && !hasTag(conn.Tags, report.Framework.Key) {
+			continue
+		}
+
+		entry := &ConnectionRetentionReport{
+			ConnectionID:  conn.ID,
+			Name:          conn.Name,
+			Type:          conn.Type,
+			Tags:          conn.Tags,
+			DataClasses:   []string{},
+			Frameworks:    []string{},
+			RetentionDays: conn.RetentionDays,
+			Violations:    []string{},
+		}
+
+		for _, tag := range conn.Tags {
+			if strings.HasPrefix(tag, dataClassTagPrefix) {
+				entry.DataClasses = append(entry.DataClasses, strings.TrimPrefix(tag, dataClassTagPrefix))
+			}
+			if _, ok := complianceFrameworks[tag]; ok {
+				entry.Frameworks = append(entry.Frameworks, tag)
+			}
+		}
+
+		backups, err := s.backupRepo.GetBackupsByConnectionID(conn.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get backups for connection %s: %v", conn.ID, err)
+		}
+
+		var overdue int
+		for _, backup := range backups {
+			if backup.Status != "completed" {
+				continue
+			}
+			entry.RetainedBackups++
+			entry.RetainedSize += backup.Size
+
+			createdAt := backup.CreatedAt
+			if entry.OldestBackup == nil || createdAt.Before(*entry.OldestBackup) {
+				entry.OldestBackup = &createdAt
+			}
+			if entry.NewestBackup == nil || createdAt.After(*entry.NewestBackup) {
+				entry.NewestBackup = &createdAt
+			}
+
+			if conn.RetentionDays != nil && time.Since(createdAt) > time.Duration(*conn.RetentionDays)*24*time.Hour {
+				overdue++
+			}
+		}
+
+		entry.Deletions, err = s.backupRepo.GetBackupDeletions(conn.ID, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deletions for connection %s: %v", conn.ID, err)
+		}
+
+		if conn.RetentionDays == nil {
+			entry.Violations = append(entry.Violations, "no retention policy configured")
+		}
+		if overdue > 0 {
+			entry.Violations = append(entry.Violations,
+				fmt.Sprintf("%d backup(s) retained longer than the configured retention period", overdue))
+		}
+
+		for _, key := range entry.Frameworks {
+			framework := complianceFrameworks[key]
+			if conn.RetentionDays == nil {
+				continue
+			}
+			if framework.MinRetentionDays > 0 && *conn.RetentionDays < framework.MinRetentionDays {
+				entry.Violations = append(entry.Violations,
+					fmt.Sprintf("%s requires at least %d days of retention, configured %d", framework.Name, framework.MinRetentionDays, *conn.RetentionDays))
+			}
+			if framework.MaxRetentionDays > 0 && *conn.RetentionDays > framework.MaxRetentionDays {
+				entry.Violations = append(entry.Violations,
+					fmt.Sprintf("%s allows at most %d days of retention, configured %d", framework.Name, framework.MaxRetentionDays, *conn.RetentionDays))
+			}
+		}
+
+		entry.Compliant = len(entry.Violations) == 0
+		if !entry.Compliant {
+			report.Compliant = false
+		}
+
+		report.Connections = append(report.Connections, entry)
+	}
+
+	sort.Slice(report.Connections, func(i, j int) bool {
+		return report.Connections[i].Name < report.Connections[j].Name
+	})
+
+	return report, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *BackupHandler) GetRetentionReport(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		if from, err = parseReportDate(fromStr); err != nil {
+			response.SendError(w, http.StatusBadRequest, "invalid from date")
+			return
+		}
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		if to, err = parseReportDate(toStr); err != nil {
+			response.SendError(w, http.StatusBadRequest, "invalid to date")
+			return
+		}
+	}
+
+	report, err := h.backupService.GetRetentionReport(userID, r.URL.Query().Get("framework"), from, to)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Retention report generated successfully", report)
+}
+
+// parseReportDate accepts either a plain date or a full RFC3339 timestamp
+func parseReportDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return common.ParseTime(value)
+}
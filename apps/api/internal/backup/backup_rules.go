@@ -0,0 +1,353 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/rules"
+	"github.com/google/uuid"
+)
+
+// defaultRuleCheckSchedule checks no_backup rules every 10 minutes
+const defaultRuleCheckSchedule = "0 */10 * * * *"
+
+// ruleRunHistory is how many runs are looked at to count a failure streak
+const ruleRunHistory = 100
+
+// minSizeSamples is how many backups a size average needs before deviations
+// from it notify, so the first backups of a connection don't
+const minSizeSamples = 3
+
+// runFailed tells whether a run counts as a failure for rules. Cancelled and
+// skipped runs are neither failures nor successes.
+func runFailed(status string) bool {
+	return status == RunStatusFailed || status == RunStatusTimedOut || status == RunStatusPartial
+}
+
+// evaluateRunRules evaluates the rules of the connection's owner against a
+// finished run
+func (s *BackupService) evaluateRunRules(run *BackupRun) {
+	if s.ruleService == nil || (!runFailed(run.Status) && run.Status != RunStatusSuccess) {
+		return
+	}
+	conn, err := s.connStorage.GetConnection(run.ConnectionID)
+	if err != nil {
+		return
+	}
+
+	if run.Status == RunStatusSuccess {
+		s.evaluateSizeRules(conn, run)
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"connection_id":   conn.ID,
+		"connection_name": conn.Name,
+		"database_name":   conn.DatabaseName,
+		"database_type":   conn.Type,
+		"run_id":          run.ID,
+	}
+	if run.Error != nil {
+		metadata["error"] = *run.Error
+	}
+
+	failureRules, err := s.ruleService.MatchingRules(conn.UserID, conn.ID, rules.ConditionFailure)
+	if err != nil {
+		slog.WarnContext(run.processes.jobContext(), "Failed to get notification rules of connection", "connection_id", conn.ID, "error", err)
+		return
+	}
+	for _, rule := range failureRules {
+		s.triggerRule(rule, conn, fmt.Sprintf("Backup run of '%s' %s", conn.Name, runOutcome(run.Status)), metadata)
+	}
+
+	streakRules, err := s.ruleService.MatchingRules(conn.UserID, conn.ID, rules.ConditionConsecutiveFailures)
+	if err != nil || len(streakRules) == 0 {
+		return
+	}
+	streak, err := s.failureStreak(conn.ID)
+	if err != nil {
+		slog.WarnContext(run.processes.jobContext(), "Failed to count failed runs of connection", "connection_id", conn.ID, "error", err)
+		return
+	}
+	metadata["failed_runs"] = streak
+	for _, rule := range streakRules {
+		// Only the run reaching the threshold notifies, not every run after it
+		if streak == rule.Threshold {
+			s.triggerRule(rule, conn, fmt.Sprintf("%d backup runs of '%s' failed in a row", streak, conn.Name), metadata)
+		}
+	}
+}
+
+// formatWindow describes a rule window in days when it is whole days
+func formatWindow(hours int) string {
+	switch {
+	case hours == 24:
+		return "day"
+	case hours%24 == 0:
+		return fmt.Sprintf("%d days", hours/24)
+	case hours == 1:
+		return "hour"
+	default:
+		return fmt.Sprintf("%d hours", hours)
+	}
+}
+
+func runOutcome(status string) string {
+	switch status {
+	case RunStatusPartial:
+		return "partially failed"
+	case RunStatusTimedOut:
+		return "timed out"
+	default:
+		return "failed"
+	}
+}
+
+// failureStreak counts the failed runs of a connection since its last
+// successful one
+func (s *BackupService) failureStreak(connectionID string) (int, error) {
+	runs, err := s.backupRepo.GetBackupRunsByConnectionID(connectionID, ruleRunHistory)
+	if err != nil {
+		return 0, err
+	}
+
+	streak := 0
+	for _, run := range runs {
+		if run.Status == RunStatusSuccess {
+			break
+		}
+		if runFailed(run.Status) {
+			streak++
+		}
+	}
+	return streak, nil
+}
+
+// evaluateSizeRules compares each backup of a successful run with the
+// average size of the database's backups in the window of the rule
+func (s *BackupService) evaluateSizeRules(conn *connection.StoredConnection, run *BackupRun) {
+	sizeRules, err := s.ruleService.MatchingRules(conn.UserID, conn.ID, rules.ConditionSizeDeviation)
+	if err != nil || len(sizeRules) == 0 {
+		return
+	}
+	backups, err := s.backupRepo.GetBackupsByRunID(run.ID.String())
+	if err != nil {
+		slog.WarnContext(run.processes.jobContext(), "Failed to get backups of run", "run_id", run.ID, "error", err)
+		return
+	}
+
+	for _, backup := range backups {
+		if backup.Status != "completed" || backup.Size <= 0 {
+			continue
+		}
+		for _, rule := range sizeRules {
+			window := time.Duration(rule.WindowHours) * time.Hour
+			average, samples, err := s.backupRepo.GetAverageBackupSize(conn.ID, backup.DatabaseName, backup.CreatedAt.Add(-window), backup.CreatedAt)
+			if err != nil {
+				slog.WarnContext(run.processes.jobContext(), "Failed to get average backup size of connection", "connection_id", conn.ID, "error", err)
+				continue
+			}
+			if samples < minSizeSamples || average <= 0 {
+				continue
+			}
+
+			deviation := (float64(backup.Size) - average) / average * 100
+			if math.Abs(deviation) <= float64(rule.Threshold) {
+				continue
+			}
+
+			direction := "larger"
+			if deviation < 0 {
+				direction = "smaller"
+			}
+			databaseName := conn.DatabaseName
+			if backup.DatabaseName != nil {
+				databaseName = *backup.DatabaseName
+			}
+			message := fmt.Sprintf("Backup of '%s' is %s, %.0f%% %s than its average of %s over the last %s",
+				databaseName, formatBytes(backup.Size), math.Abs(deviation), direction,
+				formatBytes(int64(average)), formatWindow(rule.WindowHours))
+			s.triggerRule(rule, conn, message, map[string]interface{}{
+				"connection_id":   conn.ID,
+				"connection_name": conn.Name,
+				"database_name":   databaseName,
+				"database_type":   conn.Type,
+				"backup_id":       backup.ID,
+				"size":            formatBytes(backup.Size),
+				"average_size":    formatBytes(int64(average)),
+				"deviation":       fmt.Sprintf("%+.0f%%", deviation),
+			})
+		}
+	}
+}
+
+func (s *BackupService) scheduleRuleChecks() {
+	schedule := strings.TrimSpace(os.Getenv("NOTIFICATION_RULES_SCHEDULE"))
+	if strings.EqualFold(schedule, "off") {
+		return
+	}
+	if schedule == "" {
+		schedule = defaultRuleCheckSchedule
+	}
+
+	if _, err := s.cronManager.AddFunc(schedule, s.checkNoBackupRules); err != nil {
+		slog.Error("Failed to schedule notification rule checks", "error", err)
+	}
+	if _, err := s.cronManager.AddFunc(schedule, s.checkSLARules); err != nil {
+		slog.Error("Failed to schedule SLA rule checks", "error", err)
+	}
+}
+
+// checkNoBackupRules notifies for each connection without a successful
+// backup in the window of a no_backup rule. A rule notifies once per
+// connection until the connection is backed up again; connections of paused
+// schedules are left out.
+func (s *BackupService) checkNoBackupRules() {
+	if s.ruleService == nil {
+		return
+	}
+	noBackupRules, err := s.ruleService.EnabledRules(rules.ConditionNoBackup)
+	if err != nil {
+		slog.Error("Failed to check notification rules", "error", err)
+		return
+	}
+
+	for _, rule := range noBackupRules {
+		var connectionIDs []string
+		if rule.ConnectionID != nil {
+			connectionIDs = []string{*rule.ConnectionID}
+		} else {
+			conns, err := s.connStorage.ListByUserID(rule.UserID)
+			if err != nil {
+				slog.Warn("Failed to list connections of user", "user_id", rule.UserID, "error", err)
+				continue
+			}
+			for _, conn := range conns {
+				connectionIDs = append(connectionIDs, conn.ID)
+			}
+		}
+
+		for _, connectionID := range connectionIDs {
+			s.checkNoBackupRule(rule, connectionID)
+		}
+	}
+}
+
+func (s *BackupService) checkNoBackupRule(rule *rules.Rule, connectionID string) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil || !s.connStorage.HasAccess(conn, rule.UserID) {
+		return
+	}
+	if schedule, err := s.backupRepo.GetBackupSchedule(conn.ID); err == nil && schedule.Paused {
+		return
+	}
+
+	// A connection never backed up is measured from its creation
+	since, err := common.ParseTime(conn.CreatedAt)
+	latest, latestErr := s.backupRepo.GetLatestCompletedBackup(conn.ID)
+	if latestErr == nil {
+		since, err = latest.CreatedAt, nil
+	}
+	if err != nil {
+		return
+	}
+
+	window := time.Duration(rule.WindowHours) * time.Hour
+	if time.Since(since) < window {
+		return
+	}
+	last, err := s.ruleService.LatestEvent(rule.ID, conn.ID)
+	if err != nil {
+		slog.Warn("Failed to get events of notification rule", "rule_id", rule.ID, "error", err)
+		return
+	}
+	if last != nil && last.TriggeredAt.After(since) {
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"connection_id":   conn.ID,
+		"connection_name": conn.Name,
+		"database_name":   conn.DatabaseName,
+		"database_type":   conn.Type,
+	}
+	message := fmt.Sprintf("'%s' has no successful backup in the last %s", conn.Name, formatWindow(rule.WindowHours))
+	if latestErr == nil {
+		metadata["last_backup_at"] = since.Format(time.RFC3339)
+		message = fmt.Sprintf("'%s' has no successful backup since %s", conn.Name, since.Format(time.RFC3339))
+	}
+	s.triggerRule(rule, conn, message, metadata)
+}
+
+// triggerRule records that a rule matched and delivers its notification
+// through every channel of the rule, recording each delivery under the
+// event's ID
+func (s *BackupService) triggerRule(rule *rules.Rule, conn *connection.StoredConnection, message string, metadata map[string]interface{}) {
+	now := time.Now()
+	event := &rules.RuleEvent{
+		ID:           uuid.New(),
+		RuleID:       rule.ID,
+		UserID:       rule.UserID,
+		ConnectionID: conn.ID,
+		Message:      message,
+		TriggeredAt:  now,
+	}
+	if err := s.ruleService.RecordEvent(event); err != nil {
+		slog.Warn("Failed to record event of notification rule", "rule_id", rule.ID, "error", err)
+	}
+
+	userSettings, err := s.settingsService.GetUserSettingsInternal(rule.UserID)
+	if err != nil || userSettings == nil {
+		slog.Warn("Failed to get settings for notification rule", "rule_id", rule.ID, "error", err)
+		return
+	}
+
+	metadata["rule_id"] = rule.ID
+	metadata["rule_name"] = rule.Name
+	metadata["condition"] = rule.Condition
+	metadataJSON, _ := json.Marshal(metadata)
+	n := &notification.Notification{
+		ID:        uuid.New(),
+		UserID:    rule.UserID,
+		Title:     rule.Name,
+		Message:   message,
+		Type:      notification.RuleTriggered,
+		Status:    notification.StatusUnread,
+		Metadata:  metadataJSON,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	for i, channel := range rule.Channels {
+		target, deliveryErr := s.deliverThroughChannel(userSettings, channel, n, metadata)
+
+		delivery := &notification.Delivery{
+			ID:               uuid.New(),
+			UserID:           rule.UserID,
+			NotificationType: n.Type,
+			ChainID:          event.ID,
+			Position:         i + 1,
+			Channel:          channel.Type,
+			Target:           target,
+			Status:           notification.DeliveryDelivered,
+			CreatedAt:        time.Now(),
+		}
+		if deliveryErr != nil {
+			errMsg := deliveryErr.Error()
+			delivery.Status = notification.DeliveryFailed
+			delivery.Error = &errMsg
+			slog.Warn("Failed to deliver notification rule", "rule_id", rule.ID, "channel", channel.Type, "error", deliveryErr)
+		}
+		if err := s.notificationRepo.CreateDelivery(delivery); err != nil {
+			slog.Warn("Failed to record notification delivery", "rule_id", rule.ID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package backup
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// RunEnvironment records how a backup artifact was produced, so it can be
+// reproduced or restored long after the tools used have changed.
+type RunEnvironment struct {
+	VelldVersion    string         `json:"velld_version"`
+	GoVersion       string         `json:"go_version"`
+	OS              string         `json:"os"`
+	Arch            string         `json:"arch"`
+	Hostname        string         `json:"hostname,omitempty"`
+	DumpTool        string         `json:"dump_tool,omitempty"`
+	DumpToolPath    string         `json:"dump_tool_path,omitempty"`
+	DumpToolVersion string         `json:"dump_tool_version,omitempty"`
+	DumpArgs        []string       `json:"dump_args,omitempty"`
+	Streamed        bool           `json:"streamed"`
+	PgDumpJobs      int            `json:"pg_dump_jobs,omitempty"`
+	ExtraDumpArgs   string         `json:"extra_dump_args,omitempty"`
+	Sample          *SampleOptions `json:"sample,omitempty"`
+	CapturedAt      time.Time      `json:"captured_at"`
+}
+
+// Value stores the environment as JSON in a nullable text column
+func (e RunEnvironment) Value() (driver.Value, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (e *RunEnvironment) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	case []byte:
+		return json.Unmarshal(v, e)
+	default:
+		return fmt.Errorf("cannot scan %T into run environment", src)
+	}
+}
+
+// toolVersions caches "<tool> --version" output by binary path
+var toolVersions sync.Map
+
+func dumpToolVersion(binPath string) string {
+	if version, ok := toolVersions.Load(binPath); ok {
+		return version.(string)
+	}
+
+	output, err := exec.Command(binPath, "--version").Output()
+	if err != nil {
+		return ""
+	}
+
+	version := strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+	toolVersions.Store(binPath, version)
+	return version
+}
+
+// secretArgs are dump options whose following argument is a secret
+var secretArgs = map[string]bool{
+	"--password": true,
+	"-a":         true,
+}
+
+// redactDumpArgs masks passwords passed on the dump command line
+func redactDumpArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		switch {
+		case i > 0 && secretArgs[args[i-1]]:
+			redacted[i] = "***"
+		case strings.HasPrefix(arg, "-p") && len(arg) > 2 && !strings.HasPrefix(arg, "--"):
+			// mysqldump takes its password attached to -p
+			redacted[i] = "-p***"
+		case strings.HasPrefix(arg, "--password="):
+			redacted[i] = "--password=***"
+		default:
+			redacted[i] = arg
+		}
+	}
+	return redacted
+}
+
+// captureRunEnvironment describes the host, tools and effective flags of a
+// dump command about to run.
+func captureRunEnvironment(cmd *exec.Cmd, schedule *BackupSchedule, streamed bool) *RunEnvironment {
+	env := &RunEnvironment{
+		VelldVersion: common.Version,
+		GoVersion:    runtime.Version(),
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		Streamed:     streamed,
+		CapturedAt:   time.Now(),
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		env.Hostname = hostname
+	}
+
+	if cmd != nil {
+		env.DumpTool = strings.TrimSuffix(filepath.Base(cmd.Path), ".exe")
+		env.DumpToolPath = cmd.Path
+		env.DumpToolVersion = dumpToolVersion(cmd.Path)
+		env.DumpArgs = redactDumpArgs(cmd.Args[1:])
+	}
+
+	if schedule != nil {
+		env.PgDumpJobs = schedule.PgDumpJobs
+		env.Sample = schedule.Sample
+		if schedule.ExtraDumpArgs != nil {
+			env.ExtraDumpArgs = *schedule.ExtraDumpArgs
+		}
+	}
+
+	return env
+}
+
+// BackupReproduction explains how a backup was produced and how to restore it
+type BackupReproduction struct {
+	BackupID                 uuid.UUID       `json:"backup_id"`
+	DatabaseType             string          `json:"database_type"`
+	Path                     string          `json:"path"`
+	S3ObjectKey              *string         `json:"s3_object_key"`
+	Checksum                 *string         `json:"checksum"`
+	CompressionCommand       *string         `json:"compression_command"`
+	EncryptionKeyFingerprint *string         `json:"encryption_key_fingerprint"`
+	DumpFilters              *DumpFilters    `json:"dump_filters"`
+	Environment              *RunEnvironment `json:"environment"`
+	ProduceSteps             []string        `json:"produce_steps"`
+	RestoreSteps             []string        `json:"restore_steps"`
+}
+
+func (s *BackupService) GetBackupReproduction(backupID string, userID uuid.UUID) (*BackupReproduction, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	return &BackupReproduction{
+		BackupID:                 backup.ID,
+		DatabaseType:             conn.Type,
+		Path:                     backup.Path,
+		S3ObjectKey:              backup.S3ObjectKey,
+		Checksum:                 backup.Checksum,
+		CompressionCommand:       backup.CompressionCommand,
+		EncryptionKeyFingerprint: backup.EncryptionKeyFingerprint,
+		DumpFilters:              backup.DumpFilters,
+		Environment:              backup.RunEnvironment,
+		ProduceSteps:             produceSteps(backup),
+		RestoreSteps:             restoreSteps(backup, conn),
+	}, nil
+}
+
+func produceSteps(backup *Backup) []string {
+	env := backup.RunEnvironment
+	if env == nil {
+		return []string{"No run environment was recorded for this backup"}
+	}
+
+	var steps []string
+	if env.DumpTool != "" {
+		version := env.DumpToolVersion
+		if version == "" {
+			version = "unknown version"
+		}
+		steps = append(steps, fmt.Sprintf("Dump with %s (%s): %s %s",
+			env.DumpTool, version, env.DumpTool, strings.Join(env.DumpArgs, " ")))
+	}
+	if isDirectoryDump(backup.Path) {
+		steps = append(steps, "Pack the dump directory into an uncompressed tar archive")
+	}
+	if backup.CompressionCommand != nil {
+		steps = append(steps, fmt.Sprintf("Compress with: %s", *backup.CompressionCommand))
+	}
+	if backup.EncryptionKeyFingerprint != nil {
+		steps = append(steps, fmt.Sprintf("Encrypt with OpenPGP for key %s", *backup.EncryptionKeyFingerprint))
+	}
+	if env.Streamed {
+		steps = append(steps, "Stream the output to S3 without a local copy")
+	}
+	if backup.Checksum != nil {
+		steps = append(steps, fmt.Sprintf("Expect SHA-256 %s", *backup.Checksum))
+	}
+
+	return steps
+}
+
+func restoreSteps(backup *Backup, conn *connection.StoredConnection) []string {
+	var steps []string
+	if backup.Checksum != nil {
+		steps = append(steps, fmt.Sprintf("Verify the artifact: sha256sum must print %s", *backup.Checksum))
+	}
+	if backup.EncryptionKeyFingerprint != nil {
+		steps = append(steps, fmt.Sprintf("Decrypt with the private key of %s: gpg --decrypt", *backup.EncryptionKeyFingerprint))
+	}
+	if backup.CompressionCommand != nil {
+		if codec, err := lookupCompressionCodec(*backup.CompressionCommand); err == nil {
+			steps = append(steps, fmt.Sprintf("Decompress with: %s", strings.Join(codec.decompress, " ")))
+		} else {
+			steps = append(steps, fmt.Sprintf("Decompress with the decompressor of: %s", *backup.CompressionCommand))
+		}
+	}
+
+	dumpPath := plainDumpPath(backup)
+	switch {
+	case isXtraBackup(dumpPath):
+		steps = append(steps, "Prepare the backup and the incremental backups it builds on with POST /api/backups/{id}/prepare, or extract each and run xtrabackup --prepare --apply-log-only on the full backup, then with --incremental-dir for each incremental in order")
+		steps = append(steps, "Stop MySQL, empty its data directory, run: xtrabackup --copy-back --target-dir=<prepared directory>, give the files to the mysql user and start MySQL")
+	case isPhysicalBackup(dumpPath):
+		steps = append(steps, "Stop PostgreSQL and extract the tar archive. Extract base.tar.gz (and any <oid>.tar.gz tablespaces) into an empty data directory and pg_wal.tar.gz into its pg_wal directory, then start PostgreSQL")
+	case isDirectoryDump(dumpPath):
+		steps = append(steps, "Extract the tar archive, then run: pg_restore -j <jobs> --no-owner -d <database> <directory>")
+	case isCustomDump(dumpPath):
+		steps = append(steps, "Restore with: pg_restore --no-owner -d <database> <file> (add -t, -n or -L to restore selectively)")
+	case conn.Type == "postgresql":
+		steps = append(steps, "Restore with: psql -d <database> -f <file>")
+	case conn.Type == "mysql" || conn.Type == "mariadb":
+		steps = append(steps, "Restore with: mysql <database> < <file>")
+	case conn.Type == "mongodb" && isMongoArchive(dumpPath):
+		steps = append(steps, fmt.Sprintf("Restore with: mongorestore %s",
+			strings.Join(mongoArchiveRestoreArgs(filepath.Base(dumpPath), "<database>"), " ")))
+	case conn.Type == "mongodb":
+		steps = append(steps, "Restore with: mongorestore --db <database> <dump directory>")
+	case conn.Type == "redis":
+		steps = append(steps, "Stop Redis, replace dump.rdb with the artifact and start Redis again")
+	}
+
+	if env := backup.RunEnvironment; env != nil && env.DumpToolVersion != "" {
+		steps = append(steps, fmt.Sprintf("Use restore tools at least as new as %s", env.DumpToolVersion))
+	}
+
+	return steps
+}
+
+// plainDumpPath strips the encryption and compression extensions from the
+// artifact path, leaving the extension of the dump itself.
+func plainDumpPath(backup *Backup) string {
+	path := strings.TrimSuffix(backup.Path, ".gpg")
+	if backup.CompressionCommand != nil {
+		if codec, err := lookupCompressionCodec(*backup.CompressionCommand); err == nil {
+			path = strings.TrimSuffix(path, codec.extension)
+		}
+	}
+	return path
+}
+
+func (h *BackupHandler) GetBackupReproduction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	reproduction, err := h.backupService.GetBackupReproduction(backupID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup reproduction retrieved successfully", reproduction)
+}
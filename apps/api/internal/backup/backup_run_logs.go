@@ -0,0 +1,593 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultRunLogRetentionDays = 30
+	defaultRunLogMaxMB         = 50
+	// runLogReapSchedule removes expired run logs every hour
+	runLogReapSchedule = "0 15 * * * *"
+	// staleRunLogSpoolAge is when the spool of a log that was never persisted,
+	// as its run was interrupted by a restart, is removed
+	staleRunLogSpoolAge    = 24 * time.Hour
+	defaultRunLogPageLines = 500
+	maxRunLogPageLines     = 5000
+	defaultRunLogListLimit = 20
+	maxRunLogListLimit     = 100
+)
+
+// RunLog is the full stdout and stderr of the tools of a backup run or a
+// restore, kept compressed for BACKUP_RUN_LOG_RETENTION_DAYS. Backup run logs
+// share the ID of their run.
+type RunLog struct {
+	ID             string `json:"id"`
+	Kind           string `json:"kind"`
+	ConnectionID   string `json:"connection_id"`
+	Lines          int    `json:"lines"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size"`
+	// Truncated is set when the output went past BACKUP_RUN_LOG_MAX_MB and
+	// the rest of it was not kept
+	Truncated  bool       `json:"truncated"`
+	Running    bool       `json:"running"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// RunLogPage is a page of the lines of a run log. NextOffset is unset on
+// the last page of a finished log.
+type RunLogPage struct {
+	Log        *RunLog  `json:"log"`
+	Offset     int      `json:"offset"`
+	Lines      []string `json:"lines"`
+	NextOffset *int     `json:"next_offset"`
+}
+
+// runLogSpool writes the lines of a running log to disk until the log ends
+// and is compressed
+type runLogSpool struct {
+	file      *os.File
+	lines     int
+	size      int64
+	limit     int64
+	truncated bool
+}
+
+// append writes a line unless the spool is full. Its log's lock is held.
+func (sp *runLogSpool) append(line string) {
+	if sp == nil || sp.truncated {
+		return
+	}
+	if sp.size+int64(len(line))+1 > sp.limit {
+		sp.truncated = true
+		return
+	}
+	if _, err := sp.file.WriteString(line + "\n"); err != nil {
+		slog.Warn("Failed to write run log", "path", sp.file.Name(), "error", err)
+		sp.truncated = true
+		return
+	}
+	sp.lines++
+	sp.size += int64(len(line)) + 1
+}
+
+// runLogRetention reads BACKUP_RUN_LOG_RETENTION_DAYS; 0 keeps logs forever
+func runLogRetention() time.Duration {
+	days := defaultRunLogRetentionDays
+	if value := strings.TrimSpace(os.Getenv("BACKUP_RUN_LOG_RETENTION_DAYS")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			slog.Warn("Invalid BACKUP_RUN_LOG_RETENTION_DAYS, using the default", "value", value, "default_days", defaultRunLogRetentionDays)
+		} else {
+			days = parsed
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// runLogMaxBytes reads BACKUP_RUN_LOG_MAX_MB, how much output of one run is
+// kept; 0 keeps no run logs
+func runLogMaxBytes() int64 {
+	megabytes := defaultRunLogMaxMB
+	if value := strings.TrimSpace(os.Getenv("BACKUP_RUN_LOG_MAX_MB")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			slog.Warn("Invalid BACKUP_RUN_LOG_MAX_MB, using the default", "value", value, "default_mb", defaultRunLogMaxMB)
+		} else {
+			megabytes = parsed
+		}
+	}
+	return int64(megabytes) << 20
+}
+
+func (s *BackupService) runLogDir() string {
+	return filepath.Join(s.backupDir, ".logs")
+}
+
+func (s *BackupService) runLogSpoolPath(id string) string {
+	return filepath.Join(s.runLogDir(), id+".log")
+}
+
+func (s *BackupService) runLogPath(id string) string {
+	return filepath.Join(s.runLogDir(), id+".log.gz")
+}
+
+// openRunLogSpool starts keeping the output of a run. A log that can't be
+// kept can still be tailed while it runs.
+func (s *BackupService) openRunLogSpool(id string) *runLogSpool {
+	limit := runLogMaxBytes()
+	if limit == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(s.runLogDir(), 0700); err != nil {
+		slog.Warn("Failed to create run log directory", "path", s.runLogDir(), "error", err)
+		return nil
+	}
+	file, err := os.OpenFile(s.runLogSpoolPath(id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		slog.Warn("Failed to create run log", "log_id", id, "error", err)
+		return nil
+	}
+	return &runLogSpool{file: file, limit: limit}
+}
+
+// persistRunLog compresses the spool of a finished log and records it. The
+// compressed file is complete before the spool is removed, so readers find
+// one or the other.
+func (s *BackupService) persistRunLog(l *liveLog) {
+	l.mu.Lock()
+	spool := l.spool
+	info := l.info
+	l.mu.Unlock()
+	if spool == nil {
+		return
+	}
+
+	spoolPath := spool.file.Name()
+	defer os.Remove(spoolPath)
+	if err := spool.file.Close(); err != nil {
+		slog.Warn("Failed to close run log", "log_id", info.ID, "error", err)
+		return
+	}
+
+	compressedSize, err := compressRunLog(spoolPath, s.runLogPath(info.ID))
+	if err != nil {
+		slog.Warn("Failed to compress run log", "log_id", info.ID, "error", err)
+		return
+	}
+
+	finishedAt := time.Now()
+	runLog := &RunLog{
+		ID:             info.ID,
+		Kind:           info.Kind,
+		ConnectionID:   info.ConnectionID,
+		Lines:          spool.lines,
+		Size:           spool.size,
+		CompressedSize: compressedSize,
+		Truncated:      spool.truncated,
+		StartedAt:      info.StartedAt,
+		FinishedAt:     &finishedAt,
+	}
+	if err := s.backupRepo.CreateRunLog(runLog); err != nil {
+		slog.Warn("Failed to record run log", "log_id", info.ID, "error", err)
+		os.Remove(s.runLogPath(info.ID))
+	}
+}
+
+// compressRunLog gzips a spool into path and returns the compressed size
+func compressRunLog(spoolPath, path string) (int64, error) {
+	src, err := os.Open(spoolPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	tmpPath := path + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpPath)
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		return 0, err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		return 0, err
+	}
+	info, err := dst.Stat()
+	if err != nil {
+		dst.Close()
+		return 0, err
+	}
+	if err := dst.Close(); err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(tmpPath, path)
+}
+
+// openRunLogLines opens the lines of a log: the compressed file of a
+// finished log, or the spool of a running one
+func (s *BackupService) openRunLogLines(id string) (io.ReadCloser, error) {
+	file, err := os.Open(s.runLogPath(id))
+	if err == nil {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{gz, file}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return os.Open(s.runLogSpoolPath(id))
+}
+
+// readRunLogLines returns up to limit lines of a log from offset, and
+// whether more lines follow
+func (s *BackupService) readRunLogLines(id string, offset, limit int) ([]string, bool, error) {
+	lines := []string{}
+	reader, err := s.openRunLogLines(id)
+	if os.IsNotExist(err) {
+		return lines, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*maxLiveLogLineLength)
+	for n := 0; scanner.Scan(); n++ {
+		if n < offset {
+			continue
+		}
+		if len(lines) == limit {
+			return lines, true, nil
+		}
+		lines = append(lines, scanner.Text())
+	}
+	return lines, false, scanner.Err()
+}
+
+// userRunLog returns a log of one of the user's connections, recorded or
+// still running, and the live log of a running one
+func (s *BackupService) userRunLog(id string, userID uuid.UUID) (*RunLog, *liveLog, error) {
+	// Log IDs name files, so only the IDs velld gives out are accepted
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil, sql.ErrNoRows
+	}
+
+	runLog, err := s.backupRepo.GetRunLog(id)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, nil, err
+	}
+	if runLog != nil {
+		conn, err := s.connStorage.GetConnection(runLog.ConnectionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !s.connStorage.HasAccess(conn, userID) {
+			return nil, nil, sql.ErrNoRows
+		}
+		return runLog, nil, nil
+	}
+
+	l, err := s.userLiveLog(id, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if l == nil {
+		return nil, nil, sql.ErrNoRows
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	runLog = &RunLog{
+		ID:           l.info.ID,
+		Kind:         l.info.Kind,
+		ConnectionID: l.info.ConnectionID,
+		Running:      !l.finished,
+		StartedAt:    l.info.StartedAt,
+		FinishedAt:   l.info.FinishedAt,
+	}
+	if l.spool != nil {
+		runLog.Lines = l.spool.lines
+		runLog.Size = l.spool.size
+		runLog.Truncated = l.spool.truncated
+	}
+	return runLog, l, nil
+}
+
+// GetRunLogs lists the recorded logs of the user's connections, newest first
+func (s *BackupService) GetRunLogs(userID uuid.UUID, connectionID, kind string, limit, offset int) ([]*RunLog, int, error) {
+	return s.backupRepo.GetRunLogs(userID, connectionID, kind, limit, offset)
+}
+
+// GetRunLog returns a page of the lines of a log. Pages of a running log
+// grow until it finishes.
+func (s *BackupService) GetRunLog(id string, userID uuid.UUID, offset, limit int) (*RunLogPage, error) {
+	runLog, _, err := s.userRunLog(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, more, err := s.readRunLogLines(id, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run log: %v", err)
+	}
+
+	page := &RunLogPage{Log: runLog, Offset: offset, Lines: lines}
+	if more || runLog.Running {
+		next := offset + len(lines)
+		page.NextOffset = &next
+	}
+	return page, nil
+}
+
+// follow returns how many lines of the log are on disk and a channel with
+// the lines that follow, which is closed when the log finishes. A log that
+// isn't kept returns its backlog instead.
+func (l *liveLog) follow() (int, []string, chan string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ch := make(chan string, liveLogSubscriberBuffer)
+	if l.finished {
+		close(ch)
+	} else {
+		l.subscribers[ch] = true
+	}
+	if l.spool == nil {
+		return 0, append([]string(nil), l.lines...), ch
+	}
+	return l.spool.lines, nil, ch
+}
+
+// scheduleRunLogCleanup removes expired run logs every hour
+func (s *BackupService) scheduleRunLogCleanup() {
+	if _, err := s.cronManager.AddFunc(runLogReapSchedule, s.removeExpiredRunLogs); err != nil {
+		slog.Error("Failed to schedule run log cleanup", "error", err)
+	}
+}
+
+// removeExpiredRunLogs removes the logs older than the retention and the
+// spools of runs interrupted by a restart
+func (s *BackupService) removeExpiredRunLogs() {
+	if retention := runLogRetention(); retention > 0 {
+		ids, err := s.backupRepo.DeleteRunLogsBefore(time.Now().Add(-retention))
+		if err != nil {
+			slog.Error("Failed to remove expired run logs", "error", err)
+		}
+		for _, id := range ids {
+			if err := os.Remove(s.runLogPath(id)); err != nil && !os.IsNotExist(err) {
+				slog.Warn("Failed to remove run log", "log_id", id, "error", err)
+			}
+		}
+		if len(ids) > 0 {
+			slog.Info("Removed expired run logs", "count", len(ids))
+		}
+	}
+
+	spools, err := filepath.Glob(filepath.Join(s.runLogDir(), "*.log"))
+	if err != nil {
+		return
+	}
+	for _, path := range spools {
+		id := strings.TrimSuffix(filepath.Base(path), ".log")
+		if _, running := s.liveLogs.Load(id); running {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleRunLogSpoolAge {
+			os.Remove(path)
+		}
+	}
+}
+
+func (h *BackupHandler) GetRunLogs(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	page := 1
+	limit := defaultRunLogListLimit
+	if pageStr := query.Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, maxRunLogListLimit)
+		}
+	}
+
+	runLogs, total, err := h.backupService.GetRunLogs(userID, query.Get("connection_id"), query.Get("kind"), limit, (page-1)*limit)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendPaginatedSuccess(w, "Run logs retrieved successfully", runLogs, page, limit, total)
+}
+
+// GetRunLog returns the lines of a log from ?offset=, at most ?limit= of them
+func (h *BackupHandler) GetRunLog(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	offset := 0
+	limit := defaultRunLogPageLines
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		if offset, err = strconv.Atoi(offsetStr); err != nil || offset < 0 {
+			response.SendError(w, http.StatusBadRequest, "invalid offset")
+			return
+		}
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 {
+			response.SendError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(limit, maxRunLogPageLines)
+	}
+
+	page, err := h.backupService.GetRunLog(mux.Vars(r)["id"], userID, offset, limit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Run log not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Run log retrieved successfully", page)
+}
+
+// FollowRunLog streams a log as server-sent events from line ?from=: the
+// lines written so far, then each line as it is written while the run goes
+// on, and an "end" event once it finished. Each line event carries its line
+// number as its ID.
+func (h *BackupHandler) FollowRunLog(w http.ResponseWriter, r *http.Request) {
+	logID := mux.Vars(r)["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	from := 0
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		if from, err = strconv.Atoi(fromStr); err != nil || from < 0 {
+			response.SendError(w, http.StatusBadRequest, "invalid from")
+			return
+		}
+	}
+
+	runLog, l, err := h.backupService.userRunLog(logID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Run log not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// A running log is subscribed to before its lines are read, so no line
+	// falls between the two
+	stored := -1
+	var backlog []string
+	var lines chan string
+	if l != nil {
+		stored, backlog, lines = l.follow()
+		defer l.unsubscribe(lines)
+	}
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	next := from
+	send := func(line string) {
+		fmt.Fprintf(w, "id: %d\ndata: %s\n\n", next, line)
+		next++
+	}
+
+	if backlog != nil {
+		for _, line := range backlog {
+			send(line)
+		}
+	} else {
+		// Lines are read a page at a time, up to those on disk when the
+		// stream started
+		for stored < 0 || next < stored {
+			limit := maxRunLogPageLines
+			if stored >= 0 {
+				limit = min(limit, stored-next)
+			}
+			page, more, err := h.backupService.readRunLogLines(logID, next, limit)
+			if err != nil {
+				slog.Warn("Failed to read run log", "log_id", logID, "error", err)
+				return
+			}
+			for _, line := range page {
+				send(line)
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+			if !more || len(page) == 0 {
+				break
+			}
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		slog.Warn("Failed to stream run log", "log_id", logID, "error", err)
+		return
+	}
+
+	if lines == nil {
+		fmt.Fprintf(w, "event: end\ndata: %s\n\n", runLog.Kind)
+		controller.Flush()
+		return
+	}
+
+	heartbeat := time.NewTicker(liveLogHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case line, open := <-lines:
+			if !open {
+				fmt.Fprintf(w, "event: end\ndata: %s\n\n", runLog.Kind)
+				controller.Flush()
+				return
+			}
+			send(line)
+			controller.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			controller.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/logging"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/telemetry"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Backup run triggers
+const (
+	RunTriggerManual    = "manual"
+	RunTriggerScheduled = "scheduled"
+)
+
+// Backup run and job states
+const (
+	RunStatusQueued  = "queued"
+	RunStatusRunning = "running"
+	RunStatusSuccess = "success"
+	RunStatusPartial = "partial"
+	RunStatusFailed  = "failed"
+)
+
+// Backup run job kinds
+const (
+	RunJobDump   = "dump"
+	RunJobUpload = "upload"
+)
+
+const defaultRunListLimit = 20
+
+// runBackup creates the backups of a connection as one run. A schedule marks
+// the run as scheduled; manual runs pass nil. The run waits in the job queue
+// until a worker is free. The run's span is started under the span of ctx.
+func (s *BackupService) runBackup(ctx context.Context, connectionID string, schedule *BackupSchedule) (*BackupRun, *Backup, error) {
+	run := &BackupRun{
+		ID:           uuid.New(),
+		ConnectionID: connectionID,
+		Trigger:      RunTriggerManual,
+		Status:       RunStatusQueued,
+		Priority:     priorityFor(schedule),
+		StartedTime:  time.Now(),
+	}
+	if schedule != nil {
+		scheduleID := schedule.ID.String()
+		run.ScheduleID = &scheduleID
+		run.Trigger = RunTriggerScheduled
+	}
+	ctx = logging.WithJobID(ctx, run.ID.String())
+
+	if err := s.backupRepo.CreateBackupRun(run); err != nil {
+		slog.WarnContext(ctx, "Failed to record backup run", "error", err)
+	}
+
+	ctx, span := telemetry.StartSpan(ctx, "backup.run",
+		attribute.String("velld.run.id", run.ID.String()),
+		attribute.String("velld.run.trigger", run.Trigger),
+		attribute.String("velld.connection.id", connectionID))
+
+	// The tracker exists while the run is queued, so a newer run can cancel it
+	run.processes = newProcessTracker()
+	run.processes.ctx = ctx
+	run.processes.meter = s.beginProgress(run.ID.String(), LiveLogBackup, connectionID)
+	current := s.beginConnectionRun(run)
+	defer s.endConnectionRun(current)
+
+	_, queueSpan := telemetry.StartSpan(ctx, "backup.queue", attribute.String("velld.run.priority", run.Priority))
+	waited := s.jobQueue.acquire(run.ID.String(), run.Priority)
+	queueSpan.End()
+	defer s.jobQueue.release()
+	run.processes.meter.setPhase(ProgressPhaseStarting, "")
+
+	startTime := time.Now()
+	run.Status = RunStatusRunning
+	run.StartedTime = startTime
+	if waited {
+		slog.InfoContext(ctx, "Backup run left the job queue", "connection_id", connectionID)
+	}
+	if err := s.backupRepo.StartBackupRun(run); err != nil {
+		slog.WarnContext(ctx, "Failed to record start of backup run", "error", err)
+	}
+	pingRunStarted(run, schedule)
+	s.publishRunStarted(run)
+
+	run.processes.log = s.beginLiveLog(run.ID.String(), LiveLogBackup, connectionID)
+	defer s.endLiveLog(run.processes.log)
+	timeout := s.runTimeout(connectionID, schedule)
+	var timer *time.Timer
+	if timeout > 0 {
+		timer = time.AfterFunc(timeout, func() {
+			slog.WarnContext(ctx, "Backup run exceeded its timeout", "connection_id", connectionID, "timeout", timeout)
+			run.processes.expire()
+		})
+	}
+
+	backup, err := s.createBackup(connectionID, run)
+	if timer != nil {
+		timer.Stop()
+	}
+	if run.processes.wasCancelled() {
+		err = errRunReplaced
+	} else if run.processes.timedOut() {
+		err = fmt.Errorf("backup timed out after %s", timeout)
+	}
+	s.recordRunMetrics(connectionID, startTime, backup, err)
+	s.finishBackupRun(run, err)
+	s.endProgress(run.processes.meter, run.Status)
+	pingRunFinished(run, schedule)
+	s.publishRunFinished(run)
+	span.SetAttributes(
+		attribute.String("velld.run.status", run.Status),
+		attribute.Int("velld.run.jobs", run.TotalJobs),
+		attribute.Int("velld.run.failed_jobs", run.FailedJobs))
+	telemetry.EndSpan(span, err)
+	if run.Status == RunStatusSuccess {
+		go s.resolveIncidents(connectionID)
+	}
+	go s.evaluateRunRules(run)
+	go s.flagSuspectBackups(run)
+
+	return run, backup, err
+}
+
+// recordJob adds a child job to the run. A nil backup with a nil error is
+// not recorded.
+func (run *BackupRun) recordJob(kind, target string, backup *Backup, jobErr error) {
+	job := &BackupRunJob{
+		ID:        uuid.New(),
+		RunID:     run.ID.String(),
+		Kind:      kind,
+		Target:    target,
+		Status:    RunStatusSuccess,
+		CreatedAt: time.Now(),
+	}
+	if backup != nil {
+		backupID := backup.ID.String()
+		job.BackupID = &backupID
+	}
+	if jobErr != nil {
+		message := jobErr.Error()
+		job.Status = RunStatusFailed
+		job.Error = &message
+	} else if backup == nil {
+		return
+	}
+
+	run.jobsMu.Lock()
+	defer run.jobsMu.Unlock()
+	run.Jobs = append(run.Jobs, job)
+}
+
+// recordUpload adds the S3 upload of a backup to the run, if one happened
+func (run *BackupRun) recordUpload(backup *Backup, uploadErr error) {
+	if uploadErr == nil && backup.S3ObjectKey == nil {
+		return
+	}
+	run.recordJob(RunJobUpload, filepath.Base(backup.Path), backup, uploadErr)
+}
+
+// databaseSize returns the pre-flight size of a database, if it was measured
+func (run *BackupRun) databaseSize(dbName string) *int64 {
+	size, ok := run.databaseSizes[dbName]
+	if !ok {
+		return nil
+	}
+	return &size
+}
+
+// backupIDs lists the backups the run produced
+func (run *BackupRun) backupIDs() []string {
+	var ids []string
+	for _, job := range run.Jobs {
+		if job.Kind == RunJobDump && job.BackupID != nil {
+			ids = append(ids, *job.BackupID)
+		}
+	}
+	return ids
+}
+
+// aggregateRunStatus is success when every job succeeded, failed when none
+// did and partial otherwise.
+func aggregateRunStatus(succeeded, failed int) string {
+	switch {
+	case succeeded == 0:
+		return RunStatusFailed
+	case failed == 0:
+		return RunStatusSuccess
+	default:
+		return RunStatusPartial
+	}
+}
+
+func (s *BackupService) finishBackupRun(run *BackupRun, runErr error) {
+	run.TotalJobs = len(run.Jobs)
+	run.SucceededJobs, run.FailedJobs = 0, 0
+	var failedTargets []string
+	for _, job := range run.Jobs {
+		if job.Status == RunStatusSuccess {
+			run.SucceededJobs++
+		} else {
+			run.FailedJobs++
+			failedTargets = append(failedTargets, fmt.Sprintf("%s %s", job.Kind, job.Target))
+		}
+	}
+
+	run.Status = aggregateRunStatus(run.SucceededJobs, run.FailedJobs)
+	if runErr != nil {
+		run.Status = RunStatusFailed
+		if run.processes.wasCancelled() {
+			run.Status = RunStatusCancelled
+		} else if run.processes.timedOut() {
+			run.Status = RunStatusTimedOut
+		}
+		message := runErr.Error()
+		run.Error = &message
+	} else if len(failedTargets) > 0 {
+		message := fmt.Sprintf("failed jobs: %s", strings.Join(failedTargets, ", "))
+		run.Error = &message
+	}
+
+	now := time.Now()
+	run.CompletedTime = &now
+
+	if err := s.backupRepo.FinishBackupRun(run); err != nil {
+		slog.WarnContext(run.processes.jobContext(), "Failed to record outcome of backup run", "error", err)
+	}
+}
+
+// recordSkippedRun records a scheduled run that did not start in the
+// schedule's run history and moves the schedule on to its next run
+func (s *BackupService) recordSkippedRun(schedule *BackupSchedule, status, message string) {
+	slog.Info("Skipping backup of schedule", "schedule_id", schedule.ID, "reason", message)
+
+	now := time.Now()
+	scheduleID := schedule.ID.String()
+	run := &BackupRun{
+		ID:            uuid.New(),
+		ConnectionID:  schedule.ConnectionID,
+		ScheduleID:    &scheduleID,
+		Trigger:       RunTriggerScheduled,
+		Status:        status,
+		Priority:      priorityFor(schedule),
+		Error:         &message,
+		StartedTime:   now,
+		CompletedTime: &now,
+	}
+	if err := s.backupRepo.CreateBackupRun(run); err != nil {
+		slog.Warn("Failed to record backup run", "schedule_id", schedule.ID, "error", err)
+	} else if err := s.backupRepo.FinishBackupRun(run); err != nil {
+		slog.Warn("Failed to record outcome of backup run", "run_id", run.ID, "error", err)
+	}
+
+	if schedule.RunAt != nil {
+		s.finishOneShot(schedule)
+	} else if spec, err := schedule.cronSchedule(); err == nil {
+		nextRun := spec.Next(now)
+		schedule.NextRunTime = &nextRun
+	} else {
+		return
+	}
+	schedule.UpdatedAt = now
+	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
+		slog.Error("Failed to update backup schedule", "schedule_id", schedule.ID, "error", err)
+	}
+}
+
+// notifyBackupRun notifies once for the whole run: failed runs as a backup
+// failure, partial runs with the jobs that failed. Successful runs are only
+// posted to Discord.
+func (s *BackupService) notifyBackupRun(run *BackupRun, runErr error) {
+	switch run.Status {
+	case RunStatusSuccess:
+		s.notifyBackupSucceeded(run)
+	case RunStatusFailed, RunStatusTimedOut:
+		if runErr == nil {
+			runErr = fmt.Errorf("all backup jobs failed")
+		}
+		if err := s.createFailureNotification(run.ConnectionID, runErr); err != nil {
+			slog.ErrorContext(run.processes.jobContext(), "Failed to create failure notification", "error", err)
+		}
+	case RunStatusPartial:
+		conn, err := s.connStorage.GetConnection(run.ConnectionID)
+		if err != nil {
+			slog.ErrorContext(run.processes.jobContext(), "Failed to create partial run notification", "error", err)
+			return
+		}
+		s.createPartialRunNotification(conn, run)
+	}
+}
+
+func (s *BackupService) createPartialRunNotification(conn *connection.StoredConnection, run *BackupRun) {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+	if err != nil || userSettings == nil {
+		return
+	}
+
+	var failedJobs []map[string]interface{}
+	for _, job := range run.Jobs {
+		if job.Status != RunStatusFailed {
+			continue
+		}
+		failedJobs = append(failedJobs, map[string]interface{}{
+			"kind":   job.Kind,
+			"target": job.Target,
+			"error":  job.Error,
+		})
+	}
+
+	metadata := map[string]interface{}{
+		"connection_id":  conn.ID,
+		"database_name":  conn.DatabaseName,
+		"database_type":  conn.Type,
+		"run_id":         run.ID,
+		"status":         run.Status,
+		"total_jobs":     run.TotalJobs,
+		"succeeded_jobs": run.SucceededJobs,
+		"failed_jobs":    failedJobs,
+		"timestamp":      time.Now().Format(time.RFC3339),
+	}
+
+	metadataJSON, _ := json.Marshal(metadata)
+	n := &notification.Notification{
+		ID:     uuid.New(),
+		UserID: conn.UserID,
+		Title:  "Backup Partially Failed",
+		Message: fmt.Sprintf("Backup of '%s' completed %d of %d jobs: %s",
+			conn.Name, run.SucceededJobs, run.TotalJobs, *run.Error),
+		Type:      notification.BackupPartial,
+		Status:    notification.StatusUnread,
+		Metadata:  metadataJSON,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	s.dispatchWebhooks(n, metadata)
+	s.raiseNotificationIncident(userSettings, conn.ID, n, metadata)
+
+	if s.notifyThroughFallbacks(userSettings, n, metadata) {
+		return
+	}
+
+	if userSettings.NotifyDashboard {
+		if err := s.notificationRepo.CreateNotification(n); err != nil {
+			slog.ErrorContext(run.processes.jobContext(), "Failed to create partial run notification", "error", err)
+		}
+	}
+
+	if userSettings.NotifyWebhook && userSettings.WebhookURL != nil {
+		go s.sendWebhookNotification(*userSettings.WebhookURL, metadata)
+	}
+
+	s.notifyDiscord(userSettings, conn.ID, n, metadata)
+	s.notifyEmail(userSettings, n, metadata)
+	s.notifyPush(userSettings, n, metadata)
+	s.notifyMatrix(userSettings, n, metadata)
+}
+
+// GetBackupRun returns a run with its child jobs
+func (s *BackupService) GetBackupRun(runID string, userID uuid.UUID) (*BackupRun, error) {
+	run, err := s.backupRepo.GetBackupRun(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(run.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	run.Jobs, err = s.backupRepo.GetBackupRunJobs(runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup run jobs: %v", err)
+	}
+	s.setQueuePosition(run)
+	return run, nil
+}
+
+// GetBackupRuns lists the latest runs of a connection, without their jobs
+func (s *BackupService) GetBackupRuns(connectionID string, userID uuid.UUID, limit int) ([]*BackupRun, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	if limit <= 0 {
+		limit = defaultRunListLimit
+	}
+	runs, err := s.backupRepo.GetBackupRunsByConnectionID(connectionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		s.setQueuePosition(run)
+	}
+	return runs, nil
+}
+
+func (h *BackupHandler) GetBackupRun(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	runID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	run, err := h.backupService.GetBackupRun(runID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup run not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup run retrieved successfully", run)
+}
+
+func (h *BackupHandler) GetBackupRuns(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	connectionID := r.URL.Query().Get("connection_id")
+	if connectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 0 {
+			response.SendError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	runs, err := h.backupService.GetBackupRuns(connectionID, userID, limit)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup runs retrieved successfully", runs)
+}
@@ -0,0 +1,222 @@
+package backup
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// samplableTypes lists the database types whose rows can be sampled
+var samplableTypes = map[string]bool{
+	"postgresql": true,
+	"mysql":      true,
+	"mariadb":    true,
+}
+
+// SampleOptions turns a schedule's backups into development snapshots: the
+// full schema with a number, or a percentage, of the rows of each table.
+// Rows are only kept when the rows they reference are in the sample too.
+type SampleOptions struct {
+	RowsPerTable int     `json:"rows_per_table,omitempty"`
+	Percent      float64 `json:"percent,omitempty"`
+}
+
+func (o *SampleOptions) isEmpty() bool {
+	return o.RowsPerTable == 0 && o.Percent == 0
+}
+
+// Value stores the options as JSON in a nullable text column
+func (o SampleOptions) Value() (driver.Value, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (o *SampleOptions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	case []byte:
+		return json.Unmarshal(v, o)
+	default:
+		return fmt.Errorf("cannot scan %T into sample options", src)
+	}
+}
+
+// validateSampleOptions checks the sample submitted with a schedule request
+// against the parallel jobs and dump filters the schedule will have. An empty
+// sample clears it.
+func (s *BackupService) validateSampleOptions(connectionID string, options *SampleOptions, pgDumpJobs int, filters *DumpFilters) (*SampleOptions, error) {
+	if options == nil || options.isEmpty() {
+		return nil, nil
+	}
+
+	if options.RowsPerTable < 0 {
+		return nil, fmt.Errorf("sample rows per table cannot be negative")
+	}
+	if options.Percent < 0 || options.Percent > 100 {
+		return nil, fmt.Errorf("sample percent must be between 0 and 100")
+	}
+	if options.RowsPerTable > 0 && options.Percent > 0 {
+		return nil, fmt.Errorf("samples take either rows_per_table or percent, not both")
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !samplableTypes[conn.Type] {
+		return nil, fmt.Errorf("sampled backups are not supported for %s", conn.Type)
+	}
+	if conn.Type == "postgresql" && pgDumpJobs > 0 {
+		return nil, fmt.Errorf("sampled backups are plain SQL scripts and cannot be combined with pg_dump_jobs")
+	}
+	if filters != nil {
+		return nil, fmt.Errorf("sampled backups cover every table and cannot be combined with dump filters")
+	}
+
+	return &SampleOptions{RowsPerTable: options.RowsPerTable, Percent: options.Percent}, nil
+}
+
+func sampleOptionsFor(schedule *BackupSchedule) *SampleOptions {
+	if schedule == nil {
+		return nil
+	}
+	return schedule.Sample
+}
+
+// createSampleDump writes a sampled dump to backupPath in three parts: the
+// schema without constraints and triggers, the sampled rows, then the
+// constraints and triggers, so these neither reject nor rewrite the rows as
+// they load. conn is reached through the run's SSH tunnel, if any.
+func (s *BackupService) createSampleDump(conn *connection.StoredConnection, dbName, backupPath string, schedule *BackupSchedule, processes *processTracker) (*RunEnvironment, error) {
+	if s.connService == nil {
+		return nil, fmt.Errorf("sampled backups are not available")
+	}
+
+	postPath := backupPath + ".post"
+	var preCmd, postCmd *exec.Cmd
+	switch conn.Type {
+	case "postgresql":
+		preCmd = s.createPgDumpCmd(conn, backupPath, pgDumpFormatPlain)
+		postCmd = s.createPgDumpCmd(conn, postPath, pgDumpFormatPlain)
+		if preCmd != nil {
+			preCmd.Args = append(preCmd.Args, "--section=pre-data")
+			postCmd.Args = append(postCmd.Args, "--section=post-data")
+		}
+	case "mysql", "mariadb":
+		preCmd = s.createMySQLDumpCmd(conn, backupPath)
+		postCmd = s.createMySQLDumpCmd(conn, postPath)
+		if preCmd != nil {
+			preCmd.Args = append(preCmd.Args, "--no-data", "--skip-triggers")
+			postCmd.Args = append(postCmd.Args, "--no-data", "--no-create-info")
+		}
+	default:
+		return nil, fmt.Errorf("sampled backups are not supported for %s", conn.Type)
+	}
+
+	if preCmd == nil {
+		return nil, fmt.Errorf("backup tool not found for %s. Please ensure %s is installed and available in PATH", conn.Type, requiredTools[conn.Type])
+	}
+	applyExtraDumpArgs(preCmd, schedule)
+	applyExtraDumpArgs(postCmd, schedule)
+	environment := captureRunEnvironment(preCmd, schedule, false)
+
+	masker, err := newDumpMasker(conn, schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(postPath)
+	if err := s.runSampleDumpCommand(conn, dbName, backupPath, preCmd, processes); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewWriterSize(file, 64*1024)
+
+	// The dump commands already go through the tunnel set up for the run
+	source := *conn
+	source.SSHEnabled = false
+	options := schedule.Sample
+	summary, err := s.connService.WriteSampleData(&source, connection.SampleSpec{
+		RowsPerTable: options.RowsPerTable,
+		Percent:      options.Percent,
+	}, buffered)
+	if err != nil {
+		file.Close()
+		os.Remove(backupPath)
+		return nil, fmt.Errorf("failed to sample %s database '%s': %v", conn.Type, dbName, err)
+	}
+
+	if err := s.runSampleDumpCommand(conn, dbName, backupPath, postCmd, processes); err != nil {
+		file.Close()
+		os.Remove(backupPath)
+		return nil, err
+	}
+	err = appendFile(buffered, postPath)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(backupPath)
+		return nil, err
+	}
+
+	slog.InfoContext(processes.jobContext(), "Sampled database", "rows", summary.Rows, "tables", summary.Tables, "database", dbName)
+	for _, fk := range summary.Cyclic {
+		slog.WarnContext(processes.jobContext(), "Foreign key is part of a reference cycle, sampled only rows where it is NULL", "foreign_key", fk)
+	}
+
+	if masker != nil {
+		if err := maskDumpFile(processes.jobContext(), backupPath, masker); err != nil {
+			return nil, err
+		}
+	}
+
+	return environment, nil
+}
+
+func (s *BackupService) runSampleDumpCommand(conn *connection.StoredConnection, dbName, backupPath string, cmd *exec.Cmd, processes *processTracker) error {
+	output, err := processes.combinedOutput(cmd)
+	if err == nil {
+		return nil
+	}
+	if processes.timedOut() {
+		removePartialDump(backupPath)
+		return fmt.Errorf("backup of %s database '%s' timed out", conn.Type, dbName)
+	}
+	errorMsg := string(output)
+	if errorMsg == "" {
+		errorMsg = err.Error()
+	}
+	return fmt.Errorf("backup failed for %s database '%s' on %s:%d - %s",
+		conn.Type, dbName, conn.Host, conn.Port, errorMsg)
+}
+
+func appendFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
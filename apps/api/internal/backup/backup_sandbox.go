@@ -0,0 +1,755 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Restore sandbox states
+const (
+	SandboxStarting  = "starting"
+	SandboxRestoring = "restoring"
+	SandboxReady     = "ready"
+	SandboxFailed    = "failed"
+	SandboxExpired   = "expired"
+	SandboxRemoved   = "removed"
+)
+
+const (
+	defaultSandboxTTL = 4 * time.Hour
+	maxSandboxTTL     = 24 * time.Hour
+	// maxSandboxesPerUser caps the containers one user keeps running
+	maxSandboxesPerUser = 3
+	// sandboxStartTimeout is how long a container may take to accept
+	// connections, which includes pulling its image
+	sandboxStartTimeout = 5 * time.Minute
+	// sandboxReapSchedule checks for expired sandboxes every minute
+	sandboxReapSchedule = "0 * * * * *"
+	// sandboxContainerPrefix names the containers, followed by the sandbox ID
+	sandboxContainerPrefix = "velld-sandbox-"
+	sandboxLabel           = "velld.sandbox"
+)
+
+// sandboxImagePattern accepts image references such as postgres:16 or
+// registry.example.com/mysql:8.0, and nothing docker would read as a flag
+var sandboxImagePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._/-]*(:[A-Za-z0-9._-]+)?$`)
+
+// RestoreSandbox is a throwaway database container a backup is restored
+// into, so old data can be inspected without touching a real server. The
+// container is removed when the sandbox expires.
+type RestoreSandbox struct {
+	ID           string    `json:"id"`
+	UserID       uuid.UUID `json:"user_id"`
+	BackupID     string    `json:"backup_id"`
+	ConnectionID string    `json:"connection_id"`
+	DatabaseType string    `json:"database_type"`
+	Image        string    `json:"image"`
+	ContainerID  *string   `json:"container_id,omitempty"`
+	Status       string    `json:"status"`
+	// Host, Port, Username, Password and DatabaseName are the temporary
+	// connection details, set once the container runs
+	Host         string    `json:"host,omitempty"`
+	Port         int       `json:"port,omitempty"`
+	Username     string    `json:"username,omitempty"`
+	Password     string    `json:"password,omitempty"`
+	DatabaseName string    `json:"database_name"`
+	Error        *string   `json:"error,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// CreateSandboxRequest restores a backup into a new sandbox. Image
+// overrides the image picked from the backup's server version and must be
+// one of SANDBOX_ALLOWED_IMAGES.
+type CreateSandboxRequest struct {
+	BackupID   string `json:"backup_id"`
+	Image      string `json:"image,omitempty"`
+	TTLMinutes int    `json:"ttl_minutes,omitempty"`
+}
+
+// SandboxRequestError rejects a sandbox that cannot be created
+type SandboxRequestError struct {
+	Reason string
+}
+
+func (e *SandboxRequestError) Error() string {
+	return e.Reason
+}
+
+// sandboxEngine is how a database type runs in a container
+type sandboxEngine struct {
+	image    string
+	port     int
+	username string
+	// env are the variables the image reads its password and first
+	// database from; the password is passed through the environment so it
+	// does not show up in the process list
+	env func(password, database string) []string
+}
+
+var sandboxEngines = map[string]sandboxEngine{
+	"postgresql": {
+		image:    "postgres",
+		port:     5432,
+		username: "postgres",
+		env: func(password, database string) []string {
+			return []string{"POSTGRES_PASSWORD=" + password, "POSTGRES_DB=" + database}
+		},
+	},
+	"mysql": {
+		image:    "mysql",
+		port:     3306,
+		username: "root",
+		env: func(password, database string) []string {
+			return []string{"MYSQL_ROOT_PASSWORD=" + password, "MYSQL_DATABASE=" + database}
+		},
+	},
+	"mariadb": {
+		image:    "mariadb",
+		port:     3306,
+		username: "root",
+		env: func(password, database string) []string {
+			return []string{"MARIADB_ROOT_PASSWORD=" + password, "MARIADB_DATABASE=" + database}
+		},
+	},
+	// MongoDB runs without authentication; its port is only published on
+	// SANDBOX_BIND_ADDRESS
+	"mongodb": {
+		image: "mongo",
+		port:  27017,
+		env:   func(password, database string) []string { return nil },
+	},
+}
+
+// dockerBinary returns the docker CLI, from SANDBOX_DOCKER_PATH or the PATH
+func dockerBinary() (string, error) {
+	if path := strings.TrimSpace(os.Getenv("SANDBOX_DOCKER_PATH")); path != "" {
+		return path, nil
+	}
+	path, err := exec.LookPath("docker")
+	if err != nil {
+		return "", &SandboxRequestError{Reason: "restore sandboxes need the docker CLI, which was not found. Install it or set SANDBOX_DOCKER_PATH"}
+	}
+	return path, nil
+}
+
+// sandboxBindAddress reads SANDBOX_BIND_ADDRESS, the host address the
+// containers' ports are published on. It defaults to loopback, so sandboxes
+// are not exposed to the network.
+func sandboxBindAddress() string {
+	if address := strings.TrimSpace(os.Getenv("SANDBOX_BIND_ADDRESS")); address != "" {
+		return address
+	}
+	return "127.0.0.1"
+}
+
+// sandboxHost reads SANDBOX_HOST, the address velld and its users reach the
+// published ports at, defaulting to the bind address
+func sandboxHost() string {
+	if host := strings.TrimSpace(os.Getenv("SANDBOX_HOST")); host != "" {
+		return host
+	}
+	return sandboxBindAddress()
+}
+
+// sandboxAllowedImages reads SANDBOX_ALLOWED_IMAGES, the comma-separated
+// image names (without tags) sandboxes may run, such as
+// postgres,registry.example.com/mysql. It defaults to the official images
+// sandboxImage picks from.
+func sandboxAllowedImages() map[string]bool {
+	allowed := map[string]bool{}
+	for _, name := range strings.Split(os.Getenv("SANDBOX_ALLOWED_IMAGES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			allowed[name] = true
+		}
+	}
+	if len(allowed) == 0 {
+		for _, engine := range sandboxEngines {
+			allowed[engine.image] = true
+		}
+	}
+	return allowed
+}
+
+// imageName strips the tag from an image reference. A colon before the last
+// slash belongs to a registry port, not a tag.
+func imageName(image string) string {
+	if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+		return image[:colon]
+	}
+	return image
+}
+
+// checkSandboxImage refuses images the operator has not allowed, so users
+// cannot run arbitrary containers on the Docker host
+func checkSandboxImage(image string) error {
+	if !sandboxImagePattern.MatchString(image) {
+		return &SandboxRequestError{Reason: fmt.Sprintf("invalid image %q", image)}
+	}
+	if !sandboxAllowedImages()[imageName(image)] {
+		return &SandboxRequestError{Reason: fmt.Sprintf("image %q is not allowed. Allow it with SANDBOX_ALLOWED_IMAGES", imageName(image))}
+	}
+	return nil
+}
+
+// sandboxImage picks the image of the engine release a backup was taken
+// from. MariaDB servers reached as MySQL connections report themselves in
+// their version.
+func sandboxImage(dbType, serverVersion string) (string, error) {
+	if strings.Contains(serverVersion, "MariaDB") {
+		dbType = "mariadb"
+		// Older MariaDB servers prefix their version for MySQL clients
+		serverVersion = strings.TrimPrefix(serverVersion, "5.5.5-")
+	}
+	engine, ok := sandboxEngines[dbType]
+	if !ok {
+		return "", &SandboxRequestError{Reason: fmt.Sprintf("%s backups cannot be restored into a sandbox", dbType)}
+	}
+
+	major, minor, ok := parseVersion(serverVersion)
+	if !ok {
+		return "", &SandboxRequestError{Reason: "the backup does not record its server version. Set image to choose the sandbox's image"}
+	}
+	// PostgreSQL names its releases by major version since 10
+	if dbType == "postgresql" && major >= 10 {
+		return fmt.Sprintf("%s:%d", engine.image, major), nil
+	}
+	return fmt.Sprintf("%s:%d.%d", engine.image, major, minor), nil
+}
+
+// imageEngine returns the database type an image runs, for images picked
+// by sandboxImage or given with the same names
+func imageEngine(dbType, image string) string {
+	if dbType != "mysql" && dbType != "mariadb" {
+		return dbType
+	}
+	name := image
+	if slash := strings.LastIndex(name, "/"); slash >= 0 {
+		name = name[slash+1:]
+	}
+	if strings.HasPrefix(name, "mariadb") {
+		return "mariadb"
+	}
+	return "mysql"
+}
+
+func randomSandboxPassword() (string, error) {
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CreateRestoreSandbox starts a container for the backup's engine and
+// restores the backup into it in the background
+func (s *BackupService) CreateRestoreSandbox(req *CreateSandboxRequest, userID uuid.UUID, access *ArtifactAccess) (*RestoreSandbox, error) {
+	backup, err := s.backupRepo.GetBackup(req.BackupID)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	if backup.Status != "completed" {
+		return nil, &SandboxRequestError{Reason: "only completed backups can be restored into a sandbox"}
+	}
+	if isGPGEncrypted(backup) {
+		return nil, &SandboxRequestError{Reason: "GPG encrypted backups cannot be restored by velld"}
+	}
+	if isPhysicalBackup(plainDumpPath(backup)) {
+		return nil, &SandboxRequestError{Reason: "physical backups cannot be restored into a sandbox"}
+	}
+	if _, ok := sandboxEngines[conn.Type]; !ok {
+		return nil, &SandboxRequestError{Reason: fmt.Sprintf("%s backups cannot be restored into a sandbox", conn.Type)}
+	}
+	if _, err := dockerBinary(); err != nil {
+		return nil, err
+	}
+
+	ttl := defaultSandboxTTL
+	if req.TTLMinutes < 0 {
+		return nil, &SandboxRequestError{Reason: "ttl_minutes cannot be negative"}
+	}
+	if req.TTLMinutes > 0 {
+		ttl = time.Duration(req.TTLMinutes) * time.Minute
+	}
+	if ttl > maxSandboxTTL {
+		return nil, &SandboxRequestError{Reason: fmt.Sprintf("sandboxes live for at most %d hours", int(maxSandboxTTL.Hours()))}
+	}
+
+	image := strings.TrimSpace(req.Image)
+	if image == "" {
+		image, err = sandboxImage(conn.Type, s.sourceServerVersion(backup, conn))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := checkSandboxImage(image); err != nil {
+		return nil, err
+	}
+
+	active, err := s.backupRepo.CountActiveRestoreSandboxes(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count sandboxes: %v", err)
+	}
+	if active >= maxSandboxesPerUser {
+		return nil, &SandboxRequestError{Reason: fmt.Sprintf("you already have %d sandboxes running. Remove one first", active)}
+	}
+
+	database := databaseNameFromBackup(backup, conn)
+	if database == "" {
+		database = "restored"
+	}
+	password, err := randomSandboxPassword()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate sandbox password: %v", err)
+	}
+
+	now := time.Now()
+	engine := sandboxEngines[imageEngine(conn.Type, image)]
+	sandbox := &RestoreSandbox{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		BackupID:     backup.ID.String(),
+		ConnectionID: conn.ID,
+		DatabaseType: imageEngine(conn.Type, image),
+		Image:        image,
+		Status:       SandboxStarting,
+		Username:     engine.username,
+		Password:     password,
+		DatabaseName: database,
+		ExpiresAt:    now.Add(ttl),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if engine.username == "" {
+		sandbox.Password = ""
+	}
+
+	encrypted, err := s.encryptSandboxPassword(sandbox.Password)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.backupRepo.CreateRestoreSandbox(sandbox, encrypted); err != nil {
+		return nil, fmt.Errorf("failed to save sandbox: %v", err)
+	}
+
+	go s.runRestoreSandbox(sandbox, backup, access)
+
+	return sandbox, nil
+}
+
+// sourceServerVersion returns the server version a backup was taken from,
+// describing the source connection when the backup has no manifest
+func (s *BackupService) sourceServerVersion(backup *Backup, conn *connection.StoredConnection) string {
+	if backup.Manifest != nil && backup.Manifest.ServerVersion != "" {
+		return backup.Manifest.ServerVersion
+	}
+	if s.connService == nil {
+		return ""
+	}
+	description, err := s.connService.DescribeSchema(conn)
+	if err != nil {
+		slog.Warn("Failed to read server version of connection for sandbox", "connection_id", conn.ID, "error", err)
+		return ""
+	}
+	return description.ServerVersion
+}
+
+func (s *BackupService) encryptSandboxPassword(password string) (string, error) {
+	if password == "" || s.cryptoService == nil {
+		return password, nil
+	}
+	encrypted, err := s.cryptoService.Encrypt(password)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt sandbox password: %v", err)
+	}
+	return encrypted, nil
+}
+
+// revealSandbox decrypts the password of a sandbox loaded from the database.
+// Sandboxes that no longer run keep no connection details.
+func (s *BackupService) revealSandbox(sandbox *RestoreSandbox) {
+	if sandbox.Status != SandboxReady && sandbox.Status != SandboxRestoring {
+		sandbox.Password = ""
+		return
+	}
+	if sandbox.Password == "" || s.cryptoService == nil {
+		return
+	}
+	password, err := s.cryptoService.Decrypt(sandbox.Password)
+	if err != nil {
+		slog.Warn("Failed to decrypt password of sandbox", "sandbox_id", sandbox.ID, "error", err)
+		sandbox.Password = ""
+		return
+	}
+	sandbox.Password = password
+}
+
+// runRestoreSandbox starts the sandbox's container, waits for it to accept
+// connections and restores the backup into it. A sandbox that fails is
+// removed, keeping its record with the error.
+func (s *BackupService) runRestoreSandbox(sandbox *RestoreSandbox, backup *Backup, access *ArtifactAccess) {
+	fail := func(err error) {
+		slog.Error("Restore sandbox failed", "sandbox_id", sandbox.ID, "error", err)
+		s.removeSandboxContainer(sandbox)
+		message := err.Error()
+		sandbox.Status = SandboxFailed
+		sandbox.Error = &message
+		if err := s.backupRepo.UpdateRestoreSandbox(sandbox); err != nil {
+			slog.Warn("Failed to save sandbox", "sandbox_id", sandbox.ID, "error", err)
+		}
+	}
+
+	if err := s.startSandboxContainer(sandbox); err != nil {
+		fail(err)
+		return
+	}
+	sandbox.Status = SandboxRestoring
+	if err := s.backupRepo.UpdateRestoreSandbox(sandbox); err != nil {
+		slog.Warn("Failed to save sandbox", "sandbox_id", sandbox.ID, "error", err)
+	}
+
+	target := sandbox.connection()
+	if err := s.waitForSandbox(target); err != nil {
+		fail(err)
+		return
+	}
+
+	if _, err := s.restoreInto(backup, target, restoreOptions{
+		createDatabase: true,
+		portable:       true,
+		origin:         restoreOrigin{trigger: RestoreTriggerSandbox, access: access},
+	}); err != nil {
+		fail(fmt.Errorf("restore failed: %v", err))
+		return
+	}
+
+	current, err := s.backupRepo.GetRestoreSandbox(sandbox.ID)
+	if err == nil && current.Status != SandboxRestoring {
+		// Removed or expired while the restore ran
+		return
+	}
+	sandbox.Status = SandboxReady
+	if err := s.backupRepo.UpdateRestoreSandbox(sandbox); err != nil {
+		slog.Warn("Failed to save sandbox", "sandbox_id", sandbox.ID, "error", err)
+	}
+	slog.Info("Restore sandbox is ready", "sandbox_id", sandbox.ID, "host", sandbox.Host, "port", sandbox.Port)
+}
+
+// connection describes the sandbox as a connection to restore into. Its ID
+// belongs to no saved connection.
+func (sandbox *RestoreSandbox) connection() *connection.StoredConnection {
+	return &connection.StoredConnection{
+		ID:           "sandbox_" + sandbox.ID,
+		Name:         sandboxContainerPrefix + sandbox.ID,
+		Type:         sandbox.DatabaseType,
+		Host:         sandbox.Host,
+		Port:         sandbox.Port,
+		Username:     sandbox.Username,
+		Password:     sandbox.Password,
+		DatabaseName: sandbox.DatabaseName,
+		UserID:       sandbox.UserID,
+	}
+}
+
+// startSandboxContainer runs the sandbox's container with its port
+// published on a free port of the bind address
+func (s *BackupService) startSandboxContainer(sandbox *RestoreSandbox) error {
+	docker, err := dockerBinary()
+	if err != nil {
+		return err
+	}
+	engine := sandboxEngines[sandbox.DatabaseType]
+
+	env := engine.env(sandbox.Password, sandbox.DatabaseName)
+	args := []string{"run", "-d",
+		"--name", sandboxContainerPrefix + sandbox.ID,
+		"--label", sandboxLabel + "=" + sandbox.ID,
+		"-p", fmt.Sprintf("%s::%d", sandboxBindAddress(), engine.port),
+	}
+	for _, variable := range env {
+		name, _, _ := strings.Cut(variable, "=")
+		args = append(args, "-e", name)
+	}
+	args = append(args, sandbox.Image)
+
+	cmd := exec.Command(docker, args...)
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to start container: %s", strings.TrimSpace(stderr.String()))
+	}
+	containerID := strings.TrimSpace(string(output))
+	sandbox.ContainerID = &containerID
+
+	output, err = exec.Command(docker, "port", containerID, fmt.Sprintf("%d/tcp", engine.port)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to read the container's port: %s", strings.TrimSpace(string(output)))
+	}
+	// docker port prints one line per address family, such as 127.0.0.1:49153
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	_, portStr, err := net.SplitHostPort(strings.TrimSpace(line))
+	if err != nil {
+		return fmt.Errorf("unexpected port mapping %q", line)
+	}
+	if sandbox.Port, err = strconv.Atoi(portStr); err != nil {
+		return fmt.Errorf("unexpected port mapping %q", line)
+	}
+	sandbox.Host = sandboxHost()
+	return nil
+}
+
+// waitForSandbox waits until the sandbox's server accepts connections. The
+// images run a temporary server without networking while they initialize.
+func (s *BackupService) waitForSandbox(conn *connection.StoredConnection) error {
+	if s.connService == nil {
+		return nil
+	}
+
+	deadline := time.Now().Add(sandboxStartTimeout)
+	for {
+		_, err := s.connService.DescribeSchema(conn)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("sandbox did not accept connections within %s: %v", sandboxStartTimeout, err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// removeSandboxContainer force-removes the sandbox's container with its
+// volumes
+func (s *BackupService) removeSandboxContainer(sandbox *RestoreSandbox) {
+	docker, err := dockerBinary()
+	if err != nil {
+		return
+	}
+	output, err := exec.Command(docker, "rm", "-f", "-v", sandboxContainerPrefix+sandbox.ID).CombinedOutput()
+	if err != nil && !strings.Contains(string(output), "No such container") {
+		slog.Warn("Failed to remove container of sandbox", "sandbox_id", sandbox.ID, "output", strings.TrimSpace(string(output)))
+	}
+}
+
+// RemoveRestoreSandbox removes one of the user's sandboxes with its container
+func (s *BackupService) RemoveRestoreSandbox(id string, userID uuid.UUID) error {
+	sandbox, err := s.backupRepo.GetRestoreSandbox(id)
+	if err != nil {
+		return err
+	}
+	if sandbox.UserID != userID {
+		return sql.ErrNoRows
+	}
+	if !sandboxActive(sandbox.Status) {
+		return nil
+	}
+
+	s.removeSandboxContainer(sandbox)
+	sandbox.Status = SandboxRemoved
+	return s.backupRepo.UpdateRestoreSandbox(sandbox)
+}
+
+func sandboxActive(status string) bool {
+	return status == SandboxStarting || status == SandboxRestoring || status == SandboxReady
+}
+
+// reapRestoreSandboxes removes the containers of expired sandboxes
+func (s *BackupService) reapRestoreSandboxes() {
+	sandboxes, err := s.backupRepo.GetRestoreSandboxes(nil, SandboxStarting, SandboxRestoring, SandboxReady)
+	if err != nil {
+		slog.Error("Failed to get restore sandboxes", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for _, sandbox := range sandboxes {
+		if now.Before(sandbox.ExpiresAt) {
+			continue
+		}
+		s.removeSandboxContainer(sandbox)
+		sandbox.Status = SandboxExpired
+		if err := s.backupRepo.UpdateRestoreSandbox(sandbox); err != nil {
+			slog.Warn("Failed to save sandbox", "sandbox_id", sandbox.ID, "error", err)
+			continue
+		}
+		slog.Info("Removed expired restore sandbox", "sandbox_id", sandbox.ID)
+	}
+}
+
+// scheduleSandboxRemoval removes the containers of expired sandboxes every
+// minute
+func (s *BackupService) scheduleSandboxRemoval() {
+	if _, err := s.cronManager.AddFunc(sandboxReapSchedule, s.reapRestoreSandboxes); err != nil {
+		slog.Error("Failed to schedule restore sandbox removal", "error", err)
+	}
+}
+
+// recoverRestoreSandboxes fails the sandboxes a restart cut off while they
+// started, and removes their containers
+func (s *BackupService) recoverRestoreSandboxes() {
+	sandboxes, err := s.backupRepo.GetRestoreSandboxes(nil, SandboxStarting, SandboxRestoring)
+	if err != nil {
+		slog.Error("Failed to get restore sandboxes", "error", err)
+		return
+	}
+	for _, sandbox := range sandboxes {
+		s.removeSandboxContainer(sandbox)
+		message := "interrupted by a restart"
+		sandbox.Status = SandboxFailed
+		sandbox.Error = &message
+		if err := s.backupRepo.UpdateRestoreSandbox(sandbox); err != nil {
+			slog.Warn("Failed to save sandbox", "sandbox_id", sandbox.ID, "error", err)
+		}
+	}
+}
+
+// GetRestoreSandboxes lists the user's sandboxes, newest first
+func (s *BackupService) GetRestoreSandboxes(userID uuid.UUID) ([]*RestoreSandbox, error) {
+	sandboxes, err := s.backupRepo.GetRestoreSandboxes(&userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sandbox := range sandboxes {
+		s.revealSandbox(sandbox)
+	}
+	return sandboxes, nil
+}
+
+// GetRestoreSandbox returns one of the user's sandboxes with its connection
+// details
+func (s *BackupService) GetRestoreSandbox(id string, userID uuid.UUID) (*RestoreSandbox, error) {
+	sandbox, err := s.backupRepo.GetRestoreSandbox(id)
+	if err != nil {
+		return nil, err
+	}
+	if sandbox.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	s.revealSandbox(sandbox)
+	return sandbox, nil
+}
+
+func sendSandboxError(w http.ResponseWriter, err error) {
+	var invalid *SandboxRequestError
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Backup or sandbox not found")
+	case errors.As(err, &invalid):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func (h *BackupHandler) CreateRestoreSandbox(w http.ResponseWriter, r *http.Request) {
+	var req CreateSandboxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.BackupID == "" {
+		response.SendError(w, http.StatusBadRequest, "backup_id is required")
+		return
+	}
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	access := newArtifactAccess(r, req.BackupID, userID, AccessRestore)
+	detail := "restore sandbox"
+	access.Detail = &detail
+	if err := h.backupService.recordArtifactAccess(access); err != nil {
+		sendAccessError(w, err)
+		return
+	}
+
+	sandbox, err := h.backupService.CreateRestoreSandbox(&req, userID, access)
+	if err != nil {
+		sendSandboxError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Restore sandbox is starting", sandbox)
+}
+
+func (h *BackupHandler) GetRestoreSandboxes(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sandboxes, err := h.backupService.GetRestoreSandboxes(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Restore sandboxes retrieved successfully", sandboxes)
+}
+
+func (h *BackupHandler) GetRestoreSandbox(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sandbox, err := h.backupService.GetRestoreSandbox(mux.Vars(r)["id"], userID)
+	if err != nil {
+		sendSandboxError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Restore sandbox retrieved successfully", sandbox)
+}
+
+func (h *BackupHandler) RemoveRestoreSandbox(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.backupService.RemoveRestoreSandbox(mux.Vars(r)["id"], userID); err != nil {
+		sendSandboxError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Restore sandbox removed", nil)
+}
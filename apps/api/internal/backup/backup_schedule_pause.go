@@ -0,0 +1,191 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/webhook"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Schedule states shown in listings
+const (
+	ScheduleStateActive   = "active"
+	ScheduleStatePaused   = "paused"
+	ScheduleStateDisabled = "disabled"
+)
+
+func (schedule *BackupSchedule) state() string {
+	switch {
+	case !schedule.Enabled:
+		return ScheduleStateDisabled
+	case schedule.Paused:
+		return ScheduleStatePaused
+	default:
+		return ScheduleStateActive
+	}
+}
+
+// PauseScheduleRequest pauses a schedule, optionally saying why
+type PauseScheduleRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// userSchedule returns the schedule of one of the user's connections
+func (s *BackupService) userSchedule(connectionID string, userID uuid.UUID) (*BackupSchedule, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+	return s.backupRepo.GetBackupSchedule(connectionID)
+}
+
+// PauseSchedule stops the runs of a connection's schedule without removing
+// it. Runs already started are not interrupted.
+func (s *BackupService) PauseSchedule(connectionID string, userID uuid.UUID, req *PauseScheduleRequest) (*ScheduleOverview, error) {
+	schedule, err := s.userSchedule(connectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !schedule.Enabled {
+		return nil, sql.ErrNoRows
+	}
+
+	if !schedule.Paused {
+		now := time.Now()
+		schedule.Paused = true
+		schedule.PausedAt = &now
+	}
+	schedule.PauseReason = nil
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		schedule.PauseReason = &reason
+	}
+	schedule.UpdatedAt = time.Now()
+	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
+		return nil, err
+	}
+	s.dispatchScheduleEvent(webhook.EventSchedulePaused, schedule)
+
+	s.removeCronEntry(schedule.ID.String())
+
+	schedule.State = schedule.state()
+	return scheduleOverview(schedule), nil
+}
+
+// ResumeSchedule runs a paused schedule again from its next run time. Runs
+// missed while it was paused are not caught up.
+func (s *BackupService) ResumeSchedule(connectionID string, userID uuid.UUID) (*ScheduleOverview, error) {
+	schedule, err := s.userSchedule(connectionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !schedule.Enabled {
+		return nil, sql.ErrNoRows
+	}
+	if !schedule.Paused {
+		return scheduleOverview(schedule), nil
+	}
+
+	spec, err := schedule.cronSchedule()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	nextRun := spec.Next(now)
+	schedule.Paused = false
+	schedule.PausedAt = nil
+	schedule.PauseReason = nil
+	schedule.NextRunTime = &nextRun
+	schedule.UpdatedAt = now
+	if nextRun.IsZero() {
+		// A one-shot schedule whose time passed while it was paused is over
+		s.finishOneShot(schedule)
+	}
+	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
+		return nil, err
+	}
+	s.dispatchScheduleEvent(webhook.EventScheduleResumed, schedule)
+	if !schedule.Enabled {
+		schedule.State = schedule.state()
+		return scheduleOverview(schedule), nil
+	}
+
+	entryID, err := s.registerSchedule(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register cron job: %v", err)
+	}
+	s.setCronEntry(schedule.ID.String(), entryID)
+
+	schedule.State = schedule.state()
+	return scheduleOverview(schedule), nil
+}
+
+// schedulePaused reports whether a schedule is paused now. Cron jobs, catch-up
+// and deferred runs hold the schedule as it was when they were queued, so
+// its saved state is checked before each run.
+func (s *BackupService) schedulePaused(schedule *BackupSchedule) bool {
+	current, err := s.backupRepo.GetBackupSchedule(schedule.ConnectionID)
+	if err != nil || current.ID != schedule.ID {
+		return schedule.Paused
+	}
+	return current.Paused
+}
+
+func (h *BackupHandler) PauseSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The body is optional
+	var req PauseScheduleRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	overview, err := h.backupService.PauseSchedule(mux.Vars(r)["connection_id"], userID, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "No active schedule found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule paused successfully", overview)
+}
+
+func (h *BackupHandler) ResumeSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	overview, err := h.backupService.ResumeSchedule(mux.Vars(r)["connection_id"], userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "No active schedule found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule resumed successfully", overview)
+}
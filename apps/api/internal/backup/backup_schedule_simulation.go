@@ -0,0 +1,198 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common/response"
+)
+
+const (
+	defaultSimulationDays = 7
+	maxSimulationDays     = 90
+	// maxSimulatedRuns keeps per-second and per-minute schedules from
+	// producing huge responses
+	maxSimulatedRuns = 1000
+	maxJitterSeconds = 24 * 60 * 60
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// blackout is a parsed BlackoutWindow in minutes since midnight
+type blackout struct {
+	start, end int
+	days       map[time.Weekday]bool
+	label      string
+}
+
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func parseBlackoutWindows(windows []BlackoutWindow) ([]blackout, error) {
+	var parsed []blackout
+	for _, window := range windows {
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("blackout window %s-%s is empty", window.Start, window.End)
+		}
+
+		b := blackout{start: start, end: end, label: fmt.Sprintf("%s-%s", window.Start, window.End)}
+		if len(window.Days) > 0 {
+			b.days = make(map[time.Weekday]bool)
+			for _, day := range window.Days {
+				// Accept full names such as "monday" too
+				name := strings.ToLower(strings.TrimSpace(day))
+				if len(name) > 3 {
+					name = name[:3]
+				}
+				weekday, ok := weekdays[name]
+				if !ok {
+					return nil, fmt.Errorf("invalid blackout day %q", day)
+				}
+				b.days[weekday] = true
+			}
+			b.label += " on " + strings.Join(window.Days, ", ")
+		}
+		parsed = append(parsed, b)
+	}
+	return parsed, nil
+}
+
+// contains reports whether t falls in the window. The part of a window past
+// midnight belongs to the day it started on.
+func (b blackout) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if b.start < b.end {
+		if minute < b.start || minute >= b.end {
+			return false
+		}
+	} else if minute < b.end {
+		day = t.AddDate(0, 0, -1).Weekday()
+	} else if minute < b.start {
+		return false
+	}
+
+	return b.days == nil || b.days[day]
+}
+
+// until returns when the window containing t ends
+func (b blackout) until(t time.Time) time.Time {
+	year, month, day := t.Date()
+	if b.start > b.end && t.Hour()*60+t.Minute() >= b.start {
+		day++
+	}
+	return time.Date(year, month, day, b.end/60, b.end%60, 0, 0, t.Location())
+}
+
+// SimulateSchedule lists the concrete run times of a cron expression over the
+// next days, marking the runs that fall in a blackout window and the latest
+// start of each run once jitter is applied.
+func (s *BackupService) SimulateSchedule(req *ScheduleSimulationRequest) (*ScheduleSimulation, error) {
+	spec, err := parseCronSchedule(req.CronSchedule, req.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	location := time.Local
+	if req.Timezone != "" {
+		location, err = time.LoadLocation(req.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %v", req.Timezone, err)
+		}
+	}
+
+	days := req.Days
+	if days <= 0 {
+		days = defaultSimulationDays
+	}
+	if days > maxSimulationDays {
+		return nil, fmt.Errorf("days must be at most %d", maxSimulationDays)
+	}
+
+	if err := validateJitter(&req.JitterSeconds); err != nil {
+		return nil, err
+	}
+	jitter := time.Duration(req.JitterSeconds) * time.Second
+
+	blackouts, err := parseBlackoutWindows(req.BlackoutWindows)
+	if err != nil {
+		return nil, err
+	}
+
+	from := time.Now().In(location)
+	simulation := &ScheduleSimulation{
+		Timezone: location.String(),
+		From:     from,
+		To:       from.AddDate(0, 0, days),
+		Runs:     []SimulatedRun{},
+	}
+
+	for next := spec.Next(from); !next.IsZero() && next.Before(simulation.To); next = spec.Next(next) {
+		if len(simulation.Runs) == maxSimulatedRuns {
+			simulation.Truncated = true
+			break
+		}
+
+		run := SimulatedRun{Time: next}
+		for _, b := range blackouts {
+			if b.contains(next) {
+				run.Skipped = true
+				run.Reason = "blackout window " + b.label
+				break
+			}
+		}
+
+		simulation.TotalRuns++
+		if run.Skipped {
+			simulation.SkippedRuns++
+		}
+		if jitter > 0 {
+			latest := next.Add(jitter)
+			run.Latest = &latest
+		}
+		simulation.Runs = append(simulation.Runs, run)
+	}
+
+	return simulation, nil
+}
+
+func (h *BackupHandler) SimulateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleSimulationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	simulation, err := h.backupService.SimulateSchedule(&req)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Schedule simulated successfully", simulation)
+}
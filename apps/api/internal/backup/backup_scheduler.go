@@ -4,83 +4,498 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"os"
 	"time"
 
+	"github.com/dendianugerah/velld/internal/events"
+	"github.com/dendianugerah/velld/internal/telemetry"
+	"github.com/dendianugerah/velld/internal/webhook"
 	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func (s *BackupService) ScheduleBackup(req *ScheduleBackupRequest) error {
+// ScheduleBackup creates or updates the backup schedule for a connection and
+// returns any privilege warnings for the connection's backup user.
+func (s *BackupService) ScheduleBackup(req *ScheduleBackupRequest) ([]string, error) {
 	// Check if a schedule already exists for this connection
 	existingSchedule, err := s.backupRepo.GetBackupSchedule(req.ConnectionID)
 	if err != nil && err != sql.ErrNoRows {
-		return fmt.Errorf("failed to check existing schedule: %v", err)
+		return nil, fmt.Errorf("failed to check existing schedule: %v", err)
 	}
 
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, err := parser.Parse(req.CronSchedule)
+	timezone, err := validateScheduleTimezone(req.Timezone, req.CronSchedule)
 	if err != nil {
-		return fmt.Errorf("invalid cron schedule: %v", err)
+		return nil, err
+	}
+	if timezone == nil {
+		// The schedule keeps its time zone
+		name := ""
+		if existingSchedule != nil {
+			name = timezoneName(existingSchedule.Timezone)
+		}
+		timezone = &name
+	}
+
+	if err := validateRunAt(req.RunAt, req.CronSchedule); err != nil {
+		return nil, err
+	}
+
+	schedule, err := scheduleSpec(req.CronSchedule, req.RunAt, *timezone)
+	if err != nil {
+		return nil, err
 	}
 
 	nextRun := schedule.Next(time.Now())
 
+	gpgPublicKey, err := validateScheduleGPGKey(req.GPGPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	verifyConnectionID, err := s.validateVerifyConnection(req.ConnectionID, req.VerifyConnectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	compressionCommand, err := validateScheduleCompression(req.CompressionCommand)
+	if err != nil {
+		return nil, err
+	}
+
+	discordWebhookURL, err := validateScheduleDiscordWebhook(req.DiscordWebhookURL)
+	if err != nil {
+		return nil, err
+	}
+
+	heartbeatURL, err := validateHeartbeatURL(req.HeartbeatURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.validateStreamToStorage(req.ConnectionID, req.StreamToStorage); err != nil {
+		return nil, err
+	}
+
+	if err := s.validatePgDumpJobs(req.ConnectionID, req.PgDumpJobs); err != nil {
+		return nil, err
+	}
+
+	dumpFilters, err := s.validateDumpFilters(req.ConnectionID, req.DumpFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	extraDumpArgs, err := s.validateExtraDumpArgs(req.ConnectionID, req.ExtraDumpArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	effectiveFilters := dumpFilters
+	if req.DumpFilters == nil && existingSchedule != nil {
+		effectiveFilters = existingSchedule.DumpFilters
+	}
+	mongoDumpOptions, err := s.validateMongoDumpOptions(req.ConnectionID, req.MongoDumpOptions, effectiveFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	postProcessors, err := s.validatePostProcessors(req.ConnectionID, req.PostProcessors)
+	if err != nil {
+		return nil, err
+	}
+
+	effectiveJobs := 0
+	effectiveRules := req.MaskingRules
+	if existingSchedule != nil {
+		effectiveJobs = existingSchedule.PgDumpJobs
+		if effectiveRules == nil {
+			effectiveRules = &existingSchedule.MaskingRules
+		}
+	}
+	if req.PgDumpJobs != nil {
+		effectiveJobs = *req.PgDumpJobs
+	}
+	maskingRules, err := s.validateMaskingRules(req.ConnectionID, effectiveRules, effectiveJobs)
+	if err != nil {
+		return nil, err
+	}
+
+	effectiveSample := req.Sample
+	if effectiveSample == nil && existingSchedule != nil {
+		effectiveSample = existingSchedule.Sample
+	}
+	sample, err := s.validateSampleOptions(req.ConnectionID, effectiveSample, effectiveJobs, effectiveFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	effectivePhysical := req.PhysicalBackup
+	if effectivePhysical == nil && existingSchedule != nil {
+		effectivePhysical = &existingSchedule.PhysicalBackup
+	}
+	if err := s.validatePhysicalBackup(req.ConnectionID, effectivePhysical, effectiveJobs, effectiveFilters, sample, maskingRules); err != nil {
+		return nil, err
+	}
+
+	effectiveIncrementals := req.IncrementalBackups
+	if effectiveIncrementals == nil && existingSchedule != nil {
+		effectiveIncrementals = &existingSchedule.IncrementalBackups
+	}
+	if err := s.validateIncrementalBackups(req.ConnectionID, effectiveIncrementals, effectivePhysical != nil && *effectivePhysical); err != nil {
+		return nil, err
+	}
+
+	effectiveAllDatabases := req.AllDatabases
+	if effectiveAllDatabases == nil && existingSchedule != nil {
+		effectiveAllDatabases = &existingSchedule.AllDatabases
+	}
+	if err := s.validateAllDatabases(req.ConnectionID, effectiveAllDatabases, effectivePhysical != nil && *effectivePhysical); err != nil {
+		return nil, err
+	}
+
+	effectiveDatabases := req.Databases
+	if effectiveDatabases == nil && existingSchedule != nil {
+		effectiveDatabases = &existingSchedule.Databases
+	}
+	databases, err := s.validateScheduleDatabases(req.ConnectionID, effectiveDatabases,
+		effectiveAllDatabases != nil && *effectiveAllDatabases, effectivePhysical != nil && *effectivePhysical)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateDatabaseWorkers(req.DatabaseWorkers); err != nil {
+		return nil, err
+	}
+
+	if err := s.validateRedisSnapshot(req.ConnectionID, req.RedisSnapshot); err != nil {
+		return nil, err
+	}
+
+	if err := validateBandwidthLimit(req.BandwidthLimitKBps); err != nil {
+		return nil, err
+	}
+
+	priority, err := validatePriority(req.Priority)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrencyPolicy, err := validateConcurrencyPolicy(req.ConcurrencyPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateTimeout(req.TimeoutMinutes); err != nil {
+		return nil, err
+	}
+
+	if err := validateJitter(req.JitterSeconds); err != nil {
+		return nil, err
+	}
+
+	if err := validateRPO(req.RPOMinutes); err != nil {
+		return nil, err
+	}
+
+	if err := validateSizeAnomalyPercent(req.SizeAnomalyPercent); err != nil {
+		return nil, err
+	}
+
+	if err := validateVerificationObjective(req.VerificationObjectiveMinutes); err != nil {
+		return nil, err
+	}
+
+	if err := validateStorageQuota(req.RetentionMaxBytes); err != nil {
+		return nil, err
+	}
+
+	warnings, err := s.preflightDumpPrivileges(req.ConnectionID)
+	if err != nil {
+		return warnings, err
+	}
+
 	if existingSchedule != nil {
 		// Update existing schedule
 		existingSchedule.Enabled = true
 		existingSchedule.CronSchedule = req.CronSchedule
+		existingSchedule.RunAt = req.RunAt
 		existingSchedule.RetentionDays = req.RetentionDays
+		if req.RetentionMaxBytes != nil {
+			existingSchedule.RetentionMaxBytes = *req.RetentionMaxBytes
+		}
+		existingSchedule.Timezone = storedTimezone(*timezone)
 		existingSchedule.NextRunTime = &nextRun
+		if req.GPGPublicKey != nil {
+			existingSchedule.GPGPublicKey = gpgPublicKey
+		}
+		if req.VerifyConnectionID != nil {
+			existingSchedule.VerifyConnectionID = verifyConnectionID
+		}
+		if req.CompressionCommand != nil {
+			existingSchedule.CompressionCommand = compressionCommand
+			if compressionCommand == nil {
+				existingSchedule.CompressionLevel = 0
+				existingSchedule.CompressionThreads = 0
+			}
+		}
+		if req.CompressionLevel != nil {
+			existingSchedule.CompressionLevel = *req.CompressionLevel
+		}
+		if req.CompressionThreads != nil {
+			existingSchedule.CompressionThreads = *req.CompressionThreads
+		}
+		if err := validateCompressionOptions(existingSchedule); err != nil {
+			return nil, err
+		}
+		if req.DiscordWebhookURL != nil {
+			existingSchedule.DiscordWebhookURL = discordWebhookURL
+		}
+		if req.HeartbeatURL != nil {
+			existingSchedule.HeartbeatURL = heartbeatURL
+		}
+		if req.StreamToStorage != nil {
+			existingSchedule.StreamToStorage = *req.StreamToStorage
+		}
+		if req.PgDumpJobs != nil {
+			existingSchedule.PgDumpJobs = *req.PgDumpJobs
+		}
+		if req.DumpFilters != nil {
+			existingSchedule.DumpFilters = dumpFilters
+		}
+		if req.ExtraDumpArgs != nil {
+			existingSchedule.ExtraDumpArgs = extraDumpArgs
+		}
+		if req.MongoDumpOptions != nil {
+			existingSchedule.MongoDumpOptions = mongoDumpOptions
+		}
+		if req.PostProcessors != nil {
+			existingSchedule.PostProcessors = postProcessors
+		}
+		if req.RedisSnapshot != nil {
+			existingSchedule.RedisSnapshot = *req.RedisSnapshot
+		}
+		if req.BandwidthLimitKBps != nil {
+			existingSchedule.BandwidthLimitKBps = *req.BandwidthLimitKBps
+		}
+		if req.Deduplicate != nil {
+			existingSchedule.Deduplicate = *req.Deduplicate
+		}
+		if req.Priority != nil {
+			existingSchedule.Priority = priority
+		}
+		if req.ConcurrencyPolicy != nil {
+			existingSchedule.ConcurrencyPolicy = concurrencyPolicy
+		}
+		if req.TimeoutMinutes != nil {
+			existingSchedule.TimeoutMinutes = *req.TimeoutMinutes
+		}
+		if req.JitterSeconds != nil {
+			existingSchedule.JitterSeconds = *req.JitterSeconds
+		}
+		if req.RPOMinutes != nil {
+			existingSchedule.RPOMinutes = *req.RPOMinutes
+		}
+		if req.SizeAnomalyPercent != nil {
+			existingSchedule.SizeAnomalyPercent = *req.SizeAnomalyPercent
+		}
+		if req.VerificationObjectiveMinutes != nil {
+			existingSchedule.VerificationObjectiveMinutes = *req.VerificationObjectiveMinutes
+		}
+		if req.MaskingRules != nil {
+			existingSchedule.MaskingRules = maskingRules
+		}
+		if req.Sample != nil {
+			existingSchedule.Sample = sample
+		}
+		if req.PhysicalBackup != nil {
+			existingSchedule.PhysicalBackup = *req.PhysicalBackup
+		}
+		if req.IncrementalBackups != nil {
+			existingSchedule.IncrementalBackups = *req.IncrementalBackups
+		}
+		if req.AllDatabases != nil {
+			existingSchedule.AllDatabases = *req.AllDatabases
+		}
+		if req.DatabaseWorkers != nil {
+			existingSchedule.DatabaseWorkers = *req.DatabaseWorkers
+		}
+		if req.Databases != nil {
+			existingSchedule.Databases = databases
+		}
+		if req.RerunInterrupted != nil {
+			existingSchedule.RerunInterrupted = req.RerunInterrupted
+		}
 		existingSchedule.UpdatedAt = time.Now()
 
 		if err := s.backupRepo.UpdateBackupSchedule(existingSchedule); err != nil {
-			return fmt.Errorf("failed to update backup schedule: %v", err)
+			return nil, fmt.Errorf("failed to update backup schedule: %v", err)
 		}
+		s.dispatchScheduleEvent(webhook.EventScheduleUpdated, existingSchedule)
 
 		// Update cron job
 		scheduleID := existingSchedule.ID.String()
-		if oldEntryID, exists := s.cronEntries[scheduleID]; exists {
-			s.cronManager.Remove(oldEntryID)
+		s.removeCronEntry(scheduleID)
+		if existingSchedule.Paused {
+			return warnings, nil
 		}
 
-		entryID, err := s.cronManager.AddFunc(req.CronSchedule, func() {
-			s.executeCronBackup(existingSchedule)
-		})
+		entryID, err := s.registerSchedule(existingSchedule)
 		if err != nil {
-			return fmt.Errorf("failed to schedule backup: %v", err)
+			return nil, fmt.Errorf("failed to schedule backup: %v", err)
 		}
 
-		s.cronEntries[scheduleID] = entryID
-		return nil
+		s.setCronEntry(scheduleID, entryID)
+		return warnings, nil
 	}
 
 	// Create new schedule if none exists
 	backupSchedule := &BackupSchedule{
-		ID:            uuid.New(),
-		ConnectionID:  req.ConnectionID,
-		Enabled:       true,
-		CronSchedule:  req.CronSchedule,
-		RetentionDays: req.RetentionDays,
-		NextRunTime:   &nextRun,
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+		ID:                 uuid.New(),
+		ConnectionID:       req.ConnectionID,
+		Enabled:            true,
+		CronSchedule:       req.CronSchedule,
+		RunAt:              req.RunAt,
+		Timezone:           storedTimezone(*timezone),
+		RetentionDays:      req.RetentionDays,
+		NextRunTime:        &nextRun,
+		GPGPublicKey:       gpgPublicKey,
+		VerifyConnectionID: verifyConnectionID,
+		CompressionCommand: compressionCommand,
+		StreamToStorage:    req.StreamToStorage != nil && *req.StreamToStorage,
+		DumpFilters:        dumpFilters,
+		ExtraDumpArgs:      extraDumpArgs,
+		MongoDumpOptions:   mongoDumpOptions,
+		PostProcessors:     postProcessors,
+		MaskingRules:       maskingRules,
+		Sample:             sample,
+		RedisSnapshot:      req.RedisSnapshot != nil && *req.RedisSnapshot,
+		PhysicalBackup:     req.PhysicalBackup != nil && *req.PhysicalBackup,
+		AllDatabases:       req.AllDatabases != nil && *req.AllDatabases,
+		Databases:          databases,
+		RerunInterrupted:   req.RerunInterrupted,
+		Deduplicate:        req.Deduplicate != nil && *req.Deduplicate,
+		Priority:           priority,
+		ConcurrencyPolicy:  concurrencyPolicy,
+		DiscordWebhookURL:  discordWebhookURL,
+		HeartbeatURL:       heartbeatURL,
+		CreatedAt:          time.Now(),
+		UpdatedAt:          time.Now(),
+	}
+	if req.PgDumpJobs != nil {
+		backupSchedule.PgDumpJobs = *req.PgDumpJobs
+	}
+	if req.RetentionMaxBytes != nil {
+		backupSchedule.RetentionMaxBytes = *req.RetentionMaxBytes
+	}
+	if req.BandwidthLimitKBps != nil {
+		backupSchedule.BandwidthLimitKBps = *req.BandwidthLimitKBps
+	}
+	if req.TimeoutMinutes != nil {
+		backupSchedule.TimeoutMinutes = *req.TimeoutMinutes
+	}
+	if req.JitterSeconds != nil {
+		backupSchedule.JitterSeconds = *req.JitterSeconds
+	}
+	if req.RPOMinutes != nil {
+		backupSchedule.RPOMinutes = *req.RPOMinutes
+	}
+	if req.SizeAnomalyPercent != nil {
+		backupSchedule.SizeAnomalyPercent = *req.SizeAnomalyPercent
+	}
+	if req.VerificationObjectiveMinutes != nil {
+		backupSchedule.VerificationObjectiveMinutes = *req.VerificationObjectiveMinutes
+	}
+	if req.CompressionLevel != nil {
+		backupSchedule.CompressionLevel = *req.CompressionLevel
+	}
+	if req.CompressionThreads != nil {
+		backupSchedule.CompressionThreads = *req.CompressionThreads
+	}
+	if err := validateCompressionOptions(backupSchedule); err != nil {
+		return nil, err
+	}
+	if req.IncrementalBackups != nil {
+		backupSchedule.IncrementalBackups = *req.IncrementalBackups
+	}
+	if req.DatabaseWorkers != nil {
+		backupSchedule.DatabaseWorkers = *req.DatabaseWorkers
 	}
 
 	if err := s.backupRepo.CreateBackupSchedule(backupSchedule); err != nil {
-		return fmt.Errorf("failed to save backup schedule: %v", err)
+		return nil, fmt.Errorf("failed to save backup schedule: %v", err)
 	}
+	s.dispatchScheduleEvent(webhook.EventScheduleCreated, backupSchedule)
 
 	scheduleID := backupSchedule.ID.String()
-	entryID, err := s.cronManager.AddFunc(req.CronSchedule, func() {
-		s.executeCronBackup(backupSchedule)
-	})
+	entryID, err := s.registerSchedule(backupSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to schedule backup: %v", err)
+	}
+
+	s.setCronEntry(scheduleID, entryID)
+	return warnings, nil
+}
+
+// ReloadSchedules re-reads the active schedules from the database and
+// re-registers their cron jobs. Removing a cron entry only stops future runs,
+// so backups that are already in flight are not interrupted.
+func (s *BackupService) ReloadSchedules() (int, error) {
+	schedules, err := s.backupRepo.GetAllActiveSchedules()
 	if err != nil {
-		return fmt.Errorf("failed to schedule backup: %v", err)
+		return 0, fmt.Errorf("failed to get active schedules: %v", err)
 	}
 
+	// Handlers and one-shot runs wait for the whole swap, so they never see
+	// a half reloaded set of entries
+	s.cronMu.Lock()
+	for scheduleID, entryID := range s.cronEntries {
+		s.cronManager.Remove(entryID)
+		delete(s.cronEntries, scheduleID)
+	}
+
+	for _, schedule := range schedules {
+		schedule := schedule
+		if schedule.Paused {
+			continue
+		}
+		entryID, err := s.registerSchedule(schedule)
+		if err != nil {
+			slog.Error("Failed to re-register schedule", "schedule_id", schedule.ID, "error", err)
+			continue
+		}
+		s.cronEntries[schedule.ID.String()] = entryID
+	}
+	registered := len(s.cronEntries)
+	s.cronMu.Unlock()
+
+	s.scheduleIntegrityVerification()
+	s.schedulePrechecks()
+	s.scheduleCredentialChecks()
+
+	return registered, nil
+}
+
+// setCronEntry records the cron job of a schedule and removes the job it
+// replaces
+func (s *BackupService) setCronEntry(scheduleID string, entryID cron.EntryID) {
+	s.cronMu.Lock()
+	defer s.cronMu.Unlock()
+	if oldEntryID, exists := s.cronEntries[scheduleID]; exists && oldEntryID != entryID {
+		s.cronManager.Remove(oldEntryID)
+	}
 	s.cronEntries[scheduleID] = entryID
-	return nil
+}
+
+// removeCronEntry stops the future runs of a schedule
+func (s *BackupService) removeCronEntry(scheduleID string) {
+	s.cronMu.Lock()
+	defer s.cronMu.Unlock()
+	if entryID, exists := s.cronEntries[scheduleID]; exists {
+		s.cronManager.Remove(entryID)
+		delete(s.cronEntries, scheduleID)
+	}
 }
 
 func (s *BackupService) executeCronBackup(schedule *BackupSchedule) {
@@ -92,33 +507,59 @@ func (s *BackupService) executeCronBackup(schedule *BackupSchedule) {
 	// 	return
 	// }
 
-	backup, err := s.CreateBackup(schedule.ConnectionID)
-	if err != nil {
-		if notifyErr := s.createFailureNotification(schedule.ConnectionID, err); notifyErr != nil {
-			fmt.Printf("Error creating failure notification: %v\n", notifyErr)
-		}
-	} else {
-		scheduleIDStr := schedule.ID.String()
-		if err := s.backupRepo.UpdateBackupStatusAndSchedule(backup.ID.String(), backup.Status, scheduleIDStr); err != nil {
-			fmt.Printf("Error updating backup status and schedule: %v\n", err)
+	if s.schedulePaused(schedule) {
+		slog.Info("Skipping backup of paused schedule", "schedule_id", schedule.ID)
+		return
+	}
+
+	if s.blackedOut(schedule) {
+		return
+	}
+
+	ctx, span := telemetry.StartSpan(context.Background(), "backup.scheduled",
+		attribute.String("velld.schedule.id", schedule.ID.String()),
+		attribute.String("velld.connection.id", schedule.ConnectionID))
+	defer span.End()
+
+	if !s.awaitPreviousRun(schedule) {
+		return
+	}
+
+	run, _, err := s.runBackup(ctx, schedule.ConnectionID, schedule)
+	s.notifyBackupRun(run, err)
+
+	// Every backup of the run belongs to the schedule
+	scheduleIDStr := schedule.ID.String()
+	for _, backupID := range run.backupIDs() {
+		if err := s.backupRepo.UpdateBackupStatusAndSchedule(backupID, "completed", scheduleIDStr); err != nil {
+			slog.ErrorContext(run.processes.jobContext(), "Failed to update backup status and schedule", "backup_id", backupID, "error", err)
 		}
 	}
 
 	// Update schedule's next run time and last backup time
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	cronSchedule, _ := parser.Parse(schedule.CronSchedule)
-	nextRun := cronSchedule.Next(time.Now())
-	schedule.NextRunTime = &nextRun
 	now := time.Now()
+	if schedule.RunAt != nil {
+		s.finishOneShot(schedule)
+	} else if cronSchedule, err := schedule.cronSchedule(); err == nil {
+		nextRun := cronSchedule.Next(now)
+		schedule.NextRunTime = &nextRun
+	}
 	schedule.LastBackupTime = &now
 	schedule.UpdatedAt = now
 
 	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
-		fmt.Printf("Error updating backup schedule: %v\n", err)
+		slog.ErrorContext(run.processes.jobContext(), "Failed to update backup schedule", "schedule_id", schedule.ID, "error", err)
 	}
 
-	if schedule.RetentionDays > 0 {
-		s.cleanupOldBackups(schedule.ConnectionID, schedule.RetentionDays)
+	if schedule.RetentionDays > 0 || schedule.RetentionMaxBytes > 0 {
+		_, retentionSpan := telemetry.StartSpan(ctx, "backup.retention")
+		if schedule.RetentionDays > 0 {
+			s.cleanupOldBackups(schedule.ConnectionID, schedule.RetentionDays)
+		}
+		if schedule.RetentionMaxBytes > 0 {
+			s.enforceStorageQuota(schedule.ConnectionID, schedule.RetentionMaxBytes)
+		}
+		retentionSpan.End()
 	}
 }
 
@@ -126,7 +567,7 @@ func (s *BackupService) cleanupOldBackups(connectionID string, retentionDays int
 	cutoffTime := time.Now().AddDate(0, 0, -retentionDays)
 	oldBackups, err := s.backupRepo.GetBackupsOlderThan(connectionID, cutoffTime)
 	if err != nil {
-		fmt.Printf("Error fetching old backups for cleanup: %v\n", err)
+		slog.Error("Failed to fetch old backups for cleanup", "connection_id", connectionID, "error", err)
 		return
 	}
 
@@ -134,17 +575,23 @@ func (s *BackupService) cleanupOldBackups(connectionID string, retentionDays int
 		return
 	}
 
+	s.removeBackups(connectionID, oldBackups, DeletionReasonRetention)
+}
+
+// removeBackups deletes backups of a connection with their files and S3
+// copies, recording reason as the reason of each deletion
+func (s *BackupService) removeBackups(connectionID string, oldBackups []*Backup, reason string) {
 	// Get connection to retrieve user settings for S3
 	conn, err := s.connStorage.GetConnection(connectionID)
 	if err != nil {
-		fmt.Printf("Error getting connection for cleanup: %v\n", err)
+		slog.Error("Failed to get connection for cleanup", "connection_id", connectionID, "error", err)
 		return
 	}
 
 	// Get user settings to check if S3 is enabled
 	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
 	if err != nil {
-		fmt.Printf("Warning: Failed to get user settings for cleanup: %v\n", err)
+		slog.Warn("Failed to get user settings for cleanup", "connection_id", connectionID, "error", err)
 		// Continue with local cleanup even if we can't get S3 settings
 	}
 
@@ -158,7 +605,7 @@ func (s *BackupService) cleanupOldBackups(connectionID string, retentionDays int
 		
 		secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
 		if err != nil {
-			fmt.Printf("Warning: Failed to decrypt S3 secret key for cleanup: %v\n", err)
+			slog.Warn("Failed to decrypt S3 secret key for cleanup", "connection_id", connectionID, "error", err)
 		} else {
 			region := "us-east-1"
 			if userSettings.S3Region != nil && *userSettings.S3Region != "" {
@@ -182,7 +629,7 @@ func (s *BackupService) cleanupOldBackups(connectionID string, retentionDays int
 
 			s3Storage, err = NewS3Storage(s3Config)
 			if err != nil {
-				fmt.Printf("Warning: Failed to create S3 storage client for cleanup: %v\n", err)
+				slog.Warn("Failed to create S3 storage client for cleanup", "connection_id", connectionID, "error", err)
 				s3Storage = nil
 			}
 		}
@@ -190,41 +637,58 @@ func (s *BackupService) cleanupOldBackups(connectionID string, retentionDays int
 
 	// Clean up old backups
 	ctx := context.Background()
+	var removed []string
 	for _, backup := range oldBackups {
 		backupID := backup.ID.String()
 		
 		// Delete from S3 if object key exists, S3 is configured, and connection has S3 cleanup enabled
 		if backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" && s3Storage != nil && conn.S3CleanupOnRetention {
 			if err := s3Storage.DeleteFile(ctx, *backup.S3ObjectKey); err != nil {
-				fmt.Printf("Warning: Failed to delete S3 object %s for backup %s: %v\n", 
-					*backup.S3ObjectKey, backupID, err)
+				slog.Warn("Failed to delete S3 object of backup",
+					"object_key", *backup.S3ObjectKey, "backup_id", backupID, "error", err)
 			} else {
-				fmt.Printf("Deleted S3 object %s for backup %s (retention cleanup)\n", 
-					*backup.S3ObjectKey, backupID)
+				slog.Info("Deleted S3 object of backup",
+					"object_key", *backup.S3ObjectKey, "backup_id", backupID, "reason", reason)
 			}
 		}
 
 		// Delete local file if it exists
 		if _, err := os.Stat(backup.Path); err == nil {
 			if err := os.Remove(backup.Path); err != nil {
-				fmt.Printf("Warning: Failed to delete local file %s for backup %s: %v\n", 
-					backup.Path, backupID, err)
+				slog.Warn("Failed to delete local file of backup",
+					"path", backup.Path, "backup_id", backupID, "error", err)
 			} else {
-				fmt.Printf("Deleted local file %s for backup %s (retention cleanup)\n", 
-					backup.Path, backupID)
+				slog.Info("Deleted local file of backup",
+					"path", backup.Path, "backup_id", backupID, "reason", reason)
 			}
 		}
+		removeChecksumManifest(backup.Path)
+		s.deletePostProcessedFiles(ctx, backup, s3Storage, conn.S3CleanupOnRetention)
+		s.releaseBackupChunks(backupID)
 
 		// Delete backup record from database
 		if err := s.backupRepo.DeleteBackup(backupID); err != nil {
-			fmt.Printf("Error deleting backup record %s: %v\n", backupID, err)
+			slog.Error("Failed to delete backup record", "backup_id", backupID, "error", err)
 		} else {
-			fmt.Printf("Deleted backup record %s (retention cleanup)\n", backupID)
+			slog.Info("Deleted backup record", "backup_id", backupID, "reason", reason)
+			removed = append(removed, backupID)
+			if err := s.backupRepo.RecordBackupDeletion(backup, reason); err != nil {
+				slog.Warn("Failed to record deletion of backup", "backup_id", backupID, "error", err)
+			}
 		}
 	}
 
-	fmt.Printf("Retention cleanup completed: processed %d old backups for connection %s\n", 
-		len(oldBackups), connectionID)
+	slog.Info("Backup cleanup completed for connection",
+		"connection_id", connectionID, "removed", len(oldBackups), "reason", reason)
+
+	if len(removed) > 0 {
+		s.publishEvent(conn, events.TypeRetentionPruned, map[string]interface{}{
+			"connection_id":   conn.ID,
+			"connection_name": conn.Name,
+			"reason":          reason,
+			"backup_ids":      removed,
+		})
+	}
 }
 
 func (s *BackupService) DisableBackupSchedule(connectionID string) error {
@@ -233,17 +697,14 @@ func (s *BackupService) DisableBackupSchedule(connectionID string) error {
 		return err
 	}
 
-	scheduleID := schedule.ID.String()
-	if entryID, exists := s.cronEntries[scheduleID]; exists {
-		s.cronManager.Remove(entryID)
-		delete(s.cronEntries, scheduleID)
-	}
+	s.removeCronEntry(schedule.ID.String())
 
 	schedule.Enabled = false
 	schedule.UpdatedAt = time.Now()
 	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
 		return err
 	}
+	s.dispatchScheduleEvent(webhook.EventScheduleDisabled, schedule)
 
 	return nil
 }
@@ -254,35 +715,309 @@ func (s *BackupService) UpdateBackupSchedule(connectionID string, req *UpdateSch
 		return err
 	}
 
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	_, err = parser.Parse(req.CronSchedule)
+	timezone, err := validateScheduleTimezone(req.Timezone, req.CronSchedule)
+	if err != nil {
+		return err
+	}
+	if timezone != nil {
+		schedule.Timezone = storedTimezone(*timezone)
+	}
+
+	if err := validateRunAt(req.RunAt, req.CronSchedule); err != nil {
+		return err
+	}
+
+	spec, err := scheduleSpec(req.CronSchedule, req.RunAt, timezoneName(schedule.Timezone))
+	if err != nil {
+		return err
+	}
+
+	gpgPublicKey, err := validateScheduleGPGKey(req.GPGPublicKey)
+	if err != nil {
+		return err
+	}
+
+	verifyConnectionID, err := s.validateVerifyConnection(connectionID, req.VerifyConnectionID)
+	if err != nil {
+		return err
+	}
+
+	compressionCommand, err := validateScheduleCompression(req.CompressionCommand)
+	if err != nil {
+		return err
+	}
+
+	discordWebhookURL, err := validateScheduleDiscordWebhook(req.DiscordWebhookURL)
+	if err != nil {
+		return err
+	}
+
+	heartbeatURL, err := validateHeartbeatURL(req.HeartbeatURL)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateStreamToStorage(connectionID, req.StreamToStorage); err != nil {
+		return err
+	}
+
+	if err := s.validatePgDumpJobs(connectionID, req.PgDumpJobs); err != nil {
+		return err
+	}
+
+	dumpFilters, err := s.validateDumpFilters(connectionID, req.DumpFilters)
+	if err != nil {
+		return err
+	}
+
+	extraDumpArgs, err := s.validateExtraDumpArgs(connectionID, req.ExtraDumpArgs)
+	if err != nil {
+		return err
+	}
+
+	effectiveFilters := schedule.DumpFilters
+	if req.DumpFilters != nil {
+		effectiveFilters = dumpFilters
+	}
+	mongoDumpOptions, err := s.validateMongoDumpOptions(connectionID, req.MongoDumpOptions, effectiveFilters)
+	if err != nil {
+		return err
+	}
+
+	postProcessors, err := s.validatePostProcessors(connectionID, req.PostProcessors)
+	if err != nil {
+		return err
+	}
+
+	effectiveJobs := schedule.PgDumpJobs
+	if req.PgDumpJobs != nil {
+		effectiveJobs = *req.PgDumpJobs
+	}
+	effectiveRules := &schedule.MaskingRules
+	if req.MaskingRules != nil {
+		effectiveRules = req.MaskingRules
+	}
+	maskingRules, err := s.validateMaskingRules(connectionID, effectiveRules, effectiveJobs)
+	if err != nil {
+		return err
+	}
+
+	effectiveSample := schedule.Sample
+	if req.Sample != nil {
+		effectiveSample = req.Sample
+	}
+	sample, err := s.validateSampleOptions(connectionID, effectiveSample, effectiveJobs, effectiveFilters)
+	if err != nil {
+		return err
+	}
+
+	effectivePhysical := &schedule.PhysicalBackup
+	if req.PhysicalBackup != nil {
+		effectivePhysical = req.PhysicalBackup
+	}
+	if err := s.validatePhysicalBackup(connectionID, effectivePhysical, effectiveJobs, effectiveFilters, sample, maskingRules); err != nil {
+		return err
+	}
+
+	effectiveIncrementals := &schedule.IncrementalBackups
+	if req.IncrementalBackups != nil {
+		effectiveIncrementals = req.IncrementalBackups
+	}
+	if err := s.validateIncrementalBackups(connectionID, effectiveIncrementals, *effectivePhysical); err != nil {
+		return err
+	}
+
+	effectiveAllDatabases := &schedule.AllDatabases
+	if req.AllDatabases != nil {
+		effectiveAllDatabases = req.AllDatabases
+	}
+	if err := s.validateAllDatabases(connectionID, effectiveAllDatabases, *effectivePhysical); err != nil {
+		return err
+	}
+
+	effectiveDatabases := &schedule.Databases
+	if req.Databases != nil {
+		effectiveDatabases = req.Databases
+	}
+	databases, err := s.validateScheduleDatabases(connectionID, effectiveDatabases, *effectiveAllDatabases, *effectivePhysical)
+	if err != nil {
+		return err
+	}
+
+	if err := validateDatabaseWorkers(req.DatabaseWorkers); err != nil {
+		return err
+	}
+
+	if err := s.validateRedisSnapshot(connectionID, req.RedisSnapshot); err != nil {
+		return err
+	}
+
+	if err := validateBandwidthLimit(req.BandwidthLimitKBps); err != nil {
+		return err
+	}
+
+	priority, err := validatePriority(req.Priority)
 	if err != nil {
-		return fmt.Errorf("invalid cron schedule: %v", err)
+		return err
+	}
+
+	concurrencyPolicy, err := validateConcurrencyPolicy(req.ConcurrencyPolicy)
+	if err != nil {
+		return err
+	}
+
+	if err := validateTimeout(req.TimeoutMinutes); err != nil {
+		return err
+	}
+
+	if err := validateJitter(req.JitterSeconds); err != nil {
+		return err
+	}
+
+	if err := validateRPO(req.RPOMinutes); err != nil {
+		return err
+	}
+
+	if err := validateSizeAnomalyPercent(req.SizeAnomalyPercent); err != nil {
+		return err
+	}
+
+	if err := validateVerificationObjective(req.VerificationObjectiveMinutes); err != nil {
+		return err
+	}
+
+	if err := validateStorageQuota(req.RetentionMaxBytes); err != nil {
+		return err
 	}
 
 	schedule.CronSchedule = req.CronSchedule
+	schedule.RunAt = req.RunAt
+	nextRun := spec.Next(time.Now())
+	schedule.NextRunTime = &nextRun
 	schedule.RetentionDays = req.RetentionDays
+	if req.RetentionMaxBytes != nil {
+		schedule.RetentionMaxBytes = *req.RetentionMaxBytes
+	}
+	if req.GPGPublicKey != nil {
+		schedule.GPGPublicKey = gpgPublicKey
+	}
+	if req.VerifyConnectionID != nil {
+		schedule.VerifyConnectionID = verifyConnectionID
+	}
+	if req.CompressionCommand != nil {
+		schedule.CompressionCommand = compressionCommand
+		if compressionCommand == nil {
+			schedule.CompressionLevel = 0
+			schedule.CompressionThreads = 0
+		}
+	}
+	if req.CompressionLevel != nil {
+		schedule.CompressionLevel = *req.CompressionLevel
+	}
+	if req.CompressionThreads != nil {
+		schedule.CompressionThreads = *req.CompressionThreads
+	}
+	if err := validateCompressionOptions(schedule); err != nil {
+		return err
+	}
+	if req.DiscordWebhookURL != nil {
+		schedule.DiscordWebhookURL = discordWebhookURL
+	}
+	if req.HeartbeatURL != nil {
+		schedule.HeartbeatURL = heartbeatURL
+	}
+	if req.StreamToStorage != nil {
+		schedule.StreamToStorage = *req.StreamToStorage
+	}
+	if req.PgDumpJobs != nil {
+		schedule.PgDumpJobs = *req.PgDumpJobs
+	}
+	if req.DumpFilters != nil {
+		schedule.DumpFilters = dumpFilters
+	}
+	if req.ExtraDumpArgs != nil {
+		schedule.ExtraDumpArgs = extraDumpArgs
+	}
+	if req.MongoDumpOptions != nil {
+		schedule.MongoDumpOptions = mongoDumpOptions
+	}
+	if req.PostProcessors != nil {
+		schedule.PostProcessors = postProcessors
+	}
+	if req.RedisSnapshot != nil {
+		schedule.RedisSnapshot = *req.RedisSnapshot
+	}
+	if req.BandwidthLimitKBps != nil {
+		schedule.BandwidthLimitKBps = *req.BandwidthLimitKBps
+	}
+	if req.Deduplicate != nil {
+		schedule.Deduplicate = *req.Deduplicate
+	}
+	if req.Priority != nil {
+		schedule.Priority = priority
+	}
+	if req.ConcurrencyPolicy != nil {
+		schedule.ConcurrencyPolicy = concurrencyPolicy
+	}
+	if req.TimeoutMinutes != nil {
+		schedule.TimeoutMinutes = *req.TimeoutMinutes
+	}
+	if req.JitterSeconds != nil {
+		schedule.JitterSeconds = *req.JitterSeconds
+	}
+	if req.RPOMinutes != nil {
+		schedule.RPOMinutes = *req.RPOMinutes
+	}
+	if req.SizeAnomalyPercent != nil {
+		schedule.SizeAnomalyPercent = *req.SizeAnomalyPercent
+	}
+	if req.VerificationObjectiveMinutes != nil {
+		schedule.VerificationObjectiveMinutes = *req.VerificationObjectiveMinutes
+	}
+	if req.MaskingRules != nil {
+		schedule.MaskingRules = maskingRules
+	}
+	if req.Sample != nil {
+		schedule.Sample = sample
+	}
+	if req.PhysicalBackup != nil {
+		schedule.PhysicalBackup = *req.PhysicalBackup
+	}
+	if req.IncrementalBackups != nil {
+		schedule.IncrementalBackups = *req.IncrementalBackups
+	}
+	if req.AllDatabases != nil {
+		schedule.AllDatabases = *req.AllDatabases
+	}
+	if req.DatabaseWorkers != nil {
+		schedule.DatabaseWorkers = *req.DatabaseWorkers
+	}
+	if req.Databases != nil {
+		schedule.Databases = databases
+	}
+	if req.RerunInterrupted != nil {
+		schedule.RerunInterrupted = req.RerunInterrupted
+	}
 	err = s.backupRepo.UpdateBackupSchedule(schedule)
 	if err != nil {
 		return err
 	}
+	s.dispatchScheduleEvent(webhook.EventScheduleUpdated, schedule)
 
 	// Remove old cron job
-	if entryID, ok := s.cronEntries[schedule.ID.String()]; ok {
-		s.cronManager.Remove(entryID)
-		delete(s.cronEntries, schedule.ID.String())
+	s.removeCronEntry(schedule.ID.String())
+	if schedule.Paused {
+		return nil
 	}
 
 	// Add new cron job
-	entryID, err := s.cronManager.AddFunc(schedule.CronSchedule, func() {
-		s.executeCronBackup(schedule)
-	})
+	entryID, err := s.registerSchedule(schedule)
 	if err != nil {
 		return fmt.Errorf("failed to register cron job: %v", err)
 	}
 
 	// Store the new entry ID
-	s.cronEntries[schedule.ID.String()] = entryID
+	s.setCronEntry(schedule.ID.String(), entryID)
 
 	return nil
 }
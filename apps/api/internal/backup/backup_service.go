@@ -2,60 +2,129 @@ package backup
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/events"
 	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/rules"
 	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/dendianugerah/velld/internal/webhook"
 	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
 )
 
 type BackupService struct {
 	connStorage      *connection.ConnectionRepository
+	connService      *connection.ConnectionService
 	backupDir        string
 	backupRepo       *BackupRepository
 	cronManager      *cron.Cron
+	cronMu           sync.Mutex // guards cronEntries, which handlers, cron jobs and reloads change
 	cronEntries      map[string]cron.EntryID // map[scheduleID]entryID
+	integrityEntry   cron.EntryID
+	precheckEntry    cron.EntryID
+	credentialEntry  cron.EntryID
+	precheckMu       sync.Mutex
+	dedupMu          sync.Mutex // serializes chunk store writes and releases
+	incidentMu       sync.Mutex // serializes raising and resolving incidents
+	prechecked       map[string]time.Time // map[scheduleID]pre-checked run time
 	settingsService  *settings.SettingsService
 	notificationRepo *notification.NotificationRepository
+	webhookService   *webhook.WebhookService
+	eventService     *events.EventService
+	ruleService      *rules.RuleService
 	cryptoService    *common.EncryptionService
+	activeUploads    sync.Map // backup IDs with a chunked upload running
+	transfers        sync.Map // map[backupID]*transfer, dump streams and uploads running
+	liveLogs         sync.Map // map[runID or restore ID]*liveLog, output of running processes
+	exportJobs       sync.Map // map[exportID]*atomic.Bool, running exports and their cancel flag
+	restoreJobs      sync.Map // map[restore ID]*restoreJob, progress of running and recent restores
+	progressMeters   sync.Map // map[runID or restore ID]*progressMeter, progress pushed to clients
+	importLocks      sync.Map // map[importID]*sync.Mutex, serializes the chunks of a dump upload
+	deferredRuns     sync.Map // map[scheduleID]time.Time, runs deferred past a maintenance window
+	privilegeChecks  sync.Map // map[connectionID]*cachedPrivilegeCheck, recent privilege pre-flight results
+	jobQueue         jobQueue
+	runsMu           sync.Mutex
+	connectionRuns   map[string]*connectionRun // map[connectionID]run, queued and running backup runs
+	metricsMu        sync.Mutex
+	runMetrics       map[string]*connectionRunMetrics // map[connectionID]metrics
+	signer           *artifactSigner
+	schedulerBeat    atomic.Int64 // unix nanoseconds of the scheduler's last heartbeat
 }
 
 func NewBackupService(
 	connStorage *connection.ConnectionRepository,
+	connService *connection.ConnectionService,
 	backupDir string,
 	backupRepo *BackupRepository,
 	settingsService *settings.SettingsService,
 	notificationRepo *notification.NotificationRepository,
+	webhookService *webhook.WebhookService,
+	eventService *events.EventService,
+	ruleService *rules.RuleService,
 	cryptoService *common.EncryptionService,
 ) *BackupService {
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
 		panic(err)
 	}
 
-	cronManager := cron.New(cron.WithSeconds())
+	cronManager := cron.New(cron.WithParser(scheduleParser))
 	service := &BackupService{
 		connStorage:      connStorage,
+		connService:      connService,
 		backupDir:        backupDir,
 		backupRepo:       backupRepo,
 		settingsService:  settingsService,
 		notificationRepo: notificationRepo,
+		webhookService:   webhookService,
+		eventService:     eventService,
+		ruleService:      ruleService,
 		cryptoService:    cryptoService,
 		cronManager:      cronManager,
 		cronEntries:      make(map[string]cron.EntryID),
+		runMetrics:       make(map[string]*connectionRunMetrics),
+		connectionRuns:   make(map[string]*connectionRun),
+		prechecked:       make(map[string]time.Time),
 	}
 
+	signer, err := loadArtifactSigner()
+	if err != nil {
+		slog.Error("Failed to load backup signing key, backups will not be signed", "error", err)
+	}
+	service.signer = signer
+
 	// Recover existing schedules before starting the cron manager
 	if err := service.recoverSchedules(); err != nil {
-		fmt.Printf("Error recovering schedules: %v\n", err)
-	}
+		slog.Error("Failed to recover schedules", "error", err)
+	}
+	service.recoverInterruptedRestores()
+
+	service.scheduleIntegrityVerification()
+	service.schedulePrechecks()
+	service.scheduleCredentialChecks()
+	service.scheduleSandboxRemoval()
+	service.scheduleImportCleanup()
+	service.scheduleStorageReconciliation()
+	service.scheduleDigests()
+	service.scheduleStalenessAlerts()
+	service.scheduleRuleChecks()
+	service.scheduleHeartbeat()
+	service.scheduleRunLogCleanup()
+
+	go service.resumePendingUploads()
+	go service.resumeArtifactExports()
+	go service.recoverRestoreSandboxes()
 
 	cronManager.Start()
 	return service
@@ -68,51 +137,94 @@ func (s *BackupService) recoverSchedules() error {
 	}
 
 	now := time.Now()
+	var missed []*BackupSchedule
 	for _, schedule := range schedules {
 		scheduleID := schedule.ID.String()
+		if schedule.Paused {
+			continue
+		}
 
 		// Check if we missed any backups
 		if schedule.NextRunTime != nil && schedule.NextRunTime.Before(now) {
-			// Execute a backup immediately for missed schedule
-			go s.executeCronBackup(schedule)
+			missed = append(missed, schedule)
 		}
 
 		// Re-register the cron job
-		entryID, err := s.cronManager.AddFunc(schedule.CronSchedule, func() {
-			s.executeCronBackup(schedule)
-		})
+		entryID, err := s.registerSchedule(schedule)
 		if err != nil {
-			fmt.Printf("Error re-registering schedule %s: %v\n", scheduleID, err)
+			slog.Error("Failed to re-register schedule", "schedule_id", scheduleID, "error", err)
 			continue
 		}
 
-		s.cronEntries[scheduleID] = entryID
+		s.setCronEntry(scheduleID, entryID)
 	}
 
+	// Runs interrupted by a crash or restart are closed, and the ones that
+	// saved nothing run again
+	missed = s.rerunInterruptedRuns(s.recoverInterruptedRuns(), missed)
+
+	// Missed backups are caught up through a throttled queue
+	go s.catchUpMissedSchedules(missed)
+
 	return nil
 }
 
 func (s *BackupService) CreateBackup(connectionID string) (*Backup, error) {
+	_, backup, err := s.runBackup(context.Background(), connectionID, nil)
+	return backup, err
+}
+
+func (s *BackupService) createBackup(connectionID string, run *BackupRun) (*Backup, error) {
 	conn, err := s.connStorage.GetConnection(connectionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get connection: %v", err)
 	}
 
+	if _, err := s.preflightDumpPrivileges(connectionID); err != nil {
+		return nil, err
+	}
+
+	// Per-schedule backup options (e.g. encryption) also apply to manual backups
+	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get backup schedule: %v", err)
+	}
+
+	if err := s.selectRunDatabases(conn, schedule); err != nil {
+		return nil, err
+	}
+
+	if err := s.preflightBackupSize(conn, schedule, run); err != nil {
+		return nil, err
+	}
+
+	s.describeRunSchemas(conn, run)
+
 	// Check if multi-database backup is needed
 	if len(conn.SelectedDatabases) > 0 {
 		// Create backups for all selected databases
-		return s.createMultiDatabaseBackup(conn)
+		return s.createMultiDatabaseBackup(conn, schedule, run)
 	}
 
 	// Single database backup
-	return s.createSingleDatabaseBackup(conn, conn.DatabaseName)
+	backup, err := s.createSingleDatabaseBackup(conn, conn.DatabaseName, schedule, run)
+	if err != nil {
+		run.recordJob(RunJobDump, conn.DatabaseName, nil, err)
+	}
+	return backup, err
 }
 
-func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnection) (*Backup, error) {
+func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnection, schedule *BackupSchedule, run *BackupRun) (*Backup, error) {
 	if err := s.verifyBackupTools(conn.Type); err != nil {
 		return nil, err
 	}
 
+	switch conn.Type {
+	case "postgresql", "mysql", "mariadb", "mongodb", "redis":
+	default:
+		return nil, fmt.Errorf("unsupported database type for backup: %s", conn.Type)
+	}
+
 	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(conn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to setup SSH tunnel: %v", err)
@@ -134,94 +246,243 @@ func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnect
 	var failedDatabases []string
 	var successfulBackups []*Backup
 
-	for _, dbName := range conn.SelectedDatabases {
-		backupID := uuid.New()
-		filename := fmt.Sprintf("%s_%s.sql", dbName, timestamp)
-		backupPath := filepath.Join(connectionFolder, filename)
-
-		tempConn := *conn
-		tempConn.DatabaseName = dbName
-
-		var cmd *exec.Cmd
-		switch conn.Type {
-		case "postgresql":
-			cmd = s.createPgDumpCmd(&tempConn, backupPath)
-		case "mysql", "mariadb":
-			cmd = s.createMySQLDumpCmd(&tempConn, backupPath)
-		case "mongodb":
-			cmd = s.createMongoDumpCmd(&tempConn, backupPath)
-		case "redis":
-			cmd = s.createRedisDumpCmd(&tempConn, backupPath)
-		default:
-			return nil, fmt.Errorf("unsupported database type for backup: %s", conn.Type)
-		}
+	storage := s.streamingStorageFor(conn, schedule)
+
+	// Databases are dumped by up to the schedule's number of workers, their
+	// results are collected in the order of the selection
+	backups := make([]*Backup, len(conn.SelectedDatabases))
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, databaseWorkersFor(schedule))
+	for i, dbName := range conn.SelectedDatabases {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, dbName string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			tempConn := *conn
+			tempConn.DatabaseName = dbName
+			backupPath := filepath.Join(connectionFolder,
+				fmt.Sprintf("%s_%s%s", dbName, timestamp, dumpFileExtension(conn, schedule)))
+
+			backup, err := s.backupSelectedDatabase(&tempConn, storage, backupPath, startTime, schedule, run)
+			if err != nil {
+				slog.WarnContext(run.processes.jobContext(), "Database backup failed", "database", dbName, "error", err)
+				run.recordJob(RunJobDump, dbName, nil, err)
+				return
+			}
 
-		if cmd == nil {
-			fmt.Printf("Warning: backup tool not found for database '%s'\n", dbName)
-			failedDatabases = append(failedDatabases, dbName)
-			continue
-		}
+			s.verifyBackupByRestoreIfConfigured(backup, schedule)
+			s.deduplicateBackupIfConfigured(backup, schedule)
+			backups[i] = backup
+		}(i, dbName)
+	}
+	wg.Wait()
 
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			fmt.Printf("Warning: Failed to backup database '%s': %s\n", dbName, string(output))
-			failedDatabases = append(failedDatabases, dbName)
+	for i, backup := range backups {
+		if backup == nil {
+			failedDatabases = append(failedDatabases, conn.SelectedDatabases[i])
 			continue
 		}
+		successfulBackups = append(successfulBackups, backup)
+	}
 
-		fileInfo, err := os.Stat(backupPath)
-		if err != nil {
-			fmt.Printf("Warning: Failed to get file info for database '%s': %v\n", dbName, err)
-			failedDatabases = append(failedDatabases, dbName)
-			continue
+	if len(successfulBackups) == 0 {
+		if len(failedDatabases) > 0 {
+			return nil, fmt.Errorf("all database backups failed: %v", failedDatabases)
 		}
+		return nil, fmt.Errorf("all database backups failed")
+	}
+
+	if len(failedDatabases) > 0 {
+		slog.WarnContext(run.processes.jobContext(), "Multi-database backup completed with some failures",
+			"succeeded", len(successfulBackups), "total", len(conn.SelectedDatabases), "failed", failedDatabases)
+	} else {
+		slog.InfoContext(run.processes.jobContext(), "Multi-database backup completed",
+			"succeeded", len(successfulBackups), "total", len(conn.SelectedDatabases))
+	}
+
+	return successfulBackups[0], nil
+}
 
+// backupSelectedDatabase backs up one database of a multi-database run
+func (s *BackupService) backupSelectedDatabase(conn *connection.StoredConnection, storage *S3Storage, backupPath string, startTime time.Time, schedule *BackupSchedule, run *BackupRun) (*Backup, error) {
+	dbName := conn.DatabaseName
+	runID := run.ID.String()
+
+	if storage != nil {
 		backup := &Backup{
-			ID:           backupID,
+			ID:           uuid.New(),
 			ConnectionID: conn.ID,
+			DatabaseName: &dbName,
+			DatabaseSize: run.databaseSize(dbName),
+			RunID:        &runID,
 			StartedTime:  startTime,
 			Status:       "completed",
 			Path:         backupPath,
-			Size:         fileInfo.Size(),
+			DumpFilters:  dumpFiltersFor(schedule),
 			CreatedAt:    time.Now(),
 			UpdatedAt:    time.Now(),
 		}
 
+		err := run.processes.traceStage("backup.stream", func() error {
+			run.estimateDumpTotal(dbName)
+			return s.streamBackupToStorage(conn, storage, backup, schedule, run.processes)
+		}, databaseAttributes(conn, dbName)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stream backup of database '%s': %v", dbName, err)
+		}
+
 		now := time.Now()
 		backup.CompletedTime = &now
-
-		if err := s.uploadToS3IfEnabled(backup, conn.UserID, conn.Name); err != nil {
-			fmt.Printf("Warning: Failed to upload backup '%s' to S3: %v\n", dbName, err)
-		}
+		s.buildBackupManifest(backup, conn, run)
 
 		if err := s.backupRepo.CreateBackup(backup); err != nil {
-			fmt.Printf("Warning: Failed to save backup record for '%s': %v\n", dbName, err)
-			failedDatabases = append(failedDatabases, dbName)
-			continue
+			return nil, fmt.Errorf("failed to save backup record for '%s': %v", dbName, err)
 		}
+		run.recordJob(RunJobDump, dbName, backup, nil)
+		return backup, nil
+	}
+
+	var environment *RunEnvironment
+	err := run.processes.traceStage("backup.dump", func() error {
+		run.processes.meter.watch(backupPath)
+		run.estimateDumpTotal(dbName)
+		var err error
+		environment, err = s.dumpSelectedDatabase(conn, backupPath, schedule, run)
+		return err
+	}, databaseAttributes(conn, dbName)...)
+	if err != nil {
+		return nil, err
+	}
 
-		successfulBackups = append(successfulBackups, backup)
+	if err := packDirectoryDump(backupPath); err != nil {
+		return nil, fmt.Errorf("failed to pack dump of database '%s': %v", dbName, err)
 	}
 
-	if len(successfulBackups) == 0 {
-		if len(failedDatabases) > 0 {
-			return nil, fmt.Errorf("all database backups failed: %v", failedDatabases)
+	fileInfo, err := os.Stat(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info for database '%s': %v", dbName, err)
+	}
+
+	backup := &Backup{
+		ID:             uuid.New(),
+		ConnectionID:   conn.ID,
+		DatabaseName:   &dbName,
+		DatabaseSize:   run.databaseSize(dbName),
+		RunID:          &runID,
+		StartedTime:    startTime,
+		Status:         "completed",
+		Path:           backupPath,
+		Size:           fileInfo.Size(),
+		DumpFilters:    dumpFiltersFor(schedule),
+		RunEnvironment: environment,
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+
+	attrs := databaseAttributes(conn, dbName)
+	if err := run.processes.traceStage("backup.compress", func() error {
+		return s.compressBackupIfConfigured(backup, schedule)
+	}, attrs...); err != nil {
+		return nil, fmt.Errorf("failed to compress backup for database '%s': %v", dbName, err)
+	}
+
+	if err := run.processes.traceStage("backup.encrypt", func() error {
+		return s.encryptBackupIfConfigured(backup, schedule)
+	}, attrs...); err != nil {
+		return nil, fmt.Errorf("failed to encrypt backup for database '%s': %v", dbName, err)
+	}
+
+	if err := run.processes.traceStage("backup.checksum", func() error {
+		return s.recordBackupChecksum(backup)
+	}, attrs...); err != nil {
+		return nil, fmt.Errorf("failed to checksum backup for database '%s': %v", dbName, err)
+	}
+
+	run.processes.traceStage("backup.post_process", func() error {
+		s.postProcessBackupIfConfigured(backup, conn, schedule)
+		return nil
+	}, attrs...)
+	s.catalogBackup(backup, conn)
+
+	now := time.Now()
+	backup.CompletedTime = &now
+	s.buildBackupManifest(backup, conn, run)
+
+	s.replaceArtifactWithPartsIfConfigured(backup, schedule)
+
+	uploadErr := run.processes.traceStage("backup.upload", func() error {
+		return s.uploadToS3IfEnabled(backup, conn.UserID, conn.Name, schedule)
+	}, attrs...)
+	if uploadErr != nil {
+		slog.WarnContext(run.processes.jobContext(), "Failed to upload backup to S3", "database", dbName, "error", uploadErr)
+	}
+
+	if err := s.backupRepo.CreateBackup(backup); err != nil {
+		return nil, fmt.Errorf("failed to save backup record for '%s': %v", dbName, err)
+	}
+	run.recordJob(RunJobDump, dbName, backup, nil)
+	run.recordUpload(backup, uploadErr)
+
+	return backup, nil
+}
+
+// dumpSelectedDatabase runs the dump of one database of a multi-database run
+// into backupPath
+func (s *BackupService) dumpSelectedDatabase(conn *connection.StoredConnection, backupPath string, schedule *BackupSchedule, run *BackupRun) (*RunEnvironment, error) {
+	dbName := conn.DatabaseName
+	if physicalBackupFor(schedule) {
+		return nil, fmt.Errorf("physical backups include every database and cannot be combined with selected databases")
+	}
+	if sampleOptionsFor(schedule) != nil {
+		return s.createSampleDump(conn, dbName, backupPath, schedule, run.processes)
+	}
+
+	var cmd *exec.Cmd
+	switch conn.Type {
+	case "postgresql":
+		cmd = s.createPgDumpCmdForSchedule(conn, backupPath, schedule)
+	case "mysql", "mariadb":
+		cmd = s.createMySQLDumpCmd(conn, backupPath)
+	case "mongodb":
+		cmd = s.createMongoDumpCmd(conn, backupPath)
+	case "redis":
+		cmd = s.createRedisDumpCmd(conn, backupPath)
+	}
+
+	if cmd == nil {
+		return nil, fmt.Errorf("backup tool not found for database '%s'", dbName)
+	}
+	applyDumpFilters(cmd, conn, dumpFiltersFor(schedule))
+	applyExtraDumpArgs(cmd, schedule)
+	applyMongoDumpOptions(cmd, mongoDumpOptionsFor(schedule))
+	environment := captureRunEnvironment(cmd, schedule, false)
+
+	masker, err := newDumpMasker(conn, schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to backup database '%s': %v", dbName, err)
+	}
+
+	output, err := run.processes.combinedOutput(cmd)
+	if err != nil {
+		if run.processes.timedOut() {
+			removePartialDump(backupPath)
+			return nil, fmt.Errorf("backup of database '%s' timed out", dbName)
 		}
-		return nil, fmt.Errorf("all database backups failed")
+		return nil, fmt.Errorf("failed to backup database '%s': %s", dbName, string(output))
 	}
 
-	if len(failedDatabases) > 0 {
-		fmt.Printf("Multi-database backup completed with some failures: %d/%d databases backed up successfully, %d failed: %v\n",
-			len(successfulBackups), len(conn.SelectedDatabases), len(failedDatabases), failedDatabases)
-	} else {
-		fmt.Printf("Multi-database backup completed: %d/%d databases backed up successfully\n",
-			len(successfulBackups), len(conn.SelectedDatabases))
+	if masker != nil {
+		if err := maskDumpFile(run.processes.jobContext(), backupPath, masker); err != nil {
+			return nil, fmt.Errorf("failed to backup database '%s': %v", dbName, err)
+		}
 	}
 
-	return successfulBackups[0], nil
+	return environment, nil
 }
 
-func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnection, dbName string) (*Backup, error) {
+func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnection, dbName string, schedule *BackupSchedule, run *BackupRun) (*Backup, error) {
 	if err := s.verifyBackupTools(conn.Type); err != nil {
 		return nil, err
 	}
@@ -240,7 +501,7 @@ func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnec
 
 	backupID := uuid.New()
 	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("%s_%s.sql", dbName, timestamp)
+	filename := fmt.Sprintf("%s_%s%s", dbName, timestamp, dumpFileExtension(conn, schedule))
 
 	connectionFolder := filepath.Join(s.backupDir, common.SanitizeConnectionName(conn.Name))
 	if err := os.MkdirAll(connectionFolder, 0755); err != nil {
@@ -248,21 +509,142 @@ func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnec
 	}
 
 	backupPath := filepath.Join(connectionFolder, filename)
+	runID := run.ID.String()
 
 	backup := &Backup{
 		ID:           backupID,
 		ConnectionID: conn.ID,
+		DatabaseName: &dbName,
+		DatabaseSize: run.databaseSize(dbName),
+		RunID:        &runID,
 		StartedTime:  time.Now(),
 		Status:       "in_progress",
 		Path:         backupPath,
+		DumpFilters:  dumpFiltersFor(schedule),
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
 
+	attrs := databaseAttributes(conn, dbName)
+
+	// Streamed dumps go straight to S3 without touching local disk
+	if storage := s.streamingStorageFor(conn, schedule); storage != nil {
+		if err := run.processes.traceStage("backup.stream", func() error {
+			run.estimateDumpTotal(dbName)
+			return s.streamBackupToStorage(conn, storage, backup, schedule, run.processes)
+		}, attrs...); err != nil {
+			return nil, fmt.Errorf("backup failed for %s database '%s' on %s:%d - %v",
+				conn.Type, dbName, conn.Host, conn.Port, err)
+		}
+
+		backup.Status = "completed"
+		now := time.Now()
+		backup.CompletedTime = &now
+		s.buildBackupManifest(backup, conn, run)
+
+		if err := s.backupRepo.CreateBackup(backup); err != nil {
+			return nil, fmt.Errorf("failed to save backup: %v", err)
+		}
+		run.recordJob(RunJobDump, dbName, backup, nil)
+
+		s.verifyBackupByRestoreIfConfigured(backup, schedule)
+
+		return backup, nil
+	}
+
+	var environment *RunEnvironment
+	err = run.processes.traceStage("backup.dump", func() error {
+		run.processes.meter.watch(backupPath)
+		run.estimateDumpTotal(dbName)
+		var err error
+		if redisSnapshotFor(schedule) {
+			environment, err = s.createRedisSnapshot(conn, tunnel, backupPath, schedule)
+			if err != nil {
+				return fmt.Errorf("backup failed for %s database '%s' on %s:%d - %v",
+					conn.Type, dbName, conn.Host, conn.Port, err)
+			}
+		} else if sampleOptionsFor(schedule) != nil {
+			environment, err = s.createSampleDump(conn, dbName, backupPath, schedule, run.processes)
+		} else if physicalBackupFor(schedule) {
+			environment, err = s.createPhysicalBackup(conn, tunnel, backup, schedule, run.processes)
+		} else {
+			environment, err = s.runDumpCommand(conn, dbName, backupPath, schedule, run.processes)
+		}
+		return err
+	}, attrs...)
+	if err != nil {
+		return nil, err
+	}
+	backup.RunEnvironment = environment
+
+	if err := packDirectoryDump(backupPath); err != nil {
+		return nil, err
+	}
+
+	// Get file size
+	fileInfo, err := os.Stat(backupPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup file info: %v", err)
+	}
+
+	backup.Size = fileInfo.Size()
+
+	if err := run.processes.traceStage("backup.compress", func() error {
+		return s.compressBackupIfConfigured(backup, schedule)
+	}, attrs...); err != nil {
+		return nil, err
+	}
+
+	if err := run.processes.traceStage("backup.encrypt", func() error {
+		return s.encryptBackupIfConfigured(backup, schedule)
+	}, attrs...); err != nil {
+		return nil, err
+	}
+
+	if err := run.processes.traceStage("backup.checksum", func() error {
+		return s.recordBackupChecksum(backup)
+	}, attrs...); err != nil {
+		return nil, err
+	}
+
+	run.processes.traceStage("backup.post_process", func() error {
+		s.postProcessBackupIfConfigured(backup, conn, schedule)
+		return nil
+	}, attrs...)
+	s.catalogBackup(backup, conn)
+
+	backup.Status = "completed"
+	now := time.Now()
+	backup.CompletedTime = &now
+	s.buildBackupManifest(backup, conn, run)
+
+	s.replaceArtifactWithPartsIfConfigured(backup, schedule)
+
+	uploadErr := run.processes.traceStage("backup.upload", func() error {
+		return s.uploadToS3IfEnabled(backup, conn.UserID, conn.Name, schedule)
+	}, attrs...)
+	if uploadErr != nil {
+		slog.WarnContext(run.processes.jobContext(), "Failed to upload backup to S3", "database", dbName, "error", uploadErr)
+	}
+
+	if err := s.backupRepo.CreateBackup(backup); err != nil {
+		return nil, fmt.Errorf("failed to save backup: %v", err)
+	}
+	run.recordJob(RunJobDump, dbName, backup, nil)
+	run.recordUpload(backup, uploadErr)
+
+	s.verifyBackupByRestoreIfConfigured(backup, schedule)
+	s.deduplicateBackupIfConfigured(backup, schedule)
+
+	return backup, nil
+}
+
+// runDumpCommand runs the dump tool of the connection type into backupPath
+func (s *BackupService) runDumpCommand(conn *connection.StoredConnection, dbName, backupPath string, schedule *BackupSchedule, processes *processTracker) (*RunEnvironment, error) {
 	var cmd *exec.Cmd
 	switch conn.Type {
 	case "postgresql":
-		cmd = s.createPgDumpCmd(conn, backupPath)
+		cmd = s.createPgDumpCmdForSchedule(conn, backupPath, schedule)
 	case "mysql", "mariadb":
 		cmd = s.createMySQLDumpCmd(conn, backupPath)
 	case "mongodb":
@@ -276,9 +658,22 @@ func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnec
 	if cmd == nil {
 		return nil, fmt.Errorf("backup tool not found for %s. Please ensure %s is installed and available in PATH", conn.Type, requiredTools[conn.Type])
 	}
+	applyDumpFilters(cmd, conn, dumpFiltersFor(schedule))
+	applyExtraDumpArgs(cmd, schedule)
+	applyMongoDumpOptions(cmd, mongoDumpOptionsFor(schedule))
+	environment := captureRunEnvironment(cmd, schedule, false)
+
+	masker, err := newDumpMasker(conn, schedule)
+	if err != nil {
+		return nil, err
+	}
 
-	output, err := cmd.CombinedOutput()
+	output, err := processes.combinedOutput(cmd)
 	if err != nil {
+		if processes.timedOut() {
+			removePartialDump(backupPath)
+			return nil, fmt.Errorf("backup of %s database '%s' timed out", conn.Type, dbName)
+		}
 		errorMsg := string(output)
 		if errorMsg == "" {
 			errorMsg = err.Error()
@@ -287,26 +682,13 @@ func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnec
 			conn.Type, dbName, conn.Host, conn.Port, errorMsg)
 	}
 
-	// Get file size
-	fileInfo, err := os.Stat(backupPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get backup file info: %v", err)
-	}
-
-	backup.Size = fileInfo.Size()
-	backup.Status = "completed"
-	now := time.Now()
-	backup.CompletedTime = &now
-
-	if err := s.uploadToS3IfEnabled(backup, conn.UserID, conn.Name); err != nil {
-		fmt.Printf("Warning: Failed to upload backup to S3: %v\n", err)
-	}
-
-	if err := s.backupRepo.CreateBackup(backup); err != nil {
-		return nil, fmt.Errorf("failed to save backup: %v", err)
+	if masker != nil {
+		if err := maskDumpFile(processes.jobContext(), backupPath, masker); err != nil {
+			return nil, err
+		}
 	}
 
-	return backup, nil
+	return environment, nil
 }
 
 func (s *BackupService) GetBackup(id string) (*Backup, error) {
@@ -331,7 +713,7 @@ func (s *BackupService) GetBackupStats(userID uuid.UUID) (*BackupStats, error) {
 	return s.backupRepo.GetBackupStats(userID)
 }
 
-func (s *BackupService) uploadToS3IfEnabled(backup *Backup, userID uuid.UUID, connectionName string) error {
+func (s *BackupService) uploadToS3IfEnabled(backup *Backup, userID uuid.UUID, connectionName string, schedule *BackupSchedule) error {
 	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
 	if err != nil {
 		return fmt.Errorf("failed to get user settings: %w", err)
@@ -386,24 +768,50 @@ func (s *BackupService) uploadToS3IfEnabled(backup *Backup, userID uuid.UUID, co
 	}
 
 	ctx := context.Background()
+	transfer := s.beginTransfer(backup, TransferKindUpload, schedule)
+	defer s.endTransfer(transfer)
+
 	// Use sanitized connection name as subfolder
 	sanitizedConnectionName := common.SanitizeConnectionName(connectionName)
-	objectKey, err := s3Storage.UploadFileWithPath(ctx, backup.Path, sanitizedConnectionName)
+	var objectKey string
+	if artifactReplacedBySplit(backup) {
+		// The manifest with the part index stands in for the artifact
+		objectKey, err = uploadFile(ctx, s3Storage, transfer, backup.Path+manifestSuffix, sanitizedConnectionName)
+	} else if backup.Size > uploadPartSize() {
+		objectKey, err = s.uploadResumable(s3Storage, transfer, backup, sanitizedConnectionName)
+	} else {
+		objectKey, err = uploadFile(ctx, s3Storage, transfer, backup.Path, sanitizedConnectionName)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to upload backup to S3: %w", err)
 	}
 
 	backup.S3ObjectKey = &objectKey
 
-	fmt.Printf("Successfully uploaded backup %s to S3: %s\n", backup.ID, objectKey)
+	slog.InfoContext(backupContext(backup), "Uploaded backup to S3", "backup_id", backup.ID, "object_key", objectKey)
+
+	uploadPostProcessedFiles(s3Storage, transfer, backup, sanitizedConnectionName)
+
+	// Parts that replace the artifact are its only copy, so they stay local
+	// until all of them are uploaded
+	if artifactReplacedBySplit(backup) {
+		for _, part := range splitPartFiles(backup) {
+			if part.ObjectKey == nil {
+				return fmt.Errorf("failed to upload part %s to S3", filepath.Base(part.Path))
+			}
+		}
+	}
 
 	// Purge local backup file if enabled
 	if userSettings.S3PurgeLocal {
-		if err := os.Remove(backup.Path); err != nil {
-			fmt.Printf("Warning: Failed to purge local backup file %s: %v\n", backup.Path, err)
-		} else {
-			fmt.Printf("Successfully purged local backup file: %s\n", backup.Path)
+		// Artifacts replaced by their split parts have no local file left
+		if err := os.Remove(backup.Path); err != nil && !os.IsNotExist(err) {
+			slog.WarnContext(backupContext(backup), "Failed to purge local backup file", "path", backup.Path, "error", err)
+		} else if err == nil {
+			slog.InfoContext(backupContext(backup), "Purged local backup file", "path", backup.Path)
 		}
+		removeChecksumManifest(backup.Path)
+		removePostProcessedFiles(backup)
 	}
 
 	return nil
@@ -418,6 +826,20 @@ func (s *BackupService) ensureBackupFileAvailable(backup *Backup, userID uuid.UU
 		return backup.Path, false, nil
 	}
 
+	// Artifacts replaced by their split parts are reassembled from the parts
+	if path, err := s.reassembleSplitBackup(backup, userID); err != nil {
+		return "", false, err
+	} else if path != "" {
+		return path, true, nil
+	}
+
+	// Deduplicated artifacts are reassembled from the chunk store
+	if path, err := s.reassembleDeduplicatedBackup(backup); err != nil {
+		slog.Warn("Failed to reassemble deduplicated backup", "backup_id", backup.ID, "error", err)
+	} else if path != "" {
+		return path, true, nil
+	}
+
 	// Local file doesn't exist, check if we have S3 object key
 	if backup.S3ObjectKey == nil || *backup.S3ObjectKey == "" {
 		return "", false, fmt.Errorf("backup file not found locally and no S3 object key available")
@@ -493,7 +915,7 @@ func (s *BackupService) ensureBackupFileAvailable(backup *Backup, userID uuid.UU
 		return "", false, fmt.Errorf("failed to download backup from S3: %w", err)
 	}
 
-	fmt.Printf("Successfully downloaded backup %s from S3 to temp location: %s\n", backup.ID, tempFilePath)
+	slog.Info("Downloaded backup from S3 to temp location", "backup_id", backup.ID, "path", tempFilePath)
 	
 	// Return temp file path and indicate it should be cleaned up
 	return tempFilePath, true, nil
@@ -572,16 +994,16 @@ func (s *BackupService) CleanupS3BackupsForConnection(connectionID string) error
 	for _, backup := range backups {
 		if backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" {
 			if err := s3Storage.DeleteFile(ctx, *backup.S3ObjectKey); err != nil {
-				fmt.Printf("Warning: Failed to delete S3 object %s: %v\n", *backup.S3ObjectKey, err)
+				slog.Warn("Failed to delete S3 object", "object_key", *backup.S3ObjectKey, "error", err)
 			} else {
 				deletedCount++
-				fmt.Printf("Deleted S3 object %s for backup %s (connection cleanup)\n", 
-					*backup.S3ObjectKey, backup.ID)
+				slog.Info("Deleted S3 object of backup (connection cleanup)",
+					"object_key", *backup.S3ObjectKey, "backup_id", backup.ID)
 			}
 		}
 	}
 
-	fmt.Printf("S3 cleanup completed for connection %s: deleted %d objects\n", connectionID, deletedCount)
+	slog.Info("S3 cleanup completed for connection", "connection_id", connectionID, "deleted", deletedCount)
 	return nil
 }
 
@@ -678,22 +1100,22 @@ func (s *BackupService) RenameS3FolderForConnection(connectionID string, oldName
 
 		// Move object in S3
 		if err := s3Storage.MoveFile(ctx, oldKey, newKey); err != nil {
-			fmt.Printf("Warning: Failed to rename S3 object %s to %s: %v\n", oldKey, newKey, err)
+			slog.Warn("Failed to rename S3 object", "from", oldKey, "to", newKey, "error", err)
 			continue
 		}
 
 		// Update database record with new S3 object key
 		backup.S3ObjectKey = &newKey
 		if err := s.backupRepo.UpdateBackupS3ObjectKey(backup.ID.String(), newKey); err != nil {
-			fmt.Printf("Warning: Failed to update S3 object key in database for backup %s: %v\n", backup.ID, err)
+			slog.Warn("Failed to update S3 object key in database", "backup_id", backup.ID, "error", err)
 			continue
 		}
 
 		renamedCount++
-		fmt.Printf("Renamed S3 object from %s to %s\n", oldKey, newKey)
+		slog.Info("Renamed S3 object", "from", oldKey, "to", newKey)
 	}
 
-	fmt.Printf("S3 folder rename completed for connection %s: renamed %d objects from %s to %s\n", 
-		connectionID, renamedCount, oldFolder, newFolder)
+	slog.Info("S3 folder rename completed for connection",
+		"connection_id", connectionID, "renamed", renamedCount, "from", oldFolder, "to", newFolder)
 	return nil
 }
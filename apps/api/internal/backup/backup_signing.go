@@ -0,0 +1,288 @@
+package backup
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Checksum signature states reported on verification
+const (
+	SignatureStatusValid        = "valid"
+	SignatureStatusInvalid      = "invalid"
+	SignatureStatusUnsigned     = "unsigned"
+	SignatureStatusUnverifiable = "unverifiable"
+)
+
+// artifactSigner signs backup checksums with the instance key, either held in
+// a local key file or behind an external command such as a KMS client
+type artifactSigner struct {
+	entity      *openpgp.Entity
+	command     []string
+	keyring     openpgp.EntityList
+	publicKey   string
+	fingerprint string
+}
+
+// loadArtifactSigner reads the signing configuration. BACKUP_SIGNING_KEY_FILE
+// takes an ASCII-armored private key, unlocked with
+// BACKUP_SIGNING_KEY_PASSPHRASE if it is protected. Keys that should not leave
+// a KMS are used through BACKUP_SIGNING_COMMAND instead, which receives the
+// data on stdin and prints an armored detached signature; its public key is
+// read from BACKUP_SIGNING_PUBLIC_KEY_FILE. Without either, backups are not
+// signed.
+func loadArtifactSigner() (*artifactSigner, error) {
+	keyFile := strings.TrimSpace(os.Getenv("BACKUP_SIGNING_KEY_FILE"))
+	command := strings.Fields(os.Getenv("BACKUP_SIGNING_COMMAND"))
+
+	switch {
+	case keyFile != "" && len(command) > 0:
+		return nil, fmt.Errorf("set either BACKUP_SIGNING_KEY_FILE or BACKUP_SIGNING_COMMAND, not both")
+	case keyFile != "":
+		entity, err := readSigningKey(keyFile, os.Getenv("BACKUP_SIGNING_KEY_PASSPHRASE"))
+		if err != nil {
+			return nil, err
+		}
+		return newArtifactSigner(openpgp.EntityList{entity}, entity, nil)
+	case len(command) > 0:
+		publicKeyFile := strings.TrimSpace(os.Getenv("BACKUP_SIGNING_PUBLIC_KEY_FILE"))
+		if publicKeyFile == "" {
+			return nil, fmt.Errorf("BACKUP_SIGNING_COMMAND requires BACKUP_SIGNING_PUBLIC_KEY_FILE")
+		}
+		file, err := os.Open(publicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open signing public key: %v", err)
+		}
+		defer file.Close()
+		keyring, err := openpgp.ReadArmoredKeyRing(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing public key: %v", err)
+		}
+		if len(keyring) == 0 {
+			return nil, fmt.Errorf("invalid signing public key: no keys found")
+		}
+		return newArtifactSigner(keyring, nil, command)
+	default:
+		return nil, nil
+	}
+}
+
+func readSigningKey(path, passphrase string) (*openpgp.Entity, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open signing key: %v", err)
+	}
+	defer file.Close()
+
+	keyring, err := openpgp.ReadArmoredKeyRing(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %v", err)
+	}
+	if len(keyring) == 0 || keyring[0].PrivateKey == nil {
+		return nil, fmt.Errorf("invalid signing key: no private key found")
+	}
+
+	entity := keyring[0]
+	if entity.PrivateKey.Encrypted {
+		if passphrase == "" {
+			return nil, fmt.Errorf("signing key is passphrase protected, set BACKUP_SIGNING_KEY_PASSPHRASE")
+		}
+		if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("failed to unlock signing key: %v", err)
+		}
+	}
+	return entity, nil
+}
+
+// newArtifactSigner signs a probe with the configured key so a broken key or
+// command is reported at startup rather than on every backup
+func newArtifactSigner(keyring openpgp.EntityList, entity *openpgp.Entity, command []string) (*artifactSigner, error) {
+	var publicKey bytes.Buffer
+	w, err := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := keyring[0].Serialize(w); err != nil {
+		return nil, fmt.Errorf("failed to export signing public key: %v", err)
+	}
+	w.Close()
+
+	signer := &artifactSigner{
+		entity:      entity,
+		command:     command,
+		keyring:     keyring,
+		publicKey:   publicKey.String(),
+		fingerprint: gpgKeyFingerprint(keyring),
+	}
+
+	probe := "velld signing check\n"
+	signature, err := signer.sign(probe)
+	if err != nil {
+		return nil, err
+	}
+	if err := signer.verify(probe, signature); err != nil {
+		return nil, fmt.Errorf("signature does not match the signing public key: %v", err)
+	}
+	return signer, nil
+}
+
+// sign returns an ASCII-armored detached signature of data
+func (a *artifactSigner) sign(data string) (string, error) {
+	if a.entity != nil {
+		var signature bytes.Buffer
+		if err := openpgp.ArmoredDetachSign(&signature, a.entity, strings.NewReader(data), nil); err != nil {
+			return "", fmt.Errorf("failed to sign: %v", err)
+		}
+		return signature.String(), nil
+	}
+
+	cmd := exec.Command(a.command[0], a.command[1:]...)
+	cmd.Stdin = strings.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("signing command failed: %s", message)
+	}
+	return string(output), nil
+}
+
+func (a *artifactSigner) verify(data, signature string) error {
+	_, err := openpgp.CheckArmoredDetachedSignature(a.keyring, strings.NewReader(data), strings.NewReader(signature), nil)
+	return err
+}
+
+// checksumLine is the sha256sum line of an artifact, which is what gets signed
+func checksumLine(checksum, path string) string {
+	return fmt.Sprintf("%s  %s\n", checksum, filepath.Base(path))
+}
+
+// signBackupChecksum signs the artifact's checksum line with the instance key,
+// if one is configured. A failed signature leaves the backup unsigned rather
+// than failing it.
+func (s *BackupService) signBackupChecksum(backup *Backup) {
+	if s.signer == nil || backup.Checksum == nil {
+		return
+	}
+
+	signature, err := s.signer.sign(checksumLine(*backup.Checksum, backup.Path))
+	if err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to sign checksum of backup", "backup_id", backup.ID, "error", err)
+		return
+	}
+	fingerprint := s.signer.fingerprint
+	backup.ChecksumSignature = &signature
+	backup.SigningKeyFingerprint = &fingerprint
+}
+
+// VerifyBackupSignature checks a backup's checksum signature against the
+// instance signing key and returns what a consumer needs to repeat the check.
+func (s *BackupService) VerifyBackupSignature(backupID string, userID uuid.UUID) (*SignatureVerification, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.checkBackupSignature(backup), nil
+}
+
+func (s *BackupService) checkBackupSignature(backup *Backup) *SignatureVerification {
+	result := &SignatureVerification{
+		BackupID: backup.ID.String(),
+		Status:   SignatureStatusUnsigned,
+	}
+	if backup.Checksum == nil || backup.ChecksumSignature == nil {
+		return result
+	}
+
+	result.Checksum = *backup.Checksum
+	result.SignedData = checksumLine(*backup.Checksum, backup.Path)
+	result.Signature = *backup.ChecksumSignature
+	if backup.SigningKeyFingerprint != nil {
+		result.KeyFingerprint = *backup.SigningKeyFingerprint
+	}
+
+	if s.signer == nil {
+		result.Status = SignatureStatusUnverifiable
+		result.Error = "no signing key is configured on this instance"
+		return result
+	}
+	result.PublicKey = s.signer.publicKey
+
+	if err := s.signer.verify(result.SignedData, result.Signature); err != nil {
+		result.Status = SignatureStatusInvalid
+		if err == pgperrors.ErrUnknownIssuer {
+			result.Error = "signed by a key other than the current signing key"
+		} else {
+			result.Error = err.Error()
+		}
+		return result
+	}
+
+	result.Status = SignatureStatusValid
+	return result
+}
+
+// setSignatureHeaders describes a downloaded artifact's checksum and the
+// result of checking its signature
+func (s *BackupService) setSignatureHeaders(w http.ResponseWriter, backup *Backup) {
+	if backup.Checksum == nil {
+		return
+	}
+	w.Header().Set("X-Backup-Checksum", "sha256="+*backup.Checksum)
+
+	result := s.checkBackupSignature(backup)
+	w.Header().Set("X-Backup-Signature-Status", result.Status)
+	if result.KeyFingerprint != "" {
+		w.Header().Set("X-Backup-Signing-Key", result.KeyFingerprint)
+	}
+}
+
+func (h *BackupHandler) VerifyBackupSignature(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.backupService.VerifyBackupSignature(backupID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup signature checked", result)
+}
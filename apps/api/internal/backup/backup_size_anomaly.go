@@ -0,0 +1,248 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/rules"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultSizeAnomalyPercent marks backups less than half or more than
+	// one and a half times the trailing average as suspect
+	defaultSizeAnomalyPercent = 50
+	maxSizeAnomalyPercent     = 1000
+	// sizeHistoryLength is how many earlier backups the trailing average
+	// is taken over
+	sizeHistoryLength = 10
+	// sizeHistoryListLimit is how many backups the size history lists
+	sizeHistoryListLimit = 50
+)
+
+// SizeHistoryEntry is a completed backup in the size history of a connection
+type SizeHistoryEntry struct {
+	BackupID      uuid.UUID `json:"backup_id"`
+	DatabaseName  *string   `json:"database_name"`
+	Size          int64     `json:"size"`
+	Suspect       bool      `json:"suspect"`
+	SuspectReason *string   `json:"suspect_reason"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// SizeHistory lists the sizes of a connection's latest backups with the
+// threshold its schedule marks backups suspect at; 0 means detection is off
+type SizeHistory struct {
+	ConnectionID     string              `json:"connection_id"`
+	ThresholdPercent int                 `json:"threshold_percent"`
+	Suspects         int                 `json:"suspects"`
+	Backups          []*SizeHistoryEntry `json:"backups"`
+}
+
+func validateSizeAnomalyPercent(percent *int) error {
+	if percent != nil && (*percent < 0 || *percent > maxSizeAnomalyPercent) {
+		return fmt.Errorf("size_anomaly_percent must be between 0 and %d", maxSizeAnomalyPercent)
+	}
+	return nil
+}
+
+// sizeAnomalyPercent reads BACKUP_SIZE_ANOMALY_PERCENT, the threshold of
+// schedules that do not set their own. "off" turns detection off for them.
+func sizeAnomalyPercent() int {
+	value := strings.TrimSpace(os.Getenv("BACKUP_SIZE_ANOMALY_PERCENT"))
+	if value == "" {
+		return defaultSizeAnomalyPercent
+	}
+	if strings.EqualFold(value, "off") {
+		return 0
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 || parsed > maxSizeAnomalyPercent {
+		slog.Warn("Invalid BACKUP_SIZE_ANOMALY_PERCENT, using the default", "value", value, "default_percent", defaultSizeAnomalyPercent)
+		return defaultSizeAnomalyPercent
+	}
+	return parsed
+}
+
+func sizeAnomalyPercentFor(schedule *BackupSchedule) int {
+	if schedule != nil && schedule.SizeAnomalyPercent > 0 {
+		return schedule.SizeAnomalyPercent
+	}
+	return sizeAnomalyPercent()
+}
+
+// flagSuspectBackups compares each backup of a finished run with the
+// average size of the database's earlier backups, marks those off by more
+// than the threshold as suspect and notifies the suspect_backup rules. A
+// tiny dump usually means a broken backup.
+func (s *BackupService) flagSuspectBackups(run *BackupRun) {
+	if run.Status != RunStatusSuccess && run.Status != RunStatusPartial {
+		return
+	}
+	ctx := run.processes.jobContext()
+
+	schedule, err := s.backupRepo.GetBackupSchedule(run.ConnectionID)
+	if err != nil && err != sql.ErrNoRows {
+		slog.WarnContext(ctx, "Failed to get backup schedule for size check", "connection_id", run.ConnectionID, "error", err)
+		return
+	}
+	threshold := sizeAnomalyPercentFor(schedule)
+	if threshold == 0 {
+		return
+	}
+
+	backups, err := s.backupRepo.GetBackupsByRunID(run.ID.String())
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to get backups of run", "run_id", run.ID, "error", err)
+		return
+	}
+
+	var suspects []*Backup
+	for _, backup := range backups {
+		if backup.Status != "completed" || backup.Size <= 0 {
+			continue
+		}
+		sizes, err := s.backupRepo.GetRecentBackupSizes(backup.ConnectionID, backup.DatabaseName, backup.CreatedAt, sizeHistoryLength)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to get size history of connection", "connection_id", backup.ConnectionID, "error", err)
+			continue
+		}
+		if len(sizes) < minSizeSamples {
+			continue
+		}
+
+		var total int64
+		for _, size := range sizes {
+			total += size
+		}
+		average := float64(total) / float64(len(sizes))
+		deviation := (float64(backup.Size) - average) / average * 100
+		if math.Abs(deviation) <= float64(threshold) {
+			continue
+		}
+
+		direction := "larger"
+		if deviation < 0 {
+			direction = "smaller"
+		}
+		reason := fmt.Sprintf("%s is %.0f%% %s than the average of %s over the last %d backups",
+			formatBytes(backup.Size), math.Abs(deviation), direction, formatBytes(int64(average)), len(sizes))
+		if err := s.backupRepo.MarkBackupSuspect(backup.ID.String(), reason); err != nil {
+			slog.WarnContext(ctx, "Failed to mark backup suspect", "backup_id", backup.ID, "error", err)
+			continue
+		}
+		backup.Suspect = true
+		backup.SuspectReason = &reason
+		slog.WarnContext(ctx, "Backup size is anomalous", "backup_id", backup.ID, "connection_id", backup.ConnectionID,
+			"size", backup.Size, "average_size", int64(average), "deviation_percent", math.Round(deviation))
+		suspects = append(suspects, backup)
+	}
+
+	if len(suspects) > 0 {
+		s.evaluateSuspectRules(run, suspects)
+	}
+}
+
+// evaluateSuspectRules notifies the suspect_backup rules of the connection's
+// owner of each suspect backup
+func (s *BackupService) evaluateSuspectRules(run *BackupRun, suspects []*Backup) {
+	if s.ruleService == nil {
+		return
+	}
+	conn, err := s.connStorage.GetConnection(run.ConnectionID)
+	if err != nil {
+		return
+	}
+	suspectRules, err := s.ruleService.MatchingRules(conn.UserID, conn.ID, rules.ConditionSuspectBackup)
+	if err != nil {
+		slog.WarnContext(run.processes.jobContext(), "Failed to get notification rules of connection", "connection_id", conn.ID, "error", err)
+		return
+	}
+
+	for _, backup := range suspects {
+		databaseName := conn.DatabaseName
+		if backup.DatabaseName != nil {
+			databaseName = *backup.DatabaseName
+		}
+		message := fmt.Sprintf("Backup of '%s' looks broken: %s", databaseName, *backup.SuspectReason)
+		for _, rule := range suspectRules {
+			s.triggerRule(rule, conn, message, map[string]interface{}{
+				"connection_id":   conn.ID,
+				"connection_name": conn.Name,
+				"database_name":   databaseName,
+				"database_type":   conn.Type,
+				"run_id":          run.ID,
+				"backup_id":       backup.ID,
+				"size":            formatBytes(backup.Size),
+				"reason":          *backup.SuspectReason,
+			})
+		}
+	}
+}
+
+// GetSizeHistory lists the sizes of the latest backups of the user's
+// connection, newest first
+func (s *BackupService) GetSizeHistory(connectionID string, userID uuid.UUID) (*SizeHistory, error) {
+	if _, err := s.accessibleConnection(connectionID, userID); err != nil {
+		return nil, err
+	}
+
+	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	backups, err := s.backupRepo.GetSizeHistory(connectionID, sizeHistoryListLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &SizeHistory{
+		ConnectionID:     connectionID,
+		ThresholdPercent: sizeAnomalyPercentFor(schedule),
+		Backups:          make([]*SizeHistoryEntry, 0, len(backups)),
+	}
+	for _, backup := range backups {
+		if backup.Suspect {
+			history.Suspects++
+		}
+		history.Backups = append(history.Backups, &SizeHistoryEntry{
+			BackupID:      backup.ID,
+			DatabaseName:  backup.DatabaseName,
+			Size:          backup.Size,
+			Suspect:       backup.Suspect,
+			SuspectReason: backup.SuspectReason,
+			CreatedAt:     backup.CreatedAt,
+		})
+	}
+	return history, nil
+}
+
+func (h *BackupHandler) GetSizeHistory(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	history, err := h.backupService.GetSizeHistory(mux.Vars(r)["connection_id"], userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup size history retrieved successfully", history)
+}
@@ -0,0 +1,237 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPreflightMarginPercent = 10
+	// compressionRatioSamples is how many previous backups the ratio of
+	// artifact to database size is averaged over
+	compressionRatioSamples = 5
+)
+
+// preflightMargin reads BACKUP_PREFLIGHT_MARGIN_PERCENT, the headroom added to
+// the estimated backup size. "off" disables the pre-flight space check.
+func preflightMargin() (float64, bool) {
+	value := strings.TrimSpace(os.Getenv("BACKUP_PREFLIGHT_MARGIN_PERCENT"))
+	if strings.EqualFold(value, "off") {
+		return 0, false
+	}
+
+	percent := defaultPreflightMarginPercent
+	if value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			slog.Warn("Invalid BACKUP_PREFLIGHT_MARGIN_PERCENT, using the default", "value", value, "default_percent", defaultPreflightMarginPercent)
+		} else {
+			percent = parsed
+		}
+	}
+	return 1 + float64(percent)/100, true
+}
+
+// estimateBackupSize measures the databases a backup of conn will dump and
+// scales their size by the ratio of artifact to database size of previous
+// backups, then checks the directories the backup writes to for room.
+func (s *BackupService) estimateBackupSize(conn *connection.StoredConnection, schedule *BackupSchedule) (*BackupSizeEstimate, error) {
+	if s.connService == nil {
+		return nil, fmt.Errorf("database sizes cannot be measured")
+	}
+
+	databases := conn.SelectedDatabases
+	if len(databases) == 0 {
+		databases = []string{conn.DatabaseName}
+	}
+
+	estimate := &BackupSizeEstimate{
+		ConnectionID:  conn.ID,
+		DatabaseSizes: make(map[string]int64),
+		Ratio:         1,
+		Sufficient:    true,
+	}
+
+	for _, dbName := range databases {
+		target := *conn
+		target.DatabaseName = dbName
+		size, err := s.connService.MeasureDatabaseSize(&target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to measure database '%s': %v", dbName, err)
+		}
+		estimate.DatabaseSizes[dbName] = size
+		estimate.DatabaseSize += size
+	}
+
+	ratios, err := s.backupRepo.GetArtifactSizeRatios(conn.ID, compressionRatioSamples)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get previous backup sizes: %v", err)
+	}
+	if len(ratios) > 0 {
+		var sum float64
+		for _, ratio := range ratios {
+			sum += ratio
+		}
+		estimate.Ratio = sum / float64(len(ratios))
+		estimate.RatioSamples = len(ratios)
+	}
+
+	margin, enabled := preflightMargin()
+	if !enabled {
+		margin = 1
+	}
+	estimate.EstimatedSize = int64(float64(estimate.DatabaseSize) * estimate.Ratio * margin)
+
+	estimate.Streamed = s.streamingStorageFor(conn, schedule) != nil
+	if estimate.Streamed {
+		return estimate, nil
+	}
+
+	// Compression and encryption briefly keep two copies next to each other
+	copies := int64(1)
+	if schedule != nil && ((schedule.CompressionCommand != nil && *schedule.CompressionCommand != "") ||
+		(schedule.GPGPublicKey != nil && *schedule.GPGPublicKey != "")) {
+		copies = 2
+	}
+	estimate.addLocation(s.backupDir, "backup directory", estimate.EstimatedSize*copies)
+
+	// Compressed artifacts are decompressed into the temp directory to be
+	// cataloged and restore-verified
+	if schedule != nil && schedule.CompressionCommand != nil && *schedule.CompressionCommand != "" {
+		uncompressed := int64(float64(estimate.DatabaseSize) * margin)
+		estimate.addLocation(os.TempDir(), "temp directory", uncompressed)
+	}
+
+	return estimate, nil
+}
+
+func (e *BackupSizeEstimate) addLocation(path, purpose string, required int64) {
+	location := SpaceCheck{
+		Path:       path,
+		Purpose:    purpose,
+		Required:   uint64(required),
+		Sufficient: true,
+	}
+
+	free, err := freeDiskSpace(path)
+	if err != nil {
+		slog.Warn("Failed to check free space", "path", path, "error", err)
+		e.Locations = append(e.Locations, location)
+		return
+	}
+
+	location.Free = free
+	location.Sufficient = free >= location.Required
+	if !location.Sufficient {
+		e.Sufficient = false
+	}
+	e.Locations = append(e.Locations, location)
+}
+
+// preflightBackupSize fails a backup before it starts when the estimated
+// artifact does not fit, instead of letting the dump die halfway. Estimation
+// problems only skip the check; connectivity issues are reported by the dump.
+func (s *BackupService) preflightBackupSize(conn *connection.StoredConnection, schedule *BackupSchedule, run *BackupRun) error {
+	if _, enabled := preflightMargin(); !enabled {
+		return nil
+	}
+
+	estimate, err := s.estimateBackupSize(conn, schedule)
+	if err != nil {
+		slog.WarnContext(run.processes.jobContext(), "Skipping pre-flight size check for connection", "connection_id", conn.ID, "error", err)
+		return nil
+	}
+	run.databaseSizes = estimate.DatabaseSizes
+
+	if estimate.Sufficient {
+		return nil
+	}
+
+	var shortages []string
+	for _, location := range estimate.Locations {
+		if !location.Sufficient {
+			shortages = append(shortages, fmt.Sprintf("%s %s has %s free but needs %s",
+				location.Purpose, location.Path, formatBytes(int64(location.Free)), formatBytes(int64(location.Required))))
+		}
+	}
+
+	basis := "assuming the artifact is as large as the database"
+	if estimate.RatioSamples > 0 {
+		basis = fmt.Sprintf("at %.0f%% of the database size like the last %d backups", estimate.Ratio*100, estimate.RatioSamples)
+	}
+
+	return fmt.Errorf("not enough disk space for backup of '%s': estimated %s from a %s database %s; %s",
+		conn.Name, formatBytes(estimate.EstimatedSize), formatBytes(estimate.DatabaseSize), basis, strings.Join(shortages, "; "))
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// GetBackupSizeEstimate estimates the next backup of a connection without
+// running it
+func (s *BackupService) GetBackupSizeEstimate(connectionID string, userID uuid.UUID) (*BackupSizeEstimate, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get backup schedule: %v", err)
+	}
+
+	if err := s.selectRunDatabases(conn, schedule); err != nil {
+		return nil, err
+	}
+
+	return s.estimateBackupSize(conn, schedule)
+}
+
+func (h *BackupHandler) GetBackupSizeEstimate(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	connectionID := r.URL.Query().Get("connection_id")
+	if connectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+
+	estimate, err := h.backupService.GetBackupSizeEstimate(connectionID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup size estimated successfully", estimate)
+}
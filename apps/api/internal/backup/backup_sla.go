@@ -0,0 +1,610 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/rules"
+	"github.com/google/uuid"
+)
+
+// Objectives measured by the SLA report
+const (
+	ObjectiveRPO          = "rpo"
+	ObjectiveVerification = "verification"
+)
+
+// Intervals the SLA report splits its window into
+const (
+	SLAIntervalDay   = "day"
+	SLAIntervalWeek  = "week"
+	SLAIntervalMonth = "month"
+)
+
+// maxSLAPeriods bounds how many periods one report is split into
+const maxSLAPeriods = 400
+
+var slaCSVHeader = []string{
+	"connection_id", "connection_name", "type", "objective", "objective_minutes", "compliance_percent",
+	"violated_minutes", "violations", "events", "last_event_at", "compliant", "from", "to",
+}
+
+// SLAViolation is a stretch of time a connection broke an objective. End is
+// unset when the objective was still broken at the end of the window.
+type SLAViolation struct {
+	Start           time.Time  `json:"start"`
+	End             *time.Time `json:"end"`
+	DurationSeconds int64      `json:"duration_seconds"`
+}
+
+// SLAObjective is how well a connection kept one objective over the window:
+// a successful backup, or a backup that passed a restore verification, at
+// least every ObjectiveSeconds
+type SLAObjective struct {
+	Objective         string  `json:"objective"`
+	ObjectiveSeconds  int64   `json:"objective_seconds"`
+	CompliancePercent float64 `json:"compliance_percent"`
+	MeasuredSeconds   int64   `json:"measured_seconds"`
+	ViolatedSeconds   int64   `json:"violated_seconds"`
+	// Events counts the successful backups or passed verifications in the
+	// window
+	Events      int             `json:"events"`
+	LastEventAt *time.Time      `json:"last_event_at"`
+	Violations  []*SLAViolation `json:"violations"`
+
+	measuredFrom time.Time
+	measuredTo   time.Time
+}
+
+// SLAPeriod is the compliance of one interval of the window; percentages are
+// unset for objectives not measured in it
+type SLAPeriod struct {
+	Start               time.Time `json:"start"`
+	End                 time.Time `json:"end"`
+	RPOPercent          *float64  `json:"rpo_percent"`
+	VerificationPercent *float64  `json:"verification_percent"`
+}
+
+type ConnectionSLA struct {
+	ConnectionID string        `json:"connection_id"`
+	Name         string        `json:"name"`
+	Type         string        `json:"type"`
+	Paused       bool          `json:"paused"`
+	RPO          *SLAObjective `json:"rpo"`
+	Verification *SLAObjective `json:"verification"`
+	Periods      []*SLAPeriod  `json:"periods"`
+	Compliant    bool          `json:"compliant"`
+}
+
+// SLAReport measures the connections with an RPO or a verification
+// objective against them over a window
+type SLAReport struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Interval    string           `json:"interval"`
+	Compliant   bool             `json:"compliant"`
+	Violations  int              `json:"violations"`
+	Connections []*ConnectionSLA `json:"connections"`
+}
+
+func validateVerificationObjective(minutes *int) error {
+	if minutes != nil && *minutes < 0 {
+		return fmt.Errorf("verification objective cannot be negative")
+	}
+	return nil
+}
+
+// defaultVerificationObjective reads BACKUP_VERIFICATION_OBJECTIVE_MINUTES,
+// the verification objective of schedules that do not set their own. Unset
+// means no objective.
+func defaultVerificationObjective() time.Duration {
+	value := strings.TrimSpace(os.Getenv("BACKUP_VERIFICATION_OBJECTIVE_MINUTES"))
+	if value == "" {
+		return 0
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		slog.Warn("Invalid BACKUP_VERIFICATION_OBJECTIVE_MINUTES, verification is not measured against a default", "value", value)
+		return 0
+	}
+	return time.Duration(parsed) * time.Minute
+}
+
+func verificationObjectiveFor(schedule *BackupSchedule) time.Duration {
+	if schedule.VerificationObjectiveMinutes > 0 {
+		return time.Duration(schedule.VerificationObjectiveMinutes) * time.Minute
+	}
+	return defaultVerificationObjective()
+}
+
+// measureObjective finds where the gap between events grew past the
+// objective within [from, to]. Measuring starts at since, which is given one
+// objective of grace, and a paused schedule is not measured past its pause.
+func measureObjective(name string, objective time.Duration, events []time.Time, since, from, to time.Time) *SLAObjective {
+	result := &SLAObjective{
+		Objective:        name,
+		ObjectiveSeconds: int64(objective.Seconds()),
+		Violations:       []*SLAViolation{},
+		measuredFrom:     from,
+		measuredTo:       to,
+	}
+	if since.After(from) {
+		result.measuredFrom = since
+	}
+	if !result.measuredTo.After(result.measuredFrom) {
+		result.CompliancePercent = 100
+		return result
+	}
+
+	var violated time.Duration
+	addViolation := func(start, end time.Time, open bool) {
+		if start.Before(result.measuredFrom) {
+			start = result.measuredFrom
+		}
+		if end.After(result.measuredTo) {
+			end, open = result.measuredTo, true
+		}
+		if !end.After(start) {
+			return
+		}
+		violation := &SLAViolation{Start: start, DurationSeconds: int64(end.Sub(start).Seconds())}
+		if !open {
+			violation.End = &end
+		}
+		result.Violations = append(result.Violations, violation)
+		violated += end.Sub(start)
+	}
+
+	deadline := since.Add(objective)
+	for _, event := range events {
+		if event.After(result.measuredTo) {
+			break
+		}
+		if event.After(deadline) {
+			addViolation(deadline, event, false)
+		}
+		if next := event.Add(objective); next.After(deadline) {
+			deadline = next
+		}
+		if !event.Before(from) {
+			result.Events++
+		}
+		eventAt := event
+		result.LastEventAt = &eventAt
+	}
+	if result.measuredTo.After(deadline) {
+		addViolation(deadline, result.measuredTo, true)
+	}
+
+	measured := result.measuredTo.Sub(result.measuredFrom)
+	result.MeasuredSeconds = int64(measured.Seconds())
+	result.ViolatedSeconds = int64(violated.Seconds())
+	result.CompliancePercent = compliancePercent(measured, violated)
+	return result
+}
+
+func compliancePercent(measured, violated time.Duration) float64 {
+	if measured <= 0 {
+		return 100
+	}
+	return math.Round((1-float64(violated)/float64(measured))*10000) / 100
+}
+
+// percentBetween returns the compliance of the objective between start and
+// end, or nil when it wasn't measured then
+func (o *SLAObjective) percentBetween(start, end time.Time) *float64 {
+	if o == nil {
+		return nil
+	}
+	if start.Before(o.measuredFrom) {
+		start = o.measuredFrom
+	}
+	if end.After(o.measuredTo) {
+		end = o.measuredTo
+	}
+	if !end.After(start) {
+		return nil
+	}
+
+	var violated time.Duration
+	for _, violation := range o.Violations {
+		violationEnd := o.measuredTo
+		if violation.End != nil {
+			violationEnd = *violation.End
+		}
+		overlapStart, overlapEnd := violation.Start, violationEnd
+		if overlapStart.Before(start) {
+			overlapStart = start
+		}
+		if overlapEnd.After(end) {
+			overlapEnd = end
+		}
+		if overlapEnd.After(overlapStart) {
+			violated += overlapEnd.Sub(overlapStart)
+		}
+	}
+	percent := compliancePercent(end.Sub(start), violated)
+	return &percent
+}
+
+// slaPeriods splits [from, to] into intervals
+func slaPeriods(from, to time.Time, interval string) ([][2]time.Time, error) {
+	var periods [][2]time.Time
+	for start := from; start.Before(to); {
+		var end time.Time
+		switch interval {
+		case SLAIntervalDay:
+			end = start.AddDate(0, 0, 1)
+		case SLAIntervalWeek:
+			end = start.AddDate(0, 0, 7)
+		case SLAIntervalMonth:
+			end = start.AddDate(0, 1, 0)
+		default:
+			return nil, fmt.Errorf("interval must be one of %s, %s or %s", SLAIntervalDay, SLAIntervalWeek, SLAIntervalMonth)
+		}
+		if end.After(to) {
+			end = to
+		}
+		periods = append(periods, [2]time.Time{start, end})
+		if len(periods) > maxSLAPeriods {
+			return nil, fmt.Errorf("the window holds more than %d periods of a %s", maxSLAPeriods, interval)
+		}
+		start = end
+	}
+	return periods, nil
+}
+
+// measureConnectionSLA measures a connection's objectives over the window,
+// or returns nil when it has none
+func (s *BackupService) measureConnectionSLA(conn *connection.StoredConnection, schedule *BackupSchedule, from, to time.Time) (*ConnectionSLA, error) {
+	rpo := rpoFor(schedule)
+	verification := verificationObjectiveFor(schedule)
+	if rpo == 0 && verification == 0 {
+		return nil, nil
+	}
+
+	entry := &ConnectionSLA{
+		ConnectionID: conn.ID,
+		Name:         conn.Name,
+		Type:         conn.Type,
+		Paused:       schedule.Paused,
+		Periods:      []*SLAPeriod{},
+	}
+
+	// A paused schedule is not expected to back up while it is paused
+	if schedule.Paused && schedule.PausedAt != nil && schedule.PausedAt.Before(to) {
+		to = *schedule.PausedAt
+	}
+
+	if rpo > 0 {
+		runs, err := s.backupRepo.GetSuccessfulRunTimes(conn.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get runs of connection %s: %v", conn.ID, err)
+		}
+		entry.RPO = measureObjective(ObjectiveRPO, rpo, runs, schedule.CreatedAt, from, to)
+	}
+	if verification > 0 {
+		verifications, err := s.backupRepo.GetPassedVerificationTimes(conn.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get restore verifications of connection %s: %v", conn.ID, err)
+		}
+		entry.Verification = measureObjective(ObjectiveVerification, verification, verifications, schedule.CreatedAt, from, to)
+	}
+
+	entry.Compliant = (entry.RPO == nil || len(entry.RPO.Violations) == 0) &&
+		(entry.Verification == nil || len(entry.Verification.Violations) == 0)
+	return entry, nil
+}
+
+// GetSLAReport measures the user's connections against their RPO and
+// verification objectives between from and to, split into intervals. An
+// empty connectionID reports on every connection with an objective.
+func (s *BackupService) GetSLAReport(userID uuid.UUID, connectionID string, from, to time.Time, interval string) (*SLAReport, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	periods, err := slaPeriods(from, to, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	var connections []*connection.StoredConnection
+	if connectionID != "" {
+		conn, err := s.connStorage.GetConnection(connectionID)
+		if err != nil {
+			return nil, err
+		}
+		if !s.connStorage.HasAccess(conn, userID) {
+			return nil, sql.ErrNoRows
+		}
+		connections = append(connections, conn)
+	} else {
+		list, err := s.connStorage.ListByUserID(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list connections: %v", err)
+		}
+		for _, item := range list {
+			conn, err := s.connStorage.GetConnection(item.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get connection %s: %v", item.ID, err)
+			}
+			connections = append(connections, conn)
+		}
+	}
+
+	report := &SLAReport{
+		GeneratedAt: time.Now(),
+		From:        from,
+		To:          to,
+		Interval:    interval,
+		Compliant:   true,
+		Connections: []*ConnectionSLA{},
+	}
+	for _, conn := range connections {
+		schedule, err := s.backupRepo.GetBackupSchedule(conn.ID)
+		if err == sql.ErrNoRows || (err == nil && !schedule.Enabled) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get schedule of connection %s: %v", conn.ID, err)
+		}
+
+		entry, err := s.measureConnectionSLA(conn, schedule, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+
+		for _, period := range periods {
+			entry.Periods = append(entry.Periods, &SLAPeriod{
+				Start:               period[0],
+				End:                 period[1],
+				RPOPercent:          entry.RPO.percentBetween(period[0], period[1]),
+				VerificationPercent: entry.Verification.percentBetween(period[0], period[1]),
+			})
+		}
+		for _, objective := range []*SLAObjective{entry.RPO, entry.Verification} {
+			if objective != nil {
+				report.Violations += len(objective.Violations)
+			}
+		}
+		if !entry.Compliant {
+			report.Compliant = false
+		}
+		report.Connections = append(report.Connections, entry)
+	}
+	return report, nil
+}
+
+// writeSLAReportCSV writes a row per connection and objective
+func writeSLAReportCSV(w io.Writer, report *SLAReport) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(slaCSVHeader); err != nil {
+		return err
+	}
+
+	for _, entry := range report.Connections {
+		for _, objective := range []*SLAObjective{entry.RPO, entry.Verification} {
+			if objective == nil {
+				continue
+			}
+			lastEventAt := ""
+			if objective.LastEventAt != nil {
+				lastEventAt = objective.LastEventAt.UTC().Format(time.RFC3339)
+			}
+			err := writer.Write(csvCells(
+				entry.ConnectionID,
+				entry.Name,
+				entry.Type,
+				objective.Objective,
+				strconv.FormatInt(objective.ObjectiveSeconds/60, 10),
+				strconv.FormatFloat(objective.CompliancePercent, 'f', 2, 64),
+				strconv.FormatInt(objective.ViolatedSeconds/60, 10),
+				strconv.Itoa(len(objective.Violations)),
+				strconv.Itoa(objective.Events),
+				lastEventAt,
+				strconv.FormatBool(len(objective.Violations) == 0),
+				report.From.UTC().Format(time.RFC3339),
+				report.To.UTC().Format(time.RFC3339),
+			))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvCells escapes cells a spreadsheet would evaluate as formulas, since
+// connection names are chosen by users
+func csvCells(cells ...string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
+
+// openSLAViolations returns the objectives the connection breaks now and
+// when the latest of those violations began
+func (s *BackupService) openSLAViolations(conn *connection.StoredConnection, schedule *BackupSchedule) ([]*SLAObjective, time.Time, error) {
+	now := time.Now()
+	entry, err := s.measureConnectionSLA(conn, schedule, schedule.CreatedAt, now)
+	if err != nil || entry == nil {
+		return nil, time.Time{}, err
+	}
+
+	var open []*SLAObjective
+	var since time.Time
+	for _, objective := range []*SLAObjective{entry.RPO, entry.Verification} {
+		if objective == nil || len(objective.Violations) == 0 {
+			continue
+		}
+		last := objective.Violations[len(objective.Violations)-1]
+		if last.End != nil {
+			continue
+		}
+		open = append(open, objective)
+		if last.Start.After(since) {
+			since = last.Start
+		}
+	}
+	return open, since, nil
+}
+
+// checkSLARules notifies the sla_violation rules of each connection that
+// breaks its RPO or verification objective. A rule notifies once per
+// violation, and again when another objective is broken as well; paused
+// schedules are left out.
+func (s *BackupService) checkSLARules() {
+	if s.ruleService == nil {
+		return
+	}
+	slaRules, err := s.ruleService.EnabledRules(rules.ConditionSLAViolation)
+	if err != nil {
+		slog.Error("Failed to check notification rules", "error", err)
+		return
+	}
+
+	for _, rule := range slaRules {
+		var connectionIDs []string
+		if rule.ConnectionID != nil {
+			connectionIDs = []string{*rule.ConnectionID}
+		} else {
+			conns, err := s.connStorage.ListByUserID(rule.UserID)
+			if err != nil {
+				slog.Warn("Failed to list connections of user", "user_id", rule.UserID, "error", err)
+				continue
+			}
+			for _, conn := range conns {
+				connectionIDs = append(connectionIDs, conn.ID)
+			}
+		}
+
+		for _, connectionID := range connectionIDs {
+			s.checkSLARule(rule, connectionID)
+		}
+	}
+}
+
+func (s *BackupService) checkSLARule(rule *rules.Rule, connectionID string) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil || !s.connStorage.HasAccess(conn, rule.UserID) {
+		return
+	}
+	schedule, err := s.backupRepo.GetBackupSchedule(conn.ID)
+	if err != nil || !schedule.Enabled || schedule.Paused {
+		return
+	}
+
+	open, since, err := s.openSLAViolations(conn, schedule)
+	if err != nil {
+		slog.Warn("Failed to check SLA of connection", "connection_id", conn.ID, "error", err)
+		return
+	}
+	if len(open) == 0 {
+		return
+	}
+	last, err := s.ruleService.LatestEvent(rule.ID, conn.ID)
+	if err != nil {
+		slog.Warn("Failed to get events of notification rule", "rule_id", rule.ID, "error", err)
+		return
+	}
+	if last != nil && last.TriggeredAt.After(since) {
+		return
+	}
+
+	metadata := map[string]interface{}{
+		"connection_id":   conn.ID,
+		"connection_name": conn.Name,
+		"database_name":   conn.DatabaseName,
+		"database_type":   conn.Type,
+	}
+	var broken []string
+	for _, objective := range open {
+		objectiveDuration := time.Duration(objective.ObjectiveSeconds) * time.Second
+		switch objective.Objective {
+		case ObjectiveRPO:
+			broken = append(broken, fmt.Sprintf("no successful backup in its RPO of %s", objectiveDuration))
+			metadata["rpo"] = objectiveDuration.String()
+		case ObjectiveVerification:
+			broken = append(broken, fmt.Sprintf("no backup passed a restore verification in %s", objectiveDuration))
+			metadata["verification_objective"] = objectiveDuration.String()
+		}
+		if objective.LastEventAt != nil {
+			metadata["last_"+objective.Objective+"_at"] = objective.LastEventAt.Format(time.RFC3339)
+		}
+	}
+	message := fmt.Sprintf("'%s' breaks its SLA: %s", conn.Name, strings.Join(broken, "; "))
+	s.triggerRule(rule, conn, message, metadata)
+}
+
+// GetSLAReport reports over ?from= and ?to=, the last 30 days by default,
+// split by ?interval=. ?format=csv exports it as CSV.
+func (h *BackupHandler) GetSLAReport(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if fromStr := query.Get("from"); fromStr != "" {
+		if from, err = parseReportDate(fromStr); err != nil {
+			response.SendError(w, http.StatusBadRequest, "invalid from date")
+			return
+		}
+	}
+	if toStr := query.Get("to"); toStr != "" {
+		if to, err = parseReportDate(toStr); err != nil {
+			response.SendError(w, http.StatusBadRequest, "invalid to date")
+			return
+		}
+	}
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = SLAIntervalWeek
+	}
+
+	report, err := h.backupService.GetSLAReport(userID, query.Get("connection_id"), from, to, interval)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+			return
+		}
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if query.Get("format") == "csv" {
+		filename := fmt.Sprintf("velld-sla-%s.csv", time.Now().UTC().Format("20060102-150405"))
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		if err := writeSLAReportCSV(w, report); err != nil {
+			slog.Error("Failed to export SLA report", "error", err)
+		}
+		return
+	}
+
+	response.SendSuccess(w, "SLA report generated successfully", report)
+}
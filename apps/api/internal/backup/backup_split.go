@@ -0,0 +1,171 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// splitPartFiles returns the parts the split post-processor wrote, in order.
+// Parts recorded before they were numbered keep the order they were saved in.
+func splitPartFiles(backup *Backup) []PostProcessedFile {
+	var parts []PostProcessedFile
+	for _, file := range backup.PostProcessedFiles {
+		if file.Processor == PostProcessorSplit {
+			parts = append(parts, file)
+		}
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].Number < parts[j].Number
+	})
+	return parts
+}
+
+// artifactReplacedBySplit reports whether a backup is stored only as its split
+// parts. Such backups have no local artifact, and their S3 object is the
+// manifest with the part index.
+func artifactReplacedBySplit(backup *Backup) bool {
+	if len(splitPartFiles(backup)) == 0 {
+		return false
+	}
+	if backup.S3ObjectKey != nil {
+		return strings.HasSuffix(*backup.S3ObjectKey, manifestSuffix)
+	}
+	_, err := os.Stat(backup.Path)
+	return err != nil
+}
+
+// replaceArtifactWithPartsIfConfigured removes the local artifact once the
+// split post-processor wrote its parts, when the schedule asks for parts only.
+// If splitting failed, the artifact is kept.
+func (s *BackupService) replaceArtifactWithPartsIfConfigured(backup *Backup, schedule *BackupSchedule) {
+	if schedule == nil {
+		return
+	}
+
+	replace := false
+	for _, config := range schedule.PostProcessors {
+		if config.Type == PostProcessorSplit && config.ReplaceArtifact {
+			replace = true
+		}
+	}
+	parts := splitPartFiles(backup)
+	if !replace || len(parts) == 0 {
+		return
+	}
+
+	if err := os.Remove(backup.Path); err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to replace backup by its parts", "backup_id", backup.ID, "error", err)
+		return
+	}
+	slog.InfoContext(backupContext(backup), "Replaced backup by split parts", "backup_id", backup.ID, "parts", len(parts))
+}
+
+// reassembleSplitBackup concatenates the parts of an artifact replaced by its
+// split parts into a temp file, from local parts or from S3, and checks the
+// result against the backup's checksum. It returns an empty path for backups
+// that still have a whole artifact.
+func (s *BackupService) reassembleSplitBackup(backup *Backup, userID uuid.UUID) (string, error) {
+	if !artifactReplacedBySplit(backup) {
+		return "", nil
+	}
+
+	tempDir := filepath.Join(os.TempDir(), "velld-split")
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	// The base name keeps the extension, which restores and verification use
+	out, err := os.CreateTemp(tempDir, "*_"+filepath.Base(backup.Path))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	path := out.Name()
+
+	var storage *S3Storage
+	for _, part := range splitPartFiles(backup) {
+		if err = s.appendSplitPart(out, part, userID, &storage); err != nil {
+			break
+		}
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to reassemble backup from its parts: %v", err)
+	}
+
+	if backup.Checksum != nil {
+		actual, err := computeFileChecksum(path)
+		if err != nil {
+			os.Remove(path)
+			return "", fmt.Errorf("failed to checksum reassembled backup: %v", err)
+		}
+		if !strings.EqualFold(actual, *backup.Checksum) {
+			os.Remove(path)
+			return "", fmt.Errorf("reassembled backup does not match its checksum")
+		}
+	}
+
+	return path, nil
+}
+
+// appendSplitPart copies one part into out, downloading it when it is not
+// local, and checks it against its recorded checksum so a damaged part is
+// named instead of failing the checksum of the whole artifact. The S3 client
+// is created on the first download.
+func (s *BackupService) appendSplitPart(out io.Writer, part PostProcessedFile, userID uuid.UUID, storage **S3Storage) error {
+	path := part.Path
+	if _, err := os.Stat(path); err != nil {
+		if part.ObjectKey == nil {
+			return fmt.Errorf("part %s is missing", filepath.Base(part.Path))
+		}
+		if *storage == nil {
+			created, err := s.s3StorageForUser(userID)
+			if err != nil {
+				return err
+			}
+			if created == nil {
+				return fmt.Errorf("part %s is not local and S3 is not enabled", filepath.Base(part.Path))
+			}
+			*storage = created
+		}
+
+		download, err := os.CreateTemp(filepath.Join(os.TempDir(), "velld-split"), "*_"+filepath.Base(part.Path))
+		if err != nil {
+			return err
+		}
+		path = download.Name()
+		download.Close()
+		defer os.Remove(path)
+
+		if err := (*storage).DownloadFile(context.Background(), *part.ObjectKey, path); err != nil {
+			return fmt.Errorf("failed to download part %s: %v", filepath.Base(part.Path), err)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), file); err != nil {
+		return err
+	}
+	if part.Checksum != nil && !strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), *part.Checksum) {
+		return fmt.Errorf("part %s does not match its checksum", filepath.Base(part.Path))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+func validateStorageQuota(maxBytes *int64) error {
+	if maxBytes != nil && *maxBytes < 0 {
+		return fmt.Errorf("retention_max_bytes cannot be negative")
+	}
+	return nil
+}
+
+// backupsOverQuota picks the backups to delete so the rest fit in quota
+// bytes. backups are newest first; once a backup does not fit, it and every
+// older one go. The newest full backup and the bases of kept incremental
+// backups are always kept, even past the quota, so a restorable backup
+// remains and no incremental chain is broken.
+func backupsOverQuota(backups []*Backup, quota int64) []*Backup {
+	var used int64
+	over := false
+	keptFull := false
+	bases := make(map[string]bool)
+
+	var remove []*Backup
+	for _, backup := range backups {
+		full := backup.IncrementalBaseID == nil
+		if !over && used+backup.Size > quota {
+			over = true
+		}
+		if over && !bases[backup.ID.String()] && (!full || keptFull) {
+			remove = append(remove, backup)
+			continue
+		}
+
+		used += backup.Size
+		if full {
+			keptFull = true
+		} else {
+			bases[*backup.IncrementalBaseID] = true
+		}
+	}
+	return remove
+}
+
+// enforceStorageQuota deletes the oldest backups of a connection beyond its
+// schedule's size budget
+func (s *BackupService) enforceStorageQuota(connectionID string, quota int64) {
+	backups, err := s.backupRepo.GetCompletedBackupsNewestFirst(connectionID)
+	if err != nil {
+		slog.Error("Failed to fetch backups for storage quota", "connection_id", connectionID, "error", err)
+		return
+	}
+
+	remove := backupsOverQuota(backups, quota)
+	if len(remove) == 0 {
+		return
+	}
+
+	slog.Info("Backups of connection exceed their storage quota, deleting the oldest",
+		"connection_id", connectionID, "quota_bytes", quota, "removed", len(remove))
+	s.removeBackups(connectionID, remove, DeletionReasonStorageQuota)
+}
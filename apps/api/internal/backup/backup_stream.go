@@ -0,0 +1,398 @@
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultStreamPartSizeMB = 16
+	// S3 rejects multipart parts smaller than 5 MiB
+	minStreamPartSizeMB   = 5
+	defaultStreamBufferKB = 1024
+)
+
+// streamableTypes lists the database types whose dump tools can write a
+// single self-contained dump to stdout.
+var streamableTypes = map[string]bool{
+	"postgresql": true,
+	"mysql":      true,
+	"mariadb":    true,
+}
+
+// validateStreamToStorage checks that a connection supports streaming uploads
+// before the option is enabled on its schedule.
+func (s *BackupService) validateStreamToStorage(connectionID string, enabled *bool) error {
+	if enabled == nil || !*enabled {
+		return nil
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	if !streamableTypes[conn.Type] {
+		return fmt.Errorf("streaming uploads are not supported for %s", conn.Type)
+	}
+
+	return nil
+}
+
+// streamPartSize reads BACKUP_STREAM_PART_SIZE_MB, the multipart upload part
+// size. Memory use per streamed backup is roughly one part.
+func streamPartSize() uint64 {
+	sizeMB := defaultStreamPartSizeMB
+	if value := strings.TrimSpace(os.Getenv("BACKUP_STREAM_PART_SIZE_MB")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < minStreamPartSizeMB {
+			slog.Warn("Invalid BACKUP_STREAM_PART_SIZE_MB, using the default", "value", value, "default_mb", defaultStreamPartSizeMB)
+		} else {
+			sizeMB = parsed
+		}
+	}
+	return uint64(sizeMB) * 1024 * 1024
+}
+
+// streamBufferSize reads BACKUP_STREAM_BUFFER_KB, the write buffer between the
+// dump pipeline and the upload.
+func streamBufferSize() int {
+	sizeKB := defaultStreamBufferKB
+	if value := strings.TrimSpace(os.Getenv("BACKUP_STREAM_BUFFER_KB")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			slog.Warn("Invalid BACKUP_STREAM_BUFFER_KB, using the default", "value", value, "default_kb", defaultStreamBufferKB)
+		} else {
+			sizeKB = parsed
+		}
+	}
+	return sizeKB * 1024
+}
+
+// s3StorageForUser returns the user's S3 storage, or nil when S3 is disabled
+func (s *BackupService) s3StorageForUser(userID uuid.UUID) (*S3Storage, error) {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user settings: %w", err)
+	}
+
+	if !userSettings.S3Enabled {
+		return nil, nil
+	}
+
+	if userSettings.S3Endpoint == nil || *userSettings.S3Endpoint == "" {
+		return nil, fmt.Errorf("S3 endpoint not configured")
+	}
+	if userSettings.S3Bucket == nil || *userSettings.S3Bucket == "" {
+		return nil, fmt.Errorf("S3 bucket not configured")
+	}
+	if userSettings.S3AccessKey == nil || *userSettings.S3AccessKey == "" {
+		return nil, fmt.Errorf("S3 access key not configured")
+	}
+	if userSettings.S3SecretKey == nil || *userSettings.S3SecretKey == "" {
+		return nil, fmt.Errorf("S3 secret key not configured")
+	}
+
+	secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt S3 secret key: %w", err)
+	}
+
+	region := "us-east-1"
+	if userSettings.S3Region != nil && *userSettings.S3Region != "" {
+		region = *userSettings.S3Region
+	}
+
+	pathPrefix := ""
+	if userSettings.S3PathPrefix != nil {
+		pathPrefix = *userSettings.S3PathPrefix
+	}
+
+	return NewS3Storage(S3Config{
+		Endpoint:   *userSettings.S3Endpoint,
+		Region:     region,
+		Bucket:     *userSettings.S3Bucket,
+		AccessKey:  *userSettings.S3AccessKey,
+		SecretKey:  secretKey,
+		UseSSL:     userSettings.S3UseSSL,
+		PathPrefix: pathPrefix,
+	})
+}
+
+// streamingStorageFor returns the storage to stream the connection's dumps
+// to, or nil to fall back to a local dump file.
+func (s *BackupService) streamingStorageFor(conn *connection.StoredConnection, schedule *BackupSchedule) *S3Storage {
+	if schedule == nil || !schedule.StreamToStorage {
+		return nil
+	}
+
+	if !streamableTypes[conn.Type] {
+		slog.Warn("Streaming uploads are not supported for this database type, writing dump to disk", "type", conn.Type)
+		return nil
+	}
+
+	if pgDumpJobs(conn, schedule) > 0 {
+		slog.Warn("Parallel directory dumps cannot be streamed, writing dump to disk", "connection_id", conn.ID)
+		return nil
+	}
+
+	if sampleOptionsFor(schedule) != nil {
+		slog.Warn("Sampled dumps cannot be streamed, writing dump to disk", "connection_id", conn.ID)
+		return nil
+	}
+
+	if physicalBackupFor(schedule) {
+		slog.Warn("Physical backups cannot be streamed, writing backup to disk", "connection_id", conn.ID)
+		return nil
+	}
+
+	storage, err := s.s3StorageForUser(conn.UserID)
+	if err != nil {
+		slog.Warn("Cannot stream backup to S3, writing dump to disk", "connection_id", conn.ID, "error", err)
+		return nil
+	}
+	if storage == nil {
+		slog.Warn("Streaming is enabled for connection but S3 is not, writing dump to disk", "connection_id", conn.ID)
+	}
+
+	return storage
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// streamBackupToStorage pipes the dump through the schedule's compression and
+// encryption straight into a multipart upload, hashing it on the way. No copy
+// of the dump is written to local disk; backup.Path only names the artifact.
+func (s *BackupService) streamBackupToStorage(conn *connection.StoredConnection, storage *S3Storage, backup *Backup, schedule *BackupSchedule, processes *processTracker) error {
+	var dumpCmd *exec.Cmd
+	switch conn.Type {
+	case "postgresql":
+		dumpCmd = s.createPgDumpCmd(conn, "", pgDumpFormatFor(schedule))
+	case "mysql", "mariadb":
+		dumpCmd = s.createMySQLDumpCmd(conn, "")
+	default:
+		return fmt.Errorf("streaming uploads are not supported for %s", conn.Type)
+	}
+	if dumpCmd == nil {
+		return fmt.Errorf("backup tool not found for %s. Please ensure %s is installed and available in PATH", conn.Type, requiredTools[conn.Type])
+	}
+	applyDumpFilters(dumpCmd, conn, dumpFiltersFor(schedule))
+	applyExtraDumpArgs(dumpCmd, schedule)
+	backup.RunEnvironment = captureRunEnvironment(dumpCmd, schedule, true)
+
+	masker, err := newDumpMasker(conn, schedule)
+	if err != nil {
+		return err
+	}
+
+	codec, compressArgs, compressed, err := scheduleCompression(schedule)
+	if err != nil {
+		return err
+	}
+	if compressed {
+		command := strings.Join(compressArgs, " ")
+		backup.Path += codec.extension
+		backup.CompressionCommand = &command
+	}
+
+	var entities openpgp.EntityList
+	if schedule.GPGPublicKey != nil && *schedule.GPGPublicKey != "" {
+		parsed, err := parseGPGPublicKey(*schedule.GPGPublicKey)
+		if err != nil {
+			return err
+		}
+		entities = parsed
+		fingerprint := gpgKeyFingerprint(entities)
+		backup.Path += ".gpg"
+		backup.EncryptionKeyFingerprint = &fingerprint
+	}
+
+	transfer := s.beginTransfer(backup, TransferKindStream, schedule)
+	defer s.endTransfer(transfer)
+
+	// Throttling the upload side slows the dump down through the pipes
+	uploadReader, uploadWriter := io.Pipe()
+	hash := sha256.New()
+	counter := &countingWriter{}
+	buffered := bufio.NewWriterSize(io.MultiWriter(transfer.writer(uploadWriter), hash, counter), streamBufferSize())
+
+	type uploadResult struct {
+		objectKey string
+		err       error
+	}
+	uploaded := make(chan uploadResult, 1)
+	go func() {
+		objectKey, err := storage.UploadStream(context.Background(), uploadReader, filepath.Base(backup.Path),
+			common.SanitizeConnectionName(conn.Name), streamPartSize())
+		// Unblock the pipeline if the upload gave up early
+		uploadReader.CloseWithError(err)
+		uploaded <- uploadResult{objectKey, err}
+	}()
+
+	err = runStreamPipeline(dumpCmd, compressArgs, entities, masker, buffered, processes)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		uploadWriter.CloseWithError(err)
+		<-uploaded
+		if processes.timedOut() {
+			// Drop the parts the stream already uploaded
+			objectKey := storage.getObjectKeyWithPath(filepath.Base(backup.Path), common.SanitizeConnectionName(conn.Name))
+			if err := storage.RemoveIncompleteUpload(context.Background(), objectKey); err != nil {
+				slog.WarnContext(processes.jobContext(), "Failed to remove partial upload", "object_key", objectKey, "error", err)
+			}
+			return fmt.Errorf("backup timed out")
+		}
+		return err
+	}
+	uploadWriter.Close()
+
+	result := <-uploaded
+	if result.err != nil {
+		return result.err
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	backup.S3ObjectKey = &result.objectKey
+	backup.Size = counter.n
+	backup.Checksum = &checksum
+	s.signBackupChecksum(backup)
+
+	slog.InfoContext(processes.jobContext(), "Streamed backup to S3", "backup_id", backup.ID, "object_key", result.objectKey)
+	return nil
+}
+
+// runStreamPipeline runs dump | mask | compress | encrypt into out
+func runStreamPipeline(dumpCmd *exec.Cmd, compressArgs []string, entities openpgp.EntityList, masker *dumpMasker, out io.Writer, processes *processTracker) error {
+	var encrypter io.WriteCloser
+	if entities != nil {
+		hints := &openpgp.FileHints{IsBinary: true}
+		config := &packet.Config{DefaultCompressionAlgo: packet.CompressionZLIB}
+		w, err := openpgp.Encrypt(out, entities, nil, hints, config)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt backup: %v", err)
+		}
+		encrypter = w
+		out = w
+	}
+
+	var dumpStderr, compressStderr strings.Builder
+	dumpCmd.Stderr = processes.logOutput(&dumpStderr)
+
+	// The dump's output goes through the masking stage, which exec copies
+	// into in a goroutine that Wait waits for
+	var maskWriter *maskingWriter
+	dumpOutput := func(w io.Writer) io.Writer {
+		if masker == nil {
+			return w
+		}
+		maskWriter = masker.writer(w)
+		return maskWriter
+	}
+
+	var compressCmd *exec.Cmd
+	var maskedPipe *os.File
+	if compressArgs == nil {
+		dumpCmd.Stdout = dumpOutput(out)
+		if err := processes.start(dumpCmd); err != nil {
+			return err
+		}
+	} else {
+		pipeReader, pipeWriter, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+
+		compressCmd = exec.Command(compressArgs[0], compressArgs[1:]...)
+		compressCmd.Stdin = pipeReader
+		compressCmd.Stdout = out
+		compressCmd.Stderr = processes.logOutput(&compressStderr)
+		dumpCmd.Stdout = dumpOutput(pipeWriter)
+
+		if err := processes.start(compressCmd); err != nil {
+			pipeReader.Close()
+			pipeWriter.Close()
+			return fmt.Errorf("failed to start compression command: %v", err)
+		}
+		if err := processes.start(dumpCmd); err != nil {
+			pipeReader.Close()
+			pipeWriter.Close()
+			processes.wait(compressCmd)
+			return err
+		}
+
+		// The children hold their own copies; closing ours lets EOF and
+		// broken pipes propagate when either side exits. The masking stage
+		// writes to the pipe itself, so it is closed once masking is done.
+		pipeReader.Close()
+		if maskWriter == nil {
+			pipeWriter.Close()
+		} else {
+			maskedPipe = pipeWriter
+		}
+	}
+
+	dumpErr := processes.wait(dumpCmd)
+	var maskErr error
+	if maskWriter != nil {
+		maskErr = maskWriter.Close()
+		if maskedPipe != nil {
+			maskedPipe.Close()
+		}
+	}
+	var compressErr error
+	if compressCmd != nil {
+		compressErr = processes.wait(compressCmd)
+	}
+
+	if dumpErr != nil {
+		if msg := strings.TrimSpace(dumpStderr.String()); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return dumpErr
+	}
+	if compressErr != nil {
+		if msg := strings.TrimSpace(compressStderr.String()); msg != "" {
+			return fmt.Errorf("failed to compress backup: %v: %s", compressErr, msg)
+		}
+		return fmt.Errorf("failed to compress backup: %v", compressErr)
+	}
+	if maskErr != nil {
+		return fmt.Errorf("failed to mask dump: %v", maskErr)
+	}
+	if maskWriter != nil {
+		slog.InfoContext(processes.jobContext(), "Masked values in streamed dump", "masked", maskWriter.masked)
+	}
+
+	if encrypter != nil {
+		if err := encrypter.Close(); err != nil {
+			return fmt.Errorf("failed to encrypt backup: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,340 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+)
+
+// Transfer kinds
+const (
+	TransferKindStream = "stream"
+	TransferKindUpload = "upload"
+	TransferKindExport = "export"
+)
+
+const (
+	// throttleChunkSize bounds how much data passes between two limiter waits
+	throttleChunkSize = 32 * 1024
+	throughputWindow  = 2 * time.Second
+)
+
+// globalBandwidth is shared by all transfers, so BACKUP_BANDWIDTH_LIMIT_KBPS
+// caps their combined rate.
+var globalBandwidth = &bandwidthLimiter{}
+
+// globalBandwidthLimit reads BACKUP_BANDWIDTH_LIMIT_KBPS, the combined rate of
+// all dump streams and uploads in kilobytes per second. 0 is unlimited.
+func globalBandwidthLimit() int {
+	value := strings.TrimSpace(os.Getenv("BACKUP_BANDWIDTH_LIMIT_KBPS"))
+	if value == "" {
+		return 0
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		slog.Warn("Invalid BACKUP_BANDWIDTH_LIMIT_KBPS, transfers are not limited", "value", value)
+		return 0
+	}
+	return parsed
+}
+
+func validateBandwidthLimit(limit *int) error {
+	if limit != nil && *limit < 0 {
+		return fmt.Errorf("bandwidth limit cannot be negative")
+	}
+	return nil
+}
+
+func bandwidthLimitFor(schedule *BackupSchedule) int {
+	if schedule == nil {
+		return 0
+	}
+	return schedule.BandwidthLimitKBps
+}
+
+// bandwidthLimiter spaces out transfers so they average at most limit
+// kilobytes per second. Callers reserve time slots in turn, which shares the
+// rate between concurrent transfers.
+type bandwidthLimiter struct {
+	mu    sync.Mutex
+	limit int
+	next  time.Time
+}
+
+func newBandwidthLimiter(limitKBps int) *bandwidthLimiter {
+	return &bandwidthLimiter{limit: limitKBps}
+}
+
+func (l *bandwidthLimiter) setLimit(limitKBps int) {
+	l.mu.Lock()
+	l.limit = limitKBps
+	l.mu.Unlock()
+}
+
+// wait blocks until n more bytes may pass
+func (l *bandwidthLimiter) wait(n int) {
+	l.mu.Lock()
+	if l.limit <= 0 {
+		l.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.limit*1024) * float64(time.Second)))
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+}
+
+// transfer is a dump stream or upload that is moving data. It applies the
+// schedule and global limits and measures the current throughput.
+type transfer struct {
+	key           string
+	backupID      string
+	connectionID  string
+	kind          string
+	scheduleLimit int
+	globalLimit   int
+	startedAt     time.Time
+	limiters      []*bandwidthLimiter
+	// meter is the progress of the run the transfer belongs to
+	meter *progressMeter
+
+	mu          sync.Mutex
+	bytes       int64
+	windowStart time.Time
+	windowBytes int64
+	rate        float64
+}
+
+// beginTransfer registers a transfer for the backup with the limits that
+// apply to it. It must be ended with endTransfer.
+func (s *BackupService) beginTransfer(backup *Backup, kind string, schedule *BackupSchedule) *transfer {
+	t := s.registerTransfer(backup.ID.String(), backup.ID.String(), backup.ConnectionID, kind, bandwidthLimitFor(schedule))
+	t.meter = s.progressMeterFor(backup)
+	if kind == TransferKindUpload {
+		t.meter.setTotal(backup.Size, false)
+	}
+	return t
+}
+
+// registerTransfer registers a transfer under key, limited to limitKBps on
+// top of the global limit
+func (s *BackupService) registerTransfer(key, backupID, connectionID, kind string, limitKBps int) *transfer {
+	now := time.Now()
+	t := &transfer{
+		key:           key,
+		backupID:      backupID,
+		connectionID:  connectionID,
+		kind:          kind,
+		scheduleLimit: limitKBps,
+		globalLimit:   globalBandwidthLimit(),
+		startedAt:     now,
+		windowStart:   now,
+	}
+
+	if t.scheduleLimit > 0 {
+		t.limiters = append(t.limiters, newBandwidthLimiter(t.scheduleLimit))
+	}
+	globalBandwidth.setLimit(t.globalLimit)
+	t.limiters = append(t.limiters, globalBandwidth)
+
+	s.transfers.Store(t.key, t)
+	return t
+}
+
+func (s *BackupService) endTransfer(t *transfer) {
+	s.transfers.Delete(t.key)
+}
+
+// setBackup names the backup an export is copying at the moment
+func (t *transfer) setBackup(backupID string) {
+	t.mu.Lock()
+	t.backupID = backupID
+	t.mu.Unlock()
+}
+
+// pass waits for the limiters and counts n bytes
+func (t *transfer) pass(n int) {
+	for _, limiter := range t.limiters {
+		limiter.wait(n)
+	}
+	t.meter.add(n)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.bytes += int64(n)
+	t.windowBytes += int64(n)
+	if elapsed := time.Since(t.windowStart); elapsed >= throughputWindow {
+		t.rate = float64(t.windowBytes) / elapsed.Seconds()
+		t.windowStart = time.Now()
+		t.windowBytes = 0
+	}
+}
+
+func (t *transfer) progress() TransferProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rate := t.rate
+	// A stalled transfer does not close its window, so measure it as it is
+	if elapsed := time.Since(t.windowStart); elapsed >= throughputWindow {
+		rate = float64(t.windowBytes) / elapsed.Seconds()
+	}
+
+	return TransferProgress{
+		BackupID:                 t.backupID,
+		ConnectionID:             t.connectionID,
+		Kind:                     t.kind,
+		TransferredBytes:         t.bytes,
+		ThroughputBytesPerSecond: rate,
+		ScheduleLimitKBps:        t.scheduleLimit,
+		GlobalLimitKBps:          t.globalLimit,
+		StartedAt:                t.startedAt,
+	}
+}
+
+func (t *transfer) writer(w io.Writer) io.Writer {
+	return &throttledWriter{w: w, t: t}
+}
+
+func (t *transfer) reader(r io.Reader) io.Reader {
+	return &throttledReader{r: r, t: t}
+}
+
+type throttledWriter struct {
+	w io.Writer
+	t *transfer
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written:]
+		if len(chunk) > throttleChunkSize {
+			chunk = chunk[:throttleChunkSize]
+		}
+		w.t.pass(len(chunk))
+
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+type throttledReader struct {
+	r io.Reader
+	t *transfer
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkSize {
+		p = p[:throttleChunkSize]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.t.pass(n)
+	}
+	return n, err
+}
+
+// uploadFile uploads a local file in a single request within the transfer's
+// limits
+func uploadFile(ctx context.Context, storage *S3Storage, t *transfer, path, subfolder string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	return storage.UploadReaderWithPath(ctx, t.reader(file), fileInfo.Size(), filepath.Base(path), subfolder)
+}
+
+// transferThroughput returns the current throughput of a running transfer of
+// the backup, or 0 when none is running.
+func (s *BackupService) transferThroughput(backupID string) float64 {
+	value, ok := s.transfers.Load(backupID)
+	if !ok {
+		return 0
+	}
+	return value.(*transfer).progress().ThroughputBytesPerSecond
+}
+
+// GetActiveTransfers lists the running dump streams and uploads of the
+// user's connections
+func (s *BackupService) GetActiveTransfers(userID uuid.UUID) ([]TransferProgress, error) {
+	owned := make(map[string]bool)
+	transfers := []TransferProgress{}
+
+	var lookupErr error
+	s.transfers.Range(func(_, value interface{}) bool {
+		progress := value.(*transfer).progress()
+
+		isOwner, checked := owned[progress.ConnectionID]
+		if !checked {
+			conn, err := s.connStorage.GetConnection(progress.ConnectionID)
+			if err != nil {
+				lookupErr = fmt.Errorf("failed to get connection: %v", err)
+				return false
+			}
+			isOwner = s.connStorage.HasAccess(conn, userID)
+			owned[progress.ConnectionID] = isOwner
+		}
+
+		if isOwner {
+			transfers = append(transfers, progress)
+		}
+		return true
+	})
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+
+	sort.Slice(transfers, func(i, j int) bool {
+		return transfers[i].StartedAt.Before(transfers[j].StartedAt)
+	})
+
+	return transfers, nil
+}
+
+func (h *BackupHandler) GetActiveTransfers(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	transfers, err := h.backupService.GetActiveTransfers(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Active transfers retrieved successfully", transfers)
+}
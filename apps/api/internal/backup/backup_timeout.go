@@ -0,0 +1,171 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RunStatusTimedOut marks runs stopped by their schedule's timeout, as
+// opposed to runs whose dump failed
+const RunStatusTimedOut = "timed_out"
+
+func validateTimeout(minutes *int) error {
+	if minutes != nil && *minutes < 0 {
+		return fmt.Errorf("timeout cannot be negative")
+	}
+	return nil
+}
+
+// runTimeout returns how long a run of the connection may take, or 0 for no
+// limit. Manual runs use the timeout of the connection's schedule, like its
+// other options.
+func (s *BackupService) runTimeout(connectionID string, schedule *BackupSchedule) time.Duration {
+	if schedule == nil {
+		current, err := s.backupRepo.GetBackupSchedule(connectionID)
+		if err != nil {
+			return 0
+		}
+		schedule = current
+	}
+	return time.Duration(schedule.TimeoutMinutes) * time.Minute
+}
+
+// processTracker keeps the dump subprocesses of a run, so a run past its
+// timeout can kill them, copies their output to the run's live log and
+// traces them under the run's span. A nil tracker runs commands untracked.
+type processTracker struct {
+	mu        sync.Mutex
+	running   map[*exec.Cmd]trace.Span
+	expired   bool
+	cancelled bool
+	interrupt bool
+	log       *liveLog
+	// progress counts the objects a restore's output reports restoring
+	progress *restoreJob
+	// meter follows the run or restore through its phases for clients
+	meter *progressMeter
+	// ctx carries the span and job ID of the run or restore into the spans
+	// and log lines of its stages
+	ctx context.Context
+}
+
+func newProcessTracker() *processTracker {
+	return &processTracker{running: make(map[*exec.Cmd]trace.Span)}
+}
+
+// start starts cmd in its own process group. Once the run expired no new
+// commands are started.
+func (t *processTracker) start(cmd *exec.Cmd) error {
+	if t == nil {
+		return cmd.Start()
+	}
+
+	setProcessGroup(cmd)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.expired {
+		t.interrupt = true
+		if t.cancelled {
+			return errRunCancelled
+		}
+		return fmt.Errorf("backup run timed out")
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	t.running[cmd] = t.traceCommand(cmd)
+	return nil
+}
+
+// wait waits for a command started with start
+func (t *processTracker) wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	if t != nil {
+		t.mu.Lock()
+		span := t.running[cmd]
+		delete(t.running, cmd)
+		t.mu.Unlock()
+		if span != nil {
+			endCommandSpan(span, cmd, err)
+		}
+	}
+	return err
+}
+
+// combinedOutput is cmd.CombinedOutput for a tracked command
+func (t *processTracker) combinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	var output bytes.Buffer
+	w := t.logOutput(&output)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	if err := t.start(cmd); err != nil {
+		return nil, err
+	}
+	err := t.wait(cmd)
+	return output.Bytes(), err
+}
+
+// expire kills the running commands with the processes they started
+func (t *processTracker) expire() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expired = true
+	for cmd := range t.running {
+		t.interrupt = true
+		if err := killProcessTree(cmd.Process); err != nil {
+			slog.WarnContext(t.jobContext(), "Failed to kill dump process", "pid", cmd.Process.Pid, "error", err)
+		}
+	}
+}
+
+// cancel kills the running commands like expire, for a run stopped by the
+// user rather than by its timeout
+func (t *processTracker) cancel() {
+	t.mu.Lock()
+	t.cancelled = true
+	t.mu.Unlock()
+	t.expire()
+}
+
+// timedOut reports whether the timeout interrupted a dump. Runs that expire
+// after their last dump finished complete normally.
+func (t *processTracker) timedOut() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.interrupt
+}
+
+// wasCancelled reports whether cancel interrupted a dump
+func (t *processTracker) wasCancelled() bool {
+	if t == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cancelled && t.interrupt
+}
+
+// removePartialDump deletes what a killed dump left at path, which is a
+// directory for parallel Postgres dumps
+func removePartialDump(path string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	if err := os.RemoveAll(path); err != nil {
+		slog.Warn("Failed to remove partial dump", "path", path, "error", err)
+		return
+	}
+	slog.Info("Removed partial dump of timed out backup", "path", path)
+}
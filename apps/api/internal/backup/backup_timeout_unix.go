@@ -0,0 +1,23 @@
+//go:build !windows
+
+package backup
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group, so the tools
+// it spawns can be killed with it
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// killProcessTree kills the process group led by process
+func killProcessTree(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGKILL)
+}
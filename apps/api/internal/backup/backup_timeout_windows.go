@@ -0,0 +1,18 @@
+//go:build windows
+
+package backup
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// setProcessGroup is not needed on Windows, where taskkill follows the
+// process tree
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessTree kills process and every process it started
+func killProcessTree(process *os.Process) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(process.Pid)).Run()
+}
@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/logging"
+	"github.com/dendianugerah/velld/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// databaseAttributes describe the database a span works on
+func databaseAttributes(conn *connection.StoredConnection, dbName string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("velld.connection.id", conn.ID),
+		attribute.String("db.system", conn.Type),
+		attribute.String("db.namespace", dbName),
+	}
+}
+
+// jobContext is the context of the run or restore the tracker belongs to
+func (t *processTracker) jobContext() context.Context {
+	if t == nil || t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+// backupContext is a context whose log lines carry the ID of the run that
+// made the backup
+func backupContext(backup *Backup) context.Context {
+	if backup == nil || backup.RunID == nil {
+		return context.Background()
+	}
+	return logging.WithJobID(context.Background(), *backup.RunID)
+}
+
+// traceStage runs one stage of a run or restore in a span under the
+// tracker's trace, and reports it as the phase of its progress
+func (t *processTracker) traceStage(name string, fn func() error, attrs ...attribute.KeyValue) error {
+	if t != nil {
+		var database string
+		for _, attr := range attrs {
+			if attr.Key == "db.namespace" {
+				database = attr.Value.AsString()
+			}
+		}
+		t.meter.setPhase(stagePhase(name), database)
+	}
+	_, span := telemetry.StartSpan(t.jobContext(), name, attrs...)
+	err := fn()
+	telemetry.EndSpan(span, err)
+	return err
+}
+
+// traceCommand starts the span of a subprocess. Arguments are left out, as
+// they can hold credentials.
+func (t *processTracker) traceCommand(cmd *exec.Cmd) trace.Span {
+	name := filepath.Base(cmd.Path)
+	_, span := telemetry.StartSpan(t.jobContext(), "exec "+name,
+		attribute.String("process.executable.name", name),
+		attribute.Int("process.pid", cmd.Process.Pid))
+	return span
+}
+
+// endCommandSpan ends the span of a subprocess with its exit code
+func endCommandSpan(span trace.Span, cmd *exec.Cmd, err error) {
+	if cmd.ProcessState != nil {
+		span.SetAttributes(attribute.Int("process.exit.code", cmd.ProcessState.ExitCode()))
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		span.SetAttributes(attribute.String("process.error", err.Error()))
+	}
+	telemetry.EndSpan(span, err)
+}
@@ -0,0 +1,360 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Upload journal states
+const (
+	UploadStatusUploading   = "uploading"
+	UploadStatusInterrupted = "interrupted"
+	UploadStatusCompleted   = "completed"
+)
+
+const (
+	defaultUploadPartSizeMB = 64
+	// S3 allows at most 10000 parts per upload
+	maxUploadParts    = 10000
+	uploadPartRetries = 3
+)
+
+// uploadPartSize reads BACKUP_UPLOAD_PART_SIZE_MB. Artifacts larger than one
+// part are uploaded in chunks that can be resumed individually.
+func uploadPartSize() int64 {
+	sizeMB := defaultUploadPartSizeMB
+	if value := strings.TrimSpace(os.Getenv("BACKUP_UPLOAD_PART_SIZE_MB")); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < minStreamPartSizeMB {
+			slog.Warn("Invalid BACKUP_UPLOAD_PART_SIZE_MB, using the default", "value", value, "default_mb", defaultUploadPartSizeMB)
+		} else {
+			sizeMB = parsed
+		}
+	}
+	return int64(sizeMB) * 1024 * 1024
+}
+
+// updateProgress fills in the derived progress fields of a journal
+func (j *UploadJournal) updateProgress() {
+	j.UploadedBytes = 0
+	for _, part := range j.Parts {
+		j.UploadedBytes += part.Size
+	}
+	j.PartsCompleted = len(j.Parts)
+	j.PartsTotal = int((j.TotalSize + j.PartSize - 1) / j.PartSize)
+	if j.PartsTotal == 0 {
+		j.PartsTotal = 1
+	}
+	if j.TotalSize > 0 {
+		j.Progress = float64(j.UploadedBytes) / float64(j.TotalSize) * 100
+	}
+}
+
+// uploadResumable uploads a local artifact in parts, journaling every part S3
+// acknowledges. When a previous attempt was interrupted, only the missing
+// parts are uploaded.
+func (s *BackupService) uploadResumable(storage *S3Storage, transfer *transfer, backup *Backup, subfolder string) (string, error) {
+	backupID := backup.ID.String()
+	if _, busy := s.activeUploads.LoadOrStore(backupID, true); busy {
+		return "", fmt.Errorf("upload of backup %s is already in progress", backupID)
+	}
+	defer s.activeUploads.Delete(backupID)
+
+	ctx := context.Background()
+
+	file, err := os.Open(backup.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	journal, err := s.backupRepo.GetUploadJournal(backupID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get upload journal: %v", err)
+	}
+	if journal != nil && journal.Status == UploadStatusCompleted {
+		return journal.ObjectKey, nil
+	}
+	if journal != nil && journal.TotalSize != fileInfo.Size() {
+		// The artifact changed since the upload started, so start over
+		if err := storage.AbortMultipartUpload(ctx, journal.ObjectKey, journal.UploadID); err != nil {
+			slog.WarnContext(backupContext(backup), "Failed to abort stale upload", "backup_id", backupID, "error", err)
+		}
+		journal = nil
+	}
+
+	if journal == nil {
+		partSize := uploadPartSize()
+		if minPartSize := (fileInfo.Size() + maxUploadParts - 1) / maxUploadParts; partSize < minPartSize {
+			partSize = minPartSize
+		}
+
+		objectKey := storage.getObjectKeyWithPath(filepath.Base(backup.Path), subfolder)
+		uploadID, err := storage.StartMultipartUpload(ctx, objectKey)
+		if err != nil {
+			return "", err
+		}
+
+		journal = &UploadJournal{
+			BackupID:  backupID,
+			ObjectKey: objectKey,
+			UploadID:  uploadID,
+			PartSize:  partSize,
+			TotalSize: fileInfo.Size(),
+			Parts:     []UploadPart{},
+		}
+	}
+
+	journal.Status = UploadStatusUploading
+	journal.Attempts++
+	journal.Error = ""
+	if err := s.backupRepo.SaveUploadJournal(journal); err != nil {
+		return "", fmt.Errorf("failed to save upload journal: %v", err)
+	}
+
+	uploaded := make(map[int]bool)
+	for _, part := range journal.Parts {
+		uploaded[part.Number] = true
+	}
+
+	journal.updateProgress()
+	for partNumber := 1; partNumber <= journal.PartsTotal; partNumber++ {
+		if uploaded[partNumber] {
+			continue
+		}
+
+		offset := int64(partNumber-1) * journal.PartSize
+		size := journal.PartSize
+		if remaining := journal.TotalSize - offset; remaining < size {
+			size = remaining
+		}
+
+		etag, err := uploadPartWithRetry(ctx, storage, transfer, journal, file, partNumber, offset, size)
+		if err != nil {
+			s.interruptUpload(journal, err)
+			return "", fmt.Errorf("upload interrupted at part %d/%d and can be resumed: %w", partNumber, journal.PartsTotal, err)
+		}
+
+		journal.Parts = append(journal.Parts, UploadPart{Number: partNumber, ETag: etag, Size: size})
+		if err := s.backupRepo.SaveUploadJournal(journal); err != nil {
+			slog.WarnContext(backupContext(backup), "Failed to update upload journal", "backup_id", backupID, "error", err)
+		}
+	}
+
+	sort.Slice(journal.Parts, func(i, j int) bool {
+		return journal.Parts[i].Number < journal.Parts[j].Number
+	})
+
+	if err := storage.CompleteMultipartUpload(ctx, journal.ObjectKey, journal.UploadID, journal.Parts); err != nil {
+		s.interruptUpload(journal, err)
+		return "", err
+	}
+
+	journal.Status = UploadStatusCompleted
+	if err := s.backupRepo.SaveUploadJournal(journal); err != nil {
+		slog.WarnContext(backupContext(backup), "Failed to update upload journal", "backup_id", backupID, "error", err)
+	}
+
+	return journal.ObjectKey, nil
+}
+
+func uploadPartWithRetry(ctx context.Context, storage *S3Storage, transfer *transfer, journal *UploadJournal, file *os.File, partNumber int, offset, size int64) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt < uploadPartRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(1<<attempt) * time.Second)
+		}
+
+		etag, err := storage.UploadPart(ctx, journal.ObjectKey, journal.UploadID, partNumber, transfer.reader(io.NewSectionReader(file, offset, size)), size)
+		if err == nil {
+			return etag, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+func (s *BackupService) interruptUpload(journal *UploadJournal, cause error) {
+	journal.Status = UploadStatusInterrupted
+	journal.Error = cause.Error()
+	if err := s.backupRepo.SaveUploadJournal(journal); err != nil {
+		slog.Warn("Failed to update upload journal", "backup_id", journal.BackupID, "error", err)
+	}
+}
+
+// resumeUpload continues an interrupted upload from the local artifact and
+// records the object key once it completes.
+func (s *BackupService) resumeUpload(backup *Backup, conn *connection.StoredConnection) error {
+	if _, err := os.Stat(backup.Path); err != nil {
+		return fmt.Errorf("local backup file no longer exists, upload cannot be resumed")
+	}
+
+	// A resumed upload is held to the limit of the connection's schedule
+	schedule, err := s.backupRepo.GetBackupSchedule(conn.ID)
+	if err != nil && err != sql.ErrNoRows {
+		slog.WarnContext(backupContext(backup), "Failed to get schedule for upload resume", "backup_id", backup.ID, "error", err)
+	}
+
+	if err := s.uploadToS3IfEnabled(backup, conn.UserID, conn.Name, schedule); err != nil {
+		return err
+	}
+
+	if backup.S3ObjectKey == nil {
+		return fmt.Errorf("S3 storage is not enabled")
+	}
+
+	return s.backupRepo.UpdateBackupS3ObjectKey(backup.ID.String(), *backup.S3ObjectKey)
+}
+
+// resumePendingUploads picks up uploads that were interrupted by a failure or
+// a restart.
+func (s *BackupService) resumePendingUploads() {
+	journals, err := s.backupRepo.GetPendingUploadJournals()
+	if err != nil {
+		slog.Error("Failed to get pending uploads", "error", err)
+		return
+	}
+
+	for _, journal := range journals {
+		backup, err := s.backupRepo.GetBackup(journal.BackupID)
+		if err == sql.ErrNoRows {
+			// The process exited before the backup record was saved
+			if err := s.backupRepo.DeleteUploadJournal(journal.BackupID); err != nil {
+				slog.Warn("Failed to delete orphaned upload journal", "backup_id", journal.BackupID, "error", err)
+			}
+			continue
+		}
+		if err != nil {
+			slog.Warn("Failed to get backup for upload resume", "backup_id", journal.BackupID, "error", err)
+			continue
+		}
+
+		conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+		if err != nil {
+			slog.WarnContext(backupContext(backup), "Failed to get connection for upload resume", "connection_id", backup.ConnectionID, "error", err)
+			continue
+		}
+
+		if err := s.resumeUpload(backup, conn); err != nil {
+			slog.WarnContext(backupContext(backup), "Failed to resume upload of backup", "backup_id", backup.ID, "error", err)
+		}
+	}
+}
+
+func (s *BackupService) GetUploadProgress(backupID string, userID uuid.UUID) (*UploadJournal, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	journal, err := s.backupRepo.GetUploadJournal(backupID)
+	if err != nil {
+		return nil, err
+	}
+	journal.updateProgress()
+	journal.ThroughputBytesPerSecond = s.transferThroughput(backupID)
+
+	return journal, nil
+}
+
+// ResumeUpload resumes an interrupted chunked upload on demand
+func (s *BackupService) ResumeUpload(backupID string, userID uuid.UUID) (*UploadJournal, error) {
+	journal, err := s.GetUploadProgress(backupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if journal.Status == UploadStatusCompleted {
+		return nil, fmt.Errorf("upload has already completed")
+	}
+
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	if err := s.resumeUpload(backup, conn); err != nil {
+		return nil, err
+	}
+
+	return s.GetUploadProgress(backupID, userID)
+}
+
+func (h *BackupHandler) GetUploadProgress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	journal, err := h.backupService.GetUploadProgress(backupID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Upload not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Upload progress retrieved successfully", journal)
+}
+
+func (h *BackupHandler) ResumeUpload(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	journal, err := h.backupService.ResumeUpload(backupID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Upload not found")
+			return
+		}
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Upload resumed successfully", journal)
+}
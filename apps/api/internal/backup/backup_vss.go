@@ -0,0 +1,22 @@
+package backup
+
+import (
+	"os"
+	"strings"
+)
+
+// vssSnapshotsEnabled reads WINDOWS_VSS_SNAPSHOTS, whether files copied from
+// the local filesystem are read from a Volume Shadow Copy on Windows hosts.
+func vssSnapshotsEnabled() bool {
+	return vssSupported && strings.ToLower(strings.TrimSpace(os.Getenv("WINDOWS_VSS_SNAPSHOTS"))) == "true"
+}
+
+// copyLocalFile copies a file of a database server on the same host and
+// returns how it did so. A shadow copy keeps a file that the server holds open
+// or rewrites during the copy consistent.
+func copyLocalFile(srcPath, dstPath string) (string, error) {
+	if vssSnapshotsEnabled() {
+		return "vss", copyFileFromShadow(srcPath, dstPath)
+	}
+	return "file", copyFile(srcPath, dstPath)
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package backup
+
+import "fmt"
+
+const vssSupported = false
+
+func copyFileFromShadow(srcPath, dstPath string) error {
+	return fmt.Errorf("volume shadow copies are only available on Windows")
+}
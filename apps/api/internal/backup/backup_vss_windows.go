@@ -0,0 +1,78 @@
+//go:build windows
+
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const vssSupported = true
+
+// copyFileFromShadow creates a shadow copy of the volume holding srcPath,
+// copies the file out of it and deletes the shadow copy again. Creating
+// shadow copies needs an elevated process.
+func copyFileFromShadow(srcPath, dstPath string) error {
+	absPath, err := filepath.Abs(srcPath)
+	if err != nil {
+		return err
+	}
+
+	// Shadow copies exist for local volumes only, not for network shares
+	volume := filepath.VolumeName(absPath)
+	if len(volume) != 2 || volume[1] != ':' {
+		return fmt.Errorf("%s is not on a local volume", absPath)
+	}
+
+	shadowID, device, err := createShadowCopy(volume + `\`)
+	if err != nil {
+		return fmt.Errorf("failed to create shadow copy of %s: %v", volume, err)
+	}
+	defer deleteShadowCopy(shadowID)
+
+	return copyFile(device+strings.TrimPrefix(absPath, volume), dstPath)
+}
+
+// createShadowCopy returns the ID and the device path of a new shadow copy
+func createShadowCopy(volume string) (string, string, error) {
+	script := fmt.Sprintf(`$ErrorActionPreference = 'Stop'
+$result = Invoke-CimMethod -ClassName Win32_ShadowCopy -MethodName Create -Arguments @{Volume = %s; Context = 'ClientAccessible'}
+if ($result.ReturnValue -ne 0) { throw "Win32_ShadowCopy.Create returned $($result.ReturnValue)" }
+$shadow = Get-CimInstance -ClassName Win32_ShadowCopy -Filter "ID='$($result.ShadowID)'"
+Write-Output $shadow.ID
+Write-Output $shadow.DeviceObject`, powerShellQuote(volume))
+
+	output, err := runPowerShell(script)
+	if err != nil {
+		return "", "", err
+	}
+
+	lines := strings.Fields(output)
+	if len(lines) != 2 {
+		return "", "", fmt.Errorf("unexpected output: %s", output)
+	}
+	return lines[0], lines[1], nil
+}
+
+func deleteShadowCopy(shadowID string) {
+	script := fmt.Sprintf(`Get-CimInstance -ClassName Win32_ShadowCopy -Filter "ID='%s'" | Remove-CimInstance`, shadowID)
+	if _, err := runPowerShell(script); err != nil {
+		slog.Warn("Failed to delete shadow copy", "shadow_id", shadowID, "error", err)
+	}
+}
+
+func runPowerShell(script string) (string, error) {
+	output, err := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script).CombinedOutput()
+	result := strings.TrimSpace(string(output))
+	if err != nil && result != "" {
+		err = fmt.Errorf("%v: %s", err, result)
+	}
+	return result, err
+}
+
+func powerShellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
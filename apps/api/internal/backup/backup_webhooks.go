@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/events"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/dendianugerah/velld/internal/webhook"
+)
+
+// webhookEvents maps notification types to the webhook events they fire
+var webhookEvents = map[notification.NotificationType]webhook.Event{
+	notification.BackupCompleted:              webhook.EventBackupCompleted,
+	notification.BackupFailed:                 webhook.EventBackupFailed,
+	notification.BackupPartial:                webhook.EventBackupPartial,
+	notification.BackupCorrupt:                webhook.EventBackupCorrupt,
+	notification.BackupPrecheckFailed:         webhook.EventBackupPrecheckFailed,
+	notification.ConnectionCredentialsInvalid: webhook.EventConnectionCredentialsInvalid,
+	notification.RestoreCompleted:             webhook.EventRestoreCompleted,
+	notification.RestoreFailed:                webhook.EventRestoreFailed,
+}
+
+// dispatchWebhooks fires the webhook event of a notification. Webhooks are
+// independent of the notification settings and fallback chains: they are
+// called for every event they subscribe to.
+func (s *BackupService) dispatchWebhooks(n *notification.Notification, metadata map[string]interface{}) {
+	event, ok := webhookEvents[n.Type]
+	if !ok || s.webhookService == nil {
+		return
+	}
+	go s.webhookService.Dispatch(n.UserID, event, n.Title, n.Message, metadata)
+}
+
+var scheduleEventTitles = map[webhook.Event]string{
+	webhook.EventScheduleCreated:  "Schedule Created",
+	webhook.EventScheduleUpdated:  "Schedule Updated",
+	webhook.EventScheduleDisabled: "Schedule Disabled",
+	webhook.EventSchedulePaused:   "Schedule Paused",
+	webhook.EventScheduleResumed:  "Schedule Resumed",
+}
+
+// dispatchScheduleEvent fires a webhook event for a change to a schedule and
+// publishes it to the owner's event streams
+func (s *BackupService) dispatchScheduleEvent(event webhook.Event, schedule *BackupSchedule) {
+	if s.webhookService == nil && s.eventService == nil {
+		return
+	}
+	conn, err := s.connStorage.GetConnection(schedule.ConnectionID)
+	if err != nil {
+		slog.Warn("Failed to get connection for webhook", "event", event, "error", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"schedule_id":     schedule.ID,
+		"connection_id":   conn.ID,
+		"connection_name": conn.Name,
+		"database_name":   conn.DatabaseName,
+		"database_type":   conn.Type,
+		"enabled":         schedule.Enabled,
+		"paused":          schedule.Paused,
+		"cron_schedule":   schedule.CronSchedule,
+		"retention_days":  schedule.RetentionDays,
+	}
+	if schedule.RunAt != nil {
+		data["run_at"] = schedule.RunAt.Format(time.RFC3339)
+	}
+	if schedule.NextRunTime != nil && !schedule.NextRunTime.IsZero() {
+		data["next_run_time"] = schedule.NextRunTime.Format(time.RFC3339)
+	}
+	if schedule.PauseReason != nil {
+		data["pause_reason"] = *schedule.PauseReason
+	}
+
+	s.publishEvent(conn, events.Type(event), data)
+	if s.webhookService == nil {
+		return
+	}
+
+	title := scheduleEventTitles[event]
+	message := fmt.Sprintf("%s for '%s'", title, conn.Name)
+	go s.webhookService.Dispatch(conn.UserID, event, title, message, data)
+}
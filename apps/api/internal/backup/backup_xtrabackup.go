@@ -0,0 +1,432 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// xtraBackupExtension marks an XtraBackup of a MySQL server: the backup
+// directory, including its xtrabackup_checkpoints file, packed into one tar
+// archive. Incremental backups hold only the pages changed since their base.
+const xtraBackupExtension = ".xb.tar"
+
+// maxIncrementalBackups caps how many incremental backups follow a full one
+const maxIncrementalBackups = 100
+
+// xtraBackupOutputLines is how much of XtraBackup's verbose log is kept in
+// error messages
+const xtraBackupOutputLines = 20
+
+func isXtraBackup(path string) bool {
+	return strings.HasSuffix(path, xtraBackupExtension)
+}
+
+// validateIncrementalBackups checks the incremental backup count submitted
+// with a schedule request. Incrementals continue from the LSN XtraBackup
+// records, so they need physical backups of a MySQL connection.
+func (s *BackupService) validateIncrementalBackups(connectionID string, count *int, physical bool) error {
+	if count == nil || *count == 0 {
+		return nil
+	}
+
+	if *count < 0 || *count > maxIncrementalBackups {
+		return fmt.Errorf("incremental backups must be between 0 and %d", maxIncrementalBackups)
+	}
+
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	if conn.Type != "mysql" {
+		return fmt.Errorf("incremental backups are only supported for mysql connections")
+	}
+	if !physical {
+		return fmt.Errorf("incremental backups require physical_backup")
+	}
+
+	return nil
+}
+
+// incrementalBaseFor returns the backup the next physical backup of the
+// connection builds on, or nil when it should be a full backup: when the
+// schedule takes no incrementals, the current chain has as many as it
+// allows, or the chain cannot be followed back to its full backup.
+func (s *BackupService) incrementalBaseFor(connectionID string, schedule *BackupSchedule) *Backup {
+	if schedule == nil || schedule.IncrementalBackups == 0 {
+		return nil
+	}
+
+	latest, err := s.backupRepo.GetLatestCheckpointedBackup(connectionID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Warn("Failed to get latest physical backup of connection", "connection_id", connectionID, "error", err)
+		}
+		return nil
+	}
+
+	chain, err := s.backupChain(latest)
+	if err != nil {
+		slog.Warn("Taking a full backup", "connection_id", connectionID, "reason", err)
+		return nil
+	}
+	if len(chain)-1 >= schedule.IncrementalBackups {
+		return nil
+	}
+	return latest
+}
+
+// backupChain returns the full backup an incremental backup builds on,
+// followed by every incremental up to and including it
+func (s *BackupService) backupChain(backup *Backup) ([]*Backup, error) {
+	chain := []*Backup{backup}
+	for current := backup; current.IncrementalBaseID != nil; {
+		if len(chain) > maxIncrementalBackups {
+			return nil, fmt.Errorf("incremental chain of backup %s is longer than %d backups", backup.ID, maxIncrementalBackups)
+		}
+		base, err := s.backupRepo.GetBackup(*current.IncrementalBaseID)
+		if err != nil {
+			return nil, fmt.Errorf("base backup %s of incremental backup %s not found", *current.IncrementalBaseID, current.ID)
+		}
+		chain = append(chain, base)
+		current = base
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// createXtraBackup copies the MySQL server with XtraBackup, incrementally
+// from the previous backup's checkpoint when the schedule takes
+// incrementals. XtraBackup reads the data files directly, so it runs on the
+// database host: over SSH with its output streamed back as xbstream when the
+// connection uses a tunnel, and locally otherwise.
+func (s *BackupService) createXtraBackup(conn *connection.StoredConnection, tunnel *connection.SSHTunnel, backup *Backup, schedule *BackupSchedule, processes *processTracker) (*RunEnvironment, error) {
+	targetDir := strings.TrimSuffix(backup.Path, ".tar")
+
+	args := []string{"--backup", "--user=" + conn.Username}
+	base := s.incrementalBaseFor(conn.ID, schedule)
+	if base != nil {
+		slog.InfoContext(processes.jobContext(), "Taking incremental backup", "connection_id", conn.ID, "base_backup_id", base.ID)
+		args = append(args, "--incremental-lsn="+*base.CheckpointLSN)
+	}
+
+	var environment *RunEnvironment
+	var err error
+	if tunnel != nil {
+		environment, err = runXtraBackupOverSSH(conn, tunnel, args, targetDir, schedule, processes)
+	} else {
+		environment, err = runXtraBackup(conn, args, targetDir, schedule, processes)
+	}
+	if err != nil {
+		removePartialDump(targetDir)
+		if processes.timedOut() {
+			return nil, fmt.Errorf("physical backup of %s server on %s:%d timed out", conn.Type, conn.Host, conn.Port)
+		}
+		return nil, fmt.Errorf("physical backup failed for %s server on %s:%d - %v", conn.Type, conn.Host, conn.Port, err)
+	}
+
+	lsn, err := readXtraBackupCheckpoint(targetDir)
+	if err != nil {
+		removePartialDump(targetDir)
+		return nil, err
+	}
+	backup.CheckpointLSN = &lsn
+	if base != nil {
+		baseID := base.ID.String()
+		backup.IncrementalBaseID = &baseID
+	}
+
+	return environment, nil
+}
+
+func xtraBackupBinary(tool string) (string, error) {
+	binaryPath := common.FindBinaryPath("mysql", tool)
+	if binaryPath == "" {
+		return "", fmt.Errorf("backup tool not found for mysql. Please ensure %s is installed and available in PATH", tool)
+	}
+	return filepath.Join(binaryPath, common.GetPlatformExecutableName(tool)), nil
+}
+
+// runXtraBackup backs up a server whose data directory is on this host
+func runXtraBackup(conn *connection.StoredConnection, args []string, targetDir string, schedule *BackupSchedule, processes *processTracker) (*RunEnvironment, error) {
+	binPath, err := xtraBackupBinary("xtrabackup")
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args,
+		"--host="+conn.Host,
+		fmt.Sprintf("--port=%d", conn.Port),
+		"--target-dir="+targetDir,
+	)
+	cmd := exec.Command(binPath, args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("MYSQL_PWD=%s", conn.Password))
+	environment := captureRunEnvironment(cmd, schedule, false)
+
+	output, err := processes.combinedOutput(cmd)
+	if err != nil {
+		if message := lastLines(string(output), xtraBackupOutputLines); message != "" {
+			return nil, fmt.Errorf("%s", message)
+		}
+		return nil, err
+	}
+	return environment, nil
+}
+
+// runXtraBackupOverSSH runs XtraBackup on the SSH host of the connection's
+// tunnel and unpacks its xbstream output into targetDir with a local xbstream
+func runXtraBackupOverSSH(conn *connection.StoredConnection, tunnel *connection.SSHTunnel, args []string, targetDir string, schedule *BackupSchedule, processes *processTracker) (*RunEnvironment, error) {
+	binPath, err := xtraBackupBinary("xbstream")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+
+	// The tunnel's remote address is the database as the SSH host sees it
+	args = append(args,
+		"--host="+tunnel.Remote.IP.String(),
+		fmt.Sprintf("--port=%d", tunnel.Remote.Port),
+		"--stream=xbstream",
+		"--target-dir=/tmp",
+	)
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	password := "'" + strings.ReplaceAll(conn.Password, "'", `'\''`) + "'"
+	command := fmt.Sprintf("MYSQL_PWD=%s xtrabackup %s", password, strings.Join(quoted, " "))
+
+	extract := exec.Command(binPath, "-x", "-C", targetDir)
+	stdin, err := extract.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	var extractOutput bytes.Buffer
+	extract.Stdout = processes.logOutput(&extractOutput)
+	extract.Stderr = extract.Stdout
+	if err := processes.start(extract); err != nil {
+		return nil, err
+	}
+
+	runErr := tunnel.RunCommand(command, stdin)
+	stdin.Close()
+	waitErr := processes.wait(extract)
+	if runErr != nil {
+		return nil, fmt.Errorf("%s", lastLines(runErr.Error(), xtraBackupOutputLines))
+	}
+	if waitErr != nil {
+		return nil, fmt.Errorf("xbstream failed: %s", strings.TrimSpace(extractOutput.String()))
+	}
+
+	environment := captureRunEnvironment(nil, schedule, false)
+	environment.DumpTool = "xtrabackup"
+	environment.DumpArgs = append([]string{"fetch=ssh"}, args...)
+	return environment, nil
+}
+
+// readXtraBackupCheckpoint returns the LSN a backup ends at, which the next
+// incremental backup starts from
+func readXtraBackupCheckpoint(targetDir string) (string, error) {
+	file, err := os.Open(filepath.Join(targetDir, "xtrabackup_checkpoints"))
+	if err != nil {
+		return "", fmt.Errorf("backup has no xtrabackup_checkpoints: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if ok && strings.TrimSpace(key) == "to_lsn" {
+			return strings.TrimSpace(value), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read xtrabackup_checkpoints: %v", err)
+	}
+	return "", fmt.Errorf("xtrabackup_checkpoints has no to_lsn")
+}
+
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PreparePhysicalBackup makes an XtraBackup restorable: the full backup its
+// chain starts from is extracted and every incremental up to this backup is
+// applied to it in order. The prepared directory is left on the velld host
+// for xtrabackup --copy-back, which has to run on the stopped MySQL server.
+func (s *BackupService) PreparePhysicalBackup(backupID string, userID uuid.UUID) (*PreparedBackup, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+
+	if !isXtraBackup(plainDumpPath(backup)) {
+		return nil, fmt.Errorf("only physical MySQL backups can be prepared")
+	}
+
+	chain, err := s.backupChain(backup)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range chain {
+		if isGPGEncrypted(b) {
+			return nil, fmt.Errorf("backup %s is GPG encrypted and velld cannot decrypt it", b.ID)
+		}
+	}
+
+	binPath, err := xtraBackupBinary("xtrabackup")
+	if err != nil {
+		return nil, err
+	}
+
+	preparedDir := filepath.Join(s.backupDir, ".prepared", backup.ID.String())
+	if err := os.RemoveAll(preparedDir); err != nil {
+		return nil, fmt.Errorf("failed to clear prepared directory: %v", err)
+	}
+	if err := os.MkdirAll(preparedDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create prepared directory: %v", err)
+	}
+
+	if err := s.applyBackupChain(binPath, chain, preparedDir, conn.UserID); err != nil {
+		os.RemoveAll(preparedDir)
+		return nil, err
+	}
+
+	chainIDs := make([]string, len(chain))
+	for i, b := range chain {
+		chainIDs[i] = b.ID.String()
+	}
+
+	return &PreparedBackup{
+		BackupID: backup.ID.String(),
+		Chain:    chainIDs,
+		Path:     preparedDir,
+		RestoreSteps: []string{
+			"Stop MySQL and empty its data directory",
+			fmt.Sprintf("Copy the prepared backup into place: xtrabackup --copy-back --target-dir=%s", preparedDir),
+			"Give the restored files to the mysql user and start MySQL",
+		},
+	}, nil
+}
+
+// applyBackupChain extracts the full backup of the chain into preparedDir
+// and applies each incremental to it. Every step but the last keeps the
+// undo phase for later with --apply-log-only, as XtraBackup requires.
+func (s *BackupService) applyBackupChain(binPath string, chain []*Backup, preparedDir string, userID uuid.UUID) error {
+	if err := s.extractChainBackup(chain[0], preparedDir, userID); err != nil {
+		return err
+	}
+
+	args := []string{"--prepare", "--target-dir=" + preparedDir}
+	if len(chain) > 1 {
+		args = append(args, "--apply-log-only")
+	}
+	if err := runXtraBackupPrepare(binPath, args); err != nil {
+		return fmt.Errorf("failed to prepare full backup %s: %v", chain[0].ID, err)
+	}
+
+	for i, incremental := range chain[1:] {
+		incrementalDir, err := os.MkdirTemp(filepath.Dir(preparedDir), "incremental-")
+		if err != nil {
+			return fmt.Errorf("failed to create temp directory: %v", err)
+		}
+
+		err = s.extractChainBackup(incremental, incrementalDir, userID)
+		if err == nil {
+			args := []string{"--prepare", "--target-dir=" + preparedDir, "--incremental-dir=" + incrementalDir}
+			if i < len(chain)-2 {
+				args = append(args, "--apply-log-only")
+			}
+			if err = runXtraBackupPrepare(binPath, args); err != nil {
+				err = fmt.Errorf("failed to apply incremental backup %s: %v", incremental.ID, err)
+			}
+		}
+		os.RemoveAll(incrementalDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *BackupService) extractChainBackup(backup *Backup, dir string, userID uuid.UUID) error {
+	filePath, isTemp, err := s.ensureBackupContentAvailable(backup, userID)
+	if err != nil {
+		return fmt.Errorf("backup %s is not available: %v", backup.ID, err)
+	}
+	if isTemp {
+		defer os.Remove(filePath)
+	}
+	return extractDirectoryDump(filePath, dir)
+}
+
+func runXtraBackupPrepare(binPath string, args []string) error {
+	output, err := exec.Command(binPath, args...).CombinedOutput()
+	if err != nil {
+		if message := lastLines(string(output), xtraBackupOutputLines); message != "" {
+			return fmt.Errorf("%s", message)
+		}
+		return err
+	}
+	return nil
+}
+
+func (h *BackupHandler) PreparePhysicalBackup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.backupService.recordArtifactAccess(newArtifactAccess(r, backupID, userID, AccessPrepare)); err != nil {
+		sendAccessError(w, err)
+		return
+	}
+
+	prepared, err := h.backupService.PreparePhysicalBackup(backupID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup prepared successfully", prepared)
+}
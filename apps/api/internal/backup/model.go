@@ -1,54 +1,191 @@
 package backup
 
 import (
+	"sync"
 	"time"
 
+	"github.com/dendianugerah/velld/internal/connection"
 	"github.com/google/uuid"
 )
 
 // BackupSchedule represents a backup schedule configuration
 type BackupSchedule struct {
-	ID             uuid.UUID  `json:"id"`
-	ConnectionID   string     `json:"connection_id"`
-	Enabled        bool       `json:"enabled"`
-	CronSchedule   string     `json:"cron_schedule"`
-	RetentionDays  int        `json:"retention_days"`
-	NextRunTime    *time.Time `json:"next_run_time"`
-	LastBackupTime *time.Time `json:"last_backup_time"`
-	CreatedAt      time.Time  `json:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at"`
+	ID                 uuid.UUID         `json:"id"`
+	ConnectionID       string            `json:"connection_id"`
+	Enabled            bool              `json:"enabled"`
+	CronSchedule       string            `json:"cron_schedule"`
+	RetentionDays      int               `json:"retention_days"`
+	RetentionMaxBytes  int64             `json:"retention_max_bytes"`
+	NextRunTime        *time.Time        `json:"next_run_time"`
+	LastBackupTime     *time.Time        `json:"last_backup_time"`
+	GPGPublicKey       *string           `json:"gpg_public_key,omitempty"`
+	VerifyConnectionID *string           `json:"verify_connection_id,omitempty"`
+	CompressionCommand *string           `json:"compression_command,omitempty"`
+	StreamToStorage    bool              `json:"stream_to_storage"`
+	PgDumpJobs         int               `json:"pg_dump_jobs"`
+	DumpFilters        *DumpFilters      `json:"dump_filters,omitempty"`
+	ExtraDumpArgs      *string           `json:"extra_dump_args,omitempty"`
+	MongoDumpOptions   *MongoDumpOptions `json:"mongo_dump_options,omitempty"`
+	PostProcessors     PostProcessors    `json:"post_processors,omitempty"`
+	RedisSnapshot      bool              `json:"redis_snapshot"`
+	BandwidthLimitKBps int               `json:"bandwidth_limit_kbps"`
+	Deduplicate        bool              `json:"deduplicate"`
+	Priority           string            `json:"priority"`
+	ConcurrencyPolicy  string            `json:"concurrency_policy"`
+	TimeoutMinutes     int               `json:"timeout_minutes"`
+	RPOMinutes         int               `json:"rpo_minutes"`
+	MaskingRules       MaskingRules      `json:"masking_rules,omitempty"`
+	Sample             *SampleOptions    `json:"sample,omitempty"`
+	PhysicalBackup     bool              `json:"physical_backup"`
+	IncrementalBackups int               `json:"incremental_backups"`
+	AllDatabases       bool              `json:"all_databases"`
+	DatabaseWorkers    int               `json:"database_workers"`
+	Databases          ScheduleDatabases `json:"databases,omitempty"`
+	// JitterSeconds delays each scheduled run by a random time up to that
+	// many seconds, so schedules sharing a start time don't start together
+	JitterSeconds int `json:"jitter_seconds"`
+	// Paused schedules keep their settings but skip their runs until they
+	// are resumed
+	Paused      bool       `json:"paused"`
+	PausedAt    *time.Time `json:"paused_at,omitempty"`
+	PauseReason *string    `json:"pause_reason,omitempty"`
+	// State labels the schedule active, paused or disabled
+	State string `json:"state"`
+	// Timezone is the IANA zone the cron expression is evaluated in; unset
+	// uses the server's local time zone
+	Timezone *string `json:"timezone,omitempty"`
+	// RunAt makes the schedule a one-shot backup at that time instead of a
+	// cron schedule; it is disabled after the run
+	RunAt *time.Time `json:"run_at,omitempty"`
+	// DiscordWebhookURL receives the Discord notifications of the schedule's
+	// connection instead of the webhook of the settings
+	DiscordWebhookURL *string `json:"discord_webhook_url,omitempty"`
+	// HeartbeatURL is a Healthchecks.io or Cronitor check pinged when a
+	// scheduled run starts, succeeds or fails, so the monitor alerts when
+	// backups stop running
+	HeartbeatURL *string `json:"heartbeat_url,omitempty"`
+	// SizeAnomalyPercent is how far a backup may be off the trailing average
+	// size before it is marked suspect; 0 falls back to
+	// BACKUP_SIZE_ANOMALY_PERCENT
+	SizeAnomalyPercent int `json:"size_anomaly_percent"`
+	// VerificationObjectiveMinutes is how old the newest backup that passed
+	// a restore verification may get; 0 falls back to
+	// BACKUP_VERIFICATION_OBJECTIVE_MINUTES
+	VerificationObjectiveMinutes int `json:"verification_objective_minutes"`
+	// CompressionLevel and CompressionThreads tune the codec of
+	// CompressionCommand; 0 keeps the codec's default
+	CompressionLevel   int `json:"compression_level"`
+	CompressionThreads int `json:"compression_threads"`
+	// RerunInterrupted decides whether runs interrupted by a restart run
+	// again; unset follows BACKUP_RERUN_INTERRUPTED
+	RerunInterrupted *bool     `json:"rerun_interrupted,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 // Backup represents a single backup record
 type Backup struct {
-	ID            uuid.UUID  `json:"id"`
-	ConnectionID  string     `json:"connection_id"`
-	ScheduleID    *string    `json:"schedule_id"`
-	Status        string     `json:"status"`
-	Path          string     `json:"path"`
-	S3ObjectKey   *string    `json:"s3_object_key"`
-	Size          int64      `json:"size"`
-	StartedTime   time.Time  `json:"started_time"`
-	CompletedTime *time.Time `json:"completed_time"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
+	ID                        uuid.UUID          `json:"id"`
+	ConnectionID              string             `json:"connection_id"`
+	DatabaseName              *string            `json:"database_name"`
+	DatabaseSize              *int64             `json:"database_size"`
+	ScheduleID                *string            `json:"schedule_id"`
+	RunID                     *string            `json:"run_id"`
+	Status                    string             `json:"status"`
+	Path                      string             `json:"path"`
+	S3ObjectKey               *string            `json:"s3_object_key"`
+	Size                      int64              `json:"size"`
+	CompressionCommand        *string            `json:"compression_command"`
+	EncryptionKeyFingerprint  *string            `json:"encryption_key_fingerprint"`
+	Checksum                  *string            `json:"checksum"`
+	ChecksumSignature         *string            `json:"checksum_signature"`
+	SigningKeyFingerprint     *string            `json:"signing_key_fingerprint"`
+	VerificationStatus        *string            `json:"verification_status"`
+	VerifiedAt                *time.Time         `json:"verified_at"`
+	RestoreVerificationStatus *string            `json:"restore_verification_status"`
+	DumpFilters               *DumpFilters       `json:"dump_filters"`
+	RunEnvironment            *RunEnvironment    `json:"run_environment"`
+	PostProcessedFiles        PostProcessedFiles `json:"post_processed_files"`
+	IncrementalBaseID         *string            `json:"incremental_base_id"`
+	CheckpointLSN             *string            `json:"checkpoint_lsn"`
+	Manifest                  *BackupManifest    `json:"manifest,omitempty"`
+	StartedTime               time.Time          `json:"started_time"`
+	CompletedTime             *time.Time         `json:"completed_time"`
+	CreatedAt                 time.Time          `json:"created_at"`
+	UpdatedAt                 time.Time          `json:"updated_at"`
+	// Suspect marks a backup whose size is far off the trailing average of
+	// the database's backups, which usually means a broken dump
+	Suspect       bool    `json:"suspect"`
+	SuspectReason *string `json:"suspect_reason"`
+	// catalog lists the tables in the artifact and is saved with the backup
+	catalog []CatalogTable
+}
+
+// BackupRun groups the backups produced by one trigger. Each database dumped
+// and each upload is a child job; the run status aggregates their outcomes.
+type BackupRun struct {
+	ID            uuid.UUID       `json:"id"`
+	ConnectionID  string          `json:"connection_id"`
+	ScheduleID    *string         `json:"schedule_id"`
+	Trigger       string          `json:"trigger"`
+	Status        string          `json:"status"`
+	TotalJobs     int             `json:"total_jobs"`
+	SucceededJobs int             `json:"succeeded_jobs"`
+	FailedJobs    int             `json:"failed_jobs"`
+	Error         *string         `json:"error"`
+	StartedTime   time.Time       `json:"started_time"`
+	CompletedTime *time.Time      `json:"completed_time"`
+	Jobs          []*BackupRunJob `json:"jobs,omitempty"`
+	Priority      string          `json:"priority"`
+	// QueuePosition is the place of a queued run among the waiting runs
+	QueuePosition *int `json:"queue_position,omitempty"`
+	// databaseSizes are the sizes measured by the pre-flight check
+	databaseSizes map[string]int64
+	// schemas are the schema descriptions taken before the dump, for the
+	// manifests of its backups
+	schemas map[string]*connection.SchemaDescription
+	// processes are the dump subprocesses the run's timeout kills
+	processes *processTracker
+	// jobsMu guards Jobs while databases are dumped in parallel
+	jobsMu sync.Mutex
+}
+
+// BackupRunJob is a child job of a backup run
+type BackupRunJob struct {
+	ID        uuid.UUID `json:"id"`
+	RunID     string    `json:"run_id"`
+	Kind      string    `json:"kind"`
+	Target    string    `json:"target"`
+	BackupID  *string   `json:"backup_id"`
+	Status    string    `json:"status"`
+	Error     *string   `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // BackupList represents a backup in list view with additional info
 type BackupList struct {
-	ID            uuid.UUID `json:"id"`
-	ConnectionID  string    `json:"connection_id"`
-	DatabaseType  string    `json:"database_type"`
-	DatabaseName  string    `json:"database_name"`
-	ScheduleID    *string   `json:"schedule_id"`
-	Status        string    `json:"status"`
-	Path          string    `json:"path"`
-	S3ObjectKey   *string   `json:"s3_object_key"`
-	Size          int64     `json:"size"`
-	StartedTime   string    `json:"started_time"`
-	CompletedTime string    `json:"completed_time"`
-	CreatedAt     string    `json:"created_at"`
-	UpdatedAt     string    `json:"updated_at"`
+	ID                        uuid.UUID    `json:"id"`
+	ConnectionID              string       `json:"connection_id"`
+	DatabaseType              string       `json:"database_type"`
+	DatabaseName              string       `json:"database_name"`
+	ScheduleID                *string      `json:"schedule_id"`
+	Status                    string       `json:"status"`
+	Path                      string       `json:"path"`
+	S3ObjectKey               *string      `json:"s3_object_key"`
+	Size                      int64        `json:"size"`
+	CompressionCommand        *string      `json:"compression_command"`
+	EncryptionKeyFingerprint  *string      `json:"encryption_key_fingerprint"`
+	Checksum                  *string      `json:"checksum"`
+	VerificationStatus        *string      `json:"verification_status"`
+	VerifiedAt                *string      `json:"verified_at"`
+	RestoreVerificationStatus *string      `json:"restore_verification_status"`
+	DumpFilters               *DumpFilters `json:"dump_filters"`
+	Suspect                   bool         `json:"suspect"`
+	SuspectReason             *string      `json:"suspect_reason"`
+	StartedTime               string       `json:"started_time"`
+	CompletedTime             string       `json:"completed_time"`
+	CreatedAt                 string       `json:"created_at"`
+	UpdatedAt                 string       `json:"updated_at"`
 }
 
 // BackupRequest represents a request to create a backup
@@ -61,6 +198,109 @@ type ScheduleBackupRequest struct {
 	ConnectionID  string `json:"connection_id"`
 	CronSchedule  string `json:"cron_schedule"`
 	RetentionDays int    `json:"retention_days"`
+	// RetentionMaxBytes caps the total size of the connection's backups; the
+	// oldest are deleted beyond it, keeping the newest full backup. 0 removes
+	// the cap
+	RetentionMaxBytes *int64 `json:"retention_max_bytes,omitempty"`
+	// Timezone is an IANA name such as "Europe/Amsterdam" the schedule runs
+	// in; an empty string uses the server's local time zone
+	Timezone *string `json:"timezone,omitempty"`
+	// RunAt schedules a single backup at that time instead of the cron
+	// schedule, e.g. right before a planned migration; leave cron_schedule
+	// empty when it is set
+	RunAt *time.Time `json:"run_at,omitempty"`
+	// GPGPublicKey is an ASCII-armored public key; an empty string removes it
+	GPGPublicKey *string `json:"gpg_public_key,omitempty"`
+	// VerifyConnectionID enables verify-by-restore; an empty string disables it
+	VerifyConnectionID *string `json:"verify_connection_id,omitempty"`
+	// CompressionCommand names the codec: gzip, pigz, xz, zstd or bzip2; an
+	// empty string disables it
+	CompressionCommand *string `json:"compression_command,omitempty"`
+	// CompressionLevel is the codec's level, e.g. 1-9 for gzip or 1-19 for
+	// zstd; 0 keeps the codec's default
+	CompressionLevel *int `json:"compression_level,omitempty"`
+	// CompressionThreads is how many threads pigz, xz or zstd compress with;
+	// 0 keeps the codec's default
+	CompressionThreads *int `json:"compression_threads,omitempty"`
+	// StreamToStorage uploads dumps to S3 as they are produced, without a local copy
+	StreamToStorage *bool `json:"stream_to_storage,omitempty"`
+	// PgDumpJobs > 0 dumps Postgres in directory format with that many workers
+	PgDumpJobs *int `json:"pg_dump_jobs,omitempty"`
+	// DumpFilters restricts dumps to schemas and tables; empty filters clear them
+	DumpFilters *DumpFilters `json:"dump_filters,omitempty"`
+	// ExtraDumpArgs are allowlisted dump tool options such as "--no-owner"; an
+	// empty string removes them
+	ExtraDumpArgs *string `json:"extra_dump_args,omitempty"`
+	// MongoDumpOptions toggles mongodump --oplog, --gzip and reads from
+	// secondaries; all toggles off clears them
+	MongoDumpOptions *MongoDumpOptions `json:"mongo_dump_options,omitempty"`
+	// PostProcessors run on each artifact before it is uploaded; an empty
+	// list removes them
+	PostProcessors *PostProcessors `json:"post_processors,omitempty"`
+	// RedisSnapshot backs up Redis with BGSAVE and fetches the RDB file
+	// instead of replicating it with redis-cli --rdb
+	RedisSnapshot *bool `json:"redis_snapshot,omitempty"`
+	// BandwidthLimitKBps caps dump streams and uploads in kilobytes per
+	// second; 0 removes the limit
+	BandwidthLimitKBps *int `json:"bandwidth_limit_kbps,omitempty"`
+	// Deduplicate stores artifacts as content-defined chunks in the shared
+	// chunk store instead of as whole files
+	Deduplicate *bool `json:"deduplicate,omitempty"`
+	// Priority orders queued runs when every worker is busy: high, normal
+	// or low
+	Priority *string `json:"priority,omitempty"`
+	// ConcurrencyPolicy decides what a scheduled run does when the previous
+	// run of the connection is still going: skip, queue or replace
+	ConcurrencyPolicy *string `json:"concurrency_policy,omitempty"`
+	// TimeoutMinutes stops runs that take longer, killing the dump and
+	// removing its partial files; 0 removes the timeout
+	TimeoutMinutes *int `json:"timeout_minutes,omitempty"`
+	// JitterSeconds delays each scheduled run by a random time up to that
+	// many seconds, at most a day; 0 starts runs on time
+	JitterSeconds *int `json:"jitter_seconds,omitempty"`
+	// RPOMinutes is the recovery point objective: the newest successful
+	// backup must not be older. 0 falls back to BACKUP_RPO_MINUTES
+	RPOMinutes *int `json:"rpo_minutes,omitempty"`
+	// SizeAnomalyPercent marks backups more than that many percent smaller
+	// or larger than the trailing average as suspect. 0 falls back to
+	// BACKUP_SIZE_ANOMALY_PERCENT
+	SizeAnomalyPercent *int `json:"size_anomaly_percent,omitempty"`
+	// VerificationObjectiveMinutes requires a backup that passed a restore
+	// verification at least that often, e.g. 10080 for weekly. 0 falls back
+	// to BACKUP_VERIFICATION_OBJECTIVE_MINUTES
+	VerificationObjectiveMinutes *int `json:"verification_objective_minutes,omitempty"`
+	// MaskingRules rewrite columns such as emails and names while dumping,
+	// producing sanitized backups for staging; an empty list removes them
+	MaskingRules *MaskingRules `json:"masking_rules,omitempty"`
+	// Sample turns backups into small development snapshots holding a number
+	// or percentage of the rows of each table; an empty sample removes it
+	Sample *SampleOptions `json:"sample,omitempty"`
+	// PhysicalBackup copies the whole server with pg_basebackup (Postgres) or
+	// XtraBackup (MySQL) instead of dumping the database, for servers too
+	// large for logical dumps
+	PhysicalBackup *bool `json:"physical_backup,omitempty"`
+	// IncrementalBackups is how many incremental physical MySQL backups
+	// follow each full one; 0 takes full backups only
+	IncrementalBackups *int `json:"incremental_backups,omitempty"`
+	// AllDatabases backs up every database found on the server at run time,
+	// each into its own backup record of the run
+	AllDatabases *bool `json:"all_databases,omitempty"`
+	// DatabaseWorkers is how many databases of a multi-database run are
+	// dumped at once; 0 dumps them one after another
+	DatabaseWorkers *int `json:"database_workers,omitempty"`
+	// Databases are the databases of the connection the schedule backs up,
+	// each into its own backup record of the run; an empty list removes it
+	Databases *ScheduleDatabases `json:"databases,omitempty"`
+	// RerunInterrupted runs the schedule's runs interrupted by a restart
+	// again, overriding BACKUP_RERUN_INTERRUPTED
+	RerunInterrupted *bool `json:"rerun_interrupted,omitempty"`
+	// DiscordWebhookURL sends the connection's backup and restore events to
+	// this Discord webhook instead of the one of the settings; an empty
+	// string removes it
+	DiscordWebhookURL *string `json:"discord_webhook_url,omitempty"`
+	// HeartbeatURL is pinged when the schedule's runs start, succeed or
+	// fail; an empty string removes it
+	HeartbeatURL *string `json:"heartbeat_url,omitempty"`
 }
 
 // BackupStats represents backup statistics
@@ -96,7 +336,317 @@ type BackupListOptions struct {
 	Search string
 }
 
+// EncryptionVerification is the result of checking a backup's GPG recipients
+type EncryptionVerification struct {
+	BackupID              string `json:"backup_id"`
+	KeyFingerprint        string `json:"key_fingerprint"`
+	ConfiguredFingerprint string `json:"configured_fingerprint"`
+	Verified              bool   `json:"verified"`
+	Error                 string `json:"error,omitempty"`
+}
+
+// SignatureVerification is the result of checking a backup's checksum
+// signature against the instance signing key. SignedData is the sha256sum
+// line that was signed, so it can also be checked with `gpg --verify`.
+type SignatureVerification struct {
+	BackupID       string `json:"backup_id"`
+	Checksum       string `json:"checksum,omitempty"`
+	SignedData     string `json:"signed_data,omitempty"`
+	Signature      string `json:"signature,omitempty"`
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+	PublicKey      string `json:"public_key,omitempty"`
+	Status         string `json:"status"`
+	Error          string `json:"error,omitempty"`
+}
+
+// PreparedBackup is a physical MySQL backup with its incremental chain
+// applied, ready to be copied into a stopped server's data directory
+type PreparedBackup struct {
+	BackupID     string   `json:"backup_id"`
+	Chain        []string `json:"chain"`
+	Path         string   `json:"path"`
+	RestoreSteps []string `json:"restore_steps"`
+}
+
+// IntegrityVerification is the result of re-hashing a stored backup artifact
+type IntegrityVerification struct {
+	BackupID         string    `json:"backup_id"`
+	ExpectedChecksum string    `json:"expected_checksum"`
+	ActualChecksum   string    `json:"actual_checksum,omitempty"`
+	Status           string    `json:"status"`
+	VerifiedAt       time.Time `json:"verified_at"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// RestoreTableCheck compares a restored table with the source database
+type RestoreTableCheck struct {
+	Name         string `json:"name"`
+	SourceRows   *int64 `json:"source_rows"`
+	RestoredRows int64  `json:"restored_rows"`
+}
+
+// RestoreVerification records a test restore of a backup into a scratch database
+type RestoreVerification struct {
+	ID                  uuid.UUID           `json:"id"`
+	BackupID            string              `json:"backup_id"`
+	ScratchConnectionID string              `json:"scratch_connection_id"`
+	Status              string              `json:"status"`
+	Tables              []RestoreTableCheck `json:"tables"`
+	Warnings            []string            `json:"warnings"`
+	Error               string              `json:"error,omitempty"`
+	StartedAt           time.Time           `json:"started_at"`
+	CompletedAt         *time.Time          `json:"completed_at"`
+}
+
 type UpdateScheduleRequest struct {
-	CronSchedule  string `json:"cron_schedule"`
-	RetentionDays int    `json:"retention_days"`
+	CronSchedule       string             `json:"cron_schedule"`
+	RunAt              *time.Time         `json:"run_at,omitempty"`
+	Timezone           *string            `json:"timezone,omitempty"`
+	RetentionDays      int                `json:"retention_days"`
+	RetentionMaxBytes  *int64             `json:"retention_max_bytes,omitempty"`
+	GPGPublicKey       *string            `json:"gpg_public_key,omitempty"`
+	VerifyConnectionID *string            `json:"verify_connection_id,omitempty"`
+	CompressionCommand *string            `json:"compression_command,omitempty"`
+	StreamToStorage    *bool              `json:"stream_to_storage,omitempty"`
+	PgDumpJobs         *int               `json:"pg_dump_jobs,omitempty"`
+	DumpFilters        *DumpFilters       `json:"dump_filters,omitempty"`
+	ExtraDumpArgs      *string            `json:"extra_dump_args,omitempty"`
+	MongoDumpOptions   *MongoDumpOptions  `json:"mongo_dump_options,omitempty"`
+	PostProcessors     *PostProcessors    `json:"post_processors,omitempty"`
+	RedisSnapshot      *bool              `json:"redis_snapshot,omitempty"`
+	BandwidthLimitKBps *int               `json:"bandwidth_limit_kbps,omitempty"`
+	Deduplicate        *bool              `json:"deduplicate,omitempty"`
+	Priority           *string            `json:"priority,omitempty"`
+	ConcurrencyPolicy  *string            `json:"concurrency_policy,omitempty"`
+	TimeoutMinutes     *int               `json:"timeout_minutes,omitempty"`
+	JitterSeconds      *int               `json:"jitter_seconds,omitempty"`
+	RPOMinutes         *int               `json:"rpo_minutes,omitempty"`
+	SizeAnomalyPercent *int               `json:"size_anomaly_percent,omitempty"`
+	MaskingRules       *MaskingRules      `json:"masking_rules,omitempty"`
+	Sample             *SampleOptions     `json:"sample,omitempty"`
+	PhysicalBackup     *bool              `json:"physical_backup,omitempty"`
+	IncrementalBackups *int               `json:"incremental_backups,omitempty"`
+	AllDatabases       *bool              `json:"all_databases,omitempty"`
+	DatabaseWorkers    *int               `json:"database_workers,omitempty"`
+	Databases          *ScheduleDatabases `json:"databases,omitempty"`
+	RerunInterrupted   *bool              `json:"rerun_interrupted,omitempty"`
+	DiscordWebhookURL  *string            `json:"discord_webhook_url,omitempty"`
+	HeartbeatURL       *string            `json:"heartbeat_url,omitempty"`
+	CompressionLevel   *int               `json:"compression_level,omitempty"`
+	CompressionThreads *int               `json:"compression_threads,omitempty"`
+
+	VerificationObjectiveMinutes *int `json:"verification_objective_minutes,omitempty"`
+}
+
+// UploadPart is a part of a multipart upload that S3 has acknowledged
+type UploadPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+	Size   int64  `json:"size"`
+}
+
+// UploadJournal tracks a chunked upload so it can resume after a failure
+type UploadJournal struct {
+	BackupID       string       `json:"backup_id"`
+	ObjectKey      string       `json:"object_key"`
+	UploadID       string       `json:"-"`
+	PartSize       int64        `json:"part_size"`
+	TotalSize      int64        `json:"total_size"`
+	Parts          []UploadPart `json:"parts"`
+	UploadedBytes  int64        `json:"uploaded_bytes"`
+	PartsCompleted int          `json:"parts_completed"`
+	PartsTotal     int          `json:"parts_total"`
+	Progress       float64      `json:"progress"`
+	// ThroughputBytesPerSecond is measured while the upload is running
+	ThroughputBytesPerSecond float64   `json:"throughput_bytes_per_second"`
+	Status                   string    `json:"status"`
+	Attempts                 int       `json:"attempts"`
+	Error                    string    `json:"error,omitempty"`
+	CreatedAt                time.Time `json:"created_at"`
+	UpdatedAt                time.Time `json:"updated_at"`
+}
+
+// TransferProgress is the progress of a running dump stream or upload
+type TransferProgress struct {
+	BackupID                 string    `json:"backup_id"`
+	ConnectionID             string    `json:"connection_id"`
+	Kind                     string    `json:"kind"`
+	TransferredBytes         int64     `json:"transferred_bytes"`
+	ThroughputBytesPerSecond float64   `json:"throughput_bytes_per_second"`
+	ScheduleLimitKBps        int       `json:"schedule_limit_kbps"`
+	GlobalLimitKBps          int       `json:"global_limit_kbps"`
+	StartedAt                time.Time `json:"started_at"`
+}
+
+// CatalogTable is a table recorded in the catalog of a backup
+type CatalogTable struct {
+	Schema string `json:"schema,omitempty"`
+	Name   string `json:"name"`
+}
+
+// CatalogSearchOptions filters a backup catalog search. Table may contain *
+// wildcards.
+type CatalogSearchOptions struct {
+	UserID       uuid.UUID
+	ConnectionID string
+	Database     string
+	Tag          string
+	Table        string
+	From         *time.Time
+	To           *time.Time
+	Limit        int
+	Offset       int
+}
+
+// CatalogSearchResult is a backup found by a catalog search, with the tables
+// that matched the table filter
+type CatalogSearchResult struct {
+	BackupID       uuid.UUID      `json:"backup_id"`
+	ConnectionID   string         `json:"connection_id"`
+	ConnectionName string         `json:"connection_name"`
+	DatabaseType   string         `json:"database_type"`
+	DatabaseName   string         `json:"database_name"`
+	Status         string         `json:"status"`
+	Path           string         `json:"path"`
+	S3ObjectKey    *string        `json:"s3_object_key"`
+	Size           int64          `json:"size"`
+	CreatedAt      string         `json:"created_at"`
+	MatchedTables  []CatalogTable `json:"matched_tables,omitempty"`
+}
+
+// BackupSizeEstimate is the expected artifact size of the next backup of a
+// connection and whether the directories it writes to have room for it
+type BackupSizeEstimate struct {
+	ConnectionID  string           `json:"connection_id"`
+	DatabaseSizes map[string]int64 `json:"database_sizes"`
+	DatabaseSize  int64            `json:"database_size"`
+	// Ratio is the average artifact to database size of previous backups
+	Ratio         float64      `json:"ratio"`
+	RatioSamples  int          `json:"ratio_samples"`
+	EstimatedSize int64        `json:"estimated_size"`
+	Streamed      bool         `json:"streamed"`
+	Locations     []SpaceCheck `json:"locations"`
+	Sufficient    bool         `json:"sufficient"`
+}
+
+// SpaceCheck compares the free space of a directory with what a backup needs
+type SpaceCheck struct {
+	Path       string `json:"path"`
+	Purpose    string `json:"purpose"`
+	Required   uint64 `json:"required"`
+	Free       uint64 `json:"free"`
+	Sufficient bool   `json:"sufficient"`
+}
+
+// BackupChunk is one content-defined chunk of a deduplicated artifact
+type BackupChunk struct {
+	Seq        int    `json:"seq"`
+	Hash       string `json:"hash"`
+	Size       int64  `json:"size"`
+	StoredSize int64  `json:"stored_size"`
+}
+
+// DedupStats summarizes how much the chunk store saves for a user's backups
+type DedupStats struct {
+	Backups int `json:"backups"`
+	Chunks  int `json:"chunks"`
+	// LogicalSize is the total size of the deduplicated artifacts
+	LogicalSize int64 `json:"logical_size"`
+	// StoredSize is the disk space of the distinct chunks they reference
+	StoredSize int64   `json:"stored_size"`
+	Ratio      float64 `json:"ratio"`
+}
+
+// ScheduleSimulationRequest describes a schedule to preview before saving it
+type ScheduleSimulationRequest struct {
+	CronSchedule string `json:"cron_schedule"`
+	// Timezone is an IANA name such as "Europe/Amsterdam" the schedule runs
+	// in; defaults to the server's local time zone
+	Timezone        string           `json:"timezone,omitempty"`
+	Days            int              `json:"days,omitempty"`
+	BlackoutWindows []BlackoutWindow `json:"blackout_windows,omitempty"`
+	// JitterSeconds delays each run by up to that many seconds
+	JitterSeconds int `json:"jitter_seconds,omitempty"`
+}
+
+// BlackoutWindow is a daily time range, in HH:MM, in which runs are skipped.
+// An end before the start continues past midnight.
+type BlackoutWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Days limits the window to weekdays such as "mon" or "sat"; empty means
+	// every day
+	Days []string `json:"days,omitempty"`
+}
+
+// SimulatedRun is one run time of a simulated schedule
+type SimulatedRun struct {
+	Time time.Time `json:"time"`
+	// Latest is the latest start once jitter is applied
+	Latest  *time.Time `json:"latest,omitempty"`
+	Skipped bool       `json:"skipped"`
+	Reason  string     `json:"reason,omitempty"`
+}
+
+// ScheduleSimulation lists the run times of a schedule over the next days
+type ScheduleSimulation struct {
+	Timezone    string         `json:"timezone"`
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	Runs        []SimulatedRun `json:"runs"`
+	TotalRuns   int            `json:"total_runs"`
+	SkippedRuns int            `json:"skipped_runs"`
+	// Truncated is set when the schedule has more runs than are listed;
+	// the totals then only cover the listed runs
+	Truncated bool `json:"truncated"`
+}
+
+// PresignUploadRequest asks for a URL to upload an artifact produced outside
+// the API server straight to S3
+type PresignUploadRequest struct {
+	ConnectionID string `json:"connection_id"`
+	FileName     string `json:"file_name"`
+}
+
+// PresignedUpload is a pre-signed S3 PUT for one artifact
+type PresignedUpload struct {
+	ObjectKey string    `json:"object_key"`
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CompleteUploadRequest registers an artifact uploaded with a pre-signed URL
+// as a backup
+type CompleteUploadRequest struct {
+	ConnectionID string  `json:"connection_id"`
+	ObjectKey    string  `json:"object_key"`
+	DatabaseName *string `json:"database_name,omitempty"`
+	// Checksum is the SHA-256 of the artifact in hex, used by integrity
+	// verification
+	Checksum *string `json:"checksum,omitempty"`
+}
+
+// ConnectionFreshness is the age of a connection's newest successful backup
+// against its recovery point objective
+type ConnectionFreshness struct {
+	ConnectionID string     `json:"connection_id"`
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	LastBackupAt *time.Time `json:"last_backup_at"`
+	// AgeSeconds is null when the connection has no successful backup
+	AgeSeconds *int64 `json:"age_seconds"`
+	// RPOSeconds is null when no RPO is configured
+	RPOSeconds *int64 `json:"rpo_seconds"`
+	Violated   bool   `json:"violated"`
+	// Paused connections are listed but never violate their RPO
+	Paused bool `json:"paused,omitempty"`
+}
+
+// BackupFreshness reports the freshness of every scheduled connection
+type BackupFreshness struct {
+	Status      string                 `json:"status"`
+	CheckedAt   time.Time              `json:"checked_at"`
+	Violations  int                    `json:"violations"`
+	Connections []*ConnectionFreshness `json:"connections"`
 }
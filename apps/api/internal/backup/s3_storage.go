@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -98,10 +100,15 @@ func (s *S3Storage) UploadFileWithPath(ctx context.Context, localPath string, su
 		return "", fmt.Errorf("failed to stat file: %w", err)
 	}
 
-	fileName := filepath.Base(localPath)
+	return s.UploadReaderWithPath(ctx, file, fileInfo.Size(), filepath.Base(localPath), subfolder)
+}
+
+// UploadReaderWithPath uploads size bytes from reader to S3 with a custom
+// subfolder path
+func (s *S3Storage) UploadReaderWithPath(ctx context.Context, reader io.Reader, size int64, fileName string, subfolder string) (string, error) {
 	objectKey := s.getObjectKeyWithPath(fileName, subfolder)
 
-	_, err = s.client.PutObject(ctx, s.bucket, objectKey, file, fileInfo.Size(), minio.PutObjectOptions{
+	_, err := s.client.PutObject(ctx, s.bucket, objectKey, reader, size, minio.PutObjectOptions{
 		ContentType: "application/octet-stream",
 	})
 	if err != nil {
@@ -111,6 +118,75 @@ func (s *S3Storage) UploadFileWithPath(ctx context.Context, localPath string, su
 	return objectKey, nil
 }
 
+// UploadStream uploads data of unknown length to S3 as a multipart upload.
+// Only one part is buffered in memory at a time.
+func (s *S3Storage) UploadStream(ctx context.Context, reader io.Reader, fileName string, subfolder string, partSize uint64) (string, error) {
+	objectKey := s.getObjectKeyWithPath(fileName, subfolder)
+
+	_, err := s.client.PutObject(ctx, s.bucket, objectKey, reader, -1, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    partSize,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload to S3: %w", err)
+	}
+
+	return objectKey, nil
+}
+
+// StartMultipartUpload begins a multipart upload and returns its upload ID
+func (s *S3Storage) StartMultipartUpload(ctx context.Context, objectKey string) (string, error) {
+	core := minio.Core{Client: s.client}
+	uploadID, err := core.NewMultipartUpload(ctx, s.bucket, objectKey, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	return uploadID, nil
+}
+
+// UploadPart uploads a single part of a multipart upload and returns its ETag
+func (s *S3Storage) UploadPart(ctx context.Context, objectKey, uploadID string, partNumber int, reader io.Reader, size int64) (string, error) {
+	core := minio.Core{Client: s.client}
+	part, err := core.PutObjectPart(ctx, s.bucket, objectKey, uploadID, partNumber, reader, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+	}
+	return part.ETag, nil
+}
+
+func (s *S3Storage) CompleteMultipartUpload(ctx context.Context, objectKey, uploadID string, parts []UploadPart) error {
+	completeParts := make([]minio.CompletePart, len(parts))
+	for i, part := range parts {
+		completeParts[i] = minio.CompletePart{PartNumber: part.Number, ETag: part.ETag}
+	}
+
+	core := minio.Core{Client: s.client}
+	_, err := core.CompleteMultipartUpload(ctx, s.bucket, objectKey, uploadID, completeParts, minio.PutObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Storage) AbortMultipartUpload(ctx context.Context, objectKey, uploadID string) error {
+	core := minio.Core{Client: s.client}
+	if err := core.AbortMultipartUpload(ctx, s.bucket, objectKey, uploadID); err != nil {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
+	return nil
+}
+
+// RemoveIncompleteUpload aborts the unfinished uploads of an object and
+// drops their parts
+func (s *S3Storage) RemoveIncompleteUpload(ctx context.Context, objectKey string) error {
+	if err := s.client.RemoveIncompleteUpload(ctx, s.bucket, objectKey); err != nil {
+		return fmt.Errorf("failed to remove incomplete upload: %w", err)
+	}
+	return nil
+}
+
 func (s *S3Storage) DownloadFile(ctx context.Context, objectKey, localPath string) error {
 	object, err := s.client.GetObject(ctx, s.bucket, objectKey, minio.GetObjectOptions{})
 	if err != nil {
@@ -132,6 +208,24 @@ func (s *S3Storage) DownloadFile(ctx context.Context, objectKey, localPath strin
 	return nil
 }
 
+// OpenFile opens an object for reading. The object fetches what is read or
+// seeked to with ranged requests, so it can be served to HTTP range requests
+// without downloading it first.
+func (s *S3Storage) OpenFile(ctx context.Context, objectKey string) (io.ReadSeekCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object from S3: %w", err)
+	}
+
+	// GetObject is lazy; a missing object fails here, before anything is sent
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	return object, nil
+}
+
 func (s *S3Storage) DeleteFile(ctx context.Context, objectKey string) error {
 	err := s.client.RemoveObject(ctx, s.bucket, objectKey, minio.RemoveObjectOptions{})
 	if err != nil {
@@ -158,6 +252,32 @@ func (s *S3Storage) ListFiles(ctx context.Context) ([]string, error) {
 	return files, nil
 }
 
+// StoredObject is an object listed in the bucket
+type StoredObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListObjects lists the objects under the prefix with their size and age
+func (s *S3Storage) ListObjects(ctx context.Context) ([]StoredObject, error) {
+	var objects []StoredObject
+
+	opts := minio.ListObjectsOptions{
+		Prefix:    s.prefix,
+		Recursive: true,
+	}
+
+	for object := range s.client.ListObjects(ctx, s.bucket, opts) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		objects = append(objects, StoredObject{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+	}
+
+	return objects, nil
+}
+
 func (s *S3Storage) GetFileSize(ctx context.Context, objectKey string) (int64, error) {
 	info, err := s.client.StatObject(ctx, s.bucket, objectKey, minio.StatObjectOptions{})
 	if err != nil {
@@ -166,6 +286,16 @@ func (s *S3Storage) GetFileSize(ctx context.Context, objectKey string) (int64, e
 	return info.Size, nil
 }
 
+// PresignUpload returns a URL that accepts a single PUT of the object for the
+// given time, so the bytes do not pass through the API server
+func (s *S3Storage) PresignUpload(ctx context.Context, objectKey string, expiry time.Duration) (*url.URL, error) {
+	presigned, err := s.client.PresignedPutObject(ctx, s.bucket, objectKey, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload: %w", err)
+	}
+	return presigned, nil
+}
+
 func (s *S3Storage) TestConnection(ctx context.Context) error {
 	exists, err := s.client.BucketExists(ctx, s.bucket)
 	if err != nil {
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// envFiles are the .env locations, earlier files take precedence
+var envFiles = []string{"../../.env", ".env"}
+
+// reloadExcludedEnv are read once at startup; changing them requires a restart
+var reloadExcludedEnv = map[string]bool{
+	"JWT_SECRET":     true,
+	"ENCRYPTION_KEY": true,
+	"DB_PATH":        true,
+}
+
+// processEnv holds the variables set by the real environment before any .env
+// file was loaded. Like godotenv.Load, reloading never overrides them.
+var processEnv map[string]bool
+
+func loadEnvFiles() {
+	processEnv = make(map[string]bool)
+	for _, entry := range os.Environ() {
+		if key, _, ok := strings.Cut(entry, "="); ok {
+			processEnv[key] = true
+		}
+	}
+
+	for _, file := range envFiles {
+		_ = godotenv.Load(file)
+	}
+}
+
+// ReloadEnv re-reads the .env files and applies changed values to the process
+// environment. It returns the names of the variables that changed.
+func ReloadEnv() []string {
+	values := make(map[string]string)
+	for _, file := range envFiles {
+		fileValues, err := godotenv.Read(file)
+		if err != nil {
+			continue
+		}
+		for key, value := range fileValues {
+			if _, exists := values[key]; !exists {
+				values[key] = value
+			}
+		}
+	}
+
+	changed := []string{}
+	for key, value := range values {
+		if reloadExcludedEnv[key] || processEnv[key] {
+			continue
+		}
+		if current, ok := os.LookupEnv(key); ok && current == value {
+			continue
+		}
+		os.Setenv(key, value)
+		changed = append(changed, key)
+	}
+
+	sort.Strings(changed)
+	return changed
+}
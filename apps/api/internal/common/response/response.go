@@ -16,6 +16,7 @@ type Response struct {
 	Message    string      `json:"message"`
 	Data       interface{} `json:"data,omitempty"`
 	Pagination *Pagination `json:"pagination,omitempty"`
+	Errors     interface{} `json:"errors,omitempty"`
 }
 
 func SendSuccess(w http.ResponseWriter, message string, data interface{}) {
@@ -50,3 +51,13 @@ func SendError(w http.ResponseWriter, code int, message string) {
 		Message: message,
 	})
 }
+
+// SendValidationError reports field-level validation errors with a 400 status
+func SendValidationError(w http.ResponseWriter, message string, errors interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(Response{
+		Message: message,
+		Errors:  errors,
+	})
+}
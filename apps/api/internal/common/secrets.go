@@ -7,8 +7,6 @@ import (
 	"os"
 	"strings"
 	"sync"
-
-	"github.com/joho/godotenv"
 )
 
 type Secrets struct {
@@ -17,6 +15,7 @@ type Secrets struct {
 	AdminUsernameCredential string
 	AdminPasswordCredential string
 	IsAllowSignup           bool
+	MonitoringToken         string
 }
 
 var once sync.Once
@@ -30,8 +29,7 @@ func GetSecrets() *Secrets {
 }
 
 func loadSecrets() *Secrets {
-	_ = godotenv.Load("../../.env")
-	_ = godotenv.Load(".env")
+	loadEnvFiles()
 
 	jwtSecret, err := getRequiredSecret("JWT_SECRET")
 	if err != nil {
@@ -44,6 +42,10 @@ func loadSecrets() *Secrets {
 	}
 
 	if err := validateEncryptionKey(encryptionKey); err != nil {
+		log.Fatal(fmt.Errorf("%v%s", err, swappedSecretsHint(jwtSecret)))
+	}
+
+	if err := enforceSecretStrength(jwtSecret, encryptionKey); err != nil {
 		log.Fatal(err)
 	}
 
@@ -53,12 +55,16 @@ func loadSecrets() *Secrets {
 
 	isAllowSignup := getWithDefault("ALLOW_REGISTER", "true")
 
+	// Optional token for external monitoring checks
+	monitoringToken := strings.TrimSpace(os.Getenv("MONITORING_TOKEN"))
+
 	return &Secrets{
 		JWTSecret:               jwtSecret,
 		EncryptionKey:           encryptionKey,
 		AdminUsernameCredential: adminUsernameCredential,
 		AdminPasswordCredential: adminPasswordCredential,
 		IsAllowSignup:           strings.ToLower(isAllowSignup) == "true",
+		MonitoringToken:         monitoringToken,
 	}
 }
 
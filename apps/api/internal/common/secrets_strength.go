@@ -0,0 +1,135 @@
+package common
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+)
+
+// Secret strength policies controlled by the SECRETS_POLICY env var
+const (
+	SecretsPolicyOff    = "off"
+	SecretsPolicyWarn   = "warn"
+	SecretsPolicyStrict = "strict"
+)
+
+const (
+	minJWTSecretLength = 32
+	// minSecretEntropyBits is what a secret's characters must carry, judged by
+	// their distribution. The estimate of 16 random bytes in hex is about 118
+	// bits, of 32 random bytes about 240.
+	minSecretEntropyBits = 96
+)
+
+// knownDefaultSecrets are placeholders from .env.example and common
+// tutorials, which are the first values anyone forging a token tries
+var knownDefaultSecrets = map[string]bool{
+	"your-super-secret-jwt-key-here-use-openssl-rand-hex-32": true,
+	"your-64-char-hex-key-here-use-openssl-rand-hex-32":      true,
+	"secret":          true,
+	"jwt-secret":      true,
+	"jwt_secret":      true,
+	"jwtsecret":       true,
+	"your-secret-key": true,
+	"supersecret":     true,
+	"changeme":        true,
+	"change-me":       true,
+	"password":        true,
+}
+
+// GetSecretsPolicy returns the configured secret strength policy, defaulting
+// to warn
+func GetSecretsPolicy() string {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("SECRETS_POLICY"))) {
+	case SecretsPolicyOff:
+		return SecretsPolicyOff
+	case SecretsPolicyStrict:
+		return SecretsPolicyStrict
+	default:
+		return SecretsPolicyWarn
+	}
+}
+
+// enforceSecretStrength logs the weaknesses of the JWT secret and encryption
+// key, or refuses them when SECRETS_POLICY is strict.
+func enforceSecretStrength(jwtSecret, encryptionKey string) error {
+	policy := GetSecretsPolicy()
+	if policy == SecretsPolicyOff {
+		return nil
+	}
+
+	problems := checkSecretStrength(jwtSecret, encryptionKey)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	if policy == SecretsPolicyStrict {
+		return fmt.Errorf("[ERROR] Weak secrets refused by SECRETS_POLICY=strict:\n  - %s\n"+
+			"Generate strong values with: openssl rand -hex 32", strings.Join(problems, "\n  - "))
+	}
+
+	for _, problem := range problems {
+		slog.Warn(problem + ". Generate a strong value with: openssl rand -hex 32")
+	}
+	return nil
+}
+
+// checkSecretStrength returns what makes the secrets guessable
+func checkSecretStrength(jwtSecret, encryptionKey string) []string {
+	var problems []string
+
+	switch {
+	case knownDefaultSecrets[strings.ToLower(jwtSecret)]:
+		problems = append(problems, "JWT_SECRET is a well-known default value")
+	case len(jwtSecret) < minJWTSecretLength:
+		problems = append(problems, fmt.Sprintf("JWT_SECRET is %d characters long, use at least %d", len(jwtSecret), minJWTSecretLength))
+	case secretEntropyBits(jwtSecret) < minSecretEntropyBits:
+		problems = append(problems, "JWT_SECRET is low-entropy, it repeats too few distinct characters")
+	}
+
+	if knownDefaultSecrets[strings.ToLower(encryptionKey)] {
+		problems = append(problems, "ENCRYPTION_KEY is a well-known default value")
+	} else if secretEntropyBits(encryptionKey) < minSecretEntropyBits {
+		problems = append(problems, "ENCRYPTION_KEY is low-entropy, it repeats too few distinct characters")
+	}
+
+	if jwtSecret == encryptionKey {
+		problems = append(problems, "JWT_SECRET and ENCRYPTION_KEY are the same value, a leak of one exposes both")
+	}
+
+	return problems
+}
+
+// secretEntropyBits estimates the entropy of a secret from the distribution
+// of its characters. It cannot tell a random string from a memorable one of
+// the same distribution, but catches repeated and patterned values.
+func secretEntropyBits(secret string) float64 {
+	if secret == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range secret {
+		counts[r]++
+		total++
+	}
+
+	var perChar float64
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		perChar -= p * math.Log2(p)
+	}
+	return perChar * float64(total)
+}
+
+// swappedSecretsHint explains an invalid ENCRYPTION_KEY when JWT_SECRET holds
+// what looks like the encryption key
+func swappedSecretsHint(jwtSecret string) string {
+	if validateEncryptionKey(jwtSecret) != nil {
+		return ""
+	}
+	return "\nJWT_SECRET holds a valid encryption key, JWT_SECRET and ENCRYPTION_KEY may have been swapped."
+}
@@ -15,6 +15,9 @@ import (
 	"github.com/google/uuid"
 )
 
+// Version is the velld release reported by the API and recorded with backups
+const Version = "v0.1.0"
+
 func ParseTime(timeStr string) (time.Time, error) {
 	formats := []string{
 		time.RFC3339,                // "2006-01-02T15:04:05Z07:00"
@@ -2,7 +2,7 @@ package connection
 
 import (
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/dendianugerah/velld/internal/common"
@@ -36,10 +36,14 @@ func (h *ConnectionHandler) TestConnection(w http.ResponseWriter, r *http.Reques
 
 	isConnected, err := h.service.TestConnection(config)
 	if err != nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{
+		result := map[string]interface{}{
 			"isConnected": false,
 			"error":       err.Error(),
-		})
+		}
+		if validationErr, ok := AsValidationError(err); ok {
+			result["errors"] = validationErr.Errors
+		}
+		json.NewEncoder(w).Encode(result)
 		return
 	}
 
@@ -64,6 +68,10 @@ func (h *ConnectionHandler) SaveConnection(w http.ResponseWriter, r *http.Reques
 
 	storedConn, err := h.service.SaveConnection(config, userID)
 	if err != nil {
+		if validationErr, ok := AsValidationError(err); ok {
+			response.SendValidationError(w, "Invalid connection", validationErr.Errors)
+			return
+		}
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -97,6 +105,9 @@ func (h *ConnectionHandler) GetConnection(w http.ResponseWriter, r *http.Request
 		response.SendError(w, http.StatusBadRequest, "connection id is required")
 		return
 	}
+	if !h.requireAccess(w, r, id) {
+		return
+	}
 
 	connection, err := h.service.GetConnection(id)
 	if err != nil {
@@ -122,6 +133,10 @@ func (h *ConnectionHandler) UpdateConnection(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if !h.requireAccess(w, r, config.ID) {
+		return
+	}
+
 	// Get existing connection to check if name changed
 	existingConn, err := h.service.GetConnection(config.ID)
 	if err != nil {
@@ -131,6 +146,10 @@ func (h *ConnectionHandler) UpdateConnection(w http.ResponseWriter, r *http.Requ
 
 	storedConn, err := h.service.UpdateConnection(config, userID)
 	if err != nil {
+		if validationErr, ok := AsValidationError(err); ok {
+			response.SendValidationError(w, "Invalid connection", validationErr.Errors)
+			return
+		}
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -138,7 +157,7 @@ func (h *ConnectionHandler) UpdateConnection(w http.ResponseWriter, r *http.Requ
 	// Rename S3 folder if connection name changed
 	if existingConn.Name != config.Name && h.backupService != nil {
 		if err := h.backupService.RenameS3FolderForConnection(config.ID, existingConn.Name, config.Name); err != nil {
-			fmt.Printf("Warning: Failed to rename S3 folder for connection %s: %v\n", config.ID, err)
+			slog.Warn("Failed to rename S3 folder for connection", "connection_id", config.ID, "error", err)
 			// Continue even if S3 rename fails
 		}
 	}
@@ -155,6 +174,9 @@ func (h *ConnectionHandler) UpdateConnectionSettings(w http.ResponseWriter, r *h
 		response.SendError(w, http.StatusBadRequest, "connection id is required")
 		return
 	}
+	if !h.requireAccess(w, r, id) {
+		return
+	}
 
 	var req struct {
 		S3CleanupOnRetention *bool `json:"s3_cleanup_on_retention"`
@@ -181,6 +203,9 @@ func (h *ConnectionHandler) DeleteConnection(w http.ResponseWriter, r *http.Requ
 		response.SendError(w, http.StatusBadRequest, "connection id is required")
 		return
 	}
+	if !h.requireManage(w, r, id) {
+		return
+	}
 
 	// Check if cleanup_s3 query parameter is provided
 	cleanupS3 := r.URL.Query().Get("cleanup_s3") == "true"
@@ -188,7 +213,7 @@ func (h *ConnectionHandler) DeleteConnection(w http.ResponseWriter, r *http.Requ
 	// Cleanup S3 backups if requested
 	if cleanupS3 && h.backupService != nil {
 		if err := h.backupService.CleanupS3BackupsForConnection(id); err != nil {
-			fmt.Printf("Warning: Failed to cleanup S3 backups for connection %s: %v\n", id, err)
+			slog.Warn("Failed to clean up S3 backups for connection", "connection_id", id, "error", err)
 			// Continue with connection deletion even if S3 cleanup fails
 		}
 	}
@@ -209,6 +234,9 @@ func (h *ConnectionHandler) DiscoverDatabases(w http.ResponseWriter, r *http.Req
 		response.SendError(w, http.StatusBadRequest, "connection id is required")
 		return
 	}
+	if !h.requireAccess(w, r, id) {
+		return
+	}
 
 	databases, err := h.service.DiscoverDatabases(id)
 	if err != nil {
@@ -231,6 +259,9 @@ func (h *ConnectionHandler) UpdateSelectedDatabases(w http.ResponseWriter, r *ht
 		response.SendError(w, http.StatusBadRequest, "connection id is required")
 		return
 	}
+	if !h.requireAccess(w, r, id) {
+		return
+	}
 
 	var req struct {
 		Databases []string `json:"databases"`
@@ -250,3 +281,73 @@ func (h *ConnectionHandler) UpdateSelectedDatabases(w http.ResponseWriter, r *ht
 		"message": "Selected databases updated successfully",
 	})
 }
+
+func (h *ConnectionHandler) CheckDumpPrivileges(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		response.SendError(w, http.StatusBadRequest, "connection id is required")
+		return
+	}
+	if !h.requireAccess(w, r, id) {
+		return
+	}
+
+	check, err := h.service.CheckDumpPrivileges(id)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Privilege check completed", check)
+}
+
+func (h *ConnectionHandler) CheckCredentials(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		response.SendError(w, http.StatusBadRequest, "connection id is required")
+		return
+	}
+	if !h.requireAccess(w, r, id) {
+		return
+	}
+
+	check, err := h.service.CheckCredentials(id)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Credential check completed", check)
+}
+
+func (h *ConnectionHandler) UpdateTags(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	if id == "" {
+		response.SendError(w, http.StatusBadRequest, "connection id is required")
+		return
+	}
+	if !h.requireAccess(w, r, id) {
+		return
+	}
+
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.UpdateTags(id, req.Tags); err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Connection tags updated successfully", nil)
+}
@@ -0,0 +1,141 @@
+package connection
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+)
+
+// Roles of a user on a connection
+const (
+	RoleOwner = "owner"
+	// RoleTeamAdmin manages the team the connection is shared with and may
+	// delete it or move it to another team
+	RoleTeamAdmin = "admin"
+	// RoleTeamMember uses the connection, its schedules and its backups
+	RoleTeamMember = "member"
+)
+
+// AccessibleConnections selects the IDs of the connections the user $1
+// owns or shares through a team they are a member of
+const AccessibleConnections = `SELECT id FROM connections
+	WHERE user_id = $1 OR team_id IN (SELECT team_id FROM team_members WHERE user_id = $1)`
+
+// Role returns the role of the user on the connection: its owner, their
+// role in the team it is shared with, or "" without access
+func (r *ConnectionRepository) Role(conn *StoredConnection, userID uuid.UUID) string {
+	if conn.UserID == userID {
+		return RoleOwner
+	}
+	if conn.TeamID == nil {
+		return ""
+	}
+
+	var role string
+	err := r.db.QueryRow(`SELECT role FROM team_members WHERE team_id = $1 AND user_id = $2`,
+		*conn.TeamID, userID).Scan(&role)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Warn("Failed to check team membership", "team_id", *conn.TeamID, "error", err)
+		}
+		return ""
+	}
+	return role
+}
+
+// UsersWithAccess returns the owner of the connection and the members of
+// the team it is shared with
+func (r *ConnectionRepository) UsersWithAccess(conn *StoredConnection) []uuid.UUID {
+	users := []uuid.UUID{conn.UserID}
+	if conn.TeamID == nil {
+		return users
+	}
+
+	rows, err := r.db.Query(`SELECT user_id FROM team_members WHERE team_id = $1 AND user_id != $2`,
+		*conn.TeamID, conn.UserID)
+	if err != nil {
+		slog.Warn("Failed to list team members", "team_id", *conn.TeamID, "error", err)
+		return users
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID uuid.UUID
+		if err := rows.Scan(&userID); err != nil {
+			slog.Warn("Failed to read team member", "team_id", *conn.TeamID, "error", err)
+			return users
+		}
+		users = append(users, userID)
+	}
+	return users
+}
+
+// HasAccess tells whether the user owns the connection or is a member of
+// the team it is shared with
+func (r *ConnectionRepository) HasAccess(conn *StoredConnection, userID uuid.UUID) bool {
+	return r.Role(conn, userID) != ""
+}
+
+// CanManage tells whether the user owns the connection or administers the
+// team it is shared with
+func (r *ConnectionRepository) CanManage(conn *StoredConnection, userID uuid.UUID) bool {
+	role := r.Role(conn, userID)
+	return role == RoleOwner || role == RoleTeamAdmin
+}
+
+// GetAccessibleConnection returns a connection the user may use; others
+// are not found
+func (s *ConnectionService) GetAccessibleConnection(id string, userID uuid.UUID) (*StoredConnection, error) {
+	conn, err := s.repo.GetConnection(id)
+	if err != nil {
+		return nil, err
+	}
+	if !s.repo.HasAccess(conn, userID) {
+		return nil, sql.ErrNoRows
+	}
+	return conn, nil
+}
+
+// requireAccess answers the request unless the user may use the
+// connection; connections of others are not found
+func (h *ConnectionHandler) requireAccess(w http.ResponseWriter, r *http.Request, id string) bool {
+	_, ok := h.accessibleConnection(w, r, id)
+	return ok
+}
+
+// requireManage answers the request unless the user owns the connection
+// or administers its team
+func (h *ConnectionHandler) requireManage(w http.ResponseWriter, r *http.Request, id string) bool {
+	conn, ok := h.accessibleConnection(w, r, id)
+	if !ok {
+		return false
+	}
+	userID, _ := common.GetUserIDFromContext(r.Context())
+	if !h.service.repo.CanManage(conn, userID) {
+		response.SendError(w, http.StatusForbidden, "only the owner of the connection or an admin of its team can do this")
+		return false
+	}
+	return true
+}
+
+func (h *ConnectionHandler) accessibleConnection(w http.ResponseWriter, r *http.Request, id string) (*StoredConnection, bool) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	conn, err := h.service.GetAccessibleConnection(id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			response.SendError(w, http.StatusNotFound, "connection not found")
+		} else {
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return nil, false
+	}
+	return conn, true
+}
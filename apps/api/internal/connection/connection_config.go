@@ -241,6 +241,20 @@ func (cm *ConnectionManager) GetDatabaseSize(id string) (int64, error) {
 	}
 }
 
+// MeasureDatabaseSize connects to the configured database just to read its
+// current size
+func (cm *ConnectionManager) MeasureDatabaseSize(config ConnectionConfig) (int64, error) {
+	tempConfig := config
+	tempConfig.ID = "temp_size_" + config.ID
+
+	if err := cm.Connect(tempConfig); err != nil {
+		return 0, fmt.Errorf("failed to connect for size check: %w", err)
+	}
+	defer cm.Disconnect(tempConfig.ID)
+
+	return cm.GetDatabaseSize(tempConfig.ID)
+}
+
 func (cm *ConnectionManager) getSQLDatabaseSize(db *sql.DB) (int64, error) {
 	var query string
 
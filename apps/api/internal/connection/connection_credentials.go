@@ -0,0 +1,95 @@
+package connection
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Credential statuses recorded by credential checks
+const (
+	CredentialStatusValid       = "valid"
+	CredentialStatusInvalid     = "invalid"
+	CredentialStatusUnreachable = "unreachable"
+)
+
+// authFailureMarkers are fragments of the errors drivers return when the
+// server rejects the username or password, as opposed to being unreachable.
+var authFailureMarkers = []string{
+	"password authentication failed",
+	"authentication failed",
+	"access denied for user",
+	"wrongpass",
+	"noauth",
+	"invalid username-password pair",
+	"unable to authenticate",
+	"sqlstate 28p01",
+	"sqlstate 28000",
+	"error 1045",
+}
+
+// CredentialCheck is the outcome of probing a connection's stored credentials
+type CredentialCheck struct {
+	ConnectionID   string    `json:"connection_id"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// ProbeCredentials connects with the given config and disconnects again. The
+// connect itself authenticates, so no query is run against the database.
+func (cm *ConnectionManager) ProbeCredentials(config ConnectionConfig) error {
+	tempConfig := config
+	tempConfig.ID = "temp_credentials_" + config.ID
+
+	if err := cm.Connect(tempConfig); err != nil {
+		return err
+	}
+	cm.Disconnect(tempConfig.ID)
+	return nil
+}
+
+func isAuthFailure(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, marker := range authFailureMarkers {
+		if strings.Contains(message, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCredentials probes a stored connection's credentials and records the
+// result. Servers that cannot be reached say nothing about the credentials, so
+// they are recorded as unreachable rather than invalid.
+func (s *ConnectionService) CheckCredentials(id string) (*CredentialCheck, error) {
+	conn, err := s.repo.GetConnection(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	check := &CredentialCheck{
+		ConnectionID: conn.ID,
+		Status:       CredentialStatusValid,
+		CheckedAt:    time.Now(),
+	}
+	if conn.CredentialStatus != nil {
+		check.PreviousStatus = *conn.CredentialStatus
+	}
+
+	if err := s.manager.ProbeCredentials(configFromStoredConnection(conn)); err != nil {
+		check.Error = err.Error()
+		if isAuthFailure(err) {
+			check.Status = CredentialStatusInvalid
+		} else {
+			check.Status = CredentialStatusUnreachable
+		}
+	}
+
+	if err := s.repo.UpdateCredentialStatus(conn.ID, check.Status, check.Error, check.CheckedAt); err != nil {
+		return nil, fmt.Errorf("failed to record credential check: %w", err)
+	}
+
+	return check, nil
+}
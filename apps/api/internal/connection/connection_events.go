@@ -0,0 +1,22 @@
+package connection
+
+import (
+	"github.com/dendianugerah/velld/internal/events"
+)
+
+// publishEvent broadcasts a change to a connection to the event streams of
+// its owner and of the members of its team
+func (s *ConnectionService) publishEvent(eventType events.Type, conn *StoredConnection) {
+	if s.events == nil {
+		return
+	}
+	data := map[string]interface{}{
+		"connection_id":   conn.ID,
+		"connection_name": conn.Name,
+		"database_name":   conn.DatabaseName,
+		"database_type":   conn.Type,
+	}
+	for _, userID := range s.repo.UsersWithAccess(conn) {
+		s.events.Publish(userID, eventType, data)
+	}
+}
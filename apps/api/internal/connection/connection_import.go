@@ -0,0 +1,433 @@
+package connection
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/events"
+	"github.com/google/uuid"
+)
+
+// Supported connection export formats
+const (
+	ImportFormatPgAdmin = "pgadmin"
+	ImportFormatDBeaver = "dbeaver"
+)
+
+// Import outcomes reported per connection
+const (
+	ImportStatusImported = "imported"
+	ImportStatusSkipped  = "skipped"
+	ImportStatusInvalid  = "invalid"
+)
+
+// maxImportSize limits the size of an uploaded export file
+const maxImportSize = 5 << 20
+
+type ImportedConnection struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Host         string `json:"host"`
+	Port         int    `json:"port"`
+	Database     string `json:"database"`
+	Username     string `json:"username"`
+	Group        string `json:"group,omitempty"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+	ConnectionID string `json:"connection_id,omitempty"`
+}
+
+type ImportResult struct {
+	Format      string                `json:"format"`
+	DryRun      bool                  `json:"dry_run"`
+	Imported    int                   `json:"imported"`
+	Skipped     int                   `json:"skipped"`
+	Invalid     int                   `json:"invalid"`
+	Connections []*ImportedConnection `json:"connections"`
+}
+
+// importCandidate is a parsed connection plus the metadata velld keeps as tags
+type importCandidate struct {
+	config ConnectionConfig
+	group  string
+	reason string
+}
+
+// flexInt accepts numbers encoded either as JSON numbers or strings, as both
+// pgAdmin and DBeaver write ports inconsistently.
+type flexInt int
+
+func (f *flexInt) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "" || value == "null" {
+		*f = 0
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid number %s", data)
+	}
+	*f = flexInt(n)
+	return nil
+}
+
+type pgAdminExport struct {
+	Servers map[string]struct {
+		Name                 string  `json:"Name"`
+		Group                string  `json:"Group"`
+		Host                 string  `json:"Host"`
+		HostAddr             string  `json:"HostAddr"`
+		Port                 flexInt `json:"Port"`
+		MaintenanceDB        string  `json:"MaintenanceDB"`
+		Username             string  `json:"Username"`
+		SSLMode              string  `json:"SSLMode"`
+		UseSSHTunnel         flexInt `json:"UseSSHTunnel"`
+		TunnelHost           string  `json:"TunnelHost"`
+		TunnelPort           flexInt `json:"TunnelPort"`
+		TunnelUsername       string  `json:"TunnelUsername"`
+		TunnelAuthentication flexInt `json:"TunnelAuthentication"`
+	} `json:"Servers"`
+}
+
+// parsePgAdminServers parses a pgAdmin servers.json export. pgAdmin never
+// exports passwords, so they have to be filled in after the import.
+func parsePgAdminServers(data []byte) ([]*importCandidate, error) {
+	var export pgAdminExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid pgAdmin export: %v", err)
+	}
+
+	// Server IDs are numeric strings; keep the order they were exported in
+	ids := make([]string, 0, len(export.Servers))
+	for id := range export.Servers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, errA := strconv.Atoi(ids[i])
+		b, errB := strconv.Atoi(ids[j])
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return ids[i] < ids[j]
+	})
+
+	var candidates []*importCandidate
+	for _, id := range ids {
+		server := export.Servers[id]
+
+		host := server.Host
+		if host == "" {
+			host = server.HostAddr
+		}
+
+		candidate := &importCandidate{
+			config: ConnectionConfig{
+				Name:     server.Name,
+				Type:     "postgresql",
+				Host:     host,
+				Port:     int(server.Port),
+				Username: server.Username,
+				Database: server.MaintenanceDB,
+				SSL:      server.SSLMode == "require" || strings.HasPrefix(server.SSLMode, "verify"),
+			},
+			group: server.Group,
+		}
+
+		if server.UseSSHTunnel == 1 {
+			candidate.config.SSHEnabled = true
+			candidate.config.SSHHost = server.TunnelHost
+			candidate.config.SSHPort = int(server.TunnelPort)
+			candidate.config.SSHUsername = server.TunnelUsername
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, nil
+}
+
+type dbeaverExport struct {
+	Connections map[string]struct {
+		Provider      string `json:"provider"`
+		Driver        string `json:"driver"`
+		Name          string `json:"name"`
+		Folder        string `json:"folder"`
+		Configuration struct {
+			Host     string  `json:"host"`
+			Port     flexInt `json:"port"`
+			Database string  `json:"database"`
+			User     string  `json:"user"`
+			Handlers map[string]struct {
+				Enabled    bool `json:"enabled"`
+				Properties struct {
+					Host flexString `json:"host"`
+					Port flexInt    `json:"port"`
+					User flexString `json:"user"`
+				} `json:"properties"`
+			} `json:"handlers"`
+		} `json:"configuration"`
+	} `json:"connections"`
+}
+
+// flexString ignores non-string values instead of failing the whole import
+type flexString string
+
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*f = flexString(s)
+	}
+	return nil
+}
+
+// dbeaverTypes maps DBeaver provider IDs to velld connection types
+var dbeaverTypes = map[string]string{
+	"postgresql": "postgresql",
+	"mysql":      "mysql",
+	"mariadb":    "mariadb",
+	"mongodb":    "mongodb",
+	"redis":      "redis",
+}
+
+// parseDBeaverDataSources parses a DBeaver data-sources.json file. Credentials
+// live in DBeaver's encrypted credentials store and are not imported.
+func parseDBeaverDataSources(data []byte) ([]*importCandidate, error) {
+	var export dbeaverExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid DBeaver export: %v", err)
+	}
+
+	ids := make([]string, 0, len(export.Connections))
+	for id := range export.Connections {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var candidates []*importCandidate
+	for _, id := range ids {
+		source := export.Connections[id]
+		cfg := source.Configuration
+
+		candidate := &importCandidate{
+			config: ConnectionConfig{
+				Name:     source.Name,
+				Host:     cfg.Host,
+				Port:     int(cfg.Port),
+				Username: cfg.User,
+				Database: cfg.Database,
+			},
+			group: source.Folder,
+		}
+
+		dbType, ok := dbeaverTypes[strings.ToLower(source.Provider)]
+		if dbType == "mysql" && strings.Contains(strings.ToLower(source.Driver), "maria") {
+			dbType = "mariadb"
+		}
+		if !ok {
+			candidate.reason = fmt.Sprintf("unsupported DBeaver provider %q", source.Provider)
+		}
+		candidate.config.Type = dbType
+
+		if tunnel, ok := cfg.Handlers["ssh_tunnel"]; ok && tunnel.Enabled {
+			candidate.config.SSHEnabled = true
+			candidate.config.SSHHost = string(tunnel.Properties.Host)
+			candidate.config.SSHPort = int(tunnel.Properties.Port)
+			candidate.config.SSHUsername = string(tunnel.Properties.User)
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, nil
+}
+
+// detectImportFormat guesses the export format from its top-level keys
+func detectImportFormat(data []byte) (string, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return "", fmt.Errorf("import file is not valid JSON: %v", err)
+	}
+
+	if _, ok := probe["Servers"]; ok {
+		return ImportFormatPgAdmin, nil
+	}
+	if _, ok := probe["connections"]; ok {
+		return ImportFormatDBeaver, nil
+	}
+
+	return "", fmt.Errorf("unrecognized export format, expected a pgAdmin servers.json or DBeaver data-sources.json")
+}
+
+var defaultPorts = map[string]int{
+	"postgresql": 5432,
+	"mysql":      3306,
+	"mariadb":    3306,
+	"mongodb":    27017,
+	"redis":      6379,
+}
+
+// ImportConnections creates connections from a pgAdmin or DBeaver export.
+// Imported connections are stored without testing them, since the exports
+// carry no passwords. With dryRun nothing is saved.
+func (s *ConnectionService) ImportConnections(format string, data []byte, userID uuid.UUID, dryRun bool) (*ImportResult, error) {
+	if format == "" {
+		detected, err := detectImportFormat(data)
+		if err != nil {
+			return nil, err
+		}
+		format = detected
+	}
+
+	var candidates []*importCandidate
+	var err error
+	switch strings.ToLower(format) {
+	case ImportFormatPgAdmin:
+		candidates, err = parsePgAdminServers(data)
+	case ImportFormatDBeaver:
+		candidates, err = parseDBeaverDataSources(data)
+	default:
+		return nil, fmt.Errorf("unsupported import format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.ListByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connections: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, conn := range existing {
+		seen[importKey(conn.Type, conn.Host, conn.Name)] = true
+	}
+
+	result := &ImportResult{
+		Format:      strings.ToLower(format),
+		DryRun:      dryRun,
+		Connections: []*ImportedConnection{},
+	}
+
+	for _, candidate := range candidates {
+		config := candidate.config
+		if config.Port == 0 {
+			config.Port = defaultPorts[config.Type]
+		}
+		if config.SSHEnabled && config.SSHPort == 0 {
+			config.SSHPort = 22
+		}
+
+		entry := &ImportedConnection{
+			Name:     config.Name,
+			Type:     config.Type,
+			Host:     config.Host,
+			Port:     config.Port,
+			Database: config.Database,
+			Username: config.Username,
+			Group:    candidate.group,
+		}
+		result.Connections = append(result.Connections, entry)
+
+		validationErr := ValidateConnectionConfig(config)
+
+		switch {
+		case candidate.reason != "":
+			entry.Status = ImportStatusInvalid
+			entry.Reason = candidate.reason
+		case validationErr != nil:
+			entry.Status = ImportStatusInvalid
+			entry.Reason = validationErr.Error()
+		case seen[importKey(config.Type, config.Host, config.Name)]:
+			entry.Status = ImportStatusSkipped
+			entry.Reason = "a connection with this name and host already exists"
+		default:
+			entry.Status = ImportStatusImported
+		}
+
+		if entry.Status != ImportStatusImported {
+			if entry.Status == ImportStatusInvalid {
+				result.Invalid++
+			} else {
+				result.Skipped++
+			}
+			continue
+		}
+		seen[importKey(config.Type, config.Host, config.Name)] = true
+		result.Imported++
+
+		if dryRun {
+			continue
+		}
+
+		storedConn := StoredConnection{
+			ID:           uuid.New().String(),
+			Name:         config.Name,
+			Type:         config.Type,
+			Host:         config.Host,
+			Port:         config.Port,
+			Username:     config.Username,
+			DatabaseName: config.Database,
+			SSL:          config.SSL,
+			SSHEnabled:   config.SSHEnabled,
+			SSHHost:      config.SSHHost,
+			SSHPort:      config.SSHPort,
+			SSHUsername:  config.SSHUsername,
+			UserID:       userID,
+			Status:       "disconnected",
+		}
+
+		if err := s.repo.Save(storedConn); err != nil {
+			return nil, fmt.Errorf("failed to save connection %s: %v", config.Name, err)
+		}
+		entry.ConnectionID = storedConn.ID
+		s.publishEvent(events.TypeConnectionAdded, &storedConn)
+
+		if candidate.group != "" {
+			if err := s.repo.UpdateTags(storedConn.ID, []string{"group:" + candidate.group}); err != nil {
+				slog.Warn("Failed to tag imported connection", "connection", config.Name, "error", err)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func importKey(dbType, host, name string) string {
+	return strings.ToLower(dbType + "|" + host + "|" + name)
+}
+
+func (h *ConnectionHandler) ImportConnections(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxImportSize+1))
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) > maxImportSize {
+		response.SendError(w, http.StatusRequestEntityTooLarge, "import file is too large")
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	result, err := h.service.ImportConnections(r.URL.Query().Get("format"), data, userID, dryRun)
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Connections imported successfully", result)
+}
@@ -0,0 +1,330 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Privilege policies controlled by the BACKUP_PRIVILEGE_POLICY env var
+const (
+	PrivilegePolicyOff    = "off"
+	PrivilegePolicyWarn   = "warn"
+	PrivilegePolicyStrict = "strict"
+)
+
+// PrivilegeCheck describes whether a connection's user has exactly the
+// privileges needed to take a logical dump of its database.
+type PrivilegeCheck struct {
+	User        string   `json:"user"`
+	Database    string   `json:"database"`
+	IsSuperuser bool     `json:"is_superuser"`
+	Missing     []string `json:"missing"`
+	Excessive   []string `json:"excessive"`
+	Warnings    []string `json:"warnings"`
+	Compliant   bool     `json:"compliant"`
+	Policy      string   `json:"policy"`
+}
+
+// GetPrivilegePolicy returns the configured privilege policy, defaulting to warn
+func GetPrivilegePolicy() string {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("BACKUP_PRIVILEGE_POLICY"))) {
+	case PrivilegePolicyOff:
+		return PrivilegePolicyOff
+	case PrivilegePolicyStrict:
+		return PrivilegePolicyStrict
+	default:
+		return PrivilegePolicyWarn
+	}
+}
+
+// CheckDumpPrivileges connects with the given config and inspects the grants
+// of the authenticated user on the target database.
+func (cm *ConnectionManager) CheckDumpPrivileges(config ConnectionConfig) (*PrivilegeCheck, error) {
+	tempConfig := config
+	tempConfig.ID = "temp_privileges_" + config.ID
+
+	if err := cm.Connect(tempConfig); err != nil {
+		return nil, fmt.Errorf("failed to connect for privilege check: %w", err)
+	}
+	defer cm.Disconnect(tempConfig.ID)
+
+	conn, exists := cm.connections[tempConfig.ID]
+	if !exists {
+		return nil, fmt.Errorf("connection not found after connecting")
+	}
+
+	check := &PrivilegeCheck{
+		Database:  config.Database,
+		Missing:   []string{},
+		Excessive: []string{},
+		Warnings:  []string{},
+		Policy:    GetPrivilegePolicy(),
+	}
+
+	var err error
+	switch config.Type {
+	case "postgresql":
+		err = cm.checkPostgresPrivileges(conn.(*sql.DB), check)
+	case "mysql", "mariadb":
+		err = cm.checkMySQLPrivileges(conn.(*sql.DB), config.Database, check)
+	case "mongodb":
+		err = cm.checkMongoDBPrivileges(conn.(*mongo.Client), config.Database, check)
+	case "redis":
+		check.Warnings = append(check.Warnings, "privilege checks are not supported for Redis")
+	default:
+		return nil, fmt.Errorf("unsupported database type for privilege check: %s", config.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if check.IsSuperuser {
+		check.Warnings = append(check.Warnings,
+			fmt.Sprintf("backups are configured with superuser account '%s', use a dedicated read-only backup user", check.User))
+	}
+
+	check.Compliant = !check.IsSuperuser && len(check.Missing) == 0 && len(check.Excessive) == 0
+	return check, nil
+}
+
+func (cm *ConnectionManager) checkPostgresPrivileges(db *sql.DB, check *PrivilegeCheck) error {
+	var createRole, createDB, replication, bypassRLS bool
+	err := db.QueryRow(`
+		SELECT current_user, rolsuper, rolcreaterole, rolcreatedb, rolreplication, rolbypassrls
+		FROM pg_roles WHERE rolname = current_user`).
+		Scan(&check.User, &check.IsSuperuser, &createRole, &createDB, &replication, &bypassRLS)
+	if err != nil {
+		return fmt.Errorf("failed to read role attributes: %w", err)
+	}
+
+	if check.IsSuperuser {
+		check.Excessive = append(check.Excessive, "SUPERUSER")
+	}
+	if createRole {
+		check.Excessive = append(check.Excessive, "CREATEROLE")
+	}
+	if createDB {
+		check.Excessive = append(check.Excessive, "CREATEDB")
+	}
+	if replication {
+		check.Excessive = append(check.Excessive, "REPLICATION")
+	}
+	if bypassRLS && !check.IsSuperuser {
+		check.Warnings = append(check.Warnings, "role has BYPASSRLS, required only when tables use row level security")
+	}
+
+	// Superusers bypass all privilege checks, nothing more to inspect
+	if check.IsSuperuser {
+		return nil
+	}
+
+	rows, err := db.Query(`
+		SELECT n.nspname || '.' || c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p', 'v', 'm', 'S')
+		AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		AND n.nspname NOT LIKE 'pg_toast%'
+		AND (NOT has_schema_privilege(n.oid, 'USAGE') OR NOT has_table_privilege(c.oid, 'SELECT'))
+		ORDER BY 1
+		LIMIT 20`)
+	if err != nil {
+		return fmt.Errorf("failed to check table privileges: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var relation string
+		if err := rows.Scan(&relation); err != nil {
+			return err
+		}
+		check.Missing = append(check.Missing, fmt.Sprintf("SELECT on %s", relation))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var writable int
+	err = db.QueryRow(`
+		SELECT COUNT(*)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p')
+		AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		AND n.nspname NOT LIKE 'pg_toast%'
+		AND has_table_privilege(c.oid, 'INSERT, UPDATE, DELETE, TRUNCATE')`).Scan(&writable)
+	if err != nil {
+		return fmt.Errorf("failed to check write privileges: %w", err)
+	}
+	if writable > 0 {
+		check.Excessive = append(check.Excessive, fmt.Sprintf("write access to %d table(s)", writable))
+	}
+
+	return nil
+}
+
+var mysqlGrantPattern = regexp.MustCompile("(?i)^GRANT (.+) ON (\\S+) TO ")
+
+// mysqlDumpPrivileges are the privileges mysqldump needs for a consistent dump
+var mysqlDumpPrivileges = []string{"SELECT", "LOCK TABLES", "SHOW VIEW", "TRIGGER"}
+
+var mysqlExcessivePrivileges = []string{
+	"SUPER", "INSERT", "UPDATE", "DELETE", "DROP", "CREATE", "ALTER",
+	"CREATE USER", "GRANT OPTION", "FILE", "SHUTDOWN",
+}
+
+func (cm *ConnectionManager) checkMySQLPrivileges(db *sql.DB, database string, check *PrivilegeCheck) error {
+	if err := db.QueryRow("SELECT CURRENT_USER()").Scan(&check.User); err != nil {
+		return fmt.Errorf("failed to read current user: %w", err)
+	}
+
+	rows, err := db.Query("SHOW GRANTS FOR CURRENT_USER()")
+	if err != nil {
+		return fmt.Errorf("failed to read grants: %w", err)
+	}
+	defer rows.Close()
+
+	granted := make(map[string]bool)
+	dbScope := fmt.Sprintf("`%s`.*", database)
+
+	for rows.Next() {
+		var grant string
+		if err := rows.Scan(&grant); err != nil {
+			return err
+		}
+
+		match := mysqlGrantPattern.FindStringSubmatch(grant)
+		if match == nil {
+			continue
+		}
+
+		scope := match[2]
+		if scope != "*.*" && !strings.EqualFold(scope, dbScope) {
+			continue
+		}
+
+		if strings.Contains(strings.ToUpper(grant), "WITH GRANT OPTION") {
+			granted["GRANT OPTION"] = true
+		}
+
+		for _, privilege := range strings.Split(match[1], ",") {
+			privilege = strings.ToUpper(strings.TrimSpace(privilege))
+			if privilege == "ALL" || privilege == "ALL PRIVILEGES" {
+				if scope == "*.*" {
+					check.IsSuperuser = true
+				}
+				granted["ALL PRIVILEGES"] = true
+				continue
+			}
+			granted[privilege] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(check.User, "root@") {
+		check.IsSuperuser = true
+	}
+
+	if granted["ALL PRIVILEGES"] {
+		check.Excessive = append(check.Excessive, "ALL PRIVILEGES")
+		return nil
+	}
+
+	for _, privilege := range mysqlDumpPrivileges {
+		if !granted[privilege] {
+			check.Missing = append(check.Missing, privilege)
+		}
+	}
+
+	for _, privilege := range mysqlExcessivePrivileges {
+		if granted[privilege] {
+			check.Excessive = append(check.Excessive, privilege)
+		}
+	}
+
+	if granted["SUPER"] {
+		check.IsSuperuser = true
+	}
+
+	return nil
+}
+
+// mongoExcessiveRoles grant write or administrative access beyond what mongodump needs
+var mongoExcessiveRoles = map[string]bool{
+	"root":                 true,
+	"__system":             true,
+	"userAdminAnyDatabase": true,
+	"dbAdminAnyDatabase":   true,
+	"readWriteAnyDatabase": true,
+	"clusterAdmin":         true,
+	"restore":              true,
+	"dbOwner":              true,
+	"readWrite":            true,
+	"userAdmin":            true,
+	"dbAdmin":              true,
+}
+
+func (cm *ConnectionManager) checkMongoDBPrivileges(client *mongo.Client, database string, check *PrivilegeCheck) error {
+	ctx := context.Background()
+
+	var status struct {
+		AuthInfo struct {
+			AuthenticatedUsers []struct {
+				User string `bson:"user"`
+				DB   string `bson:"db"`
+			} `bson:"authenticatedUsers"`
+			AuthenticatedUserRoles []struct {
+				Role string `bson:"role"`
+				DB   string `bson:"db"`
+			} `bson:"authenticatedUserRoles"`
+		} `bson:"authInfo"`
+	}
+
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "connectionStatus", Value: 1}}).Decode(&status)
+	if err != nil {
+		return fmt.Errorf("failed to read connection status: %w", err)
+	}
+
+	if len(status.AuthInfo.AuthenticatedUsers) > 0 {
+		user := status.AuthInfo.AuthenticatedUsers[0]
+		check.User = fmt.Sprintf("%s@%s", user.User, user.DB)
+	} else {
+		check.Warnings = append(check.Warnings, "connection is not authenticated")
+	}
+
+	canRead := false
+	for _, role := range status.AuthInfo.AuthenticatedUserRoles {
+		switch {
+		case role.Role == "backup" && role.DB == "admin":
+			canRead = true
+		case role.Role == "readAnyDatabase":
+			canRead = true
+		case role.Role == "read" && (role.DB == database || database == ""):
+			canRead = true
+		}
+
+		if mongoExcessiveRoles[role.Role] {
+			if role.Role == "root" || role.Role == "__system" {
+				check.IsSuperuser = true
+			}
+			check.Excessive = append(check.Excessive, fmt.Sprintf("%s@%s", role.Role, role.DB))
+			// Write roles imply read access
+			canRead = true
+		}
+	}
+
+	if !canRead {
+		check.Missing = append(check.Missing, "backup@admin or read role on target database")
+	}
+
+	return nil
+}
@@ -2,6 +2,8 @@ package connection
 
 import (
 	"database/sql"
+	"strings"
+	"time"
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/google/uuid"
@@ -104,7 +106,7 @@ func (r *ConnectionRepository) GetConnection(id string) (*StoredConnection, erro
 	var conn StoredConnection
 	var encryptedUsername, encryptedPassword string
 	var encryptedSSHPassword, encryptedSSHPrivateKey sql.NullString
-	var selectedDatabasesStr sql.NullString
+	var selectedDatabasesStr, tagsStr sql.NullString
 	var sslInt, sshEnabledInt, s3CleanupInt int
 
 	query := `SELECT 
@@ -112,7 +114,9 @@ func (r *ConnectionRepository) GetConnection(id string) (*StoredConnection, erro
 		database_size, created_at, updated_at, last_connected_at, user_id, status,
 		ssh_enabled, ssh_host, ssh_port, ssh_username, ssh_password, ssh_private_key,
 		COALESCE(selected_databases, '') as selected_databases,
-		COALESCE(s3_cleanup_on_retention, 1) as s3_cleanup_on_retention
+		COALESCE(s3_cleanup_on_retention, 1) as s3_cleanup_on_retention,
+		COALESCE(tags, '') as tags,
+		credential_status, credential_checked_at, credential_error, team_id
 	FROM connections WHERE id = $1`
 
 	err := r.db.QueryRow(query, id).Scan(
@@ -139,6 +143,11 @@ func (r *ConnectionRepository) GetConnection(id string) (*StoredConnection, erro
 		&encryptedSSHPrivateKey,
 		&selectedDatabasesStr,
 		&s3CleanupInt,
+		&tagsStr,
+		&conn.CredentialStatus,
+		&conn.CredentialCheckedAt,
+		&conn.CredentialError,
+		&conn.TeamID,
 	)
 	if err != nil {
 		return nil, err
@@ -163,6 +172,8 @@ func (r *ConnectionRepository) GetConnection(id string) (*StoredConnection, erro
 		}
 	}
 
+	conn.Tags = splitTags(tagsStr.String)
+
 	conn.Username, err = r.crypto.Decrypt(encryptedUsername)
 	if err != nil {
 		return nil, err
@@ -265,7 +276,20 @@ func (r *ConnectionRepository) Update(conn StoredConnection) error {
 	return err
 }
 
+// ListByUserID lists the connections the user owns or shares through a team
 func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListItem, error) {
+	return r.listConnections(`c.id IN (`+AccessibleConnections+`)`, userID)
+}
+
+// ListOwnedByUserID lists the connections the user owns, leaving out those
+// shared with them
+func (r *ConnectionRepository) ListOwnedByUserID(userID uuid.UUID) ([]ConnectionListItem, error) {
+	return r.listConnections(`c.user_id = $1`, userID)
+}
+
+// listConnections lists the connections matching filter, a condition on
+// the user $1
+func (r *ConnectionRepository) listConnections(filter string, userID uuid.UUID) ([]ConnectionListItem, error) {
 	query := `
 		SELECT 
 			c.id,
@@ -278,7 +302,11 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 			COALESCE(bs.enabled, false) as backup_enabled,
 			bs.cron_schedule,
 			bs.retention_days,
-			COALESCE(c.s3_cleanup_on_retention, 1) as s3_cleanup_on_retention
+			CASE WHEN bs.id IS NULL THEN NULL WHEN bs.paused THEN 'paused' ELSE 'active' END as schedule_state,
+			COALESCE(c.s3_cleanup_on_retention, 1) as s3_cleanup_on_retention,
+			COALESCE(c.tags, '') as tags,
+			c.credential_status,
+			c.team_id
 		FROM connections c
 		LEFT JOIN backup_schedules bs ON c.id = bs.connection_id AND bs.enabled = true
 		LEFT JOIN backups b ON c.id = b.connection_id
@@ -287,8 +315,8 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 				FROM backups
 				WHERE connection_id = c.id
 			)
-		WHERE c.user_id = $1
-		GROUP BY c.id, c.name, c.type, c.host, c.status, c.database_size, b.completed_time, bs.enabled, bs.cron_schedule, bs.retention_days, c.s3_cleanup_on_retention
+		WHERE ` + filter + `
+		GROUP BY c.id, c.name, c.type, c.host, c.status, c.database_size, b.completed_time, bs.enabled, bs.cron_schedule, bs.retention_days, bs.id, bs.paused, c.s3_cleanup_on_retention, c.tags, c.credential_status, c.team_id
 	`
 
 	rows, err := r.db.Query(query, userID)
@@ -303,7 +331,9 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 		var lastBackupTime sql.NullString
 		var cronSchedule sql.NullString
 		var retentionDays sql.NullInt64
+		var scheduleState sql.NullString
 		var s3CleanupInt int
+		var tags string
 
 		err := rows.Scan(
 			&conn.ID,
@@ -316,7 +346,11 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 			&conn.BackupEnabled,
 			&cronSchedule,
 			&retentionDays,
+			&scheduleState,
 			&s3CleanupInt,
+			&tags,
+			&conn.CredentialStatus,
+			&conn.TeamID,
 		)
 		if err != nil {
 			return nil, err
@@ -328,11 +362,15 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 		if cronSchedule.Valid {
 			conn.CronSchedule = &cronSchedule.String
 		}
+		if scheduleState.Valid {
+			conn.ScheduleState = &scheduleState.String
+		}
 		if retentionDays.Valid {
 			days := int(retentionDays.Int64)
 			conn.RetentionDays = &days
 		}
 		conn.S3CleanupOnRetention = s3CleanupInt != 0
+		conn.Tags = splitTags(tags)
 
 		connections = append(connections, conn)
 	}
@@ -361,3 +399,45 @@ func (r *ConnectionRepository) UpdateSelectedDatabases(id string, databases []st
 	_, err := r.db.Exec(query, dbString, id)
 	return err
 }
+
+func (r *ConnectionRepository) UpdateTags(id string, tags []string) error {
+	query := `UPDATE connections SET tags = $1, updated_at = datetime('now') WHERE id = $2`
+	_, err := r.db.Exec(query, strings.Join(normalizeTags(tags), ","), id)
+	return err
+}
+
+// UpdateCredentialStatus records the outcome of the latest credential check.
+// An empty message clears the previous error.
+func (r *ConnectionRepository) UpdateCredentialStatus(id, status, message string, checkedAt time.Time) error {
+	var credentialError *string
+	if message != "" {
+		credentialError = &message
+	}
+
+	query := `UPDATE connections SET credential_status = $1, credential_checked_at = $2, credential_error = $3 WHERE id = $4`
+	_, err := r.db.Exec(query, status, checkedAt.Format(time.RFC3339), credentialError, id)
+	return err
+}
+
+// normalizeTags lowercases, trims and de-duplicates tags
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		tag = strings.ReplaceAll(tag, ",", "")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+func splitTags(tags string) []string {
+	if tags == "" {
+		return []string{}
+	}
+	return normalizeTags(strings.Split(tags, ","))
+}
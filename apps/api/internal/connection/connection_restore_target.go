@@ -0,0 +1,379 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CountDatabaseObjects returns the number of tables, views and sequences (or
+// collections) in the configured database, to detect restores over live data
+func (cm *ConnectionManager) CountDatabaseObjects(config ConnectionConfig) (int, error) {
+	tempConfig := config
+	tempConfig.ID = "temp_restore_" + config.ID
+	tempConfig.Type = driverType(config.Type)
+
+	if err := cm.Connect(tempConfig); err != nil {
+		return 0, fmt.Errorf("failed to connect to restore target: %w", err)
+	}
+	defer cm.Disconnect(tempConfig.ID)
+
+	var count int
+	switch c := cm.connections[tempConfig.ID].(type) {
+	case *sql.DB:
+		var err error
+		if config.Type == "postgresql" {
+			err = c.QueryRow(`
+				SELECT COUNT(*)
+				FROM pg_class c
+				JOIN pg_namespace n ON n.oid = c.relnamespace
+				WHERE c.relkind IN ('r', 'p', 'v', 'm', 'S', 'f')
+				AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+				AND n.nspname NOT LIKE 'pg_toast%'`).Scan(&count)
+		} else {
+			err = c.QueryRow(`
+				SELECT COUNT(*)
+				FROM information_schema.tables
+				WHERE table_schema = ?`, config.Database).Scan(&count)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to count database objects: %w", err)
+		}
+	case *mongo.Client:
+		names, err := userCollections(c.Database(config.Database))
+		if err != nil {
+			return 0, err
+		}
+		count = len(names)
+	default:
+		return 0, fmt.Errorf("restore target checks are not supported for %s", config.Type)
+	}
+
+	return count, nil
+}
+
+// ReplaceDatabase clears the configured database before a restore. With a
+// keepAs name the existing contents are moved to a database of that name;
+// without one they are dropped.
+func (cm *ConnectionManager) ReplaceDatabase(config ConnectionConfig, keepAs string) error {
+	name := config.Database
+	switch config.Type {
+	case "postgresql":
+		first := fmt.Sprintf(`DROP DATABASE %s`, quotePostgresIdent(name))
+		if keepAs != "" {
+			first = fmt.Sprintf(`ALTER DATABASE %s RENAME TO %s`, quotePostgresIdent(name), quotePostgresIdent(keepAs))
+		}
+		return cm.execOnServer(config, first, fmt.Sprintf(`CREATE DATABASE %s`, quotePostgresIdent(name)))
+	case "mysql", "mariadb":
+		if keepAs == "" {
+			return cm.execOnServer(config,
+				fmt.Sprintf("DROP DATABASE %s", quoteMySQLIdent(name)),
+				fmt.Sprintf("CREATE DATABASE %s", quoteMySQLIdent(name)))
+		}
+		return cm.withServerDB(config, func(db *sql.DB) error {
+			return moveMySQLTables(db, name, keepAs)
+		})
+	case "mongodb":
+		return cm.replaceMongoDatabase(config, keepAs)
+	default:
+		return fmt.Errorf("replacing databases is not supported for %s", config.Type)
+	}
+}
+
+// EnsureDatabase creates the configured database when the server does not
+// have it yet, so a backup can be restored into a new database. It reports
+// whether the database was created.
+func (cm *ConnectionManager) EnsureDatabase(config ConnectionConfig) (bool, error) {
+	name := config.Database
+	if name == "" {
+		return false, fmt.Errorf("no database name given")
+	}
+	if msg := ValidateDatabaseName(config.Type, name); msg != "" {
+		return false, fmt.Errorf("database name %s", msg)
+	}
+
+	created := false
+	switch config.Type {
+	case "postgresql":
+		err := cm.withServerDB(config, func(db *sql.DB) error {
+			var exists bool
+			if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, name).Scan(&exists); err != nil {
+				return err
+			}
+			if exists {
+				return nil
+			}
+			if _, err := db.Exec(fmt.Sprintf(`CREATE DATABASE %s`, quotePostgresIdent(name))); err != nil {
+				return err
+			}
+			created = true
+			return nil
+		})
+		return created, err
+	case "mysql", "mariadb":
+		err := cm.withServerDB(config, func(db *sql.DB) error {
+			var count int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = ?`, name).Scan(&count); err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+			if _, err := db.Exec(fmt.Sprintf("CREATE DATABASE %s", quoteMySQLIdent(name))); err != nil {
+				return err
+			}
+			created = true
+			return nil
+		})
+		return created, err
+	case "mongodb":
+		// MongoDB creates databases implicitly on first write
+		return false, nil
+	default:
+		return false, fmt.Errorf("creating databases is not supported for %s", config.Type)
+	}
+}
+
+// RestoreTargetState is what a restore target holds before a restore: whether
+// the database exists, the server's version and the tables, views, sequences
+// or collections already in it, qualified by schema where the engine has one
+type RestoreTargetState struct {
+	Exists        bool     `json:"exists"`
+	ServerVersion string   `json:"server_version,omitempty"`
+	Objects       []string `json:"objects"`
+}
+
+// InspectRestoreTarget reads the state of the configured database without
+// changing it, so a restore can be previewed
+func (cm *ConnectionManager) InspectRestoreTarget(config ConnectionConfig) (*RestoreTargetState, error) {
+	state := &RestoreTargetState{Objects: []string{}}
+
+	switch config.Type {
+	case "postgresql":
+		err := cm.withServerDB(config, func(db *sql.DB) error {
+			if err := db.QueryRow("SHOW server_version").Scan(&state.ServerVersion); err != nil {
+				return fmt.Errorf("failed to read server version: %w", err)
+			}
+			return db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, config.Database).Scan(&state.Exists)
+		})
+		if err != nil || !state.Exists {
+			return state, err
+		}
+		// Objects are listed from within the database, which the server
+		// connection cannot see into
+		err = cm.withTargetDB(config, func(db *sql.DB) error {
+			return appendObjectNames(db, &state.Objects, `
+				SELECT n.nspname || '.' || c.relname
+				FROM pg_class c
+				JOIN pg_namespace n ON n.oid = c.relnamespace
+				WHERE c.relkind IN ('r', 'p', 'v', 'm', 'S', 'f')
+				AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+				AND n.nspname NOT LIKE 'pg_toast%'
+				ORDER BY 1`)
+		})
+		return state, err
+	case "mysql", "mariadb":
+		err := cm.withServerDB(config, func(db *sql.DB) error {
+			if err := db.QueryRow("SELECT VERSION()").Scan(&state.ServerVersion); err != nil {
+				return fmt.Errorf("failed to read server version: %w", err)
+			}
+			var count int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.schemata WHERE schema_name = ?`, config.Database).Scan(&count); err != nil {
+				return err
+			}
+			state.Exists = count > 0
+			if !state.Exists {
+				return nil
+			}
+			return appendObjectNames(db, &state.Objects, `
+				SELECT table_name
+				FROM information_schema.tables
+				WHERE table_schema = ?
+				ORDER BY table_name`, config.Database)
+		})
+		return state, err
+	case "mongodb":
+		return state, cm.inspectMongoRestoreTarget(config, state)
+	default:
+		return nil, fmt.Errorf("restore target checks are not supported for %s", config.Type)
+	}
+}
+
+// withTargetDB runs fn on a temporary connection to the configured database
+func (cm *ConnectionManager) withTargetDB(config ConnectionConfig, fn func(db *sql.DB) error) error {
+	tempConfig := config
+	tempConfig.ID = "temp_restore_" + config.ID
+	tempConfig.Type = driverType(config.Type)
+
+	if err := cm.Connect(tempConfig); err != nil {
+		return fmt.Errorf("failed to connect to restore target: %w", err)
+	}
+	defer cm.Disconnect(tempConfig.ID)
+
+	db, ok := cm.connections[tempConfig.ID].(*sql.DB)
+	if !ok {
+		return fmt.Errorf("unexpected connection type for %s", config.Type)
+	}
+	return fn(db)
+}
+
+func appendObjectNames(db *sql.DB, names *[]string, query string, args ...interface{}) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to list database objects: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		*names = append(*names, name)
+	}
+	return rows.Err()
+}
+
+func (cm *ConnectionManager) inspectMongoRestoreTarget(config ConnectionConfig, state *RestoreTargetState) error {
+	tempConfig := config
+	tempConfig.ID = "temp_restore_" + config.ID
+	if err := cm.Connect(tempConfig); err != nil {
+		return fmt.Errorf("failed to connect to restore target: %w", err)
+	}
+	defer cm.Disconnect(tempConfig.ID)
+
+	client, ok := cm.connections[tempConfig.ID].(*mongo.Client)
+	if !ok {
+		return fmt.Errorf("unexpected connection type for %s", config.Type)
+	}
+
+	ctx := context.Background()
+	var buildInfo bson.M
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&buildInfo); err != nil {
+		return fmt.Errorf("failed to read server version: %w", err)
+	}
+	state.ServerVersion, _ = buildInfo["version"].(string)
+
+	names, err := client.ListDatabaseNames(ctx, bson.D{{Key: "name", Value: config.Database}})
+	if err != nil {
+		return fmt.Errorf("failed to list databases: %w", err)
+	}
+	state.Exists = len(names) > 0
+	if !state.Exists {
+		return nil
+	}
+
+	collections, err := userCollections(client.Database(config.Database))
+	if err != nil {
+		return err
+	}
+	state.Objects = append(state.Objects, collections...)
+	return nil
+}
+
+// moveMySQLTables moves the tables of a MySQL database into a new database,
+// since MySQL cannot rename databases. Views cannot move between databases.
+func moveMySQLTables(db *sql.DB, name, keepAs string) error {
+	var views int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.views WHERE table_schema = ?`, name).Scan(&views); err != nil {
+		return fmt.Errorf("failed to list views: %w", err)
+	}
+	if views > 0 {
+		return fmt.Errorf("database '%s' has views, which MySQL cannot move to another database; restore with overwrite instead", name)
+	}
+
+	rows, err := db.Query(`
+		SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = ? AND table_type = 'BASE TABLE'`, name)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	var renames []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			rows.Close()
+			return err
+		}
+		renames = append(renames, fmt.Sprintf("%s.%s TO %s.%s",
+			quoteMySQLIdent(name), quoteMySQLIdent(table), quoteMySQLIdent(keepAs), quoteMySQLIdent(table)))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("CREATE DATABASE %s", quoteMySQLIdent(keepAs))); err != nil {
+		return err
+	}
+	if len(renames) == 0 {
+		return nil
+	}
+	// A single RENAME TABLE moves all tables atomically
+	_, err = db.Exec("RENAME TABLE " + strings.Join(renames, ", "))
+	return err
+}
+
+func (cm *ConnectionManager) replaceMongoDatabase(config ConnectionConfig, keepAs string) error {
+	tempConfig := config
+	tempConfig.ID = "temp_restore_" + config.ID
+	if err := cm.Connect(tempConfig); err != nil {
+		return fmt.Errorf("failed to connect to restore target: %w", err)
+	}
+	defer cm.Disconnect(tempConfig.ID)
+
+	client, ok := cm.connections[tempConfig.ID].(*mongo.Client)
+	if !ok {
+		return fmt.Errorf("unexpected connection type for %s", config.Type)
+	}
+
+	ctx := context.Background()
+	db := client.Database(config.Database)
+	if keepAs == "" {
+		return db.Drop(ctx)
+	}
+
+	names, err := userCollections(db)
+	if err != nil {
+		return err
+	}
+	for _, collection := range names {
+		err := client.Database("admin").RunCommand(ctx, bson.D{
+			{Key: "renameCollection", Value: config.Database + "." + collection},
+			{Key: "to", Value: keepAs + "." + collection},
+		}).Err()
+		if err != nil {
+			return fmt.Errorf("failed to move collection %s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// driverType returns the type Connect opens a connection of type dbType
+// with, since MariaDB servers are reached through the MySQL driver
+func driverType(dbType string) string {
+	if dbType == "mariadb" {
+		return "mysql"
+	}
+	return dbType
+}
+
+func userCollections(db *mongo.Database) ([]string, error) {
+	names, err := db.ListCollectionNames(context.Background(), bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	var collections []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, "system.") {
+			collections = append(collections, name)
+		}
+	}
+	return collections, nil
+}
@@ -0,0 +1,756 @@
+package connection
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SampleSpec limits a sampled export to a number of rows, or a percentage
+// of the rows, of each table
+type SampleSpec struct {
+	RowsPerTable int
+	Percent      float64
+}
+
+// SampleSummary describes what a sampled export wrote
+type SampleSummary struct {
+	Tables int
+	Rows   int64
+	// Cyclic lists foreign keys of tables that reference themselves or each
+	// other. Rows of the referencing table are only kept when those columns
+	// are NULL.
+	Cyclic []string
+}
+
+// sampleFilterMaxKeys bounds the parent keys a foreign key filter sends to
+// the server; rows of larger key sets are matched while they are read
+const sampleFilterMaxKeys = 1000
+
+// sampleInsertBatch is the number of rows per INSERT of a MySQL sample
+const sampleInsertBatch = 100
+
+type sampleTable struct {
+	schema      string
+	name        string
+	columns     []sampleColumn
+	foreignKeys []*sampleForeignKey
+	// referenced are the column sets other tables reference, and keys the
+	// values of those columns in the rows written so far
+	referenced [][]int
+	keys       map[string]map[string]bool
+}
+
+type sampleColumn struct {
+	name   string
+	binary bool
+}
+
+type sampleForeignKey struct {
+	name          string
+	table         string
+	columns       []string
+	parent        *sampleTable
+	parentTable   string
+	parentColumns []string
+}
+
+func (t *sampleTable) qualifiedName() string {
+	if t.schema == "" {
+		return t.name
+	}
+	return t.schema + "." + t.name
+}
+
+func (t *sampleTable) columnIndexes(names []string) ([]int, bool) {
+	indexes := make([]int, len(names))
+	for i, name := range names {
+		indexes[i] = -1
+		for j, column := range t.columns {
+			if column.name == name {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] < 0 {
+			return nil, false
+		}
+	}
+	return indexes, true
+}
+
+// WriteSampleData writes a sample of the rows of every table of the
+// configured database to w: COPY blocks for Postgres, INSERT statements for
+// MySQL. Tables are written after the tables they reference, and only rows
+// whose foreign keys point at rows already written are kept, so the sample
+// loads into a schema with its constraints in place.
+func (cm *ConnectionManager) WriteSampleData(config ConnectionConfig, spec SampleSpec, w io.Writer) (*SampleSummary, error) {
+	tempConfig := config
+	tempConfig.ID = "temp_sample_" + config.ID
+	tempConfig.Type = driverType(config.Type)
+
+	if err := cm.Connect(tempConfig); err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer cm.Disconnect(tempConfig.ID)
+
+	db, ok := cm.connections[tempConfig.ID].(*sql.DB)
+	if !ok {
+		return nil, fmt.Errorf("sampled exports are not supported for %s", config.Type)
+	}
+
+	sampler := &tableSampler{db: db, postgres: config.Type == "postgresql", spec: spec, w: w}
+	var tables []*sampleTable
+	var err error
+	if sampler.postgres {
+		tables, err = loadPostgresSampleTables(db)
+	} else {
+		tables, err = loadMySQLSampleTables(db, config.Database)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &SampleSummary{}
+	order := sampleOrder(tables)
+	sampler.written = make(map[*sampleTable]bool)
+	for _, table := range order {
+		for _, fk := range table.foreignKeys {
+			if fk.parent == table || !sampler.written[fk.parent] {
+				summary.Cyclic = append(summary.Cyclic, fmt.Sprintf("%s (%s -> %s)", fk.name, table.qualifiedName(), fk.parent.qualifiedName()))
+			}
+		}
+
+		rows, err := sampler.writeTable(table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sample %s: %w", table.qualifiedName(), err)
+		}
+		sampler.written[table] = true
+		summary.Tables++
+		summary.Rows += rows
+	}
+
+	if sampler.postgres {
+		if err := writePostgresSequenceResets(db, order, w); err != nil {
+			return nil, err
+		}
+	}
+
+	return summary, nil
+}
+
+// sampleOrder orders tables so each follows the tables it references. Tables
+// that reference each other are ordered by name, starting the cycle at the
+// first of them.
+func sampleOrder(tables []*sampleTable) []*sampleTable {
+	placed := make(map[*sampleTable]bool)
+	order := make([]*sampleTable, 0, len(tables))
+	for len(order) < len(tables) {
+		var next *sampleTable
+		for _, table := range tables {
+			if placed[table] {
+				continue
+			}
+			if next == nil {
+				next = table
+			}
+			ready := true
+			for _, fk := range table.foreignKeys {
+				if fk.parent != table && !placed[fk.parent] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = table
+				break
+			}
+		}
+		placed[next] = true
+		order = append(order, next)
+	}
+	return order
+}
+
+// resolveSampleTables links foreign keys to their tables and records the
+// column sets each table has referenced. Foreign keys to tables outside the
+// sample, or over columns that cannot be read, are dropped.
+func resolveSampleTables(tables []*sampleTable, foreignKeys []*sampleForeignKey) {
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].qualifiedName() < tables[j].qualifiedName()
+	})
+	byName := make(map[string]*sampleTable, len(tables))
+	for _, table := range tables {
+		byName[table.qualifiedName()] = table
+	}
+
+	for _, fk := range foreignKeys {
+		child, parent := byName[fk.table], byName[fk.parentTable]
+		if child == nil || parent == nil {
+			continue
+		}
+		if _, ok := child.columnIndexes(fk.columns); !ok {
+			continue
+		}
+		referenced, ok := parent.columnIndexes(fk.parentColumns)
+		if !ok {
+			continue
+		}
+		fk.parent = parent
+		child.foreignKeys = append(child.foreignKeys, fk)
+		if parent != child {
+			parent.referenced = append(parent.referenced, referenced)
+		}
+	}
+}
+
+func loadPostgresSampleTables(db *sql.DB) ([]*sampleTable, error) {
+	// Partitions are read through their partitioned table
+	rows, err := db.Query(`
+		SELECT n.nspname, c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('r', 'p')
+		AND NOT c.relispartition
+		AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+		AND n.nspname NOT LIKE 'pg_toast%'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	byName := make(map[string]*sampleTable)
+	var tables []*sampleTable
+	for rows.Next() {
+		table := &sampleTable{}
+		if err := rows.Scan(&table.schema, &table.name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byName[table.qualifiedName()] = table
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT table_schema, table_name, column_name
+		FROM information_schema.columns
+		WHERE table_schema NOT IN ('pg_catalog', 'information_schema')
+		AND is_generated = 'NEVER'
+		ORDER BY table_schema, table_name, ordinal_position`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list columns: %w", err)
+	}
+	for rows.Next() {
+		var schema, name string
+		var column sampleColumn
+		if err := rows.Scan(&schema, &name, &column.name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if table := byName[schema+"."+name]; table != nil {
+			table.columns = append(table.columns, column)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT c.conname, cn.nspname, cl.relname, fn.nspname, fl.relname, a.attname, fa.attname
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_namespace cn ON cn.oid = cl.relnamespace
+		JOIN pg_class fl ON fl.oid = c.confrelid
+		JOIN pg_namespace fn ON fn.oid = fl.relnamespace
+		CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, fattnum, ord)
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		JOIN pg_attribute fa ON fa.attrelid = c.confrelid AND fa.attnum = k.fattnum
+		WHERE c.contype = 'f'
+		ORDER BY c.oid, k.ord`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+	foreignKeys, err := scanSampleForeignKeys(rows, true)
+	if err != nil {
+		return nil, err
+	}
+
+	resolveSampleTables(tables, foreignKeys)
+	return tables, nil
+}
+
+// mysqlBinaryTypes are written as hex literals, which keep their bytes
+// regardless of the connection's character set
+var mysqlBinaryTypes = map[string]bool{
+	"binary": true, "varbinary": true, "tinyblob": true, "blob": true, "mediumblob": true, "longblob": true,
+	"bit": true, "geometry": true, "point": true, "linestring": true, "polygon": true,
+	"multipoint": true, "multilinestring": true, "multipolygon": true, "geometrycollection": true,
+}
+
+func loadMySQLSampleTables(db *sql.DB, database string) ([]*sampleTable, error) {
+	rows, err := db.Query(`
+		SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = ? AND table_type = 'BASE TABLE'`, database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	byName := make(map[string]*sampleTable)
+	var tables []*sampleTable
+	for rows.Next() {
+		table := &sampleTable{}
+		if err := rows.Scan(&table.name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		byName[table.name] = table
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT table_name, column_name, data_type, extra
+		FROM information_schema.columns
+		WHERE table_schema = ?
+		ORDER BY table_name, ordinal_position`, database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list columns: %w", err)
+	}
+	for rows.Next() {
+		var name, dataType, extra string
+		var column sampleColumn
+		if err := rows.Scan(&name, &column.name, &dataType, &extra); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		// Generated columns cannot be inserted; DEFAULT_GENERATED only marks
+		// expression defaults
+		extra = strings.ToUpper(extra)
+		if strings.Contains(extra, "GENERATED") && !strings.Contains(extra, "DEFAULT_GENERATED") {
+			continue
+		}
+		column.binary = mysqlBinaryTypes[strings.ToLower(dataType)]
+		if table := byName[name]; table != nil {
+			table.columns = append(table.columns, column)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT constraint_name, table_name, referenced_table_name, column_name, referenced_column_name
+		FROM information_schema.key_column_usage
+		WHERE table_schema = ? AND referenced_table_schema = ?
+		AND referenced_table_name IS NOT NULL
+		ORDER BY table_name, constraint_name, ordinal_position`, database, database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list foreign keys: %w", err)
+	}
+	foreignKeys, err := scanSampleForeignKeys(rows, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resolveSampleTables(tables, foreignKeys)
+	return tables, nil
+}
+
+// scanSampleForeignKeys groups the column pairs of foreign keys, which the
+// query returns in order, one row per column
+func scanSampleForeignKeys(rows *sql.Rows, schemas bool) ([]*sampleForeignKey, error) {
+	defer rows.Close()
+
+	var foreignKeys []*sampleForeignKey
+	var current *sampleForeignKey
+	for rows.Next() {
+		var name, schema, table, parentSchema, parentTable, column, parentColumn string
+		var err error
+		if schemas {
+			err = rows.Scan(&name, &schema, &table, &parentSchema, &parentTable, &column, &parentColumn)
+			table = schema + "." + table
+			parentTable = parentSchema + "." + parentTable
+		} else {
+			err = rows.Scan(&name, &table, &parentTable, &column, &parentColumn)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if current == nil || current.name != name || current.table != table {
+			current = &sampleForeignKey{name: name, table: table, parentTable: parentTable}
+			foreignKeys = append(foreignKeys, current)
+		}
+		current.columns = append(current.columns, column)
+		current.parentColumns = append(current.parentColumns, parentColumn)
+	}
+	return foreignKeys, rows.Err()
+}
+
+// tableSampler writes the sampled rows of one table after another
+type tableSampler struct {
+	db       *sql.DB
+	postgres bool
+	spec     SampleSpec
+	w        io.Writer
+	written  map[*sampleTable]bool
+}
+
+// sampleFilter keeps rows whose foreign key columns are NULL or, for keys to
+// tables already written, match one of their rows
+type sampleFilter struct {
+	columns []int
+	keys    map[string]bool
+	// pushed is set when the server applies the filter
+	pushed bool
+}
+
+func (f *sampleFilter) matches(values []sql.NullString) bool {
+	parts := make([]string, len(f.columns))
+	for i, column := range f.columns {
+		if !values[column].Valid {
+			return true
+		}
+		parts[i] = values[column].String
+	}
+	return f.keys[strings.Join(parts, "\x00")]
+}
+
+func (s *tableSampler) quoteIdent(name string) string {
+	if s.postgres {
+		return quotePostgresIdent(name)
+	}
+	return quoteMySQLIdent(name)
+}
+
+func (s *tableSampler) quoteLiteral(value string) string {
+	if s.postgres {
+		return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+	}
+	return "'" + mysqlStringEscaper.Replace(value) + "'"
+}
+
+func (s *tableSampler) tableName(table *sampleTable) string {
+	if table.schema == "" {
+		return s.quoteIdent(table.name)
+	}
+	return s.quoteIdent(table.schema) + "." + s.quoteIdent(table.name)
+}
+
+// filters returns the foreign key filters of a table and whether it only
+// keeps rows referencing other sampled rows
+func (s *tableSampler) filters(table *sampleTable) ([]*sampleFilter, bool) {
+	var filters []*sampleFilter
+	referencing := false
+	for _, fk := range table.foreignKeys {
+		columns, _ := table.columnIndexes(fk.columns)
+		filter := &sampleFilter{columns: columns}
+		if fk.parent != table && s.written[fk.parent] {
+			referenced, _ := fk.parent.columnIndexes(fk.parentColumns)
+			filter.keys = fk.parent.keys[columnSetKey(referenced)]
+			referencing = true
+		}
+		filter.pushed = len(filter.keys) <= sampleFilterMaxKeys
+		filters = append(filters, filter)
+	}
+	return filters, referencing
+}
+
+// condition renders a filter as SQL
+func (s *tableSampler) condition(table *sampleTable, filter *sampleFilter) string {
+	var nulls, columns []string
+	for _, column := range filter.columns {
+		name := s.quoteIdent(table.columns[column].name)
+		nulls = append(nulls, name+" IS NULL")
+		columns = append(columns, name)
+	}
+	if len(filter.keys) == 0 {
+		return "(" + strings.Join(nulls, " OR ") + ")"
+	}
+
+	keys := make([]string, 0, len(filter.keys))
+	for key := range filter.keys {
+		var literals []string
+		for _, value := range strings.Split(key, "\x00") {
+			literals = append(literals, s.quoteLiteral(value))
+		}
+		if len(literals) == 1 {
+			keys = append(keys, literals[0])
+		} else {
+			keys = append(keys, "("+strings.Join(literals, ", ")+")")
+		}
+	}
+	sort.Strings(keys)
+
+	target := columns[0]
+	if len(columns) > 1 {
+		target = "(" + strings.Join(columns, ", ") + ")"
+	}
+	return fmt.Sprintf("(%s OR %s IN (%s))", strings.Join(nulls, " OR "), target, strings.Join(keys, ", "))
+}
+
+// query selects the sampled rows of a table. Tables referencing sampled
+// tables keep the rows that reference sampled rows instead of sampling
+// again. The row limit is left to the server when it applies every filter.
+func (s *tableSampler) query(table *sampleTable, filters []*sampleFilter, referencing bool) string {
+	var selected []string
+	for _, column := range table.columns {
+		name := s.quoteIdent(column.name)
+		if s.postgres {
+			// Text values load into any column type
+			name += "::text"
+		}
+		selected = append(selected, name)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selected, ", "), s.tableName(table))
+	var conditions []string
+	if s.spec.Percent > 0 && !referencing {
+		percent := strconv.FormatFloat(s.spec.Percent, 'f', -1, 64)
+		if s.postgres {
+			query += fmt.Sprintf(" TABLESAMPLE BERNOULLI (%s)", percent)
+		} else {
+			conditions = append(conditions, fmt.Sprintf("RAND() * 100 < %s", percent))
+		}
+	}
+
+	exact := true
+	for _, filter := range filters {
+		if !filter.pushed {
+			exact = false
+			continue
+		}
+		conditions = append(conditions, s.condition(table, filter))
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if s.spec.RowsPerTable > 0 && exact {
+		query += fmt.Sprintf(" LIMIT %d", s.spec.RowsPerTable)
+	}
+	return query
+}
+
+func (s *tableSampler) writeTable(table *sampleTable) (int64, error) {
+	table.keys = make(map[string]map[string]bool)
+	for _, columns := range table.referenced {
+		table.keys[columnSetKey(columns)] = make(map[string]bool)
+	}
+	if len(table.columns) == 0 {
+		return 0, nil
+	}
+
+	filters, referencing := s.filters(table)
+	rows, err := s.db.Query(s.query(table, filters, referencing))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	values := make([]sql.NullString, len(table.columns))
+	targets := make([]interface{}, len(values))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+
+	var written int64
+	var batch []string
+	for rows.Next() {
+		if s.spec.RowsPerTable > 0 && written >= int64(s.spec.RowsPerTable) {
+			break
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return written, err
+		}
+
+		keep := true
+		for _, filter := range filters {
+			if !filter.matches(values) {
+				keep = false
+				break
+			}
+		}
+		if !keep {
+			continue
+		}
+
+		if written == 0 {
+			if err := s.writeHeader(table); err != nil {
+				return written, err
+			}
+		}
+		if s.postgres {
+			if _, err := io.WriteString(s.w, copyRow(values)+"\n"); err != nil {
+				return written, err
+			}
+		} else {
+			batch = append(batch, s.insertTuple(table, values))
+			if len(batch) == sampleInsertBatch {
+				if err := s.writeInsert(table, batch); err != nil {
+					return written, err
+				}
+				batch = nil
+			}
+		}
+		table.recordKeys(values)
+		written++
+	}
+	if err := rows.Err(); err != nil {
+		return written, err
+	}
+
+	if written == 0 {
+		return 0, nil
+	}
+	if s.postgres {
+		_, err = io.WriteString(s.w, "\\.\n\n")
+		return written, err
+	}
+	if len(batch) > 0 {
+		if err := s.writeInsert(table, batch); err != nil {
+			return written, err
+		}
+	}
+	_, err = io.WriteString(s.w, "\n")
+	return written, err
+}
+
+func (s *tableSampler) columnList(table *sampleTable) string {
+	var columns []string
+	for _, column := range table.columns {
+		columns = append(columns, s.quoteIdent(column.name))
+	}
+	return strings.Join(columns, ", ")
+}
+
+func (s *tableSampler) writeHeader(table *sampleTable) error {
+	header := fmt.Sprintf("--\n-- Sampled data for %s\n--\n\n", table.qualifiedName())
+	if s.postgres {
+		header += fmt.Sprintf("COPY %s (%s) FROM stdin;\n", s.tableName(table), s.columnList(table))
+	}
+	_, err := io.WriteString(s.w, header)
+	return err
+}
+
+func (s *tableSampler) writeInsert(table *sampleTable, tuples []string) error {
+	_, err := fmt.Fprintf(s.w, "INSERT INTO %s (%s) VALUES %s;\n", s.tableName(table), s.columnList(table), strings.Join(tuples, ","))
+	return err
+}
+
+func (s *tableSampler) insertTuple(table *sampleTable, values []sql.NullString) string {
+	literals := make([]string, len(values))
+	for i, value := range values {
+		switch {
+		case !value.Valid:
+			literals[i] = "NULL"
+		case table.columns[i].binary && value.String != "":
+			literals[i] = "0x" + hex.EncodeToString([]byte(value.String))
+		default:
+			literals[i] = s.quoteLiteral(value.String)
+		}
+	}
+	return "(" + strings.Join(literals, ",") + ")"
+}
+
+// recordKeys remembers the referenced columns of a written row
+func (t *sampleTable) recordKeys(values []sql.NullString) {
+	for _, columns := range t.referenced {
+		parts := make([]string, len(columns))
+		complete := true
+		for i, column := range columns {
+			if !values[column].Valid {
+				complete = false
+				break
+			}
+			parts[i] = values[column].String
+		}
+		if complete {
+			t.keys[columnSetKey(columns)][strings.Join(parts, "\x00")] = true
+		}
+	}
+}
+
+func columnSetKey(columns []int) string {
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		parts[i] = strconv.Itoa(column)
+	}
+	return strings.Join(parts, ",")
+}
+
+var copyFieldEscaper = strings.NewReplacer(`\`, `\\`, "\b", `\b`, "\f", `\f`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "\v", `\v`)
+
+// copyRow renders values in COPY's text format
+func copyRow(values []sql.NullString) string {
+	fields := make([]string, len(values))
+	for i, value := range values {
+		if !value.Valid {
+			fields[i] = `\N`
+			continue
+		}
+		fields[i] = copyFieldEscaper.Replace(value.String)
+	}
+	return strings.Join(fields, "\t")
+}
+
+var mysqlStringEscaper = strings.NewReplacer(`\`, `\\`, "'", `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
+
+// writePostgresSequenceResets moves the sequences owned by sampled tables
+// past the sampled rows, so rows inserted later do not collide with them
+func writePostgresSequenceResets(db *sql.DB, tables []*sampleTable, w io.Writer) error {
+	sampled := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		sampled[table.qualifiedName()] = true
+	}
+
+	rows, err := db.Query(`
+		SELECT sn.nspname, s.relname, tn.nspname, t.relname, a.attname
+		FROM pg_depend d
+		JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_class t ON t.oid = d.refobjid
+		JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		WHERE d.classid = 'pg_class'::regclass
+		AND d.refclassid = 'pg_class'::regclass
+		AND d.deptype IN ('a', 'i')
+		ORDER BY sn.nspname, s.relname`)
+	if err != nil {
+		return fmt.Errorf("failed to list sequences: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var seqSchema, sequence, schema, table, column string
+		if err := rows.Scan(&seqSchema, &sequence, &schema, &table, &column); err != nil {
+			return err
+		}
+		if !sampled[schema+"."+table] {
+			continue
+		}
+
+		name := quotePostgresIdent(seqSchema) + "." + quotePostgresIdent(sequence)
+		max := fmt.Sprintf("(SELECT max(%s) FROM %s.%s)", quotePostgresIdent(column), quotePostgresIdent(schema), quotePostgresIdent(table))
+		_, err := fmt.Fprintf(w, "SELECT pg_catalog.setval('%s', COALESCE(%s, 1), %s IS NOT NULL);\n",
+			strings.ReplaceAll(name, "'", "''"), max, max)
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,158 @@
+package connection
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SchemaDescription is the server version and shape of a database at the
+// time of a backup. The fingerprint hashes the tables with their columns
+// (collections with their indexes for MongoDB), so two backups with the same
+// fingerprint were taken from the same schema.
+type SchemaDescription struct {
+	ServerVersion string `json:"server_version"`
+	Tables        int    `json:"tables"`
+	Fingerprint   string `json:"fingerprint,omitempty"`
+}
+
+// DescribeSchema reads the server version and schema of the configured
+// database
+func (cm *ConnectionManager) DescribeSchema(config ConnectionConfig) (*SchemaDescription, error) {
+	tempConfig := config
+	tempConfig.ID = "temp_schema_" + config.ID
+
+	if err := cm.Connect(tempConfig); err != nil {
+		return nil, fmt.Errorf("failed to connect to describe schema: %w", err)
+	}
+	defer cm.Disconnect(tempConfig.ID)
+
+	description := &SchemaDescription{}
+	var err error
+	switch c := cm.connections[tempConfig.ID].(type) {
+	case *sql.DB:
+		err = describeSQLSchema(c, config.Type, config.Database, description)
+	case *mongo.Client:
+		err = describeMongoSchema(c, config.Database, description)
+	case *redis.Client:
+		err = describeRedisServer(c, description)
+	default:
+		return nil, fmt.Errorf("schema description is not supported for %s", config.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return description, nil
+}
+
+func describeSQLSchema(db *sql.DB, dbType, database string, description *SchemaDescription) error {
+	var rows *sql.Rows
+	var err error
+	if dbType == "postgresql" {
+		if err := db.QueryRow("SHOW server_version").Scan(&description.ServerVersion); err != nil {
+			return fmt.Errorf("failed to read server version: %w", err)
+		}
+		rows, err = db.Query(`
+			SELECT c.table_schema, c.table_name, c.column_name, c.data_type, c.is_nullable, COALESCE(c.column_default, '')
+			FROM information_schema.columns c
+			JOIN information_schema.tables t
+				ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+			WHERE t.table_type = 'BASE TABLE'
+			AND c.table_schema NOT IN ('pg_catalog', 'information_schema')
+			ORDER BY c.table_schema, c.table_name, c.ordinal_position`)
+	} else {
+		if err := db.QueryRow("SELECT VERSION()").Scan(&description.ServerVersion); err != nil {
+			return fmt.Errorf("failed to read server version: %w", err)
+		}
+		rows, err = db.Query(`
+			SELECT c.table_schema, c.table_name, c.column_name, c.column_type, c.is_nullable, COALESCE(c.column_default, '')
+			FROM information_schema.columns c
+			JOIN information_schema.tables t
+				ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+			WHERE t.table_type = 'BASE TABLE'
+			AND c.table_schema = ?
+			ORDER BY c.table_schema, c.table_name, c.ordinal_position`, database)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schema: %w", err)
+	}
+	defer rows.Close()
+
+	hash := sha256.New()
+	tables := make(map[string]bool)
+	for rows.Next() {
+		var schema, table, column, columnType, nullable, columnDefault string
+		if err := rows.Scan(&schema, &table, &column, &columnType, &nullable, &columnDefault); err != nil {
+			return err
+		}
+		tables[schema+"."+table] = true
+		fmt.Fprintf(hash, "%s.%s.%s %s %s %s\n", schema, table, column, columnType, nullable, columnDefault)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	description.Tables = len(tables)
+	description.Fingerprint = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+func describeMongoSchema(client *mongo.Client, database string, description *SchemaDescription) error {
+	ctx := context.Background()
+
+	var buildInfo bson.M
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&buildInfo); err != nil {
+		return fmt.Errorf("failed to read server version: %w", err)
+	}
+	description.ServerVersion, _ = buildInfo["version"].(string)
+
+	db := client.Database(database)
+	names, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		specs, err := db.Collection(name).Indexes().ListSpecifications(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list indexes of %s: %w", name, err)
+		}
+		indexes := make([]string, len(specs))
+		for i, spec := range specs {
+			indexes[i] = fmt.Sprintf("%s %s", spec.Name, spec.KeysDocument.String())
+		}
+		sort.Strings(indexes)
+		fmt.Fprintf(hash, "%s: %s\n", name, strings.Join(indexes, ", "))
+	}
+
+	description.Tables = len(names)
+	description.Fingerprint = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// describeRedisServer reads the version only; Redis keys have no schema
+func describeRedisServer(client *redis.Client, description *SchemaDescription) error {
+	info, err := client.Info(context.Background(), "server").Result()
+	if err != nil {
+		return fmt.Errorf("failed to read server version: %w", err)
+	}
+
+	for _, line := range strings.Split(info, "\n") {
+		if version, ok := strings.CutPrefix(strings.TrimSpace(line), "redis_version:"); ok {
+			description.ServerVersion = version
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TableStats holds the row count of a single table or collection
+type TableStats struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// DatabaseInspection is a lightweight snapshot of a database's contents used
+// to sanity check restored backups.
+type DatabaseInspection struct {
+	Database string       `json:"database"`
+	Tables   []TableStats `json:"tables"`
+}
+
+// scratchDatabasePattern restricts scratch database names so they can be
+// safely interpolated into CREATE/DROP DATABASE statements.
+var scratchDatabasePattern = regexp.MustCompile(`^velld_verify_[a-z0-9_]+$`)
+
+// CreateScratchDatabase creates an empty, disposable database on the server
+// described by config.
+func (cm *ConnectionManager) CreateScratchDatabase(config ConnectionConfig, name string) error {
+	if !scratchDatabasePattern.MatchString(name) {
+		return fmt.Errorf("invalid scratch database name: %s", name)
+	}
+
+	switch config.Type {
+	case "postgresql":
+		return cm.execOnServer(config, fmt.Sprintf(`CREATE DATABASE "%s"`, name))
+	case "mysql", "mariadb":
+		return cm.execOnServer(config, fmt.Sprintf("CREATE DATABASE `%s`", name))
+	case "mongodb":
+		// MongoDB creates databases implicitly on first write
+		return nil
+	default:
+		return fmt.Errorf("scratch databases are not supported for %s", config.Type)
+	}
+}
+
+// DropScratchDatabase removes a database created by CreateScratchDatabase
+func (cm *ConnectionManager) DropScratchDatabase(config ConnectionConfig, name string) error {
+	if !scratchDatabasePattern.MatchString(name) {
+		return fmt.Errorf("invalid scratch database name: %s", name)
+	}
+
+	switch config.Type {
+	case "postgresql":
+		return cm.execOnServer(config, fmt.Sprintf(`DROP DATABASE IF EXISTS "%s"`, name))
+	case "mysql", "mariadb":
+		return cm.execOnServer(config, fmt.Sprintf("DROP DATABASE IF EXISTS `%s`", name))
+	case "mongodb":
+		tempConfig := config
+		tempConfig.ID = "temp_scratch_" + config.ID
+		if err := cm.Connect(tempConfig); err != nil {
+			return err
+		}
+		defer cm.Disconnect(tempConfig.ID)
+		return cm.connections[tempConfig.ID].(*mongo.Client).Database(name).Drop(context.Background())
+	default:
+		return fmt.Errorf("scratch databases are not supported for %s", config.Type)
+	}
+}
+
+// execOnServer runs statements in order against the server's maintenance
+// database, stopping at the first that fails
+func (cm *ConnectionManager) execOnServer(config ConnectionConfig, statements ...string) error {
+	return cm.withServerDB(config, func(db *sql.DB) error {
+		for _, statement := range statements {
+			if _, err := db.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// withServerDB connects to the server's maintenance database for fn
+func (cm *ConnectionManager) withServerDB(config ConnectionConfig, fn func(db *sql.DB) error) error {
+	tempConfig := config
+	tempConfig.ID = "temp_scratch_" + config.ID
+	tempConfig.Database = ""
+	tempConfig.Type = driverType(config.Type)
+
+	if err := cm.Connect(tempConfig); err != nil {
+		return fmt.Errorf("failed to connect to scratch server: %w", err)
+	}
+	defer cm.Disconnect(tempConfig.ID)
+
+	db, ok := cm.connections[tempConfig.ID].(*sql.DB)
+	if !ok {
+		return fmt.Errorf("unexpected connection type for %s", config.Type)
+	}
+
+	return fn(db)
+}
+
+// InspectDatabase lists the tables (or collections) of the configured
+// database with their row counts.
+func (cm *ConnectionManager) InspectDatabase(config ConnectionConfig) (*DatabaseInspection, error) {
+	tempConfig := config
+	tempConfig.ID = "temp_inspect_" + config.ID
+
+	if err := cm.Connect(tempConfig); err != nil {
+		return nil, fmt.Errorf("failed to connect for inspection: %w", err)
+	}
+	defer cm.Disconnect(tempConfig.ID)
+
+	inspection := &DatabaseInspection{
+		Database: config.Database,
+		Tables:   []TableStats{},
+	}
+
+	var err error
+	switch c := cm.connections[tempConfig.ID].(type) {
+	case *sql.DB:
+		err = cm.inspectSQLDatabase(c, config.Type, config.Database, inspection)
+	case *mongo.Client:
+		err = cm.inspectMongoDatabase(c, config.Database, inspection)
+	default:
+		return nil, fmt.Errorf("inspection is not supported for %s", config.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(inspection.Tables, func(i, j int) bool {
+		return inspection.Tables[i].Name < inspection.Tables[j].Name
+	})
+
+	return inspection, nil
+}
+
+func (cm *ConnectionManager) inspectSQLDatabase(db *sql.DB, dbType, database string, inspection *DatabaseInspection) error {
+	var rows *sql.Rows
+	var err error
+	if dbType == "postgresql" {
+		rows, err = db.Query(`
+			SELECT table_schema, table_name
+			FROM information_schema.tables
+			WHERE table_type = 'BASE TABLE'
+			AND table_schema NOT IN ('pg_catalog', 'information_schema')`)
+	} else {
+		rows, err = db.Query(`
+			SELECT table_schema, table_name
+			FROM information_schema.tables
+			WHERE table_type = 'BASE TABLE'
+			AND table_schema = ?`, database)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	type table struct{ schema, name string }
+	var tables []table
+	for rows.Next() {
+		var t table
+		if err := rows.Scan(&t.schema, &t.name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		var query, name string
+		if dbType == "postgresql" {
+			query = fmt.Sprintf(`SELECT COUNT(*) FROM %s.%s`, quotePostgresIdent(t.schema), quotePostgresIdent(t.name))
+			name = t.schema + "." + t.name
+		} else {
+			query = fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteMySQLIdent(t.name))
+			name = t.name
+		}
+
+		var count int64
+		if err := db.QueryRow(query).Scan(&count); err != nil {
+			return fmt.Errorf("failed to count rows in %s: %w", name, err)
+		}
+		inspection.Tables = append(inspection.Tables, TableStats{Name: name, Rows: count})
+	}
+
+	return nil
+}
+
+func (cm *ConnectionManager) inspectMongoDatabase(client *mongo.Client, database string, inspection *DatabaseInspection) error {
+	ctx := context.Background()
+	db := client.Database(database)
+
+	names, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	for _, name := range names {
+		count, err := db.Collection(name).EstimatedDocumentCount(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to count documents in %s: %w", name, err)
+		}
+		inspection.Tables = append(inspection.Tables, TableStats{Name: name, Rows: count})
+	}
+
+	return nil
+}
+
+func quotePostgresIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteMySQLIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
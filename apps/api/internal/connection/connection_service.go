@@ -2,23 +2,31 @@ package connection
 
 import (
 	"fmt"
+	"io"
 
+	"github.com/dendianugerah/velld/internal/events"
 	"github.com/google/uuid"
 )
 
 type ConnectionService struct {
 	repo    *ConnectionRepository
 	manager *ConnectionManager
+	events  *events.EventService
 }
 
-func NewConnectionService(repo *ConnectionRepository, manager *ConnectionManager) *ConnectionService {
+func NewConnectionService(repo *ConnectionRepository, manager *ConnectionManager, eventService *events.EventService) *ConnectionService {
 	return &ConnectionService{
 		repo:    repo,
 		manager: manager,
+		events:  eventService,
 	}
 }
 
 func (s *ConnectionService) TestConnection(config ConnectionConfig) (bool, error) {
+	if err := ValidateConnectionConfig(config); err != nil {
+		return false, err
+	}
+
 	err := s.manager.Connect(config)
 	if err != nil {
 		return false, err
@@ -28,6 +36,10 @@ func (s *ConnectionService) TestConnection(config ConnectionConfig) (bool, error
 }
 
 func (s *ConnectionService) SaveConnection(config ConnectionConfig, userID uuid.UUID) (*StoredConnection, error) {
+	if err := ValidateConnectionConfig(config); err != nil {
+		return nil, err
+	}
+
 	if config.ID == "" {
 		config.ID = uuid.New().String()
 	}
@@ -66,6 +78,7 @@ func (s *ConnectionService) SaveConnection(config ConnectionConfig, userID uuid.
 	if err := s.repo.Save(storedConn); err != nil {
 		return nil, err
 	}
+	s.publishEvent(events.TypeConnectionAdded, &storedConn)
 
 	return &storedConn, nil
 }
@@ -79,6 +92,10 @@ func (s *ConnectionService) GetConnection(id string) (*StoredConnection, error)
 }
 
 func (s *ConnectionService) UpdateConnection(config ConnectionConfig, userID uuid.UUID) (*StoredConnection, error) {
+	if err := ValidateConnectionConfig(config); err != nil {
+		return nil, err
+	}
+
 	if err := s.manager.Connect(config); err != nil {
 		return nil, err
 	}
@@ -111,10 +128,11 @@ func (s *ConnectionService) UpdateConnection(config ConnectionConfig, userID uui
 		SSHUsername:          config.SSHUsername,
 		SSHPassword:          config.SSHPassword,
 		SSHPrivateKey:        config.SSHPrivateKey,
-		UserID:               userID,
+		UserID:               existingConn.UserID, // members of its team don't take it over
 		Status:               "connected",
 		DatabaseSize:         dbSize,
 		S3CleanupOnRetention: existingConn.S3CleanupOnRetention, // preserve existing value
+		TeamID:               existingConn.TeamID,
 	}
 
 	// Update S3 cleanup setting if provided
@@ -125,6 +143,7 @@ func (s *ConnectionService) UpdateConnection(config ConnectionConfig, userID uui
 	if err := s.repo.Update(storedConn); err != nil {
 		return nil, err
 	}
+	s.publishEvent(events.TypeConnectionUpdated, &storedConn)
 
 	return &storedConn, nil
 }
@@ -140,11 +159,23 @@ func (s *ConnectionService) UpdateConnectionSettings(id string, s3CleanupOnReten
 		existingConn.S3CleanupOnRetention = *s3CleanupOnRetention
 	}
 
-	return s.repo.Update(*existingConn)
+	if err := s.repo.Update(*existingConn); err != nil {
+		return err
+	}
+	s.publishEvent(events.TypeConnectionUpdated, existingConn)
+	return nil
 }
 
 func (s *ConnectionService) DeleteConnection(id string) error {
-	return s.repo.Delete(id)
+	// The connection is read first, as its event goes to its owner
+	conn, lookupErr := s.repo.GetConnection(id)
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	if lookupErr == nil {
+		s.publishEvent(events.TypeConnectionRemoved, conn)
+	}
+	return nil
 }
 
 func (s *ConnectionService) DiscoverDatabases(id string) ([]string, error) {
@@ -153,8 +184,24 @@ func (s *ConnectionService) DiscoverDatabases(id string) ([]string, error) {
 		return nil, fmt.Errorf("failed to get connection: %w", err)
 	}
 
-	config := ConnectionConfig{
+	return s.manager.DiscoverDatabases(configFromStoredConnection(conn))
+}
+
+// CheckDumpPrivileges verifies the stored user has the privileges needed to
+// dump the connection's database, and no more.
+func (s *ConnectionService) CheckDumpPrivileges(id string) (*PrivilegeCheck, error) {
+	conn, err := s.repo.GetConnection(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	return s.manager.CheckDumpPrivileges(configFromStoredConnection(conn))
+}
+
+func configFromStoredConnection(conn *StoredConnection) ConnectionConfig {
+	return ConnectionConfig{
 		ID:            conn.ID,
+		Name:          conn.Name,
 		Type:          conn.Type,
 		Host:          conn.Host,
 		Port:          conn.Port,
@@ -169,10 +216,61 @@ func (s *ConnectionService) DiscoverDatabases(id string) ([]string, error) {
 		SSHPassword:   conn.SSHPassword,
 		SSHPrivateKey: conn.SSHPrivateKey,
 	}
-
-	return s.manager.DiscoverDatabases(config)
 }
 
 func (s *ConnectionService) UpdateSelectedDatabases(id string, databases []string) error {
 	return s.repo.UpdateSelectedDatabases(id, databases)
 }
+
+func (s *ConnectionService) UpdateTags(id string, tags []string) error {
+	return s.repo.UpdateTags(id, tags)
+}
+
+// CreateScratchDatabase creates a disposable database on the connection's server
+func (s *ConnectionService) CreateScratchDatabase(conn *StoredConnection, name string) error {
+	return s.manager.CreateScratchDatabase(configFromStoredConnection(conn), name)
+}
+
+func (s *ConnectionService) DropScratchDatabase(conn *StoredConnection, name string) error {
+	return s.manager.DropScratchDatabase(configFromStoredConnection(conn), name)
+}
+
+// MeasureDatabaseSize returns the current size of the connection's database
+func (s *ConnectionService) MeasureDatabaseSize(conn *StoredConnection) (int64, error) {
+	return s.manager.MeasureDatabaseSize(configFromStoredConnection(conn))
+}
+
+// DescribeSchema returns the server version and schema fingerprint of the connection's database
+func (s *ConnectionService) DescribeSchema(conn *StoredConnection) (*SchemaDescription, error) {
+	return s.manager.DescribeSchema(configFromStoredConnection(conn))
+}
+
+// InspectDatabase returns the tables of the connection's database with row counts
+func (s *ConnectionService) InspectDatabase(conn *StoredConnection) (*DatabaseInspection, error) {
+	return s.manager.InspectDatabase(configFromStoredConnection(conn))
+}
+
+// CountDatabaseObjects returns how many tables or collections the connection's database holds
+func (s *ConnectionService) CountDatabaseObjects(conn *StoredConnection) (int, error) {
+	return s.manager.CountDatabaseObjects(configFromStoredConnection(conn))
+}
+
+// ReplaceDatabase empties the connection's database, keeping its contents as keepAs if set
+func (s *ConnectionService) ReplaceDatabase(conn *StoredConnection, keepAs string) error {
+	return s.manager.ReplaceDatabase(configFromStoredConnection(conn), keepAs)
+}
+
+// EnsureDatabase creates the connection's database if the server lacks it and reports whether it did
+func (s *ConnectionService) EnsureDatabase(conn *StoredConnection) (bool, error) {
+	return s.manager.EnsureDatabase(configFromStoredConnection(conn))
+}
+
+// InspectRestoreTarget reports whether the connection's database exists and what it holds, without changing it
+func (s *ConnectionService) InspectRestoreTarget(conn *StoredConnection) (*RestoreTargetState, error) {
+	return s.manager.InspectRestoreTarget(configFromStoredConnection(conn))
+}
+
+// WriteSampleData writes a referentially consistent sample of the connection's tables to w
+func (s *ConnectionService) WriteSampleData(conn *StoredConnection, spec SampleSpec, w io.Writer) (*SampleSummary, error) {
+	return s.manager.WriteSampleData(configFromStoredConnection(conn), spec, w)
+}
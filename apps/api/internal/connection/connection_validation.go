@@ -0,0 +1,185 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	maxConnectionNameLength = 100
+	maxHostnameLength       = 253
+	maxUsernameLength       = 128
+)
+
+// maxDatabaseNameLength is the identifier limit of each database type
+var maxDatabaseNameLength = map[string]int{
+	"postgresql": 63,
+	"mysql":      64,
+	"mariadb":    64,
+	"mongodb":    63,
+}
+
+// invalidDatabaseNameChars lists the characters each database type rejects
+// in database names.
+var invalidDatabaseNameChars = map[string]string{
+	"mysql":   `/\.`,
+	"mariadb": `/\.`,
+	"mongodb": `/\. "$`,
+}
+
+var hostnameLabel = regexp.MustCompile(`^[a-zA-Z0-9_]([a-zA-Z0-9_-]{0,61}[a-zA-Z0-9_])?$`)
+
+// FieldError describes why a single ConnectionConfig field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every invalid field of a ConnectionConfig
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fmt.Sprintf("%s: %s", fieldErr.Field, fieldErr.Message)
+	}
+	return "invalid connection: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// AsValidationError reports whether err is a ConnectionConfig validation error
+func AsValidationError(err error) (*ValidationError, bool) {
+	var validationErr *ValidationError
+	ok := errors.As(err, &validationErr)
+	return validationErr, ok
+}
+
+// ValidateConnectionConfig checks the format of a connection before it is
+// used, so malformed input fails with field-level errors instead of deep in a
+// driver at backup time. Credentials are not required, since imported and
+// updated connections may omit them.
+func ValidateConnectionConfig(config ConnectionConfig) error {
+	v := &ValidationError{}
+
+	name := strings.TrimSpace(config.Name)
+	switch {
+	case name == "":
+		v.add("name", "is required")
+	case len(name) > maxConnectionNameLength:
+		v.add("name", "must be at most %d characters", maxConnectionNameLength)
+	}
+
+	if _, ok := defaultPorts[config.Type]; !ok {
+		v.add("type", "unsupported database type %q", config.Type)
+	}
+
+	if msg := validateHost(config.Host); msg != "" {
+		v.add("host", "%s", msg)
+	}
+
+	if config.Port < 1 || config.Port > 65535 {
+		v.add("port", "must be between 1 and 65535")
+	}
+
+	if len(config.Username) > maxUsernameLength {
+		v.add("username", "must be at most %d characters", maxUsernameLength)
+	} else if hasControlChars(config.Username) {
+		v.add("username", "must not contain control characters")
+	}
+
+	if msg := ValidateDatabaseName(config.Type, config.Database); msg != "" {
+		v.add("database", "%s", msg)
+	}
+
+	if config.SSHEnabled {
+		if msg := validateHost(config.SSHHost); msg != "" {
+			v.add("ssh_host", "%s", msg)
+		}
+		if config.SSHPort < 1 || config.SSHPort > 65535 {
+			v.add("ssh_port", "must be between 1 and 65535")
+		}
+		if strings.TrimSpace(config.SSHUsername) == "" {
+			v.add("ssh_username", "is required when SSH is enabled")
+		}
+		if config.SSHPrivateKey != "" {
+			if _, err := ssh.ParsePrivateKey([]byte(config.SSHPrivateKey)); err != nil {
+				var passphraseErr *ssh.PassphraseMissingError
+				if errors.As(err, &passphraseErr) {
+					v.add("ssh_private_key", "passphrase-protected keys are not supported")
+				} else {
+					v.add("ssh_private_key", "is not a valid private key: %v", err)
+				}
+			}
+		}
+	}
+
+	if len(v.Errors) > 0 {
+		return v
+	}
+	return nil
+}
+
+func validateHost(host string) string {
+	if host == "" {
+		return "is required"
+	}
+	if len(host) > maxHostnameLength {
+		return fmt.Sprintf("must be at most %d characters", maxHostnameLength)
+	}
+	if net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return ""
+	}
+
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if !hostnameLabel.MatchString(label) {
+			return "must be a valid hostname or IP address"
+		}
+	}
+	return ""
+}
+
+// ValidateDatabaseName returns why a database name is not valid for the
+// database type, or an empty string when it is
+func ValidateDatabaseName(dbType, name string) string {
+	if name == "" {
+		return ""
+	}
+
+	if dbType == "redis" {
+		index, err := strconv.Atoi(name)
+		if err != nil || index < 0 {
+			return "must be a non-negative Redis database index"
+		}
+		return ""
+	}
+
+	if limit, ok := maxDatabaseNameLength[dbType]; ok && len(name) > limit {
+		return fmt.Sprintf("must be at most %d characters", limit)
+	}
+	if hasControlChars(name) {
+		return "must not contain control characters"
+	}
+	if chars := invalidDatabaseNameChars[dbType]; strings.ContainsAny(name, chars) {
+		return fmt.Sprintf("must not contain any of %q", chars)
+	}
+	if (dbType == "mysql" || dbType == "mariadb") && strings.HasSuffix(name, " ") {
+		return "must not end with a space"
+	}
+	return ""
+}
+
+func hasControlChars(value string) bool {
+	return strings.IndexFunc(value, unicode.IsControl) >= 0
+}
@@ -16,6 +16,7 @@ type StoredConnection struct {
 	Password          string     `json:"password"`
 	DatabaseName      string     `json:"database_name"`
 	SelectedDatabases []string   `json:"selected_databases"`
+	Tags              []string   `json:"tags"`
 	SSL               bool       `json:"ssl"`
 	SSHEnabled        bool       `json:"ssh_enabled"`
 	SSHHost           string     `json:"ssh_host"`
@@ -30,6 +31,12 @@ type StoredConnection struct {
 	UserID                 uuid.UUID  `json:"user_id"`
 	Status                 string     `json:"status"`
 	DatabaseSize           int64      `json:"database_size"`
+	CredentialStatus       *string    `json:"credential_status"`
+	CredentialCheckedAt    *string    `json:"credential_checked_at"`
+	CredentialError        *string    `json:"credential_error"`
+	// TeamID is the team the connection is shared with; its schedules and
+	// backups are shared along with it
+	TeamID *string `json:"team_id"`
 }
 
 type ConnectionConfig struct {
@@ -73,4 +80,9 @@ type ConnectionListItem struct {
 	CronSchedule         *string `json:"cron_schedule"`
 	RetentionDays        *int    `json:"retention_days"`
 	S3CleanupOnRetention bool    `json:"s3_cleanup_on_retention"`
+	Tags                 []string `json:"tags"`
+	CredentialStatus     *string  `json:"credential_status"`
+	// ScheduleState is active or paused, null without a schedule
+	ScheduleState *string `json:"schedule_state"`
+	TeamID        *string `json:"team_id"`
 }
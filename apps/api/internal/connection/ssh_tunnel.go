@@ -1,6 +1,7 @@
 package connection
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"net"
@@ -132,6 +133,32 @@ func (tunnel *SSHTunnel) Stop() error {
 	return nil
 }
 
+// RunCommand runs a command on the SSH server of a started tunnel and writes
+// its standard output to stdout
+func (tunnel *SSHTunnel) RunCommand(command string, stdout io.Writer) error {
+	if tunnel.client == nil {
+		return fmt.Errorf("SSH tunnel is not started")
+	}
+
+	session, err := tunnel.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdout = stdout
+	session.Stderr = &stderr
+
+	if err := session.Run(command); err != nil {
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) > 0 {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
 // GetLocalAddr returns the local address (host:port) to connect to
 func (tunnel *SSHTunnel) GetLocalAddr() string {
 	return tunnel.Local.String()
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding GPG public-key encryption to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN gpg_public_key TEXT;
+
+-- Fingerprint of the key a backup artifact was encrypted for
+ALTER TABLE backups ADD COLUMN encryption_key_fingerprint TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing GPG public-key encryption from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN gpg_public_key;
+ALTER TABLE backups DROP COLUMN encryption_key_fingerprint;
+
+-- +goose StatementEnd
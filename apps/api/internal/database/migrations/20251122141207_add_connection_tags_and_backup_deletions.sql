@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding connection tags and backup deletion log';
+
+ALTER TABLE connections ADD COLUMN tags TEXT DEFAULT '';
+
+-- Evidence of every backup artifact removed by velld
+CREATE TABLE backup_deletions (
+    id TEXT PRIMARY KEY,
+    backup_id TEXT NOT NULL,
+    connection_id TEXT NOT NULL,
+    path TEXT,
+    s3_object_key TEXT,
+    size INTEGER,
+    reason TEXT NOT NULL,
+    backup_created_at TEXT,
+    deleted_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_backup_deletions_connection_id ON backup_deletions(connection_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing connection tags and backup deletion log';
+
+DROP TABLE backup_deletions;
+ALTER TABLE connections DROP COLUMN tags;
+
+-- +goose StatementEnd
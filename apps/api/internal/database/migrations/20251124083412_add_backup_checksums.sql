@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding checksum and integrity verification to backups';
+
+ALTER TABLE backups ADD COLUMN checksum TEXT;
+ALTER TABLE backups ADD COLUMN verification_status TEXT;
+ALTER TABLE backups ADD COLUMN verified_at TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing checksum and integrity verification from backups';
+
+ALTER TABLE backups DROP COLUMN verified_at;
+ALTER TABLE backups DROP COLUMN verification_status;
+ALTER TABLE backups DROP COLUMN checksum;
+
+-- +goose StatementEnd
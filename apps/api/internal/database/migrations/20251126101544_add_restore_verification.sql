@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding restore verification against scratch databases';
+
+ALTER TABLE backup_schedules ADD COLUMN verify_connection_id TEXT;
+ALTER TABLE backups ADD COLUMN restore_verification_status TEXT;
+
+CREATE TABLE backup_restore_verifications (
+    id TEXT PRIMARY KEY,
+    backup_id TEXT NOT NULL,
+    scratch_connection_id TEXT NOT NULL,
+    status TEXT NOT NULL,
+    details TEXT, -- JSON encoded table checks and warnings
+    error TEXT,
+    started_at TEXT NOT NULL,
+    completed_at TEXT
+);
+
+CREATE INDEX idx_backup_restore_verifications_backup_id ON backup_restore_verifications(backup_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing restore verification against scratch databases';
+
+DROP TABLE backup_restore_verifications;
+ALTER TABLE backups DROP COLUMN restore_verification_status;
+ALTER TABLE backup_schedules DROP COLUMN verify_connection_id;
+
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding compression filter commands';
+
+ALTER TABLE backup_schedules ADD COLUMN compression_command TEXT;
+ALTER TABLE backups ADD COLUMN compression_command TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing compression filter commands';
+
+ALTER TABLE backups DROP COLUMN compression_command;
+ALTER TABLE backup_schedules DROP COLUMN compression_command;
+
+-- +goose StatementEnd
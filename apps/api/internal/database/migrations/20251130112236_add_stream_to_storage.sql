@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding streaming uploads to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN stream_to_storage BOOLEAN NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing streaming uploads from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN stream_to_storage;
+
+-- +goose StatementEnd
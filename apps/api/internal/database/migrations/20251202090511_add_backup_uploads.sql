@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding resumable upload journal';
+
+CREATE TABLE backup_uploads (
+    backup_id TEXT PRIMARY KEY,
+    object_key TEXT NOT NULL,
+    upload_id TEXT NOT NULL,
+    part_size INTEGER NOT NULL,
+    total_size INTEGER NOT NULL,
+    parts TEXT NOT NULL DEFAULT '[]', -- JSON encoded completed parts
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_backup_uploads_status ON backup_uploads(status);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing resumable upload journal';
+
+DROP TABLE backup_uploads;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding parallel pg_dump jobs to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN pg_dump_jobs INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing parallel pg_dump jobs from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN pg_dump_jobs;
+
+-- +goose StatementEnd
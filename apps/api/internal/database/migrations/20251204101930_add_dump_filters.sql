@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding dump filters to backup schedules and backups';
+
+ALTER TABLE backup_schedules ADD COLUMN dump_filters TEXT;
+ALTER TABLE backups ADD COLUMN dump_filters TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing dump filters from backup schedules and backups';
+
+ALTER TABLE backups DROP COLUMN dump_filters;
+ALTER TABLE backup_schedules DROP COLUMN dump_filters;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding extra dump arguments to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN extra_dump_args TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing extra dump arguments from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN extra_dump_args;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding run environment to backups';
+
+ALTER TABLE backups ADD COLUMN run_environment TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing run environment from backups';
+
+ALTER TABLE backups DROP COLUMN run_environment;
+
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding backup runs with child jobs';
+
+CREATE TABLE backup_runs (
+    id TEXT PRIMARY KEY,
+    connection_id TEXT NOT NULL,
+    schedule_id TEXT,
+    trigger TEXT NOT NULL,
+    status TEXT NOT NULL,
+    total_jobs INTEGER NOT NULL DEFAULT 0,
+    succeeded_jobs INTEGER NOT NULL DEFAULT 0,
+    failed_jobs INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    started_time TEXT NOT NULL,
+    completed_time TEXT
+);
+
+CREATE INDEX idx_backup_runs_connection_id ON backup_runs(connection_id);
+
+CREATE TABLE backup_run_jobs (
+    id TEXT PRIMARY KEY,
+    run_id TEXT NOT NULL,
+    kind TEXT NOT NULL, -- dump or upload
+    target TEXT NOT NULL,
+    backup_id TEXT,
+    status TEXT NOT NULL,
+    error TEXT,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_backup_run_jobs_run_id ON backup_run_jobs(run_id);
+
+ALTER TABLE backups ADD COLUMN run_id TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing backup runs with child jobs';
+
+ALTER TABLE backups DROP COLUMN run_id;
+DROP TABLE backup_run_jobs;
+DROP TABLE backup_runs;
+
+-- +goose StatementEnd
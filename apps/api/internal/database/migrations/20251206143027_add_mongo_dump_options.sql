@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding mongodump options to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN mongo_dump_options TEXT; -- JSON encoded MongoDumpOptions
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing mongodump options from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN mongo_dump_options;
+
+-- +goose StatementEnd
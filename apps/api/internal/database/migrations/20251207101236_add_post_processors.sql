@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding artifact post-processors';
+
+ALTER TABLE backup_schedules ADD COLUMN post_processors TEXT; -- JSON encoded PostProcessors
+ALTER TABLE backups ADD COLUMN post_processed_files TEXT; -- JSON encoded PostProcessedFiles
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing artifact post-processors';
+
+ALTER TABLE backups DROP COLUMN post_processed_files;
+ALTER TABLE backup_schedules DROP COLUMN post_processors;
+
+-- +goose StatementEnd
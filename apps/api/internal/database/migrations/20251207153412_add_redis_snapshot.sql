@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding Redis snapshot backups to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN redis_snapshot BOOLEAN NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing Redis snapshot backups from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN redis_snapshot;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding bandwidth limits to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN bandwidth_limit_kbps INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing bandwidth limits from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN bandwidth_limit_kbps;
+
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding backup catalog of database and table names';
+
+ALTER TABLE backups ADD COLUMN database_name TEXT;
+
+CREATE TABLE backup_catalog_entries (
+    backup_id TEXT NOT NULL,
+    schema_name TEXT NOT NULL DEFAULT '',
+    table_name TEXT NOT NULL
+);
+
+CREATE INDEX idx_backup_catalog_entries_backup_id ON backup_catalog_entries(backup_id);
+CREATE INDEX idx_backup_catalog_entries_table_name ON backup_catalog_entries(table_name);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing backup catalog of database and table names';
+
+DROP TABLE backup_catalog_entries;
+ALTER TABLE backups DROP COLUMN database_name;
+
+-- +goose StatementEnd
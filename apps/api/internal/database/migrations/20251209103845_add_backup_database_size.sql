@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding database size at backup time to backups';
+
+ALTER TABLE backups ADD COLUMN database_size INTEGER;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing database size at backup time from backups';
+
+ALTER TABLE backups DROP COLUMN database_size;
+
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding credential check status to connections';
+
+ALTER TABLE connections ADD COLUMN credential_status TEXT;
+ALTER TABLE connections ADD COLUMN credential_checked_at TEXT;
+ALTER TABLE connections ADD COLUMN credential_error TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing credential check status from connections';
+
+ALTER TABLE connections DROP COLUMN credential_status;
+ALTER TABLE connections DROP COLUMN credential_checked_at;
+ALTER TABLE connections DROP COLUMN credential_error;
+
+-- +goose StatementEnd
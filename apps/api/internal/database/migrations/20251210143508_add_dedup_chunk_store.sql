@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding deduplicated chunk store';
+
+ALTER TABLE backup_schedules ADD COLUMN deduplicate BOOLEAN NOT NULL DEFAULT 0;
+
+CREATE TABLE dedup_chunks (
+    hash TEXT PRIMARY KEY,
+    size INTEGER NOT NULL,
+    stored_size INTEGER NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TEXT NOT NULL
+);
+
+CREATE TABLE backup_chunks (
+    backup_id TEXT NOT NULL,
+    seq INTEGER NOT NULL,
+    chunk_hash TEXT NOT NULL,
+    PRIMARY KEY (backup_id, seq)
+);
+
+CREATE INDEX idx_backup_chunks_chunk_hash ON backup_chunks(chunk_hash);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing deduplicated chunk store';
+
+DROP TABLE backup_chunks;
+DROP TABLE dedup_chunks;
+ALTER TABLE backup_schedules DROP COLUMN deduplicate;
+
+-- +goose StatementEnd
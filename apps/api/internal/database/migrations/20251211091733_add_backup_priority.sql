@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding priorities to backup schedules and runs';
+
+ALTER TABLE backup_schedules ADD COLUMN priority TEXT NOT NULL DEFAULT 'normal';
+ALTER TABLE backup_runs ADD COLUMN priority TEXT NOT NULL DEFAULT 'normal';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing priorities from backup schedules and runs';
+
+ALTER TABLE backup_runs DROP COLUMN priority;
+ALTER TABLE backup_schedules DROP COLUMN priority;
+
+-- +goose StatementEnd
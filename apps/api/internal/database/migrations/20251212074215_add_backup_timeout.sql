@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding execution timeouts to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN timeout_minutes INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing execution timeouts from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN timeout_minutes;
+
+-- +goose StatementEnd
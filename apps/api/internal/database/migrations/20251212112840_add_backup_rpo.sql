@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding recovery point objectives to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN rpo_minutes INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing recovery point objectives from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN rpo_minutes;
+
+-- +goose StatementEnd
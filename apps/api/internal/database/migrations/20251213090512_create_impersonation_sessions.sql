@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding audited admin impersonation sessions';
+
+CREATE TABLE impersonation_sessions (
+    id TEXT PRIMARY KEY,
+    admin_id TEXT NOT NULL,
+    admin_username TEXT NOT NULL,
+    target_user_id TEXT NOT NULL,
+    target_username TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    started_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    ended_at TEXT
+);
+
+CREATE TABLE impersonation_events (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_impersonation_events_session_id ON impersonation_events(session_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing audited admin impersonation sessions';
+
+DROP TABLE impersonation_events;
+DROP TABLE impersonation_sessions;
+
+-- +goose StatementEnd
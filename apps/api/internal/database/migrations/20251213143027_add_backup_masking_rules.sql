@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding masking rules to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN masking_rules TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing masking rules from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN masking_rules;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding sample options to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN sample_options TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing sample options from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN sample_options;
+
+-- +goose StatementEnd
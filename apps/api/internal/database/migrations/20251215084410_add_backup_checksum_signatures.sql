@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding checksum signatures to backups';
+
+ALTER TABLE backups ADD COLUMN checksum_signature TEXT;
+ALTER TABLE backups ADD COLUMN signing_key_fingerprint TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing checksum signatures from backups';
+
+ALTER TABLE backups DROP COLUMN signing_key_fingerprint;
+ALTER TABLE backups DROP COLUMN checksum_signature;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding physical backups to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN physical_backup BOOLEAN NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing physical backups from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN physical_backup;
+
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding incremental physical backup chains';
+
+ALTER TABLE backup_schedules ADD COLUMN incremental_backups INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backups ADD COLUMN incremental_base_id TEXT;
+ALTER TABLE backups ADD COLUMN checkpoint_lsn TEXT;
+CREATE INDEX IF NOT EXISTS idx_backups_incremental_base_id ON backups(incremental_base_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing incremental physical backup chains';
+
+DROP INDEX IF EXISTS idx_backups_incremental_base_id;
+ALTER TABLE backups DROP COLUMN checkpoint_lsn;
+ALTER TABLE backups DROP COLUMN incremental_base_id;
+ALTER TABLE backup_schedules DROP COLUMN incremental_backups;
+
+-- +goose StatementEnd
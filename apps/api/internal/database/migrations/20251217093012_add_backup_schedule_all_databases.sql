@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding all databases mode to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN all_databases BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE backup_schedules ADD COLUMN database_workers INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing all databases mode from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN database_workers;
+ALTER TABLE backup_schedules DROP COLUMN all_databases;
+
+-- +goose StatementEnd
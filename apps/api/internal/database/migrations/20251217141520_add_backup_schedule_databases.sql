@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding database selection to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN databases TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing database selection from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN databases;
+
+-- +goose StatementEnd
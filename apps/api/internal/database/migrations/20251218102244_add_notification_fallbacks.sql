@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding notification fallback chains and delivery attempts';
+
+ALTER TABLE user_settings ADD COLUMN notification_fallbacks TEXT;
+
+CREATE TABLE notification_deliveries (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    notification_type TEXT NOT NULL,
+    chain_id TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    channel TEXT NOT NULL,
+    target TEXT,
+    status TEXT NOT NULL,
+    error TEXT,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_notification_deliveries_user_id ON notification_deliveries(user_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing notification fallback chains and delivery attempts';
+
+DROP TABLE notification_deliveries;
+ALTER TABLE user_settings DROP COLUMN notification_fallbacks;
+
+-- +goose StatementEnd
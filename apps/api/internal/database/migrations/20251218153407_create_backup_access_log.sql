@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding backup artifact access log';
+
+CREATE TABLE backup_access_log (
+    id TEXT PRIMARY KEY,
+    backup_id TEXT NOT NULL,
+    connection_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    detail TEXT,
+    user_id TEXT NOT NULL,
+    username TEXT,
+    impersonator TEXT,
+    remote_addr TEXT NOT NULL,
+    forwarded_for TEXT,
+    user_agent TEXT,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_backup_access_log_backup_id ON backup_access_log(backup_id);
+CREATE INDEX idx_backup_access_log_connection_id ON backup_access_log(connection_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing backup artifact access log';
+
+DROP TABLE backup_access_log;
+
+-- +goose StatementEnd
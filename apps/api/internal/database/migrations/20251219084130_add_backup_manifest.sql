@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding manifest to backups';
+
+ALTER TABLE backups ADD COLUMN manifest TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing manifest from backups';
+
+ALTER TABLE backups DROP COLUMN manifest;
+
+-- +goose StatementEnd
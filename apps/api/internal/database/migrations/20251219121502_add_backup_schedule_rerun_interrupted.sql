@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding rerun_interrupted to backup_schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN rerun_interrupted BOOLEAN;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing rerun_interrupted from backup_schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN rerun_interrupted;
+
+-- +goose StatementEnd
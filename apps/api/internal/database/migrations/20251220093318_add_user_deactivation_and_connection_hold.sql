@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding user deactivation and connection ownership transfer';
+
+ALTER TABLE users ADD COLUMN deactivated_at TEXT;
+
+-- previous_user_id is the owner a connection was last transferred from;
+-- held_at is set while the admin holds it until it is reassigned
+ALTER TABLE connections ADD COLUMN previous_user_id TEXT;
+ALTER TABLE connections ADD COLUMN held_at TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing user deactivation and connection ownership transfer';
+
+ALTER TABLE connections DROP COLUMN held_at;
+ALTER TABLE connections DROP COLUMN previous_user_id;
+ALTER TABLE users DROP COLUMN deactivated_at;
+
+-- +goose StatementEnd
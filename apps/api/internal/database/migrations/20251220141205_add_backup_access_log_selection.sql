@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding selection to backup_access_log';
+
+ALTER TABLE backup_access_log ADD COLUMN selection TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing selection from backup_access_log';
+
+ALTER TABLE backup_access_log DROP COLUMN selection;
+
+-- +goose StatementEnd
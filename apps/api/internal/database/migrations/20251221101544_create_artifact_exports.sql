@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding artifact exports';
+
+CREATE TABLE artifact_exports (
+    id TEXT PRIMARY KEY,
+    connection_id TEXT NOT NULL,
+    destination TEXT NOT NULL,
+    filter TEXT,
+    bandwidth_limit_kbps INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_by TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    completed_at TEXT
+);
+
+CREATE TABLE artifact_export_items (
+    export_id TEXT NOT NULL REFERENCES artifact_exports(id) ON DELETE CASCADE,
+    backup_id TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    status TEXT NOT NULL,
+    size INTEGER NOT NULL DEFAULT 0,
+    checksum TEXT,
+    location TEXT,
+    error TEXT,
+    exported_at TEXT,
+    PRIMARY KEY (export_id, backup_id)
+);
+
+CREATE INDEX idx_artifact_exports_connection_id ON artifact_exports(connection_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing artifact exports';
+
+DROP TABLE artifact_export_items;
+DROP TABLE artifact_exports;
+
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding restore sandboxes';
+
+CREATE TABLE restore_sandboxes (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    backup_id TEXT NOT NULL,
+    connection_id TEXT NOT NULL,
+    database_type TEXT NOT NULL,
+    image TEXT NOT NULL,
+    container_id TEXT,
+    status TEXT NOT NULL,
+    host TEXT,
+    port INTEGER,
+    username TEXT,
+    password TEXT,
+    database_name TEXT NOT NULL,
+    error TEXT,
+    expires_at TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_restore_sandboxes_user_id ON restore_sandboxes(user_id);
+CREATE INDEX idx_restore_sandboxes_status ON restore_sandboxes(status);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing restore sandboxes';
+
+DROP TABLE restore_sandboxes;
+
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding dump imports';
+
+CREATE TABLE dump_imports (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    connection_id TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    received INTEGER NOT NULL DEFAULT 0,
+    checksum TEXT,
+    database_name TEXT,
+    status TEXT NOT NULL,
+    format TEXT,
+    backup_id TEXT,
+    error TEXT,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    FOREIGN KEY (connection_id) REFERENCES connections(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_dump_imports_user_id ON dump_imports(user_id);
+CREATE INDEX idx_dump_imports_status ON dump_imports(status);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing dump imports';
+
+DROP TABLE dump_imports;
+
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding restore history';
+
+CREATE TABLE restores (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    username TEXT,
+    impersonator TEXT,
+    backup_id TEXT NOT NULL,
+    source_connection_id TEXT NOT NULL,
+    connection_id TEXT NOT NULL,
+    database_name TEXT NOT NULL,
+    trigger TEXT NOT NULL, -- request, point_in_time or sandbox
+    options TEXT,
+    status TEXT NOT NULL,
+    error TEXT,
+    cleanup TEXT,
+    preserved_database TEXT,
+    created_database BOOLEAN NOT NULL DEFAULT 0,
+    log TEXT,
+    started_at TEXT NOT NULL,
+    finished_at TEXT,
+    duration_ms INTEGER
+);
+
+CREATE INDEX idx_restores_user_id ON restores(user_id, started_at);
+CREATE INDEX idx_restores_backup_id ON restores(backup_id);
+CREATE INDEX idx_restores_connection_id ON restores(connection_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing restore history';
+
+DROP TABLE restores;
+
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding maintenance windows';
+
+CREATE TABLE maintenance_windows (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    connection_id TEXT, -- NULL applies the window to all of the user's connections
+    name TEXT NOT NULL,
+    start_time TEXT NOT NULL,
+    end_time TEXT NOT NULL,
+    days TEXT,
+    timezone TEXT,
+    action TEXT NOT NULL DEFAULT 'skip', -- skip or defer
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_maintenance_windows_user_id ON maintenance_windows(user_id, connection_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing maintenance windows';
+
+DROP TABLE maintenance_windows;
+
+-- +goose StatementEnd
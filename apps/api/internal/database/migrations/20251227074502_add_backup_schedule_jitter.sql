@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding start jitter to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN jitter_seconds INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing start jitter from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN jitter_seconds;
+
+-- +goose StatementEnd
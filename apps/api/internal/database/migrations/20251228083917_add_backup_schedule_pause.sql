@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding pausing to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN paused BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE backup_schedules ADD COLUMN paused_at TEXT;
+ALTER TABLE backup_schedules ADD COLUMN pause_reason TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing pausing from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN pause_reason;
+ALTER TABLE backup_schedules DROP COLUMN paused_at;
+ALTER TABLE backup_schedules DROP COLUMN paused;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding concurrency policies to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN concurrency_policy TEXT NOT NULL DEFAULT 'queue';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing concurrency policies from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN concurrency_policy;
+
+-- +goose StatementEnd
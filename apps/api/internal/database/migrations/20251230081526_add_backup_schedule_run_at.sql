@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding one-shot run times to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN run_at TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing one-shot run times from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN run_at;
+
+-- +goose StatementEnd
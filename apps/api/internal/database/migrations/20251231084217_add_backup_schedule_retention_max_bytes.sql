@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding storage quotas to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN retention_max_bytes INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing storage quotas from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN retention_max_bytes;
+
+-- +goose StatementEnd
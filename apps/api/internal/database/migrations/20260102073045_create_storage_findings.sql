@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding storage reconciliation findings';
+
+CREATE TABLE storage_findings (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    connection_id TEXT,
+    kind TEXT NOT NULL, -- orphan_file or ghost_record
+    backend TEXT NOT NULL, -- local or s3
+    location TEXT NOT NULL,
+    backup_id TEXT,
+    size INTEGER NOT NULL DEFAULT 0,
+    modified_at TEXT,
+    detected_at TEXT NOT NULL,
+    resolved_at TEXT,
+    resolution TEXT
+);
+
+CREATE INDEX idx_storage_findings_user_id ON storage_findings(user_id, resolved_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing storage reconciliation findings';
+
+DROP TABLE storage_findings;
+
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding Discord notifications';
+
+ALTER TABLE user_settings ADD COLUMN notify_discord BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE user_settings ADD COLUMN discord_webhook_url TEXT;
+ALTER TABLE user_settings ADD COLUMN discord_notify_success BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE backup_schedules ADD COLUMN discord_webhook_url TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing Discord notifications';
+
+ALTER TABLE backup_schedules DROP COLUMN discord_webhook_url;
+ALTER TABLE user_settings DROP COLUMN discord_notify_success;
+ALTER TABLE user_settings DROP COLUMN discord_webhook_url;
+ALTER TABLE user_settings DROP COLUMN notify_discord;
+
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding SMTP security and email recipients to user settings';
+
+ALTER TABLE user_settings ADD COLUMN smtp_security TEXT;
+ALTER TABLE user_settings ADD COLUMN email_recipients TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing SMTP security and email recipients from user settings';
+
+ALTER TABLE user_settings DROP COLUMN email_recipients;
+ALTER TABLE user_settings DROP COLUMN smtp_security;
+
+-- +goose StatementEnd
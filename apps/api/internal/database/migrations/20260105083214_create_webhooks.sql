@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding outbound webhooks';
+
+CREATE TABLE webhooks (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    url TEXT NOT NULL,
+    events TEXT NOT NULL, -- JSON array of event names
+    payload_template TEXT,
+    content_type TEXT NOT NULL DEFAULT 'application/json',
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    secret TEXT NOT NULL, -- encrypted
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_webhooks_user_id ON webhooks(user_id);
+
+CREATE TABLE webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    webhook_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+    status TEXT NOT NULL, -- delivered, retrying or failed
+    status_code INTEGER,
+    error TEXT,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    payload TEXT NOT NULL,
+    response TEXT,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing outbound webhooks';
+
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
+
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding PagerDuty and Opsgenie incidents';
+
+ALTER TABLE user_settings ADD COLUMN notify_pagerduty BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE user_settings ADD COLUMN pagerduty_routing_key TEXT;
+ALTER TABLE user_settings ADD COLUMN notify_opsgenie BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE user_settings ADD COLUMN opsgenie_api_key TEXT;
+ALTER TABLE user_settings ADD COLUMN opsgenie_region TEXT;
+
+CREATE TABLE incidents (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    connection_id TEXT NOT NULL,
+    kind TEXT NOT NULL, -- backup_failed or rpo_violated
+    dedup_key TEXT NOT NULL,
+    summary TEXT NOT NULL,
+    triggered_at TEXT NOT NULL,
+    resolved_at TEXT
+);
+
+CREATE INDEX idx_incidents_open ON incidents(connection_id, kind, resolved_at);
+CREATE INDEX idx_incidents_user_id ON incidents(user_id, triggered_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing PagerDuty and Opsgenie incidents';
+
+DROP TABLE incidents;
+
+ALTER TABLE user_settings DROP COLUMN opsgenie_region;
+ALTER TABLE user_settings DROP COLUMN opsgenie_api_key;
+ALTER TABLE user_settings DROP COLUMN notify_opsgenie;
+ALTER TABLE user_settings DROP COLUMN pagerduty_routing_key;
+ALTER TABLE user_settings DROP COLUMN notify_pagerduty;
+
+-- +goose StatementEnd
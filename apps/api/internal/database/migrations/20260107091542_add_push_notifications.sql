@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding ntfy and Gotify push notifications';
+
+ALTER TABLE user_settings ADD COLUMN notify_ntfy BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE user_settings ADD COLUMN ntfy_server_url TEXT;
+ALTER TABLE user_settings ADD COLUMN ntfy_topic TEXT;
+ALTER TABLE user_settings ADD COLUMN ntfy_token TEXT;
+ALTER TABLE user_settings ADD COLUMN notify_gotify BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE user_settings ADD COLUMN gotify_server_url TEXT;
+ALTER TABLE user_settings ADD COLUMN gotify_token TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing ntfy and Gotify push notifications';
+
+ALTER TABLE user_settings DROP COLUMN gotify_token;
+ALTER TABLE user_settings DROP COLUMN gotify_server_url;
+ALTER TABLE user_settings DROP COLUMN notify_gotify;
+ALTER TABLE user_settings DROP COLUMN ntfy_token;
+ALTER TABLE user_settings DROP COLUMN ntfy_topic;
+ALTER TABLE user_settings DROP COLUMN ntfy_server_url;
+ALTER TABLE user_settings DROP COLUMN notify_ntfy;
+
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding Matrix notifications';
+
+ALTER TABLE user_settings ADD COLUMN notify_matrix BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE user_settings ADD COLUMN matrix_homeserver_url TEXT;
+ALTER TABLE user_settings ADD COLUMN matrix_access_token TEXT;
+ALTER TABLE user_settings ADD COLUMN matrix_room_id TEXT;
+ALTER TABLE user_settings ADD COLUMN matrix_notify_success BOOLEAN NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing Matrix notifications';
+
+ALTER TABLE user_settings DROP COLUMN matrix_notify_success;
+ALTER TABLE user_settings DROP COLUMN matrix_room_id;
+ALTER TABLE user_settings DROP COLUMN matrix_access_token;
+ALTER TABLE user_settings DROP COLUMN matrix_homeserver_url;
+ALTER TABLE user_settings DROP COLUMN notify_matrix;
+
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Creating notification rules';
+
+CREATE TABLE notification_rules (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    connection_id TEXT, -- NULL applies the rule to every connection of the user
+    condition TEXT NOT NULL, -- failure, consecutive_failures, size_deviation or no_backup
+    threshold INTEGER NOT NULL DEFAULT 0,
+    window_hours INTEGER NOT NULL DEFAULT 0,
+    channels TEXT NOT NULL, -- JSON array of {type, target}
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_notification_rules_user_id ON notification_rules(user_id);
+CREATE INDEX idx_notification_rules_condition ON notification_rules(condition, enabled);
+
+CREATE TABLE notification_rule_events (
+    id TEXT PRIMARY KEY,
+    rule_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    connection_id TEXT NOT NULL,
+    message TEXT NOT NULL,
+    triggered_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_notification_rule_events_rule ON notification_rule_events(rule_id, connection_id, triggered_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Dropping notification rules';
+
+DROP TABLE notification_rule_events;
+DROP TABLE notification_rules;
+
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding weekly and Slack digests';
+
+ALTER TABLE user_settings ADD COLUMN digest_frequency TEXT NOT NULL DEFAULT 'daily';
+ALTER TABLE user_settings ADD COLUMN digest_weekday INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE user_settings ADD COLUMN digest_slack_webhook_url TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing weekly and Slack digests';
+
+ALTER TABLE user_settings DROP COLUMN digest_slack_webhook_url;
+ALTER TABLE user_settings DROP COLUMN digest_weekday;
+ALTER TABLE user_settings DROP COLUMN digest_frequency;
+
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding heartbeat_url to backup_schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN heartbeat_url TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing heartbeat_url from backup_schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN heartbeat_url;
+
+-- +goose StatementEnd
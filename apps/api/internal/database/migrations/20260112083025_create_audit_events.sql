@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Creating audit events';
+
+CREATE TABLE audit_events (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL, -- kept as text so events outlive the user
+    username TEXT,
+    impersonator TEXT,
+    action TEXT NOT NULL,
+    resource_type TEXT NOT NULL,
+    resource_id TEXT,
+    detail TEXT,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    remote_addr TEXT NOT NULL,
+    user_agent TEXT,
+    created_at TEXT NOT NULL -- UTC
+);
+
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at);
+CREATE INDEX idx_audit_events_user ON audit_events(user_id, created_at);
+CREATE INDEX idx_audit_events_action ON audit_events(action, created_at);
+CREATE INDEX idx_audit_events_resource ON audit_events(resource_type, resource_id, created_at);
+
+-- Events are append-only
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit events cannot be changed');
+END;
+
+CREATE TRIGGER audit_events_no_delete BEFORE DELETE ON audit_events
+BEGIN
+    SELECT RAISE(ABORT, 'audit events cannot be deleted');
+END;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Dropping audit events';
+
+DROP TRIGGER audit_events_no_delete;
+DROP TRIGGER audit_events_no_update;
+DROP TABLE audit_events;
+
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding size anomaly detection to backups';
+
+ALTER TABLE backups ADD COLUMN suspect INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backups ADD COLUMN suspect_reason TEXT;
+ALTER TABLE backup_schedules ADD COLUMN size_anomaly_percent INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing size anomaly detection from backups';
+
+ALTER TABLE backups DROP COLUMN suspect;
+ALTER TABLE backups DROP COLUMN suspect_reason;
+ALTER TABLE backup_schedules DROP COLUMN size_anomaly_percent;
+
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding run logs';
+
+CREATE TABLE run_logs (
+    id TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    connection_id TEXT NOT NULL,
+    lines INTEGER NOT NULL DEFAULT 0,
+    size INTEGER NOT NULL DEFAULT 0,
+    compressed_size INTEGER NOT NULL DEFAULT 0,
+    truncated INTEGER NOT NULL DEFAULT 0,
+    started_at TEXT NOT NULL,
+    finished_at TEXT NOT NULL,
+    FOREIGN KEY (connection_id) REFERENCES connections(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_run_logs_connection_id ON run_logs(connection_id);
+CREATE INDEX idx_run_logs_finished_at ON run_logs(finished_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing run logs';
+
+DROP TABLE run_logs;
+
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding verification objective to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN verification_objective_minutes INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_backup_runs_connection_status ON backup_runs(connection_id, status);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing verification objective from backup schedules';
+
+DROP INDEX idx_backup_runs_connection_status;
+ALTER TABLE backup_schedules DROP COLUMN verification_objective_minutes;
+
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding teams';
+
+CREATE TABLE teams (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+CREATE TABLE team_members (
+    team_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL, -- admin or member
+    created_at TEXT NOT NULL,
+    PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX idx_team_members_user_id ON team_members(user_id);
+
+-- Schedules and backups belong to the team of their connection
+ALTER TABLE connections ADD COLUMN team_id TEXT;
+
+CREATE INDEX idx_connections_team_id ON connections(team_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing teams';
+
+DROP INDEX idx_connections_team_id;
+ALTER TABLE connections DROP COLUMN team_id;
+
+DROP TABLE team_members;
+DROP TABLE teams;
+
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding password reset and email verification';
+
+ALTER TABLE users ADD COLUMN email TEXT;
+ALTER TABLE users ADD COLUMN email_verified_at TEXT;
+
+CREATE UNIQUE INDEX idx_users_email ON users(email) WHERE email IS NOT NULL;
+
+-- Only the SHA-256 hash of a token is stored; the token itself is emailed
+CREATE TABLE auth_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    kind TEXT NOT NULL, -- password_reset or email_verification
+    token_hash TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    used_at TEXT,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_auth_tokens_user_id ON auth_tokens(user_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing password reset and email verification';
+
+DROP TABLE auth_tokens;
+
+DROP INDEX idx_users_email;
+ALTER TABLE users DROP COLUMN email_verified_at;
+ALTER TABLE users DROP COLUMN email;
+
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding refresh tokens';
+
+-- Every sign-in starts a family of refresh tokens. Refreshing rotates the
+-- newest token into a new one; presenting a rotated token revokes the family.
+CREATE TABLE refresh_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    family_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    user_agent TEXT,
+    remote_addr TEXT,
+    expires_at TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    rotated_at TEXT,
+    revoked_at TEXT,
+    revoked_reason TEXT
+);
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing refresh tokens';
+
+DROP TABLE refresh_tokens;
+
+-- +goose StatementEnd
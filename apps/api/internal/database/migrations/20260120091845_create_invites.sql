@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding invites';
+
+-- Invites let people sign up while registration is closed. Only the SHA-256
+-- hash of an invite's token is stored.
+CREATE TABLE invites (
+    id TEXT PRIMARY KEY,
+    token_hash TEXT NOT NULL UNIQUE,
+    email TEXT,
+    team_id TEXT,
+    team_role TEXT, -- admin or member, set with team_id
+    created_by TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    used_at TEXT,
+    used_by TEXT,
+    revoked_at TEXT
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing invites';
+
+DROP TABLE invites;
+
+-- +goose StatementEnd
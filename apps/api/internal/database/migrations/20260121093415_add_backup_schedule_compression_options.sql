@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding compression level and threads to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN compression_level INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE backup_schedules ADD COLUMN compression_threads INTEGER NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing compression level and threads from backup schedules';
+
+ALTER TABLE backup_schedules DROP COLUMN compression_threads;
+ALTER TABLE backup_schedules DROP COLUMN compression_level;
+
+-- +goose StatementEnd
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+)
+
+// heartbeatInterval keeps idle streams open through proxies
+const heartbeatInterval = 15 * time.Second
+
+type EventHandler struct {
+	service *EventService
+}
+
+func NewEventHandler(service *EventService) *EventHandler {
+	return &EventHandler{service: service}
+}
+
+// parseTypes reads the comma-separated types a stream is filtered by; none
+// streams every type
+func parseTypes(value string) (map[Type]bool, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	types := make(map[Type]bool)
+	for _, name := range strings.Split(value, ",") {
+		eventType := Type(strings.TrimSpace(name))
+		if !knownTypes[eventType] {
+			return nil, fmt.Errorf("unknown event type: %s", eventType)
+		}
+		types[eventType] = true
+	}
+	return types, nil
+}
+
+// StreamEvents streams the user's events as server-sent events named after
+// their type. ?types= filters them by a comma-separated list of types. A
+// client reconnecting with Last-Event-ID, or ?last_event_id=, first gets the
+// recent events it missed.
+func (h *EventHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	types, err := parseTypes(r.URL.Query().Get("types"))
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		lastID, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastID < 0 {
+			response.SendError(w, http.StatusBadRequest, "invalid last event ID")
+			return
+		}
+	}
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sub, missed := h.service.subscribe(userID, lastID)
+	defer h.service.unsubscribe(sub)
+
+	send := func(event Event) {
+		if types != nil && !types[event.Type] {
+			return
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: %s\nid: %d\ndata: %s\n\n", event.Type, event.ID, data)
+	}
+
+	for _, event := range missed {
+		send(event)
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			send(event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
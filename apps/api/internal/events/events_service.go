@@ -0,0 +1,108 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// recentEvents is how many events are kept for clients that reconnect
+	// with the ID of the last event they saw
+	recentEvents = 256
+	// subscriberBuffer is how many events a client may fall behind before it
+	// is disconnected; it catches up by reconnecting
+	subscriberBuffer = 64
+)
+
+// EventService broadcasts events to the streams of the users they concern.
+// Events are not stored: they are only kept in memory for a while, so
+// clients that drop their connection can catch up.
+type EventService struct {
+	mu          sync.Mutex
+	lastID      int64
+	recent      []Event
+	subscribers map[*subscriber]bool
+}
+
+// subscriber is an open stream of a user
+type subscriber struct {
+	userID uuid.UUID
+	events chan Event
+}
+
+func NewEventService() *EventService {
+	return &EventService{subscribers: make(map[*subscriber]bool)}
+}
+
+// Publish broadcasts an event to the user's streams without waiting for
+// them. A nil service publishes nothing.
+func (s *EventService) Publish(userID uuid.UUID, eventType Type, data map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	event := Event{
+		ID:        s.lastID,
+		Type:      eventType,
+		Timestamp: time.Now(),
+		Data:      data,
+		userID:    userID,
+	}
+	s.recent = append(s.recent, event)
+	if len(s.recent) > recentEvents {
+		s.recent = s.recent[len(s.recent)-recentEvents:]
+	}
+
+	for sub := range s.subscribers {
+		if sub.userID != userID {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// A client that can't keep up reconnects and catches up from
+			// the recent events
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// subscribe opens a stream of the user's events. The user's recent events
+// after lastID are returned to be sent first; a lastID of 0 skips them.
+func (s *EventService) subscribe(userID uuid.UUID, lastID int64) (*subscriber, []Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var missed []Event
+	if lastID > 0 {
+		for _, event := range s.recent {
+			if event.ID > lastID && event.userID == userID {
+				missed = append(missed, event)
+			}
+		}
+	}
+
+	sub := &subscriber{userID: userID, events: make(chan Event, subscriberBuffer)}
+	s.subscribers[sub] = true
+	return sub, missed
+}
+
+func (s *EventService) unsubscribe(sub *subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.subscribers[sub] {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Type is what happened
+type Type string
+
+const (
+	TypeBackupStarted     Type = "backup.started"
+	TypeBackupFinished    Type = "backup.finished"
+	TypeRestoreStarted    Type = "restore.started"
+	TypeRestoreFinished   Type = "restore.finished"
+	TypeScheduleCreated   Type = "schedule.created"
+	TypeScheduleUpdated   Type = "schedule.updated"
+	TypeScheduleDisabled  Type = "schedule.disabled"
+	TypeSchedulePaused    Type = "schedule.paused"
+	TypeScheduleResumed   Type = "schedule.resumed"
+	TypeConnectionAdded   Type = "connection.added"
+	TypeConnectionUpdated Type = "connection.updated"
+	TypeConnectionRemoved Type = "connection.removed"
+	// TypeRetentionPruned is published when backups were deleted by
+	// retention or a storage quota
+	TypeRetentionPruned Type = "retention.pruned"
+)
+
+// knownTypes are the types a stream can be filtered by
+var knownTypes = map[Type]bool{
+	TypeBackupStarted:     true,
+	TypeBackupFinished:    true,
+	TypeRestoreStarted:    true,
+	TypeRestoreFinished:   true,
+	TypeScheduleCreated:   true,
+	TypeScheduleUpdated:   true,
+	TypeScheduleDisabled:  true,
+	TypeSchedulePaused:    true,
+	TypeScheduleResumed:   true,
+	TypeConnectionAdded:   true,
+	TypeConnectionUpdated: true,
+	TypeConnectionRemoved: true,
+	TypeRetentionPruned:   true,
+}
+
+// Event is a change to the user's connections, schedules or backups. IDs
+// grow with every event published since the server started.
+type Event struct {
+	ID        int64                  `json:"id"`
+	Type      Type                   `json:"type"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data"`
+
+	userID uuid.UUID
+}
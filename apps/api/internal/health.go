@@ -1,16 +1,42 @@
 package internal
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
+
+	"github.com/dendianugerah/velld/internal/backup"
+	"github.com/dendianugerah/velld/internal/common"
+)
+
+// Statuses of a dependency in the probes. A degraded dependency is reported
+// without failing the probe.
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+const (
+	// probeTimeout bounds the checks of one probe
+	probeTimeout = 10 * time.Second
+	// storageCheckTTL is how long a storage check is reused, so frequent
+	// probes don't hit every bucket each time
+	storageCheckTTL = 30 * time.Second
 )
 
 type HealthHandler struct {
-	startTime time.Time
-	db        *sql.DB
+	startTime     time.Time
+	db            *sql.DB
+	backupService *backup.BackupService
+
+	storageMu      sync.Mutex
+	storageChecked time.Time
+	storageStatus  DependencyStatus
 }
 
 type ComponentHealth struct {
@@ -29,10 +55,24 @@ type HealthResponse struct {
 	Details HealthDetails `json:"details"`
 }
 
-func NewHealthHandler(db *sql.DB) *HealthHandler {
+// DependencyStatus is the state of one dependency in /healthz and /readyz
+type DependencyStatus struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type ProbeResponse struct {
+	Status  string                      `json:"status"`
+	Version string                      `json:"version"`
+	Checks  map[string]DependencyStatus `json:"checks"`
+}
+
+func NewHealthHandler(db *sql.DB, backupService *backup.BackupService) *HealthHandler {
 	return &HealthHandler{
-		startTime: time.Now(),
-		db:        db,
+		startTime:     time.Now(),
+		db:            db,
+		backupService: backupService,
 	}
 }
 
@@ -54,7 +94,7 @@ func (h *HealthHandler) CheckHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := HealthResponse{
-		Version: "v0.1.0",
+		Version: common.Version,
 		Status:  "up",
 		Uptime:  fmt.Sprintf("%dd %dh %dm", days, hours, minutes),
 		Details: HealthDetails{
@@ -73,3 +113,120 @@ func (h *HealthHandler) CheckHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+func (h *HealthHandler) checkDatabase(ctx context.Context) DependencyStatus {
+	if err := h.db.PingContext(ctx); err != nil {
+		return DependencyStatus{Status: StatusDown, Message: err.Error()}
+	}
+	var version string
+	if err := h.db.QueryRowContext(ctx, "SELECT sqlite_version()").Scan(&version); err != nil {
+		return DependencyStatus{Status: StatusDown, Message: err.Error()}
+	}
+	return DependencyStatus{Status: StatusUp}
+}
+
+func (h *HealthHandler) checkScheduler() DependencyStatus {
+	beat := h.backupService.SchedulerHeartbeat()
+	status := DependencyStatus{Status: StatusUp, Details: map[string]time.Time{"last_heartbeat": beat}}
+	if h.backupService.SchedulerStale() {
+		status.Status = StatusDown
+		status.Message = fmt.Sprintf("no heartbeat for %s", time.Since(beat).Round(time.Second))
+	}
+	return status
+}
+
+// checkStorage reports the backup directory down when it takes no writes,
+// and storage degraded when S3 buckets are unreachable, as backups are
+// still written locally
+func (h *HealthHandler) checkStorage(ctx context.Context) DependencyStatus {
+	h.storageMu.Lock()
+	defer h.storageMu.Unlock()
+	if time.Since(h.storageChecked) < storageCheckTTL {
+		return h.storageStatus
+	}
+
+	storage, err := h.backupService.CheckStorage(ctx)
+	switch {
+	case err != nil:
+		h.storageStatus = DependencyStatus{Status: StatusDown, Message: err.Error()}
+	case !storage.LocalWritable:
+		h.storageStatus = DependencyStatus{Status: StatusDown, Message: "backup directory is not writable", Details: storage}
+	case storage.Unreachable > 0:
+		h.storageStatus = DependencyStatus{
+			Status:  StatusDegraded,
+			Message: fmt.Sprintf("%d of %d S3 buckets are unavailable", storage.Unreachable, storage.Buckets),
+			Details: storage,
+		}
+	default:
+		h.storageStatus = DependencyStatus{Status: StatusUp, Details: storage}
+	}
+	h.storageChecked = time.Now()
+	return h.storageStatus
+}
+
+// checkNotifications reports channels turned on without their settings as
+// degraded; alerts through them are lost, but backups still run
+func (h *HealthHandler) checkNotifications() DependencyStatus {
+	notifications, err := h.backupService.CheckNotifications()
+	if err != nil {
+		return DependencyStatus{Status: StatusDown, Message: err.Error()}
+	}
+	if len(notifications.Problems) > 0 {
+		return DependencyStatus{Status: StatusDegraded, Message: "notification channels are incomplete", Details: notifications}
+	}
+	return DependencyStatus{Status: StatusUp, Details: notifications}
+}
+
+// sendProbe answers 503 when any check is down
+func sendProbe(w http.ResponseWriter, checks map[string]DependencyStatus) {
+	response := ProbeResponse{Status: StatusUp, Version: common.Version, Checks: checks}
+	for _, check := range checks {
+		if check.Status == StatusDown {
+			response.Status = StatusDown
+			break
+		}
+		if check.Status == StatusDegraded {
+			response.Status = StatusDegraded
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status == StatusDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Liveness checks the metadata database and the scheduler, the parts a
+// restart can fix
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+	defer cancel()
+
+	sendProbe(w, map[string]DependencyStatus{
+		"database":  h.checkDatabase(ctx),
+		"scheduler": h.checkScheduler(),
+	})
+}
+
+// Readiness checks every dependency backups need: the metadata database,
+// the scheduler, the backup storage and the notification channels
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+	defer cancel()
+
+	checks := map[string]DependencyStatus{
+		"database":  h.checkDatabase(ctx),
+		"scheduler": h.checkScheduler(),
+	}
+	// The other checks read the metadata database
+	if checks["database"].Status == StatusDown {
+		sendProbe(w, checks)
+		return
+	}
+	checks["storage"] = h.checkStorage(ctx)
+	checks["notifications"] = h.checkNotifications()
+	sendProbe(w, checks)
+}
@@ -0,0 +1,241 @@
+package internal
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	defaultHousekeepingSchedule = "0 0 * * * *"
+	defaultTempDirMaxMB         = 1024
+	defaultLogDirMaxMB          = 100
+	// Files modified more recently than this may still be in use
+	pruneGracePeriod = 10 * time.Minute
+)
+
+// tempDirPattern matches the working directories velld creates under the
+// system temp dir (S3 downloads, decompressed dumps, ...).
+const tempDirPattern = "velld-*"
+
+type DirectoryUsage struct {
+	Path           string `json:"path"`
+	LimitBytes     int64  `json:"limit_bytes"`
+	SizeBytes      int64  `json:"size_bytes"`
+	FilesRemoved   int    `json:"files_removed"`
+	BytesReclaimed int64  `json:"bytes_reclaimed"`
+}
+
+type HousekeepingRun struct {
+	StartedAt      time.Time         `json:"started_at"`
+	Directories    []*DirectoryUsage `json:"directories"`
+	FilesRemoved   int               `json:"files_removed"`
+	BytesReclaimed int64             `json:"bytes_reclaimed"`
+}
+
+type HousekeepingMetrics struct {
+	Runs                int              `json:"runs"`
+	TotalFilesRemoved   int              `json:"total_files_removed"`
+	TotalBytesReclaimed int64            `json:"total_bytes_reclaimed"`
+	LastRun             *HousekeepingRun `json:"last_run"`
+}
+
+// Housekeeper keeps velld's temp working directories and log directory under
+// a size cap by removing the oldest files first.
+type Housekeeper struct {
+	mu          sync.Mutex
+	cronManager *cron.Cron
+	entry       cron.EntryID
+	metrics     HousekeepingMetrics
+}
+
+func NewHousekeeper() *Housekeeper {
+	hk := &Housekeeper{
+		cronManager: cron.New(cron.WithSeconds()),
+	}
+
+	hk.Schedule()
+	hk.cronManager.Start()
+	return hk
+}
+
+// Schedule (re)registers the pruning job. HOUSEKEEPING_SCHEDULE takes a cron
+// expression (with seconds) or "off".
+func (hk *Housekeeper) Schedule() {
+	hk.mu.Lock()
+	defer hk.mu.Unlock()
+
+	if hk.entry != 0 {
+		hk.cronManager.Remove(hk.entry)
+		hk.entry = 0
+	}
+
+	schedule := strings.TrimSpace(os.Getenv("HOUSEKEEPING_SCHEDULE"))
+	if strings.EqualFold(schedule, "off") {
+		return
+	}
+	if schedule == "" {
+		schedule = defaultHousekeepingSchedule
+	}
+
+	entryID, err := hk.cronManager.AddFunc(schedule, func() {
+		if _, err := hk.Run(); err != nil {
+			slog.Error("Housekeeping failed", "error", err)
+		}
+	})
+	if err != nil {
+		slog.Error("Failed to schedule housekeeping", "error", err)
+		return
+	}
+	hk.entry = entryID
+}
+
+// Run prunes every managed directory once and records the reclaimed space
+func (hk *Housekeeper) Run() (*HousekeepingRun, error) {
+	hk.mu.Lock()
+	defer hk.mu.Unlock()
+
+	run := &HousekeepingRun{
+		StartedAt:   time.Now(),
+		Directories: []*DirectoryUsage{},
+	}
+
+	tempLimit := envMegabytes("TEMP_DIR_MAX_MB", defaultTempDirMaxMB)
+	tempDirs, err := filepath.Glob(filepath.Join(os.TempDir(), tempDirPattern))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list temp directories: %v", err)
+	}
+	for _, dir := range tempDirs {
+		usage, err := pruneDirectory(dir, tempLimit, false)
+		if err != nil {
+			slog.Warn("Failed to prune directory", "path", dir, "error", err)
+			continue
+		}
+		run.Directories = append(run.Directories, usage)
+	}
+
+	// The newest log file is the one being written, so it is never removed
+	if logDir := strings.TrimSpace(os.Getenv("LOG_DIR")); logDir != "" {
+		usage, err := pruneDirectory(logDir, envMegabytes("LOG_DIR_MAX_MB", defaultLogDirMaxMB), true)
+		if err != nil {
+			slog.Warn("Failed to prune directory", "path", logDir, "error", err)
+		} else {
+			run.Directories = append(run.Directories, usage)
+		}
+	}
+
+	for _, usage := range run.Directories {
+		run.FilesRemoved += usage.FilesRemoved
+		run.BytesReclaimed += usage.BytesReclaimed
+	}
+
+	hk.metrics.Runs++
+	hk.metrics.TotalFilesRemoved += run.FilesRemoved
+	hk.metrics.TotalBytesReclaimed += run.BytesReclaimed
+	hk.metrics.LastRun = run
+
+	if run.FilesRemoved > 0 {
+		slog.Info("Housekeeping completed", "files_removed", run.FilesRemoved, "bytes_reclaimed", run.BytesReclaimed)
+	}
+
+	return run, nil
+}
+
+func (hk *Housekeeper) Metrics() HousekeepingMetrics {
+	hk.mu.Lock()
+	defer hk.mu.Unlock()
+	return hk.metrics
+}
+
+type prunableFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// pruneDirectory removes the oldest files under dir until its total size is
+// within limit. Recently modified files are skipped as they may be in use.
+func pruneDirectory(dir string, limit int64, keepNewest bool) (*DirectoryUsage, error) {
+	usage := &DirectoryUsage{Path: dir, LimitBytes: limit}
+
+	var files []prunableFile
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, prunableFile{path: path, size: info.Size(), modTime: info.ModTime()})
+			usage.SizeBytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return usage, nil
+		}
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	if keepNewest && len(files) > 0 {
+		files = files[:len(files)-1]
+	}
+
+	cutoff := time.Now().Add(-pruneGracePeriod)
+	for _, file := range files {
+		if usage.SizeBytes <= limit {
+			break
+		}
+		if file.modTime.After(cutoff) {
+			continue
+		}
+		if err := os.Remove(file.path); err != nil {
+			slog.Warn("Failed to remove file", "path", file.path, "error", err)
+			continue
+		}
+		usage.SizeBytes -= file.size
+		usage.FilesRemoved++
+		usage.BytesReclaimed += file.size
+	}
+
+	return usage, nil
+}
+
+func envMegabytes(key string, fallback int) int64 {
+	sizeMB := fallback
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			slog.Warn("Invalid size setting, using the default", "key", key, "value", value, "default_mb", fallback)
+		} else {
+			sizeMB = parsed
+		}
+	}
+	return int64(sizeMB) * 1024 * 1024
+}
+
+func (hk *Housekeeper) HandleGetMetrics(w http.ResponseWriter, r *http.Request) {
+	response.SendSuccess(w, "Housekeeping metrics retrieved successfully", hk.Metrics())
+}
+
+func (hk *Housekeeper) HandleRun(w http.ResponseWriter, r *http.Request) {
+	run, err := hk.Run()
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Housekeeping completed successfully", run)
+}
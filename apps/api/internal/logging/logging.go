@@ -0,0 +1,136 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Defaults of the log file rotation
+const (
+	defaultMaxSizeMB  = 100
+	defaultMaxBackups = 5
+)
+
+type jobIDKey struct{}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// WithJobID returns a context whose log lines carry the ID of a backup run
+// or restore as job_id
+func WithJobID(ctx context.Context, jobID string) context.Context {
+	return context.WithValue(ctx, jobIDKey{}, jobID)
+}
+
+// JobID returns the job ID of a context, if it has one
+func JobID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	jobID, _ := ctx.Value(jobIDKey{}).(string)
+	return jobID
+}
+
+// jobHandler adds the job ID of the context to each record
+type jobHandler struct {
+	slog.Handler
+}
+
+func (h jobHandler) Handle(ctx context.Context, record slog.Record) error {
+	if jobID := JobID(ctx); jobID != "" {
+		record.AddAttrs(slog.String("job_id", jobID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h jobHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return jobHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h jobHandler) WithGroup(name string) slog.Handler {
+	return jobHandler{h.Handler.WithGroup(name)}
+}
+
+// parseLevel reads LOG_LEVEL: debug, info, warn or error
+func parseLevel(raw string) (slog.Level, error) {
+	var level slog.Level
+	if raw == "" {
+		return slog.LevelInfo, nil
+	}
+	if strings.EqualFold(raw, "warning") {
+		raw = "warn"
+	}
+	if err := level.UnmarshalText([]byte(raw)); err != nil {
+		return 0, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error")
+	}
+	return level, nil
+}
+
+func envInt(name string, fallback int) (int, error) {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number", name)
+	}
+	return value, nil
+}
+
+// Setup makes slog's default logger, which the standard log package writes
+// through too, follow LOG_LEVEL and LOG_FORMAT. With LOG_FILE set, lines are
+// also written to that file, rotated at LOG_FILE_MAX_SIZE_MB keeping
+// LOG_FILE_MAX_BACKUPS old files. The returned closer closes the file.
+func Setup() (io.Closer, error) {
+	level, err := parseLevel(strings.TrimSpace(os.Getenv("LOG_LEVEL")))
+	if err != nil {
+		return nil, err
+	}
+
+	var out io.Writer = os.Stdout
+	var closer io.Closer = nopCloser{}
+	if path := strings.TrimSpace(os.Getenv("LOG_FILE")); path != "" {
+		maxSizeMB, err := envInt("LOG_FILE_MAX_SIZE_MB", defaultMaxSizeMB)
+		if err != nil {
+			return nil, err
+		}
+		maxBackups, err := envInt("LOG_FILE_MAX_BACKUPS", defaultMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		file, err := newRotatingFile(path, int64(maxSizeMB)*1024*1024, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out = io.MultiWriter(os.Stdout, file)
+		closer = file
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format := strings.ToLower(strings.TrimSpace(os.Getenv("LOG_FORMAT"))); format {
+	case "", FormatText:
+		handler = slog.NewTextHandler(out, options)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, options)
+	default:
+		closer.Close()
+		return nil, fmt.Errorf("LOG_FORMAT must be %s or %s", FormatText, FormatJSON)
+	}
+
+	slog.SetDefault(slog.New(jobHandler{handler}))
+	return closer, nil
+}
@@ -1,101 +1,204 @@
 package mail
 
 import (
+	"bytes"
 	"crypto/tls"
 	"fmt"
-	"log"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
 	"net"
 	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Connection security of the SMTP server
+const (
+	// SecurityStartTLS upgrades a plain connection with STARTTLS, usually on
+	// port 587. It is the default.
+	SecurityStartTLS = "starttls"
+	// SecurityTLS speaks TLS from the start, usually on port 465
+	SecurityTLS = "tls"
+	// SecurityNone sends in the clear, for relays on the local network.
+	// Credentials are only sent to localhost without encryption.
+	SecurityNone = "none"
+)
+
+// dialTimeout bounds connecting to the SMTP server
+const dialTimeout = 30 * time.Second
+
 type SMTPConfig struct {
 	Host     string
 	Port     int
 	Username string
 	Password string
+	// Security is starttls, tls or none; empty means starttls
+	Security string
 }
 
 type Message struct {
 	From    string
-	To      string
+	To      []string
 	Subject string
-	Body    string
+	// Body is the plain text of the message
+	Body string
+	// HTMLBody is sent alongside Body as an alternative when set
+	HTMLBody string
+}
+
+// ValidateSecurity checks a connection security setting; empty is the
+// default
+func ValidateSecurity(security string) error {
+	switch security {
+	case "", SecurityStartTLS, SecurityTLS, SecurityNone:
+		return nil
+	default:
+		return fmt.Errorf("smtp security must be %s, %s or %s", SecurityStartTLS, SecurityTLS, SecurityNone)
+	}
 }
 
 func SendEmail(config *SMTPConfig, msg *Message) error {
-	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
-	auth := smtp.PlainAuth("", config.Username, config.Password, config.Host)
-
-	emailMsg := fmt.Sprintf("From: %s\r\n"+
-		"To: %s\r\n"+
-		"Subject: %s\r\n"+
-		"MIME-Version: 1.0\r\n"+
-		"Content-Type: text/plain; charset=utf-8\r\n"+
-		"\r\n"+
-		"%s\r\n", msg.From, msg.To, msg.Subject, msg.Body)
-
-	conn, err := net.Dial("tcp", addr)
+	if len(msg.To) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+	if err := ValidateSecurity(config.Security); err != nil {
+		return err
+	}
+
+	emailMsg, err := buildMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+	tlsConfig := &tls.Config{
+		ServerName:         config.Host,
+		InsecureSkipVerify: false,
+	}
+
+	var conn net.Conn
+	if config.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, dialTimeout)
+	}
 	if err != nil {
-		log.Printf("Failed to connect to SMTP server: %v", err)
+		slog.Error("Failed to connect to SMTP server", "error", err)
 		return err
 	}
 	defer conn.Close()
 
 	client, err := smtp.NewClient(conn, config.Host)
 	if err != nil {
-		log.Printf("Failed to create SMTP client: %v", err)
+		slog.Error("Failed to create SMTP client", "error", err)
 		return err
 	}
 	defer client.Close()
 
 	if err = client.Hello("localhost"); err != nil {
-		log.Printf("Failed to send EHLO: %v", err)
+		slog.Error("Failed to send EHLO", "error", err)
 		return err
 	}
 
-	tlsConfig := &tls.Config{
-		ServerName:         config.Host,
-		InsecureSkipVerify: false,
+	if config.Security == "" || config.Security == SecurityStartTLS {
+		if err = client.StartTLS(tlsConfig); err != nil {
+			slog.Error("Failed to start TLS", "error", err)
+			return err
+		}
 	}
 
-	if err = client.StartTLS(tlsConfig); err != nil {
-		log.Printf("Failed to start TLS: %v", err)
-		return err
-	}
-
-	if err = client.Auth(auth); err != nil {
-		log.Printf("Failed to authenticate: %v", err)
-		return err
+	// Relays that accept mail without authentication need no username
+	if config.Username != "" {
+		auth := smtp.PlainAuth("", config.Username, config.Password, config.Host)
+		if err = client.Auth(auth); err != nil {
+			slog.Error("Failed to authenticate", "error", err)
+			return err
+		}
 	}
 
 	if err = client.Mail(msg.From); err != nil {
-		log.Printf("Failed to set sender: %v", err)
+		slog.Error("Failed to set sender", "error", err)
 		return err
 	}
 
-	if err = client.Rcpt(msg.To); err != nil {
-		log.Printf("Failed to set recipient: %v", err)
-		return err
+	for _, to := range msg.To {
+		if err = client.Rcpt(to); err != nil {
+			slog.Error("Failed to set recipient", "recipient", to, "error", err)
+			return err
+		}
 	}
 
 	w, err := client.Data()
 	if err != nil {
-		log.Printf("Failed to create data writer: %v", err)
+		slog.Error("Failed to create data writer", "error", err)
 		return err
 	}
 
-	_, err = w.Write([]byte(emailMsg))
+	_, err = w.Write(emailMsg)
 	if err != nil {
-		log.Printf("Failed to write email body: %v", err)
+		slog.Error("Failed to write email body", "error", err)
 		return err
 	}
 
 	err = w.Close()
 	if err != nil {
-		log.Printf("Failed to close data writer: %v", err)
+		slog.Error("Failed to close data writer", "error", err)
 		return err
 	}
 
-	log.Printf("Email sent successfully to %s", msg.To)
+	slog.Info("Email sent", "recipients", strings.Join(msg.To, ", "))
 	return client.Quit()
 }
+
+// buildMessage writes the headers and body of msg: plain text alone, or
+// multipart/alternative with the HTML version when there is one
+func buildMessage(msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if msg.HTMLBody == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buf.WriteString(msg.Body)
+		buf.WriteString("\r\n")
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+
+	// Clients show the last alternative they understand, so HTML goes last
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", msg.Body},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(w)
+		if _, err := encoder.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
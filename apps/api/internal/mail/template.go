@@ -0,0 +1,159 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	texttemplate "text/template"
+	"time"
+)
+
+// Templates of the emails; each has an HTML (<name>.html) and a plain text
+// (<name>.txt) version
+const (
+	TemplateAlert             = "alert"
+	TemplateDigest            = "digest"
+	TemplatePasswordReset     = "password_reset"
+	TemplateEmailVerification = "email_verification"
+	TemplateInvite            = "invite"
+)
+
+//go:embed templates/*
+var builtinTemplates embed.FS
+
+// AlertData fills the alert template, sent when something failed
+type AlertData struct {
+	Title   string
+	Message string
+	Details []Detail
+	Time    time.Time
+}
+
+// Detail is a labelled value listed in an email
+type Detail struct {
+	Label string
+	Value string
+}
+
+// DigestData fills the digest template
+type DigestData struct {
+	// Period is Daily or Weekly
+	Period string
+	From   time.Time
+	To     time.Time
+	// Runs counts the backup runs of the period by outcome
+	Runs      int
+	Succeeded int
+	Partial   int
+	Failed    int
+	// Skipped runs did not start, e.g. during a maintenance window
+	Skipped int
+	// TotalSize is the size of all backups taken in the period
+	TotalSize string
+	// ExpiringBackups are deleted by retention before the next digest
+	ExpiringBackups int
+	ExpiringSize    string
+	Connections     []DigestConnection
+}
+
+// DigestConnection summarizes the period of one connection
+type DigestConnection struct {
+	Name      string
+	Database  string
+	Type      string
+	Runs      int
+	Succeeded int
+	Failed    int
+	// Size is the total size of the backups taken in the period
+	Size string
+	// LastBackup is the newest completed backup, at any time
+	LastBackup *time.Time
+	// Errors are the distinct errors of the failed runs
+	Errors []string
+	// ExpiringBackups are deleted by retention before the next digest
+	ExpiringBackups int
+	ExpiringSize    string
+}
+
+// AccountLinkData fills the password reset and email verification
+// templates
+type AccountLinkData struct {
+	Username string
+	// Link opens the web app with the token
+	Link string
+	// Token can be entered by hand when the link cannot be opened
+	Token     string
+	ExpiresAt time.Time
+}
+
+// InviteData fills the invite template
+type InviteData struct {
+	InvitedBy string
+	// TeamName is the team joined on signing up, if any
+	TeamName  string
+	Link      string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// templateFuncs are available in both versions of every template
+var templateFuncs = map[string]interface{}{
+	"datetime": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04 MST")
+	},
+}
+
+// templateSource reads a template from MAIL_TEMPLATES_DIR when it holds one
+// of that name, so templates can be customized without a rebuild, and from
+// the built-in templates otherwise
+func templateSource(file string) (string, error) {
+	if dir := os.Getenv("MAIL_TEMPLATES_DIR"); dir != "" {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err == nil {
+			return string(data), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read template %s: %v", file, err)
+		}
+	}
+
+	data, err := builtinTemplates.ReadFile("templates/" + file)
+	if err != nil {
+		return "", fmt.Errorf("unknown template %s", file)
+	}
+	return string(data), nil
+}
+
+// Render renders the plain text and HTML versions of a template
+func Render(name string, data interface{}) (text string, html string, err error) {
+	source, err := templateSource(name + ".txt")
+	if err != nil {
+		return "", "", err
+	}
+	textTmpl, err := texttemplate.New(name).Funcs(templateFuncs).Parse(source)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse template %s.txt: %v", name, err)
+	}
+	var textBuf bytes.Buffer
+	if err := textTmpl.Execute(&textBuf, data); err != nil {
+		return "", "", fmt.Errorf("failed to render template %s.txt: %v", name, err)
+	}
+
+	source, err = templateSource(name + ".html")
+	if err != nil {
+		return "", "", err
+	}
+	htmlTmpl, err := htmltemplate.New(name).Funcs(templateFuncs).Parse(source)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse template %s.html: %v", name, err)
+	}
+	var htmlBuf bytes.Buffer
+	if err := htmlTmpl.Execute(&htmlBuf, data); err != nil {
+		return "", "", fmt.Errorf("failed to render template %s.html: %v", name, err)
+	}
+
+	return textBuf.String(), htmlBuf.String(), nil
+}
@@ -5,8 +5,10 @@ import "net/http"
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		// Range requests resume downloads; Upload-Offset resumes dump uploads
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Range, If-Range, Upload-Offset")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Range, Accept-Ranges, Content-Disposition, Upload-Offset")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// TokenMiddleware authenticates machine clients, such as monitoring checks,
+// with a static bearer token instead of a user session
+type TokenMiddleware struct {
+	token []byte
+}
+
+func NewTokenMiddleware(token string) *TokenMiddleware {
+	return &TokenMiddleware{token: []byte(token)}
+}
+
+func (m *TokenMiddleware) RequireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if len(m.token) == 0 || subtle.ConstantTimeCompare([]byte(token), m.token) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,151 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Embed colors of Discord notifications
+const (
+	DiscordColorSuccess = 0x2ecc71
+	DiscordColorWarning = 0xf39c12
+	DiscordColorFailure = 0xe74c3c
+	DiscordColorInfo    = 0x3498db
+)
+
+// Discord's limits on embeds; longer texts are cut
+const (
+	discordTitleLimit       = 256
+	discordDescriptionLimit = 4096
+	discordFieldNameLimit   = 256
+	discordFieldValueLimit  = 1024
+	discordFieldsLimit      = 25
+)
+
+// discordTimeout bounds a webhook delivery, so a hung request doesn't keep
+// the goroutine sending it
+const discordTimeout = 15 * time.Second
+
+// discordHosts are the hosts Discord serves webhooks from
+var discordHosts = map[string]bool{
+	"discord.com":        true,
+	"discordapp.com":     true,
+	"ptb.discord.com":    true,
+	"canary.discord.com": true,
+}
+
+// DiscordMessage is the body of a Discord webhook execution
+type DiscordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []DiscordEmbed `json:"embeds"`
+}
+
+type DiscordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color"`
+	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
+	// Timestamp is an ISO 8601 time Discord shows in the reader's time zone
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type DiscordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// discordColors are the embed colors of the notification types; the others
+// are shown as information
+var discordColors = map[NotificationType]int{
+	BackupCompleted:              DiscordColorSuccess,
+	RestoreCompleted:             DiscordColorSuccess,
+	BackupFailed:                 DiscordColorFailure,
+	BackupCorrupt:                DiscordColorFailure,
+	RestoreFailed:                DiscordColorFailure,
+	ConnectionCredentialsInvalid: DiscordColorFailure,
+	BackupPrecheckFailed:         DiscordColorWarning,
+	BackupPartial:                DiscordColorWarning,
+}
+
+// NewDiscordMessage formats a notification as a Discord embed with the
+// given fields
+func NewDiscordMessage(n *Notification, fields []DiscordEmbedField) *DiscordMessage {
+	color, ok := discordColors[n.Type]
+	if !ok {
+		color = DiscordColorInfo
+	}
+
+	if len(fields) > discordFieldsLimit {
+		fields = fields[:discordFieldsLimit]
+	}
+	for i := range fields {
+		fields[i].Name = truncate(fields[i].Name, discordFieldNameLimit)
+		fields[i].Value = truncate(fields[i].Value, discordFieldValueLimit)
+	}
+
+	return &DiscordMessage{
+		Username: "Velld",
+		Embeds: []DiscordEmbed{{
+			Title:       truncate(n.Title, discordTitleLimit),
+			Description: truncate(n.Message, discordDescriptionLimit),
+			Color:       color,
+			Fields:      fields,
+			Footer:      &DiscordEmbedFooter{Text: string(n.Type)},
+			Timestamp:   n.CreatedAt.UTC().Format(time.RFC3339),
+		}},
+	}
+}
+
+// truncate cuts s to limit characters, marking the cut with an ellipsis
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// ValidateDiscordWebhookURL checks that raw is a Discord webhook URL such as
+// https://discord.com/api/webhooks/<id>/<token>
+func ValidateDiscordWebhookURL(raw string) error {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.Scheme != "https" || !discordHosts[strings.ToLower(parsed.Host)] ||
+		!strings.HasPrefix(parsed.Path, "/api/webhooks/") {
+		return fmt.Errorf("discord webhook URL must look like https://discord.com/api/webhooks/<id>/<token>")
+	}
+	return nil
+}
+
+// SendDiscord executes a Discord webhook. Only a 2xx response counts as
+// delivered; the error of any other carries Discord's explanation.
+func SendDiscord(webhookURL string, message *DiscordMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: discordTimeout}
+	resp, err := client.Post(strings.TrimSpace(webhookURL), "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to reach Discord: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("discord responded with %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Incident severities, as PagerDuty names them
+const (
+	SeverityCritical = "critical"
+	SeverityError    = "error"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// Opsgenie regions; accounts in the EU region have their own API host
+const (
+	OpsgenieRegionUS = "us"
+	OpsgenieRegionEU = "eu"
+)
+
+const (
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	opsgenieUSURL      = "https://api.opsgenie.com/v2/alerts"
+	opsgenieEUURL      = "https://api.eu.opsgenie.com/v2/alerts"
+)
+
+// Limits of the incident APIs; longer texts are cut
+const (
+	pagerDutySummaryLimit    = 1024
+	pagerDutyDedupKeyLimit   = 255
+	opsgenieMessageLimit     = 130
+	opsgenieAliasLimit       = 512
+	opsgenieDescriptionLimit = 15000
+)
+
+// incidentTimeout bounds a call to PagerDuty or Opsgenie
+const incidentTimeout = 15 * time.Second
+
+// incidentSource names Velld as the origin of incidents
+const incidentSource = "velld"
+
+// Incident is an alert raised with PagerDuty or Opsgenie. Events with the
+// same DedupKey update one incident, and resolving the key closes it.
+type Incident struct {
+	DedupKey string
+	Summary  string
+	Severity string
+	// Component is the affected connection, Group its database type and
+	// Class the kind of problem
+	Component string
+	Group     string
+	Class     string
+	Details   map[string]interface{}
+}
+
+// opsgeniePriorities maps severities to Opsgenie priorities
+var opsgeniePriorities = map[string]string{
+	SeverityCritical: "P1",
+	SeverityError:    "P2",
+	SeverityWarning:  "P3",
+	SeverityInfo:     "P5",
+}
+
+// ValidateOpsgenieRegion checks an Opsgenie region; empty is the US
+func ValidateOpsgenieRegion(region string) error {
+	switch region {
+	case "", OpsgenieRegionUS, OpsgenieRegionEU:
+		return nil
+	default:
+		return fmt.Errorf("opsgenie region must be %s or %s", OpsgenieRegionUS, OpsgenieRegionEU)
+	}
+}
+
+// TriggerPagerDuty raises an incident through the PagerDuty Events API v2
+func TriggerPagerDuty(routingKey string, incident *Incident) error {
+	return sendPagerDuty(map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": "trigger",
+		"dedup_key":    truncate(incident.DedupKey, pagerDutyDedupKeyLimit),
+		"payload": map[string]interface{}{
+			"summary":        truncate(incident.Summary, pagerDutySummaryLimit),
+			"source":         incidentSource,
+			"severity":       incident.Severity,
+			"timestamp":      time.Now().UTC().Format(time.RFC3339),
+			"component":      incident.Component,
+			"group":          incident.Group,
+			"class":          incident.Class,
+			"custom_details": incident.Details,
+		},
+	})
+}
+
+// ResolvePagerDuty resolves the PagerDuty incident of a dedup key
+func ResolvePagerDuty(routingKey, dedupKey string) error {
+	return sendPagerDuty(map[string]interface{}{
+		"routing_key":  routingKey,
+		"event_action": "resolve",
+		"dedup_key":    truncate(dedupKey, pagerDutyDedupKeyLimit),
+	})
+}
+
+func sendPagerDuty(event map[string]interface{}) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, pagerDutyEventsURL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return sendIncidentRequest("PagerDuty", req)
+}
+
+func opsgenieURL(region string) string {
+	if region == OpsgenieRegionEU {
+		return opsgenieEUURL
+	}
+	return opsgenieUSURL
+}
+
+// TriggerOpsgenie creates an Opsgenie alert, using the dedup key as its
+// alias
+func TriggerOpsgenie(apiKey, region string, incident *Incident) error {
+	details := make(map[string]string, len(incident.Details))
+	for key, value := range incident.Details {
+		details[key] = fmt.Sprint(value)
+	}
+
+	description := incident.Summary
+	if errMsg, ok := incident.Details["error"]; ok {
+		description += "\n\n" + fmt.Sprint(errMsg)
+	}
+
+	return sendOpsgenie(apiKey, opsgenieURL(region), map[string]interface{}{
+		"message":     truncate(incident.Summary, opsgenieMessageLimit),
+		"alias":       truncate(incident.DedupKey, opsgenieAliasLimit),
+		"description": truncate(description, opsgenieDescriptionLimit),
+		"source":      incidentSource,
+		"entity":      incident.Component,
+		"priority":    opsgeniePriorities[incident.Severity],
+		"tags":        []string{incidentSource, incident.Class},
+		"details":     details,
+	})
+}
+
+// ResolveOpsgenie closes the Opsgenie alert of a dedup key
+func ResolveOpsgenie(apiKey, region, dedupKey string) error {
+	alias := url.PathEscape(truncate(dedupKey, opsgenieAliasLimit))
+	return sendOpsgenie(apiKey, opsgenieURL(region)+"/"+alias+"/close?identifierType=alias", map[string]interface{}{
+		"source": incidentSource,
+		"note":   "Resolved by Velld",
+	})
+}
+
+func sendOpsgenie(apiKey, endpoint string, payload map[string]interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+apiKey)
+	return sendIncidentRequest("Opsgenie", req)
+}
+
+// sendIncidentRequest sends a request to an incident API. Both APIs accept
+// events asynchronously, so only a 2xx response counts as delivered; the
+// error of any other carries the provider's explanation.
+func sendIncidentRequest(provider string, req *http.Request) error {
+	client := &http.Client{Timeout: incidentTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %v", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s responded with %s: %s", provider, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
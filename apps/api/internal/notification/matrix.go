@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// matrixBodyLimit keeps messages well under Matrix's 64 KiB event limit
+const matrixBodyLimit = 16000
+
+var matrixRoomIDPattern = regexp.MustCompile(`^![^:\s]+:\S+$`)
+
+// MatrixField is a labelled detail listed under a Matrix message
+type MatrixField struct {
+	Label string
+	Value string
+}
+
+// MatrixMessage is an m.room.message event with a plain text body and an
+// HTML one, which most clients render
+type MatrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
+
+// NewMatrixMessage formats a notification for a Matrix room. The title is
+// colored like the Discord embed of the notification type.
+func NewMatrixMessage(n *Notification, fields []MatrixField) *MatrixMessage {
+	color, ok := discordColors[n.Type]
+	if !ok {
+		color = DiscordColorInfo
+	}
+
+	var plain, formatted strings.Builder
+	plain.WriteString(n.Title + "\n" + n.Message)
+	fmt.Fprintf(&formatted, `<strong><font data-mx-color="#%06x">%s</font></strong><br>%s`,
+		color, html.EscapeString(n.Title), html.EscapeString(n.Message))
+
+	if len(fields) > 0 {
+		plain.WriteString("\n")
+		formatted.WriteString("<ul>")
+		for _, field := range fields {
+			plain.WriteString("\n" + field.Label + ": " + field.Value)
+			fmt.Fprintf(&formatted, "<li><strong>%s:</strong> %s</li>",
+				html.EscapeString(field.Label), html.EscapeString(field.Value))
+		}
+		formatted.WriteString("</ul>")
+	}
+
+	return &MatrixMessage{
+		MsgType:       "m.text",
+		Body:          truncate(plain.String(), matrixBodyLimit),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: truncate(formatted.String(), matrixBodyLimit),
+	}
+}
+
+// ValidateMatrixRoomID checks a room ID such as !abc123:matrix.org. Aliases
+// are not accepted, as messages are sent to IDs.
+func ValidateMatrixRoomID(roomID string) error {
+	if !matrixRoomIDPattern.MatchString(roomID) {
+		return fmt.Errorf("matrix room ID must look like !<id>:<server>")
+	}
+	return nil
+}
+
+// SendMatrix posts a message to a room as the user of the access token,
+// which must have joined the room
+func SendMatrix(homeserverURL, accessToken, roomID string, msg *MatrixMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	// The transaction ID makes a retried request idempotent; every message
+	// gets its own
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/velld-%s",
+		strings.TrimRight(strings.TrimSpace(homeserverURL), "/"), url.PathEscape(roomID), uuid.New())
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return sendPushRequest("Matrix", req)
+}
@@ -10,8 +10,15 @@ import (
 type NotificationType string
 
 const (
-	BackupFailed    NotificationType = "backup_failed"
-	BackupCompleted NotificationType = "backup_completed"
+	BackupFailed                 NotificationType = "backup_failed"
+	BackupCompleted              NotificationType = "backup_completed"
+	BackupCorrupt                NotificationType = "backup_corrupt"
+	BackupPrecheckFailed         NotificationType = "backup_precheck_failed"
+	BackupPartial                NotificationType = "backup_partial"
+	ConnectionCredentialsInvalid NotificationType = "connection_credentials_invalid"
+	RestoreCompleted             NotificationType = "restore_completed"
+	RestoreFailed                NotificationType = "restore_failed"
+	RuleTriggered                NotificationType = "rule_triggered"
 )
 
 type NotificationStatus string
@@ -50,3 +57,25 @@ type NotificationListOptions struct {
 	Limit   int
 	Offset  int
 }
+
+// Delivery attempt states
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Delivery is one attempt to deliver a notification through a channel of a
+// fallback chain or a notification rule. The attempts of one chain, or of one
+// event of a rule, share a chain ID.
+type Delivery struct {
+	ID               uuid.UUID        `json:"id"`
+	UserID           uuid.UUID        `json:"user_id"`
+	NotificationType NotificationType `json:"notification_type"`
+	ChainID          uuid.UUID        `json:"chain_id"`
+	Position         int              `json:"position"`
+	Channel          string           `json:"channel"`
+	Target           *string          `json:"target,omitempty"`
+	Status           string           `json:"status"`
+	Error            *string          `json:"error,omitempty"`
+	CreatedAt        time.Time        `json:"created_at"`
+}
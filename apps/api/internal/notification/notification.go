@@ -62,3 +62,19 @@ func (h *NotificationHandler) MarkAsRead(w http.ResponseWriter, r *http.Request)
 
 	response.SendSuccess(w, "Notification marked as read", nil)
 }
+
+func (h *NotificationHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	deliveries, err := h.service.GetDeliveries(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Notification deliveries retrieved successfully", deliveries)
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/dendianugerah/velld/internal/common"
 	"github.com/google/uuid"
 )
 
@@ -71,3 +72,44 @@ func (r *NotificationRepository) DeleteNotifications(userID uuid.UUID, notificat
 		userID, notificationIDs)
 	return err
 }
+
+func (r *NotificationRepository) CreateDelivery(d *Delivery) error {
+	_, err := r.db.Exec(`
+		INSERT INTO notification_deliveries (
+			id, user_id, notification_type, chain_id, position, channel, target, status, error, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		d.ID, d.UserID, d.NotificationType, d.ChainID, d.Position, d.Channel, d.Target,
+		d.Status, d.Error, d.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+// GetUserDeliveries returns the latest delivery attempts of a user's
+// fallback chains, newest first
+func (r *NotificationRepository) GetUserDeliveries(userID uuid.UUID, limit int) ([]*Delivery, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, notification_type, chain_id, position, channel, target, status, error, created_at
+		FROM notification_deliveries
+		WHERE user_id = $1
+		ORDER BY created_at DESC, position DESC
+		LIMIT $2`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*Delivery{}
+	for rows.Next() {
+		d := &Delivery{}
+		var createdAtStr string
+		if err := rows.Scan(&d.ID, &d.UserID, &d.NotificationType, &d.ChainID, &d.Position, &d.Channel,
+			&d.Target, &d.Status, &d.Error, &createdAtStr); err != nil {
+			return nil, err
+		}
+		if d.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
@@ -23,3 +23,10 @@ func (s *NotificationService) MarkAsRead(userID uuid.UUID, notificationID uuid.U
 func (s *NotificationService) DeleteNotifications(userID uuid.UUID, notificationIDs []uuid.UUID) error {
 	return s.repo.DeleteNotifications(userID, notificationIDs)
 }
+
+// deliveryListLimit is how many delivery attempts are listed
+const deliveryListLimit = 100
+
+func (s *NotificationService) GetDeliveries(userID uuid.UUID) ([]*Delivery, error) {
+	return s.repo.GetUserDeliveries(userID, deliveryListLimit)
+}
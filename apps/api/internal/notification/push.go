@@ -0,0 +1,176 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PushPriority ranks a notification for push services, which map it to their
+// own scale
+type PushPriority int
+
+const (
+	PushPriorityLow PushPriority = iota + 1
+	PushPriorityDefault
+	PushPriorityHigh
+	PushPriorityUrgent
+)
+
+// DefaultNtfyServer is used when no ntfy server is configured
+const DefaultNtfyServer = "https://ntfy.sh"
+
+// pushTimeout bounds a push delivery, so a hung server doesn't keep the
+// goroutine sending it
+const pushTimeout = 15 * time.Second
+
+// pushPriorities are the priorities of notification types; others are sent
+// with the default priority
+var pushPriorities = map[NotificationType]PushPriority{
+	BackupCorrupt:                PushPriorityUrgent,
+	BackupFailed:                 PushPriorityHigh,
+	ConnectionCredentialsInvalid: PushPriorityHigh,
+	RestoreFailed:                PushPriorityHigh,
+	BackupPartial:                PushPriorityDefault,
+	BackupPrecheckFailed:         PushPriorityDefault,
+	BackupCompleted:              PushPriorityLow,
+	RestoreCompleted:             PushPriorityLow,
+}
+
+// ntfyPriorities map to ntfy's 1 (min) to 5 (max) scale
+var ntfyPriorities = map[PushPriority]int{
+	PushPriorityLow:     2,
+	PushPriorityDefault: 3,
+	PushPriorityHigh:    4,
+	PushPriorityUrgent:  5,
+}
+
+// gotifyPriorities map to Gotify's 0 to 10 scale; clients show a
+// notification from 4 and sound it from 8
+var gotifyPriorities = map[PushPriority]int{
+	PushPriorityLow:     2,
+	PushPriorityDefault: 5,
+	PushPriorityHigh:    8,
+	PushPriorityUrgent:  10,
+}
+
+// ntfyTags are emoji shortcodes ntfy shows in front of the title
+var ntfyTags = map[PushPriority]string{
+	PushPriorityLow:     "white_check_mark",
+	PushPriorityDefault: "warning",
+	PushPriorityHigh:    "rotating_light",
+	PushPriorityUrgent:  "rotating_light",
+}
+
+var ntfyTopicPattern = regexp.MustCompile(`^[-_A-Za-z0-9]{1,64}$`)
+
+// PushMessage is a notification for ntfy or Gotify
+type PushMessage struct {
+	Title    string
+	Message  string
+	Priority PushPriority
+}
+
+// NewPushMessage formats a notification for push services. Details are
+// appended to the message, one per line.
+func NewPushMessage(n *Notification, details []string) *PushMessage {
+	priority, ok := pushPriorities[n.Type]
+	if !ok {
+		priority = PushPriorityDefault
+	}
+	message := n.Message
+	if len(details) > 0 {
+		message += "\n\n" + strings.Join(details, "\n")
+	}
+	return &PushMessage{Title: n.Title, Message: message, Priority: priority}
+}
+
+// ValidatePushServerURL checks the URL of an ntfy or Gotify server
+func ValidatePushServerURL(raw string) error {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("server URL must be an http or https URL")
+	}
+	return nil
+}
+
+// ValidateNtfyTopic checks an ntfy topic name
+func ValidateNtfyTopic(topic string) error {
+	if !ntfyTopicPattern.MatchString(topic) {
+		return fmt.Errorf("ntfy topic must be 1 to 64 letters, digits, dashes or underscores")
+	}
+	return nil
+}
+
+// SendNtfy publishes a message to an ntfy topic. The token is an ntfy access
+// token, needed for protected topics only.
+func SendNtfy(serverURL, topic, token string, msg *PushMessage) error {
+	if serverURL == "" {
+		serverURL = DefaultNtfyServer
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"topic":    topic,
+		"title":    msg.Title,
+		"message":  msg.Message,
+		"priority": ntfyPriorities[msg.Priority],
+		"tags":     []string{ntfyTags[msg.Priority]},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(strings.TrimSpace(serverURL), "/"), bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return sendPushRequest("ntfy", req)
+}
+
+// SendGotify posts a message to a Gotify server with an application token
+func SendGotify(serverURL, token string, msg *PushMessage) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"title":    msg.Title,
+		"message":  msg.Message,
+		"priority": gotifyPriorities[msg.Priority],
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimRight(strings.TrimSpace(serverURL), "/") + "/message"
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", token)
+	return sendPushRequest("Gotify", req)
+}
+
+// sendPushRequest sends a request to a push or chat server. Only a 2xx
+// response counts as delivered; the error of any other carries the
+// server's explanation.
+func sendPushRequest(service string, req *http.Request) error {
+	client := &http.Client{Timeout: pushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %v", service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s responded with %s: %s", service, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Slack's limits on blocks; longer texts are cut and extra blocks dropped
+const (
+	slackSectionLimit = 3000
+	slackBlocksLimit  = 50
+)
+
+// SlackMessage is the body of a Slack incoming webhook. Text is the fallback
+// shown in notifications; Blocks are shown in the channel.
+type SlackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []SlackBlock `json:"blocks,omitempty"`
+}
+
+// SlackBlock is a Block Kit header, section or context block
+type SlackBlock struct {
+	Type     string      `json:"type"`
+	Text     *SlackText  `json:"text,omitempty"`
+	Elements []SlackText `json:"elements,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// SlackHeader is a header block in plain text
+func SlackHeader(text string) SlackBlock {
+	return SlackBlock{Type: "header", Text: &SlackText{Type: "plain_text", Text: text}}
+}
+
+// SlackSection is a section block in Slack's mrkdwn
+func SlackSection(text string) SlackBlock {
+	return SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: truncate(text, slackSectionLimit)}}
+}
+
+// SlackContext is a context block, shown small and grey
+func SlackContext(text string) SlackBlock {
+	return SlackBlock{Type: "context", Elements: []SlackText{{Type: "mrkdwn", Text: text}}}
+}
+
+// EscapeSlack escapes the characters Slack's mrkdwn reserves for links and
+// mentions
+func EscapeSlack(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// ValidateSlackWebhookURL checks a Slack incoming webhook URL. Other hosts
+// are accepted for Slack-compatible services such as Mattermost.
+func ValidateSlackWebhookURL(raw string) error {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("Slack webhook URL must be an https URL")
+	}
+	return nil
+}
+
+// SendSlack posts a message to a Slack incoming webhook
+func SendSlack(webhookURL string, msg *SlackMessage) error {
+	if len(msg.Blocks) > slackBlocksLimit {
+		msg.Blocks = msg.Blocks[:slackBlocksLimit]
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode Slack message: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid Slack webhook URL: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return sendPushRequest("Slack", req)
+}
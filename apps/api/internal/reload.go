@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/backup"
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+)
+
+type ReloadResult struct {
+	ChangedEnv []string  `json:"changed_env"`
+	Schedules  int       `json:"schedules"`
+	ReloadedAt time.Time `json:"reloaded_at"`
+}
+
+// Reloader applies configuration changes without restarting the process.
+// Settings and notification config are read from the database and environment
+// on every use, so refreshing the environment and the cron schedules is enough.
+type Reloader struct {
+	mu            sync.Mutex
+	backupService *backup.BackupService
+	housekeeper   *Housekeeper
+}
+
+func NewReloader(backupService *backup.BackupService, housekeeper *Housekeeper) *Reloader {
+	return &Reloader{
+		backupService: backupService,
+		housekeeper:   housekeeper,
+	}
+}
+
+func (rl *Reloader) Reload() (*ReloadResult, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	changed := common.ReloadEnv()
+
+	schedules, err := rl.backupService.ReloadSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	rl.housekeeper.Schedule()
+
+	slog.Info("Configuration reloaded", "changed_variables", len(changed), "active_schedules", schedules)
+
+	return &ReloadResult{
+		ChangedEnv: changed,
+		Schedules:  schedules,
+		ReloadedAt: time.Now(),
+	}, nil
+}
+
+func (rl *Reloader) HandleReload(w http.ResponseWriter, r *http.Request) {
+	result, err := rl.Reload()
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Configuration reloaded successfully", result)
+}
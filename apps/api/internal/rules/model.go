@@ -0,0 +1,127 @@
+package rules
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/google/uuid"
+)
+
+// Conditions a rule notifies on
+const (
+	// ConditionFailure matches every failed or partial backup run
+	ConditionFailure = "failure"
+	// ConditionConsecutiveFailures matches the run that makes Threshold
+	// failed runs in a row
+	ConditionConsecutiveFailures = "consecutive_failures"
+	// ConditionSizeDeviation matches a backup whose size is more than
+	// Threshold percent off the average of the backups of the last
+	// WindowHours
+	ConditionSizeDeviation = "size_deviation"
+	// ConditionNoBackup matches a connection without a successful backup in
+	// WindowHours; it is checked periodically and notifies once until the
+	// next backup
+	ConditionNoBackup = "no_backup"
+	// ConditionSuspectBackup matches a backup marked suspect because its
+	// size is far off the trailing average set by its schedule
+	ConditionSuspectBackup = "suspect_backup"
+	// ConditionSLAViolation matches a connection that breaks its RPO or its
+	// verification objective; it is checked periodically and notifies once
+	// per violation
+	ConditionSLAViolation = "sla_violation"
+)
+
+// conditionDefaults are the threshold and window a condition starts with;
+// zero means the condition doesn't use them
+var conditionDefaults = map[string]struct {
+	threshold   int
+	windowHours int
+}{
+	ConditionFailure:             {0, 0},
+	ConditionConsecutiveFailures: {3, 0},
+	ConditionSizeDeviation:       {30, 7 * 24},
+	ConditionNoBackup:            {0, 24},
+	ConditionSuspectBackup:       {0, 0},
+	ConditionSLAViolation:        {0, 0},
+}
+
+// Channels are the channels a rule delivers through, stored as JSON
+type Channels []settings.FallbackChannel
+
+func (c Channels) Value() (driver.Value, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (c *Channels) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case []byte:
+		return json.Unmarshal(v, c)
+	default:
+		return fmt.Errorf("cannot scan %T into rule channels", src)
+	}
+}
+
+// Rule notifies through its channels when its condition matches a backup of
+// one connection, or of every connection of the user. Rules add to the
+// notification settings; they don't replace them.
+type Rule struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	// ConnectionID limits the rule to one connection
+	ConnectionID *string `json:"connection_id"`
+	Condition    string  `json:"condition"`
+	// Threshold is the number of failed runs of consecutive_failures and the
+	// percentage of size_deviation
+	Threshold int `json:"threshold"`
+	// WindowHours is the period averaged by size_deviation and the period
+	// without a backup of no_backup
+	WindowHours int `json:"window_hours"`
+	// Channels are all delivered to, unlike a fallback chain
+	Channels  Channels  `json:"channels"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AppliesTo tells whether the rule covers the connection
+func (r *Rule) AppliesTo(connectionID string) bool {
+	return r.ConnectionID == nil || *r.ConnectionID == connectionID
+}
+
+// RuleRequest creates a rule or updates one; fields left out of an update
+// keep their value. Changing the condition resets the threshold and window to
+// the defaults of the new condition unless they are given as well.
+type RuleRequest struct {
+	Name *string `json:"name"`
+	// ConnectionID limits the rule to one connection; an empty one applies
+	// it to every connection
+	ConnectionID *string                    `json:"connection_id"`
+	Condition    *string                    `json:"condition"`
+	Threshold    *int                       `json:"threshold"`
+	WindowHours  *int                       `json:"window_hours"`
+	Channels     []settings.FallbackChannel `json:"channels"`
+	Enabled      *bool                      `json:"enabled"`
+}
+
+// RuleEvent records a rule matching a connection. Its ID is the chain ID of
+// the notification deliveries it made.
+type RuleEvent struct {
+	ID           uuid.UUID `json:"id"`
+	RuleID       uuid.UUID `json:"rule_id"`
+	UserID       uuid.UUID `json:"-"`
+	ConnectionID string    `json:"connection_id"`
+	Message      string    `json:"message"`
+	TriggeredAt  time.Time `json:"triggered_at"`
+}
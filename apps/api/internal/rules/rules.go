@@ -0,0 +1,152 @@
+package rules
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type RuleHandler struct {
+	service *RuleService
+}
+
+func NewRuleHandler(service *RuleService) *RuleHandler {
+	return &RuleHandler{service: service}
+}
+
+// sendRuleError maps service errors to their status
+func sendRuleError(w http.ResponseWriter, err error) {
+	var ruleErr *RuleError
+	switch {
+	case errors.As(err, &ruleErr):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		response.SendError(w, http.StatusNotFound, "rule not found")
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// requestIDs returns the user and the {id} of the route
+func requestIDs(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return uuid.Nil, uuid.Nil, false
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, "invalid ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, id, true
+}
+
+func (h *RuleHandler) GetRules(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	rules, err := h.service.GetRules(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Notification rules retrieved successfully", rules)
+}
+
+func (h *RuleHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule, err := h.service.CreateRule(userID, &req)
+	if err != nil {
+		sendRuleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Notification rule created successfully", rule)
+}
+
+func (h *RuleHandler) GetRule(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	rule, err := h.service.GetRule(userID, id)
+	if err != nil {
+		sendRuleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Notification rule retrieved successfully", rule)
+}
+
+func (h *RuleHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rule, err := h.service.UpdateRule(userID, id, &req)
+	if err != nil {
+		sendRuleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Notification rule updated successfully", rule)
+}
+
+func (h *RuleHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteRule(userID, id); err != nil {
+		sendRuleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Notification rule deleted successfully", nil)
+}
+
+func (h *RuleHandler) GetRuleEvents(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := h.service.GetRuleEvents(userID, id)
+	if err != nil {
+		sendRuleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Notification rule events retrieved successfully", events)
+}
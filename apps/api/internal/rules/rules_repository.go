@@ -0,0 +1,194 @@
+package rules
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/google/uuid"
+)
+
+type RuleRepository struct {
+	db *sql.DB
+}
+
+func NewRuleRepository(db *sql.DB) *RuleRepository {
+	return &RuleRepository{db: db}
+}
+
+const ruleColumns = `id, user_id, name, connection_id, condition, threshold, window_hours,
+	channels, enabled, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRule(row rowScanner) (*Rule, error) {
+	rule := &Rule{}
+	var connectionID sql.NullString
+	var createdAtStr, updatedAtStr string
+	if err := row.Scan(&rule.ID, &rule.UserID, &rule.Name, &connectionID, &rule.Condition, &rule.Threshold,
+		&rule.WindowHours, &rule.Channels, &rule.Enabled, &createdAtStr, &updatedAtStr); err != nil {
+		return nil, err
+	}
+	if connectionID.Valid {
+		rule.ConnectionID = &connectionID.String
+	}
+
+	var err error
+	if rule.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, err
+	}
+	if rule.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func scanRules(rows *sql.Rows) ([]*Rule, error) {
+	defer rows.Close()
+
+	rules := []*Rule{}
+	for rows.Next() {
+		rule, err := scanRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *RuleRepository) CreateRule(rule *Rule) error {
+	_, err := r.db.Exec(`
+		INSERT INTO notification_rules (`+ruleColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		rule.ID, rule.UserID, rule.Name, rule.ConnectionID, rule.Condition, rule.Threshold, rule.WindowHours,
+		rule.Channels, rule.Enabled, rule.CreatedAt.Format(time.RFC3339), rule.UpdatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *RuleRepository) UpdateRule(rule *Rule) error {
+	_, err := r.db.Exec(`
+		UPDATE notification_rules
+		SET name = $1, connection_id = $2, condition = $3, threshold = $4, window_hours = $5,
+			channels = $6, enabled = $7, updated_at = $8
+		WHERE id = $9`,
+		rule.Name, rule.ConnectionID, rule.Condition, rule.Threshold, rule.WindowHours,
+		rule.Channels, rule.Enabled, rule.UpdatedAt.Format(time.RFC3339), rule.ID)
+	return err
+}
+
+// DeleteRule removes a rule with its events
+func (r *RuleRepository) DeleteRule(id uuid.UUID) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM notification_rule_events WHERE rule_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM notification_rules WHERE id = $1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *RuleRepository) GetRule(id uuid.UUID) (*Rule, error) {
+	row := r.db.QueryRow(`SELECT `+ruleColumns+` FROM notification_rules WHERE id = $1`, id)
+	return scanRule(row)
+}
+
+func (r *RuleRepository) GetUserRules(userID uuid.UUID) ([]*Rule, error) {
+	rows, err := r.db.Query(`
+		SELECT `+ruleColumns+`
+		FROM notification_rules
+		WHERE user_id = $1
+		ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanRules(rows)
+}
+
+// GetEnabledRules returns the enabled rules of a condition; with a user, only
+// that user's
+func (r *RuleRepository) GetEnabledRules(userID *uuid.UUID, condition string) ([]*Rule, error) {
+	query := `
+		SELECT ` + ruleColumns + `
+		FROM notification_rules
+		WHERE enabled = 1 AND condition = $1`
+	args := []interface{}{condition}
+	if userID != nil {
+		query += " AND user_id = $2"
+		args = append(args, *userID)
+	}
+
+	rows, err := r.db.Query(query+" ORDER BY created_at", args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRules(rows)
+}
+
+const ruleEventColumns = `id, rule_id, user_id, connection_id, message, triggered_at`
+
+func scanRuleEvent(row rowScanner) (*RuleEvent, error) {
+	event := &RuleEvent{}
+	var triggeredAtStr string
+	if err := row.Scan(&event.ID, &event.RuleID, &event.UserID, &event.ConnectionID, &event.Message,
+		&triggeredAtStr); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if event.TriggeredAt, err = common.ParseTime(triggeredAtStr); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (r *RuleRepository) CreateRuleEvent(event *RuleEvent) error {
+	_, err := r.db.Exec(`
+		INSERT INTO notification_rule_events (`+ruleEventColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		event.ID, event.RuleID, event.UserID, event.ConnectionID, event.Message,
+		event.TriggeredAt.Format(time.RFC3339))
+	return err
+}
+
+// GetLatestRuleEvent returns the newest event of a rule for a connection
+func (r *RuleRepository) GetLatestRuleEvent(ruleID uuid.UUID, connectionID string) (*RuleEvent, error) {
+	row := r.db.QueryRow(`
+		SELECT `+ruleEventColumns+`
+		FROM notification_rule_events
+		WHERE rule_id = $1 AND connection_id = $2
+		ORDER BY triggered_at DESC LIMIT 1`, ruleID, connectionID)
+	return scanRuleEvent(row)
+}
+
+// GetRuleEvents returns the latest events of a rule, newest first
+func (r *RuleRepository) GetRuleEvents(ruleID uuid.UUID, limit int) ([]*RuleEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT `+ruleEventColumns+`
+		FROM notification_rule_events
+		WHERE rule_id = $1
+		ORDER BY triggered_at DESC
+		LIMIT $2`, ruleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*RuleEvent{}
+	for rows.Next() {
+		event, err := scanRuleEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
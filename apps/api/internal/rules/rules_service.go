@@ -0,0 +1,254 @@
+package rules
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/google/uuid"
+)
+
+const (
+	maxNameLength = 100
+	maxChannels   = 5
+	// eventListLimit is how many events of a rule are listed
+	eventListLimit   = 100
+	minFailureStreak = 2
+	maxFailureStreak = 50
+	minDeviation     = 1
+	maxDeviation     = 1000
+	minWindowHours   = 1
+	maxWindowHours   = 30 * 24
+)
+
+// RuleError is a rule request that cannot be saved as submitted
+type RuleError struct {
+	Reason string
+}
+
+func (e *RuleError) Error() string {
+	return e.Reason
+}
+
+type RuleService struct {
+	repo        *RuleRepository
+	connStorage *connection.ConnectionRepository
+}
+
+func NewRuleService(repo *RuleRepository, connStorage *connection.ConnectionRepository) *RuleService {
+	return &RuleService{
+		repo:        repo,
+		connStorage: connStorage,
+	}
+}
+
+func (s *RuleService) GetRules(userID uuid.UUID) ([]*Rule, error) {
+	return s.repo.GetUserRules(userID)
+}
+
+// GetRule returns a rule of the user; others are not found
+func (s *RuleService) GetRule(userID, id uuid.UUID) (*Rule, error) {
+	rule, err := s.repo.GetRule(id)
+	if err != nil {
+		return nil, err
+	}
+	if rule.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return rule, nil
+}
+
+func (s *RuleService) CreateRule(userID uuid.UUID, req *RuleRequest) (*Rule, error) {
+	if req.Name == nil || req.Condition == nil || req.Channels == nil {
+		return nil, &RuleError{Reason: "name, condition and channels are required"}
+	}
+
+	now := time.Now()
+	rule := &Rule{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Enabled:   true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.applyRequest(rule, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateRule(rule); err != nil {
+		return nil, fmt.Errorf("failed to save rule: %v", err)
+	}
+	return rule, nil
+}
+
+func (s *RuleService) UpdateRule(userID, id uuid.UUID, req *RuleRequest) (*Rule, error) {
+	rule, err := s.GetRule(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyRequest(rule, req); err != nil {
+		return nil, err
+	}
+
+	rule.UpdatedAt = time.Now()
+	if err := s.repo.UpdateRule(rule); err != nil {
+		return nil, fmt.Errorf("failed to update rule: %v", err)
+	}
+	return rule, nil
+}
+
+func (s *RuleService) DeleteRule(userID, id uuid.UUID) error {
+	if _, err := s.GetRule(userID, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteRule(id)
+}
+
+func (s *RuleService) GetRuleEvents(userID, id uuid.UUID) ([]*RuleEvent, error) {
+	if _, err := s.GetRule(userID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRuleEvents(id, eventListLimit)
+}
+
+// MatchingRules returns the enabled rules of a condition that cover the
+// connection
+func (s *RuleService) MatchingRules(userID uuid.UUID, connectionID, condition string) ([]*Rule, error) {
+	rules, err := s.repo.GetEnabledRules(&userID, condition)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []*Rule{}
+	for _, rule := range rules {
+		if rule.AppliesTo(connectionID) {
+			matching = append(matching, rule)
+		}
+	}
+	return matching, nil
+}
+
+// EnabledRules returns the enabled rules of a condition of every user
+func (s *RuleService) EnabledRules(condition string) ([]*Rule, error) {
+	return s.repo.GetEnabledRules(nil, condition)
+}
+
+func (s *RuleService) RecordEvent(event *RuleEvent) error {
+	return s.repo.CreateRuleEvent(event)
+}
+
+// LatestEvent returns when the rule last matched the connection, or nil if
+// it never did
+func (s *RuleService) LatestEvent(ruleID uuid.UUID, connectionID string) (*RuleEvent, error) {
+	event, err := s.repo.GetLatestRuleEvent(ruleID, connectionID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return event, err
+}
+
+// applyRequest validates the fields set in req and copies them to rule
+func (s *RuleService) applyRequest(rule *Rule, req *RuleRequest) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > maxNameLength {
+			return &RuleError{Reason: fmt.Sprintf("name must be 1 to %d characters", maxNameLength)}
+		}
+		rule.Name = name
+	}
+
+	if req.ConnectionID != nil {
+		rule.ConnectionID = nil
+		if connectionID := strings.TrimSpace(*req.ConnectionID); connectionID != "" {
+			conn, err := s.connStorage.GetConnection(connectionID)
+			if err != nil || !s.connStorage.HasAccess(conn, rule.UserID) {
+				return &RuleError{Reason: "connection not found"}
+			}
+			rule.ConnectionID = &connectionID
+		}
+	}
+
+	if req.Condition != nil {
+		condition := strings.TrimSpace(*req.Condition)
+		defaults, ok := conditionDefaults[condition]
+		if !ok {
+			return &RuleError{Reason: fmt.Sprintf("unknown condition %q", condition)}
+		}
+		if condition != rule.Condition {
+			rule.Condition = condition
+			rule.Threshold = defaults.threshold
+			rule.WindowHours = defaults.windowHours
+		}
+	}
+	if req.Threshold != nil {
+		rule.Threshold = *req.Threshold
+	}
+	if req.WindowHours != nil {
+		rule.WindowHours = *req.WindowHours
+	}
+	if err := validateParameters(rule); err != nil {
+		return err
+	}
+
+	if req.Channels != nil {
+		if len(req.Channels) == 0 || len(req.Channels) > maxChannels {
+			return &RuleError{Reason: fmt.Sprintf("a rule needs 1 to %d channels", maxChannels)}
+		}
+		for i, channel := range req.Channels {
+			if err := settings.ValidateChannel(channel); err != nil {
+				return &RuleError{Reason: fmt.Sprintf("channel %d: %v", i+1, err)}
+			}
+		}
+		rule.Channels = Channels(req.Channels)
+	}
+
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+
+	return nil
+}
+
+// validateParameters checks the threshold and window against what the
+// condition uses
+func validateParameters(rule *Rule) error {
+	switch rule.Condition {
+	case ConditionFailure:
+		if rule.Threshold != 0 || rule.WindowHours != 0 {
+			return &RuleError{Reason: "failure takes no threshold or window"}
+		}
+	case ConditionSuspectBackup:
+		if rule.Threshold != 0 || rule.WindowHours != 0 {
+			return &RuleError{Reason: "suspect_backup takes no threshold or window"}
+		}
+	case ConditionSLAViolation:
+		if rule.Threshold != 0 || rule.WindowHours != 0 {
+			return &RuleError{Reason: "sla_violation takes no threshold or window"}
+		}
+	case ConditionConsecutiveFailures:
+		if rule.Threshold < minFailureStreak || rule.Threshold > maxFailureStreak {
+			return &RuleError{Reason: fmt.Sprintf("threshold must be between %d and %d failed runs", minFailureStreak, maxFailureStreak)}
+		}
+		if rule.WindowHours != 0 {
+			return &RuleError{Reason: "consecutive_failures takes no window"}
+		}
+	case ConditionSizeDeviation:
+		if rule.Threshold < minDeviation || rule.Threshold > maxDeviation {
+			return &RuleError{Reason: fmt.Sprintf("threshold must be between %d and %d percent", minDeviation, maxDeviation)}
+		}
+		if rule.WindowHours < minWindowHours || rule.WindowHours > maxWindowHours {
+			return &RuleError{Reason: fmt.Sprintf("window_hours must be between %d and %d", minWindowHours, maxWindowHours)}
+		}
+	case ConditionNoBackup:
+		if rule.Threshold != 0 {
+			return &RuleError{Reason: "no_backup takes no threshold"}
+		}
+		if rule.WindowHours < minWindowHours || rule.WindowHours > maxWindowHours {
+			return &RuleError{Reason: fmt.Sprintf("window_hours must be between %d and %d", minWindowHours, maxWindowHours)}
+		}
+	}
+	return nil
+}
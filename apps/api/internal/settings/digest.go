@@ -0,0 +1,49 @@
+package settings
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/notification"
+)
+
+// Digest frequencies
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+	DigestOff    = "off"
+)
+
+// DigestSettingsError is a malformed digest setting
+type DigestSettingsError struct {
+	Reason string
+}
+
+func (e *DigestSettingsError) Error() string {
+	return e.Reason
+}
+
+func normalizeDigestFrequency(raw string) (string, error) {
+	frequency := strings.ToLower(strings.TrimSpace(raw))
+	switch frequency {
+	case "":
+		return DigestDaily, nil
+	case DigestDaily, DigestWeekly, DigestOff:
+		return frequency, nil
+	default:
+		return "", &DigestSettingsError{Reason: fmt.Sprintf("digest frequency must be %s, %s or %s", DigestDaily, DigestWeekly, DigestOff)}
+	}
+}
+
+// normalizeSlackWebhook checks a submitted Slack incoming webhook URL; an
+// empty one removes it
+func normalizeSlackWebhook(raw string) (*string, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return nil, nil
+	}
+	if err := notification.ValidateSlackWebhookURL(trimmed); err != nil {
+		return nil, &DigestSettingsError{Reason: err.Error()}
+	}
+	return &trimmed, nil
+}
@@ -0,0 +1,101 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/google/uuid"
+)
+
+// DiscordWebhookError is a missing or malformed Discord webhook URL
+type DiscordWebhookError struct {
+	Reason string
+}
+
+func (e *DiscordWebhookError) Error() string {
+	return e.Reason
+}
+
+// normalizeDiscordWebhook checks a submitted webhook URL; an empty one
+// removes the webhook
+func normalizeDiscordWebhook(raw string) (*string, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return nil, nil
+	}
+	if err := notification.ValidateDiscordWebhookURL(trimmed); err != nil {
+		return nil, &DiscordWebhookError{Reason: err.Error()}
+	}
+	return &trimmed, nil
+}
+
+// TestDiscordWebhook sends a test embed to the requested webhook, or to the
+// one of the user's settings, so a webhook can be checked before relying on
+// it
+func (s *SettingsService) TestDiscordWebhook(userID uuid.UUID, req *TestDiscordRequest) error {
+	var webhookURL *string
+	if req.WebhookURL != nil {
+		normalized, err := normalizeDiscordWebhook(*req.WebhookURL)
+		if err != nil {
+			return err
+		}
+		webhookURL = normalized
+	}
+	if webhookURL == nil {
+		settings, err := s.repo.GetUserSettings(userID)
+		if err != nil {
+			return err
+		}
+		webhookURL = settings.DiscordWebhookURL
+	}
+	if webhookURL == nil {
+		return &DiscordWebhookError{Reason: "no Discord webhook URL configured"}
+	}
+
+	now := time.Now()
+	n := &notification.Notification{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Title:     "Test Notification",
+		Message:   "Velld can post to this webhook. Backup and restore events will show up here.",
+		Type:      "test",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	return notification.SendDiscord(*webhookURL, notification.NewDiscordMessage(n, nil))
+}
+
+func (h *SettingsHandler) TestDiscordWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	// The body is optional
+	var req TestDiscordRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if err := h.service.TestDiscordWebhook(userID, &req); err != nil {
+		var invalid *DiscordWebhookError
+		if errors.As(err, &invalid) {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		response.SendError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Test notification sent to Discord", nil)
+}
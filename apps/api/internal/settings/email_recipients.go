@@ -0,0 +1,104 @@
+package settings
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxEmailRecipients caps the recipients of one user's emails
+const maxEmailRecipients = 20
+
+// EmailRecipient is an address that gets the user's emails, with the kinds
+// of email it wants
+type EmailRecipient struct {
+	Address string `json:"address"`
+	// Alerts are sent when a backup fails or is at risk
+	Alerts bool `json:"alerts"`
+	// Digest is the daily or weekly summary of the backup runs
+	Digest bool `json:"digest"`
+}
+
+// EmailRecipients replace the single email address of the settings. Without
+// them, alerts go to that address and no digest is sent.
+type EmailRecipients []EmailRecipient
+
+// Value stores the recipients as JSON in a nullable text column
+func (r EmailRecipients) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (r *EmailRecipients) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	case []byte:
+		return json.Unmarshal(v, r)
+	default:
+		return fmt.Errorf("cannot scan %T into email recipients", src)
+	}
+}
+
+// validateEmailRecipients checks the recipients submitted with a settings
+// request. Addresses are trimmed and must be unique.
+func validateEmailRecipients(recipients EmailRecipients) (EmailRecipients, error) {
+	if len(recipients) > maxEmailRecipients {
+		return nil, fmt.Errorf("at most %d email recipients are allowed", maxEmailRecipients)
+	}
+
+	validated := make(EmailRecipients, 0, len(recipients))
+	seen := make(map[string]bool)
+	for i, recipient := range recipients {
+		address := strings.TrimSpace(recipient.Address)
+		if !strings.Contains(address, "@") || strings.ContainsAny(address, " \r\n,") {
+			return nil, fmt.Errorf("email recipient %d: invalid email address %q", i+1, recipient.Address)
+		}
+		if seen[strings.ToLower(address)] {
+			return nil, fmt.Errorf("email recipient %d: %s is listed twice", i+1, address)
+		}
+		seen[strings.ToLower(address)] = true
+
+		recipient.Address = address
+		validated = append(validated, recipient)
+	}
+	return validated, nil
+}
+
+// AlertRecipients are the addresses alerts are emailed to
+func (s *UserSettings) AlertRecipients() []string {
+	if len(s.EmailRecipients) == 0 {
+		if s.Email == nil {
+			return nil
+		}
+		return []string{*s.Email}
+	}
+
+	var addresses []string
+	for _, recipient := range s.EmailRecipients {
+		if recipient.Alerts {
+			addresses = append(addresses, recipient.Address)
+		}
+	}
+	return addresses
+}
+
+// DigestRecipients are the addresses the digest is emailed to
+func (s *UserSettings) DigestRecipients() []string {
+	var addresses []string
+	for _, recipient := range s.EmailRecipients {
+		if recipient.Digest {
+			addresses = append(addresses, recipient.Address)
+		}
+	}
+	return addresses
+}
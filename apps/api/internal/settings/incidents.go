@@ -0,0 +1,130 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/google/uuid"
+)
+
+// Incident integrations
+const (
+	IncidentPagerDuty = "pagerduty"
+	IncidentOpsgenie  = "opsgenie"
+)
+
+// IncidentSettingsError is a missing or malformed incident integration
+// setting
+type IncidentSettingsError struct {
+	Reason string
+}
+
+func (e *IncidentSettingsError) Error() string {
+	return e.Reason
+}
+
+// encryptIncidentKey encrypts a submitted routing or API key; an empty one
+// removes the key
+func (s *SettingsService) encryptIncidentKey(raw string) (*string, error) {
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" {
+		return nil, nil
+	}
+	encrypted, err := s.cryptoService.Encrypt(trimmed)
+	if err != nil {
+		return nil, err
+	}
+	return &encrypted, nil
+}
+
+func normalizeOpsgenieRegion(raw string) (*string, error) {
+	region := strings.ToLower(strings.TrimSpace(raw))
+	if err := notification.ValidateOpsgenieRegion(region); err != nil {
+		return nil, &IncidentSettingsError{Reason: err.Error()}
+	}
+	if region == "" {
+		return nil, nil
+	}
+	return &region, nil
+}
+
+// TestIncidentIntegration raises a test incident with the configured
+// PagerDuty or Opsgenie key and resolves it right away, so a key can be
+// checked before an outage relies on it
+func (s *SettingsService) TestIncidentIntegration(userID uuid.UUID, req *TestIncidentRequest) error {
+	settings, err := s.repo.GetUserSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	var encryptedKey *string
+	switch req.Provider {
+	case IncidentPagerDuty:
+		encryptedKey = settings.PagerDutyRoutingKey
+	case IncidentOpsgenie:
+		encryptedKey = settings.OpsgenieAPIKey
+	default:
+		return &IncidentSettingsError{Reason: fmt.Sprintf("provider must be %s or %s", IncidentPagerDuty, IncidentOpsgenie)}
+	}
+	if encryptedKey == nil {
+		return &IncidentSettingsError{Reason: fmt.Sprintf("no %s key configured", req.Provider)}
+	}
+	key, err := s.cryptoService.Decrypt(*encryptedKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s key: %v", req.Provider, err)
+	}
+
+	incident := &notification.Incident{
+		DedupKey: "velld-test-" + uuid.New().String(),
+		Summary:  "Velld test incident. It is resolved right away.",
+		Severity: notification.SeverityInfo,
+		Class:    "test",
+	}
+	if req.Provider == IncidentPagerDuty {
+		if err := notification.TriggerPagerDuty(key, incident); err != nil {
+			return err
+		}
+		return notification.ResolvePagerDuty(key, incident.DedupKey)
+	}
+
+	region := ""
+	if settings.OpsgenieRegion != nil {
+		region = *settings.OpsgenieRegion
+	}
+	if err := notification.TriggerOpsgenie(key, region, incident); err != nil {
+		return err
+	}
+	return notification.ResolveOpsgenie(key, region, incident.DedupKey)
+}
+
+func (h *SettingsHandler) TestIncidentIntegration(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var req TestIncidentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.TestIncidentIntegration(userID, &req); err != nil {
+		var invalid *IncidentSettingsError
+		if errors.As(err, &invalid) {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		response.SendError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Test incident raised and resolved", nil)
+}
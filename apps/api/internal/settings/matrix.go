@@ -0,0 +1,108 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/google/uuid"
+)
+
+// MatrixSettingsError is a missing or malformed Matrix setting
+type MatrixSettingsError struct {
+	Reason string
+}
+
+func (e *MatrixSettingsError) Error() string {
+	return e.Reason
+}
+
+// normalizeMatrixHomeserver checks a submitted homeserver URL; an empty one
+// removes it
+func normalizeMatrixHomeserver(raw string) (*string, error) {
+	homeserverURL := strings.TrimRight(strings.TrimSpace(raw), "/")
+	if homeserverURL == "" {
+		return nil, nil
+	}
+	if err := notification.ValidatePushServerURL(homeserverURL); err != nil {
+		return nil, &MatrixSettingsError{Reason: "matrix homeserver URL must be an http or https URL"}
+	}
+	return &homeserverURL, nil
+}
+
+func normalizeMatrixRoomID(raw string) (*string, error) {
+	roomID := strings.TrimSpace(raw)
+	if roomID == "" {
+		return nil, nil
+	}
+	if err := notification.ValidateMatrixRoomID(roomID); err != nil {
+		return nil, &MatrixSettingsError{Reason: err.Error()}
+	}
+	return &roomID, nil
+}
+
+// TestMatrixNotification posts a test message with the configured homeserver
+// and access token, to the requested room or the one of the settings
+func (s *SettingsService) TestMatrixNotification(userID uuid.UUID, req *TestMatrixRequest) error {
+	settings, err := s.repo.GetUserSettings(userID)
+	if err != nil {
+		return err
+	}
+	if settings.MatrixHomeserverURL == nil || settings.MatrixAccessToken == nil {
+		return &MatrixSettingsError{Reason: "no Matrix homeserver URL or access token configured"}
+	}
+
+	roomID := settings.MatrixRoomID
+	if req.RoomID != nil {
+		normalized, err := normalizeMatrixRoomID(*req.RoomID)
+		if err != nil {
+			return err
+		}
+		roomID = normalized
+	}
+	if roomID == nil {
+		return &MatrixSettingsError{Reason: "no Matrix room ID configured"}
+	}
+
+	token, err := s.cryptoService.Decrypt(*settings.MatrixAccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt Matrix access token: %v", err)
+	}
+
+	n := &notification.Notification{
+		Title:   "Velld test notification",
+		Message: "Matrix notifications from Velld reach this room.",
+	}
+	return notification.SendMatrix(*settings.MatrixHomeserverURL, token, *roomID, notification.NewMatrixMessage(n, nil))
+}
+
+func (h *SettingsHandler) TestMatrixNotification(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var req TestMatrixRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.TestMatrixNotification(userID, &req); err != nil {
+		var invalid *MatrixSettingsError
+		if errors.As(err, &invalid) {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		response.SendError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Test message sent", nil)
+}
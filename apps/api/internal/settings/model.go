@@ -13,11 +13,53 @@ type UserSettings struct {
 	NotifyEmail     bool      `json:"notify_email"`
 	NotifyWebhook   bool      `json:"notify_webhook"`
 	WebhookURL      *string   `json:"webhook_url,omitempty"`
+	// NotifyDiscord posts backup and restore events to DiscordWebhookURL as
+	// embeds; failures always, successes with DiscordNotifySuccess
+	NotifyDiscord        bool    `json:"notify_discord"`
+	DiscordWebhookURL    *string `json:"discord_webhook_url,omitempty"`
+	DiscordNotifySuccess bool    `json:"discord_notify_success"`
 	Email           *string   `json:"email,omitempty"`
 	SMTPHost        *string   `json:"smtp_host,omitempty"`
 	SMTPPort        *int      `json:"smtp_port,omitempty"`
 	SMTPUsername    *string   `json:"smtp_username,omitempty"`
 	SMTPPassword    *string   `json:"smtp_password,omitempty"`
+	// SMTPSecurity is starttls (the default), tls or none
+	SMTPSecurity *string `json:"smtp_security,omitempty"`
+	// EmailRecipients pick who gets alerts and the digest
+	EmailRecipients EmailRecipients `json:"email_recipients,omitempty"`
+	// NotifyPagerDuty and NotifyOpsgenie raise incidents for failed backups
+	// and RPO violations, resolved when the next backup succeeds. The keys
+	// are stored encrypted and never returned.
+	NotifyPagerDuty     bool    `json:"notify_pagerduty"`
+	PagerDutyRoutingKey *string `json:"pagerduty_routing_key,omitempty"`
+	NotifyOpsgenie      bool    `json:"notify_opsgenie"`
+	OpsgenieAPIKey      *string `json:"opsgenie_api_key,omitempty"`
+	// OpsgenieRegion is us (the default) or eu
+	OpsgenieRegion *string `json:"opsgenie_region,omitempty"`
+	// NotifyNtfy and NotifyGotify push failures to self-hosted push
+	// services. NtfyServerURL defaults to https://ntfy.sh; the tokens are
+	// stored encrypted and never returned.
+	NotifyNtfy      bool    `json:"notify_ntfy"`
+	NtfyServerURL   *string `json:"ntfy_server_url,omitempty"`
+	NtfyTopic       *string `json:"ntfy_topic,omitempty"`
+	NtfyToken       *string `json:"ntfy_token,omitempty"`
+	NotifyGotify    bool    `json:"notify_gotify"`
+	GotifyServerURL *string `json:"gotify_server_url,omitempty"`
+	GotifyToken     *string `json:"gotify_token,omitempty"`
+	// NotifyMatrix posts failures to a Matrix room as the user of the access
+	// token, which is stored encrypted and never returned.
+	// MatrixNotifySuccess posts successful backups and restores as well.
+	NotifyMatrix        bool    `json:"notify_matrix"`
+	MatrixHomeserverURL *string `json:"matrix_homeserver_url,omitempty"`
+	MatrixAccessToken   *string `json:"matrix_access_token,omitempty"`
+	MatrixRoomID        *string `json:"matrix_room_id,omitempty"`
+	MatrixNotifySuccess bool    `json:"matrix_notify_success"`
+	// DigestFrequency is daily (the default), weekly or off; weekly digests
+	// are sent on DigestWeekday, 0 being Sunday. The digest also goes to
+	// DigestSlackWebhookURL, a Slack incoming webhook.
+	DigestFrequency       string  `json:"digest_frequency"`
+	DigestWeekday         int     `json:"digest_weekday"`
+	DigestSlackWebhookURL *string `json:"digest_slack_webhook_url,omitempty"`
 	// S3-compatible storage settings
 	S3Enabled    bool      `json:"s3_enabled"`
 	S3Endpoint   *string   `json:"s3_endpoint,omitempty"`
@@ -28,6 +70,8 @@ type UserSettings struct {
 	S3UseSSL     bool      `json:"s3_use_ssl"`
 	S3PathPrefix *string   `json:"s3_path_prefix,omitempty"`
 	S3PurgeLocal bool      `json:"s3_purge_local"`
+	// NotificationFallbacks are per-event chains of channels tried in order
+	NotificationFallbacks NotificationFallbacks `json:"notification_fallbacks,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	EnvConfigured map[string]bool `json:"env_configured,omitempty"`
@@ -38,11 +82,46 @@ type UpdateSettingsRequest struct {
 	NotifyEmail     *bool   `json:"notify_email,omitempty"`
 	NotifyWebhook   *bool   `json:"notify_webhook,omitempty"`
 	WebhookURL      *string `json:"webhook_url,omitempty"`
+	// DiscordWebhookURL must be a Discord webhook URL; an empty string
+	// removes it
+	NotifyDiscord        *bool   `json:"notify_discord,omitempty"`
+	DiscordWebhookURL    *string `json:"discord_webhook_url,omitempty"`
+	DiscordNotifySuccess *bool   `json:"discord_notify_success,omitempty"`
 	Email           *string `json:"email,omitempty"`
 	SMTPHost        *string `json:"smtp_host,omitempty"`
 	SMTPPort        *int    `json:"smtp_port,omitempty"`
 	SMTPUsername    *string `json:"smtp_username,omitempty"`
 	SMTPPassword    *string `json:"smtp_password,omitempty"`
+	// SMTPSecurity is starttls, tls or none; an empty string resets it to
+	// starttls
+	SMTPSecurity *string `json:"smtp_security,omitempty"`
+	// EmailRecipients replaces the recipients; an empty list removes them
+	EmailRecipients *EmailRecipients `json:"email_recipients,omitempty"`
+	// PagerDutyRoutingKey and OpsgenieAPIKey replace the keys; an empty
+	// string removes them
+	NotifyPagerDuty     *bool   `json:"notify_pagerduty,omitempty"`
+	PagerDutyRoutingKey *string `json:"pagerduty_routing_key,omitempty"`
+	NotifyOpsgenie      *bool   `json:"notify_opsgenie,omitempty"`
+	OpsgenieAPIKey      *string `json:"opsgenie_api_key,omitempty"`
+	OpsgenieRegion      *string `json:"opsgenie_region,omitempty"`
+	// An empty string removes a push server URL, topic or token
+	NotifyNtfy      *bool   `json:"notify_ntfy,omitempty"`
+	NtfyServerURL   *string `json:"ntfy_server_url,omitempty"`
+	NtfyTopic       *string `json:"ntfy_topic,omitempty"`
+	NtfyToken       *string `json:"ntfy_token,omitempty"`
+	NotifyGotify    *bool   `json:"notify_gotify,omitempty"`
+	GotifyServerURL *string `json:"gotify_server_url,omitempty"`
+	GotifyToken     *string `json:"gotify_token,omitempty"`
+	// An empty string removes the Matrix homeserver URL, token or room
+	NotifyMatrix        *bool   `json:"notify_matrix,omitempty"`
+	MatrixHomeserverURL *string `json:"matrix_homeserver_url,omitempty"`
+	MatrixAccessToken   *string `json:"matrix_access_token,omitempty"`
+	MatrixRoomID        *string `json:"matrix_room_id,omitempty"`
+	MatrixNotifySuccess *bool   `json:"matrix_notify_success,omitempty"`
+	// An empty string removes the Slack webhook of the digest
+	DigestFrequency       *string `json:"digest_frequency,omitempty"`
+	DigestWeekday         *int    `json:"digest_weekday,omitempty"`
+	DigestSlackWebhookURL *string `json:"digest_slack_webhook_url,omitempty"`
 	// S3-compatible storage settings
 	S3Enabled    *bool   `json:"s3_enabled,omitempty"`
 	S3Endpoint   *string `json:"s3_endpoint,omitempty"`
@@ -53,4 +132,29 @@ type UpdateSettingsRequest struct {
 	S3UseSSL     *bool   `json:"s3_use_ssl,omitempty"`
 	S3PathPrefix *string `json:"s3_path_prefix,omitempty"`
 	S3PurgeLocal *bool   `json:"s3_purge_local,omitempty"`
+	// NotificationFallbacks replaces the fallback chains; an empty map removes them
+	NotificationFallbacks *NotificationFallbacks `json:"notification_fallbacks,omitempty"`
+}
+
+// TestDiscordRequest names the webhook a test notification is sent to;
+// without a URL the webhook of the settings is used
+type TestDiscordRequest struct {
+	WebhookURL *string `json:"webhook_url,omitempty"`
+}
+
+// TestIncidentRequest names the incident integration to test, pagerduty or
+// opsgenie
+type TestIncidentRequest struct {
+	Provider string `json:"provider"`
+}
+
+// TestMatrixRequest sends a test message to RoomID, or to the room of the
+// settings when it is left out
+type TestMatrixRequest struct {
+	RoomID *string `json:"room_id"`
+}
+
+// TestPushRequest names the push service to test, ntfy or gotify
+type TestPushRequest struct {
+	Service string `json:"service"`
 }
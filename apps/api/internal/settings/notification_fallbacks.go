@@ -0,0 +1,139 @@
+package settings
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/notification"
+)
+
+// Channels a fallback chain delivers through
+const (
+	ChannelDashboard = "dashboard"
+	ChannelEmail     = "email"
+	ChannelWebhook   = "webhook"
+	ChannelDiscord   = "discord"
+	ChannelNtfy      = "ntfy"
+	ChannelGotify    = "gotify"
+	ChannelMatrix    = "matrix"
+)
+
+// maxFallbackChannels caps the length of one event's chain
+const maxFallbackChannels = 5
+
+// FallbackChannel is one step of a fallback chain. Target is the webhook URL
+// (a Slack incoming webhook or an SMS gateway, say), the Discord webhook, the
+// ntfy topic, the Matrix room ID or the email address to deliver to,
+// defaulting to the one of the settings. Gotify takes no target.
+type FallbackChannel struct {
+	Type   string  `json:"type"`
+	Target *string `json:"target,omitempty"`
+}
+
+// NotificationFallbacks maps a notification type to the channels tried in
+// order until one delivers. Events with a chain are delivered only through
+// it; the others go to every enabled channel.
+type NotificationFallbacks map[string][]FallbackChannel
+
+// fallbackEvents are the notification types a chain can be defined for
+var fallbackEvents = map[notification.NotificationType]bool{
+	notification.BackupFailed:                 true,
+	notification.BackupCorrupt:                true,
+	notification.BackupPrecheckFailed:         true,
+	notification.BackupPartial:                true,
+	notification.ConnectionCredentialsInvalid: true,
+}
+
+// Value stores the chains as JSON in a nullable text column
+func (f NotificationFallbacks) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (f *NotificationFallbacks) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	case []byte:
+		return json.Unmarshal(v, f)
+	default:
+		return fmt.Errorf("cannot scan %T into notification fallbacks", src)
+	}
+}
+
+// validateNotificationFallbacks checks the chains submitted with a settings
+// request. Events with an empty chain are dropped.
+func validateNotificationFallbacks(fallbacks NotificationFallbacks) (NotificationFallbacks, error) {
+	validated := make(NotificationFallbacks)
+	for event, chain := range fallbacks {
+		if !fallbackEvents[notification.NotificationType(event)] {
+			return nil, fmt.Errorf("unknown notification event %q", event)
+		}
+		if len(chain) == 0 {
+			continue
+		}
+		if len(chain) > maxFallbackChannels {
+			return nil, fmt.Errorf("fallback chain of %s has more than %d channels", event, maxFallbackChannels)
+		}
+
+		for i, channel := range chain {
+			if err := ValidateChannel(channel); err != nil {
+				return nil, fmt.Errorf("fallback channel %d of %s: %v", i+1, event, err)
+			}
+		}
+		validated[event] = chain
+	}
+	return validated, nil
+}
+
+// ValidateChannel checks the type and target of a channel notifications are
+// delivered through
+func ValidateChannel(channel FallbackChannel) error {
+	switch channel.Type {
+	case ChannelDashboard:
+		if channel.Target != nil {
+			return fmt.Errorf("dashboard takes no target")
+		}
+	case ChannelEmail:
+		if channel.Target != nil && !strings.Contains(*channel.Target, "@") {
+			return fmt.Errorf("invalid email address %q", *channel.Target)
+		}
+	case ChannelWebhook:
+		if channel.Target != nil {
+			parsed, err := url.Parse(*channel.Target)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("webhook target must be an http or https URL")
+			}
+		}
+	case ChannelDiscord:
+		if channel.Target != nil {
+			return notification.ValidateDiscordWebhookURL(*channel.Target)
+		}
+	case ChannelNtfy:
+		if channel.Target != nil {
+			return notification.ValidateNtfyTopic(*channel.Target)
+		}
+	case ChannelMatrix:
+		if channel.Target != nil {
+			return notification.ValidateMatrixRoomID(*channel.Target)
+		}
+	case ChannelGotify:
+		if channel.Target != nil {
+			return fmt.Errorf("gotify takes no target")
+		}
+	default:
+		return fmt.Errorf("unknown channel type %q", channel.Type)
+	}
+	return nil
+}
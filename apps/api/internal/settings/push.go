@@ -0,0 +1,130 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/dendianugerah/velld/internal/notification"
+	"github.com/google/uuid"
+)
+
+// Push services
+const (
+	PushNtfy   = "ntfy"
+	PushGotify = "gotify"
+)
+
+// PushSettingsError is a missing or malformed ntfy or Gotify setting
+type PushSettingsError struct {
+	Reason string
+}
+
+func (e *PushSettingsError) Error() string {
+	return e.Reason
+}
+
+// normalizePushServerURL checks a submitted server URL; an empty one removes
+// it
+func normalizePushServerURL(raw string) (*string, error) {
+	serverURL := strings.TrimRight(strings.TrimSpace(raw), "/")
+	if serverURL == "" {
+		return nil, nil
+	}
+	if err := notification.ValidatePushServerURL(serverURL); err != nil {
+		return nil, &PushSettingsError{Reason: err.Error()}
+	}
+	return &serverURL, nil
+}
+
+func normalizeNtfyTopic(raw string) (*string, error) {
+	topic := strings.TrimSpace(raw)
+	if topic == "" {
+		return nil, nil
+	}
+	if err := notification.ValidateNtfyTopic(topic); err != nil {
+		return nil, &PushSettingsError{Reason: err.Error()}
+	}
+	return &topic, nil
+}
+
+// decryptPushToken decrypts a stored ntfy or Gotify token; without one it
+// returns an empty token
+func (s *SettingsService) decryptPushToken(encrypted *string) (string, error) {
+	if encrypted == nil {
+		return "", nil
+	}
+	return s.cryptoService.Decrypt(*encrypted)
+}
+
+// TestPushNotification sends a test message through the configured ntfy or
+// Gotify server, whether or not its notifications are enabled
+func (s *SettingsService) TestPushNotification(userID uuid.UUID, req *TestPushRequest) error {
+	settings, err := s.repo.GetUserSettings(userID)
+	if err != nil {
+		return err
+	}
+
+	msg := &notification.PushMessage{
+		Title:    "Velld test notification",
+		Message:  "Push notifications from Velld reach this device.",
+		Priority: notification.PushPriorityDefault,
+	}
+
+	switch req.Service {
+	case PushNtfy:
+		if settings.NtfyTopic == nil {
+			return &PushSettingsError{Reason: "no ntfy topic configured"}
+		}
+		token, err := s.decryptPushToken(settings.NtfyToken)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt ntfy token: %v", err)
+		}
+		serverURL := ""
+		if settings.NtfyServerURL != nil {
+			serverURL = *settings.NtfyServerURL
+		}
+		return notification.SendNtfy(serverURL, *settings.NtfyTopic, token, msg)
+	case PushGotify:
+		if settings.GotifyServerURL == nil || settings.GotifyToken == nil {
+			return &PushSettingsError{Reason: "no Gotify server URL or application token configured"}
+		}
+		token, err := s.decryptPushToken(settings.GotifyToken)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt Gotify token: %v", err)
+		}
+		return notification.SendGotify(*settings.GotifyServerURL, token, msg)
+	default:
+		return &PushSettingsError{Reason: fmt.Sprintf("service must be %s or %s", PushNtfy, PushGotify)}
+	}
+}
+
+func (h *SettingsHandler) TestPushNotification(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var req TestPushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.TestPushNotification(userID, &req); err != nil {
+		var invalid *PushSettingsError
+		if errors.As(err, &invalid) {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		response.SendError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Test notification sent", nil)
+}
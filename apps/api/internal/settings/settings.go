@@ -2,6 +2,7 @@ package settings
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/dendianugerah/velld/internal/common"
@@ -47,6 +48,16 @@ func (h *SettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.Request)
 
 	settings, err := h.service.UpdateUserSettings(userID, &req)
 	if err != nil {
+		var invalid *DiscordWebhookError
+		var invalidIncident *IncidentSettingsError
+		var invalidPush *PushSettingsError
+		var invalidMatrix *MatrixSettingsError
+		var invalidDigest *DigestSettingsError
+		if errors.As(err, &invalid) || errors.As(err, &invalidIncident) || errors.As(err, &invalidPush) ||
+			errors.As(err, &invalidMatrix) || errors.As(err, &invalidDigest) {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -25,6 +25,12 @@ func (r *SettingsRepository) GetUserSettings(userID uuid.UUID) (*UserSettings, e
                webhook_url, email, smtp_host, smtp_port, smtp_username, 
                smtp_password, s3_enabled, s3_endpoint, s3_region, s3_bucket,
                s3_access_key, s3_secret_key, s3_use_ssl, s3_path_prefix, s3_purge_local,
+               notification_fallbacks, notify_discord, discord_webhook_url, discord_notify_success,
+               smtp_security, email_recipients, notify_pagerduty, pagerduty_routing_key,
+               notify_opsgenie, opsgenie_api_key, opsgenie_region, notify_ntfy, ntfy_server_url,
+               ntfy_topic, ntfy_token, notify_gotify, gotify_server_url, gotify_token,
+               notify_matrix, matrix_homeserver_url, matrix_access_token, matrix_room_id,
+               matrix_notify_success, digest_frequency, digest_weekday, digest_slack_webhook_url,
                created_at, updated_at
         FROM user_settings
         WHERE user_id = $1`, userID).Scan(
@@ -34,7 +40,15 @@ func (r *SettingsRepository) GetUserSettings(userID uuid.UUID) (*UserSettings, e
 		&settings.SMTPUsername, &settings.SMTPPassword,
 		&settings.S3Enabled, &settings.S3Endpoint, &settings.S3Region, &settings.S3Bucket,
 		&settings.S3AccessKey, &settings.S3SecretKey, &settings.S3UseSSL, &settings.S3PathPrefix,
-		&settings.S3PurgeLocal,
+		&settings.S3PurgeLocal, &settings.NotificationFallbacks,
+		&settings.NotifyDiscord, &settings.DiscordWebhookURL, &settings.DiscordNotifySuccess,
+		&settings.SMTPSecurity, &settings.EmailRecipients,
+		&settings.NotifyPagerDuty, &settings.PagerDutyRoutingKey,
+		&settings.NotifyOpsgenie, &settings.OpsgenieAPIKey, &settings.OpsgenieRegion,
+		&settings.NotifyNtfy, &settings.NtfyServerURL, &settings.NtfyTopic, &settings.NtfyToken,
+		&settings.NotifyGotify, &settings.GotifyServerURL, &settings.GotifyToken,
+		&settings.NotifyMatrix, &settings.MatrixHomeserverURL, &settings.MatrixAccessToken, &settings.MatrixRoomID,
+		&settings.MatrixNotifySuccess, &settings.DigestFrequency, &settings.DigestWeekday, &settings.DigestSlackWebhookURL,
 		&createdAtStr, &updatedAtStr)
 
 	if err == sql.ErrNoRows {
@@ -45,6 +59,8 @@ func (r *SettingsRepository) GetUserSettings(userID uuid.UUID) (*UserSettings, e
 			UserID:          userID,
 			NotifyDashboard: true,
 			S3UseSSL:        true,
+			DigestFrequency: DigestDaily,
+			DigestWeekday:   int(time.Monday),
 			CreatedAt:       now,
 			UpdatedAt:       now,
 		}
@@ -76,15 +92,29 @@ func (r *SettingsRepository) CreateUserSettings(settings *UserSettings) error {
             webhook_url, email, smtp_host, smtp_port, smtp_username, 
             smtp_password, s3_enabled, s3_endpoint, s3_region, s3_bucket,
             s3_access_key, s3_secret_key, s3_use_ssl, s3_path_prefix, s3_purge_local,
+            notification_fallbacks, notify_discord, discord_webhook_url, discord_notify_success,
+            smtp_security, email_recipients, notify_pagerduty, pagerduty_routing_key,
+            notify_opsgenie, opsgenie_api_key, opsgenie_region, notify_ntfy, ntfy_server_url,
+            ntfy_topic, ntfy_token, notify_gotify, gotify_server_url, gotify_token,
+            notify_matrix, matrix_homeserver_url, matrix_access_token, matrix_room_id,
+            matrix_notify_success, digest_frequency, digest_weekday, digest_slack_webhook_url,
             created_at, updated_at
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)`,
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39, $40, $41, $42, $43, $44, $45, $46, $47, $48)`,
 		settings.ID, settings.UserID, settings.NotifyDashboard,
 		settings.NotifyEmail, settings.NotifyWebhook, settings.WebhookURL,
 		settings.Email, settings.SMTPHost, settings.SMTPPort,
 		settings.SMTPUsername, settings.SMTPPassword,
 		settings.S3Enabled, settings.S3Endpoint, settings.S3Region, settings.S3Bucket,
 		settings.S3AccessKey, settings.S3SecretKey, settings.S3UseSSL, settings.S3PathPrefix,
-		settings.S3PurgeLocal,
+		settings.S3PurgeLocal, settings.NotificationFallbacks,
+		settings.NotifyDiscord, settings.DiscordWebhookURL, settings.DiscordNotifySuccess,
+		settings.SMTPSecurity, settings.EmailRecipients,
+		settings.NotifyPagerDuty, settings.PagerDutyRoutingKey,
+		settings.NotifyOpsgenie, settings.OpsgenieAPIKey, settings.OpsgenieRegion,
+		settings.NotifyNtfy, settings.NtfyServerURL, settings.NtfyTopic, settings.NtfyToken,
+		settings.NotifyGotify, settings.GotifyServerURL, settings.GotifyToken,
+		settings.NotifyMatrix, settings.MatrixHomeserverURL, settings.MatrixAccessToken, settings.MatrixRoomID,
+		settings.MatrixNotifySuccess, settings.DigestFrequency, settings.DigestWeekday, settings.DigestSlackWebhookURL,
 		settings.CreatedAt, settings.UpdatedAt)
 	return err
 }
@@ -98,14 +128,30 @@ func (r *SettingsRepository) UpdateUserSettings(settings *UserSettings) error {
             smtp_username = $8, smtp_password = $9, s3_enabled = $10,
             s3_endpoint = $11, s3_region = $12, s3_bucket = $13,
             s3_access_key = $14, s3_secret_key = $15, s3_use_ssl = $16,
-            s3_path_prefix = $17, s3_purge_local = $18, updated_at = $19
-        WHERE user_id = $20`,
+            s3_path_prefix = $17, s3_purge_local = $18, notification_fallbacks = $19,
+            notify_discord = $20, discord_webhook_url = $21, discord_notify_success = $22,
+            smtp_security = $23, email_recipients = $24, notify_pagerduty = $25,
+            pagerduty_routing_key = $26, notify_opsgenie = $27, opsgenie_api_key = $28,
+            opsgenie_region = $29, notify_ntfy = $30, ntfy_server_url = $31, ntfy_topic = $32,
+            ntfy_token = $33, notify_gotify = $34, gotify_server_url = $35, gotify_token = $36,
+            notify_matrix = $37, matrix_homeserver_url = $38, matrix_access_token = $39,
+            matrix_room_id = $40, matrix_notify_success = $41, digest_frequency = $42,
+            digest_weekday = $43, digest_slack_webhook_url = $44, updated_at = $45
+        WHERE user_id = $46`,
 		settings.NotifyDashboard, settings.NotifyEmail, settings.NotifyWebhook,
 		settings.WebhookURL, settings.Email, settings.SMTPHost, settings.SMTPPort,
 		settings.SMTPUsername, settings.SMTPPassword,
 		settings.S3Enabled, settings.S3Endpoint, settings.S3Region, settings.S3Bucket,
 		settings.S3AccessKey, settings.S3SecretKey, settings.S3UseSSL, settings.S3PathPrefix,
-		settings.S3PurgeLocal,
+		settings.S3PurgeLocal, settings.NotificationFallbacks,
+		settings.NotifyDiscord, settings.DiscordWebhookURL, settings.DiscordNotifySuccess,
+		settings.SMTPSecurity, settings.EmailRecipients,
+		settings.NotifyPagerDuty, settings.PagerDutyRoutingKey,
+		settings.NotifyOpsgenie, settings.OpsgenieAPIKey, settings.OpsgenieRegion,
+		settings.NotifyNtfy, settings.NtfyServerURL, settings.NtfyTopic, settings.NtfyToken,
+		settings.NotifyGotify, settings.GotifyServerURL, settings.GotifyToken,
+		settings.NotifyMatrix, settings.MatrixHomeserverURL, settings.MatrixAccessToken, settings.MatrixRoomID,
+		settings.MatrixNotifySuccess, settings.DigestFrequency, settings.DigestWeekday, settings.DigestSlackWebhookURL,
 		settings.UpdatedAt, settings.UserID)
 	return err
 }
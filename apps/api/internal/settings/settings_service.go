@@ -3,8 +3,11 @@ package settings
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/mail"
 	"github.com/google/uuid"
 )
 
@@ -32,6 +35,11 @@ func (s *SettingsService) GetUserSettings(userID uuid.UUID) (*UserSettings, erro
 	// Remove sensitive data before returning
 	settings.SMTPPassword = nil
 	settings.S3SecretKey = nil
+	settings.PagerDutyRoutingKey = nil
+	settings.OpsgenieAPIKey = nil
+	settings.NtfyToken = nil
+	settings.GotifyToken = nil
+	settings.MatrixAccessToken = nil
 	return settings, nil
 }
 
@@ -71,6 +79,11 @@ func (s *SettingsService) applyDefaults(settings *UserSettings) {
 		settings.EnvConfigured["smtp_password"] = true
 	}
 
+	if smtpSecurity := os.Getenv("SMTP_SECURITY"); smtpSecurity != "" {
+		settings.SMTPSecurity = &smtpSecurity
+		settings.EnvConfigured["smtp_security"] = true
+	}
+
 	if smtpFrom := os.Getenv("SMTP_FROM"); smtpFrom != "" {
 		settings.Email = &smtpFrom
 		settings.EnvConfigured["email"] = true
@@ -88,6 +101,7 @@ func (s *SettingsService) UpdateUserSettings(userID uuid.UUID, req *UpdateSettin
 	envSMTPUser := os.Getenv("SMTP_USER") != ""
 	envSMTPPass := os.Getenv("SMTP_PASSWORD") != ""
 	envSMTPFrom := os.Getenv("SMTP_FROM") != ""
+	envSMTPSecurity := os.Getenv("SMTP_SECURITY") != ""
 
 	if req.NotifyDashboard != nil {
 		settings.NotifyDashboard = *req.NotifyDashboard
@@ -101,6 +115,19 @@ func (s *SettingsService) UpdateUserSettings(userID uuid.UUID, req *UpdateSettin
 	if req.WebhookURL != nil {
 		settings.WebhookURL = req.WebhookURL
 	}
+	if req.NotifyDiscord != nil {
+		settings.NotifyDiscord = *req.NotifyDiscord
+	}
+	if req.DiscordWebhookURL != nil {
+		webhookURL, err := normalizeDiscordWebhook(*req.DiscordWebhookURL)
+		if err != nil {
+			return nil, err
+		}
+		settings.DiscordWebhookURL = webhookURL
+	}
+	if req.DiscordNotifySuccess != nil {
+		settings.DiscordNotifySuccess = *req.DiscordNotifySuccess
+	}
 	if req.Email != nil && !envSMTPFrom {
 		settings.Email = req.Email
 	}
@@ -113,6 +140,147 @@ func (s *SettingsService) UpdateUserSettings(userID uuid.UUID, req *UpdateSettin
 	if req.SMTPUsername != nil && !envSMTPUser {
 		settings.SMTPUsername = req.SMTPUsername
 	}
+	if req.SMTPSecurity != nil && !envSMTPSecurity {
+		security := strings.ToLower(strings.TrimSpace(*req.SMTPSecurity))
+		if err := mail.ValidateSecurity(security); err != nil {
+			return nil, err
+		}
+		settings.SMTPSecurity = nil
+		if security != "" {
+			settings.SMTPSecurity = &security
+		}
+	}
+	if req.EmailRecipients != nil {
+		recipients, err := validateEmailRecipients(*req.EmailRecipients)
+		if err != nil {
+			return nil, err
+		}
+		settings.EmailRecipients = recipients
+	}
+	if req.NotifyPagerDuty != nil {
+		settings.NotifyPagerDuty = *req.NotifyPagerDuty
+	}
+	if req.PagerDutyRoutingKey != nil {
+		key, err := s.encryptIncidentKey(*req.PagerDutyRoutingKey)
+		if err != nil {
+			return nil, err
+		}
+		settings.PagerDutyRoutingKey = key
+	}
+	if req.NotifyOpsgenie != nil {
+		settings.NotifyOpsgenie = *req.NotifyOpsgenie
+	}
+	if req.OpsgenieAPIKey != nil {
+		key, err := s.encryptIncidentKey(*req.OpsgenieAPIKey)
+		if err != nil {
+			return nil, err
+		}
+		settings.OpsgenieAPIKey = key
+	}
+	if req.OpsgenieRegion != nil {
+		region, err := normalizeOpsgenieRegion(*req.OpsgenieRegion)
+		if err != nil {
+			return nil, err
+		}
+		settings.OpsgenieRegion = region
+	}
+	if req.NotifyNtfy != nil {
+		settings.NotifyNtfy = *req.NotifyNtfy
+	}
+	if req.NtfyServerURL != nil {
+		serverURL, err := normalizePushServerURL(*req.NtfyServerURL)
+		if err != nil {
+			return nil, err
+		}
+		settings.NtfyServerURL = serverURL
+	}
+	if req.NtfyTopic != nil {
+		topic, err := normalizeNtfyTopic(*req.NtfyTopic)
+		if err != nil {
+			return nil, err
+		}
+		settings.NtfyTopic = topic
+	}
+	if req.NtfyToken != nil {
+		token, err := s.encryptIncidentKey(*req.NtfyToken)
+		if err != nil {
+			return nil, err
+		}
+		settings.NtfyToken = token
+	}
+	if req.NotifyGotify != nil {
+		settings.NotifyGotify = *req.NotifyGotify
+	}
+	if req.GotifyServerURL != nil {
+		serverURL, err := normalizePushServerURL(*req.GotifyServerURL)
+		if err != nil {
+			return nil, err
+		}
+		settings.GotifyServerURL = serverURL
+	}
+	if req.GotifyToken != nil {
+		token, err := s.encryptIncidentKey(*req.GotifyToken)
+		if err != nil {
+			return nil, err
+		}
+		settings.GotifyToken = token
+	}
+	if req.NotifyMatrix != nil {
+		settings.NotifyMatrix = *req.NotifyMatrix
+	}
+	if req.MatrixHomeserverURL != nil {
+		homeserverURL, err := normalizeMatrixHomeserver(*req.MatrixHomeserverURL)
+		if err != nil {
+			return nil, err
+		}
+		settings.MatrixHomeserverURL = homeserverURL
+	}
+	if req.MatrixAccessToken != nil {
+		token, err := s.encryptIncidentKey(*req.MatrixAccessToken)
+		if err != nil {
+			return nil, err
+		}
+		settings.MatrixAccessToken = token
+	}
+	if req.MatrixRoomID != nil {
+		roomID, err := normalizeMatrixRoomID(*req.MatrixRoomID)
+		if err != nil {
+			return nil, err
+		}
+		settings.MatrixRoomID = roomID
+	}
+	if req.MatrixNotifySuccess != nil {
+		settings.MatrixNotifySuccess = *req.MatrixNotifySuccess
+	}
+	if req.DigestFrequency != nil {
+		frequency, err := normalizeDigestFrequency(*req.DigestFrequency)
+		if err != nil {
+			return nil, err
+		}
+		settings.DigestFrequency = frequency
+	}
+	if req.DigestWeekday != nil {
+		if *req.DigestWeekday < int(time.Sunday) || *req.DigestWeekday > int(time.Saturday) {
+			return nil, &DigestSettingsError{Reason: "digest weekday must be 0 (Sunday) to 6 (Saturday)"}
+		}
+		settings.DigestWeekday = *req.DigestWeekday
+	}
+	if req.DigestSlackWebhookURL != nil {
+		webhookURL, err := normalizeSlackWebhook(*req.DigestSlackWebhookURL)
+		if err != nil {
+			return nil, err
+		}
+		settings.DigestSlackWebhookURL = webhookURL
+	}
+	if settings.NotifyNtfy && settings.NtfyTopic == nil {
+		return nil, &PushSettingsError{Reason: "an ntfy topic is required to enable ntfy notifications"}
+	}
+	if settings.NotifyGotify && (settings.GotifyServerURL == nil || settings.GotifyToken == nil) {
+		return nil, &PushSettingsError{Reason: "a Gotify server URL and application token are required to enable Gotify notifications"}
+	}
+	if settings.NotifyMatrix && (settings.MatrixHomeserverURL == nil || settings.MatrixAccessToken == nil || settings.MatrixRoomID == nil) {
+		return nil, &MatrixSettingsError{Reason: "a Matrix homeserver URL, access token and room ID are required to enable Matrix notifications"}
+	}
 	if req.SMTPPassword != nil && !envSMTPPass {
 		// Encrypt SMTP password before storing
 		encryptedPass, err := s.cryptoService.Encrypt(*req.SMTPPassword)
@@ -155,6 +323,13 @@ func (s *SettingsService) UpdateUserSettings(userID uuid.UUID, req *UpdateSettin
 	if req.S3PurgeLocal != nil {
 		settings.S3PurgeLocal = *req.S3PurgeLocal
 	}
+	if req.NotificationFallbacks != nil {
+		fallbacks, err := validateNotificationFallbacks(*req.NotificationFallbacks)
+		if err != nil {
+			return nil, err
+		}
+		settings.NotificationFallbacks = fallbacks
+	}
 
 	if err := s.repo.UpdateUserSettings(settings); err != nil {
 		return nil, err
@@ -163,5 +338,10 @@ func (s *SettingsService) UpdateUserSettings(userID uuid.UUID, req *UpdateSettin
 	// Remove sensitive data before returning
 	settings.SMTPPassword = nil
 	settings.S3SecretKey = nil
+	settings.PagerDutyRoutingKey = nil
+	settings.OpsgenieAPIKey = nil
+	settings.NtfyToken = nil
+	settings.GotifyToken = nil
+	settings.MatrixAccessToken = nil
 	return settings, nil
 }
@@ -0,0 +1,56 @@
+package team
+
+import (
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+)
+
+// Roles of team members
+const (
+	// RoleAdmin manages the team's members and connections
+	RoleAdmin = connection.RoleTeamAdmin
+	// RoleMember uses the team's connections, schedules and backups
+	RoleMember = connection.RoleTeamMember
+)
+
+// Team shares connections, with their schedules and backups, between its
+// members. Backups of a shared connection are still stored and notified
+// with the settings of its owner.
+type Team struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedBy uuid.UUID `json:"created_by"`
+	// Role is the role of the user the team is listed for
+	Role        string    `json:"role,omitempty"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Member is a user of a team with their role in it
+type Member struct {
+	TeamID    uuid.UUID `json:"team_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TeamRequest struct {
+	Name *string `json:"name"`
+}
+
+// MemberRequest adds a user to a team by username, or changes the role of
+// a member
+type MemberRequest struct {
+	Username *string `json:"username"`
+	Role     *string `json:"role"`
+}
+
+// ConnectionTeamRequest shares a connection with a team, or stops sharing
+// it with a null team
+type ConnectionTeamRequest struct {
+	TeamID *string `json:"team_id"`
+}
@@ -0,0 +1,249 @@
+package team
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type TeamHandler struct {
+	service *TeamService
+}
+
+func NewTeamHandler(service *TeamService) *TeamHandler {
+	return &TeamHandler{service: service}
+}
+
+// sendTeamError maps service errors to their status; notFound names what
+// was not found
+func sendTeamError(w http.ResponseWriter, err error, notFound string) {
+	var teamErr *TeamError
+	switch {
+	case errors.As(err, &teamErr):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNotAdmin):
+		response.SendError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		response.SendError(w, http.StatusNotFound, notFound)
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// requestIDs returns the user and the {id} of the route
+func requestIDs(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return uuid.Nil, uuid.Nil, false
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, "invalid ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, id, true
+}
+
+// requestMemberID returns the {user_id} of the route
+func requestMemberID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(mux.Vars(r)["user_id"])
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, "invalid user ID")
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func (h *TeamHandler) GetTeams(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	teams, err := h.service.GetTeams(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Teams retrieved successfully", teams)
+}
+
+func (h *TeamHandler) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req TeamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	team, err := h.service.CreateTeam(userID, &req)
+	if err != nil {
+		sendTeamError(w, err, "team not found")
+		return
+	}
+
+	response.SendSuccess(w, "Team created successfully", team)
+}
+
+func (h *TeamHandler) GetTeam(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	team, err := h.service.GetTeam(userID, id)
+	if err != nil {
+		sendTeamError(w, err, "team not found")
+		return
+	}
+
+	response.SendSuccess(w, "Team retrieved successfully", team)
+}
+
+func (h *TeamHandler) UpdateTeam(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req TeamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	team, err := h.service.UpdateTeam(userID, id, &req)
+	if err != nil {
+		sendTeamError(w, err, "team not found")
+		return
+	}
+
+	response.SendSuccess(w, "Team updated successfully", team)
+}
+
+func (h *TeamHandler) DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteTeam(userID, id); err != nil {
+		sendTeamError(w, err, "team not found")
+		return
+	}
+
+	response.SendSuccess(w, "Team deleted successfully", nil)
+}
+
+func (h *TeamHandler) GetMembers(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := h.service.GetMembers(userID, id)
+	if err != nil {
+		sendTeamError(w, err, "team not found")
+		return
+	}
+
+	response.SendSuccess(w, "Team members retrieved successfully", members)
+}
+
+func (h *TeamHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req MemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	member, err := h.service.AddMember(userID, id, &req)
+	if err != nil {
+		sendTeamError(w, err, "team not found")
+		return
+	}
+
+	response.SendSuccess(w, "Team member added successfully", member)
+}
+
+func (h *TeamHandler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+	memberID, ok := requestMemberID(w, r)
+	if !ok {
+		return
+	}
+
+	var req MemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.UpdateMember(userID, id, memberID, &req); err != nil {
+		sendTeamError(w, err, "team member not found")
+		return
+	}
+
+	response.SendSuccess(w, "Team member updated successfully", nil)
+}
+
+func (h *TeamHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+	memberID, ok := requestMemberID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveMember(userID, id, memberID); err != nil {
+		sendTeamError(w, err, "team member not found")
+		return
+	}
+
+	response.SendSuccess(w, "Team member removed successfully", nil)
+}
+
+func (h *TeamHandler) SetConnectionTeam(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req ConnectionTeamRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.service.SetConnectionTeam(userID, mux.Vars(r)["id"], &req); err != nil {
+		sendTeamError(w, err, "connection not found")
+		return
+	}
+
+	response.SendSuccess(w, "Connection team updated successfully", nil)
+}
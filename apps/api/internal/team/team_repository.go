@@ -0,0 +1,206 @@
+package team
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/google/uuid"
+)
+
+type TeamRepository struct {
+	db *sql.DB
+}
+
+func NewTeamRepository(db *sql.DB) *TeamRepository {
+	return &TeamRepository{db: db}
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// teamColumns are read with the role of the user $1 and the member count
+const teamColumns = `t.id, t.name, t.created_by, t.created_at, t.updated_at,
+	COALESCE((SELECT role FROM team_members WHERE team_id = t.id AND user_id = $1), ''),
+	(SELECT COUNT(*) FROM team_members WHERE team_id = t.id)`
+
+func scanTeam(row rowScanner) (*Team, error) {
+	team := &Team{}
+	var createdAtStr, updatedAtStr string
+	if err := row.Scan(&team.ID, &team.Name, &team.CreatedBy, &createdAtStr, &updatedAtStr,
+		&team.Role, &team.MemberCount); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if team.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, err
+	}
+	if team.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// CreateTeam creates a team with its creator as its first admin
+func (r *TeamRepository) CreateTeam(team *Team) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	createdAt := team.CreatedAt.Format(time.RFC3339)
+	if _, err := tx.Exec(`
+		INSERT INTO teams (id, name, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		team.ID, team.Name, team.CreatedBy, createdAt, team.UpdatedAt.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO team_members (team_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)`,
+		team.ID, team.CreatedBy, RoleAdmin, createdAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTeam returns a team with the role of the user in it
+func (r *TeamRepository) GetTeam(id, userID uuid.UUID) (*Team, error) {
+	row := r.db.QueryRow(`SELECT `+teamColumns+` FROM teams t WHERE t.id = $2`, userID, id)
+	return scanTeam(row)
+}
+
+// GetUserTeams returns the teams the user is a member of
+func (r *TeamRepository) GetUserTeams(userID uuid.UUID) ([]*Team, error) {
+	rows, err := r.db.Query(`
+		SELECT `+teamColumns+`
+		FROM teams t
+		WHERE t.id IN (SELECT team_id FROM team_members WHERE user_id = $1)
+		ORDER BY t.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []*Team{}
+	for rows.Next() {
+		team, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+func (r *TeamRepository) UpdateTeam(team *Team) error {
+	_, err := r.db.Exec(`UPDATE teams SET name = $1, updated_at = $2 WHERE id = $3`,
+		team.Name, team.UpdatedAt.Format(time.RFC3339), team.ID)
+	return err
+}
+
+// DeleteTeam removes a team with its members. Its connections are no
+// longer shared and stay with their owners.
+func (r *TeamRepository) DeleteTeam(id uuid.UUID) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE connections SET team_id = NULL WHERE team_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM team_members WHERE team_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM teams WHERE id = $1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetMemberRole returns the role of the user in the team; sql.ErrNoRows
+// when they are not a member
+func (r *TeamRepository) GetMemberRole(teamID, userID uuid.UUID) (string, error) {
+	var role string
+	err := r.db.QueryRow(`SELECT role FROM team_members WHERE team_id = $1 AND user_id = $2`,
+		teamID, userID).Scan(&role)
+	return role, err
+}
+
+func (r *TeamRepository) GetMembers(teamID uuid.UUID) ([]*Member, error) {
+	rows, err := r.db.Query(`
+		SELECT m.team_id, m.user_id, COALESCE(u.username, ''), m.role, m.created_at
+		FROM team_members m
+		LEFT JOIN users u ON u.id = m.user_id
+		WHERE m.team_id = $1
+		ORDER BY m.created_at`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+	for rows.Next() {
+		member := &Member{}
+		var createdAtStr string
+		if err := rows.Scan(&member.TeamID, &member.UserID, &member.Username, &member.Role, &createdAtStr); err != nil {
+			return nil, err
+		}
+		if member.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+func (r *TeamRepository) AddMember(member *Member) error {
+	_, err := r.db.Exec(`
+		INSERT INTO team_members (team_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)`,
+		member.TeamID, member.UserID, member.Role, member.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *TeamRepository) UpdateMemberRole(teamID, userID uuid.UUID, role string) error {
+	_, err := r.db.Exec(`UPDATE team_members SET role = $1 WHERE team_id = $2 AND user_id = $3`,
+		role, teamID, userID)
+	return err
+}
+
+func (r *TeamRepository) RemoveMember(teamID, userID uuid.UUID) error {
+	_, err := r.db.Exec(`DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`, teamID, userID)
+	return err
+}
+
+// CountAdmins returns how many admins the team has
+func (r *TeamRepository) CountAdmins(teamID uuid.UUID) (int, error) {
+	var count int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM team_members WHERE team_id = $1 AND role = $2`,
+		teamID, RoleAdmin).Scan(&count)
+	return count, err
+}
+
+// GetUserIDByUsername returns the ID of an active user
+func (r *TeamRepository) GetUserIDByUsername(username string) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := r.db.QueryRow(`SELECT id FROM users WHERE username = $1 AND deactivated_at IS NULL`,
+		username).Scan(&id)
+	return id, err
+}
+
+// SetConnectionTeam shares a connection with a team, or with none when
+// teamID is nil
+func (r *TeamRepository) SetConnectionTeam(connectionID string, teamID *uuid.UUID) error {
+	var value interface{}
+	if teamID != nil {
+		value = teamID.String()
+	}
+	_, err := r.db.Exec(`UPDATE connections SET team_id = $1 WHERE id = $2`, value, connectionID)
+	return err
+}
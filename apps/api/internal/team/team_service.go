@@ -0,0 +1,274 @@
+package team
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+)
+
+const maxNameLength = 100
+
+// TeamError is a team request that cannot be saved as submitted
+type TeamError struct {
+	Reason string
+}
+
+func (e *TeamError) Error() string {
+	return e.Reason
+}
+
+// ErrNotAdmin is returned to members that are not admins of the team for
+// changes only admins can make
+var ErrNotAdmin = errors.New("only admins of the team can do this")
+
+type TeamService struct {
+	repo        *TeamRepository
+	connStorage *connection.ConnectionRepository
+}
+
+func NewTeamService(repo *TeamRepository, connStorage *connection.ConnectionRepository) *TeamService {
+	return &TeamService{
+		repo:        repo,
+		connStorage: connStorage,
+	}
+}
+
+func validateName(name *string) (string, error) {
+	if name == nil || strings.TrimSpace(*name) == "" {
+		return "", &TeamError{Reason: "name is required"}
+	}
+	trimmed := strings.TrimSpace(*name)
+	if len(trimmed) > maxNameLength {
+		return "", &TeamError{Reason: fmt.Sprintf("name must be at most %d characters", maxNameLength)}
+	}
+	return trimmed, nil
+}
+
+func validateRole(role string) error {
+	if role != RoleAdmin && role != RoleMember {
+		return &TeamError{Reason: fmt.Sprintf("role must be %s or %s", RoleAdmin, RoleMember)}
+	}
+	return nil
+}
+
+func (s *TeamService) GetTeams(userID uuid.UUID) ([]*Team, error) {
+	return s.repo.GetUserTeams(userID)
+}
+
+// GetTeam returns a team the user is a member of; others are not found
+func (s *TeamService) GetTeam(userID, id uuid.UUID) (*Team, error) {
+	team, err := s.repo.GetTeam(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if team.Role == "" {
+		return nil, sql.ErrNoRows
+	}
+	return team, nil
+}
+
+// adminTeam returns a team the user administers
+func (s *TeamService) adminTeam(userID, id uuid.UUID) (*Team, error) {
+	team, err := s.GetTeam(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if team.Role != RoleAdmin {
+		return nil, ErrNotAdmin
+	}
+	return team, nil
+}
+
+// CreateTeam creates a team administered by the user
+func (s *TeamService) CreateTeam(userID uuid.UUID, req *TeamRequest) (*Team, error) {
+	name, err := validateName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	team := &Team{
+		ID:          uuid.New(),
+		Name:        name,
+		CreatedBy:   userID,
+		Role:        RoleAdmin,
+		MemberCount: 1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.repo.CreateTeam(team); err != nil {
+		return nil, fmt.Errorf("failed to create team: %v", err)
+	}
+	return team, nil
+}
+
+func (s *TeamService) UpdateTeam(userID, id uuid.UUID, req *TeamRequest) (*Team, error) {
+	team, err := s.adminTeam(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	name, err := validateName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	team.Name = name
+	team.UpdatedAt = time.Now()
+	if err := s.repo.UpdateTeam(team); err != nil {
+		return nil, fmt.Errorf("failed to update team: %v", err)
+	}
+	return team, nil
+}
+
+// DeleteTeam removes a team; its connections go back to their owners
+func (s *TeamService) DeleteTeam(userID, id uuid.UUID) error {
+	if _, err := s.adminTeam(userID, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteTeam(id)
+}
+
+func (s *TeamService) GetMembers(userID, id uuid.UUID) ([]*Member, error) {
+	if _, err := s.GetTeam(userID, id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetMembers(id)
+}
+
+// AddMember adds a user to a team by username, as a member unless another
+// role is given
+func (s *TeamService) AddMember(userID, id uuid.UUID, req *MemberRequest) (*Member, error) {
+	if _, err := s.adminTeam(userID, id); err != nil {
+		return nil, err
+	}
+	if req.Username == nil || strings.TrimSpace(*req.Username) == "" {
+		return nil, &TeamError{Reason: "username is required"}
+	}
+	role := RoleMember
+	if req.Role != nil {
+		role = *req.Role
+	}
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+
+	username := strings.TrimSpace(*req.Username)
+	memberID, err := s.repo.GetUserIDByUsername(username)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &TeamError{Reason: fmt.Sprintf("user %s not found", username)}
+		}
+		return nil, fmt.Errorf("failed to get user: %v", err)
+	}
+	if _, err := s.repo.GetMemberRole(id, memberID); err == nil {
+		return nil, &TeamError{Reason: fmt.Sprintf("%s is already a member of the team", username)}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get member: %v", err)
+	}
+
+	member := &Member{
+		TeamID:    id,
+		UserID:    memberID,
+		Username:  username,
+		Role:      role,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.AddMember(member); err != nil {
+		return nil, fmt.Errorf("failed to add member: %v", err)
+	}
+	return member, nil
+}
+
+// keepsAdmin fails when the member is the last admin of the team, who
+// cannot be demoted or removed
+func (s *TeamService) keepsAdmin(id, memberID uuid.UUID) error {
+	role, err := s.repo.GetMemberRole(id, memberID)
+	if err != nil {
+		return err
+	}
+	if role != RoleAdmin {
+		return nil
+	}
+	admins, err := s.repo.CountAdmins(id)
+	if err != nil {
+		return fmt.Errorf("failed to count admins: %v", err)
+	}
+	if admins <= 1 {
+		return &TeamError{Reason: "a team needs at least one admin"}
+	}
+	return nil
+}
+
+// UpdateMember changes the role of a member
+func (s *TeamService) UpdateMember(userID, id, memberID uuid.UUID, req *MemberRequest) error {
+	if _, err := s.adminTeam(userID, id); err != nil {
+		return err
+	}
+	if req.Role == nil {
+		return &TeamError{Reason: "role is required"}
+	}
+	if err := validateRole(*req.Role); err != nil {
+		return err
+	}
+	if _, err := s.repo.GetMemberRole(id, memberID); err != nil {
+		return err
+	}
+	if *req.Role != RoleAdmin {
+		if err := s.keepsAdmin(id, memberID); err != nil {
+			return err
+		}
+	}
+	return s.repo.UpdateMemberRole(id, memberID, *req.Role)
+}
+
+// RemoveMember removes a member from a team. Admins remove anyone; other
+// members only leave.
+func (s *TeamService) RemoveMember(userID, id, memberID uuid.UUID) error {
+	if memberID == userID {
+		if _, err := s.GetTeam(userID, id); err != nil {
+			return err
+		}
+	} else if _, err := s.adminTeam(userID, id); err != nil {
+		return err
+	}
+	if err := s.keepsAdmin(id, memberID); err != nil {
+		return err
+	}
+	return s.repo.RemoveMember(id, memberID)
+}
+
+// SetConnectionTeam shares a connection with a team the user administers,
+// or stops sharing it. Only the owner of the connection or an admin of its
+// current team can move it.
+func (s *TeamService) SetConnectionTeam(userID uuid.UUID, connectionID string, req *ConnectionTeamRequest) error {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return err
+	}
+	if !s.connStorage.HasAccess(conn, userID) {
+		return sql.ErrNoRows
+	}
+	if !s.connStorage.CanManage(conn, userID) {
+		return ErrNotAdmin
+	}
+
+	if req.TeamID == nil || *req.TeamID == "" {
+		return s.repo.SetConnectionTeam(connectionID, nil)
+	}
+	teamID, err := uuid.Parse(*req.TeamID)
+	if err != nil {
+		return &TeamError{Reason: "invalid team ID"}
+	}
+	if _, err := s.adminTeam(userID, teamID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &TeamError{Reason: "team not found"}
+		}
+		return err
+	}
+	return s.repo.SetConnectionTeam(connectionID, &teamID)
+}
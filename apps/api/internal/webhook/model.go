@@ -0,0 +1,165 @@
+package webhook
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event is what happened for a webhook to be called
+type Event string
+
+const (
+	EventBackupCompleted              Event = "backup.completed"
+	EventBackupFailed                 Event = "backup.failed"
+	EventBackupPartial                Event = "backup.partial"
+	EventBackupCorrupt                Event = "backup.corrupt"
+	EventBackupPrecheckFailed         Event = "backup.precheck_failed"
+	EventConnectionCredentialsInvalid Event = "connection.credentials_invalid"
+	EventRestoreCompleted             Event = "restore.completed"
+	EventRestoreFailed                Event = "restore.failed"
+	EventScheduleCreated              Event = "schedule.created"
+	EventScheduleUpdated              Event = "schedule.updated"
+	EventScheduleDisabled             Event = "schedule.disabled"
+	EventSchedulePaused               Event = "schedule.paused"
+	EventScheduleResumed              Event = "schedule.resumed"
+	// EventTest is only sent by testing a webhook
+	EventTest Event = "webhook.test"
+)
+
+// EventAll subscribes a webhook to every event
+const EventAll = "*"
+
+// knownEvents are the events a webhook can subscribe to
+var knownEvents = map[Event]bool{
+	EventBackupCompleted:              true,
+	EventBackupFailed:                 true,
+	EventBackupPartial:                true,
+	EventBackupCorrupt:                true,
+	EventBackupPrecheckFailed:         true,
+	EventConnectionCredentialsInvalid: true,
+	EventRestoreCompleted:             true,
+	EventRestoreFailed:                true,
+	EventScheduleCreated:              true,
+	EventScheduleUpdated:              true,
+	EventScheduleDisabled:             true,
+	EventSchedulePaused:               true,
+	EventScheduleResumed:              true,
+}
+
+// Events are the events a webhook subscribes to, stored as JSON
+type Events []string
+
+func (e Events) Value() (driver.Value, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (e *Events) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	case []byte:
+		return json.Unmarshal(v, e)
+	default:
+		return fmt.Errorf("cannot scan %T into webhook events", src)
+	}
+}
+
+// Has tells whether the events include event
+func (e Events) Has(event Event) bool {
+	for _, subscribed := range e {
+		if subscribed == EventAll || Event(subscribed) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook calls a URL of the user's choice when subscribed events happen
+type Webhook struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	URL    string    `json:"url"`
+	Events Events    `json:"events"`
+	// PayloadTemplate is a Go template rendering the request body from the
+	// Payload; without one the Payload is sent as JSON
+	PayloadTemplate *string `json:"payload_template,omitempty"`
+	ContentType     string  `json:"content_type"`
+	// MaxAttempts is how many times a delivery is tried before giving up
+	MaxAttempts int  `json:"max_attempts"`
+	Enabled     bool `json:"enabled"`
+	// Secret signs the requests. It is only returned when it is set, on
+	// creation or rotation; it is stored encrypted.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	encryptedSecret string
+}
+
+// WebhookRequest creates a webhook or updates one; fields left out of an
+// update keep their value
+type WebhookRequest struct {
+	Name            *string  `json:"name"`
+	URL             *string  `json:"url"`
+	Events          []string `json:"events"`
+	PayloadTemplate *string  `json:"payload_template"`
+	ContentType     *string  `json:"content_type"`
+	MaxAttempts     *int     `json:"max_attempts"`
+	Enabled         *bool    `json:"enabled"`
+	// Secret sets the signing secret; one is generated when a webhook is
+	// created without it or RotateSecret is set
+	Secret       *string `json:"secret"`
+	RotateSecret bool    `json:"rotate_secret"`
+}
+
+// Payload describes an event. It is sent as JSON, or fills the payload
+// template of the webhook.
+type Payload struct {
+	// ID is shared by every attempt to deliver the event
+	ID        uuid.UUID              `json:"id"`
+	Event     Event                  `json:"event"`
+	Timestamp time.Time              `json:"timestamp"`
+	Title     string                 `json:"title,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// Delivery states
+const (
+	DeliveryDelivered = "delivered"
+	// DeliveryRetrying attempts failed and are tried again
+	DeliveryRetrying = "retrying"
+	// DeliveryFailed attempts failed and are not tried again
+	DeliveryFailed = "failed"
+)
+
+// Delivery is one attempt to deliver an event to a webhook. The attempts of
+// one event share its event ID.
+type Delivery struct {
+	ID         uuid.UUID `json:"id"`
+	WebhookID  uuid.UUID `json:"webhook_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	EventID    uuid.UUID `json:"event_id"`
+	Event      Event     `json:"event"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"`
+	StatusCode *int      `json:"status_code,omitempty"`
+	Error      *string   `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	// Payload is the request body sent
+	Payload string `json:"payload"`
+	// Response is the start of the response body
+	Response  *string   `json:"response,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type WebhookHandler struct {
+	service *WebhookService
+}
+
+func NewWebhookHandler(service *WebhookService) *WebhookHandler {
+	return &WebhookHandler{service: service}
+}
+
+// sendWebhookError maps service errors to their status
+func sendWebhookError(w http.ResponseWriter, err error) {
+	var webhookErr *WebhookError
+	switch {
+	case errors.As(err, &webhookErr):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		response.SendError(w, http.StatusNotFound, "webhook not found")
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// requestIDs returns the user and the {id} of the route
+func requestIDs(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return uuid.Nil, uuid.Nil, false
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, "invalid ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, id, true
+}
+
+func (h *WebhookHandler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	webhooks, err := h.service.GetWebhooks(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Webhooks retrieved successfully", webhooks)
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhook, err := h.service.CreateWebhook(userID, &req)
+	if err != nil {
+		sendWebhookError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Webhook created successfully", webhook)
+}
+
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, err := h.service.GetWebhook(userID, id)
+	if err != nil {
+		sendWebhookError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Webhook retrieved successfully", webhook)
+}
+
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhook, err := h.service.UpdateWebhook(userID, id, &req)
+	if err != nil {
+		sendWebhookError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Webhook updated successfully", webhook)
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteWebhook(userID, id); err != nil {
+		sendWebhookError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Webhook deleted successfully", nil)
+}
+
+// TestWebhook sends a test event to the webhook and returns how it went
+func (h *WebhookHandler) TestWebhook(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.service.TestWebhook(userID, id)
+	if err != nil {
+		sendWebhookError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Webhook test sent", delivery)
+}
+
+func (h *WebhookHandler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.service.GetDeliveries(userID, id)
+	if err != nil {
+		sendWebhookError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Webhook deliveries retrieved successfully", deliveries)
+}
+
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := requestIDs(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.service.Redeliver(userID, id)
+	if err != nil {
+		sendWebhookError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Webhook delivery resent", delivery)
+}
@@ -0,0 +1,279 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// deliveryTimeout bounds one attempt, so a hung endpoint doesn't hold a
+// delivery forever
+const deliveryTimeout = 15 * time.Second
+
+// retryBackoff is the wait before the second attempt; it doubles with every
+// attempt after that, up to maxRetryBackoff
+const (
+	retryBackoff    = 10 * time.Second
+	maxRetryBackoff = 10 * time.Minute
+)
+
+// maxResponseLog is how much of a response body the delivery log keeps
+const maxResponseLog = 1024
+
+// deliveryRetention is how long delivery attempts are logged
+const deliveryRetention = 30 * 24 * time.Hour
+
+// Headers of a webhook request. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the webhook's secret, so receivers can check the
+// request came from Velld and reject replays of old ones.
+const (
+	HeaderEvent     = "X-Velld-Event"
+	HeaderDelivery  = "X-Velld-Delivery"
+	HeaderTimestamp = "X-Velld-Timestamp"
+	HeaderSignature = "X-Velld-Signature"
+)
+
+// templateFuncs are available to payload templates
+var templateFuncs = template.FuncMap{
+	// json encodes a value, e.g. {{json .Message}} for a quoted string
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func validatePayloadTemplate(source string) error {
+	if len(source) > maxPayloadTemplate {
+		return &WebhookError{Reason: fmt.Sprintf("payload template must be at most %d bytes", maxPayloadTemplate)}
+	}
+	sample := &Payload{
+		ID:        uuid.New(),
+		Event:     EventTest,
+		Timestamp: time.Now(),
+		Title:     "Webhook Test",
+		Message:   "This is a test event",
+		Data:      map[string]interface{}{},
+	}
+	if _, err := renderPayload(&source, sample); err != nil {
+		return &WebhookError{Reason: err.Error()}
+	}
+	return nil
+}
+
+// renderPayload renders the request body of an event: the payload template
+// when there is one, the Payload as JSON otherwise
+func renderPayload(payloadTemplate *string, payload *Payload) (string, error) {
+	if payloadTemplate == nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode payload: %v", err)
+		}
+		return string(data), nil
+	}
+
+	tmpl, err := template.New("payload").Funcs(templateFuncs).Parse(*payloadTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid payload template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, payload); err != nil {
+		return "", fmt.Errorf("failed to render payload template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// Sign returns the signature of a request body sent at timestamp
+func Sign(secret string, timestamp int64, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", timestamp, body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatch sends an event to every enabled webhook of the user subscribed to
+// it, without waiting for them. Failed deliveries are retried in the
+// background; retries pending when the server stops are lost.
+func (s *WebhookService) Dispatch(userID uuid.UUID, event Event, title, message string, data map[string]interface{}) {
+	webhooks, err := s.repo.GetUserWebhooks(userID)
+	if err != nil {
+		slog.Warn("Failed to get webhooks for event", "event", event, "error", err)
+		return
+	}
+
+	payload := &Payload{
+		ID:        uuid.New(),
+		Event:     event,
+		Timestamp: time.Now(),
+		Title:     title,
+		Message:   message,
+		Data:      data,
+	}
+	if payload.Data == nil {
+		payload.Data = map[string]interface{}{}
+	}
+
+	for _, w := range webhooks {
+		if !w.Enabled || !w.Events.Has(event) {
+			continue
+		}
+		body, err := renderPayload(w.PayloadTemplate, payload)
+		if err != nil {
+			s.logAttempt(w, payload.ID, event, 1, body, DeliveryFailed, nil, err, 0, "")
+			continue
+		}
+		go s.deliver(w, payload.ID, event, body, w.MaxAttempts)
+	}
+}
+
+// TestWebhook sends a test event to a webhook once and returns the attempt,
+// whether it is enabled or subscribed to anything
+func (s *WebhookService) TestWebhook(userID, id uuid.UUID) (*Delivery, error) {
+	w, err := s.GetWebhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &Payload{
+		ID:        uuid.New(),
+		Event:     EventTest,
+		Timestamp: time.Now(),
+		Title:     "Webhook Test",
+		Message:   fmt.Sprintf("Test event for webhook '%s'", w.Name),
+		Data:      map[string]interface{}{"webhook_id": w.ID},
+	}
+	body, err := renderPayload(w.PayloadTemplate, payload)
+	if err != nil {
+		return nil, &WebhookError{Reason: err.Error()}
+	}
+	return s.deliver(w, payload.ID, EventTest, body, 1), nil
+}
+
+// Redeliver sends the payload of a logged delivery once more and returns the
+// attempt. It shares the event ID of the original delivery, so receivers can
+// recognize it.
+func (s *WebhookService) Redeliver(userID, deliveryID uuid.UUID) (*Delivery, error) {
+	original, err := s.repo.GetDelivery(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	w, err := s.GetWebhook(userID, original.WebhookID)
+	if err != nil {
+		return nil, err
+	}
+	return s.deliver(w, original.EventID, original.Event, original.Payload, 1), nil
+}
+
+// deliver tries to deliver body until it succeeds, fails for good or
+// maxAttempts is reached, and returns the last attempt
+func (s *WebhookService) deliver(w *Webhook, eventID uuid.UUID, event Event, body string, maxAttempts int) *Delivery {
+	secret, err := s.cryptoService.Decrypt(w.encryptedSecret)
+	if err != nil {
+		return s.logAttempt(w, eventID, event, 1, body, DeliveryFailed, nil,
+			fmt.Errorf("failed to decrypt webhook secret: %v", err), 0, "")
+	}
+
+	backoff := retryBackoff
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		statusCode, responseBody, sendErr := s.send(w, secret, eventID, event, body)
+		duration := time.Since(start)
+
+		if sendErr == nil {
+			return s.logAttempt(w, eventID, event, attempt, body, DeliveryDelivered, &statusCode, nil, duration, responseBody)
+		}
+
+		var code *int
+		if statusCode != 0 {
+			code = &statusCode
+		}
+		if attempt >= maxAttempts || !retryable(statusCode) {
+			return s.logAttempt(w, eventID, event, attempt, body, DeliveryFailed, code, sendErr, duration, responseBody)
+		}
+		s.logAttempt(w, eventID, event, attempt, body, DeliveryRetrying, code, sendErr, duration, responseBody)
+
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// retryable tells whether a failed attempt may succeed later: network errors
+// (no status code), timeouts, rate limits and server errors. Other client
+// errors will fail the same way again.
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// send posts body to the webhook and returns the status code and the start
+// of the response body. Any status other than 2xx is an error.
+func (s *WebhookService) send(w *Webhook, secret string, eventID uuid.UUID, event Event, body string) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewBufferString(body))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create request: %v", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", w.ContentType)
+	req.Header.Set("User-Agent", "Velld-Webhook")
+	req.Header.Set(HeaderEvent, string(event))
+	req.Header.Set(HeaderDelivery, eventID.String())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseLog))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(responseBody), fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, string(responseBody), nil
+}
+
+// logAttempt records an attempt in the delivery log and returns it
+func (s *WebhookService) logAttempt(w *Webhook, eventID uuid.UUID, event Event, attempt int, body, status string,
+	statusCode *int, attemptErr error, duration time.Duration, responseBody string) *Delivery {
+	d := &Delivery{
+		ID:         uuid.New(),
+		WebhookID:  w.ID,
+		UserID:     w.UserID,
+		EventID:    eventID,
+		Event:      event,
+		Attempt:    attempt,
+		Status:     status,
+		StatusCode: statusCode,
+		DurationMs: duration.Milliseconds(),
+		Payload:    body,
+		CreatedAt:  time.Now(),
+	}
+	if attemptErr != nil {
+		message := attemptErr.Error()
+		d.Error = &message
+	}
+	if responseBody != "" {
+		d.Response = &responseBody
+	}
+
+	if err := s.repo.CreateDelivery(d); err != nil {
+		slog.Warn("Failed to log webhook delivery", "webhook_id", w.ID, "error", err)
+	}
+	if err := s.repo.DeleteDeliveriesBefore(time.Now().Add(-deliveryRetention)); err != nil {
+		slog.Warn("Failed to prune webhook deliveries", "webhook_id", w.ID, "error", err)
+	}
+	return d
+}
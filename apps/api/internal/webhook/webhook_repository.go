@@ -0,0 +1,186 @@
+package webhook
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/google/uuid"
+)
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+const webhookColumns = `id, user_id, name, url, events, payload_template, content_type,
+	max_attempts, secret, enabled, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	w := &Webhook{}
+	var payloadTemplate sql.NullString
+	var createdAtStr, updatedAtStr string
+	if err := row.Scan(&w.ID, &w.UserID, &w.Name, &w.URL, &w.Events, &payloadTemplate, &w.ContentType,
+		&w.MaxAttempts, &w.encryptedSecret, &w.Enabled, &createdAtStr, &updatedAtStr); err != nil {
+		return nil, err
+	}
+	if payloadTemplate.Valid {
+		w.PayloadTemplate = &payloadTemplate.String
+	}
+
+	var err error
+	if w.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, err
+	}
+	if w.UpdatedAt, err = common.ParseTime(updatedAtStr); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (r *WebhookRepository) CreateWebhook(w *Webhook) error {
+	_, err := r.db.Exec(`
+		INSERT INTO webhooks (`+webhookColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		w.ID, w.UserID, w.Name, w.URL, w.Events, w.PayloadTemplate, w.ContentType,
+		w.MaxAttempts, w.encryptedSecret, w.Enabled,
+		w.CreatedAt.Format(time.RFC3339), w.UpdatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *WebhookRepository) UpdateWebhook(w *Webhook) error {
+	_, err := r.db.Exec(`
+		UPDATE webhooks
+		SET name = $1, url = $2, events = $3, payload_template = $4, content_type = $5,
+			max_attempts = $6, secret = $7, enabled = $8, updated_at = $9
+		WHERE id = $10`,
+		w.Name, w.URL, w.Events, w.PayloadTemplate, w.ContentType,
+		w.MaxAttempts, w.encryptedSecret, w.Enabled, w.UpdatedAt.Format(time.RFC3339), w.ID)
+	return err
+}
+
+// DeleteWebhook removes a webhook with its delivery log
+func (r *WebhookRepository) DeleteWebhook(id uuid.UUID) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM webhooks WHERE id = $1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *WebhookRepository) GetWebhook(id uuid.UUID) (*Webhook, error) {
+	row := r.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id)
+	return scanWebhook(row)
+}
+
+func (r *WebhookRepository) GetUserWebhooks(userID uuid.UUID) ([]*Webhook, error) {
+	rows, err := r.db.Query(`
+		SELECT `+webhookColumns+`
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+const deliveryColumns = `id, webhook_id, user_id, event_id, event, attempt, status, status_code,
+	error, duration_ms, payload, response, created_at`
+
+func scanDelivery(row rowScanner) (*Delivery, error) {
+	d := &Delivery{}
+	var statusCode sql.NullInt64
+	var errorMsg, responseBody sql.NullString
+	var createdAtStr string
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.UserID, &d.EventID, &d.Event, &d.Attempt, &d.Status, &statusCode,
+		&errorMsg, &d.DurationMs, &d.Payload, &responseBody, &createdAtStr); err != nil {
+		return nil, err
+	}
+	if statusCode.Valid {
+		code := int(statusCode.Int64)
+		d.StatusCode = &code
+	}
+	if errorMsg.Valid {
+		d.Error = &errorMsg.String
+	}
+	if responseBody.Valid {
+		d.Response = &responseBody.String
+	}
+
+	var err error
+	if d.CreatedAt, err = common.ParseTime(createdAtStr); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (r *WebhookRepository) CreateDelivery(d *Delivery) error {
+	_, err := r.db.Exec(`
+		INSERT INTO webhook_deliveries (`+deliveryColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		d.ID, d.WebhookID, d.UserID, d.EventID, d.Event, d.Attempt, d.Status, d.StatusCode,
+		d.Error, d.DurationMs, d.Payload, d.Response, d.CreatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *WebhookRepository) GetDelivery(id uuid.UUID) (*Delivery, error) {
+	row := r.db.QueryRow(`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id)
+	return scanDelivery(row)
+}
+
+// GetWebhookDeliveries returns the latest delivery attempts of a webhook,
+// newest first
+func (r *WebhookRepository) GetWebhookDeliveries(webhookID uuid.UUID, limit int) ([]*Delivery, error) {
+	rows, err := r.db.Query(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY created_at DESC, attempt DESC
+		LIMIT $2`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*Delivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// DeleteDeliveriesBefore prunes the delivery log
+func (r *WebhookRepository) DeleteDeliveriesBefore(before time.Time) error {
+	_, err := r.db.Exec("DELETE FROM webhook_deliveries WHERE created_at < $1", before.Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,245 @@
+package webhook
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultContentType = "application/json"
+	defaultMaxAttempts = 5
+	maxMaxAttempts     = 10
+	maxNameLength      = 100
+	maxPayloadTemplate = 64 * 1024
+)
+
+// WebhookError is a webhook request that cannot be saved as submitted
+type WebhookError struct {
+	Reason string
+}
+
+func (e *WebhookError) Error() string {
+	return e.Reason
+}
+
+type WebhookService struct {
+	repo          *WebhookRepository
+	cryptoService *common.EncryptionService
+	client        *http.Client
+}
+
+func NewWebhookService(repo *WebhookRepository, cryptoService *common.EncryptionService) *WebhookService {
+	return &WebhookService{
+		repo:          repo,
+		cryptoService: cryptoService,
+		client:        &http.Client{Timeout: deliveryTimeout},
+	}
+}
+
+func (s *WebhookService) GetWebhooks(userID uuid.UUID) ([]*Webhook, error) {
+	return s.repo.GetUserWebhooks(userID)
+}
+
+// GetWebhook returns a webhook of the user; others are not found
+func (s *WebhookService) GetWebhook(userID, id uuid.UUID) (*Webhook, error) {
+	w, err := s.repo.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	if w.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+	return w, nil
+}
+
+func (s *WebhookService) CreateWebhook(userID uuid.UUID, req *WebhookRequest) (*Webhook, error) {
+	if req.Name == nil || req.URL == nil || req.Events == nil {
+		return nil, &WebhookError{Reason: "name, url and events are required"}
+	}
+
+	now := time.Now()
+	w := &Webhook{
+		ID:          uuid.New(),
+		UserID:      userID,
+		ContentType: defaultContentType,
+		MaxAttempts: defaultMaxAttempts,
+		Enabled:     true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if req.Secret == nil {
+		req.RotateSecret = true
+	}
+	if err := s.applyRequest(w, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateWebhook(w); err != nil {
+		return nil, fmt.Errorf("failed to save webhook: %v", err)
+	}
+	return w, nil
+}
+
+func (s *WebhookService) UpdateWebhook(userID, id uuid.UUID, req *WebhookRequest) (*Webhook, error) {
+	w, err := s.GetWebhook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyRequest(w, req); err != nil {
+		return nil, err
+	}
+
+	w.UpdatedAt = time.Now()
+	if err := s.repo.UpdateWebhook(w); err != nil {
+		return nil, fmt.Errorf("failed to update webhook: %v", err)
+	}
+	return w, nil
+}
+
+func (s *WebhookService) DeleteWebhook(userID, id uuid.UUID) error {
+	if _, err := s.GetWebhook(userID, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteWebhook(id)
+}
+
+// applyRequest validates the fields set in req and copies them to w
+func (s *WebhookService) applyRequest(w *Webhook, req *WebhookRequest) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > maxNameLength {
+			return &WebhookError{Reason: fmt.Sprintf("name must be 1 to %d characters", maxNameLength)}
+		}
+		w.Name = name
+	}
+
+	if req.URL != nil {
+		target, err := validateURL(*req.URL)
+		if err != nil {
+			return err
+		}
+		w.URL = target
+	}
+
+	if req.Events != nil {
+		events, err := validateEvents(req.Events)
+		if err != nil {
+			return err
+		}
+		w.Events = events
+	}
+
+	if req.ContentType != nil {
+		contentType := strings.TrimSpace(*req.ContentType)
+		if contentType == "" {
+			contentType = defaultContentType
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return &WebhookError{Reason: fmt.Sprintf("invalid content type: %v", err)}
+		}
+		w.ContentType = contentType
+	}
+
+	if req.PayloadTemplate != nil {
+		w.PayloadTemplate = nil
+		if strings.TrimSpace(*req.PayloadTemplate) != "" {
+			if err := validatePayloadTemplate(*req.PayloadTemplate); err != nil {
+				return err
+			}
+			w.PayloadTemplate = req.PayloadTemplate
+		}
+	}
+
+	if req.MaxAttempts != nil {
+		if *req.MaxAttempts < 1 || *req.MaxAttempts > maxMaxAttempts {
+			return &WebhookError{Reason: fmt.Sprintf("max_attempts must be between 1 and %d", maxMaxAttempts)}
+		}
+		w.MaxAttempts = *req.MaxAttempts
+	}
+
+	if req.Enabled != nil {
+		w.Enabled = *req.Enabled
+	}
+
+	secret := ""
+	if req.Secret != nil {
+		secret = strings.TrimSpace(*req.Secret)
+		if secret == "" {
+			return &WebhookError{Reason: "secret cannot be empty"}
+		}
+	} else if req.RotateSecret {
+		generated, err := generateSecret()
+		if err != nil {
+			return err
+		}
+		secret = generated
+	}
+	if secret != "" {
+		encrypted, err := s.cryptoService.Encrypt(secret)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt webhook secret: %v", err)
+		}
+		w.encryptedSecret = encrypted
+		w.Secret = secret
+	}
+
+	return nil
+}
+
+func validateURL(raw string) (string, error) {
+	trimmed := strings.TrimSpace(raw)
+	u, err := url.Parse(trimmed)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", &WebhookError{Reason: "url must be an http or https URL"}
+	}
+	return trimmed, nil
+}
+
+func validateEvents(requested []string) (Events, error) {
+	events := Events{}
+	seen := make(map[string]bool)
+	for _, event := range requested {
+		event = strings.TrimSpace(event)
+		if event != EventAll && !knownEvents[Event(event)] {
+			return nil, &WebhookError{Reason: fmt.Sprintf("unknown webhook event %q", event)}
+		}
+		if seen[event] {
+			continue
+		}
+		seen[event] = true
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		return nil, &WebhookError{Reason: "a webhook needs at least one event"}
+	}
+	return events, nil
+}
+
+// generateSecret returns a random signing secret
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %v", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// deliveryListLimit is how many delivery attempts of a webhook are listed
+const deliveryListLimit = 100
+
+func (s *WebhookService) GetDeliveries(userID, webhookID uuid.UUID) ([]*Delivery, error) {
+	if _, err := s.GetWebhook(userID, webhookID); err != nil {
+		return nil, err
+	}
+	return s.repo.GetWebhookDeliveries(webhookID, deliveryListLimit)
+}